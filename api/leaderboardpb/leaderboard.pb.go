@@ -0,0 +1,684 @@
+// 排行榜 gRPC 接口定义，语义与 HTTP 接口（/game/rank）一致，由同一个 LeaderboardService 实现
+// 服务端为 internal/grpcserver（GRPC_ENABLED、GRPC_PORT），Go 代码生成在 api/leaderboardpb，修改后在仓库根目录重新生成：
+//   protoc --go_out=. --go_opt=module=game-leaderboard --go-grpc_out=. --go-grpc_opt=module=game-leaderboard api/proto/leaderboard.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: api/proto/leaderboard.proto
+
+package leaderboardpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// 排名方式，未指定时使用服务配置
+type RankingMethod int32
+
+const (
+	RankingMethod_RANKING_METHOD_UNSPECIFIED RankingMethod = 0
+	RankingMethod_RANKING_METHOD_STANDARD    RankingMethod = 1
+	RankingMethod_RANKING_METHOD_DENSE       RankingMethod = 2
+)
+
+// Enum value maps for RankingMethod.
+var (
+	RankingMethod_name = map[int32]string{
+		0: "RANKING_METHOD_UNSPECIFIED",
+		1: "RANKING_METHOD_STANDARD",
+		2: "RANKING_METHOD_DENSE",
+	}
+	RankingMethod_value = map[string]int32{
+		"RANKING_METHOD_UNSPECIFIED": 0,
+		"RANKING_METHOD_STANDARD":    1,
+		"RANKING_METHOD_DENSE":       2,
+	}
+)
+
+func (x RankingMethod) Enum() *RankingMethod {
+	p := new(RankingMethod)
+	*p = x
+	return p
+}
+
+func (x RankingMethod) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (RankingMethod) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_proto_leaderboard_proto_enumTypes[0].Descriptor()
+}
+
+func (RankingMethod) Type() protoreflect.EnumType {
+	return &file_api_proto_leaderboard_proto_enumTypes[0]
+}
+
+func (x RankingMethod) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use RankingMethod.Descriptor instead.
+func (RankingMethod) EnumDescriptor() ([]byte, []int) {
+	return file_api_proto_leaderboard_proto_rawDescGZIP(), []int{0}
+}
+
+type UpdateScoreRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	PlayerId string                 `protobuf:"bytes,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+	// 分数增量
+	IncrScore int64  `protobuf:"varint,2,opt,name=incr_score,json=incrScore,proto3" json:"incr_score,omitempty"`
+	Name      string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Reason    string `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	// 不允许为 true，覆盖总分只能通过 HTTP 管理员接口 PUT /game/rank/user/{player_id}/score
+	SetAbsolute bool `protobuf:"varint,5,opt,name=set_absolute,json=setAbsolute,proto3" json:"set_absolute,omitempty"`
+	// 大于 0 时本次增量在该秒数后到期并从总分中扣回
+	TtlSeconds int64 `protobuf:"varint,6,opt,name=ttl_seconds,json=ttlSeconds,proto3" json:"ttl_seconds,omitempty"`
+	// 同一键在有效期内只生效一次
+	IdempotencyKey string `protobuf:"bytes,7,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *UpdateScoreRequest) Reset() {
+	*x = UpdateScoreRequest{}
+	mi := &file_api_proto_leaderboard_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateScoreRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateScoreRequest) ProtoMessage() {}
+
+func (x *UpdateScoreRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_leaderboard_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateScoreRequest.ProtoReflect.Descriptor instead.
+func (*UpdateScoreRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_leaderboard_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UpdateScoreRequest) GetPlayerId() string {
+	if x != nil {
+		return x.PlayerId
+	}
+	return ""
+}
+
+func (x *UpdateScoreRequest) GetIncrScore() int64 {
+	if x != nil {
+		return x.IncrScore
+	}
+	return 0
+}
+
+func (x *UpdateScoreRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *UpdateScoreRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *UpdateScoreRequest) GetSetAbsolute() bool {
+	if x != nil {
+		return x.SetAbsolute
+	}
+	return false
+}
+
+func (x *UpdateScoreRequest) GetTtlSeconds() int64 {
+	if x != nil {
+		return x.TtlSeconds
+	}
+	return 0
+}
+
+func (x *UpdateScoreRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+type UpdateScoreResponse struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	PlayerId    string                 `protobuf:"bytes,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+	ScoreChange int64                  `protobuf:"varint,2,opt,name=score_change,json=scoreChange,proto3" json:"score_change,omitempty"`
+	SetAbsolute bool                   `protobuf:"varint,3,opt,name=set_absolute,json=setAbsolute,proto3" json:"set_absolute,omitempty"`
+	// 使用已处理过的幂等键时为 true，返回首次处理的结果
+	Replayed      bool `protobuf:"varint,4,opt,name=replayed,proto3" json:"replayed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateScoreResponse) Reset() {
+	*x = UpdateScoreResponse{}
+	mi := &file_api_proto_leaderboard_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateScoreResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateScoreResponse) ProtoMessage() {}
+
+func (x *UpdateScoreResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_leaderboard_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateScoreResponse.ProtoReflect.Descriptor instead.
+func (*UpdateScoreResponse) Descriptor() ([]byte, []int) {
+	return file_api_proto_leaderboard_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UpdateScoreResponse) GetPlayerId() string {
+	if x != nil {
+		return x.PlayerId
+	}
+	return ""
+}
+
+func (x *UpdateScoreResponse) GetScoreChange() int64 {
+	if x != nil {
+		return x.ScoreChange
+	}
+	return 0
+}
+
+func (x *UpdateScoreResponse) GetSetAbsolute() bool {
+	if x != nil {
+		return x.SetAbsolute
+	}
+	return false
+}
+
+func (x *UpdateScoreResponse) GetReplayed() bool {
+	if x != nil {
+		return x.Replayed
+	}
+	return false
+}
+
+type GetPlayerRankRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PlayerId      string                 `protobuf:"bytes,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+	Method        RankingMethod          `protobuf:"varint,2,opt,name=method,proto3,enum=leaderboard.v1.RankingMethod" json:"method,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPlayerRankRequest) Reset() {
+	*x = GetPlayerRankRequest{}
+	mi := &file_api_proto_leaderboard_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPlayerRankRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPlayerRankRequest) ProtoMessage() {}
+
+func (x *GetPlayerRankRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_leaderboard_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPlayerRankRequest.ProtoReflect.Descriptor instead.
+func (*GetPlayerRankRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_leaderboard_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetPlayerRankRequest) GetPlayerId() string {
+	if x != nil {
+		return x.PlayerId
+	}
+	return ""
+}
+
+func (x *GetPlayerRankRequest) GetMethod() RankingMethod {
+	if x != nil {
+		return x.Method
+	}
+	return RankingMethod_RANKING_METHOD_UNSPECIFIED
+}
+
+type GetTopNRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	N     int32                  `protobuf:"varint,1,opt,name=n,proto3" json:"n,omitempty"`
+	// daily、weekly、monthly，为空时为全服总榜
+	Window        string        `protobuf:"bytes,2,opt,name=window,proto3" json:"window,omitempty"`
+	Method        RankingMethod `protobuf:"varint,3,opt,name=method,proto3,enum=leaderboard.v1.RankingMethod" json:"method,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTopNRequest) Reset() {
+	*x = GetTopNRequest{}
+	mi := &file_api_proto_leaderboard_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTopNRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTopNRequest) ProtoMessage() {}
+
+func (x *GetTopNRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_leaderboard_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTopNRequest.ProtoReflect.Descriptor instead.
+func (*GetTopNRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_leaderboard_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetTopNRequest) GetN() int32 {
+	if x != nil {
+		return x.N
+	}
+	return 0
+}
+
+func (x *GetTopNRequest) GetWindow() string {
+	if x != nil {
+		return x.Window
+	}
+	return ""
+}
+
+func (x *GetTopNRequest) GetMethod() RankingMethod {
+	if x != nil {
+		return x.Method
+	}
+	return RankingMethod_RANKING_METHOD_UNSPECIFIED
+}
+
+type GetPlayerRankRangeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PlayerId      string                 `protobuf:"bytes,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+	Range         int32                  `protobuf:"varint,2,opt,name=range,proto3" json:"range,omitempty"`
+	Method        RankingMethod          `protobuf:"varint,3,opt,name=method,proto3,enum=leaderboard.v1.RankingMethod" json:"method,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPlayerRankRangeRequest) Reset() {
+	*x = GetPlayerRankRangeRequest{}
+	mi := &file_api_proto_leaderboard_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPlayerRankRangeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPlayerRankRangeRequest) ProtoMessage() {}
+
+func (x *GetPlayerRankRangeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_leaderboard_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPlayerRankRangeRequest.ProtoReflect.Descriptor instead.
+func (*GetPlayerRankRangeRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_leaderboard_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetPlayerRankRangeRequest) GetPlayerId() string {
+	if x != nil {
+		return x.PlayerId
+	}
+	return ""
+}
+
+func (x *GetPlayerRankRangeRequest) GetRange() int32 {
+	if x != nil {
+		return x.Range
+	}
+	return 0
+}
+
+func (x *GetPlayerRankRangeRequest) GetMethod() RankingMethod {
+	if x != nil {
+		return x.Method
+	}
+	return RankingMethod_RANKING_METHOD_UNSPECIFIED
+}
+
+type RankInfo struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	PlayerId string                 `protobuf:"bytes,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+	Rank     int32                  `protobuf:"varint,2,opt,name=rank,proto3" json:"rank,omitempty"`
+	Score    int64                  `protobuf:"varint,3,opt,name=score,proto3" json:"score,omitempty"`
+	Name     string                 `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
+	// Unix 秒，未知时为 0
+	UpdatedAt int64 `protobuf:"varint,5,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	// 排名来自后台预计算结果
+	Approximate bool `protobuf:"varint,6,opt,name=approximate,proto3" json:"approximate,omitempty"`
+	// Redis 不可用时返回的已过期缓存
+	Stale bool `protobuf:"varint,7,opt,name=stale,proto3" json:"stale,omitempty"`
+	// Redis 不可用时由 MySQL 统计的结果
+	Fallback      bool `protobuf:"varint,8,opt,name=fallback,proto3" json:"fallback,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RankInfo) Reset() {
+	*x = RankInfo{}
+	mi := &file_api_proto_leaderboard_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RankInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RankInfo) ProtoMessage() {}
+
+func (x *RankInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_leaderboard_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RankInfo.ProtoReflect.Descriptor instead.
+func (*RankInfo) Descriptor() ([]byte, []int) {
+	return file_api_proto_leaderboard_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RankInfo) GetPlayerId() string {
+	if x != nil {
+		return x.PlayerId
+	}
+	return ""
+}
+
+func (x *RankInfo) GetRank() int32 {
+	if x != nil {
+		return x.Rank
+	}
+	return 0
+}
+
+func (x *RankInfo) GetScore() int64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *RankInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *RankInfo) GetUpdatedAt() int64 {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return 0
+}
+
+func (x *RankInfo) GetApproximate() bool {
+	if x != nil {
+		return x.Approximate
+	}
+	return false
+}
+
+func (x *RankInfo) GetStale() bool {
+	if x != nil {
+		return x.Stale
+	}
+	return false
+}
+
+func (x *RankInfo) GetFallback() bool {
+	if x != nil {
+		return x.Fallback
+	}
+	return false
+}
+
+type RankList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Rankings      []*RankInfo            `protobuf:"bytes,1,rep,name=rankings,proto3" json:"rankings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RankList) Reset() {
+	*x = RankList{}
+	mi := &file_api_proto_leaderboard_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RankList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RankList) ProtoMessage() {}
+
+func (x *RankList) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_leaderboard_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RankList.ProtoReflect.Descriptor instead.
+func (*RankList) Descriptor() ([]byte, []int) {
+	return file_api_proto_leaderboard_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *RankList) GetRankings() []*RankInfo {
+	if x != nil {
+		return x.Rankings
+	}
+	return nil
+}
+
+var File_api_proto_leaderboard_proto protoreflect.FileDescriptor
+
+const file_api_proto_leaderboard_proto_rawDesc = "" +
+	"\n" +
+	"\x1bapi/proto/leaderboard.proto\x12\x0eleaderboard.v1\"\xe9\x01\n" +
+	"\x12UpdateScoreRequest\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\tR\bplayerId\x12\x1d\n" +
+	"\n" +
+	"incr_score\x18\x02 \x01(\x03R\tincrScore\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12!\n" +
+	"\fset_absolute\x18\x05 \x01(\bR\vsetAbsolute\x12\x1f\n" +
+	"\vttl_seconds\x18\x06 \x01(\x03R\n" +
+	"ttlSeconds\x12'\n" +
+	"\x0fidempotency_key\x18\a \x01(\tR\x0eidempotencyKey\"\x94\x01\n" +
+	"\x13UpdateScoreResponse\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\tR\bplayerId\x12!\n" +
+	"\fscore_change\x18\x02 \x01(\x03R\vscoreChange\x12!\n" +
+	"\fset_absolute\x18\x03 \x01(\bR\vsetAbsolute\x12\x1a\n" +
+	"\breplayed\x18\x04 \x01(\bR\breplayed\"j\n" +
+	"\x14GetPlayerRankRequest\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\tR\bplayerId\x125\n" +
+	"\x06method\x18\x02 \x01(\x0e2\x1d.leaderboard.v1.RankingMethodR\x06method\"m\n" +
+	"\x0eGetTopNRequest\x12\f\n" +
+	"\x01n\x18\x01 \x01(\x05R\x01n\x12\x16\n" +
+	"\x06window\x18\x02 \x01(\tR\x06window\x125\n" +
+	"\x06method\x18\x03 \x01(\x0e2\x1d.leaderboard.v1.RankingMethodR\x06method\"\x85\x01\n" +
+	"\x19GetPlayerRankRangeRequest\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\tR\bplayerId\x12\x14\n" +
+	"\x05range\x18\x02 \x01(\x05R\x05range\x125\n" +
+	"\x06method\x18\x03 \x01(\x0e2\x1d.leaderboard.v1.RankingMethodR\x06method\"\xd8\x01\n" +
+	"\bRankInfo\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\tR\bplayerId\x12\x12\n" +
+	"\x04rank\x18\x02 \x01(\x05R\x04rank\x12\x14\n" +
+	"\x05score\x18\x03 \x01(\x03R\x05score\x12\x12\n" +
+	"\x04name\x18\x04 \x01(\tR\x04name\x12\x1d\n" +
+	"\n" +
+	"updated_at\x18\x05 \x01(\x03R\tupdatedAt\x12 \n" +
+	"\vapproximate\x18\x06 \x01(\bR\vapproximate\x12\x14\n" +
+	"\x05stale\x18\a \x01(\bR\x05stale\x12\x1a\n" +
+	"\bfallback\x18\b \x01(\bR\bfallback\"@\n" +
+	"\bRankList\x124\n" +
+	"\brankings\x18\x01 \x03(\v2\x18.leaderboard.v1.RankInfoR\brankings*f\n" +
+	"\rRankingMethod\x12\x1e\n" +
+	"\x1aRANKING_METHOD_UNSPECIFIED\x10\x00\x12\x1b\n" +
+	"\x17RANKING_METHOD_STANDARD\x10\x01\x12\x18\n" +
+	"\x14RANKING_METHOD_DENSE\x10\x022\xd6\x02\n" +
+	"\vLeaderboard\x12V\n" +
+	"\vUpdateScore\x12\".leaderboard.v1.UpdateScoreRequest\x1a#.leaderboard.v1.UpdateScoreResponse\x12O\n" +
+	"\rGetPlayerRank\x12$.leaderboard.v1.GetPlayerRankRequest\x1a\x18.leaderboard.v1.RankInfo\x12C\n" +
+	"\aGetTopN\x12\x1e.leaderboard.v1.GetTopNRequest\x1a\x18.leaderboard.v1.RankList\x12Y\n" +
+	"\x12GetPlayerRankRange\x12).leaderboard.v1.GetPlayerRankRangeRequest\x1a\x18.leaderboard.v1.RankListB$Z\"game-leaderboard/api/leaderboardpbb\x06proto3"
+
+var (
+	file_api_proto_leaderboard_proto_rawDescOnce sync.Once
+	file_api_proto_leaderboard_proto_rawDescData []byte
+)
+
+func file_api_proto_leaderboard_proto_rawDescGZIP() []byte {
+	file_api_proto_leaderboard_proto_rawDescOnce.Do(func() {
+		file_api_proto_leaderboard_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_proto_leaderboard_proto_rawDesc), len(file_api_proto_leaderboard_proto_rawDesc)))
+	})
+	return file_api_proto_leaderboard_proto_rawDescData
+}
+
+var file_api_proto_leaderboard_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_api_proto_leaderboard_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_api_proto_leaderboard_proto_goTypes = []any{
+	(RankingMethod)(0),                // 0: leaderboard.v1.RankingMethod
+	(*UpdateScoreRequest)(nil),        // 1: leaderboard.v1.UpdateScoreRequest
+	(*UpdateScoreResponse)(nil),       // 2: leaderboard.v1.UpdateScoreResponse
+	(*GetPlayerRankRequest)(nil),      // 3: leaderboard.v1.GetPlayerRankRequest
+	(*GetTopNRequest)(nil),            // 4: leaderboard.v1.GetTopNRequest
+	(*GetPlayerRankRangeRequest)(nil), // 5: leaderboard.v1.GetPlayerRankRangeRequest
+	(*RankInfo)(nil),                  // 6: leaderboard.v1.RankInfo
+	(*RankList)(nil),                  // 7: leaderboard.v1.RankList
+}
+var file_api_proto_leaderboard_proto_depIdxs = []int32{
+	0, // 0: leaderboard.v1.GetPlayerRankRequest.method:type_name -> leaderboard.v1.RankingMethod
+	0, // 1: leaderboard.v1.GetTopNRequest.method:type_name -> leaderboard.v1.RankingMethod
+	0, // 2: leaderboard.v1.GetPlayerRankRangeRequest.method:type_name -> leaderboard.v1.RankingMethod
+	6, // 3: leaderboard.v1.RankList.rankings:type_name -> leaderboard.v1.RankInfo
+	1, // 4: leaderboard.v1.Leaderboard.UpdateScore:input_type -> leaderboard.v1.UpdateScoreRequest
+	3, // 5: leaderboard.v1.Leaderboard.GetPlayerRank:input_type -> leaderboard.v1.GetPlayerRankRequest
+	4, // 6: leaderboard.v1.Leaderboard.GetTopN:input_type -> leaderboard.v1.GetTopNRequest
+	5, // 7: leaderboard.v1.Leaderboard.GetPlayerRankRange:input_type -> leaderboard.v1.GetPlayerRankRangeRequest
+	2, // 8: leaderboard.v1.Leaderboard.UpdateScore:output_type -> leaderboard.v1.UpdateScoreResponse
+	6, // 9: leaderboard.v1.Leaderboard.GetPlayerRank:output_type -> leaderboard.v1.RankInfo
+	7, // 10: leaderboard.v1.Leaderboard.GetTopN:output_type -> leaderboard.v1.RankList
+	7, // 11: leaderboard.v1.Leaderboard.GetPlayerRankRange:output_type -> leaderboard.v1.RankList
+	8, // [8:12] is the sub-list for method output_type
+	4, // [4:8] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_api_proto_leaderboard_proto_init() }
+func file_api_proto_leaderboard_proto_init() {
+	if File_api_proto_leaderboard_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_proto_leaderboard_proto_rawDesc), len(file_api_proto_leaderboard_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_proto_leaderboard_proto_goTypes,
+		DependencyIndexes: file_api_proto_leaderboard_proto_depIdxs,
+		EnumInfos:         file_api_proto_leaderboard_proto_enumTypes,
+		MessageInfos:      file_api_proto_leaderboard_proto_msgTypes,
+	}.Build()
+	File_api_proto_leaderboard_proto = out.File
+	file_api_proto_leaderboard_proto_goTypes = nil
+	file_api_proto_leaderboard_proto_depIdxs = nil
+}
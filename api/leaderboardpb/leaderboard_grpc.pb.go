@@ -0,0 +1,247 @@
+// 排行榜 gRPC 接口定义，语义与 HTTP 接口（/game/rank）一致，由同一个 LeaderboardService 实现
+// 服务端为 internal/grpcserver（GRPC_ENABLED、GRPC_PORT），Go 代码生成在 api/leaderboardpb，修改后在仓库根目录重新生成：
+//   protoc --go_out=. --go_opt=module=game-leaderboard --go-grpc_out=. --go-grpc_opt=module=game-leaderboard api/proto/leaderboard.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: api/proto/leaderboard.proto
+
+package leaderboardpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Leaderboard_UpdateScore_FullMethodName        = "/leaderboard.v1.Leaderboard/UpdateScore"
+	Leaderboard_GetPlayerRank_FullMethodName      = "/leaderboard.v1.Leaderboard/GetPlayerRank"
+	Leaderboard_GetTopN_FullMethodName            = "/leaderboard.v1.Leaderboard/GetTopN"
+	Leaderboard_GetPlayerRankRange_FullMethodName = "/leaderboard.v1.Leaderboard/GetPlayerRankRange"
+)
+
+// LeaderboardClient is the client API for Leaderboard service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LeaderboardClient interface {
+	// 更新玩家分数，对应 POST /game/rank/upscores
+	UpdateScore(ctx context.Context, in *UpdateScoreRequest, opts ...grpc.CallOption) (*UpdateScoreResponse, error)
+	// 获取玩家排名，对应 GET /game/rank/user/:playerId
+	GetPlayerRank(ctx context.Context, in *GetPlayerRankRequest, opts ...grpc.CallOption) (*RankInfo, error)
+	// 获取前N名玩家，对应 GET /game/rank/top/:n；超过服务配置的上限时按上限截断，n 为 0 时返回空列表
+	GetTopN(ctx context.Context, in *GetTopNRequest, opts ...grpc.CallOption) (*RankList, error)
+	// 获取玩家周边排名，对应 GET /game/rank/range/:playerId/:range
+	GetPlayerRankRange(ctx context.Context, in *GetPlayerRankRangeRequest, opts ...grpc.CallOption) (*RankList, error)
+}
+
+type leaderboardClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLeaderboardClient(cc grpc.ClientConnInterface) LeaderboardClient {
+	return &leaderboardClient{cc}
+}
+
+func (c *leaderboardClient) UpdateScore(ctx context.Context, in *UpdateScoreRequest, opts ...grpc.CallOption) (*UpdateScoreResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateScoreResponse)
+	err := c.cc.Invoke(ctx, Leaderboard_UpdateScore_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *leaderboardClient) GetPlayerRank(ctx context.Context, in *GetPlayerRankRequest, opts ...grpc.CallOption) (*RankInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RankInfo)
+	err := c.cc.Invoke(ctx, Leaderboard_GetPlayerRank_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *leaderboardClient) GetTopN(ctx context.Context, in *GetTopNRequest, opts ...grpc.CallOption) (*RankList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RankList)
+	err := c.cc.Invoke(ctx, Leaderboard_GetTopN_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *leaderboardClient) GetPlayerRankRange(ctx context.Context, in *GetPlayerRankRangeRequest, opts ...grpc.CallOption) (*RankList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RankList)
+	err := c.cc.Invoke(ctx, Leaderboard_GetPlayerRankRange_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LeaderboardServer is the server API for Leaderboard service.
+// All implementations must embed UnimplementedLeaderboardServer
+// for forward compatibility.
+type LeaderboardServer interface {
+	// 更新玩家分数，对应 POST /game/rank/upscores
+	UpdateScore(context.Context, *UpdateScoreRequest) (*UpdateScoreResponse, error)
+	// 获取玩家排名，对应 GET /game/rank/user/:playerId
+	GetPlayerRank(context.Context, *GetPlayerRankRequest) (*RankInfo, error)
+	// 获取前N名玩家，对应 GET /game/rank/top/:n；超过服务配置的上限时按上限截断，n 为 0 时返回空列表
+	GetTopN(context.Context, *GetTopNRequest) (*RankList, error)
+	// 获取玩家周边排名，对应 GET /game/rank/range/:playerId/:range
+	GetPlayerRankRange(context.Context, *GetPlayerRankRangeRequest) (*RankList, error)
+	mustEmbedUnimplementedLeaderboardServer()
+}
+
+// UnimplementedLeaderboardServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLeaderboardServer struct{}
+
+func (UnimplementedLeaderboardServer) UpdateScore(context.Context, *UpdateScoreRequest) (*UpdateScoreResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateScore not implemented")
+}
+func (UnimplementedLeaderboardServer) GetPlayerRank(context.Context, *GetPlayerRankRequest) (*RankInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPlayerRank not implemented")
+}
+func (UnimplementedLeaderboardServer) GetTopN(context.Context, *GetTopNRequest) (*RankList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTopN not implemented")
+}
+func (UnimplementedLeaderboardServer) GetPlayerRankRange(context.Context, *GetPlayerRankRangeRequest) (*RankList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPlayerRankRange not implemented")
+}
+func (UnimplementedLeaderboardServer) mustEmbedUnimplementedLeaderboardServer() {}
+func (UnimplementedLeaderboardServer) testEmbeddedByValue()                     {}
+
+// UnsafeLeaderboardServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LeaderboardServer will
+// result in compilation errors.
+type UnsafeLeaderboardServer interface {
+	mustEmbedUnimplementedLeaderboardServer()
+}
+
+func RegisterLeaderboardServer(s grpc.ServiceRegistrar, srv LeaderboardServer) {
+	// If the following call pancis, it indicates UnimplementedLeaderboardServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Leaderboard_ServiceDesc, srv)
+}
+
+func _Leaderboard_UpdateScore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateScoreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaderboardServer).UpdateScore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Leaderboard_UpdateScore_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaderboardServer).UpdateScore(ctx, req.(*UpdateScoreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Leaderboard_GetPlayerRank_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPlayerRankRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaderboardServer).GetPlayerRank(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Leaderboard_GetPlayerRank_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaderboardServer).GetPlayerRank(ctx, req.(*GetPlayerRankRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Leaderboard_GetTopN_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTopNRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaderboardServer).GetTopN(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Leaderboard_GetTopN_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaderboardServer).GetTopN(ctx, req.(*GetTopNRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Leaderboard_GetPlayerRankRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPlayerRankRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaderboardServer).GetPlayerRankRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Leaderboard_GetPlayerRankRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaderboardServer).GetPlayerRankRange(ctx, req.(*GetPlayerRankRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Leaderboard_ServiceDesc is the grpc.ServiceDesc for Leaderboard service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Leaderboard_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "leaderboard.v1.Leaderboard",
+	HandlerType: (*LeaderboardServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "UpdateScore",
+			Handler:    _Leaderboard_UpdateScore_Handler,
+		},
+		{
+			MethodName: "GetPlayerRank",
+			Handler:    _Leaderboard_GetPlayerRank_Handler,
+		},
+		{
+			MethodName: "GetTopN",
+			Handler:    _Leaderboard_GetTopN_Handler,
+		},
+		{
+			MethodName: "GetPlayerRankRange",
+			Handler:    _Leaderboard_GetPlayerRankRange_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "api/proto/leaderboard.proto",
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"game-leaderboard/internal/model"
+)
+
+// replay 按指定速率回放 NDJSON 格式的分数更新记录，用于压测和容量评估
+func main() {
+	file := flag.String("file", "", "NDJSON 文件路径，每行一个 UpdateRequest")
+	target := flag.String("target", "http://localhost:8080/game/rank/upscores", "分数更新接口地址")
+	rate := flag.Int("rate", 100, "每秒发送的请求数，<=0 表示不限速")
+	timeout := flag.Duration("timeout", 5*time.Second, "单个请求超时时间")
+	flag.Parse()
+
+	if *file == "" {
+		log.Fatal("-file is required")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("Failed to open replay file: %v", err)
+	}
+	defer f.Close()
+
+	client := &http.Client{Timeout: *timeout}
+
+	stats, err := replay(f, client, *target, *rate)
+	if err != nil {
+		log.Printf("Failed to read replay file: %v", err)
+	}
+
+	log.Printf("Replay finished: sent=%d failed=%d skipped=%d elapsed=%s throughput=%.1f req/s",
+		stats.sent, stats.failed, stats.skipped, stats.elapsed.Round(time.Millisecond), stats.throughput())
+
+	if stats.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// replayStats 回放结果统计
+type replayStats struct {
+	sent, failed, skipped int
+	elapsed               time.Duration
+}
+
+// throughput 每秒发送的请求数
+func (s replayStats) throughput() float64 {
+	if s.elapsed <= 0 {
+		return 0
+	}
+	return float64(s.sent) / s.elapsed.Seconds()
+}
+
+// replay 逐行读取 r 中的 UpdateRequest 并按 rate 限速发送到 target，无法解析的行跳过
+// 返回的 error 只表示读取失败，单个请求失败计入 failed
+func replay(r io.Reader, client *http.Client, target string, rate int) (replayStats, error) {
+	// 限速器
+	var ticker *time.Ticker
+	if rate > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+	}
+
+	var stats replayStats
+	start := time.Now()
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var req model.UpdateRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			log.Printf("Skipping invalid line %d: %v", lineNo, err)
+			stats.skipped++
+			continue
+		}
+
+		if ticker != nil {
+			<-ticker.C
+		}
+
+		stats.sent++
+		if err := postUpdate(client, target, &req); err != nil {
+			log.Printf("Update failed at line %d (player %s): %v", lineNo, req.PlayerID, err)
+			stats.failed++
+		}
+	}
+
+	stats.elapsed = time.Since(start)
+	return stats, scanner.Err()
+}
+
+func postUpdate(client *http.Client, target string, req *model.UpdateRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"game-leaderboard/internal/handler"
+	"game-leaderboard/internal/repository/repotest"
+	"game-leaderboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 启动使用内存存储的分数更新接口，测试结束时关闭
+func newReplayServer(t *testing.T) (*service.LeaderboardService, *httptest.Server) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	svc := service.NewLeaderboardService(repotest.NewRedisStore(false, ""), repotest.NewMySQLStore(0), service.Options{})
+	t.Cleanup(svc.Close)
+
+	router := gin.New()
+	router.POST("/game/rank/upscores", handler.NewHTTPHandler(svc, 100, 100, 100).UpdateScore)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return svc, server
+}
+
+func TestReplay(t *testing.T) {
+	svc, server := newReplayServer(t)
+
+	f, err := os.Open("testdata/updates.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	stats, err := replay(f, server.Client(), server.URL+"/game/rank/upscores", 0)
+	if err != nil {
+		t.Fatalf("replay() error = %v", err)
+	}
+	if stats.sent != 6 || stats.failed != 1 || stats.skipped != 1 {
+		t.Errorf("replay() sent=%d failed=%d skipped=%d, want sent=6 failed=1 skipped=1",
+			stats.sent, stats.failed, stats.skipped)
+	}
+
+	top, err := svc.GetTopN(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("GetTopN() error = %v", err)
+	}
+	want := []struct {
+		playerID string
+		name     string
+		score    int64
+	}{
+		{"p2", "bob", 90},
+		{"p1", "alice", 70},
+		{"p3", "carol", 60},
+	}
+	if len(top) != len(want) {
+		t.Fatalf("leaderboard has %d players, want %d", len(top), len(want))
+	}
+	for i, w := range want {
+		got := top[i]
+		if got.Rank != i+1 || got.PlayerID != w.playerID || got.Name != w.name || got.Score != w.score {
+			t.Errorf("rank %d = %s %q %d, want %s %q %d", i+1, got.PlayerID, got.Name, got.Score, w.playerID, w.name, w.score)
+		}
+	}
+}
+
+func TestReplayRateLimit(t *testing.T) {
+	_, server := newReplayServer(t)
+
+	f, err := os.Open("testdata/updates.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// 每 10ms 发送一个请求，6 个请求至少需要 60ms
+	stats, err := replay(f, server.Client(), server.URL+"/game/rank/upscores", 100)
+	if err != nil {
+		t.Fatalf("replay() error = %v", err)
+	}
+	if stats.elapsed < 50*time.Millisecond {
+		t.Errorf("replay() took %s at 100 req/s, want at least 50ms", stats.elapsed)
+	}
+}
@@ -2,65 +2,242 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
 	"syscall"
 	"time"
 
+	"game-leaderboard/internal/cache"
 	"game-leaderboard/internal/config"
+	"game-leaderboard/internal/events"
+	"game-leaderboard/internal/grpcserver"
 	"game-leaderboard/internal/handler"
+	"game-leaderboard/internal/metrics"
+	"game-leaderboard/internal/middleware"
 	"game-leaderboard/internal/repository"
 	"game-leaderboard/internal/service"
+	"game-leaderboard/internal/tracing"
 	"game-leaderboard/pkg/database"
 	"game-leaderboard/pkg/logger"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/extra/redisotel/v8"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
+// requestIDHeader 请求ID的请求头和响应头
+const requestIDHeader = "X-Request-ID"
+
+// 客户端传入的请求ID写入日志和响应头，只接受有限长度的安全字符，避免日志注入和超长日志
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
 func main() {
-	// 加载配置
-	cfg := config.LoadConfig()
+	// 加载配置，设置 CONFIG_FILE 时以配置文件为基础，环境变量优先
+	var cfg *config.Config
+	if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
+		fileCfg, err := config.LoadConfigFromFile(configFile)
+		if err != nil {
+			log.Fatal("Failed to load config file: ", err)
+		}
+		cfg = fileCfg
+	} else {
+		cfg = config.LoadConfig()
+	}
+	// 加载时校验失败只记录警告，启动服务时必须通过：部分组合（如 MAX_PLAYERS 与先写 Redis）会导致分数丢失
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
 
-	fmt.Println("cfg:", cfg)
+	if err := logger.Configure(logger.OutputOptions{
+		Output:     cfg.LogOutput,
+		File:       cfg.LogFile,
+		MaxSizeMB:  cfg.LogMaxSizeMB,
+		MaxBackups: cfg.LogMaxBackups,
+		MaxAgeDays: cfg.LogMaxAgeDays,
+		Format:     cfg.LogFormat,
+		Color:      cfg.IsDevelopment(),
+	}); err != nil {
+		log.Fatal("Failed to configure log output: ", err)
+	}
+
+	// 指标在包初始化时创建，此处加上常量标签后统一注册
+	if err := metrics.Init(cfg.MetricsConstLabels); err != nil {
+		log.Fatal("Failed to register metrics: ", err)
+	}
 
 	// 初始化数据库连接
-	mysqlDB, err := database.NewMySQLConnection(cfg.MySQLDSN, cfg.MySQLMaxConns)
+	mysqlDB, err := database.NewMySQLConnection(cfg.MySQLDSN, database.MySQLPoolOptions{
+		MaxOpenConns:    cfg.MySQLMaxConns,
+		MaxIdleConns:    cfg.MySQLIdleConns,
+		ConnMaxLifetime: cfg.MySQLConnMaxLifetime,
+		ConnMaxIdleTime: cfg.MySQLConnMaxIdleTime,
+	})
 	if err != nil {
 		log.Fatal("Failed to connect to MySQL:", err)
 	}
 	defer mysqlDB.Close()
 
-	redisClient, err := database.NewRedisConnection(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
+	if cfg.MySQLKeepaliveInterval > 0 {
+		keepaliveCtx, stopKeepalive := context.WithCancel(context.Background())
+		defer stopKeepalive()
+		database.StartMySQLKeepalive(keepaliveCtx, mysqlDB, cfg.MySQLKeepaliveInterval)
+	}
+
+	redisClient, err := database.NewRedisConnection(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, database.RedisTopology{
+		Mode:             cfg.RedisMode,
+		MasterName:       cfg.RedisMasterName,
+		SentinelAddrs:    cfg.RedisSentinelAddrs,
+		SentinelPassword: cfg.RedisSentinelPassword,
+		ClusterAddrs:     cfg.RedisClusterAddrs,
+	}, database.RedisPoolOptions{
+		PoolSize:     cfg.RedisPoolSize,
+		MinIdleConns: cfg.RedisMinIdleConns,
+		DialTimeout:  cfg.RedisDialTimeout,
+		ReadTimeout:  cfg.RedisReadTimeout,
+		WriteTimeout: cfg.RedisWriteTimeout,
+		OpTimeout:    cfg.RedisOpTimeout,
+	})
 	if err != nil {
 		log.Fatal("Failed to connect to Redis:", err)
 	}
 	defer redisClient.Close()
 
+	// 链路追踪：HTTP 请求、服务方法和 Redis/MySQL 调用
+	if cfg.TracingEnabled {
+		shutdownTracing, err := tracing.Setup(context.Background(), cfg.OTLPEndpoint, "game-leaderboard")
+		if err != nil {
+			log.Fatal("Failed to set up tracing: ", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				log.Println("Failed to flush traces:", err)
+			}
+		}()
+		redisClient.AddHook(redisotel.NewTracingHook())
+	}
+
 	// 初始化存储
-	redisRepo := repository.NewRedisRepository(redisClient)
-	mysqlRepo := repository.NewMySQLRepository(mysqlDB)
+	redisRepo := repository.NewRedisRepository(redisClient, cfg.PlayerMetadataSource != "mysql", cfg.RankOrder, cfg.MaxPlayers, repository.RetryOptions{
+		MaxRetries: cfg.RedisMaxRetries,
+		MinBackoff: cfg.RedisMinRetryBackoff,
+		MaxBackoff: cfg.RedisMaxRetryBackoff,
+	})
+	mysqlRepo := repository.NewMySQLRepository(mysqlDB, cfg.DBOpTimeout, cfg.MaxScore)
+
+	// 升级前的 Redis key 不带哈希标签，需在读取排行榜之前迁移；已完成迁移时 MigrateKeys 直接返回
+	if cfg.RedisMigrateKeys {
+		if migrated, err := redisRepo.MigrateKeys(context.Background()); err != nil {
+			log.Fatal("Failed to migrate redis keys: ", err)
+		} else if migrated > 0 {
+			logger.NewLogger("main").Info("Migrated redis keys to hash-tagged names", "count", migrated)
+		}
+	}
+
+	// 启动自检：校验存储结构与当前版本兼容
+	if cfg.SchemaCheckOnStart {
+		if err := verifySchema(mysqlRepo, redisRepo); err != nil {
+			log.Fatal("Startup schema check failed: ", err)
+		}
+	}
+
+	// 可选的 Redis L2 缓存，多实例部署时共享热点查询结果
+	var l2Cache *cache.RedisCache
+	if cfg.L2CacheEnabled {
+		l2Cache = cache.NewRedisCache(redisClient, cfg.L2CacheTTL)
+	}
+
+	// 分数变更事件发布目标
+	var eventPublisher events.EventPublisher = events.NoopPublisher{}
+	if cfg.WebhookURL != "" {
+		eventPublisher = events.NewWebhookPublisher(cfg.WebhookURL, cfg.WebhookTimeout)
+	}
+
+	// 未启用衰减时不运行衰减任务
+	var decayInterval time.Duration
+	if cfg.DecayEnabled {
+		decayInterval = cfg.DecayInterval
+	}
 
 	// 初始化服务
 	leaderboardService := service.NewLeaderboardService(
 		redisRepo,
 		mysqlRepo,
-		cfg.RankingMethod,
-		cfg.EnableCache,
+		service.Options{
+			RankingMethod:       cfg.RankingMethod,
+			UpdateMode:          cfg.ScoreUpdateMode,
+			WriteMode:           cfg.WriteMode,
+			MaxScore:            cfg.MaxScore,
+			ReasonMultipliers:   cfg.ReasonMultipliers,
+			EnableCache:         cfg.EnableCache,
+			CacheSize:           cfg.CacheSize,
+			CacheTTL:            cfg.CacheTTL,
+			CacheMaxStale:       cfg.CacheMaxStale,
+			DBFallbackReads:     cfg.DBFallbackReads,
+			L2Cache:             l2Cache,
+			SnapshotInterval:    cfg.SnapshotInterval,
+			HealthCheckInterval: cfg.HealthCheckInterval,
+			ScheduleJitter:      cfg.ScheduleJitter,
+			RebuildPreserveMax:  cfg.RebuildPreserveMax,
+
+			CacheDisabledEndpoints: cfg.CacheDisabledEndpoints,
+
+			SnapshotRetentionCount:    cfg.SnapshotRetentionCount,
+			SnapshotRetentionDuration: cfg.SnapshotRetentionDuration,
+
+			ReasonTTLs:          cfg.ReasonTTLs,
+			ScoreExpiryInterval: cfg.ScoreExpiryInterval,
+
+			IdempotencyTTL: cfg.IdempotencyTTL,
+
+			DecayInterval:      decayInterval,
+			DecayRate:          cfg.DecayRate,
+			DecayInactiveAfter: cfg.DecayInactiveAfter,
+			DecayDryRun:        cfg.DecayDryRun,
+
+			PrecomputedRanks:    cfg.PrecomputedRanks,
+			RankRefreshInterval: cfg.RankRefreshInterval,
+
+			EventPublisher: eventPublisher,
+
+			LiveTopN: cfg.LiveTopN,
+		},
 	)
 
+	// 启动后台任务，关闭服务时通过 Close 停止
+	leaderboardService.StartBackgroundTasks(context.Background())
+	defer leaderboardService.Close()
+
 	// 启动时重建排行榜（确保数据一致性）
 	if cfg.RebuildOnStart {
 		ctx := context.Background()
 		if err := leaderboardService.RebuildLeaderboard(ctx); err != nil {
 			logger.NewLogger("main").Error("Failed to rebuild leaderboard", "error", err)
 		}
+	} else if cfg.CacheRestoreOnStart {
+		// 重建后缓存快照已过时，只在未重建时预热
+		if _, err := leaderboardService.ImportCacheState(context.Background()); err != nil {
+			logger.NewLogger("main").Warn("Failed to restore cache state", "error", err)
+		}
+	}
+
+	// 预热本地缓存，避免重启后的第一批请求全部落到 Redis
+	if cfg.WarmCacheOnStart {
+		if _, err := leaderboardService.WarmCache(context.Background(), cfg.WarmCacheTopN, cfg.WarmCachePlayers); err != nil {
+			logger.NewLogger("main").Warn("Failed to warm cache", "error", err)
+		}
 	}
 
 	// 初始化处理器
-	httpHandler := handler.NewHTTPHandler(leaderboardService)
+	httpHandler := handler.NewHTTPHandler(leaderboardService, cfg.MaxBatchSize, cfg.MaxRankRange, cfg.MaxTopN)
 
 	// 设置 Gin
 	if cfg.Environment == "production" {
@@ -69,20 +246,100 @@ func main() {
 
 	router := gin.Default()
 
+	// 只信任配置的代理转发的客户端 IP，否则 c.ClientIP() 为负载均衡的地址或可被请求头伪造
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Failed to set trusted proxies: ", err)
+	}
+
 	// 中间件
 	router.Use(gin.Recovery())
+	router.Use(RequestIDMiddleware())
+	if cfg.TracingEnabled {
+		router.Use(otelgin.Middleware("game-leaderboard"))
+	}
 	router.Use(CORSMiddleware())
 
+	// 统计近期 5xx 比例，计入就绪检查；健康检查本身不计入，避免 503 自我强化
+	if cfg.ReadyErrorRateThreshold > 0 {
+		errorRate := middleware.NewErrorRateTracker(cfg.ReadyErrorRateWindow)
+		router.Use(errorRate.Middleware("/game/rank/health", "/game/rank/ready"))
+		httpHandler.SetErrorRateCheck(errorRate, cfg.ReadyErrorRateThreshold, cfg.ReadyErrorMinRequests)
+	}
+
+	// 写接口限流，读接口不受影响
+	writeLimit := func(c *gin.Context) { c.Next() }
+	if cfg.RateLimitRPS > 0 {
+		writeLimit = middleware.NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst).Middleware()
+	}
+
 	// API 路由
 	api := router.Group("/game/rank")
 	{
-		api.POST("/upscores", httpHandler.UpdateScore)
+		api.POST("/upscores", writeLimit, httpHandler.UpdateScore)
+		api.POST("/upscores/batch", writeLimit, httpHandler.BatchUpdateScores)
+		api.POST("/names", writeLimit, httpHandler.UpdatePlayerNames)
 		api.GET("/user/:playerId", httpHandler.GetPlayerRank)
+		api.GET("/user/:playerId/history", httpHandler.GetScoreHistory)
+		api.GET("/user/:playerId/history/daily", httpHandler.GetDailyScoreDeltas)
+		api.GET("/user/:playerId/percentile", httpHandler.GetPlayerPercentile)
+		api.GET("/user/:playerId/last-active", httpHandler.GetPlayerLastActive)
+		api.GET("/user/:playerId/peak", httpHandler.GetPlayerPeakRank)
+		api.GET("/user/:playerId/profile", httpHandler.GetPlayerProfile)
 		api.GET("/top/:n", httpHandler.GetTopN)
+		api.GET("/page", httpHandler.GetLeaderboardPage)
+		api.GET("/score-at/:rank", httpHandler.GetScoreAtRank)
+		api.GET("/rank-for-score/:score", httpHandler.GetRankForScore)
 		api.GET("/range/:playerId/:range", httpHandler.GetPlayerRankRange)
+		api.GET("/near-score/:playerId", httpHandler.GetPlayersNearScore)
+		api.POST("/ranks", httpHandler.BatchGetPlayerRanks)
+		api.POST("/cohort", httpHandler.GetCohortStats)
+		api.POST("/among", httpHandler.GetRankingAmongPlayers)
+		api.GET("/search", httpHandler.SearchPlayers)
 		api.GET("/health", httpHandler.HealthCheck)
-		api.POST("/rebuild", httpHandler.RebuildLeaderboard)
-		api.GET("/cache_stats", httpHandler.GetCacheStats)
+		api.GET("/ready", httpHandler.ReadinessCheck)
+	}
+
+	// 管理接口，需要 API Key
+	if len(cfg.AdminAPIKeys) == 0 {
+		logger.NewLogger("main").Warn("ADMIN_API_KEYS is not set, admin routes will reject all requests")
+	}
+	admin := api.Group("", middleware.APIKeyAuth(cfg.AdminAPIKeys))
+	{
+		admin.POST("/rebuild", httpHandler.RebuildLeaderboard)
+		admin.POST("/reset", httpHandler.ResetLeaderboard)
+		admin.GET("/snapshots", httpHandler.ListSnapshots)
+		admin.POST("/restore", httpHandler.RestoreLeaderboard)
+		admin.GET("/export", httpHandler.ExportLeaderboard)
+		admin.GET("/score-buckets", httpHandler.GetScoreBuckets)
+		admin.GET("/cache_stats", httpHandler.GetCacheStats)
+		admin.POST("/cache_export", httpHandler.ExportCacheState)
+		admin.POST("/cache_import", httpHandler.ImportCacheState)
+		admin.POST("/cache/flush", httpHandler.FlushCache)
+		admin.GET("/blocklist", httpHandler.GetBlockedPlayers)
+		admin.POST("/blocklist", httpHandler.BlockPlayers)
+		admin.DELETE("/blocklist/:playerId", httpHandler.UnblockPlayer)
+		admin.PUT("/user/:playerId/score", httpHandler.SetPlayerScore)
+		admin.GET("/score-writes", httpHandler.GetScoreWriteQueue)
+		admin.POST("/score-writes/retry", httpHandler.RetryDeadScoreWrites)
+	}
+
+	// 实时前N名推送和玩家排名变化推送
+	liveHandler := handler.NewLiveHandler(leaderboardService, cfg.LiveMaxConnections, cfg.PlayerStreamIdleTimeout, cfg.LiveAllowedOrigins)
+	if cfg.LiveTopN > 0 {
+		api.GET("/live", liveHandler.Live)
+	}
+	api.GET("/user/:playerId/stream", liveHandler.PlayerStream)
+
+	// 可选的只读 GraphQL 接口，REST 仍为主要接口
+	if cfg.GraphQLEnabled {
+		graphqlHandler := handler.NewGraphQLHandler(leaderboardService)
+		api.POST("/graphql", graphqlHandler.Query)
+	}
+
+	// 玩家属性和筛选子集排名
+	if cfg.FilteredRanksEnabled {
+		api.PUT("/user/:playerId/attributes", writeLimit, httpHandler.UpdatePlayerAttributes)
+		api.GET("/user/:playerId/filtered-rank", httpHandler.GetFilteredRank)
 	}
 
 	// 创建 HTTP 服务器
@@ -104,28 +361,113 @@ func main() {
 		}
 	}()
 
+	// 可选的 gRPC 接口，使用单独的端口，与 HTTP 接口共用同一个服务实例
+	var grpcSrv *grpcserver.Server
+	if cfg.GRPCEnabled {
+		grpcSrv = grpcserver.NewServer(leaderboardService, cfg.MaxRankRange, cfg.MaxTopN)
+
+		go func() {
+			log.Printf("gRPC server starting on :%s", cfg.GRPCPort)
+
+			if err := grpcSrv.ListenAndServe(":" + cfg.GRPCPort); err != nil {
+				log.Fatalf("Failed to start gRPC server: %v", err)
+			}
+		}()
+	}
+
+	// 指标使用单独的端口，不经过业务路由的中间件
+	var metricsSrv *http.Server
+	if cfg.MetricsEnabled {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:    ":" + cfg.MetricsPort,
+			Handler: metricsMux,
+		}
+
+		go func() {
+			log.Printf("Metrics server starting on :%s", cfg.MetricsPort)
+
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start metrics server: %v", err)
+			}
+		}()
+	}
+
 	// 等待中断信号以优雅地关闭服务器
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
 
-	// 给服务器 5 秒时间完成当前请求
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// 给服务器一定时间完成当前请求
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	if grpcSrv != nil {
+		if err := grpcSrv.Shutdown(ctx); err != nil {
+			log.Printf("gRPC server forced to shutdown: %v", err)
+		}
+	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(ctx)
+	}
+
+	// 请求处理完毕后停止后台任务，并等待进行中的事件发布完成
+	leaderboardService.Close()
 
 	log.Println("Server exited")
 }
 
+// 校验 MySQL 表结构和 Redis 数据类型
+func verifySchema(mysqlRepo *repository.MySQLRepository, redisRepo *repository.RedisRepository) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := mysqlRepo.VerifySchema(ctx); err != nil {
+		return fmt.Errorf("mysql: %w", err)
+	}
+
+	if err := redisRepo.VerifySchema(ctx); err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+
+	return nil
+}
+
+// RequestIDMiddleware 读取或生成请求ID，写入请求 context 并在响应头中返回；请求头中的ID不合法时生成新的ID
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Request = c.Request.WithContext(logger.ContextWithRequestID(c.Request.Context(), requestID))
+		c.Writer.Header().Set(requestIDHeader, requestID)
+
+		c.Next()
+	}
+}
+
+// 生成 16 字节随机数的十六进制请求ID
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID, Idempotency-Key")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
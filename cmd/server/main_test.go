@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"game-leaderboard/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantKept bool
+	}{
+		{"valid", "req-1.a_B", true},
+		{"max length", strings.Repeat("a", 64), true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("a", 65), false},
+		// 换行和空格可伪造日志行
+		{"newline", "req-1\nfake log line", false},
+		{"space", "req 1", false},
+		{"non ascii", "请求1", false},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			router := gin.New()
+			router.Use(RequestIDMiddleware())
+			router.GET("/", func(c *gin.Context) {
+				seen = logger.RequestIDFromContext(c.Request.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(requestIDHeader, tt.header)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			got := w.Header().Get(requestIDHeader)
+			if got != seen {
+				t.Errorf("response ID %q differs from context ID %q", got, seen)
+			}
+			if tt.wantKept {
+				if got != tt.header {
+					t.Errorf("request ID = %q, want %q", got, tt.header)
+				}
+				return
+			}
+			// 生成的ID为 32 位十六进制
+			if got == tt.header || !validRequestID.MatchString(got) || len(got) != 32 {
+				t.Errorf("request ID = %q, want a generated ID", got)
+			}
+		})
+	}
+}
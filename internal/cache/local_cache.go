@@ -2,6 +2,8 @@ package cache
 
 import (
 	"container/list"
+	"context"
+	"strconv"
 	"sync"
 	"time"
 
@@ -22,56 +24,127 @@ type LocalCache struct {
 	lruList  *list.List
 	capacity int
 	ttl      time.Duration
+	// 过期后继续保留的时长，期间只能通过 GetStale* 读取，用于 Redis 不可用时降级
+	maxStale time.Duration
 
 	// 统计信息
 	hits   int64
 	misses int64
+
+	// 后台清理任务
+	stopCleanup context.CancelFunc
+	cleanupWg   sync.WaitGroup
 }
 
-// NewLocalCache 创建新的本地缓存
+const (
+	// 默认缓存过期时间
+	defaultTTL = 5 * time.Minute
+	// 过期缓存清理周期
+	CleanupInterval = 1 * time.Minute
+)
+
+// NewLocalCache 创建新的本地缓存，使用默认过期时间
 func NewLocalCache(capacity int) *LocalCache {
+	return NewLocalCacheWithTTL(capacity, defaultTTL)
+}
+
+// NewLocalCacheWithTTL 创建指定容量和过期时间的本地缓存
+func NewLocalCacheWithTTL(capacity int, ttl time.Duration) *LocalCache {
 	cache := &LocalCache{
 		items:    make(map[string]*list.Element),
 		lruList:  list.New(),
 		capacity: capacity,
-		ttl:      5 * time.Minute, // 默认5分钟过期
+		ttl:      ttl,
 	}
 
-	// 启动定期清理
-	cache.StartCleanup(1 * time.Minute)
-
 	return cache
 }
 
-// SetPlayerRank 缓存玩家排名
-func (c *LocalCache) SetPlayerRank(playerID string, rankInfo *model.RankInfo) {
-	c.set("rank:"+playerID, rankInfo)
+// SetMaxStale 设置过期缓存项继续保留、可通过 GetStale* 读取的最长时间，为 0 时过期即删除，应在使用缓存前调用
+func (c *LocalCache) SetMaxStale(maxStale time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxStale = maxStale
+}
+
+// SetPlayerRank 缓存玩家按指定排名方式计算的排名
+// 同一玩家不同排名方式的结果存放在同一缓存项中，便于一次清除
+func (c *LocalCache) SetPlayerRank(playerID, method string, rankInfo *model.RankInfo) {
+	key := "rank:" + playerID
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 缓存中的 map 可能正被读取，写入时复制
+	byMethod := map[string]*model.RankInfo{method: rankInfo}
+	if elem, exists := c.items[key]; exists {
+		item := elem.Value.(*CacheItem)
+		if existing, ok := item.value.(map[string]*model.RankInfo); ok && time.Now().Before(item.expiration) {
+			for m, info := range existing {
+				if m != method {
+					byMethod[m] = info
+				}
+			}
+		}
+	}
+
+	c.setLocked(key, byMethod, time.Now().Add(c.ttl))
 }
 
 // GetPlayerRank 获取缓存的玩家排名
-func (c *LocalCache) GetPlayerRank(playerID string) (*model.RankInfo, bool) {
+func (c *LocalCache) GetPlayerRank(playerID, method string) (*model.RankInfo, bool) {
 	value, ok := c.get("rank:" + playerID)
 	if !ok {
 		return nil, false
 	}
 
-	if rankInfo, ok := value.(*model.RankInfo); ok {
-		return rankInfo, true
+	if byMethod, ok := value.(map[string]*model.RankInfo); ok {
+		if rankInfo, ok := byMethod[method]; ok {
+			return rankInfo, true
+		}
 	}
 
 	return nil, false
 }
 
 // SetTopN 缓存前N名
-func (c *LocalCache) SetTopN(n int, rankings []*model.RankInfo) {
-	key := "top:" + string(rune(n))
-	c.set(key, rankings)
+func (c *LocalCache) SetTopN(n int, method string, rankings []*model.RankInfo) {
+	c.set(topNKey(n, method), rankings)
 }
 
 // GetTopN 获取缓存的前N名
-func (c *LocalCache) GetTopN(n int) ([]*model.RankInfo, bool) {
-	key := "top:" + string(rune(n))
-	value, ok := c.get(key)
+func (c *LocalCache) GetTopN(n int, method string) ([]*model.RankInfo, bool) {
+	value, ok := c.get(topNKey(n, method))
+	if !ok {
+		return nil, false
+	}
+
+	if rankings, ok := value.([]*model.RankInfo); ok {
+		return rankings, true
+	}
+
+	return nil, false
+}
+
+// GetStalePlayerRank 获取玩家排名，包括已过期但未超过最大保留时间的缓存项，不计入命中统计
+func (c *LocalCache) GetStalePlayerRank(playerID, method string) (*model.RankInfo, bool) {
+	value, ok := c.getStale("rank:" + playerID)
+	if !ok {
+		return nil, false
+	}
+
+	if byMethod, ok := value.(map[string]*model.RankInfo); ok {
+		if rankInfo, ok := byMethod[method]; ok {
+			return rankInfo, true
+		}
+	}
+
+	return nil, false
+}
+
+// GetStaleTopN 获取前N名，包括已过期但未超过最大保留时间的缓存项，不计入命中统计
+func (c *LocalCache) GetStaleTopN(n int, method string) ([]*model.RankInfo, bool) {
+	value, ok := c.getStale(topNKey(n, method))
 	if !ok {
 		return nil, false
 	}
@@ -119,36 +192,73 @@ func (c *LocalCache) Clear() {
 
 // GetStats 获取缓存统计信息
 func (c *LocalCache) GetStats() map[string]interface{} {
+	stats := c.Stats()
+
+	return map[string]interface{}{
+		"hits":     stats.Hits,
+		"misses":   stats.Misses,
+		"hit_rate": stats.HitRatio() * 100,
+		"size":     stats.Size,
+		"capacity": stats.Capacity,
+		"usage":    float64(stats.Size) / float64(stats.Capacity) * 100,
+	}
+}
+
+// Stats 本地缓存的命中统计和容量
+type Stats struct {
+	Hits     int64
+	Misses   int64
+	Size     int
+	Capacity int
+}
+
+// HitRatio 命中率（0-1），尚无访问时为 0
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// Stats 返回当前统计信息
+func (c *LocalCache) Stats() Stats {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	total := c.hits + c.misses
-	hitRate := 0.0
-	if total > 0 {
-		hitRate = float64(c.hits) / float64(total) * 100
+	return Stats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Size:     len(c.items),
+		Capacity: c.capacity,
 	}
+}
 
-	return map[string]interface{}{
-		"hits":     c.hits,
-		"misses":   c.misses,
-		"hit_rate": hitRate,
-		"size":     len(c.items),
-		"capacity": c.capacity,
-		"usage":    float64(len(c.items)) / float64(c.capacity) * 100,
-	}
+// top-N 缓存 key，形如 top:<N>:<method>
+func topNKey(n int, method string) string {
+	return "top:" + strconv.Itoa(n) + ":" + method
 }
 
 // 内部方法
 func (c *LocalCache) set(key string, value interface{}) {
+	c.setWithExpiration(key, value, time.Now().Add(c.ttl))
+}
+
+func (c *LocalCache) setWithExpiration(key string, value interface{}, expiration time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.setLocked(key, value, expiration)
+}
+
+// 调用方需持有锁
+func (c *LocalCache) setLocked(key string, value interface{}, expiration time.Time) {
 	// 如果键已存在，更新值并移到前面
 	if elem, exists := c.items[key]; exists {
 		c.lruList.MoveToFront(elem)
 		item := elem.Value.(*CacheItem)
 		item.value = value
-		item.expiration = time.Now().Add(c.ttl)
+		item.expiration = expiration
 		return
 	}
 
@@ -161,7 +271,7 @@ func (c *LocalCache) set(key string, value interface{}) {
 	item := &CacheItem{
 		key:        key,
 		value:      value,
-		expiration: time.Now().Add(c.ttl),
+		expiration: expiration,
 	}
 
 	// 添加到链表前面并存储引用
@@ -181,9 +291,11 @@ func (c *LocalCache) get(key string) (interface{}, bool) {
 
 	item := elem.Value.(*CacheItem)
 
-	// 检查是否过期
-	if time.Now().After(item.expiration) {
-		c.delete(key)
+	// 检查是否过期，仍在最大保留时间内的过期项留给 getStale 读取
+	if now := time.Now(); now.After(item.expiration) {
+		if now.After(item.expiration.Add(c.maxStale)) {
+			c.delete(key)
+		}
 		c.misses++
 		return nil, false
 	}
@@ -195,6 +307,23 @@ func (c *LocalCache) get(key string) (interface{}, bool) {
 	return item.value, true
 }
 
+// 读取未过期或过期未超过 maxStale 的缓存项，不调整 LRU 顺序
+func (c *LocalCache) getStale(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	elem, exists := c.items[key]
+	if !exists {
+		return nil, false
+	}
+
+	item := elem.Value.(*CacheItem)
+	if time.Now().After(item.expiration.Add(c.maxStale)) {
+		return nil, false
+	}
+	return item.value, true
+}
+
 func (c *LocalCache) delete(key string) {
 	if elem, exists := c.items[key]; exists {
 		c.lruList.Remove(elem)
@@ -212,16 +341,46 @@ func (c *LocalCache) evict() {
 	}
 }
 
-// StartCleanup 启动定期清理过期缓存
-func (c *LocalCache) StartCleanup(interval time.Duration) {
+// StartCleanup 启动定期清理过期缓存，ctx 取消或调用 Close 后停止
+func (c *LocalCache) StartCleanup(ctx context.Context, interval time.Duration) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.mu.Lock()
+	if c.stopCleanup != nil {
+		c.stopCleanup()
+	}
+	c.stopCleanup = cancel
+	c.mu.Unlock()
+
 	ticker := time.NewTicker(interval)
+	c.cleanupWg.Add(1)
 	go func() {
-		for range ticker.C {
-			c.cleanup()
+		defer c.cleanupWg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.cleanup()
+			}
 		}
 	}()
 }
 
+// Close 停止后台清理任务并等待其退出，可重复调用
+func (c *LocalCache) Close() {
+	c.mu.Lock()
+	stop := c.stopCleanup
+	c.stopCleanup = nil
+	c.mu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+	c.cleanupWg.Wait()
+}
+
 func (c *LocalCache) cleanup() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -231,7 +390,7 @@ func (c *LocalCache) cleanup() {
 
 	for key, elem := range c.items {
 		item := elem.Value.(*CacheItem)
-		if now.After(item.expiration) {
+		if now.After(item.expiration.Add(c.maxStale)) {
 			keysToDelete = append(keysToDelete, key)
 		}
 	}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"game-leaderboard/internal/model"
+)
+
+func TestCloseStopsCleanup(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		func() {
+			c := NewLocalCache(10)
+			defer c.Close()
+
+			// 重复启动时只保留最后一个清理任务
+			c.StartCleanup(context.Background(), time.Millisecond)
+			c.StartCleanup(context.Background(), time.Millisecond)
+		}()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	after := runtime.NumGoroutine()
+	for after > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		after = runtime.NumGoroutine()
+	}
+	if after > before {
+		t.Errorf("goroutines after Close = %d, want <= %d", after, before)
+	}
+
+	// Close 可重复调用，未启动清理任务时直接返回
+	c := NewLocalCache(10)
+	c.Close()
+	c.Close()
+}
+
+func TestTopNKeys(t *testing.T) {
+	// 0xD800 和 0xD801 是代理区码点，按 rune 编码时都变成 U+FFFD；超出 Unicode 范围的 N 同理
+	ns := []int{1, 100, 0xD800, 0xD801, 0x110000, 0x110001}
+
+	c := NewLocalCache(len(ns))
+	defer c.Close()
+	for _, n := range ns {
+		c.SetTopN(n, "standard", []*model.RankInfo{{PlayerID: fmt.Sprintf("p%d", n), Rank: 1}})
+	}
+
+	// 导出再导入后每个 N 仍对应自己的结果
+	restored := NewLocalCache(len(ns))
+	defer restored.Close()
+	if got := restored.Import(c.Export()); got != len(ns) {
+		t.Fatalf("Import() = %d, want %d", got, len(ns))
+	}
+	for _, n := range ns {
+		rankings, ok := restored.GetTopN(n, "standard")
+		if !ok || len(rankings) != 1 || rankings[0].PlayerID != fmt.Sprintf("p%d", n) {
+			t.Errorf("GetTopN(%d) = %+v, %v, want p%d", n, rankings, ok, n)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"game-leaderboard/internal/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// L2 缓存 key 定义
+	redisCacheRankPrefix = "cache:rank:"
+	redisCacheTopPrefix  = "cache:top:"
+	redisCacheTopIndex   = "cache:top:index" // 记录已缓存的 top-N key，便于整体失效
+)
+
+// RedisCache 基于 Redis 的共享缓存，作为多实例部署时本地缓存之后的 L2 缓存
+type RedisCache struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+// NewRedisCache 创建 L2 缓存，ttl 应明显短于本地缓存以降低跨实例的不一致窗口
+func NewRedisCache(client redis.UniversalClient, ttl time.Duration) *RedisCache {
+	return &RedisCache{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// SetPlayerRank 缓存玩家按指定排名方式计算的排名
+// 同一玩家的各排名方式存放在同一个 hash 中，便于一次清除
+func (c *RedisCache) SetPlayerRank(ctx context.Context, playerID, method string, rankInfo *model.RankInfo) error {
+	data, err := json.Marshal(rankInfo)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache value: %w", err)
+	}
+
+	key := redisCacheRankPrefix + playerID
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, method, data)
+		pipe.Expire(ctx, key, c.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set cache value: %w", err)
+	}
+	return nil
+}
+
+// GetPlayerRank 获取缓存的玩家排名
+func (c *RedisCache) GetPlayerRank(ctx context.Context, playerID, method string) (*model.RankInfo, bool, error) {
+	data, err := c.client.HGet(ctx, redisCacheRankPrefix+playerID, method).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to get cache value: %w", err)
+	}
+
+	var rankInfo model.RankInfo
+	if err := json.Unmarshal(data, &rankInfo); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal cache value: %w", err)
+	}
+	return &rankInfo, true, nil
+}
+
+// SetTopN 缓存前N名
+func (c *RedisCache) SetTopN(ctx context.Context, n int, method string, rankings []*model.RankInfo) error {
+	key := redisCacheTopKey(n, method)
+	if err := c.set(ctx, key, rankings); err != nil {
+		return err
+	}
+	return c.client.SAdd(ctx, redisCacheTopIndex, key).Err()
+}
+
+// GetTopN 获取缓存的前N名
+func (c *RedisCache) GetTopN(ctx context.Context, n int, method string) ([]*model.RankInfo, bool, error) {
+	var rankings []*model.RankInfo
+	ok, err := c.get(ctx, redisCacheTopKey(n, method), &rankings)
+	if !ok || err != nil {
+		return nil, false, err
+	}
+	return rankings, true, nil
+}
+
+// ClearPlayerRank 清除玩家排名缓存
+func (c *RedisCache) ClearPlayerRank(ctx context.Context, playerID string) error {
+	return c.client.Del(ctx, redisCacheRankPrefix+playerID).Err()
+}
+
+// ClearTopN 清除所有前N名缓存
+func (c *RedisCache) ClearTopN(ctx context.Context) error {
+	keys, err := c.client.SMembers(ctx, redisCacheTopIndex).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list cached top-n keys: %w", err)
+	}
+
+	keys = append(keys, redisCacheTopIndex)
+	return c.client.Del(ctx, keys...).Err()
+}
+
+func redisCacheTopKey(n int, method string) string {
+	return redisCacheTopPrefix + strconv.Itoa(n) + ":" + method
+}
+
+func (c *RedisCache) set(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache value: %w", err)
+	}
+
+	if err := c.client.Set(ctx, key, data, c.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set cache value: %w", err)
+	}
+	return nil
+}
+
+func (c *RedisCache) get(ctx context.Context, key string, dest interface{}) (bool, error) {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get cache value: %w", err)
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return false, fmt.Errorf("failed to unmarshal cache value: %w", err)
+	}
+	return true, nil
+}
+
+// Clear 清除所有 L2 缓存
+func (c *RedisCache) Clear(ctx context.Context) error {
+	if err := c.ClearTopN(ctx); err != nil {
+		return err
+	}
+
+	iter := c.client.Scan(ctx, 0, redisCacheRankPrefix+"*", 1000).Iterator()
+	keys := make([]string, 0)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan cached rank keys: %w", err)
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.client.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"game-leaderboard/internal/model"
+)
+
+// Snapshot 本地缓存的可序列化快照，用于重启后预热缓存
+type Snapshot struct {
+	CreatedAt time.Time           `json:"createdAt"`
+	Ranks     []SnapshotRankEntry `json:"ranks"`
+	TopN      []SnapshotTopNEntry `json:"topN"`
+}
+
+// SnapshotRankEntry 玩家排名缓存项
+type SnapshotRankEntry struct {
+	PlayerID  string          `json:"playerId"`
+	Method    string          `json:"method"`
+	RankInfo  *model.RankInfo `json:"rankInfo"`
+	ExpiresAt time.Time       `json:"expiresAt"`
+}
+
+// SnapshotTopNEntry 前N名缓存项
+type SnapshotTopNEntry struct {
+	N         int               `json:"n"`
+	Method    string            `json:"method"`
+	Rankings  []*model.RankInfo `json:"rankings"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// Export 导出所有未过期的缓存项，保留各自的过期时间
+func (c *LocalCache) Export() *Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	snapshot := &Snapshot{
+		CreatedAt: now,
+		Ranks:     make([]SnapshotRankEntry, 0),
+		TopN:      make([]SnapshotTopNEntry, 0),
+	}
+
+	for key, elem := range c.items {
+		item := elem.Value.(*CacheItem)
+		if now.After(item.expiration) {
+			continue
+		}
+
+		switch value := item.value.(type) {
+		case map[string]*model.RankInfo:
+			for method, rankInfo := range value {
+				snapshot.Ranks = append(snapshot.Ranks, SnapshotRankEntry{
+					PlayerID:  strings.TrimPrefix(key, "rank:"),
+					Method:    method,
+					RankInfo:  rankInfo,
+					ExpiresAt: item.expiration,
+				})
+			}
+		case []*model.RankInfo:
+			// top-N 的 key 形如 top:<N>:<method>，见 topNKey
+			n, method, ok := strings.Cut(strings.TrimPrefix(key, "top:"), ":")
+			if !ok {
+				continue
+			}
+			count, err := strconv.Atoi(n)
+			if err != nil {
+				continue
+			}
+			snapshot.TopN = append(snapshot.TopN, SnapshotTopNEntry{
+				N:         count,
+				Method:    method,
+				Rankings:  value,
+				ExpiresAt: item.expiration,
+			})
+		}
+	}
+
+	return snapshot
+}
+
+// Import 将快照中的缓存项载入本地缓存，已过期的项被跳过，返回载入的数量
+// 载入的项沿用快照中的过期时间，因此恢复后的数据不会比正常缓存更陈旧
+func (c *LocalCache) Import(snapshot *Snapshot) int {
+	if snapshot == nil {
+		return 0
+	}
+
+	now := time.Now()
+	imported := 0
+
+	for _, entry := range snapshot.Ranks {
+		if entry.RankInfo == nil || !entry.ExpiresAt.After(now) {
+			continue
+		}
+		c.importPlayerRank(entry)
+		imported++
+	}
+
+	for _, entry := range snapshot.TopN {
+		if entry.N <= 0 || !entry.ExpiresAt.After(now) {
+			continue
+		}
+		c.setWithExpiration(topNKey(entry.N, entry.Method), entry.Rankings, entry.ExpiresAt)
+		imported++
+	}
+
+	return imported
+}
+
+// 将快照中的一条玩家排名合并到该玩家的缓存项，过期时间取较早者
+func (c *LocalCache) importPlayerRank(entry SnapshotRankEntry) {
+	key := "rank:" + entry.PlayerID
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byMethod := map[string]*model.RankInfo{entry.Method: entry.RankInfo}
+	expiration := entry.ExpiresAt
+	if elem, exists := c.items[key]; exists {
+		item := elem.Value.(*CacheItem)
+		if existing, ok := item.value.(map[string]*model.RankInfo); ok {
+			for method, rankInfo := range existing {
+				if method != entry.Method {
+					byMethod[method] = rankInfo
+				}
+			}
+			if item.expiration.Before(expiration) {
+				expiration = item.expiration
+			}
+		}
+	}
+
+	c.setLocked(key, byMethod, expiration)
+}
@@ -2,11 +2,16 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"game-leaderboard/pkg/logger"
+	"game-leaderboard/pkg/utils"
+
+	"github.com/goccy/go-yaml"
 )
 
 type Config struct {
@@ -15,69 +20,327 @@ type Config struct {
 	Port        string `json:"port"`
 	LogLevel    string `json:"logLevel"`
 
+	// 日志输出：stdout（默认）、stderr 或 file（写入 LogFile，超过 LogMaxSizeMB 时轮转）
+	// 轮转后保留最近 LogMaxBackups 个且不超过 LogMaxAgeDays 天的旧文件，为 0 时不限
+	LogOutput     string `json:"logOutput"`
+	LogFile       string `json:"logFile"`
+	LogMaxSizeMB  int    `json:"logMaxSizeMB"`
+	LogMaxBackups int    `json:"logMaxBackups"`
+	LogMaxAgeDays int    `json:"logMaxAgeDays"`
+	// LogFormat json（默认）或 console（便于阅读的文本格式，开发环境下输出到终端时日志级别带颜色）
+	LogFormat string `json:"logFormat"`
+
 	// MySQL 配置
 	MySQLDSN       string `json:"mysqlDSN"`
 	MySQLMaxConns  int    `json:"mysqlMaxConns"`
 	MySQLIdleConns int    `json:"mysqlIdleConns"`
+	// 连接的最长使用时间，为 0 时不限制
+	MySQLConnMaxLifetime time.Duration `json:"mysqlConnMaxLifetime"`
+	// 空闲连接的最长保留时间，以及后台 ping 的间隔（为 0 时不 ping），避免空闲连接被服务端或防火墙断开后首个查询失败
+	MySQLConnMaxIdleTime   time.Duration `json:"mysqlConnMaxIdleTime"`
+	MySQLKeepaliveInterval time.Duration `json:"mysqlKeepaliveInterval"`
+	// DBOpTimeout 单次 MySQL 操作（查询或事务）的最长耗时，超时后中止查询；全表重建、重置等批量操作不受限制，为 0 时不限制
+	DBOpTimeout time.Duration `json:"dbOpTimeout"`
+
+	// SchemaCheckOnStart 启动时校验 MySQL 表结构和 Redis 数据类型，不兼容时拒绝启动
+	SchemaCheckOnStart bool `json:"schemaCheckOnStart"`
 
 	// Redis 配置
 	RedisAddr     string `json:"redisAddr"`
 	RedisPassword string `json:"redisPassword"`
 	RedisDB       int    `json:"redisDB"`
 	RedisPoolSize int    `json:"redisPoolSize"`
+	// 连接池最少空闲连接数及超时，超时为 0 时使用 go-redis 的默认值
+	RedisMinIdleConns int           `json:"redisMinIdleConns"`
+	RedisDialTimeout  time.Duration `json:"redisDialTimeout"`
+	RedisReadTimeout  time.Duration `json:"redisReadTimeout"`
+	RedisWriteTimeout time.Duration `json:"redisWriteTimeout"`
+	// 幂等命令（分数和排名读取、覆盖写入）遇到临时错误（连接断开、超时、LOADING 等，不包括 redis.Nil 这类正常结果）时的重试次数及退避区间，次数为 0 时不重试
+	// 累加、入队等非幂等写入不重试
+	RedisMaxRetries      int           `json:"redisMaxRetries"`
+	RedisMinRetryBackoff time.Duration `json:"redisMinRetryBackoff"`
+	RedisMaxRetryBackoff time.Duration `json:"redisMaxRetryBackoff"`
+	// RedisOpTimeout 单条 Redis 命令（pipeline 整体）每次执行的最长耗时，为 0 时只受读写超时限制
+	RedisOpTimeout time.Duration `json:"redisOpTimeout"`
+
+	// RedisMode 部署模式：single（默认，连接 RedisAddr）、sentinel（通过 RedisSentinelAddrs 发现 RedisMasterName 的主节点）
+	// 或 cluster（以 RedisClusterAddrs 为种子节点，RedisDB 必须为 0）
+	// 集群模式下排行榜相关的 key 都带 {lb} 哈希标签，位于同一槽位，多键脚本和事务可以正常执行
+	RedisMode             string   `json:"redisMode"`
+	RedisMasterName       string   `json:"redisMasterName"`
+	RedisSentinelAddrs    []string `json:"redisSentinelAddrs"`
+	RedisSentinelPassword string   `json:"redisSentinelPassword"`
+	RedisClusterAddrs     []string `json:"redisClusterAddrs"`
+
+	// RedisMigrateKeys 启动时将升级前不带哈希标签的 key 迁移到当前名称，迁移完成后写入标记，之后的启动不再扫描
+	RedisMigrateKeys bool `json:"redisMigrateKeys"`
+
+	// PlayerMetadataSource 玩家名称等信息的存储位置：redis 或 mysql（Redis 仅保存分数）
+	PlayerMetadataSource string `json:"playerMetadataSource"`
 
 	// 排行榜配置
-	RankingMethod  string `json:"rankingMethod"`
-	EnableCache    bool   `json:"enableCache"`
-	CacheSize      int    `json:"cacheSize"`
-	ShardCount     int    `json:"shardCount"`
-	RebuildOnStart bool   `json:"rebuildOnStart"`
+	RankingMethod       string        `json:"rankingMethod"`
+	RankOrder           string        `json:"rankOrder"` // desc（分数高者在前）或 asc（分数低者在前）
+	ScoreUpdateMode     string        `json:"scoreUpdateMode"`
+	WriteMode           string        `json:"writeMode"` // mysql_first 或 redis_first（先写 Redis，异步写入 MySQL，未写入的变更可能随 Redis 丢失）
+	EnableCache         bool          `json:"enableCache"`
+	CacheSize           int           `json:"cacheSize"`
+	CacheTTL            time.Duration `json:"cacheTTL"`
+	CacheMaxStale       time.Duration `json:"cacheMaxStale"`  // Redis 读取失败时可返回的本地缓存最长过期时间，为 0 时不返回过期结果
+	L2CacheEnabled      bool          `json:"l2CacheEnabled"` // 在本地缓存之后启用 Redis 共享缓存
+	L2CacheTTL          time.Duration `json:"l2CacheTTL"`
+	CacheRestoreOnStart bool          `json:"cacheRestoreOnStart"` // 启动时从 Redis 中的快照预热本地缓存
+	WarmCacheOnStart    bool          `json:"warmCacheOnStart"`    // 启动时（重建或恢复快照之后）查询前N名和最近活跃玩家的排名写入本地缓存
+	WarmCacheTopN       int           `json:"warmCacheTopN"`
+	WarmCachePlayers    int           `json:"warmCachePlayers"`
+	ShardCount          int           `json:"shardCount"`
+	RebuildOnStart      bool          `json:"rebuildOnStart"`
+	RebuildPreserveMax  bool          `json:"rebuildPreserveMax"` // 重建时保留 Redis 与 MySQL 中排名靠前的分数（降序榜为较高者，升序榜为较低者）
+	// CacheDisabledEndpoints 不使用缓存（本地和 L2）的接口：rank（玩家排名）、top（前N名）
+	CacheDisabledEndpoints []string `json:"cacheDisabledEndpoints"`
+
+	// MaxPlayers 总榜最多保留的玩家数，超出时移除排名最后的玩家（MySQL 中保留），为 0 时不限制
+	MaxPlayers int `json:"maxPlayers"`
+
+	// MaxScore 总分和单次变更的绝对值上限，超出的更新返回 400；不能超过 2^53（Redis 以 float64 保存分数，超出后精度丢失）
+	MaxScore int64 `json:"maxScore"`
+
+	// DBFallbackReads Redis 读取失败且没有可用的过期缓存时，从 MySQL 统计排名和前N名（不排除被封禁的玩家）
+	DBFallbackReads bool `json:"dbFallbackReads"`
+
+	// PrecomputedRanks 后台定期预计算排名，单个玩家排名查询返回带计算时间的近似排名
+	PrecomputedRanks    bool          `json:"precomputedRanks"`
+	RankRefreshInterval time.Duration `json:"rankRefreshInterval"`
+
+	// ReasonMultipliers 按得分原因配置的分数倍率，未配置的原因按 1 倍计算
+	ReasonMultipliers map[string]float64 `json:"reasonMultipliers"`
+
+	// ReasonTTLs 按得分原因配置的分数有效期，到期后该次增量从总分中扣回；未配置的原因永久有效
+	// ScoreExpiryInterval 后台扣回到期分数的间隔，为 0 时不扣回
+	ReasonTTLs          map[string]time.Duration `json:"reasonTTLs"`
+	ScoreExpiryInterval time.Duration            `json:"scoreExpiryInterval"`
+
+	// IdempotencyTTL 分数更新幂等键的保留时间，在此期间使用同一键的重复提交返回首次的结果
+	IdempotencyTTL time.Duration `json:"idempotencyTTL"`
+
+	// 分数衰减：每隔 DecayInterval 将超过 DecayInactiveAfter 未得分的玩家的正分数按 DecayRate 比例扣减
+	// DecayDryRun 时只记录将要扣减的玩家数和分数，不实际修改
+	DecayEnabled       bool          `json:"decayEnabled"`
+	DecayRate          float64       `json:"decayRate"`
+	DecayInterval      time.Duration `json:"decayInterval"`
+	DecayInactiveAfter time.Duration `json:"decayInactiveAfter"`
+	DecayDryRun        bool          `json:"decayDryRun"`
 
 	// 性能配置
+	MaxBatchSize     int           `json:"maxBatchSize"`
 	SnapshotInterval time.Duration `json:"snapshotInterval"`
-	WriteTimeout     time.Duration `json:"writeTimeout"`
-	ReadTimeout      time.Duration `json:"readTimeout"`
+	// MaxRankRange 周边排名接口允许请求的最大范围，超出时返回 400
+	MaxRankRange int `json:"maxRankRange"`
+	// MaxTopN 前N名接口一次最多返回的玩家数，超出时按上限截断并在响应中标明
+	MaxTopN int `json:"maxTopN"`
+	// HealthCheckInterval 后台检查 Redis 和 MySQL 连接的间隔，为 0 时不检查
+	HealthCheckInterval time.Duration `json:"healthCheckInterval"`
+	ScheduleJitter      time.Duration `json:"scheduleJitter"` // 后台任务每个周期额外等待的最大随机时长，使多个实例错开执行，为 0 时不加
+	WriteTimeout        time.Duration `json:"writeTimeout"`
+	ReadTimeout         time.Duration `json:"readTimeout"`
+	ShutdownTimeout     time.Duration `json:"shutdownTimeout"`
+
+	// 快照保留策略：每次创建快照后删除超出保留范围的旧快照，两者都为 0 时保留全部
+	// 同时配置时只删除既不在最近 SnapshotRetentionCount 个之内、也早于 SnapshotRetentionDuration 的快照
+	SnapshotRetentionCount    int           `json:"snapshotRetentionCount"`
+	SnapshotRetentionDuration time.Duration `json:"snapshotRetentionDuration"`
+
+	// 写接口按客户端 IP 限流，RateLimitRPS 为 0 时不限流
+	RateLimitRPS   float64 `json:"rateLimitRPS"`
+	RateLimitBurst int     `json:"rateLimitBurst"`
+
+	// TrustedProxies 信任的反向代理（IP 或 CIDR），只有来自这些地址的请求才按 X-Forwarded-For 等请求头解析客户端 IP，
+	// 影响日志和按 IP 限流；默认只信任本机，为空时不信任任何代理
+	TrustedProxies []string `json:"trustedProxies"`
+
+	// AdminAPIKeys 管理接口允许的 API Key，未配置时管理接口全部拒绝
+	AdminAPIKeys []string `json:"adminAPIKeys"`
+
+	// 分数变更事件 webhook，为空时不发布事件
+	WebhookURL     string        `json:"webhookURL"`
+	WebhookTimeout time.Duration `json:"webhookTimeout"`
+
+	// GraphQL 配置
+	GraphQLEnabled bool `json:"graphqlEnabled"`
+
+	// gRPC 接口使用单独的端口，与 HTTP 接口由同一个服务实例处理
+	GRPCEnabled bool   `json:"grpcEnabled"`
+	GRPCPort    string `json:"grpcPort"`
+
+	// FilteredRanksEnabled 提供玩家属性写入和按属性筛选子集的排名接口，排名由 MySQL 实时统计
+	FilteredRanksEnabled bool `json:"filteredRanksEnabled"`
+
+	// 实时前N名 WebSocket 推送，LiveTopN 为 0 时不启用
+	LiveTopN int `json:"liveTopN"`
+	// 实时连接数上限，WebSocket 和玩家排名 SSE 共用
+	LiveMaxConnections int `json:"liveMaxConnections"`
+	// 玩家排名 SSE 在该时长内没有更新时关闭连接
+	PlayerStreamIdleTimeout time.Duration `json:"playerStreamIdleTimeout"`
+	// 允许建立实时 WebSocket 连接的页面来源（如 https://game.example.com），* 表示允许所有来源；
+	// 为空时只允许与服务同源的页面，不带 Origin 头的非浏览器客户端不受限制
+	LiveAllowedOrigins []string `json:"liveAllowedOrigins"`
+
+	// 链路追踪配置，span 以 OTLP/HTTP 格式发送到 OTLPEndpoint（完整 URL，如 http://localhost:4318/v1/traces）
+	TracingEnabled bool   `json:"tracingEnabled"`
+	OTLPEndpoint   string `json:"otlpEndpoint"`
+
+	// 就绪检查：窗口内请求数不少于 ReadyErrorMinRequests 且 5xx 比例超过 ReadyErrorRateThreshold（百分比）时视为不可用，阈值为 0 时不检查
+	ReadyErrorRateThreshold float64       `json:"readyErrorRateThreshold"`
+	ReadyErrorRateWindow    time.Duration `json:"readyErrorRateWindow"`
+	ReadyErrorMinRequests   int           `json:"readyErrorMinRequests"`
 
 	// 监控配置
 	MetricsEnabled bool   `json:"metricsEnabled"`
 	MetricsPort    string `json:"metricsPort"`
+	// MetricsConstLabels 附加到所有指标上的常量标签，多个服务共用一个 Prometheus 时用于区分来源
+	MetricsConstLabels map[string]string `json:"metricsConstLabels"`
 }
 
-// LoadConfig 从环境变量加载配置
-func LoadConfig() *Config {
-	cfg := &Config{
+// defaultConfig 返回各配置项的默认值
+func defaultConfig() *Config {
+	return &Config{
 		// 服务器配置
-		Environment: getEnv("ENVIRONMENT", "development"),
-		Port:        getEnv("PORT", "8080"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
+		Environment: "development",
+		Port:        "8080",
+		LogLevel:    "info",
+
+		LogOutput:     "stdout",
+		LogFile:       "",
+		LogMaxSizeMB:  100,
+		LogMaxBackups: 10,
+		LogMaxAgeDays: 7,
+		LogFormat:     "json",
 
 		// MySQL 配置
-		MySQLDSN:       getEnv("MYSQL_DSN", "root:root@tcp(localhost:3306)/360?parseTime=true"),
-		MySQLMaxConns:  getEnvAsInt("MYSQL_MAX_CONNS", 100),
-		MySQLIdleConns: getEnvAsInt("MYSQL_IDLE_CONNS", 10),
+		MySQLDSN:       "root:root@tcp(localhost:3306)/360?parseTime=true",
+		MySQLMaxConns:  100,
+		MySQLIdleConns: 10,
+
+		MySQLConnMaxLifetime: 30 * time.Minute,
+
+		MySQLConnMaxIdleTime:   5 * time.Minute,
+		MySQLKeepaliveInterval: 0,
+		DBOpTimeout:            10 * time.Second,
+
+		SchemaCheckOnStart: false,
 
 		// Redis 配置
-		RedisAddr:     getEnv("REDIS_ADDR", "127.0.0.1:11307"),
-		RedisPassword: getEnv("REDIS_PASSWORD", ""),
-		RedisDB:       getEnvAsInt("REDIS_DB", 0),
-		RedisPoolSize: getEnvAsInt("REDIS_POOL_SIZE", 100),
+		RedisAddr:     "127.0.0.1:11307",
+		RedisPassword: "",
+		RedisDB:       0,
+		RedisPoolSize: 100,
+
+		RedisMinIdleConns: 0,
+		RedisDialTimeout:  5 * time.Second,
+		RedisReadTimeout:  3 * time.Second,
+		RedisWriteTimeout: 3 * time.Second,
+
+		RedisMaxRetries:      3,
+		RedisMinRetryBackoff: 8 * time.Millisecond,
+		RedisMaxRetryBackoff: 512 * time.Millisecond,
+		RedisOpTimeout:       5 * time.Second,
+
+		RedisMode:        "single",
+		RedisMigrateKeys: true,
+
+		PlayerMetadataSource: "redis", // redis or mysql
 
 		// 排行榜配置
-		RankingMethod:  getEnv("RANKING_METHOD", "standard"), // standard or dense
-		EnableCache:    getEnvAsBool("ENABLE_CACHE", true),
-		CacheSize:      getEnvAsInt("CACHE_SIZE", 10000),
-		ShardCount:     getEnvAsInt("SHARD_COUNT", 16),
-		RebuildOnStart: getEnvAsBool("REBUILD_ON_START", false),
+		RankingMethod:       "standard",  // standard or dense
+		RankOrder:           "desc",      // desc or asc
+		ScoreUpdateMode:     "increment", // increment or set
+		WriteMode:           "mysql_first",
+		MaxPlayers:          0,
+		MaxScore:            utils.MaxExactScore,
+		EnableCache:         true,
+		CacheSize:           10000,
+		CacheTTL:            5 * time.Minute,
+		CacheMaxStale:       0,
+		DBFallbackReads:     false,
+		L2CacheEnabled:      false,
+		L2CacheTTL:          5 * time.Second,
+		CacheRestoreOnStart: false,
+		WarmCacheOnStart:    false,
+		WarmCacheTopN:       100,
+		WarmCachePlayers:    1000,
+		ShardCount:          16,
+		RebuildOnStart:      false,
+		RebuildPreserveMax:  false,
+
+		PrecomputedRanks:    false,
+		RankRefreshInterval: 1 * time.Minute,
+
+		ReasonMultipliers: make(map[string]float64),
+
+		ReasonTTLs:          make(map[string]time.Duration),
+		ScoreExpiryInterval: 1 * time.Minute,
+
+		IdempotencyTTL: 24 * time.Hour,
+
+		DecayEnabled:       false,
+		DecayRate:          0.05,
+		DecayInterval:      24 * time.Hour,
+		DecayInactiveAfter: 7 * 24 * time.Hour,
+		DecayDryRun:        false,
 
 		// 性能配置
-		SnapshotInterval: getEnvAsDuration("SNAPSHOT_INTERVAL", 1*time.Hour),
-		WriteTimeout:     getEnvAsDuration("WRITE_TIMEOUT", 10*time.Second),
-		ReadTimeout:      getEnvAsDuration("READ_TIMEOUT", 5*time.Second),
+		MaxBatchSize:        1000,
+		MaxRankRange:        100,
+		MaxTopN:             1000,
+		SnapshotInterval:    1 * time.Hour,
+		HealthCheckInterval: 30 * time.Second,
+		WriteTimeout:        10 * time.Second,
+		ReadTimeout:         5 * time.Second,
+		ShutdownTimeout:     5 * time.Second,
+
+		SnapshotRetentionCount:    0,
+		SnapshotRetentionDuration: 0,
+
+		RateLimitRPS:   0,
+		RateLimitBurst: 20,
+
+		TrustedProxies: []string{"127.0.0.1", "::1"},
+
+		WebhookURL:     "",
+		WebhookTimeout: 2 * time.Second,
+
+		LiveTopN:                10,
+		LiveMaxConnections:      1000,
+		PlayerStreamIdleTimeout: 5 * time.Minute,
+
+		ReadyErrorRateThreshold: 0,
+		ReadyErrorRateWindow:    1 * time.Minute,
+		ReadyErrorMinRequests:   20,
+
+		// GraphQL 配置
+		GraphQLEnabled: false,
+
+		// gRPC 配置
+		GRPCEnabled: false,
+		GRPCPort:    "9000",
+
+		FilteredRanksEnabled: false,
+
+		// 链路追踪配置
+		TracingEnabled: false,
+		OTLPEndpoint:   "http://localhost:4318/v1/traces",
 
 		// 监控配置
-		MetricsEnabled: getEnvAsBool("METRICS_ENABLED", false),
-		MetricsPort:    getEnv("METRICS_PORT", "9090"),
+		MetricsEnabled:     false,
+		MetricsPort:        "9090",
+		MetricsConstLabels: make(map[string]string),
 	}
+}
+
+// LoadConfig 从环境变量加载配置
+func LoadConfig() *Config {
+	cfg := defaultConfig()
+	applyEnv(cfg)
 
 	// 验证配置
 	if err := cfg.Validate(); err != nil {
@@ -87,6 +350,181 @@ func LoadConfig() *Config {
 	return cfg
 }
 
+// LoadConfigFromFile 从 YAML 或 JSON 文件加载配置（字段名与 json tag 一致），
+// 文件中未出现的字段使用默认值，已设置的环境变量优先于文件中的值
+func LoadConfigFromFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// JSON 是 YAML 的子集，两种格式使用同一解析器；时长字段可写作 "5m" 等字符串
+	cfg := defaultConfig()
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if cfg.ReasonMultipliers == nil {
+		cfg.ReasonMultipliers = make(map[string]float64)
+	}
+	if cfg.MetricsConstLabels == nil {
+		cfg.MetricsConstLabels = make(map[string]string)
+	}
+	if cfg.ReasonTTLs == nil {
+		cfg.ReasonTTLs = make(map[string]time.Duration)
+	}
+
+	applyEnv(cfg)
+
+	// 验证合并后的配置
+	if err := cfg.Validate(); err != nil {
+		logger.NewLogger("config").Warn("Configuration validation warning", "error", err)
+	}
+
+	return cfg, nil
+}
+
+// applyEnv 用已设置的环境变量覆盖 cfg 中的对应字段
+func applyEnv(cfg *Config) {
+	// 服务器配置
+	cfg.Environment = getEnv("ENVIRONMENT", cfg.Environment)
+	cfg.Port = getEnv("PORT", cfg.Port)
+	cfg.LogLevel = getEnv("LOG_LEVEL", cfg.LogLevel)
+	cfg.LogOutput = getEnv("LOG_OUTPUT", cfg.LogOutput)
+	cfg.LogFile = getEnv("LOG_FILE", cfg.LogFile)
+	cfg.LogMaxSizeMB = getEnvAsInt("LOG_MAX_SIZE_MB", cfg.LogMaxSizeMB)
+	cfg.LogMaxBackups = getEnvAsInt("LOG_MAX_BACKUPS", cfg.LogMaxBackups)
+	cfg.LogMaxAgeDays = getEnvAsInt("LOG_MAX_AGE_DAYS", cfg.LogMaxAgeDays)
+	cfg.LogFormat = getEnv("LOG_FORMAT", cfg.LogFormat)
+
+	// MySQL 配置
+	cfg.MySQLDSN = getEnv("MYSQL_DSN", cfg.MySQLDSN)
+	cfg.MySQLMaxConns = getEnvAsInt("MYSQL_MAX_CONNS", cfg.MySQLMaxConns)
+	cfg.MySQLIdleConns = getEnvAsInt("MYSQL_IDLE_CONNS", cfg.MySQLIdleConns)
+	cfg.MySQLConnMaxLifetime = getEnvAsDuration("MYSQL_CONN_MAX_LIFETIME", cfg.MySQLConnMaxLifetime)
+	cfg.MySQLConnMaxIdleTime = getEnvAsDuration("MYSQL_CONN_MAX_IDLE_TIME", cfg.MySQLConnMaxIdleTime)
+	cfg.MySQLKeepaliveInterval = getEnvAsDuration("MYSQL_KEEPALIVE_INTERVAL", cfg.MySQLKeepaliveInterval)
+	cfg.DBOpTimeout = getEnvAsDuration("DB_OP_TIMEOUT", cfg.DBOpTimeout)
+
+	cfg.SchemaCheckOnStart = getEnvAsBool("SCHEMA_CHECK_ON_START", cfg.SchemaCheckOnStart)
+
+	// Redis 配置
+	cfg.RedisAddr = getEnv("REDIS_ADDR", cfg.RedisAddr)
+	cfg.RedisPassword = getEnv("REDIS_PASSWORD", cfg.RedisPassword)
+	cfg.RedisDB = getEnvAsInt("REDIS_DB", cfg.RedisDB)
+	cfg.RedisPoolSize = getEnvAsInt("REDIS_POOL_SIZE", cfg.RedisPoolSize)
+	cfg.RedisMinIdleConns = getEnvAsInt("REDIS_MIN_IDLE_CONNS", cfg.RedisMinIdleConns)
+	cfg.RedisDialTimeout = getEnvAsDuration("REDIS_DIAL_TIMEOUT", cfg.RedisDialTimeout)
+	cfg.RedisReadTimeout = getEnvAsDuration("REDIS_READ_TIMEOUT", cfg.RedisReadTimeout)
+	cfg.RedisWriteTimeout = getEnvAsDuration("REDIS_WRITE_TIMEOUT", cfg.RedisWriteTimeout)
+	cfg.RedisMaxRetries = getEnvAsInt("REDIS_MAX_RETRIES", cfg.RedisMaxRetries)
+	cfg.RedisMinRetryBackoff = getEnvAsDuration("REDIS_MIN_RETRY_BACKOFF", cfg.RedisMinRetryBackoff)
+	cfg.RedisMaxRetryBackoff = getEnvAsDuration("REDIS_MAX_RETRY_BACKOFF", cfg.RedisMaxRetryBackoff)
+	cfg.RedisOpTimeout = getEnvAsDuration("REDIS_OP_TIMEOUT", cfg.RedisOpTimeout)
+	cfg.RedisMode = getEnv("REDIS_MODE", cfg.RedisMode)
+	cfg.RedisMasterName = getEnv("REDIS_MASTER_NAME", cfg.RedisMasterName)
+	cfg.RedisSentinelAddrs = getEnvAsSlice("REDIS_SENTINEL_ADDRS", cfg.RedisSentinelAddrs)
+	cfg.RedisSentinelPassword = getEnv("REDIS_SENTINEL_PASSWORD", cfg.RedisSentinelPassword)
+	cfg.RedisClusterAddrs = getEnvAsSlice("REDIS_CLUSTER_ADDRS", cfg.RedisClusterAddrs)
+	cfg.RedisMigrateKeys = getEnvAsBool("REDIS_MIGRATE_KEYS", cfg.RedisMigrateKeys)
+
+	cfg.PlayerMetadataSource = getEnv("PLAYER_METADATA_SOURCE", cfg.PlayerMetadataSource)
+
+	// 排行榜配置
+	cfg.RankingMethod = getEnv("RANKING_METHOD", cfg.RankingMethod)
+	cfg.RankOrder = getEnv("RANK_ORDER", cfg.RankOrder)
+	cfg.MaxPlayers = getEnvAsInt("MAX_PLAYERS", cfg.MaxPlayers)
+	cfg.MaxScore = getEnvAsInt64("MAX_SCORE", cfg.MaxScore)
+	cfg.ScoreUpdateMode = getEnv("SCORE_UPDATE_MODE", cfg.ScoreUpdateMode)
+	cfg.WriteMode = getEnv("WRITE_MODE", cfg.WriteMode)
+	cfg.EnableCache = getEnvAsBool("ENABLE_CACHE", cfg.EnableCache)
+	cfg.CacheSize = getEnvAsInt("CACHE_SIZE", cfg.CacheSize)
+	cfg.CacheTTL = getEnvAsDuration("CACHE_TTL", cfg.CacheTTL)
+	cfg.CacheMaxStale = getEnvAsDuration("CACHE_MAX_STALE", cfg.CacheMaxStale)
+	cfg.DBFallbackReads = getEnvAsBool("DB_FALLBACK_READS", cfg.DBFallbackReads)
+	cfg.L2CacheEnabled = getEnvAsBool("L2_CACHE_ENABLED", cfg.L2CacheEnabled)
+	cfg.L2CacheTTL = getEnvAsDuration("L2_CACHE_TTL", cfg.L2CacheTTL)
+	cfg.CacheRestoreOnStart = getEnvAsBool("CACHE_RESTORE_ON_START", cfg.CacheRestoreOnStart)
+	cfg.WarmCacheOnStart = getEnvAsBool("WARM_CACHE_ON_START", cfg.WarmCacheOnStart)
+	cfg.WarmCacheTopN = getEnvAsInt("WARM_CACHE_TOP_N", cfg.WarmCacheTopN)
+	cfg.WarmCachePlayers = getEnvAsInt("WARM_CACHE_PLAYERS", cfg.WarmCachePlayers)
+	cfg.CacheDisabledEndpoints = getEnvAsSlice("CACHE_DISABLED_ENDPOINTS", cfg.CacheDisabledEndpoints)
+	cfg.ShardCount = getEnvAsInt("SHARD_COUNT", cfg.ShardCount)
+	cfg.RebuildOnStart = getEnvAsBool("REBUILD_ON_START", cfg.RebuildOnStart)
+	cfg.RebuildPreserveMax = getEnvAsBool("REBUILD_PRESERVE_MAX", cfg.RebuildPreserveMax)
+
+	cfg.PrecomputedRanks = getEnvAsBool("PRECOMPUTED_RANKS", cfg.PrecomputedRanks)
+	cfg.RankRefreshInterval = getEnvAsDuration("RANK_REFRESH_INTERVAL", cfg.RankRefreshInterval)
+
+	// 格式: tournament=1.5,practice=0
+	cfg.ReasonMultipliers = getEnvAsFloatMap("REASON_MULTIPLIERS", cfg.ReasonMultipliers)
+
+	// 格式: event_bonus=72h,daily_quest=24h
+	cfg.ReasonTTLs = getEnvAsDurationMap("REASON_TTLS", cfg.ReasonTTLs)
+	cfg.ScoreExpiryInterval = getEnvAsDuration("SCORE_EXPIRY_INTERVAL", cfg.ScoreExpiryInterval)
+
+	cfg.IdempotencyTTL = getEnvAsDuration("IDEMPOTENCY_TTL", cfg.IdempotencyTTL)
+
+	cfg.DecayEnabled = getEnvAsBool("DECAY_ENABLED", cfg.DecayEnabled)
+	cfg.DecayRate = getEnvAsFloat("DECAY_RATE", cfg.DecayRate)
+	cfg.DecayInterval = getEnvAsDuration("DECAY_INTERVAL", cfg.DecayInterval)
+	cfg.DecayInactiveAfter = getEnvAsDuration("DECAY_INACTIVE_AFTER", cfg.DecayInactiveAfter)
+	cfg.DecayDryRun = getEnvAsBool("DECAY_DRY_RUN", cfg.DecayDryRun)
+
+	// 性能配置
+	cfg.MaxBatchSize = getEnvAsInt("MAX_BATCH_SIZE", cfg.MaxBatchSize)
+	cfg.MaxRankRange = getEnvAsInt("MAX_RANK_RANGE", cfg.MaxRankRange)
+	cfg.MaxTopN = getEnvAsInt("MAX_TOP_N", cfg.MaxTopN)
+	cfg.SnapshotInterval = getEnvAsDuration("SNAPSHOT_INTERVAL", cfg.SnapshotInterval)
+	cfg.HealthCheckInterval = getEnvAsDuration("HEALTH_CHECK_INTERVAL", cfg.HealthCheckInterval)
+	cfg.ScheduleJitter = getEnvAsDuration("SCHEDULE_JITTER", cfg.ScheduleJitter)
+	cfg.WriteTimeout = getEnvAsDuration("WRITE_TIMEOUT", cfg.WriteTimeout)
+	cfg.ReadTimeout = getEnvAsDuration("READ_TIMEOUT", cfg.ReadTimeout)
+	cfg.ShutdownTimeout = getEnvAsDuration("SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout)
+	cfg.SnapshotRetentionCount = getEnvAsInt("SNAPSHOT_RETENTION_COUNT", cfg.SnapshotRetentionCount)
+	cfg.SnapshotRetentionDuration = getEnvAsDuration("SNAPSHOT_RETENTION_DURATION", cfg.SnapshotRetentionDuration)
+
+	cfg.RateLimitRPS = getEnvAsFloat("RATE_LIMIT_RPS", cfg.RateLimitRPS)
+	cfg.RateLimitBurst = getEnvAsInt("RATE_LIMIT_BURST", cfg.RateLimitBurst)
+
+	// 格式: 10.0.0.0/8,192.168.1.10
+	cfg.TrustedProxies = getEnvAsSlice("TRUSTED_PROXIES", cfg.TrustedProxies)
+
+	// 格式: key1,key2
+	cfg.AdminAPIKeys = getEnvAsSlice("ADMIN_API_KEYS", cfg.AdminAPIKeys)
+
+	cfg.WebhookURL = getEnv("WEBHOOK_URL", cfg.WebhookURL)
+	cfg.WebhookTimeout = getEnvAsDuration("WEBHOOK_TIMEOUT", cfg.WebhookTimeout)
+
+	// GraphQL 配置
+	cfg.GraphQLEnabled = getEnvAsBool("GRAPHQL_ENABLED", cfg.GraphQLEnabled)
+
+	// gRPC 配置
+	cfg.GRPCEnabled = getEnvAsBool("GRPC_ENABLED", cfg.GRPCEnabled)
+	cfg.GRPCPort = getEnv("GRPC_PORT", cfg.GRPCPort)
+
+	cfg.FilteredRanksEnabled = getEnvAsBool("FILTERED_RANKS_ENABLED", cfg.FilteredRanksEnabled)
+
+	// 实时推送配置
+	cfg.LiveTopN = getEnvAsInt("LIVE_TOP_N", cfg.LiveTopN)
+	cfg.LiveMaxConnections = getEnvAsInt("LIVE_MAX_CONNECTIONS", cfg.LiveMaxConnections)
+	cfg.PlayerStreamIdleTimeout = getEnvAsDuration("PLAYER_STREAM_IDLE_TIMEOUT", cfg.PlayerStreamIdleTimeout)
+	cfg.LiveAllowedOrigins = getEnvAsSlice("LIVE_ALLOWED_ORIGINS", cfg.LiveAllowedOrigins)
+
+	// 链路追踪配置
+	cfg.TracingEnabled = getEnvAsBool("TRACING_ENABLED", cfg.TracingEnabled)
+	cfg.OTLPEndpoint = getEnv("OTLP_ENDPOINT", cfg.OTLPEndpoint)
+
+	// 就绪检查配置
+	cfg.ReadyErrorRateThreshold = getEnvAsFloat("READY_ERROR_RATE_THRESHOLD", cfg.ReadyErrorRateThreshold)
+	cfg.ReadyErrorRateWindow = getEnvAsDuration("READY_ERROR_RATE_WINDOW", cfg.ReadyErrorRateWindow)
+	cfg.ReadyErrorMinRequests = getEnvAsInt("READY_ERROR_MIN_REQUESTS", cfg.ReadyErrorMinRequests)
+
+	// 监控配置
+	cfg.MetricsEnabled = getEnvAsBool("METRICS_ENABLED", cfg.MetricsEnabled)
+	cfg.MetricsPort = getEnv("METRICS_PORT", cfg.MetricsPort)
+	cfg.MetricsConstLabels = getEnvAsStringMap("METRICS_CONST_LABELS", cfg.MetricsConstLabels)
+}
+
 // Validate 验证配置
 func (c *Config) Validate() error {
 	if c.Port == "" {
@@ -97,25 +535,304 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("MYSQL_DSN is required")
 	}
 
-	if c.RedisAddr == "" {
-		return fmt.Errorf("REDIS_ADDR is required")
+	if c.LogOutput != "stdout" && c.LogOutput != "stderr" && c.LogOutput != "file" {
+		return fmt.Errorf("LOG_OUTPUT must be 'stdout', 'stderr' or 'file'")
+	}
+
+	if c.LogOutput == "file" && c.LogFile == "" {
+		return fmt.Errorf("LOG_FILE is required when LOG_OUTPUT is 'file'")
+	}
+
+	if c.LogFormat != "json" && c.LogFormat != "console" {
+		return fmt.Errorf("LOG_FORMAT must be 'json' or 'console'")
+	}
+
+	if c.LogMaxSizeMB < 0 || c.LogMaxBackups < 0 || c.LogMaxAgeDays < 0 {
+		return fmt.Errorf("LOG_MAX_SIZE_MB, LOG_MAX_BACKUPS and LOG_MAX_AGE_DAYS cannot be negative")
+	}
+
+	if c.MySQLIdleConns < 0 || c.MySQLIdleConns > c.MySQLMaxConns {
+		return fmt.Errorf("MYSQL_IDLE_CONNS must be between 0 and MYSQL_MAX_CONNS")
+	}
+
+	if c.MySQLConnMaxLifetime < 0 {
+		return fmt.Errorf("MYSQL_CONN_MAX_LIFETIME must not be negative")
+	}
+
+	if c.MySQLConnMaxIdleTime < 0 || c.MySQLKeepaliveInterval < 0 {
+		return fmt.Errorf("MYSQL_CONN_MAX_IDLE_TIME and MYSQL_KEEPALIVE_INTERVAL must not be negative")
+	}
+
+	if c.DBOpTimeout < 0 || c.RedisOpTimeout < 0 {
+		return fmt.Errorf("DB_OP_TIMEOUT and REDIS_OP_TIMEOUT must not be negative")
+	}
+
+	switch c.RedisMode {
+	case "single":
+		if c.RedisAddr == "" {
+			return fmt.Errorf("REDIS_ADDR is required")
+		}
+	case "sentinel":
+		if c.RedisMasterName == "" || len(c.RedisSentinelAddrs) == 0 {
+			return fmt.Errorf("REDIS_MASTER_NAME and REDIS_SENTINEL_ADDRS are required when REDIS_MODE is sentinel")
+		}
+	case "cluster":
+		if len(c.RedisClusterAddrs) == 0 {
+			return fmt.Errorf("REDIS_CLUSTER_ADDRS is required when REDIS_MODE is cluster")
+		}
+		if c.RedisDB != 0 {
+			return fmt.Errorf("REDIS_DB must be 0 when REDIS_MODE is cluster")
+		}
+	default:
+		return fmt.Errorf("REDIS_MODE must be 'single', 'sentinel' or 'cluster'")
+	}
+
+	if c.RedisPoolSize <= 0 {
+		return fmt.Errorf("REDIS_POOL_SIZE must be positive")
+	}
+
+	if c.RedisMinIdleConns < 0 || c.RedisMinIdleConns > c.RedisPoolSize {
+		return fmt.Errorf("REDIS_MIN_IDLE_CONNS must be between 0 and REDIS_POOL_SIZE")
+	}
+
+	if c.RedisMaxRetries < 0 {
+		return fmt.Errorf("REDIS_MAX_RETRIES cannot be negative")
+	}
+
+	if c.RedisMinRetryBackoff <= 0 || c.RedisMaxRetryBackoff < c.RedisMinRetryBackoff {
+		return fmt.Errorf("REDIS_MIN_RETRY_BACKOFF must be positive and not greater than REDIS_MAX_RETRY_BACKOFF")
+	}
+
+	if c.PlayerMetadataSource != "redis" && c.PlayerMetadataSource != "mysql" {
+		return fmt.Errorf("PLAYER_METADATA_SOURCE must be 'redis' or 'mysql'")
 	}
 
 	if c.RankingMethod != "standard" && c.RankingMethod != "dense" {
 		return fmt.Errorf("RANKING_METHOD must be 'standard' or 'dense'")
 	}
 
+	if c.ScoreUpdateMode != "set" && c.ScoreUpdateMode != "increment" {
+		return fmt.Errorf("SCORE_UPDATE_MODE must be 'increment' or 'set'")
+	}
+
+	if c.RankOrder != "desc" && c.RankOrder != "asc" {
+		return fmt.Errorf("RANK_ORDER must be 'desc' or 'asc'")
+	}
+
+	if c.WriteMode != "mysql_first" && c.WriteMode != "redis_first" {
+		return fmt.Errorf("WRITE_MODE must be 'mysql_first' or 'redis_first'")
+	}
+
+	if c.MaxScore <= 0 || c.MaxScore > utils.MaxExactScore {
+		return fmt.Errorf("MAX_SCORE must be between 1 and %d (2^53)", utils.MaxExactScore)
+	}
+
+	if c.MaxPlayers < 0 {
+		return fmt.Errorf("MAX_PLAYERS cannot be negative")
+	}
+	// 先写 Redis 时 Redis 是分数的唯一来源，被移出总榜的玩家再次得分时无法得知其原有总分
+	if c.MaxPlayers > 0 && c.WriteMode != "mysql_first" {
+		return fmt.Errorf("MAX_PLAYERS requires WRITE_MODE=mysql_first")
+	}
+
+	for reason, multiplier := range c.ReasonMultipliers {
+		if multiplier < 0 {
+			return fmt.Errorf("REASON_MULTIPLIERS: multiplier for '%s' must not be negative", reason)
+		}
+	}
+
+	for reason, ttl := range c.ReasonTTLs {
+		if ttl <= 0 {
+			return fmt.Errorf("REASON_TTLS: ttl for '%s' must be positive", reason)
+		}
+	}
+
+	if c.ScoreExpiryInterval < 0 {
+		return fmt.Errorf("SCORE_EXPIRY_INTERVAL must not be negative")
+	}
+
+	if c.IdempotencyTTL <= 0 {
+		return fmt.Errorf("IDEMPOTENCY_TTL must be positive")
+	}
+
+	if c.DecayEnabled {
+		if c.DecayRate <= 0 || c.DecayRate > 1 {
+			return fmt.Errorf("DECAY_RATE must be in (0, 1]")
+		}
+		if c.DecayInterval <= 0 {
+			return fmt.Errorf("DECAY_INTERVAL must be positive")
+		}
+		if c.DecayInactiveAfter <= 0 {
+			return fmt.Errorf("DECAY_INACTIVE_AFTER must be positive")
+		}
+		// 分数低者在前时扣减分数反而提升排名；先写 Redis 时 MySQL 不是最新分数
+		if c.RankOrder != "desc" {
+			return fmt.Errorf("DECAY_ENABLED requires RANK_ORDER=desc")
+		}
+		if c.WriteMode != "mysql_first" {
+			return fmt.Errorf("DECAY_ENABLED requires WRITE_MODE=mysql_first")
+		}
+	}
+
 	if c.CacheSize <= 0 {
 		return fmt.Errorf("CACHE_SIZE must be positive")
 	}
 
+	if c.CacheTTL <= 0 {
+		return fmt.Errorf("CACHE_TTL must be positive")
+	}
+
+	if c.CacheMaxStale < 0 {
+		return fmt.Errorf("CACHE_MAX_STALE must not be negative")
+	}
+
+	if c.L2CacheEnabled && c.L2CacheTTL <= 0 {
+		return fmt.Errorf("L2_CACHE_TTL must be positive")
+	}
+
+	if c.WarmCacheOnStart {
+		if !c.EnableCache {
+			return fmt.Errorf("WARM_CACHE_ON_START requires ENABLE_CACHE=true")
+		}
+		if c.WarmCacheTopN < 0 || c.WarmCachePlayers < 0 {
+			return fmt.Errorf("WARM_CACHE_TOP_N and WARM_CACHE_PLAYERS must not be negative")
+		}
+	}
+
+	for _, endpoint := range c.CacheDisabledEndpoints {
+		if endpoint != "rank" && endpoint != "top" {
+			return fmt.Errorf("CACHE_DISABLED_ENDPOINTS: unknown endpoint '%s', must be 'rank' or 'top'", endpoint)
+		}
+	}
+
 	if c.ShardCount <= 0 {
 		return fmt.Errorf("SHARD_COUNT must be positive")
 	}
 
+	if c.MaxBatchSize <= 0 {
+		return fmt.Errorf("MAX_BATCH_SIZE must be positive")
+	}
+
+	if c.MaxRankRange <= 0 {
+		return fmt.Errorf("MAX_RANK_RANGE must be positive")
+	}
+
+	if c.MaxTopN <= 0 {
+		return fmt.Errorf("MAX_TOP_N must be positive")
+	}
+
+	if c.SnapshotInterval <= 0 {
+		return fmt.Errorf("SNAPSHOT_INTERVAL must be positive")
+	}
+
+	if c.SnapshotRetentionCount < 0 {
+		return fmt.Errorf("SNAPSHOT_RETENTION_COUNT must not be negative")
+	}
+
+	if c.SnapshotRetentionDuration < 0 {
+		return fmt.Errorf("SNAPSHOT_RETENTION_DURATION must not be negative")
+	}
+
+	if c.HealthCheckInterval < 0 {
+		return fmt.Errorf("HEALTH_CHECK_INTERVAL must not be negative")
+	}
+
+	if c.ScheduleJitter < 0 {
+		return fmt.Errorf("SCHEDULE_JITTER must not be negative")
+	}
+
+	if c.PrecomputedRanks && c.RankRefreshInterval <= 0 {
+		return fmt.Errorf("RANK_REFRESH_INTERVAL must be positive")
+	}
+
+	if c.WebhookURL != "" && c.WebhookTimeout <= 0 {
+		return fmt.Errorf("WEBHOOK_TIMEOUT must be positive")
+	}
+
+	if c.LiveTopN < 0 || c.LiveTopN > 1000 {
+		return fmt.Errorf("LIVE_TOP_N must be between 0 and 1000")
+	}
+
+	if c.LiveMaxConnections <= 0 {
+		return fmt.Errorf("LIVE_MAX_CONNECTIONS must be positive")
+	}
+
+	if c.PlayerStreamIdleTimeout <= 0 {
+		return fmt.Errorf("PLAYER_STREAM_IDLE_TIMEOUT must be positive")
+	}
+
+	if c.TracingEnabled && c.OTLPEndpoint == "" {
+		return fmt.Errorf("OTLP_ENDPOINT is required when tracing is enabled")
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("SHUTDOWN_TIMEOUT must be positive")
+	}
+
+	if c.RateLimitRPS < 0 {
+		return fmt.Errorf("RATE_LIMIT_RPS must not be negative")
+	}
+
+	if c.RateLimitRPS > 0 && c.RateLimitBurst <= 0 {
+		return fmt.Errorf("RATE_LIMIT_BURST must be positive when rate limiting is enabled")
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("TRUSTED_PROXIES contains invalid IP or CIDR %q", proxy)
+			}
+		}
+	}
+
+	if c.ReadyErrorRateThreshold < 0 || c.ReadyErrorRateThreshold > 100 {
+		return fmt.Errorf("READY_ERROR_RATE_THRESHOLD must be between 0 and 100")
+	}
+
+	if c.ReadyErrorRateThreshold > 0 && c.ReadyErrorRateWindow < time.Second {
+		return fmt.Errorf("READY_ERROR_RATE_WINDOW must be at least 1s")
+	}
+
+	if c.GRPCEnabled {
+		if c.GRPCPort == "" {
+			return fmt.Errorf("GRPC_PORT is required when gRPC is enabled")
+		}
+		if c.GRPCPort == c.Port || (c.MetricsEnabled && c.GRPCPort == c.MetricsPort) {
+			return fmt.Errorf("GRPC_PORT must differ from PORT and METRICS_PORT")
+		}
+	}
+
+	if c.MetricsEnabled && c.MetricsPort == "" {
+		return fmt.Errorf("METRICS_PORT is required when metrics are enabled")
+	}
+
+	for name, value := range c.MetricsConstLabels {
+		if !isValidLabelName(name) {
+			return fmt.Errorf("METRICS_CONST_LABELS: '%s' is not a valid Prometheus label name", name)
+		}
+		if value == "" {
+			return fmt.Errorf("METRICS_CONST_LABELS: value for '%s' must not be empty", name)
+		}
+	}
+
 	return nil
 }
 
+// Prometheus 标签名由字母、数字和下划线组成，不能以数字开头，双下划线开头的名称为保留名称
+func isValidLabelName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "__") {
+		return false
+	}
+	for i, ch := range name {
+		isLetter := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_'
+		isDigit := ch >= '0' && ch <= '9'
+		if !isLetter && !(isDigit && i > 0) {
+			return false
+		}
+	}
+	return true
+}
+
 // IsProduction 检查是否为生产环境
 func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
@@ -155,6 +872,27 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+func getEnvAsInt64(key string, defaultValue int64) int64 {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseInt(valueStr, 10, 64)
+	if err != nil {
+		logger.NewLogger("config").Warn(
+			"Failed to parse environment variable as integer, using default",
+			"key", key,
+			"value", valueStr,
+			"default", defaultValue,
+			"error", err,
+		)
+		return defaultValue
+	}
+
+	return value
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	valueStr := os.Getenv(key)
 	if valueStr == "" {
@@ -176,6 +914,27 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	return value
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		logger.NewLogger("config").Warn(
+			"Failed to parse environment variable as float, using default",
+			"key", key,
+			"value", valueStr,
+			"default", defaultValue,
+			"error", err,
+		)
+		return defaultValue
+	}
+
+	return value
+}
+
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	valueStr := os.Getenv(key)
 	if valueStr == "" {
@@ -196,3 +955,131 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 
 	return value
 }
+
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	result := make([]string, 0)
+	for _, item := range strings.Split(valueStr, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func getEnvAsStringMap(key string, defaultValue map[string]string) map[string]string {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	result := make(map[string]string)
+
+	for _, pair := range strings.Split(valueStr, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			logger.NewLogger("config").Warn(
+				"Ignoring malformed map entry in environment variable",
+				"key", key,
+				"entry", pair,
+			)
+			continue
+		}
+
+		result[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	return result
+}
+
+func getEnvAsFloatMap(key string, defaultValue map[string]float64) map[string]float64 {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	result := make(map[string]float64)
+
+	for _, pair := range strings.Split(valueStr, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, rawValue, ok := strings.Cut(pair, "=")
+		if !ok {
+			logger.NewLogger("config").Warn(
+				"Ignoring malformed map entry in environment variable",
+				"key", key,
+				"entry", pair,
+			)
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(rawValue), 64)
+		if err != nil {
+			logger.NewLogger("config").Warn(
+				"Failed to parse map entry as float, ignoring",
+				"key", key,
+				"entry", pair,
+				"error", err,
+			)
+			continue
+		}
+
+		result[strings.TrimSpace(name)] = value
+	}
+
+	return result
+}
+
+func getEnvAsDurationMap(key string, defaultValue map[string]time.Duration) map[string]time.Duration {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	result := make(map[string]time.Duration)
+
+	for _, pair := range strings.Split(valueStr, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, rawValue, ok := strings.Cut(pair, "=")
+		if !ok {
+			logger.NewLogger("config").Warn(
+				"Ignoring malformed map entry in environment variable",
+				"key", key,
+				"entry", pair,
+			)
+			continue
+		}
+
+		value, err := time.ParseDuration(strings.TrimSpace(rawValue))
+		if err != nil {
+			logger.NewLogger("config").Warn(
+				"Failed to parse map entry as duration, ignoring",
+				"key", key,
+				"entry", pair,
+				"error", err,
+			)
+			continue
+		}
+
+		result[strings.TrimSpace(name)] = value
+	}
+
+	return result
+}
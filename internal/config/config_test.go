@@ -0,0 +1,232 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRedisMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{
+			name:   "single",
+			modify: func(c *Config) {},
+		},
+		{
+			name: "sentinel",
+			modify: func(c *Config) {
+				c.RedisMode = "sentinel"
+				c.RedisMasterName = "mymaster"
+				c.RedisSentinelAddrs = []string{"sentinel:26379"}
+			},
+		},
+		{
+			name:    "sentinel without master name",
+			modify:  func(c *Config) { c.RedisMode = "sentinel" },
+			wantErr: "REDIS_MASTER_NAME",
+		},
+		{
+			name: "cluster",
+			modify: func(c *Config) {
+				c.RedisMode = "cluster"
+				c.RedisClusterAddrs = []string{"redis-0:6379", "redis-1:6379"}
+			},
+		},
+		{
+			name:    "cluster without seed addresses",
+			modify:  func(c *Config) { c.RedisMode = "cluster" },
+			wantErr: "REDIS_CLUSTER_ADDRS",
+		},
+		{
+			name: "cluster with a non-zero db",
+			modify: func(c *Config) {
+				c.RedisMode = "cluster"
+				c.RedisClusterAddrs = []string{"redis-0:6379"}
+				c.RedisDB = 1
+			},
+			wantErr: "REDIS_DB",
+		},
+		{
+			name:    "unknown mode",
+			modify:  func(c *Config) { c.RedisMode = "replica" },
+			wantErr: "REDIS_MODE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateGRPC(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{
+			name:   "disabled",
+			modify: func(c *Config) { c.GRPCPort = "" },
+		},
+		{
+			name:   "enabled on the default port",
+			modify: func(c *Config) { c.GRPCEnabled = true },
+		},
+		{
+			name: "enabled without a port",
+			modify: func(c *Config) {
+				c.GRPCEnabled = true
+				c.GRPCPort = ""
+			},
+			wantErr: "GRPC_PORT is required",
+		},
+		{
+			name: "same port as http",
+			modify: func(c *Config) {
+				c.GRPCEnabled = true
+				c.GRPCPort = c.Port
+			},
+			wantErr: "must differ",
+		},
+		{
+			name: "same port as metrics",
+			modify: func(c *Config) {
+				c.GRPCEnabled = true
+				c.MetricsEnabled = true
+				c.GRPCPort = c.MetricsPort
+			},
+			wantErr: "must differ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigGRPCFromEnv(t *testing.T) {
+	t.Setenv("GRPC_ENABLED", "true")
+	t.Setenv("GRPC_PORT", "9500")
+
+	cfg := LoadConfig()
+	if !cfg.GRPCEnabled || cfg.GRPCPort != "9500" {
+		t.Fatalf("GRPCEnabled, GRPCPort = %v, %q, want true, %q", cfg.GRPCEnabled, cfg.GRPCPort, "9500")
+	}
+}
+
+func TestLoadConfigRedisClusterFromEnv(t *testing.T) {
+	t.Setenv("REDIS_MODE", "cluster")
+	t.Setenv("REDIS_CLUSTER_ADDRS", "redis-0:6379,redis-1:6379")
+
+	cfg := LoadConfig()
+	if cfg.RedisMode != "cluster" || strings.Join(cfg.RedisClusterAddrs, ",") != "redis-0:6379,redis-1:6379" {
+		t.Fatalf("RedisMode, RedisClusterAddrs = %q, %v, want cluster, [redis-0:6379 redis-1:6379]", cfg.RedisMode, cfg.RedisClusterAddrs)
+	}
+}
+
+func TestLoadConfigRedisMigrateKeys(t *testing.T) {
+	// 默认开启，可通过环境变量关闭
+	if cfg := LoadConfig(); !cfg.RedisMigrateKeys {
+		t.Fatal("RedisMigrateKeys = false by default, want true")
+	}
+	t.Setenv("REDIS_MIGRATE_KEYS", "false")
+	if cfg := LoadConfig(); cfg.RedisMigrateKeys {
+		t.Fatal("RedisMigrateKeys = true with REDIS_MIGRATE_KEYS=false, want false")
+	}
+}
+
+func TestLoadMetricsConstLabelsFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "two labels",
+			env:  "game=foo, region=us",
+			want: map[string]string{"game": "foo", "region": "us"},
+		},
+		{
+			name: "malformed entry is skipped",
+			env:  "game=foo,region",
+			want: map[string]string{"game": "foo"},
+		},
+		{
+			name:    "invalid label name",
+			env:     "1game=foo",
+			want:    map[string]string{"1game": "foo"},
+			wantErr: "not a valid Prometheus label name",
+		},
+		{
+			name:    "reserved label name",
+			env:     "__name__=foo",
+			want:    map[string]string{"__name__": "foo"},
+			wantErr: "not a valid Prometheus label name",
+		},
+		{
+			name:    "empty value",
+			env:     "game=",
+			want:    map[string]string{"game": ""},
+			wantErr: "must not be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("METRICS_CONST_LABELS", tt.env)
+
+			cfg := LoadConfig()
+			if len(cfg.MetricsConstLabels) != len(tt.want) {
+				t.Fatalf("MetricsConstLabels = %v, want %v", cfg.MetricsConstLabels, tt.want)
+			}
+			for name, value := range tt.want {
+				if got, ok := cfg.MetricsConstLabels[name]; !ok || got != value {
+					t.Fatalf("MetricsConstLabels = %v, want %v", cfg.MetricsConstLabels, tt.want)
+				}
+			}
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
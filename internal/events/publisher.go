@@ -0,0 +1,28 @@
+package events
+
+import (
+	"context"
+	"time"
+)
+
+// ScoreChangeEvent 分数变更事件，在分数成功写入后发布
+type ScoreChangeEvent struct {
+	PlayerID   string    `json:"playerId"`
+	Delta      int64     `json:"delta"`
+	FinalScore int64     `json:"finalScore"`
+	Reason     string    `json:"reason,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// EventPublisher 分数变更事件的发布目标（webhook、消息队列等）
+type EventPublisher interface {
+	Publish(ctx context.Context, event ScoreChangeEvent) error
+}
+
+// NoopPublisher 不发布任何事件，未配置发布目标时使用
+type NoopPublisher struct{}
+
+// Publish 直接返回
+func (NoopPublisher) Publish(ctx context.Context, event ScoreChangeEvent) error {
+	return nil
+}
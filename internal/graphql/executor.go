@@ -0,0 +1,297 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/service"
+)
+
+const (
+	// 与 REST 接口保持一致的查询上限
+	maxTopN  = 1000
+	maxRange = 100
+
+	// 分数历史默认和最大返回数量
+	defaultHistoryLimit = 10
+	maxHistoryLimit     = 200
+
+	// 单个请求的根字段数量上限和分数历史查询次数上限，每次 history 解析都是一次 MySQL 查询
+	maxRootFields     = 10
+	maxHistoryLookups = 50
+)
+
+// Error GraphQL 错误
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Response GraphQL 响应
+type Response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []*Error               `json:"errors,omitempty"`
+}
+
+// Executor 只读 GraphQL 查询执行器，将查询字段映射到排行榜服务方法
+type Executor struct {
+	leaderboardService *service.LeaderboardService
+}
+
+func NewExecutor(leaderboardService *service.LeaderboardService) *Executor {
+	return &Executor{
+		leaderboardService: leaderboardService,
+	}
+}
+
+// execution 单个请求的执行状态
+type execution struct {
+	*Executor
+
+	// 剩余可执行的分数历史查询次数
+	historyLookups int
+}
+
+// Execute 执行查询，单个字段失败不影响其他字段
+func (e *Executor) Execute(ctx context.Context, query string, variables map[string]interface{}) *Response {
+	fields, err := Parse(query, variables)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+	if len(fields) > maxRootFields {
+		return &Response{Errors: []*Error{{Message: fmt.Sprintf("query selects %d root fields, at most %d are allowed", len(fields), maxRootFields)}}}
+	}
+
+	exec := &execution{Executor: e, historyLookups: maxHistoryLookups}
+	resp := &Response{Data: make(map[string]interface{}, len(fields))}
+	for _, field := range fields {
+		key := field.ResponseKey()
+
+		value, err := exec.resolveRoot(ctx, field)
+		if err != nil {
+			resp.Data[key] = nil
+			resp.Errors = append(resp.Errors, &Error{
+				Message: err.Error(),
+				Path:    []interface{}{key},
+			})
+			continue
+		}
+		resp.Data[key] = value
+	}
+
+	return resp
+}
+
+func (e *execution) resolveRoot(ctx context.Context, field *Field) (interface{}, error) {
+	switch field.Name {
+	case "__typename":
+		return "Query", nil
+
+	case "player":
+		id, err := argString(field, "id")
+		if err != nil {
+			return nil, err
+		}
+		rankInfo, err := e.leaderboardService.GetPlayerRank(ctx, id)
+		if err != nil {
+			if errors.Is(err, service.ErrPlayerNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return e.projectRankInfo(ctx, rankInfo, field.Selections)
+
+	case "topN":
+		n, err := argInt(field, "n")
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("argument 'n' must be a positive integer")
+		}
+		if n > maxTopN {
+			n = maxTopN
+		}
+		rankings, err := e.leaderboardService.GetTopN(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		return e.projectRankInfoList(ctx, rankings, field.Selections)
+
+	case "rankRange":
+		id, err := argString(field, "id")
+		if err != nil {
+			return nil, err
+		}
+		rangeNum, err := argInt(field, "range")
+		if err != nil {
+			return nil, err
+		}
+		if rangeNum <= 0 {
+			return nil, fmt.Errorf("argument 'range' must be a positive integer")
+		}
+		if rangeNum > maxRange {
+			rangeNum = maxRange
+		}
+		rankings, err := e.leaderboardService.GetPlayerRankRange(ctx, id, rangeNum)
+		if err != nil {
+			return nil, err
+		}
+		return e.projectRankInfoList(ctx, rankings, field.Selections)
+	}
+
+	return nil, fmt.Errorf("cannot query field '%s' on type 'Query'", field.Name)
+}
+
+func (e *execution) projectRankInfoList(ctx context.Context, rankings []*model.RankInfo, selections []*Field) (interface{}, error) {
+	result := make([]interface{}, 0, len(rankings))
+	for _, rankInfo := range rankings {
+		item, err := e.projectRankInfo(ctx, rankInfo, selections)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+func (e *execution) projectRankInfo(ctx context.Context, rankInfo *model.RankInfo, selections []*Field) (interface{}, error) {
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("field of type 'RankInfo' must have a selection of subfields")
+	}
+
+	result := make(map[string]interface{}, len(selections))
+	for _, sel := range selections {
+		switch sel.Name {
+		case "__typename":
+			result[sel.ResponseKey()] = "RankInfo"
+		case "playerId":
+			result[sel.ResponseKey()] = rankInfo.PlayerID
+		case "rank":
+			result[sel.ResponseKey()] = rankInfo.Rank
+		case "score":
+			result[sel.ResponseKey()] = rankInfo.Score
+		case "name":
+			result[sel.ResponseKey()] = rankInfo.Name
+		case "updatedAt":
+			if rankInfo.UpdatedAt.IsZero() {
+				result[sel.ResponseKey()] = nil
+			} else {
+				result[sel.ResponseKey()] = rankInfo.UpdatedAt.Format(time.RFC3339)
+			}
+		case "history":
+			history, err := e.resolveHistory(ctx, rankInfo.PlayerID, sel)
+			if err != nil {
+				return nil, err
+			}
+			result[sel.ResponseKey()] = history
+		default:
+			return nil, fmt.Errorf("cannot query field '%s' on type 'RankInfo'", sel.Name)
+		}
+	}
+
+	return result, nil
+}
+
+// 解析 RankInfo.history(limit, offset) 字段
+func (e *execution) resolveHistory(ctx context.Context, playerID string, field *Field) (interface{}, error) {
+	limit := defaultHistoryLimit
+	if _, ok := field.Args["limit"]; ok {
+		n, err := argInt(field, "limit")
+		if err != nil {
+			return nil, err
+		}
+		limit = n
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("argument 'limit' must be a positive integer")
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	offset := 0
+	if _, ok := field.Args["offset"]; ok {
+		n, err := argInt(field, "offset")
+		if err != nil {
+			return nil, err
+		}
+		offset = n
+	}
+
+	if e.historyLookups <= 0 {
+		return nil, fmt.Errorf("query resolves 'history' more than %d times", maxHistoryLookups)
+	}
+	e.historyLookups--
+
+	history, err := e.leaderboardService.GetScoreHistory(ctx, playerID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(field.Selections) == 0 {
+		return nil, fmt.Errorf("field of type 'ScoreHistory' must have a selection of subfields")
+	}
+
+	result := make([]interface{}, 0, len(history))
+	for _, item := range history {
+		entry := make(map[string]interface{}, len(field.Selections))
+		for _, sel := range field.Selections {
+			switch sel.Name {
+			case "__typename":
+				entry[sel.ResponseKey()] = "ScoreHistory"
+			case "rawScoreChange":
+				entry[sel.ResponseKey()] = item.RawScoreChange
+			case "scoreChange":
+				entry[sel.ResponseKey()] = item.ScoreChange
+			case "finalScore":
+				entry[sel.ResponseKey()] = item.FinalScore
+			case "reason":
+				entry[sel.ResponseKey()] = item.Reason
+			case "createdAt":
+				entry[sel.ResponseKey()] = item.CreatedAt.Format(time.RFC3339)
+			default:
+				return nil, fmt.Errorf("cannot query field '%s' on type 'ScoreHistory'", sel.Name)
+			}
+		}
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+func argString(field *Field, name string) (string, error) {
+	value, ok := field.Args[name]
+	if !ok || value == nil {
+		return "", fmt.Errorf("argument '%s' is required", name)
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("argument '%s' must be a string", name)
+	}
+	return str, nil
+}
+
+func argInt(field *Field, name string) (int, error) {
+	value, ok := field.Args[name]
+	if !ok || value == nil {
+		return 0, fmt.Errorf("argument '%s' is required", name)
+	}
+
+	// 字面量解析为 int64，JSON 变量解码为 float64
+	switch v := value.(type) {
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != float64(int64(v)) {
+			return 0, fmt.Errorf("argument '%s' must be an integer", name)
+		}
+		return int(v), nil
+	}
+
+	return 0, fmt.Errorf("argument '%s' must be an integer", name)
+}
@@ -0,0 +1,112 @@
+package graphql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/repository/repotest"
+	"game-leaderboard/internal/service"
+)
+
+// 基于内存存储的执行器，按顺序为每个玩家写入分数变更
+func newTestExecutor(t *testing.T, updates ...model.UpdateRequest) *Executor {
+	t.Helper()
+
+	svc := service.NewLeaderboardService(repotest.NewRedisStore(false, ""), repotest.NewMySQLStore(0), service.Options{})
+	t.Cleanup(svc.Close)
+	for _, req := range updates {
+		if err := svc.UpdateScore(context.Background(), req); err != nil {
+			t.Fatalf("UpdateScore(%s): %v", req.PlayerID, err)
+		}
+	}
+	return NewExecutor(svc)
+}
+
+func TestExecutePlayerRankAndHistory(t *testing.T) {
+	e := newTestExecutor(t,
+		model.UpdateRequest{PlayerID: "p1", Name: "alice", IncrScore: 100, Reason: "win"},
+		model.UpdateRequest{PlayerID: "p1", Name: "alice", IncrScore: 20, Reason: "bonus"},
+		model.UpdateRequest{PlayerID: "p2", Name: "bob", IncrScore: 500},
+	)
+
+	resp := e.Execute(context.Background(),
+		`query Profile($id: String!) { me: player(id: $id) { rank score name history(limit: 1) { scoreChange finalScore reason } } }`,
+		map[string]interface{}{"id": "p1"})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Execute() errors = %v", resp.Errors[0].Message)
+	}
+
+	me, ok := resp.Data["me"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("data.me = %#v, want an object", resp.Data["me"])
+	}
+	if me["rank"] != 2 || me["score"] != int64(120) || me["name"] != "alice" {
+		t.Errorf("me = rank %v score %v name %v, want rank 2 score 120 name alice", me["rank"], me["score"], me["name"])
+	}
+	history, ok := me["history"].([]interface{})
+	if !ok || len(history) != 1 {
+		t.Fatalf("me.history = %#v, want one entry", me["history"])
+	}
+	latest := history[0].(map[string]interface{})
+	if latest["scoreChange"] != int64(20) || latest["finalScore"] != int64(120) || latest["reason"] != "bonus" {
+		t.Errorf("latest history = %v, want the +20 bonus ending at 120", latest)
+	}
+}
+
+func TestExecuteUnknownPlayerIsNull(t *testing.T) {
+	e := newTestExecutor(t)
+
+	resp := e.Execute(context.Background(), `{ player(id: "nobody") { rank } }`, nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Execute() errors = %v", resp.Errors[0].Message)
+	}
+	if v, ok := resp.Data["player"]; !ok || v != nil {
+		t.Errorf("data.player = %#v, want null", v)
+	}
+}
+
+func TestExecuteLimits(t *testing.T) {
+	var updates []model.UpdateRequest
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		updates = append(updates, model.UpdateRequest{PlayerID: id, IncrScore: 10})
+	}
+	e := newTestExecutor(t, updates...)
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{
+			name:    "too many root fields",
+			query:   "{" + strings.Repeat(" topN(n: 1) { rank }", maxRootFields+1) + " }",
+			wantErr: "root fields",
+		},
+		{
+			name:    "nesting too deep",
+			query:   "{ topN(n: 1) { history { reason { a { b { c } } } } } }",
+			wantErr: "maximum depth",
+		},
+		{
+			name: "history lookups across aliased root fields",
+			query: "{" + strings.Repeat(" topN(n: 8) { history { reason } }", maxHistoryLookups/8) +
+				" last: topN(n: 8) { history { reason } } }",
+			wantErr: "'history' more than",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := e.Execute(context.Background(), tt.query, nil)
+			if len(resp.Errors) == 0 {
+				t.Fatalf("Execute() returned no errors, want %q", tt.wantErr)
+			}
+			last := resp.Errors[len(resp.Errors)-1].Message
+			if !strings.Contains(last, tt.wantErr) {
+				t.Errorf("Execute() error = %q, want it to contain %q", last, tt.wantErr)
+			}
+		})
+	}
+}
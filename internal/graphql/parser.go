@@ -0,0 +1,403 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Field 查询中的一个字段选择
+type Field struct {
+	Alias      string
+	Name       string
+	Args       map[string]interface{}
+	Selections []*Field
+}
+
+// ResponseKey 返回字段在结果中的键名（优先使用别名）
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// variableRef 参数中引用的变量，执行前替换为实际值
+type variableRef string
+
+// 选择集的最大嵌套层数，Query 的根字段为第 1 层
+const maxDepth = 5
+
+// Parse 解析只读查询，仅支持 query 操作、字段、别名、参数和变量，不支持片段和指令
+func Parse(query string, variables map[string]interface{}) ([]*Field, error) {
+	p := &parser{lexer: newLexer(query)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	fields, err := p.parseOperation()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := resolveVariables(fields, variables); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+type parser struct {
+	lexer *lexer
+	tok   token
+	depth int
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) expectPunct(value string) error {
+	if p.tok.kind != tokenPunct || p.tok.value != value {
+		return fmt.Errorf("expected '%s' at position %d, got '%s'", value, p.tok.pos, p.tok.value)
+	}
+	return p.advance()
+}
+
+func (p *parser) isPunct(value string) bool {
+	return p.tok.kind == tokenPunct && p.tok.value == value
+}
+
+func (p *parser) parseOperation() ([]*Field, error) {
+	if p.tok.kind == tokenName {
+		if p.tok.value != "query" {
+			return nil, fmt.Errorf("unsupported operation '%s', only query is allowed", p.tok.value)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		// 可选的操作名
+		if p.tok.kind == tokenName {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+
+		// 可选的变量定义，类型信息仅用于跳过
+		if p.isPunct("(") {
+			if err := p.skipVariableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fields, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", p.tok.value, p.tok.pos)
+	}
+
+	return fields, nil
+}
+
+func (p *parser) skipVariableDefinitions() error {
+	depth := 0
+	for {
+		if p.tok.kind == tokenEOF {
+			return fmt.Errorf("unterminated variable definitions")
+		}
+		if p.isPunct("(") {
+			depth++
+		} else if p.isPunct(")") {
+			depth--
+			if depth == 0 {
+				return p.advance()
+			}
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *parser) parseSelectionSet() ([]*Field, error) {
+	if p.depth >= maxDepth {
+		return nil, fmt.Errorf("selection set at position %d exceeds the maximum depth of %d", p.tok.pos, maxDepth)
+	}
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+
+	fields := make([]*Field, 0)
+	for !p.isPunct("}") {
+		if p.tok.kind == tokenEOF {
+			return nil, fmt.Errorf("unterminated selection set")
+		}
+
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, p.advance()
+}
+
+func (p *parser) parseField() (*Field, error) {
+	if p.tok.kind != tokenName {
+		return nil, fmt.Errorf("expected field name at position %d, got '%s'", p.tok.pos, p.tok.value)
+	}
+
+	field := &Field{Name: p.tok.value, Args: make(map[string]interface{})}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	// alias: name
+	if p.isPunct(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokenName {
+			return nil, fmt.Errorf("expected field name after alias at position %d", p.tok.pos)
+		}
+		field.Alias = field.Name
+		field.Name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.isPunct("(") {
+		if err := p.parseArguments(field); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.isPunct("{") {
+		selections, err := p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+		field.Selections = selections
+	}
+
+	return field, nil
+}
+
+func (p *parser) parseArguments(field *Field) error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+
+	for !p.isPunct(")") {
+		if p.tok.kind != tokenName {
+			return fmt.Errorf("expected argument name at position %d, got '%s'", p.tok.pos, p.tok.value)
+		}
+		name := p.tok.value
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return err
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return err
+		}
+		field.Args[name] = value
+	}
+
+	return p.advance()
+}
+
+func (p *parser) parseValue() (interface{}, error) {
+	tok := p.tok
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	switch tok.kind {
+	case tokenString:
+		return tok.value, nil
+	case tokenInt:
+		return strconv.ParseInt(tok.value, 10, 64)
+	case tokenVariable:
+		return variableRef(tok.value), nil
+	case tokenName:
+		switch tok.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported argument value '%s' at position %d", tok.value, tok.pos)
+}
+
+// 将参数中的变量引用替换为请求中传入的变量值
+func resolveVariables(fields []*Field, variables map[string]interface{}) error {
+	for _, field := range fields {
+		for name, value := range field.Args {
+			ref, ok := value.(variableRef)
+			if !ok {
+				continue
+			}
+			actual, ok := variables[string(ref)]
+			if !ok {
+				return fmt.Errorf("variable '$%s' is not provided", ref)
+			}
+			field.Args[name] = actual
+		}
+
+		if err := resolveVariables(field.Selections, variables); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenString
+	tokenInt
+	tokenVariable
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+type lexer struct {
+	input []rune
+	pos   int
+}
+
+func newLexer(input string) *lexer {
+	return &lexer{input: []rune(input)}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+
+	if l.pos >= len(l.input) {
+		return token{kind: tokenEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	ch := l.input[l.pos]
+
+	switch {
+	case strings.ContainsRune("{}():![]=", ch):
+		l.pos++
+		return token{kind: tokenPunct, value: string(ch), pos: start}, nil
+	case ch == '$':
+		l.pos++
+		name := l.readName()
+		if name == "" {
+			return token{}, fmt.Errorf("expected variable name at position %d", start)
+		}
+		return token{kind: tokenVariable, value: name, pos: start}, nil
+	case ch == '"':
+		value, err := l.readString()
+		if err != nil {
+			return token{}, err
+		}
+		return token{kind: tokenString, value: value, pos: start}, nil
+	case ch == '-' || unicode.IsDigit(ch):
+		l.pos++
+		for l.pos < len(l.input) && unicode.IsDigit(l.input[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokenInt, value: string(l.input[start:l.pos]), pos: start}, nil
+	case ch == '_' || unicode.IsLetter(ch):
+		return token{kind: tokenName, value: l.readName(), pos: start}, nil
+	}
+
+	return token{}, fmt.Errorf("unexpected character '%c' at position %d", ch, start)
+}
+
+// 跳过空白、逗号和注释
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.input) {
+		ch := l.input[l.pos]
+		if ch == '#' {
+			for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		if ch != ',' && !unicode.IsSpace(ch) {
+			return
+		}
+		l.pos++
+	}
+}
+
+func (l *lexer) readName() string {
+	start := l.pos
+	for l.pos < len(l.input) {
+		ch := l.input[l.pos]
+		if ch != '_' && !unicode.IsLetter(ch) && !unicode.IsDigit(ch) {
+			break
+		}
+		l.pos++
+	}
+	return string(l.input[start:l.pos])
+}
+
+func (l *lexer) readString() (string, error) {
+	start := l.pos
+	l.pos++ // 跳过开头的引号
+
+	var sb strings.Builder
+	for l.pos < len(l.input) {
+		ch := l.input[l.pos]
+		switch ch {
+		case '"':
+			l.pos++
+			return sb.String(), nil
+		case '\\':
+			if l.pos+1 >= len(l.input) {
+				return "", fmt.Errorf("unterminated string at position %d", start)
+			}
+			l.pos++
+			switch esc := l.input[l.pos]; esc {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			default:
+				sb.WriteRune(esc)
+			}
+		default:
+			sb.WriteRune(ch)
+		}
+		l.pos++
+	}
+
+	return "", fmt.Errorf("unterminated string at position %d", start)
+}
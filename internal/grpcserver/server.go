@@ -0,0 +1,302 @@
+// Package grpcserver 以 gRPC 协议提供 api/proto/leaderboard.proto 中定义的排行榜接口，服务端桩代码生成在 api/leaderboardpb，
+// 请求直接委托给 LeaderboardService，与 HTTP 接口共用同一套业务逻辑
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path"
+	"strconv"
+	"time"
+
+	"game-leaderboard/api/leaderboardpb"
+	"game-leaderboard/internal/metrics"
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/service"
+	"game-leaderboard/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 请求ID的请求元数据，与 HTTP 接口的 X-Request-ID 相同（gRPC 元数据的键均为小写）
+const requestIDMetadata = "x-request-id"
+
+var (
+	grpcRequests = promauto.With(metrics.Registerer).NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_requests_total",
+		Help: "Total number of gRPC requests",
+	}, []string{"method", "code"})
+
+	grpcRequestDuration = promauto.With(metrics.Registerer).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_request_duration_seconds",
+		Help:    "gRPC request duration in seconds",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+// Server 排行榜 gRPC 服务端
+type Server struct {
+	leaderboardpb.UnimplementedLeaderboardServer
+
+	leaderboardService *service.LeaderboardService
+	logger             *logger.Logger
+	maxRankRange       int
+	maxTopN            int
+
+	grpcServer *grpc.Server
+}
+
+// NewServer maxRankRange、maxTopN 与 HTTP 接口使用相同的配置
+func NewServer(leaderboardService *service.LeaderboardService, maxRankRange, maxTopN int) *Server {
+	return newServer(leaderboardService, maxRankRange, maxTopN)
+}
+
+// opts 追加在默认选项之后，测试用来加入拦截器
+func newServer(leaderboardService *service.LeaderboardService, maxRankRange, maxTopN int, opts ...grpc.ServerOption) *Server {
+	s := &Server{
+		leaderboardService: leaderboardService,
+		logger:             logger.NewLogger("grpc_server"),
+		maxRankRange:       maxRankRange,
+		maxTopN:            maxTopN,
+	}
+
+	opts = append([]grpc.ServerOption{grpc.ChainUnaryInterceptor(s.intercept)}, opts...)
+	s.grpcServer = grpc.NewServer(opts...)
+	leaderboardpb.RegisterLeaderboardServer(s.grpcServer, s)
+	return s
+}
+
+// ListenAndServe 在 addr 上监听并处理请求，Shutdown 后返回 nil
+func (s *Server) ListenAndServe(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(lis)
+}
+
+// Serve 在 lis 上处理请求，Shutdown 后返回 nil
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpcServer.Serve(lis)
+}
+
+// Shutdown 通过 GracefulStop 停止接受新的连接和调用，等待进行中的调用完成；
+// ctx 到期时强制关闭所有连接并取消进行中调用的上下文，不再等待处理函数返回，返回 ctx.Err()
+func (s *Server) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
+
+// 一元调用拦截器：从元数据读取请求ID，记录指标，并将服务返回的错误转换为 gRPC 状态
+func (s *Server) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	method := path.Base(info.FullMethod)
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDMetadata); len(ids) > 0 && ids[0] != "" {
+			ctx = logger.ContextWithRequestID(ctx, ids[0])
+		}
+	}
+
+	resp, err := handler(ctx, req)
+	err = s.toStatus(ctx, method, err)
+
+	grpcRequests.WithLabelValues(method, strconv.Itoa(int(status.Code(err)))).Inc()
+	grpcRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// 将处理结果转换为 gRPC 状态，未识别的错误记录日志并返回 INTERNAL
+func (s *Server) toStatus(ctx context.Context, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, service.ErrPlayerNotFound):
+		return status.Error(codes.NotFound, "player not found")
+	case errors.Is(err, service.ErrInvalidPlayerID),
+		errors.Is(err, service.ErrInvalidTTL),
+		errors.Is(err, service.ErrScoreOutOfRange),
+		errors.Is(err, service.ErrInvalidIdempotencyKey),
+		errors.Is(err, service.ErrInvalidWindow):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrIdempotencyKeyInProgress), errors.Is(err, service.ErrIdempotencyKeyReused):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+
+	s.logger.WithContext(ctx).Error("gRPC call failed",
+		"method", method,
+		"error", err)
+	return status.Error(codes.Internal, err.Error())
+}
+
+// UpdateScore 更新玩家分数，带幂等键时重复提交返回首次的结果
+func (s *Server) UpdateScore(ctx context.Context, req *leaderboardpb.UpdateScoreRequest) (*leaderboardpb.UpdateScoreResponse, error) {
+	if req.PlayerId == "" {
+		return nil, status.Error(codes.InvalidArgument, "player_id is required")
+	}
+	if req.TtlSeconds < 0 {
+		return nil, status.Error(codes.InvalidArgument, "ttl_seconds must not be negative")
+	}
+	// 与 HTTP 的 POST /upscores 相同只允许增量更新，覆盖总分只能通过 HTTP 管理员接口
+	if req.SetAbsolute {
+		return nil, status.Error(codes.InvalidArgument, "set_absolute is not allowed, use the admin score endpoint")
+	}
+
+	update := model.UpdateRequest{
+		PlayerID:   req.PlayerId,
+		IncrScore:  req.IncrScore,
+		Name:       req.Name,
+		Reason:     req.Reason,
+		TTLSeconds: req.TtlSeconds,
+	}
+	if req.IdempotencyKey != "" {
+		receipt, replayed, err := s.leaderboardService.UpdateScoreIdempotent(ctx, req.IdempotencyKey, update)
+		if err != nil {
+			return nil, err
+		}
+		return &leaderboardpb.UpdateScoreResponse{
+			PlayerId:    receipt.PlayerID,
+			ScoreChange: receipt.ScoreChange,
+			SetAbsolute: receipt.SetAbsolute,
+			Replayed:    replayed,
+		}, nil
+	}
+
+	if err := s.leaderboardService.UpdateScore(ctx, update); err != nil {
+		return nil, err
+	}
+	return &leaderboardpb.UpdateScoreResponse{
+		PlayerId:    req.PlayerId,
+		ScoreChange: req.IncrScore,
+	}, nil
+}
+
+// GetPlayerRank 获取玩家排名
+func (s *Server) GetPlayerRank(ctx context.Context, req *leaderboardpb.GetPlayerRankRequest) (*leaderboardpb.RankInfo, error) {
+	if req.PlayerId == "" {
+		return nil, status.Error(codes.InvalidArgument, "player_id is required")
+	}
+	ctx, err := withRankingMethod(ctx, req.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	rankInfo, err := s.leaderboardService.GetPlayerRank(ctx, req.PlayerId)
+	if err != nil {
+		return nil, err
+	}
+	return toRankInfo(rankInfo), nil
+}
+
+// GetTopN 获取前N名玩家，n 超过上限时按上限截断，n 为 0 时返回空列表
+func (s *Server) GetTopN(ctx context.Context, req *leaderboardpb.GetTopNRequest) (*leaderboardpb.RankList, error) {
+	if req.N < 0 {
+		return nil, status.Error(codes.InvalidArgument, "n must not be negative")
+	}
+	ctx, err := withRankingMethod(ctx, req.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	n := min(int(req.N), s.maxTopN)
+	if n == 0 {
+		return &leaderboardpb.RankList{}, nil
+	}
+
+	var rankings []*model.RankInfo
+	if req.Window != "" {
+		rankings, err = s.leaderboardService.GetTopNForWindow(ctx, req.Window, n)
+	} else {
+		rankings, err = s.leaderboardService.GetTopN(ctx, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toRankList(rankings), nil
+}
+
+// GetPlayerRankRange 获取玩家周边排名
+func (s *Server) GetPlayerRankRange(ctx context.Context, req *leaderboardpb.GetPlayerRankRangeRequest) (*leaderboardpb.RankList, error) {
+	if req.PlayerId == "" {
+		return nil, status.Error(codes.InvalidArgument, "player_id is required")
+	}
+	if req.Range <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "range must be a positive integer")
+	}
+	if int(req.Range) > s.maxRankRange {
+		return nil, status.Errorf(codes.InvalidArgument, "range %d exceeds the maximum of %d", req.Range, s.maxRankRange)
+	}
+	ctx, err := withRankingMethod(ctx, req.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	rankings, err := s.leaderboardService.GetPlayerRankRange(ctx, req.PlayerId, int(req.Range))
+	if err != nil {
+		return nil, err
+	}
+	return toRankList(rankings), nil
+}
+
+// 未指定排名方式时使用服务配置
+func withRankingMethod(ctx context.Context, method leaderboardpb.RankingMethod) (context.Context, error) {
+	switch method {
+	case leaderboardpb.RankingMethod_RANKING_METHOD_UNSPECIFIED:
+		return ctx, nil
+	case leaderboardpb.RankingMethod_RANKING_METHOD_STANDARD:
+		return service.WithRankingMethod(ctx, service.RankingStandard)
+	case leaderboardpb.RankingMethod_RANKING_METHOD_DENSE:
+		return service.WithRankingMethod(ctx, service.RankingDense)
+	}
+	return nil, status.Errorf(codes.InvalidArgument, "unknown ranking method %d", method)
+}
+
+func toRankInfo(rankInfo *model.RankInfo) *leaderboardpb.RankInfo {
+	result := &leaderboardpb.RankInfo{
+		PlayerId:    rankInfo.PlayerID,
+		Rank:        int32(rankInfo.Rank),
+		Score:       rankInfo.Score,
+		Name:        rankInfo.Name,
+		Approximate: rankInfo.Approximate,
+		Stale:       rankInfo.Stale,
+		Fallback:    rankInfo.Fallback,
+	}
+	if !rankInfo.UpdatedAt.IsZero() {
+		result.UpdatedAt = rankInfo.UpdatedAt.Unix()
+	}
+	return result
+}
+
+func toRankList(rankings []*model.RankInfo) *leaderboardpb.RankList {
+	result := &leaderboardpb.RankList{Rankings: make([]*leaderboardpb.RankInfo, len(rankings))}
+	for i, rankInfo := range rankings {
+		result.Rankings[i] = toRankInfo(rankInfo)
+	}
+	return result
+}
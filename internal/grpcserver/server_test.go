@@ -0,0 +1,341 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"game-leaderboard/api/leaderboardpb"
+	"game-leaderboard/internal/repository/repotest"
+	"game-leaderboard/internal/service"
+	"game-leaderboard/pkg/logger"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 在本地端口启动使用内存存储的 gRPC 服务端，返回服务端和连接到它的客户端连接
+func newTestServer(t *testing.T, opts ...grpc.ServerOption) (*Server, *grpc.ClientConn) {
+	t.Helper()
+
+	svc := service.NewLeaderboardService(repotest.NewRedisStore(false, ""), repotest.NewMySQLStore(0), service.Options{})
+	t.Cleanup(svc.Close)
+
+	srv := newServer(svc, 5, 3, opts...)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(lis) }()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+		if err := <-served; err != nil {
+			t.Errorf("Serve() = %v, want nil after shutdown", err)
+		}
+	})
+	return srv, conn
+}
+
+func TestServerRoundTrip(t *testing.T) {
+	_, conn := newTestServer(t)
+	client := leaderboardpb.NewLeaderboardClient(conn)
+	ctx := context.Background()
+
+	updates := []*leaderboardpb.UpdateScoreRequest{
+		{PlayerId: "p1", IncrScore: 50, Name: "alice"},
+		{PlayerId: "p2", IncrScore: 80, Name: "bob"},
+		{PlayerId: "p3", IncrScore: 50, Name: "carol"},
+		{PlayerId: "p4", IncrScore: -10, Name: "dave"},
+	}
+	for _, req := range updates {
+		resp, err := client.UpdateScore(ctx, req)
+		if err != nil {
+			t.Fatalf("UpdateScore(%s) error = %v", req.PlayerId, err)
+		}
+		if resp.PlayerId != req.PlayerId || resp.ScoreChange != req.IncrScore {
+			t.Fatalf("UpdateScore(%s) = %v", req.PlayerId, resp)
+		}
+	}
+
+	t.Run("idempotent update is replayed", func(t *testing.T) {
+		req := &leaderboardpb.UpdateScoreRequest{PlayerId: "p4", IncrScore: 5, Name: "dave", IdempotencyKey: "k1"}
+		for i, wantReplayed := range []bool{false, true} {
+			resp, err := client.UpdateScore(ctx, req)
+			if err != nil {
+				t.Fatalf("call %d error = %v", i, err)
+			}
+			if resp.Replayed != wantReplayed || resp.ScoreChange != 5 {
+				t.Fatalf("call %d = %v, want replayed %v", i, resp, wantReplayed)
+			}
+		}
+	})
+
+	t.Run("player rank", func(t *testing.T) {
+		resp, err := client.GetPlayerRank(ctx, &leaderboardpb.GetPlayerRankRequest{PlayerId: "p4"})
+		if err != nil {
+			t.Fatalf("GetPlayerRank(p4) error = %v", err)
+		}
+		if resp.Rank != 4 || resp.Score != -5 || resp.Name != "dave" {
+			t.Fatalf("GetPlayerRank(p4) = %v, want rank 4 score -5 name dave", resp)
+		}
+	})
+
+	t.Run("dense rank", func(t *testing.T) {
+		req := &leaderboardpb.GetPlayerRankRequest{PlayerId: "p4", Method: leaderboardpb.RankingMethod_RANKING_METHOD_DENSE}
+		resp, err := client.GetPlayerRank(ctx, req)
+		if err != nil {
+			t.Fatalf("GetPlayerRank(p4) error = %v", err)
+		}
+		if resp.Rank != 3 {
+			t.Fatalf("dense rank of p4 = %d, want 3", resp.Rank)
+		}
+	})
+
+	t.Run("top n is clamped", func(t *testing.T) {
+		resp, err := client.GetTopN(ctx, &leaderboardpb.GetTopNRequest{N: 10})
+		if err != nil {
+			t.Fatalf("GetTopN(10) error = %v", err)
+		}
+		if len(resp.Rankings) != 3 || resp.Rankings[0].PlayerId != "p2" || resp.Rankings[0].Score != 80 {
+			t.Fatalf("GetTopN(10) = %v, want 3 rankings led by p2", resp.Rankings)
+		}
+	})
+
+	t.Run("top zero", func(t *testing.T) {
+		resp, err := client.GetTopN(ctx, &leaderboardpb.GetTopNRequest{})
+		if err != nil {
+			t.Fatalf("GetTopN(0) error = %v", err)
+		}
+		if len(resp.Rankings) != 0 {
+			t.Fatalf("GetTopN(0) = %v, want empty", resp.Rankings)
+		}
+	})
+
+	t.Run("rank range", func(t *testing.T) {
+		resp, err := client.GetPlayerRankRange(ctx, &leaderboardpb.GetPlayerRankRangeRequest{PlayerId: "p4", Range: 2})
+		if err != nil {
+			t.Fatalf("GetPlayerRankRange(p4, 2) error = %v", err)
+		}
+		if len(resp.Rankings) != 2 || resp.Rankings[1].PlayerId != "p4" || resp.Rankings[1].Rank != 4 {
+			t.Fatalf("GetPlayerRankRange(p4, 2) = %v, want the window to end at p4", resp.Rankings)
+		}
+	})
+}
+
+func TestServerErrors(t *testing.T) {
+	_, conn := newTestServer(t)
+	client := leaderboardpb.NewLeaderboardClient(conn)
+
+	tests := []struct {
+		name     string
+		call     func(ctx context.Context) error
+		wantCode codes.Code
+	}{
+		{
+			name: "player not found",
+			call: func(ctx context.Context) error {
+				_, err := client.GetPlayerRank(ctx, &leaderboardpb.GetPlayerRankRequest{PlayerId: "missing"})
+				return err
+			},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "missing player id",
+			call: func(ctx context.Context) error {
+				_, err := client.UpdateScore(ctx, &leaderboardpb.UpdateScoreRequest{IncrScore: 1})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "negative ttl",
+			call: func(ctx context.Context) error {
+				_, err := client.UpdateScore(ctx, &leaderboardpb.UpdateScoreRequest{PlayerId: "p1", IncrScore: 1, TtlSeconds: -1})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			// 覆盖总分只能通过 HTTP 管理员接口
+			name: "set absolute",
+			call: func(ctx context.Context) error {
+				_, err := client.UpdateScore(ctx, &leaderboardpb.UpdateScoreRequest{PlayerId: "p1", IncrScore: 1, SetAbsolute: true})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "unknown ranking method",
+			call: func(ctx context.Context) error {
+				_, err := client.GetPlayerRank(ctx, &leaderboardpb.GetPlayerRankRequest{PlayerId: "p1", Method: 7})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "negative n",
+			call: func(ctx context.Context) error {
+				_, err := client.GetTopN(ctx, &leaderboardpb.GetTopNRequest{N: -1})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "invalid window",
+			call: func(ctx context.Context) error {
+				_, err := client.GetTopN(ctx, &leaderboardpb.GetTopNRequest{N: 1, Window: "yearly"})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "range too large",
+			call: func(ctx context.Context) error {
+				_, err := client.GetPlayerRankRange(ctx, &leaderboardpb.GetPlayerRankRangeRequest{PlayerId: "p1", Range: 6})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			// proto 中未定义的方法
+			name: "unknown method",
+			call: func(ctx context.Context) error {
+				return conn.Invoke(ctx, "/leaderboard.v1.Leaderboard/DeletePlayer",
+					&leaderboardpb.GetPlayerRankRequest{PlayerId: "p1"}, &leaderboardpb.RankInfo{})
+			},
+			wantCode: codes.Unimplemented,
+		},
+		{
+			name: "deadline exceeded",
+			call: func(ctx context.Context) error {
+				ctx, cancel := context.WithTimeout(ctx, -time.Second)
+				defer cancel()
+				_, err := client.GetTopN(ctx, &leaderboardpb.GetTopNRequest{N: 1})
+				return err
+			},
+			wantCode: codes.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(context.Background())
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("error = %v, want code %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestServerRequestID(t *testing.T) {
+	// 在服务端拦截器之后读取上下文中的请求ID
+	requestIDs := make(chan string, 1)
+	record := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		requestIDs <- logger.RequestIDFromContext(ctx)
+		return handler(ctx, req)
+	}
+	_, conn := newTestServer(t, grpc.ChainUnaryInterceptor(record))
+	client := leaderboardpb.NewLeaderboardClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "X-Request-ID", "req-1")
+	if _, err := client.GetTopN(ctx, &leaderboardpb.GetTopNRequest{}); err != nil {
+		t.Fatalf("GetTopN() error = %v", err)
+	}
+	if got := <-requestIDs; got != "req-1" {
+		t.Errorf("request ID = %q, want req-1", got)
+	}
+}
+
+// 返回一个阻塞调用直到 release 关闭或调用被取消的拦截器，started 在调用开始时收到通知
+func blockingInterceptor(started chan<- struct{}, release <-chan struct{}) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return handler(ctx, req)
+	}
+}
+
+func TestShutdownWaitsForInflightCalls(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	srv, conn := newTestServer(t, grpc.ChainUnaryInterceptor(blockingInterceptor(started, release)))
+	client := leaderboardpb.NewLeaderboardClient(conn)
+
+	// 发起一个进行中的调用
+	called := make(chan error, 1)
+	go func() {
+		_, err := client.GetTopN(context.Background(), &leaderboardpb.GetTopNRequest{N: 1})
+		called <- err
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v while a call was in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-called; err != nil {
+		t.Fatalf("in-flight call error = %v, want it to complete", err)
+	}
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Fatalf("Shutdown() = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return after the in-flight call finished")
+	}
+
+	// 关闭后新的调用失败
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.GetTopN(ctx, &leaderboardpb.GetTopNRequest{N: 1}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("call after shutdown error = %v, want code %v", err, codes.Unavailable)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+	srv, conn := newTestServer(t, grpc.ChainUnaryInterceptor(blockingInterceptor(started, release)))
+	client := leaderboardpb.NewLeaderboardClient(conn)
+
+	called := make(chan error, 1)
+	go func() {
+		_, err := client.GetTopN(context.Background(), &leaderboardpb.GetTopNRequest{N: 1})
+		called <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() = %v, want context.DeadlineExceeded", err)
+	}
+	// 强制关闭时进行中的调用被中断
+	if err := <-called; status.Code(err) != codes.Unavailable {
+		t.Fatalf("in-flight call error = %v, want code %v", err, codes.Unavailable)
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"game-leaderboard/internal/graphql"
+	"game-leaderboard/internal/service"
+	"game-leaderboard/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GraphQLRequest GraphQL 请求体
+type GraphQLRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type GraphQLHandler struct {
+	executor *graphql.Executor
+	logger   *logger.Logger
+}
+
+func NewGraphQLHandler(leaderboardService *service.LeaderboardService) *GraphQLHandler {
+	return &GraphQLHandler{
+		executor: graphql.NewExecutor(leaderboardService),
+		logger:   logger.NewLogger("graphql_handler"),
+	}
+}
+
+// Query 执行只读 GraphQL 查询
+// @Summary GraphQL 查询
+// @Description 只读 GraphQL 接口，支持 player(id)、topN(n)、rankRange(id, range) 查询，RankInfo 可选 history(limit, offset) 字段
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param request body GraphQLRequest true "GraphQL 请求"
+// @Success 200 {object} graphql.Response "查询结果"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Router /graphql [post]
+func (h *GraphQLHandler) Query(c *gin.Context) {
+	start := time.Now()
+
+	var req GraphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		recordRequestMetrics("POST", "/graphql", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	resp := h.executor.Execute(c.Request.Context(), req.Query, req.Variables)
+	if len(resp.Errors) > 0 {
+		h.requestLogger(c).Warn("GraphQL query returned errors",
+			"errorCount", len(resp.Errors),
+			"firstError", resp.Errors[0].Message)
+	}
+
+	// 按 GraphQL over HTTP 约定，执行错误放在响应体中，状态码仍为 200
+	recordRequestMetrics("POST", "/graphql", "200", start)
+	c.JSON(http.StatusOK, resp)
+}
+
+// 返回附加了当前请求ID的日志记录器
+func (h *GraphQLHandler) requestLogger(c *gin.Context) *logger.Logger {
+	return h.logger.WithContext(c.Request.Context())
+}
@@ -1,33 +1,73 @@
 package handler
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"game-leaderboard/internal/metrics"
+	"game-leaderboard/internal/middleware"
 	"game-leaderboard/internal/model"
 	"game-leaderboard/internal/service"
 	"game-leaderboard/pkg/logger"
+	"game-leaderboard/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// 分数更新的幂等键请求头
+const idempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	// 分页查询默认和最大每页数量
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+
+	// 快照列表默认和最大每页数量
+	defaultSnapshotLimit = 20
+	maxSnapshotLimit     = 100
+
+	// 分数历史默认和最大返回数量
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+
+	// 按天汇总分数变化的默认和最大天数
+	defaultDailyHistoryDays = 30
+	maxDailyHistoryDays     = 90
+
+	// 玩家名称搜索默认和最大返回数量
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+
+	// 异步写入死信默认和最大返回数量
+	defaultDeadWritesLimit = 100
+	maxDeadWritesLimit     = 1000
+)
+
 // 定义指标
 var (
-	requestCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	requestCounter = promauto.With(metrics.Registerer).NewCounterVec(prometheus.CounterOpts{
 		Name: "http_requests_total",
 		Help: "Total number of HTTP requests",
 	}, []string{"method", "endpoint", "status"})
 
-	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	requestDuration = promauto.With(metrics.Registerer).NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "http_request_duration_seconds",
 		Help:    "HTTP request duration in seconds",
 		Buckets: prometheus.DefBuckets,
 	}, []string{"method", "endpoint"})
 
-	leaderboardUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+	leaderboardUpdates = promauto.With(metrics.Registerer).NewCounterVec(prometheus.CounterOpts{
 		Name: "leaderboard_updates_total",
 		Help: "Total number of leaderboard updates",
 	}, []string{"player_id"})
@@ -36,36 +76,59 @@ var (
 type HTTPHandler struct {
 	leaderboardService *service.LeaderboardService
 	logger             *logger.Logger
+	maxBatchSize       int
+	maxRankRange       int
+	maxTopN            int
+
+	// 就绪检查的错误率条件，errorRate 为空时不检查
+	errorRate          *middleware.ErrorRateTracker
+	errorRateThreshold float64
+	errorMinRequests   int
 }
 
-func NewHTTPHandler(leaderboardService *service.LeaderboardService) *HTTPHandler {
+func NewHTTPHandler(leaderboardService *service.LeaderboardService, maxBatchSize, maxRankRange, maxTopN int) *HTTPHandler {
 	return &HTTPHandler{
 		leaderboardService: leaderboardService,
 		logger:             logger.NewLogger("http_handler"),
+		maxBatchSize:       maxBatchSize,
+		maxRankRange:       maxRankRange,
+		maxTopN:            maxTopN,
 	}
 }
 
+// SetErrorRateCheck 就绪检查时，窗口内请求数不少于 minRequests 且 5xx 百分比超过 threshold 则视为不可用
+func (h *HTTPHandler) SetErrorRateCheck(tracker *middleware.ErrorRateTracker, threshold float64, minRequests int) {
+	h.errorRate = tracker
+	h.errorRateThreshold = threshold
+	h.errorMinRequests = minRequests
+}
+
+// 公开的分数更新接口拒绝 setAbsolute 时返回的说明
+const setAbsoluteNotAllowed = "Score updates only accept increments, use PUT /game/rank/user/:playerId/score to set a total score"
+
 // UpdateScore 更新玩家分数
 // @Summary 更新玩家分数
-// @Description 更新指定玩家的分数，如果玩家不存在则创建
+// @Description 按增量更新指定玩家的分数，如果玩家不存在则创建；不接受 setAbsolute，直接设置总分需使用需要管理员权限的 PUT /user/{playerId}/score
+// @Description ttlSeconds 大于 0 时本次增量到期后自动从总分中扣回
+// @Description 携带幂等键时同一键只生效一次，重复提交返回首次的结果（replayed 为 true）
+// @Description 新的总分或单次增量的绝对值超过服务配置的上限（MAX_SCORE）时返回 400
 // @Tags scores
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "幂等键，优先于请求体中的 idempotencyKey"
 // @Param request body model.UpdateRequest true "分数更新请求"
 // @Success 200 {object} SuccessResponse "更新成功"
 // @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 409 {object} ErrorResponse "同一幂等键的请求仍在处理中，或已用于其他玩家"
 // @Failure 500 {object} ErrorResponse "服务器内部错误"
 // @Router /scores [post]
 func (h *HTTPHandler) UpdateScore(c *gin.Context) {
 	start := time.Now()
 
 	var req model.UpdateRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if errResp := bindJSON(c, &req); errResp != nil {
 		h.recordMetrics(c, "POST", "/scores", "400", start)
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "Invalid request body",
-			Message: err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, errResp)
 		return
 	}
 
@@ -78,20 +141,91 @@ func (h *HTTPHandler) UpdateScore(c *gin.Context) {
 		return
 	}
 
-	if req.IncrScore == 0 {
+	// 公开接口只允许增量更新，覆盖总分只能通过管理员接口
+	if req.SetAbsolute {
 		h.recordMetrics(c, "POST", "/scores", "400", start)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "Invalid score",
-			Message: "Score increment cannot be zero",
+			Error:   "setAbsolute is not allowed",
+			Message: setAbsoluteNotAllowed,
 		})
 		return
 	}
 
+	idempotencyKey := c.GetHeader(idempotencyKeyHeader)
+	if idempotencyKey == "" {
+		idempotencyKey = req.IdempotencyKey
+	}
+
+	// 增量为 0 的更新合法（例如相互抵消的奖惩），只记录历史不影响排行榜
 	ctx := c.Request.Context()
-	err := h.leaderboardService.UpdateScore(ctx, req.PlayerID, req.IncrScore, req.Name, req.Reason)
+	var (
+		receipt  *model.UpdateReceipt
+		replayed bool
+		err      error
+	)
+	if idempotencyKey != "" {
+		receipt, replayed, err = h.leaderboardService.UpdateScoreIdempotent(ctx, idempotencyKey, req)
+	} else {
+		err = h.leaderboardService.UpdateScore(ctx, req)
+	}
+	if errors.Is(err, service.ErrInvalidIdempotencyKey) {
+		h.recordMetrics(c, "POST", "/scores", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid idempotency key",
+			Message: "Idempotency key must be non-blank and at most 255 bytes",
+		})
+		return
+	}
+	if errors.Is(err, service.ErrIdempotencyKeyInProgress) || errors.Is(err, service.ErrIdempotencyKeyReused) {
+		h.recordMetrics(c, "POST", "/scores", "409", start)
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Error:   "Idempotency key conflict",
+			Message: err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidPlayerID) {
+		h.recordMetrics(c, "POST", "/scores", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid playerId",
+			Message: fmt.Sprintf("PlayerID must be at most %d characters and must not contain control characters or only whitespace", utils.MaxPlayerIDLength),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidTTL) {
+		h.recordMetrics(c, "POST", "/scores", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid ttlSeconds",
+			Message: err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrScoreOutOfRange) {
+		h.recordMetrics(c, "POST", "/scores", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Score out of range",
+			Message: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		h.recordMetrics(c, "POST", "/scores", "500", start)
-		h.logger.Error("Failed to update score",
+
+		// MySQL 已写入但 Redis 同步失败，排行榜暂未反映本次更新
+		if errors.Is(err, service.ErrRedisSyncFailed) {
+			h.requestLogger(c).Error("Score persisted but leaderboard sync failed",
+				"playerID", req.PlayerID,
+				"score", req.IncrScore,
+				"error", err)
+
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "Leaderboard sync failed",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		h.requestLogger(c).Error("Failed to update score",
 			"playerID", req.PlayerID,
 			"score", req.IncrScore,
 			"error", err)
@@ -103,17 +237,179 @@ func (h *HTTPHandler) UpdateScore(c *gin.Context) {
 		return
 	}
 
-	// 记录指标
-	leaderboardUpdates.WithLabelValues(req.PlayerID).Inc()
+	if receipt == nil {
+		receipt = &model.UpdateReceipt{
+			PlayerID:    req.PlayerID,
+			ScoreChange: req.IncrScore,
+			SetAbsolute: req.SetAbsolute,
+			Timestamp:   time.Now(),
+		}
+	}
+
+	// 记录指标，重复提交未更新分数不计入
+	if !replayed {
+		leaderboardUpdates.WithLabelValues(req.PlayerID).Inc()
+	}
 	h.recordMetrics(c, "POST", "/scores", "200", start)
 
+	data := map[string]interface{}{
+		"playerId":    receipt.PlayerID,
+		"scoreChange": receipt.ScoreChange,
+		"setAbsolute": receipt.SetAbsolute,
+		"timestamp":   receipt.Timestamp,
+	}
+	if replayed {
+		data["replayed"] = true
+	}
 	c.JSON(http.StatusOK, SuccessResponse{
 		Message: "Score updated successfully",
+		Data:    data,
+	})
+}
+
+// BatchUpdateScores 批量更新玩家分数
+// @Summary 批量更新玩家分数
+// @Description 一次更新多个玩家的分数，逐条返回处理结果，单条失败不影响其他记录；请求体校验不通过时整批拒绝并在 fields 中返回出错字段
+// @Description 与 POST /upscores 相同，不接受 setAbsolute
+// @Tags scores
+// @Accept json
+// @Produce json
+// @Param request body model.BatchUpdateRequest true "批量分数更新请求"
+// @Success 200 {object} BatchUpdateResponse "逐条处理结果"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Router /upscores/batch [post]
+func (h *HTTPHandler) BatchUpdateScores(c *gin.Context) {
+	start := time.Now()
+
+	h.limitBatchBody(c)
+
+	var req model.BatchUpdateRequest
+	if errResp := bindJSON(c, &req); errResp != nil {
+		h.recordMetrics(c, "POST", "/upscores/batch", "400", start)
+		c.JSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	if len(req.Updates) == 0 {
+		h.recordMetrics(c, "POST", "/upscores/batch", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Updates are required",
+			Message: "Updates cannot be empty",
+		})
+		return
+	}
+
+	if !h.checkBatchSize(c, "POST", "/upscores/batch", len(req.Updates), start) {
+		return
+	}
+
+	fields := make(map[string]string)
+	for i, update := range req.Updates {
+		if update.SetAbsolute {
+			fields[fmt.Sprintf("updates[%d].setAbsolute", i)] = "not_allowed"
+		}
+	}
+	if len(fields) > 0 {
+		h.recordMetrics(c, "POST", "/upscores/batch", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "setAbsolute is not allowed",
+			Message: setAbsoluteNotAllowed,
+			Fields:  fields,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	results := h.leaderboardService.BatchUpdateScores(ctx, req.Updates)
+
+	succeeded := 0
+	for i, result := range results {
+		if result.Success {
+			succeeded++
+			leaderboardUpdates.WithLabelValues(req.Updates[i].PlayerID).Inc()
+		}
+	}
+
+	h.recordMetrics(c, "POST", "/upscores/batch", "200", start)
+	c.JSON(http.StatusOK, BatchUpdateResponse{
+		Total:     len(results),
+		Succeeded: succeeded,
+		Failed:    len(results) - succeeded,
+		Results:   results,
+	})
+}
+
+// UpdatePlayerNames 批量更新玩家名称
+// @Summary 批量更新玩家名称
+// @Description 批量更新玩家显示名称，不修改分数也不记录分数历史
+// @Tags scores
+// @Accept json
+// @Produce json
+// @Param request body model.UpdateNamesRequest true "玩家ID到名称的映射"
+// @Success 200 {object} SuccessResponse "更新成功"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /names [post]
+func (h *HTTPHandler) UpdatePlayerNames(c *gin.Context) {
+	start := time.Now()
+
+	h.limitBatchBody(c)
+
+	var req model.UpdateNamesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.recordMetrics(c, "POST", "/names", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if len(req.Names) == 0 {
+		h.recordMetrics(c, "POST", "/names", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Names are required",
+			Message: "Names cannot be empty",
+		})
+		return
+	}
+
+	if !h.checkBatchSize(c, "POST", "/names", len(req.Names), start) {
+		return
+	}
+
+	if _, ok := req.Names[""]; ok {
+		h.recordMetrics(c, "POST", "/names", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID cannot be empty",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	updated, err := h.leaderboardService.UpdatePlayerNames(ctx, req.Names)
+	if err != nil {
+		h.recordMetrics(c, "POST", "/names", "500", start)
+		h.requestLogger(c).Error("Failed to update player names",
+			"count", len(req.Names),
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to update player names",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "POST", "/names", "200", start)
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message: "Player names updated successfully",
 		Data: map[string]interface{}{
-			"playerId":    req.PlayerID,
-			"scoreChange": req.IncrScore,
-			"timestamp":   time.Now(),
+			"requested": len(req.Names),
+			"updated":   updated,
 		},
+		Timestamp: time.Now(),
 	})
 }
 
@@ -126,9 +422,28 @@ func (h *HTTPHandler) UpdateScore(c *gin.Context) {
 // @Success 200 {object} model.RankInfo "排名信息"
 // @Failure 404 {object} ErrorResponse "玩家未找到"
 // @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Param fields query string false "只返回指定的字段，逗号分隔，如 playerId,rank"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
 // @Router /rank/{playerId} [get]
 func (h *HTTPHandler) GetPlayerRank(c *gin.Context) {
 	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "GET", "/rank/:playerId", start)
+	if !ok {
+		return
+	}
+
+	fields, ok := h.parseRankFields(c, "GET", "/rank/:playerId", start)
+	if !ok {
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "GET", "/rank/:playerId", start)
+	if !ok {
+		return
+	}
+
 	playerID := c.Param("playerId")
 
 	if playerID == "" {
@@ -140,7 +455,6 @@ func (h *HTTPHandler) GetPlayerRank(c *gin.Context) {
 		return
 	}
 
-	ctx := c.Request.Context()
 	rankInfo, err := h.leaderboardService.GetPlayerRank(ctx, playerID)
 	if err != nil {
 		if err == service.ErrPlayerNotFound {
@@ -153,7 +467,7 @@ func (h *HTTPHandler) GetPlayerRank(c *gin.Context) {
 		}
 
 		h.recordMetrics(c, "GET", "/rank/:playerId", "500", start)
-		h.logger.Error("Failed to get player rank",
+		h.requestLogger(c).Error("Failed to get player rank",
 			"playerID", playerID,
 			"error", err)
 
@@ -165,216 +479,2563 @@ func (h *HTTPHandler) GetPlayerRank(c *gin.Context) {
 	}
 
 	h.recordMetrics(c, "GET", "/rank/:playerId", "200", start)
-	c.JSON(http.StatusOK, rankInfo)
+	c.JSON(http.StatusOK, selectRankFields(rankInfoWithBase(rankInfo, base), fields))
 }
 
-// GetTopN 获取前N名玩家
-// @Summary 获取前N名玩家
-// @Description 获取排行榜前N名玩家的排名信息
+// GetPlayerPercentile 获取玩家百分位
+// @Summary 获取玩家百分位
+// @Description 获取玩家排名在全服中的百分位，如 5 表示位于前 5%
 // @Tags ranks
 // @Produce json
-// @Param n path int true "前N名"
-// @Success 200 {object} TopNResponse "前N名玩家列表"
-// @Failure 400 {object} ErrorResponse "参数错误"
+// @Param playerId path string true "玩家ID"
+// @Success 200 {object} model.PercentileInfo "百分位信息"
+// @Failure 404 {object} ErrorResponse "玩家未找到"
 // @Failure 500 {object} ErrorResponse "服务器内部错误"
-// @Router /top/{n} [get]
-func (h *HTTPHandler) GetTopN(c *gin.Context) {
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Router /user/{playerId}/percentile [get]
+func (h *HTTPHandler) GetPlayerPercentile(c *gin.Context) {
 	start := time.Now()
-	nStr := c.Param("n")
 
-	n, err := strconv.Atoi(nStr)
-	if err != nil || n <= 0 {
-		h.recordMetrics(c, "GET", "/top/:n", "400", start)
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "Invalid N parameter",
-			Message: "N must be a positive integer",
-		})
+	base, ok := h.parseRankBase(c, "GET", "/user/:playerId/percentile", start)
+	if !ok {
 		return
 	}
 
-	// 限制最大查询数量
-	if n > 1000 {
-		n = 1000
+	playerID := c.Param("playerId")
+
+	if playerID == "" {
+		h.recordMetrics(c, "GET", "/user/:playerId/percentile", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID parameter cannot be empty",
+		})
+		return
 	}
 
 	ctx := c.Request.Context()
-	rankings, err := h.leaderboardService.GetTopN(ctx, n)
+	percentile, err := h.leaderboardService.GetPlayerPercentile(ctx, playerID)
 	if err != nil {
-		h.recordMetrics(c, "GET", "/top/:n", "500", start)
-		h.logger.Error("Failed to get top N players",
-			"n", n,
+		if err == service.ErrPlayerNotFound {
+			h.recordMetrics(c, "GET", "/user/:playerId/percentile", "404", start)
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Player not found",
+				Message: "The specified player does not exist in the leaderboard",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/user/:playerId/percentile", "500", start)
+		h.requestLogger(c).Error("Failed to get player percentile",
+			"playerID", playerID,
 			"error", err)
 
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error:   "Failed to get top players",
+			Error:   "Failed to get player percentile",
 			Message: err.Error(),
 		})
 		return
 	}
 
-	h.recordMetrics(c, "GET", "/top/:n", "200", start)
-	c.JSON(http.StatusOK, TopNResponse{
-		Count:    len(rankings),
-		Rankings: rankings,
-	})
+	h.recordMetrics(c, "GET", "/user/:playerId/percentile", "200", start)
+	percentile.Rank -= int64(1 - base)
+	c.JSON(http.StatusOK, percentile)
 }
 
-// GetPlayerRankRange 获取玩家周边排名
-// @Summary 获取玩家周边排名
-// @Description 获取指定玩家前后一定范围内的玩家排名信息
-// @Tags ranks
+// 玩家国家/地区代码的最大长度，与 players.country 列一致
+const maxCountryLength = 16
+
+// UpdatePlayerAttributes 更新玩家属性
+// @Summary 更新玩家属性
+// @Description 设置玩家的国家/地区和等级，用于筛选子集排名；不影响分数和排行榜
+// @Tags scores
+// @Accept json
 // @Produce json
 // @Param playerId path string true "玩家ID"
-// @Param range path int true "范围大小"
-// @Success 200 {object} RankRangeResponse "周边排名信息"
-// @Failure 400 {object} ErrorResponse "参数错误"
+// @Param request body model.PlayerAttributes true "玩家属性"
+// @Success 200 {object} SuccessResponse "更新成功"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
 // @Failure 404 {object} ErrorResponse "玩家未找到"
 // @Failure 500 {object} ErrorResponse "服务器内部错误"
-// @Router /rank-range/{playerId}/{range} [get]
-func (h *HTTPHandler) GetPlayerRankRange(c *gin.Context) {
+// @Router /user/{playerId}/attributes [put]
+func (h *HTTPHandler) UpdatePlayerAttributes(c *gin.Context) {
 	start := time.Now()
+
 	playerID := c.Param("playerId")
-	rangeStr := c.Param("range")
 
-	if playerID == "" {
-		h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "400", start)
+	var attrs model.PlayerAttributes
+	if err := c.ShouldBindJSON(&attrs); err != nil {
+		h.recordMetrics(c, "PUT", "/user/:playerId/attributes", "400", start)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "PlayerID is required",
-			Message: "PlayerID parameter cannot be empty",
+			Error:   "Invalid request body",
+			Message: err.Error(),
 		})
 		return
 	}
 
-	rangeNum, err := strconv.Atoi(rangeStr)
-	if err != nil || rangeNum <= 0 {
-		h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "400", start)
+	if len(attrs.Country) > maxCountryLength || attrs.Level < 0 {
+		h.recordMetrics(c, "PUT", "/user/:playerId/attributes", "400", start)
 		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "Invalid range parameter",
-			Message: "Range must be a positive integer",
+			Error:   "Invalid attributes",
+			Message: fmt.Sprintf("Country must be at most %d characters and level must not be negative", maxCountryLength),
 		})
 		return
 	}
 
-	// 限制最大范围
-	if rangeNum > 100 {
-		rangeNum = 100
-	}
-
 	ctx := c.Request.Context()
-	rankings, err := h.leaderboardService.GetPlayerRankRange(ctx, playerID, rangeNum)
-	if err != nil {
+	if err := h.leaderboardService.SetPlayerAttributes(ctx, playerID, attrs); err != nil {
 		if err == service.ErrPlayerNotFound {
-			h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "404", start)
+			h.recordMetrics(c, "PUT", "/user/:playerId/attributes", "404", start)
 			c.JSON(http.StatusNotFound, ErrorResponse{
 				Error:   "Player not found",
-				Message: "The specified player does not exist in the leaderboard",
+				Message: "The specified player does not exist",
 			})
 			return
 		}
 
-		h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "500", start)
-		h.logger.Error("Failed to get player rank range",
+		h.recordMetrics(c, "PUT", "/user/:playerId/attributes", "500", start)
+		h.requestLogger(c).Error("Failed to update player attributes",
 			"playerID", playerID,
-			"range", rangeNum,
 			"error", err)
 
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error:   "Failed to get player rank range",
+			Error:   "Failed to update player attributes",
 			Message: err.Error(),
 		})
 		return
 	}
 
-	h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "200", start)
-	c.JSON(http.StatusOK, RankRangeResponse{
-		PlayerID: playerID,
-		Range:    rangeNum,
-		Rankings: rankings,
+	h.recordMetrics(c, "PUT", "/user/:playerId/attributes", "200", start)
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message: "Player attributes updated successfully",
+		Data:    attrs,
 	})
 }
 
-// HealthCheck 健康检查
-// @Summary 健康检查
-// @Description 检查服务健康状况
-// @Tags health
+// GetFilteredRank 获取玩家在筛选子集中的排名
+// @Summary 获取玩家在筛选子集中的排名
+// @Description 计算玩家在满足筛选条件（国家/地区、等级范围）的玩家中的排名，至少需要一个筛选条件
+// @Description 玩家本身不满足条件时返回按其分数放入该子集后的名次，inSubset 为 false
+// @Tags ranks
 // @Produce json
-// @Success 200 {object} HealthResponse "健康状态"
-// @Router /health [get]
-func (h *HTTPHandler) HealthCheck(c *gin.Context) {
+// @Param playerId path string true "玩家ID"
+// @Param country query string false "国家/地区"
+// @Param minLevel query int false "最低等级（含）"
+// @Param maxLevel query int false "最高等级（含）"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
+// @Success 200 {object} model.FilteredRankInfo "子集排名"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 404 {object} ErrorResponse "玩家未找到"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /user/{playerId}/filtered-rank [get]
+func (h *HTTPHandler) GetFilteredRank(c *gin.Context) {
 	start := time.Now()
 
-	// 检查依赖服务状态
-	ctx := c.Request.Context()
-	redisHealthy := h.leaderboardService.CheckRedisHealth(ctx)
-	mysqlHealthy := h.leaderboardService.CheckMySQLHealth(ctx)
-
-	status := "healthy"
-	if !redisHealthy || !mysqlHealthy {
-		status = "degraded"
+	base, ok := h.parseRankBase(c, "GET", "/user/:playerId/filtered-rank", start)
+	if !ok {
+		return
+	}
+	ctx, ok := h.parseRankingMethod(c, "GET", "/user/:playerId/filtered-rank", start)
+	if !ok {
+		return
 	}
 
-	h.recordMetrics(c, "GET", "/health", "200", start)
-	c.JSON(http.StatusOK, HealthResponse{
-		Status:    status,
-		Timestamp: time.Now(),
-		Services: map[string]string{
-			"redis": map[bool]string{true: "healthy", false: "unhealthy"}[redisHealthy],
-			"mysql": map[bool]string{true: "healthy", false: "unhealthy"}[mysqlHealthy],
-		},
-	})
-}
+	playerID := c.Param("playerId")
 
-// RebuildLeaderboard 重建排行榜
-// @Summary 重建排行榜
-// @Description 从MySQL数据重建Redis排行榜（用于数据恢复）
-// @Tags admin
-// @Produce json
-// @Success 200 {object} SuccessResponse "重建成功"
-// @Failure 500 {object} ErrorResponse "重建失败"
-// @Router /rebuild [post]
-func (h *HTTPHandler) RebuildLeaderboard(c *gin.Context) {
-	start := time.Now()
+	filter := model.PlayerFilter{Country: c.Query("country")}
+	for param, level := range map[string]*int{"minLevel": &filter.MinLevel, "maxLevel": &filter.MaxLevel} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			h.recordMetrics(c, "GET", "/user/:playerId/filtered-rank", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid " + param + " parameter",
+				Message: param + " must be an integer",
+			})
+			return
+		}
+		*level = value
+	}
+
+	rankInfo, err := h.leaderboardService.GetFilteredRank(ctx, playerID, filter)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidFilter):
+			h.recordMetrics(c, "GET", "/user/:playerId/filtered-rank", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid filter",
+				Message: err.Error(),
+			})
+		case err == service.ErrPlayerNotFound:
+			h.recordMetrics(c, "GET", "/user/:playerId/filtered-rank", "404", start)
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Player not found",
+				Message: "The specified player does not exist in the leaderboard",
+			})
+		default:
+			h.recordMetrics(c, "GET", "/user/:playerId/filtered-rank", "500", start)
+			h.requestLogger(c).Error("Failed to get filtered rank",
+				"playerID", playerID,
+				"error", err)
+
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "Failed to get filtered rank",
+				Message: err.Error(),
+			})
+		}
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/user/:playerId/filtered-rank", "200", start)
+	rankInfo.Rank -= int64(1 - base)
+	c.JSON(http.StatusOK, rankInfo)
+}
+
+// GetPlayerProfile 获取玩家资料
+// @Summary 获取玩家资料
+// @Description 一次返回玩家排名、MySQL 中的完整玩家信息、百分位、前后各两名的周边排名和最近 10 条分数变更；未上榜时 rank、percentile、neighbors 为空，MySQL 中没有记录时 player 为空。某一部分读取失败时该字段为空并列在 unavailable 中，其余部分照常返回
+// @Tags ranks
+// @Produce json
+// @Param playerId path string true "玩家ID"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
+// @Success 200 {object} model.PlayerProfile "玩家资料"
+// @Failure 404 {object} ErrorResponse "玩家未找到"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /user/{playerId}/profile [get]
+func (h *HTTPHandler) GetPlayerProfile(c *gin.Context) {
+	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "GET", "/user/:playerId/profile", start)
+	if !ok {
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "GET", "/user/:playerId/profile", start)
+	if !ok {
+		return
+	}
+
+	playerID := c.Param("playerId")
+
+	if playerID == "" {
+		h.recordMetrics(c, "GET", "/user/:playerId/profile", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID parameter cannot be empty",
+		})
+		return
+	}
+
+	profile, err := h.leaderboardService.GetPlayerProfile(ctx, playerID)
+	if err != nil {
+		if err == service.ErrPlayerNotFound {
+			h.recordMetrics(c, "GET", "/user/:playerId/profile", "404", start)
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Player not found",
+				Message: "The specified player does not exist",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/user/:playerId/profile", "500", start)
+		h.requestLogger(c).Error("Failed to get player profile",
+			"playerID", playerID,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get player profile",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	profile.Rank = rankInfoWithBase(profile.Rank, base)
+	profile.Neighbors = rankingsWithBase(profile.Neighbors, base)
+
+	h.recordMetrics(c, "GET", "/user/:playerId/profile", "200", start)
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetPlayerLastActive 获取玩家最后活跃时间
+// @Summary 获取玩家最后活跃时间
+// @Description 获取玩家最后一次得分的时间
+// @Tags ranks
+// @Produce json
+// @Param playerId path string true "玩家ID"
+// @Success 200 {object} LastActiveResponse "最后活跃时间"
+// @Failure 404 {object} ErrorResponse "玩家未找到"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /user/{playerId}/last-active [get]
+func (h *HTTPHandler) GetPlayerLastActive(c *gin.Context) {
+	start := time.Now()
+	playerID := c.Param("playerId")
+
+	if playerID == "" {
+		h.recordMetrics(c, "GET", "/user/:playerId/last-active", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID parameter cannot be empty",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	lastActive, err := h.leaderboardService.GetPlayerLastActive(ctx, playerID)
+	if err != nil {
+		if err == service.ErrPlayerNotFound {
+			h.recordMetrics(c, "GET", "/user/:playerId/last-active", "404", start)
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Player not found",
+				Message: "The specified player does not exist in the leaderboard",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/user/:playerId/last-active", "500", start)
+		h.requestLogger(c).Error("Failed to get player last active time",
+			"playerID", playerID,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get player last active time",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/user/:playerId/last-active", "200", start)
+	c.JSON(http.StatusOK, LastActiveResponse{
+		PlayerID:   playerID,
+		LastActive: lastActive,
+	})
+}
+
+// GetPlayerPeakRank 获取玩家历史最佳排名
+// @Summary 获取玩家历史最佳排名
+// @Description 获取玩家达到过的最好名次（标准排名，1 为第一名）及达到的时间，只在玩家自己得分后更新
+// @Tags ranks
+// @Produce json
+// @Param playerId path string true "玩家ID"
+// @Success 200 {object} model.PeakRankInfo "历史最佳排名"
+// @Failure 400 {object} ErrorResponse "玩家ID无效"
+// @Failure 404 {object} ErrorResponse "没有最佳排名记录"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /user/{playerId}/peak [get]
+func (h *HTTPHandler) GetPlayerPeakRank(c *gin.Context) {
+	start := time.Now()
+	playerID := c.Param("playerId")
+
+	ctx := c.Request.Context()
+	peak, err := h.leaderboardService.GetPlayerPeakRank(ctx, playerID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPlayerID) {
+			h.recordMetrics(c, "GET", "/user/:playerId/peak", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid playerId",
+				Message: err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrPlayerNotFound) {
+			h.recordMetrics(c, "GET", "/user/:playerId/peak", "404", start)
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Peak rank not found",
+				Message: "The specified player has no recorded peak rank",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/user/:playerId/peak", "500", start)
+		h.requestLogger(c).Error("Failed to get player peak rank",
+			"playerID", playerID,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get player peak rank",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/user/:playerId/peak", "200", start)
+	c.JSON(http.StatusOK, peak)
+}
+
+// BatchGetPlayerRanks 批量获取玩家排名
+// @Summary 批量获取玩家排名
+// @Description 一次查询多名玩家（如好友列表）的排名，未上榜的玩家不在 ranks 中，而是列在 notFound 中
+// @Tags ranks
+// @Accept json
+// @Produce json
+// @Param request body model.BatchRankRequest true "玩家ID列表"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
+// @Success 200 {object} BatchRankResponse "玩家排名"
+// @Failure 400 {object} ErrorResponse "请求参数错误或数量超出上限"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /ranks [post]
+func (h *HTTPHandler) BatchGetPlayerRanks(c *gin.Context) {
+	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "POST", "/ranks", start)
+	if !ok {
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "POST", "/ranks", start)
+	if !ok {
+		return
+	}
+
+	h.limitBatchBody(c)
+
+	var req model.BatchRankRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.recordMetrics(c, "POST", "/ranks", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if len(req.PlayerIDs) == 0 {
+		h.recordMetrics(c, "POST", "/ranks", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerIDs are required",
+			Message: "PlayerIDs cannot be empty",
+		})
+		return
+	}
+
+	if !h.checkBatchSize(c, "POST", "/ranks", len(req.PlayerIDs), start) {
+		return
+	}
+
+	ranks, notFound, err := h.leaderboardService.BatchGetPlayerRanks(ctx, req.PlayerIDs)
+	if err != nil {
+		h.recordMetrics(c, "POST", "/ranks", "500", start)
+		h.requestLogger(c).Error("Failed to batch get player ranks",
+			"count", len(req.PlayerIDs),
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get player ranks",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	for playerID, rankInfo := range ranks {
+		ranks[playerID] = rankInfoWithBase(rankInfo, base)
+	}
+
+	h.recordMetrics(c, "POST", "/ranks", "200", start)
+	c.JSON(http.StatusOK, BatchRankResponse{
+		Ranks:    ranks,
+		NotFound: notFound,
+	})
+}
+
+// GetRankingAmongPlayers 获取一组玩家之间的排名
+// @Summary 获取好友排名
+// @Description 只在给定的一组玩家（如好友列表）之间按总榜分数排名，rank 为组内的相对名次而非总榜名次；未上榜的玩家不参与排名，列在 notFound 中
+// @Tags ranks
+// @Accept json
+// @Produce json
+// @Param request body model.AmongRequest true "玩家ID列表"
+// @Param base query int false "名次起始值，0 或 1，默认 1"
+// @Param method query string false "排名方式，standard 或 dense"
+// @Success 200 {object} AmongRankingResponse "组内排名"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /among [post]
+func (h *HTTPHandler) GetRankingAmongPlayers(c *gin.Context) {
+	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "POST", "/among", start)
+	if !ok {
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "POST", "/among", start)
+	if !ok {
+		return
+	}
+
+	h.limitBatchBody(c)
+
+	var req model.AmongRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.recordMetrics(c, "POST", "/among", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if len(req.PlayerIDs) == 0 {
+		h.recordMetrics(c, "POST", "/among", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerIDs are required",
+			Message: "PlayerIDs cannot be empty",
+		})
+		return
+	}
+
+	if !h.checkBatchSize(c, "POST", "/among", len(req.PlayerIDs), start) {
+		return
+	}
+
+	rankings, notFound, err := h.leaderboardService.GetRankingAmongPlayers(ctx, req.PlayerIDs)
+	if err != nil {
+		h.recordMetrics(c, "POST", "/among", "500", start)
+		h.requestLogger(c).Error("Failed to get ranking among players",
+			"count", len(req.PlayerIDs),
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get ranking among players",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "POST", "/among", "200", start)
+	c.JSON(http.StatusOK, AmongRankingResponse{
+		Count:    len(rankings),
+		Rankings: rankingsWithBase(rankings, base),
+		NotFound: notFound,
+	})
+}
+
+// GetCohortStats 获取一组玩家的排名分布
+// @Summary 获取玩家分布
+// @Description 统计一组玩家（如某次活动带来的玩家）的最高、最低、中位名次，上榜与未上榜人数，以及按名次分段的直方图
+// @Tags ranks
+// @Accept json
+// @Produce json
+// @Param request body model.CohortRequest true "玩家ID列表"
+// @Success 200 {object} model.CohortStats "分布统计"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /cohort [post]
+func (h *HTTPHandler) GetCohortStats(c *gin.Context) {
+	start := time.Now()
+
+	h.limitBatchBody(c)
+
+	var req model.CohortRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.recordMetrics(c, "POST", "/cohort", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if len(req.PlayerIDs) == 0 {
+		h.recordMetrics(c, "POST", "/cohort", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerIDs are required",
+			Message: "PlayerIDs cannot be empty",
+		})
+		return
+	}
+
+	if !h.checkBatchSize(c, "POST", "/cohort", len(req.PlayerIDs), start) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	stats, err := h.leaderboardService.GetCohortStats(ctx, req.PlayerIDs)
+	if err != nil {
+		h.recordMetrics(c, "POST", "/cohort", "500", start)
+		h.requestLogger(c).Error("Failed to get cohort stats",
+			"count", len(req.PlayerIDs),
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get cohort stats",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "POST", "/cohort", "200", start)
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetScoreHistory 获取玩家分数变更历史
+// @Summary 获取玩家分数变更历史
+// @Description 按时间倒序获取玩家的分数变更记录及原因
+// @Tags ranks
+// @Produce json
+// @Param playerId path string true "玩家ID"
+// @Param limit query int false "返回数量"
+// @Param offset query int false "起始偏移"
+// @Success 200 {object} ScoreHistoryResponse "分数变更历史"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /user/{playerId}/history [get]
+func (h *HTTPHandler) GetScoreHistory(c *gin.Context) {
+	start := time.Now()
+	playerID := c.Param("playerId")
+
+	if playerID == "" {
+		h.recordMetrics(c, "GET", "/user/:playerId/history", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID parameter cannot be empty",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultHistoryLimit)))
+	if err != nil || limit <= 0 {
+		h.recordMetrics(c, "GET", "/user/:playerId/history", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid limit parameter",
+			Message: "Limit must be a positive integer",
+		})
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		h.recordMetrics(c, "GET", "/user/:playerId/history", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid offset parameter",
+			Message: "Offset must be a non-negative integer",
+		})
+		return
+	}
+
+	// 限制最大查询数量
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	ctx := c.Request.Context()
+	history, err := h.leaderboardService.GetScoreHistory(ctx, playerID, limit, offset)
+	if err != nil {
+		h.recordMetrics(c, "GET", "/user/:playerId/history", "500", start)
+		h.requestLogger(c).Error("Failed to get score history",
+			"playerID", playerID,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get score history",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/user/:playerId/history", "200", start)
+	c.JSON(http.StatusOK, ScoreHistoryResponse{
+		PlayerID: playerID,
+		Count:    len(history),
+		History:  history,
+	})
+}
+
+// GetDailyScoreDeltas 按天汇总玩家分数变化
+// @Summary 按天汇总玩家分数变化
+// @Description 获取玩家最近 days 天（含今天）每天的分数变化合计，按日期升序，没有变化的日期不返回。日期按 MySQL 会话时区划分
+// @Tags ranks
+// @Produce json
+// @Param playerId path string true "玩家ID"
+// @Param days query int false "天数，默认 30，最大 90"
+// @Success 200 {object} DailyScoreDeltasResponse "每天的分数变化"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /user/{playerId}/history/daily [get]
+func (h *HTTPHandler) GetDailyScoreDeltas(c *gin.Context) {
+	start := time.Now()
+	playerID := c.Param("playerId")
+
+	if playerID == "" {
+		h.recordMetrics(c, "GET", "/user/:playerId/history/daily", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID parameter cannot be empty",
+		})
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultDailyHistoryDays)))
+	if err != nil || days <= 0 {
+		h.recordMetrics(c, "GET", "/user/:playerId/history/daily", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid days parameter",
+			Message: "Days must be a positive integer",
+		})
+		return
+	}
+
+	// 限制最大查询天数
+	if days > maxDailyHistoryDays {
+		days = maxDailyHistoryDays
+	}
+
+	deltas, err := h.leaderboardService.GetDailyScoreDeltas(c.Request.Context(), playerID, days)
+	if err != nil {
+		h.recordMetrics(c, "GET", "/user/:playerId/history/daily", "500", start)
+		h.requestLogger(c).Error("Failed to get daily score deltas",
+			"playerID", playerID,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get daily score deltas",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/user/:playerId/history/daily", "200", start)
+	c.JSON(http.StatusOK, DailyScoreDeltasResponse{
+		PlayerID: playerID,
+		Days:     days,
+		Deltas:   deltas,
+	})
+}
+
+// SearchPlayers 按名称搜索玩家
+// @Summary 按名称搜索玩家
+// @Description 按名称前缀搜索玩家并返回其当前排名，匹配不区分大小写和重音（由 players.name 的排序规则决定），% 和 _ 按字面匹配。不在榜上的玩家 rank 为空
+// @Tags ranks
+// @Produce json
+// @Param name query string true "名称前缀"
+// @Param limit query int false "返回数量，默认 20，最大 100"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
+// @Success 200 {object} SearchResponse "匹配的玩家"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /search [get]
+func (h *HTTPHandler) SearchPlayers(c *gin.Context) {
+	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "GET", "/search", start)
+	if !ok {
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "GET", "/search", start)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		h.recordMetrics(c, "GET", "/search", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Name is required",
+			Message: "Name parameter cannot be empty",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+	if err != nil || limit <= 0 {
+		h.recordMetrics(c, "GET", "/search", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid limit parameter",
+			Message: "Limit must be a positive integer",
+		})
+		return
+	}
+
+	// 限制最大返回数量
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	results, err := h.leaderboardService.SearchPlayers(ctx, name, limit)
+	if err != nil {
+		h.recordMetrics(c, "GET", "/search", "500", start)
+		h.requestLogger(c).Error("Failed to search players",
+			"name", name,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to search players",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	for _, result := range results {
+		result.Rank = rankInfoWithBase(result.Rank, base)
+	}
+
+	h.recordMetrics(c, "GET", "/search", "200", start)
+	c.JSON(http.StatusOK, SearchResponse{
+		Name:    name,
+		Count:   len(results),
+		Players: results,
+	})
+}
+
+// GetTopN 获取前N名玩家
+// @Summary 获取前N名玩家
+// @Description 获取排行榜前N名玩家的排名信息，n 为 0 时只返回排行榜人数
+// @Tags ranks
+// @Produce json
+// @Param n path int true "前N名，0 表示只查询排行榜人数，超过服务配置的上限（默认 1000）时按上限截断"
+// @Param window query string false "时间窗口：daily、weekly、monthly，不传则为全服总榜"
+// @Success 200 {object} TopNResponse "前N名玩家列表，n 被截断时 clamped 为 true 且带有 X-TopN-Clamped 响应头"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Param fields query string false "只返回指定的字段，逗号分隔，如 playerId,rank"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
+// @Param minScore query string false "只返回分数不低于该值的玩家（仅全服总榜），-inf 或不传表示不限"
+// @Param maxScore query string false "只返回分数不高于该值的玩家（仅全服总榜），+inf 或不传表示不限"
+// @Router /top/{n} [get]
+func (h *HTTPHandler) GetTopN(c *gin.Context) {
+	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "GET", "/top/:n", start)
+	if !ok {
+		return
+	}
+
+	fields, ok := h.parseRankFields(c, "GET", "/top/:n", start)
+	if !ok {
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "GET", "/top/:n", start)
+	if !ok {
+		return
+	}
+
+	nStr := c.Param("n")
+
+	n, err := strconv.Atoi(nStr)
+	if err != nil || n < 0 {
+		h.recordMetrics(c, "GET", "/top/:n", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid N parameter",
+			Message: "N must be a non-negative integer",
+		})
+		return
+	}
+
+	// 限制最大查询数量，截断时通过响应头和 clamped 字段告知客户端，避免误以为排行榜只有这么多人
+	clamped := n > h.maxTopN
+	if clamped {
+		n = h.maxTopN
+		c.Header("X-TopN-Clamped", "true")
+	}
+
+	window := c.Query("window")
+
+	minScore, ok := h.parseScoreBound(c, "GET", "/top/:n", "minScore", "-inf", start)
+	if !ok {
+		return
+	}
+	maxScore, ok := h.parseScoreBound(c, "GET", "/top/:n", "maxScore", "+inf", start)
+	if !ok {
+		return
+	}
+
+	// 指定分数区间时只查询总榜中区间内的玩家，n 为 0 时只返回区间内的人数
+	if minScore != nil || maxScore != nil {
+		if window != "" {
+			h.recordMetrics(c, "GET", "/top/:n", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid score range",
+				Message: "minScore and maxScore are only supported on the global leaderboard",
+			})
+			return
+		}
+		h.getTopNByScoreRange(ctx, c, minScore, maxScore, n, clamped, base, fields, start)
+		return
+	}
+
+	// n 为 0 时不查询排名，只返回排行榜人数
+	if n == 0 {
+		h.getBoardSize(c, window, start)
+		return
+	}
+
+	// 指定 window 时查询日/周/月时间窗口排行榜
+	var rankings []*model.RankInfo
+	if window != "" {
+		rankings, err = h.leaderboardService.GetTopNForWindow(ctx, window, n)
+	} else {
+		rankings, err = h.leaderboardService.GetTopN(ctx, n)
+	}
+	if err != nil {
+		if err == service.ErrInvalidWindow {
+			h.recordMetrics(c, "GET", "/top/:n", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid window parameter",
+				Message: "Window must be one of daily, weekly, monthly",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/top/:n", "500", start)
+		h.requestLogger(c).Error("Failed to get top N players",
+			"n", n,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get top players",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/top/:n", "200", start)
+	c.JSON(http.StatusOK, TopNResponse{
+		Count:    len(rankings),
+		Rankings: selectRankingsFields(rankingsWithBase(rankings, base), fields),
+		Stale:    len(rankings) > 0 && rankings[0].Stale,
+		Fallback: len(rankings) > 0 && rankings[0].Fallback,
+		MaxN:     h.maxTopN,
+		Clamped:  clamped,
+	})
+}
+
+// 返回总榜中分数区间内的前N名玩家及区间内的总人数
+func (h *HTTPHandler) getTopNByScoreRange(ctx context.Context, c *gin.Context, minScore, maxScore *int64, n int, clamped bool, base int, fields []string, start time.Time) {
+	rankings, matched, err := h.leaderboardService.GetTopNByScoreRange(ctx, minScore, maxScore, n)
+	if err != nil {
+		if err == service.ErrInvalidScoreRange {
+			h.recordMetrics(c, "GET", "/top/:n", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid score range",
+				Message: "minScore must not be greater than maxScore",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/top/:n", "500", start)
+		h.requestLogger(c).Error("Failed to get top N players by score range",
+			"n", n,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get top players",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/top/:n", "200", start)
+	c.JSON(http.StatusOK, TopNResponse{
+		Count:    len(rankings),
+		Rankings: selectRankingsFields(rankingsWithBase(rankings, base), fields),
+		Matched:  &matched,
+		MaxN:     h.maxTopN,
+		Clamped:  clamped,
+	})
+}
+
+// 返回空的排名列表和排行榜人数
+func (h *HTTPHandler) getBoardSize(c *gin.Context, window string, start time.Time) {
+	size, err := h.leaderboardService.GetLeaderboardSize(c.Request.Context(), window)
+	if err != nil {
+		if err == service.ErrInvalidWindow {
+			h.recordMetrics(c, "GET", "/top/:n", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid window parameter",
+				Message: "Window must be one of daily, weekly, monthly",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/top/:n", "500", start)
+		h.requestLogger(c).Error("Failed to get leaderboard size",
+			"window", window,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get leaderboard size",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/top/:n", "200", start)
+	c.JSON(http.StatusOK, TopNResponse{
+		Count:    0,
+		Rankings: []*model.RankInfo{},
+		Size:     &size,
+	})
+}
+
+// GetPlayerRankRange 获取玩家周边排名
+// @Summary 获取玩家周边排名
+// @Description 获取指定玩家前后一定范围内的玩家排名信息。窗口以玩家为中心，靠近榜首或榜尾时向另一侧延伸，排行榜人数足够时总是返回 range 条
+// @Tags ranks
+// @Produce json
+// @Param playerId path string true "玩家ID"
+// @Param range path int true "范围大小，不超过服务配置的上限（默认 100）"
+// @Success 200 {object} RankRangeResponse "周边排名信息"
+// @Failure 400 {object} ErrorResponse "参数错误或范围超出上限"
+// @Failure 404 {object} ErrorResponse "玩家未找到"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Param fields query string false "只返回指定的字段，逗号分隔，如 playerId,rank"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
+// @Router /rank-range/{playerId}/{range} [get]
+func (h *HTTPHandler) GetPlayerRankRange(c *gin.Context) {
+	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "GET", "/rank-range/:playerId/:range", start)
+	if !ok {
+		return
+	}
+
+	fields, ok := h.parseRankFields(c, "GET", "/rank-range/:playerId/:range", start)
+	if !ok {
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "GET", "/rank-range/:playerId/:range", start)
+	if !ok {
+		return
+	}
+
+	playerID := c.Param("playerId")
+	rangeStr := c.Param("range")
+
+	if playerID == "" {
+		h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID parameter cannot be empty",
+		})
+		return
+	}
+
+	rangeNum, err := strconv.Atoi(rangeStr)
+	if err != nil || rangeNum <= 0 {
+		h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid range parameter",
+			Message: "Range must be a positive integer",
+		})
+		return
+	}
+
+	if rangeNum > h.maxRankRange {
+		h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Range too large",
+			Message: fmt.Sprintf("Range %d exceeds the maximum of %d", rangeNum, h.maxRankRange),
+		})
+		return
+	}
+
+	rankings, err := h.leaderboardService.GetPlayerRankRange(ctx, playerID, rangeNum)
+	if err != nil {
+		if err == service.ErrPlayerNotFound {
+			h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "404", start)
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Player not found",
+				Message: "The specified player does not exist in the leaderboard",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "500", start)
+		h.requestLogger(c).Error("Failed to get player rank range",
+			"playerID", playerID,
+			"range", rangeNum,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get player rank range",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/rank-range/:playerId/:range", "200", start)
+	c.JSON(http.StatusOK, RankRangeResponse{
+		PlayerID:       playerID,
+		Range:          rangeNum,
+		EffectiveRange: len(rankings),
+		Rankings:       selectRankingsFields(rankingsWithBase(rankings, base), fields),
+	})
+}
+
+// GetPlayersNearScore 获取分数相近的玩家
+// @Summary 获取分数相近的玩家
+// @Description 获取总榜中分数与指定玩家相差不超过 delta 的玩家，按排名顺序返回并包含该玩家；人数超过 limit 时返回以该玩家为中心的 limit 名
+// @Tags ranks
+// @Produce json
+// @Param playerId path string true "玩家ID"
+// @Param delta query int true "分差上限，不小于 0"
+// @Param limit query int false "最多返回的人数，默认和上限均为周边排名的最大范围"
+// @Success 200 {object} NearScoreResponse "分数相近的玩家"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 404 {object} ErrorResponse "玩家未找到"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Param fields query string false "只返回指定的字段，逗号分隔，如 playerId,rank"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
+// @Router /near-score/{playerId} [get]
+func (h *HTTPHandler) GetPlayersNearScore(c *gin.Context) {
+	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "GET", "/near-score/:playerId", start)
+	if !ok {
+		return
+	}
+
+	fields, ok := h.parseRankFields(c, "GET", "/near-score/:playerId", start)
+	if !ok {
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "GET", "/near-score/:playerId", start)
+	if !ok {
+		return
+	}
+
+	playerID := c.Param("playerId")
+	if playerID == "" {
+		h.recordMetrics(c, "GET", "/near-score/:playerId", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID parameter cannot be empty",
+		})
+		return
+	}
+
+	delta, err := strconv.ParseInt(c.Query("delta"), 10, 64)
+	if err != nil || delta < 0 {
+		h.recordMetrics(c, "GET", "/near-score/:playerId", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid delta parameter",
+			Message: "Delta must be a non-negative integer",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(h.maxRankRange)))
+	if err != nil || limit <= 0 {
+		h.recordMetrics(c, "GET", "/near-score/:playerId", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid limit parameter",
+			Message: "Limit must be a positive integer",
+		})
+		return
+	}
+	if limit > h.maxRankRange {
+		limit = h.maxRankRange
+	}
+
+	rankings, score, matched, err := h.leaderboardService.GetPlayersNearScore(ctx, playerID, delta, limit)
+	if err != nil {
+		if err == service.ErrPlayerNotFound {
+			h.recordMetrics(c, "GET", "/near-score/:playerId", "404", start)
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Player not found",
+				Message: "The specified player does not exist in the leaderboard",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/near-score/:playerId", "500", start)
+		h.requestLogger(c).Error("Failed to get players near score",
+			"playerID", playerID,
+			"delta", delta,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get players near score",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/near-score/:playerId", "200", start)
+	c.JSON(http.StatusOK, NearScoreResponse{
+		PlayerID: playerID,
+		Score:    score,
+		Delta:    delta,
+		Matched:  matched,
+		Count:    len(rankings),
+		Rankings: selectRankingsFields(rankingsWithBase(rankings, base), fields),
+	})
+}
+
+// GetScoreAtRank 获取指定排名的分数
+// @Summary 获取指定排名的分数
+// @Description 获取第 rank 名的分数，传入 playerId 时返回该玩家与之的分差
+// @Tags ranks
+// @Produce json
+// @Param rank path int true "排名（从1开始）"
+// @Param playerId query string false "用于计算分差的玩家ID"
+// @Success 200 {object} model.ScoreAtRankInfo "排名分数信息"
+// @Failure 400 {object} ErrorResponse "参数错误或排名超出排行榜人数"
+// @Failure 404 {object} ErrorResponse "玩家未找到"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Router /score-at/{rank} [get]
+func (h *HTTPHandler) GetScoreAtRank(c *gin.Context) {
+	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "GET", "/score-at/:rank", start)
+	if !ok {
+		return
+	}
+
+	// 路径中的排名与响应使用相同的起始值
+	rank, err := strconv.ParseInt(c.Param("rank"), 10, 64)
+	if err == nil {
+		rank += int64(1 - base)
+	}
+	if err != nil || rank <= 0 {
+		h.recordMetrics(c, "GET", "/score-at/:rank", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid rank parameter",
+			Message: "Rank must be a valid rank for the requested base",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	info, err := h.leaderboardService.GetScoreForRank(ctx, rank, c.Query("playerId"))
+	if err != nil {
+		switch err {
+		case service.ErrRankOutOfRange:
+			h.recordMetrics(c, "GET", "/score-at/:rank", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Rank out of range",
+				Message: "Rank exceeds the leaderboard size",
+			})
+			return
+		case service.ErrPlayerNotFound:
+			h.recordMetrics(c, "GET", "/score-at/:rank", "404", start)
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Player not found",
+				Message: "The specified player does not exist in the leaderboard",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/score-at/:rank", "500", start)
+		h.requestLogger(c).Error("Failed to get score at rank",
+			"rank", rank,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get score at rank",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/score-at/:rank", "200", start)
+	info.Rank -= int64(1 - base)
+	c.JSON(http.StatusOK, info)
+}
+
+// GetRankForScore 获取分数对应的名次
+// @Summary 获取分数对应的名次
+// @Description 返回该分数在当前排行榜中将占据的名次，不要求有玩家持有该分数。与已有玩家同分时并列：standard 为排在该分数之前的人数加一，dense 为排在该分数之前的不同分数个数加一（RANK_ORDER=asc 时分数低者在前）
+// @Tags ranks
+// @Produce json
+// @Param score path int true "分数"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
+// @Success 200 {object} model.RankForScoreInfo "名次信息"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /rank-for-score/{score} [get]
+func (h *HTTPHandler) GetRankForScore(c *gin.Context) {
+	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "GET", "/rank-for-score/:score", start)
+	if !ok {
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "GET", "/rank-for-score/:score", start)
+	if !ok {
+		return
+	}
+
+	score, err := strconv.ParseInt(c.Param("score"), 10, 64)
+	if err != nil {
+		h.recordMetrics(c, "GET", "/rank-for-score/:score", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid score parameter",
+			Message: "Score must be an integer",
+		})
+		return
+	}
+
+	info, err := h.leaderboardService.GetRankForScore(ctx, score)
+	if err != nil {
+		h.recordMetrics(c, "GET", "/rank-for-score/:score", "500", start)
+		h.requestLogger(c).Error("Failed to get rank for score",
+			"score", score,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get rank for score",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/rank-for-score/:score", "200", start)
+	info.Rank -= int64(1 - base)
+	c.JSON(http.StatusOK, info)
+}
+
+// GetLeaderboardPage 分页获取排行榜
+// @Summary 分页获取排行榜
+// @Description 按 offset/limit 分页获取排行榜，并返回排行榜总人数
+// @Tags ranks
+// @Produce json
+// @Param offset query int false "起始偏移（从0开始）"
+// @Param limit query int false "每页数量"
+// @Success 200 {object} PageResponse "分页排名信息"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Param base query int false "排名起始值：1（默认）或 0"
+// @Param fields query string false "只返回指定的字段，逗号分隔，如 playerId,rank"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
+// @Router /page [get]
+func (h *HTTPHandler) GetLeaderboardPage(c *gin.Context) {
+	start := time.Now()
+
+	base, ok := h.parseRankBase(c, "GET", "/page", start)
+	if !ok {
+		return
+	}
+
+	fields, ok := h.parseRankFields(c, "GET", "/page", start)
+	if !ok {
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "GET", "/page", start)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		h.recordMetrics(c, "GET", "/page", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid offset parameter",
+			Message: "Offset must be a non-negative integer",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageLimit)))
+	if err != nil || limit <= 0 {
+		h.recordMetrics(c, "GET", "/page", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid limit parameter",
+			Message: "Limit must be a positive integer",
+		})
+		return
+	}
+
+	// 限制单页最大数量
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	rankings, total, err := h.leaderboardService.GetLeaderboardPage(ctx, offset, limit)
+	if err != nil {
+		h.recordMetrics(c, "GET", "/page", "500", start)
+		h.requestLogger(c).Error("Failed to get leaderboard page",
+			"offset", offset,
+			"limit", limit,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get leaderboard page",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/page", "200", start)
+	c.JSON(http.StatusOK, PageResponse{
+		Offset:   offset,
+		Limit:    limit,
+		Total:    total,
+		Count:    len(rankings),
+		Rankings: selectRankingsFields(rankingsWithBase(rankings, base), fields),
+	})
+}
+
+// HealthCheck 存活检查
+// @Summary 存活检查
+// @Description 只表示进程可以处理请求，不检查依赖服务，依赖状态见 /ready
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse "存活状态"
+// @Router /health [get]
+func (h *HTTPHandler) HealthCheck(c *gin.Context) {
+	start := time.Now()
+
+	h.recordMetrics(c, "GET", "/health", "200", start)
+	c.JSON(http.StatusOK, HealthResponse{
+		Status:    "alive",
+		Timestamp: time.Now(),
+	})
+}
+
+// ReadinessCheck 就绪检查
+// @Summary 就绪检查
+// @Description 检查 Redis 和 MySQL 是否可用以及近期请求错误率，任一不满足时返回 503，便于编排系统摘除实例
+// @Tags health
+// @Produce json
+// @Success 200 {object} ReadinessResponse "就绪"
+// @Failure 503 {object} ReadinessResponse "依赖服务不可用"
+// @Router /ready [get]
+func (h *HTTPHandler) ReadinessCheck(c *gin.Context) {
+	start := time.Now()
+
+	dependencies := h.leaderboardService.CheckDependencies(c.Request.Context())
+
+	status, code := "ready", http.StatusOK
+	for _, dependency := range dependencies {
+		if !dependency.Healthy {
+			status, code = "unavailable", http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	// 依赖正常但近期错误率过高时报告降级
+	var errorRate *ErrorRateStatus
+	if h.errorRate != nil {
+		requests, rate := h.errorRate.Rate()
+		errorRate = &ErrorRateStatus{
+			Requests:  requests,
+			Percent:   rate,
+			Threshold: h.errorRateThreshold,
+		}
+		if requests >= h.errorMinRequests && rate > h.errorRateThreshold && code == http.StatusOK {
+			status, code = "degraded", http.StatusServiceUnavailable
+		}
+	}
+
+	h.recordMetrics(c, "GET", "/ready", strconv.Itoa(code), start)
+	c.JSON(code, ReadinessResponse{
+		Status:       status,
+		Timestamp:    time.Now(),
+		Dependencies: dependencies,
+		ErrorRate:    errorRate,
+	})
+}
+
+// RebuildLeaderboard 重建排行榜
+// @Summary 重建排行榜
+// @Description 从MySQL数据重建Redis排行榜（用于数据恢复）
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse "重建成功"
+// @Failure 500 {object} ErrorResponse "重建失败"
+// @Router /rebuild [post]
+func (h *HTTPHandler) RebuildLeaderboard(c *gin.Context) {
+	start := time.Now()
+
+	ctx := c.Request.Context()
+	err := h.leaderboardService.RebuildLeaderboard(ctx)
+	if err != nil {
+		h.recordMetrics(c, "POST", "/rebuild", "500", start)
+		h.requestLogger(c).Error("Failed to rebuild leaderboard", "error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to rebuild leaderboard",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "POST", "/rebuild", "200", start)
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message:   "Leaderboard rebuilt successfully",
+		Timestamp: time.Now(),
+	})
+}
+
+// ExportLeaderboard 导出整个排行榜
+// @Summary 导出排行榜
+// @Description 按排名顺序流式导出整个排行榜，format=json 时为 JSON 数组，format=csv 时为带表头的 CSV（id,name,score,rank,updated_at）；名称和更新时间来自 MySQL。compress=gzip 时以 gzip 压缩输出
+// @Tags admin
+// @Produce json,text/csv
+// @Param format query string false "导出格式：json（默认）或 csv"
+// @Param compress query string false "压缩方式：gzip，不传则不压缩"
+// @Param method query string false "排名方式：standard 或 dense，不传则使用服务配置"
+// @Success 200 {array} model.RankInfo "排行榜数据"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 500 {object} ErrorResponse "导出失败"
+// @Router /export [get]
+func (h *HTTPHandler) ExportLeaderboard(c *gin.Context) {
+	start := time.Now()
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		h.recordMetrics(c, "GET", "/export", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid format parameter",
+			Message: "Format must be json or csv",
+		})
+		return
+	}
+
+	compress := c.Query("compress")
+	if compress != "" && compress != "gzip" {
+		h.recordMetrics(c, "GET", "/export", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid compress parameter",
+			Message: "Compress must be gzip",
+		})
+		return
+	}
+
+	ctx, ok := h.parseRankingMethod(c, "GET", "/export", start)
+	if !ok {
+		return
+	}
+
+	// 第一页数据到达后才写响应头，遍历在此之前失败时仍可返回错误状态码
+	var (
+		out       io.Writer
+		gz        *gzip.Writer
+		encoder   *json.Encoder
+		csvWriter *csv.Writer
+		written   int
+	)
+	begin := func() {
+		// 导出耗时与排行榜大小有关，不受服务器 WriteTimeout 限制
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+			h.requestLogger(c).Warn("Failed to clear write deadline for export", "error", err)
+		}
+
+		filename := "leaderboard-" + start.UTC().Format("20060102-150405") + "." + format
+		if format == "csv" {
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			c.Header("Content-Type", "application/json")
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		out = c.Writer
+		if compress == "gzip" {
+			c.Header("Content-Encoding", "gzip")
+			c.Header("Vary", "Accept-Encoding")
+			gz = gzip.NewWriter(c.Writer)
+			out = gz
+		}
+		c.Status(http.StatusOK)
+		if format == "csv" {
+			csvWriter = csv.NewWriter(out)
+			csvWriter.Write(exportCSVHeader)
+		} else {
+			encoder = json.NewEncoder(out)
+			io.WriteString(out, "[")
+		}
+	}
+
+	err := h.leaderboardService.ExportLeaderboard(ctx, func(page []*model.RankInfo) error {
+		if out == nil {
+			begin()
+		}
+		for _, entry := range page {
+			if csvWriter != nil {
+				if err := csvWriter.Write(exportCSVRecord(entry)); err != nil {
+					return err
+				}
+				written++
+				continue
+			}
+
+			if written > 0 {
+				if _, err := io.WriteString(out, ","); err != nil {
+					return err
+				}
+			}
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+			written++
+		}
+
+		// 逐页刷新，避免整个排行榜缓冲在内存中
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		if gz != nil {
+			if err := gz.Flush(); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil && out == nil {
+		h.recordMetrics(c, "GET", "/export", "500", start)
+		h.requestLogger(c).Error("Failed to export leaderboard", "error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to export leaderboard",
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		// 响应头已发送，只能中断输出；JSON 不写结尾的 ] 使客户端得到不完整的数据而不是看似完整的数据，CSV 无法标记，以日志为准
+		h.recordMetrics(c, "GET", "/export", "500", start)
+		h.requestLogger(c).Error("Leaderboard export interrupted",
+			"written", written,
+			"error", err)
+		if gz != nil {
+			gz.Close()
+		}
+		return
+	}
+
+	if out == nil {
+		begin()
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+	} else {
+		io.WriteString(out, "]")
+	}
+	if gz != nil {
+		gz.Close()
+	}
+
+	h.recordMetrics(c, "GET", "/export", "200", start)
+}
+
+// CSV 导出的表头，与 exportCSVRecord 的列一一对应
+var exportCSVHeader = []string{"id", "name", "score", "rank", "updated_at"}
+
+func exportCSVRecord(entry *model.RankInfo) []string {
+	updatedAt := ""
+	if !entry.UpdatedAt.IsZero() {
+		updatedAt = entry.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		entry.PlayerID,
+		entry.Name,
+		strconv.FormatInt(entry.Score, 10),
+		strconv.Itoa(entry.Rank),
+		updatedAt,
+	}
+}
+
+// ResetLeaderboard 重置排行榜
+// @Summary 重置排行榜
+// @Description 赛季切换时清空 Redis 排行榜、时间窗口榜和玩家信息，可选同时清零或归档 MySQL 中的分数
+// @Tags admin
+// @Produce json
+// @Param mysql query string false "MySQL 处理方式：keep（默认）、truncate、archive"
+// @Param dryRun query bool false "只返回将被删除的数量，不实际删除"
+// @Success 200 {object} SuccessResponse "重置成功"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 500 {object} ErrorResponse "重置失败"
+// @Router /reset [post]
+func (h *HTTPHandler) ResetLeaderboard(c *gin.Context) {
+	start := time.Now()
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		h.recordMetrics(c, "POST", "/reset", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid dryRun parameter",
+			Message: "dryRun must be a boolean",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := h.leaderboardService.ResetLeaderboard(ctx, c.Query("mysql"), dryRun)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidResetMode) {
+			h.recordMetrics(c, "POST", "/reset", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid mysql parameter",
+				Message: "mysql must be keep, truncate or archive",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "POST", "/reset", "500", start)
+		h.requestLogger(c).Error("Failed to reset leaderboard", "error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to reset leaderboard",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := "Leaderboard reset successfully"
+	if dryRun {
+		message = "Dry run, nothing was removed"
+	}
+
+	h.recordMetrics(c, "POST", "/reset", "200", start)
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message:   message,
+		Data:      result,
+		Timestamp: time.Now(),
+	})
+}
+
+// ListSnapshots 列出排行榜快照
+// @Summary 列出排行榜快照
+// @Description 按创建时间倒序分页返回快照的ID、玩家数和创建时间（不含快照数据），用于选择要恢复的快照
+// @Tags admin
+// @Produce json
+// @Param limit query int false "每页数量，默认 20，最大 100"
+// @Param offset query int false "起始偏移"
+// @Success 200 {object} SnapshotListResponse "快照列表"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /snapshots [get]
+func (h *HTTPHandler) ListSnapshots(c *gin.Context) {
+	start := time.Now()
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSnapshotLimit)))
+	if err != nil || limit <= 0 {
+		h.recordMetrics(c, "GET", "/snapshots", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid limit parameter",
+			Message: "Limit must be a positive integer",
+		})
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		h.recordMetrics(c, "GET", "/snapshots", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid offset parameter",
+			Message: "Offset must be a non-negative integer",
+		})
+		return
+	}
+
+	if limit > maxSnapshotLimit {
+		limit = maxSnapshotLimit
+	}
+
+	ctx := c.Request.Context()
+	snapshots, total, err := h.leaderboardService.ListSnapshots(ctx, limit, offset)
+	if err != nil {
+		h.recordMetrics(c, "GET", "/snapshots", "500", start)
+		h.requestLogger(c).Error("Failed to list snapshots", "error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to list snapshots",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/snapshots", "200", start)
+	c.JSON(http.StatusOK, SnapshotListResponse{
+		Total:     total,
+		Count:     len(snapshots),
+		Limit:     limit,
+		Offset:    offset,
+		Snapshots: snapshots,
+	})
+}
+
+// RestoreLeaderboard 从快照恢复排行榜
+// @Summary 从快照恢复排行榜
+// @Description 以 MySQL 中保存的排行榜快照（定期快照或 archive 方式重置前的归档，可通过 /snapshots 查询）恢复 MySQL 分数并重建 Redis 排行榜，不传 snapshotId 时使用最新的快照。不在快照中的玩家分数清零，时间窗口榜同时清空；应在停止写入后调用
+// @Tags admin
+// @Produce json
+// @Param snapshotId query int false "快照ID，不传则使用最新的快照"
+// @Success 200 {object} SuccessResponse "恢复成功，data 为恢复结果"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 404 {object} ErrorResponse "快照不存在"
+// @Failure 500 {object} ErrorResponse "恢复失败"
+// @Router /restore [post]
+func (h *HTTPHandler) RestoreLeaderboard(c *gin.Context) {
+	start := time.Now()
+
+	var snapshotID int64
+	if raw := c.Query("snapshotId"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			h.recordMetrics(c, "POST", "/restore", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid snapshotId parameter",
+				Message: "snapshotId must be a positive integer",
+			})
+			return
+		}
+		snapshotID = id
+	}
+
+	ctx := c.Request.Context()
+	result, err := h.leaderboardService.RestoreFromSnapshot(ctx, snapshotID)
+	if err != nil {
+		if errors.Is(err, service.ErrLeaderboardSnapshotNotFound) {
+			h.recordMetrics(c, "POST", "/restore", "404", start)
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Snapshot not found",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		h.recordMetrics(c, "POST", "/restore", "500", start)
+		h.requestLogger(c).Error("Failed to restore leaderboard", "snapshotID", snapshotID, "error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to restore leaderboard",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "POST", "/restore", "200", start)
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message:   "Leaderboard restored successfully",
+		Data:      result,
+		Timestamp: time.Now(),
+	})
+}
+
+// GetScoreBuckets 获取分数分布
+// @Summary 获取分数分布
+// @Description 从 MySQL 按总分分组统计玩家数（FLOOR(total_score/size)），包括不在排行榜上的玩家，不读取 Redis。按分数从低到高返回，只包含有玩家的分组
+// @Tags admin
+// @Produce json
+// @Param size query int false "每组的分数宽度，默认 100"
+// @Success 200 {object} ScoreBucketsResponse "分数分布"
+// @Failure 400 {object} ErrorResponse "参数错误或分组过多"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /score-buckets [get]
+func (h *HTTPHandler) GetScoreBuckets(c *gin.Context) {
+	start := time.Now()
+
+	size, err := strconv.ParseInt(c.DefaultQuery("size", "100"), 10, 64)
+	if err != nil || size <= 0 {
+		h.recordMetrics(c, "GET", "/score-buckets", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid size parameter",
+			Message: "Size must be a positive integer",
+		})
+		return
+	}
+
+	buckets, err := h.leaderboardService.GetScoreBuckets(c.Request.Context(), size)
+	if err != nil {
+		if err == service.ErrTooManyBuckets {
+			h.recordMetrics(c, "GET", "/score-buckets", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Too many buckets",
+				Message: "The score range produces too many buckets, please use a larger size",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "GET", "/score-buckets", "500", start)
+		h.requestLogger(c).Error("Failed to get score buckets",
+			"size", size,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get score buckets",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var total int64
+	for _, bucket := range buckets {
+		total += bucket.Count
+	}
+
+	h.recordMetrics(c, "GET", "/score-buckets", "200", start)
+	c.JSON(http.StatusOK, ScoreBucketsResponse{
+		Size:    size,
+		Total:   total,
+		Buckets: buckets,
+	})
+}
+
+// GetCacheStats 获取缓存统计
+// @Summary 获取缓存统计
+// @Description 获取本地缓存的统计信息
+// @Tags admin
+// @Produce json
+// @Success 200 {object} CacheStatsResponse "缓存统计"
+// @Router /cache/stats [get]
+func (h *HTTPHandler) GetCacheStats(c *gin.Context) {
+	start := time.Now()
+
+	stats := h.leaderboardService.GetCacheStats()
+
+	h.recordMetrics(c, "GET", "/cache/stats", "200", start)
+	c.JSON(http.StatusOK, CacheStatsResponse{
+		Stats: stats,
+	})
+}
+
+// FlushCache 清空缓存
+// @Summary 清空缓存
+// @Description 清空本地缓存和 L2 缓存中的排名和前N名，指定 playerId 时只清除该玩家的排名缓存，返回清空前后的缓存统计
+// @Tags admin
+// @Produce json
+// @Param playerId query string false "只清除该玩家的排名缓存"
+// @Success 200 {object} CacheFlushResponse "清空前后的缓存统计"
+// @Failure 400 {object} ErrorResponse "玩家ID无效"
+// @Failure 409 {object} ErrorResponse "缓存未启用"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /cache/flush [post]
+func (h *HTTPHandler) FlushCache(c *gin.Context) {
+	start := time.Now()
+	playerID := c.Query("playerId")
+
+	before, after, err := h.leaderboardService.FlushCache(c.Request.Context(), playerID)
+	if err != nil {
+		if errors.Is(err, service.ErrCacheDisabled) {
+			h.recordMetrics(c, "POST", "/cache/flush", "409", start)
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Error:   "Cache disabled",
+				Message: "Neither local nor l2 cache is enabled",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidPlayerID) {
+			h.recordMetrics(c, "POST", "/cache/flush", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid playerId",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		h.recordMetrics(c, "POST", "/cache/flush", "500", start)
+		h.requestLogger(c).Error("Failed to flush cache",
+			"playerID", playerID,
+			"error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to flush cache",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "POST", "/cache/flush", "200", start)
+	c.JSON(http.StatusOK, CacheFlushResponse{
+		PlayerID: playerID,
+		Before:   before,
+		After:    after,
+	})
+}
+
+// GetBlockedPlayers 获取封禁玩家列表
+// @Summary 获取封禁玩家列表
+// @Description 获取所有被封禁、不进入排行榜的玩家ID
+// @Tags admin
+// @Produce json
+// @Success 200 {object} BlocklistResponse "封禁玩家列表"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /blocklist [get]
+func (h *HTTPHandler) GetBlockedPlayers(c *gin.Context) {
+	start := time.Now()
+
+	playerIDs, err := h.leaderboardService.GetBlockedPlayers(c.Request.Context())
+	if err != nil {
+		h.recordMetrics(c, "GET", "/blocklist", "500", start)
+		h.requestLogger(c).Error("Failed to get blocked players", "error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get blocked players",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/blocklist", "200", start)
+	c.JSON(http.StatusOK, BlocklistResponse{
+		Count:     len(playerIDs),
+		PlayerIDs: playerIDs,
+	})
+}
+
+// BlockPlayers 封禁玩家
+// @Summary 封禁玩家
+// @Description 将玩家加入封禁列表并从排行榜中移除，之后的分数更新只记录历史不进入排行榜
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body model.BlocklistRequest true "要封禁的玩家ID"
+// @Success 200 {object} SuccessResponse "封禁成功"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /blocklist [post]
+func (h *HTTPHandler) BlockPlayers(c *gin.Context) {
+	start := time.Now()
+
+	h.limitBatchBody(c)
+
+	var req model.BlocklistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.recordMetrics(c, "POST", "/blocklist", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if len(req.PlayerIDs) == 0 {
+		h.recordMetrics(c, "POST", "/blocklist", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerIDs are required",
+			Message: "PlayerIDs cannot be empty",
+		})
+		return
+	}
+
+	if !h.checkBatchSize(c, "POST", "/blocklist", len(req.PlayerIDs), start) {
+		return
+	}
+
+	for _, playerID := range req.PlayerIDs {
+		if playerID == "" {
+			h.recordMetrics(c, "POST", "/blocklist", "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "PlayerID is required",
+				Message: "PlayerID cannot be empty",
+			})
+			return
+		}
+	}
+
+	if err := h.leaderboardService.BlockPlayers(c.Request.Context(), req.PlayerIDs); err != nil {
+		h.recordMetrics(c, "POST", "/blocklist", "500", start)
+		h.requestLogger(c).Error("Failed to block players",
+			"count", len(req.PlayerIDs),
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to block players",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "POST", "/blocklist", "200", start)
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message:   "Players blocked successfully",
+		Data:      map[string]interface{}{"playerIds": req.PlayerIDs},
+		Timestamp: time.Now(),
+	})
+}
+
+// UnblockPlayer 解除封禁
+// @Summary 解除封禁
+// @Description 将玩家移出封禁列表，并以 MySQL 中的总分恢复到排行榜
+// @Tags admin
+// @Produce json
+// @Param playerId path string true "玩家ID"
+// @Success 200 {object} SuccessResponse "解除成功"
+// @Failure 400 {object} ErrorResponse "参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /blocklist/{playerId} [delete]
+func (h *HTTPHandler) UnblockPlayer(c *gin.Context) {
+	start := time.Now()
 
-	ctx := c.Request.Context()
-	err := h.leaderboardService.RebuildLeaderboard(ctx)
+	playerID := c.Param("playerId")
+	if playerID == "" {
+		h.recordMetrics(c, "DELETE", "/blocklist/:playerId", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID cannot be empty",
+		})
+		return
+	}
+
+	if err := h.leaderboardService.UnblockPlayers(c.Request.Context(), []string{playerID}); err != nil {
+		h.recordMetrics(c, "DELETE", "/blocklist/:playerId", "500", start)
+		h.requestLogger(c).Error("Failed to unblock player",
+			"playerID", playerID,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to unblock player",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "DELETE", "/blocklist/:playerId", "200", start)
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message:   "Player unblocked successfully",
+		Data:      map[string]interface{}{"playerId": playerID},
+		Timestamp: time.Now(),
+	})
+}
+
+// SetPlayerScore 直接设置玩家总分
+// @Summary 直接设置玩家总分
+// @Description 管理员将已有玩家的总分覆盖为指定值（如作弊回滚后的修正），以与原分数的差值记录历史。与 POST /upscores 的增量更新不同，不应用得分原因倍率，Redis 覆盖写入
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param playerId path string true "玩家ID"
+// @Param request body model.SetScoreRequest true "新的总分及原因，原因默认为 admin_correction"
+// @Success 200 {object} SuccessResponse "设置成功"
+// @Failure 400 {object} ErrorResponse "参数错误或分数超出上限"
+// @Failure 404 {object} ErrorResponse "玩家不存在"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /user/{playerId}/score [put]
+func (h *HTTPHandler) SetPlayerScore(c *gin.Context) {
+	start := time.Now()
+
+	playerID := c.Param("playerId")
+	if playerID == "" {
+		h.recordMetrics(c, "PUT", "/user/:playerId/score", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID cannot be empty",
+		})
+		return
+	}
+
+	var req model.SetScoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.recordMetrics(c, "PUT", "/user/:playerId/score", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	err := h.leaderboardService.SetPlayerScore(c.Request.Context(), playerID, *req.Score, req.Reason)
+	if errors.Is(err, service.ErrInvalidPlayerID) {
+		h.recordMetrics(c, "PUT", "/user/:playerId/score", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid playerId",
+			Message: fmt.Sprintf("PlayerID must be at most %d characters and must not contain control characters or only whitespace", utils.MaxPlayerIDLength),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrScoreOutOfRange) {
+		h.recordMetrics(c, "PUT", "/user/:playerId/score", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Score out of range",
+			Message: err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrPlayerNotFound) {
+		h.recordMetrics(c, "PUT", "/user/:playerId/score", "404", start)
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Player not found",
+			Message: fmt.Sprintf("Player %s not found", playerID),
+		})
+		return
+	}
 	if err != nil {
-		h.recordMetrics(c, "POST", "/rebuild", "500", start)
-		h.logger.Error("Failed to rebuild leaderboard", "error", err)
+		h.recordMetrics(c, "PUT", "/user/:playerId/score", "500", start)
+		h.requestLogger(c).Error("Failed to set player score",
+			"playerID", playerID,
+			"score", *req.Score,
+			"error", err)
 
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error:   "Failed to rebuild leaderboard",
+			Error:   "Failed to set player score",
 			Message: err.Error(),
 		})
 		return
 	}
 
-	h.recordMetrics(c, "POST", "/rebuild", "200", start)
+	h.requestLogger(c).Info("Player score set by admin",
+		"playerID", playerID,
+		"score", *req.Score,
+		"reason", req.Reason)
+
+	h.recordMetrics(c, "PUT", "/user/:playerId/score", "200", start)
 	c.JSON(http.StatusOK, SuccessResponse{
-		Message:   "Leaderboard rebuilt successfully",
+		Message: "Player score set successfully",
+		Data: map[string]interface{}{
+			"playerId": playerID,
+			"score":    *req.Score,
+		},
 		Timestamp: time.Now(),
 	})
 }
 
-// GetCacheStats 获取缓存统计
-// @Summary 获取缓存统计
-// @Description 获取本地缓存的统计信息
+// GetScoreWriteQueue 获取异步写入队列状态
+// @Summary 获取异步写入队列状态
+// @Description 先写 Redis 模式（WRITE_MODE=redis_first）下等待写入 MySQL 的变更数，以及死信队列中最早的变更
 // @Tags admin
 // @Produce json
-// @Success 200 {object} CacheStatsResponse "缓存统计"
-// @Router /cache/stats [get]
-func (h *HTTPHandler) GetCacheStats(c *gin.Context) {
+// @Param limit query int false "返回的死信条数，默认 100，最大 1000"
+// @Success 200 {object} ScoreWriteQueueResponse "队列状态"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /score-writes [get]
+func (h *HTTPHandler) GetScoreWriteQueue(c *gin.Context) {
 	start := time.Now()
 
-	stats := h.leaderboardService.GetCacheStats()
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultDeadWritesLimit)))
+	if err != nil || limit <= 0 {
+		h.recordMetrics(c, "GET", "/score-writes", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid limit parameter",
+			Message: "Limit must be a positive integer",
+		})
+		return
+	}
+	if limit > maxDeadWritesLimit {
+		limit = maxDeadWritesLimit
+	}
 
-	h.recordMetrics(c, "GET", "/cache/stats", "200", start)
-	c.JSON(http.StatusOK, CacheStatsResponse{
+	stats, dead, err := h.leaderboardService.GetScoreWriteQueue(c.Request.Context(), int64(limit))
+	if err != nil {
+		h.recordMetrics(c, "GET", "/score-writes", "500", start)
+		h.requestLogger(c).Error("Failed to get score write queue", "error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to get score write queue",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "GET", "/score-writes", "200", start)
+	c.JSON(http.StatusOK, ScoreWriteQueueResponse{
 		Stats: stats,
+		Dead:  dead,
+	})
+}
+
+// RetryDeadScoreWrites 重试死信队列中的变更
+// @Summary 重试死信队列中的变更
+// @Description 将死信队列中的全部变更重新加入待写入 MySQL 的队列，已写入过的变更按 write_id 去重
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse "重新入队成功"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /score-writes/retry [post]
+func (h *HTTPHandler) RetryDeadScoreWrites(c *gin.Context) {
+	start := time.Now()
+
+	requeued, err := h.leaderboardService.RetryDeadScoreWrites(c.Request.Context())
+	if err != nil {
+		h.recordMetrics(c, "POST", "/score-writes/retry", "500", start)
+		h.requestLogger(c).Error("Failed to retry dead score writes",
+			"requeued", requeued,
+			"error", err)
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to retry dead score writes",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "POST", "/score-writes/retry", "200", start)
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message:   "Dead score writes requeued",
+		Data:      map[string]interface{}{"requeued": requeued},
+		Timestamp: time.Now(),
+	})
+}
+
+// ExportCacheState 导出缓存状态
+// @Summary 导出缓存状态
+// @Description 将本地缓存中未过期的排名和前N名保存到 Redis，供重启后预热
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse "导出成功"
+// @Failure 409 {object} ErrorResponse "缓存未启用"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /cache/export [post]
+func (h *HTTPHandler) ExportCacheState(c *gin.Context) {
+	start := time.Now()
+
+	exported, err := h.leaderboardService.ExportCacheState(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrCacheDisabled) {
+			h.recordMetrics(c, "POST", "/cache/export", "409", start)
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Error:   "Cache disabled",
+				Message: "Local cache is not enabled",
+			})
+			return
+		}
+
+		h.recordMetrics(c, "POST", "/cache/export", "500", start)
+		h.requestLogger(c).Error("Failed to export cache state", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to export cache state",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.recordMetrics(c, "POST", "/cache/export", "200", start)
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message:   "Cache state exported successfully",
+		Data:      map[string]interface{}{"entries": exported},
+		Timestamp: time.Now(),
+	})
+}
+
+// ImportCacheState 导入缓存状态
+// @Summary 导入缓存状态
+// @Description 从 Redis 中的快照恢复本地缓存，已过期的缓存项会被跳过
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SuccessResponse "导入成功"
+// @Failure 404 {object} ErrorResponse "快照不存在"
+// @Failure 409 {object} ErrorResponse "缓存未启用"
+// @Failure 500 {object} ErrorResponse "服务器内部错误"
+// @Router /cache/import [post]
+func (h *HTTPHandler) ImportCacheState(c *gin.Context) {
+	start := time.Now()
+
+	imported, err := h.leaderboardService.ImportCacheState(c.Request.Context())
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrCacheDisabled):
+			h.recordMetrics(c, "POST", "/cache/import", "409", start)
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Error:   "Cache disabled",
+				Message: "Local cache is not enabled",
+			})
+		case errors.Is(err, service.ErrNoSnapshot):
+			h.recordMetrics(c, "POST", "/cache/import", "404", start)
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Snapshot not found",
+				Message: "No cache snapshot has been exported or it has expired",
+			})
+		default:
+			h.recordMetrics(c, "POST", "/cache/import", "500", start)
+			h.requestLogger(c).Error("Failed to import cache state", "error", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "Failed to import cache state",
+				Message: err.Error(),
+			})
+		}
+		return
+	}
+
+	h.recordMetrics(c, "POST", "/cache/import", "200", start)
+	c.JSON(http.StatusOK, SuccessResponse{
+		Message:   "Cache state imported successfully",
+		Data:      map[string]interface{}{"entries": imported},
+		Timestamp: time.Now(),
+	})
+}
+
+// 解析 base 查询参数，返回排名的起始值（默认 1，可选 0）
+func (h *HTTPHandler) parseRankBase(c *gin.Context, method, endpoint string, start time.Time) (int, bool) {
+	switch c.DefaultQuery("base", "1") {
+	case "1":
+		return 1, true
+	case "0":
+		return 0, true
+	}
+
+	h.recordMetrics(c, method, endpoint, "400", start)
+	c.JSON(http.StatusBadRequest, ErrorResponse{
+		Error:   "Invalid base parameter",
+		Message: "Base must be 0 or 1",
+	})
+	return 0, false
+}
+
+// 解析分数区间的一侧，参数缺失或为 unbounded（-inf 或 +inf）时返回 nil 表示不限
+func (h *HTTPHandler) parseScoreBound(c *gin.Context, method, endpoint, name, unbounded string, start time.Time) (*int64, bool) {
+	raw := strings.TrimSpace(c.Query(name))
+	if raw == "" || raw == unbounded || (unbounded == "+inf" && raw == "inf") {
+		return nil, true
+	}
+
+	score, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		h.recordMetrics(c, method, endpoint, "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   fmt.Sprintf("Invalid %s parameter", name),
+			Message: fmt.Sprintf("%s must be an integer or %s", name, unbounded),
+		})
+		return nil, false
+	}
+	return &score, true
+}
+
+// 解析 method 查询参数，指定时覆盖配置的排名方式，返回携带该设置的请求 context
+func (h *HTTPHandler) parseRankingMethod(c *gin.Context, method, endpoint string, start time.Time) (context.Context, bool) {
+	ctx, err := service.WithRankingMethod(c.Request.Context(), c.Query("method"))
+	if err != nil {
+		h.recordMetrics(c, method, endpoint, "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid method parameter",
+			Message: "Method must be standard or dense",
+		})
+		return nil, false
+	}
+	return ctx, true
+}
+
+// rankInfoFields RankInfo 可通过 fields 参数选择的字段（与 JSON 字段名一致）
+var rankInfoFields = map[string]func(*model.RankInfo) interface{}{
+	"playerId":  func(r *model.RankInfo) interface{} { return r.PlayerID },
+	"rank":      func(r *model.RankInfo) interface{} { return r.Rank },
+	"score":     func(r *model.RankInfo) interface{} { return r.Score },
+	"name":      func(r *model.RankInfo) interface{} { return r.Name },
+	"updatedAt": func(r *model.RankInfo) interface{} { return r.UpdatedAt },
+
+	"approximate":    func(r *model.RankInfo) interface{} { return r.Approximate },
+	"rankComputedAt": func(r *model.RankInfo) interface{} { return r.RankComputedAt },
+	"stale":          func(r *model.RankInfo) interface{} { return r.Stale },
+	"fallback":       func(r *model.RankInfo) interface{} { return r.Fallback },
+}
+
+// 解析 fields 查询参数（逗号分隔的 RankInfo 字段名），未指定时返回 nil 表示全部字段
+func (h *HTTPHandler) parseRankFields(c *gin.Context, method, endpoint string, start time.Time) ([]string, bool) {
+	raw := c.Query("fields")
+	if raw == "" {
+		return nil, true
+	}
+
+	fields := make([]string, 0)
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if _, ok := rankInfoFields[field]; !ok {
+			h.recordMetrics(c, method, endpoint, "400", start)
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid fields parameter",
+				Message: fmt.Sprintf("Unknown field '%s'", field),
+			})
+			return nil, false
+		}
+		fields = append(fields, field)
+	}
+
+	if len(fields) == 0 {
+		return nil, true
+	}
+	return fields, true
+}
+
+// 只保留指定字段，fields 为 nil 时原样返回
+func selectRankFields(rankInfo *model.RankInfo, fields []string) interface{} {
+	if fields == nil || rankInfo == nil {
+		return rankInfo
+	}
+
+	selected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		selected[field] = rankInfoFields[field](rankInfo)
+	}
+	return selected
+}
+
+func selectRankingsFields(rankings []*model.RankInfo, fields []string) interface{} {
+	if fields == nil {
+		return rankings
+	}
+
+	selected := make([]interface{}, 0, len(rankings))
+	for _, rankInfo := range rankings {
+		selected = append(selected, selectRankFields(rankInfo, fields))
+	}
+	return selected
+}
+
+// 按指定起始值返回排名信息，缓存中的对象是共享的，需复制后再修改
+func rankInfoWithBase(rankInfo *model.RankInfo, base int) *model.RankInfo {
+	if base == 1 || rankInfo == nil {
+		return rankInfo
+	}
+
+	converted := *rankInfo
+	converted.Rank -= 1 - base
+	return &converted
+}
+
+func rankingsWithBase(rankings []*model.RankInfo, base int) []*model.RankInfo {
+	if base == 1 {
+		return rankings
+	}
+
+	converted := make([]*model.RankInfo, 0, len(rankings))
+	for _, rankInfo := range rankings {
+		converted = append(converted, rankInfoWithBase(rankInfo, base))
+	}
+	return converted
+}
+
+// 批量接口每个条目的请求体字节数估算值，以及条目之外的固定开销
+const (
+	maxBatchEntryBytes = 1 << 10
+	batchBodyOverhead  = 4 << 10
+)
+
+// 按条目数上限限制批量请求体的大小，超出时 JSON 解析失败，避免超大数组在条目数校验前已被完整解码
+func (h *HTTPHandler) limitBatchBody(c *gin.Context) {
+	if h.maxBatchSize <= 0 {
+		return
+	}
+	limit := int64(h.maxBatchSize)*maxBatchEntryBytes + batchBodyOverhead
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+}
+
+// 校验批量请求的条目数，超出上限时返回 400
+func (h *HTTPHandler) checkBatchSize(c *gin.Context, method, endpoint string, size int, start time.Time) bool {
+	if h.maxBatchSize <= 0 || size <= h.maxBatchSize {
+		return true
+	}
+
+	h.recordMetrics(c, method, endpoint, "400", start)
+	c.JSON(http.StatusBadRequest, ErrorResponse{
+		Error:   "Batch too large",
+		Message: fmt.Sprintf("Batch size %d exceeds the maximum of %d", size, h.maxBatchSize),
 	})
+	return false
+}
+
+// 返回附加了当前请求ID的日志记录器
+func (h *HTTPHandler) requestLogger(c *gin.Context) *logger.Logger {
+	return h.logger.WithContext(c.Request.Context())
 }
 
 // 记录指标
 func (h *HTTPHandler) recordMetrics(c *gin.Context, method, endpoint, status string, start time.Time) {
+	recordRequestMetrics(method, endpoint, status, start)
+}
+
+func recordRequestMetrics(method, endpoint, status string, start time.Time) {
 	duration := time.Since(start).Seconds()
 
 	requestCounter.WithLabelValues(method, endpoint, status).Inc()
@@ -388,29 +3049,143 @@ type SuccessResponse struct {
 	Timestamp time.Time   `json:"timestamp"`
 }
 
+// Fields 为请求体校验失败的字段（字段路径 -> 未通过的规则），仅在字段级校验失败时返回
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-	Code    int    `json:"code,omitempty"`
+	Error   string            `json:"error"`
+	Message string            `json:"message"`
+	Code    int               `json:"code,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
 }
 
+// Rankings 为 []*model.RankInfo，指定 fields 参数时只包含所选字段
 type TopNResponse struct {
+	Count    int         `json:"count"`
+	Rankings interface{} `json:"rankings"`
+	Size     *int64      `json:"size,omitempty"`     // 仅 n 为 0 时返回排行榜人数
+	Stale    bool        `json:"stale,omitempty"`    // Redis 不可用时返回的是已过期的本地缓存
+	Fallback bool        `json:"fallback,omitempty"` // Redis 不可用时返回的是 MySQL 中的数据
+	Matched  *int64      `json:"matched,omitempty"`  // 仅指定分数区间时返回区间内的总人数
+	MaxN     int         `json:"maxN,omitempty"`     // 服务配置的 n 上限
+	Clamped  bool        `json:"clamped,omitempty"`  // 请求的 n 超过上限，已按上限截断
+}
+
+type PageResponse struct {
+	Offset   int         `json:"offset"`
+	Limit    int         `json:"limit"`
+	Total    int64       `json:"total"`
+	Count    int         `json:"count"`
+	Rankings interface{} `json:"rankings"`
+}
+
+type BatchUpdateResponse struct {
+	Total     int                        `json:"total"`
+	Succeeded int                        `json:"succeeded"`
+	Failed    int                        `json:"failed"`
+	Results   []*model.BatchUpdateResult `json:"results"`
+}
+
+type SnapshotListResponse struct {
+	Total     int64                        `json:"total"`
+	Count     int                          `json:"count"`
+	Limit     int                          `json:"limit"`
+	Offset    int                          `json:"offset"`
+	Snapshots []*model.LeaderboardSnapshot `json:"snapshots"`
+}
+
+type ScoreHistoryResponse struct {
+	PlayerID string                      `json:"playerId"`
+	Count    int                         `json:"count"`
+	History  []*model.PlayerScoreHistory `json:"history"`
+}
+
+type DailyScoreDeltasResponse struct {
+	PlayerID string                   `json:"playerId"`
+	Days     int                      `json:"days"`
+	Deltas   []*model.DailyScoreDelta `json:"deltas"`
+}
+
+type LastActiveResponse struct {
+	PlayerID   string    `json:"playerId"`
+	LastActive time.Time `json:"lastActive"`
+}
+
+type BatchRankResponse struct {
+	Ranks    map[string]*model.RankInfo `json:"ranks"`
+	NotFound []string                   `json:"notFound"`
+}
+
+// Rankings 中的 rank 为组内相对名次
+type AmongRankingResponse struct {
 	Count    int               `json:"count"`
 	Rankings []*model.RankInfo `json:"rankings"`
+	NotFound []string          `json:"notFound"`
+}
+
+type ScoreBucketsResponse struct {
+	Size    int64               `json:"size"`
+	Total   int64               `json:"total"`
+	Buckets []model.ScoreBucket `json:"buckets"`
+}
+
+type SearchResponse struct {
+	Name    string                 `json:"name"`
+	Count   int                    `json:"count"`
+	Players []*model.PlayerProfile `json:"players"`
 }
 
 type RankRangeResponse struct {
-	PlayerID string            `json:"playerId"`
-	Range    int               `json:"range"`
-	Rankings []*model.RankInfo `json:"rankings"`
+	PlayerID string `json:"playerId"`
+	Range    int    `json:"range"`
+	// EffectiveRange 实际返回的条数，只有排行榜人数少于 Range 时才小于 Range
+	EffectiveRange int         `json:"effectiveRange"`
+	Rankings       interface{} `json:"rankings"`
+}
+
+type NearScoreResponse struct {
+	PlayerID string `json:"playerId"`
+	Score    int64  `json:"score"` // 玩家当前分数
+	Delta    int64  `json:"delta"`
+	// Matched 分数在 [score-delta, score+delta] 内的总人数，Count 为实际返回的条数
+	Matched  int64       `json:"matched"`
+	Count    int         `json:"count"`
+	Rankings interface{} `json:"rankings"`
 }
 
 type HealthResponse struct {
-	Status    string            `json:"status"`
-	Timestamp time.Time         `json:"timestamp"`
-	Services  map[string]string `json:"services"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type ReadinessResponse struct {
+	Status       string                            `json:"status"`
+	Timestamp    time.Time                         `json:"timestamp"`
+	Dependencies map[string]model.DependencyHealth `json:"dependencies"`
+	ErrorRate    *ErrorRateStatus                  `json:"errorRate,omitempty"`
+}
+
+type ErrorRateStatus struct {
+	Requests  int     `json:"requests"`
+	Percent   float64 `json:"percent"`
+	Threshold float64 `json:"threshold"`
+}
+
+type BlocklistResponse struct {
+	Count     int      `json:"count"`
+	PlayerIDs []string `json:"playerIds"`
+}
+
+type ScoreWriteQueueResponse struct {
+	Stats *model.ScoreWriteQueueStats `json:"stats"`
+	Dead  []*model.PendingScoreWrite  `json:"dead"`
 }
 
 type CacheStatsResponse struct {
 	Stats map[string]interface{} `json:"stats"`
 }
+
+// PlayerID 为空表示整体清空
+type CacheFlushResponse struct {
+	PlayerID string                 `json:"playerId,omitempty"`
+	Before   map[string]interface{} `json:"before"`
+	After    map[string]interface{} `json:"after"`
+}
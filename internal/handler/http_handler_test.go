@@ -0,0 +1,1204 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"game-leaderboard/internal/metrics"
+	"game-leaderboard/internal/middleware"
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/repository/repotest"
+	"game-leaderboard/internal/service"
+	"game-leaderboard/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 基于内存存储的 HTTP 处理器，测试按需在 router 上注册路由
+type handlerEnv struct {
+	h      *HTTPHandler
+	svc    *service.LeaderboardService
+	redis  *repotest.RedisStore
+	mysql  *repotest.MySQLStore
+	router *gin.Engine
+}
+
+// 批量上限、周边排名范围上限和前N名上限分别为 10、5、3
+func newHandlerEnv(t *testing.T, opts service.Options) *handlerEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	env := &handlerEnv{
+		redis:  repotest.NewRedisStore(true, ""),
+		mysql:  repotest.NewMySQLStore(opts.MaxScore),
+		router: gin.New(),
+	}
+	env.svc = service.NewLeaderboardService(env.redis, env.mysql, opts)
+	t.Cleanup(env.svc.Close)
+	env.h = NewHTTPHandler(env.svc, 10, 5, 3)
+	return env
+}
+
+// 在 MySQL 和 Redis 中写入相同的玩家分数
+func (e *handlerEnv) seed(t *testing.T, playerID, name string, score int64) {
+	t.Helper()
+
+	updatedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	e.mysql.AddPlayer(model.Player{ID: playerID, Name: name, TotalScore: score, UpdatedAt: updatedAt})
+	if err := e.redis.UpdatePlayerScore(context.Background(), playerID, score, name, updatedAt); err != nil {
+		t.Fatalf("seed %s: %v", playerID, err)
+	}
+}
+
+// 发送请求，body 为空时不带请求体
+func (e *handlerEnv) do(method, target, body string) *httptest.ResponseRecorder {
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+// 将响应体解析到 v，失败时测试失败
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestUpdatePlayerNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantNames  map[string]string
+	}{
+		{
+			name:       "names change and scores stay",
+			body:       `{"names": {"p1": "Alicia", "p2": "Robert", "p9": "nobody"}}`,
+			wantStatus: http.StatusOK,
+			wantNames:  map[string]string{"p1": "Alicia", "p2": "Robert"},
+		},
+		{
+			name:       "empty names",
+			body:       `{"names": {}}`,
+			wantStatus: http.StatusBadRequest,
+			wantNames:  map[string]string{"p1": "alice", "p2": "bob"},
+		},
+		{
+			name:       "empty player id",
+			body:       `{"names": {"": "ghost"}}`,
+			wantStatus: http.StatusBadRequest,
+			wantNames:  map[string]string{"p1": "alice", "p2": "bob"},
+		},
+		{
+			name:       "invalid body",
+			body:       `{"names": [`,
+			wantStatus: http.StatusBadRequest,
+			wantNames:  map[string]string{"p1": "alice", "p2": "bob"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newHandlerEnv(t, service.Options{EnableCache: true, CacheSize: 10, CacheTTL: time.Minute})
+			env.router.POST("/game/rank/names", env.h.UpdatePlayerNames)
+			env.router.GET("/game/rank/user/:playerId", env.h.GetPlayerRank)
+			env.seed(t, "p1", "alice", 300)
+			env.seed(t, "p2", "bob", 200)
+
+			// 预热缓存，名称更新后应失效
+			for playerID := range tt.wantNames {
+				env.do(http.MethodGet, "/game/rank/user/"+playerID, "")
+			}
+
+			w := env.do(http.MethodPost, "/game/rank/names", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			wantScores := map[string]int64{"p1": 300, "p2": 200}
+			for playerID, wantName := range tt.wantNames {
+				w := env.do(http.MethodGet, "/game/rank/user/"+playerID, "")
+				var rankInfo model.RankInfo
+				decode(t, w, &rankInfo)
+				if rankInfo.Name != wantName || rankInfo.Score != wantScores[playerID] {
+					t.Errorf("%s = name %q score %d, want name %q score %d",
+						playerID, rankInfo.Name, rankInfo.Score, wantName, wantScores[playerID])
+				}
+
+				player, _ := env.mysql.Player(playerID)
+				if player.Name != wantName || player.TotalScore != wantScores[playerID] {
+					t.Errorf("mysql %s = name %q score %d, want name %q score %d",
+						playerID, player.Name, player.TotalScore, wantName, wantScores[playerID])
+				}
+				if history := env.mysql.History(playerID); len(history) != 0 {
+					t.Errorf("mysql %s history = %d entries, want none", playerID, len(history))
+				}
+			}
+			if _, ok := env.mysql.Player("p9"); ok {
+				t.Error("renaming an unknown player created it")
+			}
+		})
+	}
+}
+
+func TestBatchSizeLimit(t *testing.T) {
+	ids := func(n int) []string {
+		playerIDs := make([]string, n)
+		for i := range playerIDs {
+			playerIDs[i] = fmt.Sprintf("p%d", i)
+		}
+		return playerIDs
+	}
+	playerIDsBody := func(n int) string {
+		body, _ := json.Marshal(map[string]interface{}{"playerIds": ids(n)})
+		return string(body)
+	}
+	updatesBody := func(n int) string {
+		updates := make([]model.UpdateRequest, n)
+		for i, playerID := range ids(n) {
+			updates[i] = model.UpdateRequest{PlayerID: playerID, IncrScore: 1}
+		}
+		body, _ := json.Marshal(model.BatchUpdateRequest{Updates: updates})
+		return string(body)
+	}
+	namesBody := func(n int) string {
+		names := make(map[string]string, n)
+		for _, playerID := range ids(n) {
+			names[playerID] = "name-" + playerID
+		}
+		body, _ := json.Marshal(model.UpdateNamesRequest{Names: names})
+		return string(body)
+	}
+
+	endpoints := []struct {
+		path    string
+		handler func(h *HTTPHandler) gin.HandlerFunc
+		body    func(n int) string
+	}{
+		{"/upscores/batch", func(h *HTTPHandler) gin.HandlerFunc { return h.BatchUpdateScores }, updatesBody},
+		{"/names", func(h *HTTPHandler) gin.HandlerFunc { return h.UpdatePlayerNames }, namesBody},
+		{"/ranks", func(h *HTTPHandler) gin.HandlerFunc { return h.BatchGetPlayerRanks }, playerIDsBody},
+		{"/among", func(h *HTTPHandler) gin.HandlerFunc { return h.GetRankingAmongPlayers }, playerIDsBody},
+		{"/cohort", func(h *HTTPHandler) gin.HandlerFunc { return h.GetCohortStats }, playerIDsBody},
+		{"/blocklist", func(h *HTTPHandler) gin.HandlerFunc { return h.BlockPlayers }, playerIDsBody},
+	}
+
+	for _, endpoint := range endpoints {
+		for _, size := range []int{10, 11} {
+			t.Run(fmt.Sprintf("%s with %d entries", endpoint.path, size), func(t *testing.T) {
+				env := newHandlerEnv(t, service.Options{})
+				env.router.POST("/game/rank"+endpoint.path, endpoint.handler(env.h))
+
+				w := env.do(http.MethodPost, "/game/rank"+endpoint.path, endpoint.body(size))
+				var resp ErrorResponse
+				json.Unmarshal(w.Body.Bytes(), &resp)
+
+				overLimit := w.Code == http.StatusBadRequest && resp.Error == "Batch too large"
+				if size > 10 && (!overLimit || !strings.Contains(resp.Message, "maximum of 10")) {
+					t.Fatalf("status = %d, body %s, want 400 naming the limit of 10", w.Code, w.Body)
+				}
+				if size <= 10 && overLimit {
+					t.Fatalf("batch of %d rejected at a limit of 10", size)
+				}
+			})
+		}
+	}
+}
+
+func TestBatchBodySizeLimit(t *testing.T) {
+	// 条目数在上限内，但请求体超过按 10 个条目估算的大小上限
+	padding := strings.Repeat("x", 10*maxBatchEntryBytes+batchBodyOverhead)
+	playerIDsBody := fmt.Sprintf(`{"playerIds":["p1","%s"]}`, padding)
+
+	endpoints := []struct {
+		path    string
+		handler func(h *HTTPHandler) gin.HandlerFunc
+		body    string
+	}{
+		{"/upscores/batch", func(h *HTTPHandler) gin.HandlerFunc { return h.BatchUpdateScores },
+			fmt.Sprintf(`{"updates":[{"playerId":"p1","incrScore":1},{"playerId":"p2","incrScore":1,"name":"%s"}]}`, padding)},
+		{"/names", func(h *HTTPHandler) gin.HandlerFunc { return h.UpdatePlayerNames },
+			fmt.Sprintf(`{"names":{"p1":"%s"}}`, padding)},
+		{"/ranks", func(h *HTTPHandler) gin.HandlerFunc { return h.BatchGetPlayerRanks }, playerIDsBody},
+		{"/among", func(h *HTTPHandler) gin.HandlerFunc { return h.GetRankingAmongPlayers }, playerIDsBody},
+		{"/cohort", func(h *HTTPHandler) gin.HandlerFunc { return h.GetCohortStats }, playerIDsBody},
+		{"/blocklist", func(h *HTTPHandler) gin.HandlerFunc { return h.BlockPlayers }, playerIDsBody},
+	}
+
+	for _, endpoint := range endpoints {
+		t.Run(endpoint.path, func(t *testing.T) {
+			env := newHandlerEnv(t, service.Options{})
+			env.router.POST("/game/rank"+endpoint.path, endpoint.handler(env.h))
+
+			w := env.do(http.MethodPost, "/game/rank"+endpoint.path, endpoint.body)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "request body too large") {
+				t.Fatalf("status = %d, body %.200s, want 400 for an oversized body", w.Code, w.Body)
+			}
+			if _, ok := env.mysql.Player("p1"); ok {
+				t.Errorf("p1 was written although the request was rejected")
+			}
+		})
+	}
+}
+
+func TestUpdateScoreInvalidPlayerID(t *testing.T) {
+	tests := []struct {
+		name     string
+		playerID string
+	}{
+		{"only whitespace", "   "},
+		// 以 JSON 转义写入请求体
+		{"control character", `alice\u0000`},
+		{"newline", `alice\nbob`},
+		{"too long", strings.Repeat("a", utils.MaxPlayerIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newHandlerEnv(t, service.Options{})
+			env.router.POST("/game/rank/upscores", env.h.UpdateScore)
+
+			w := env.do(http.MethodPost, "/game/rank/upscores", fmt.Sprintf(`{"playerId": "%s", "incrScore": 5}`, tt.playerID))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, body %s, want 400", w.Code, w.Body)
+			}
+			var resp ErrorResponse
+			decode(t, w, &resp)
+			if resp.Error != "Invalid playerId" {
+				t.Errorf("error = %q, want %q", resp.Error, "Invalid playerId")
+			}
+			if got := env.mysql.Calls("ApplyScoreChange"); got != 0 {
+				t.Errorf("ApplyScoreChange calls = %d, want 0 for a rejected request", got)
+			}
+		})
+	}
+}
+
+// 公开的更新接口不能覆盖总分，玩家分数保持不变
+func TestUpdateScoreRejectsSetAbsolute(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		handler    func(h *HTTPHandler) gin.HandlerFunc
+		body       string
+		wantFields map[string]string
+	}{
+		{
+			name:    "single update",
+			path:    "/game/rank/upscores",
+			handler: func(h *HTTPHandler) gin.HandlerFunc { return h.UpdateScore },
+			body:    `{"playerId": "p1", "incrScore": 999999, "setAbsolute": true}`,
+		},
+		{
+			name:    "batch update",
+			path:    "/game/rank/upscores/batch",
+			handler: func(h *HTTPHandler) gin.HandlerFunc { return h.BatchUpdateScores },
+			body: `{"updates": [{"playerId": "p2", "incrScore": 5},
+				{"playerId": "p1", "incrScore": 999999, "setAbsolute": true}]}`,
+			wantFields: map[string]string{"updates[1].setAbsolute": "not_allowed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newHandlerEnv(t, service.Options{})
+			env.seed(t, "p1", "alice", 100)
+			env.router.POST(tt.path, tt.handler(env.h))
+
+			w := env.do(http.MethodPost, tt.path, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, body %s, want 400", w.Code, w.Body)
+			}
+			var resp ErrorResponse
+			decode(t, w, &resp)
+			if resp.Error != "setAbsolute is not allowed" {
+				t.Errorf("error = %q, want %q", resp.Error, "setAbsolute is not allowed")
+			}
+			if fmt.Sprint(resp.Fields) != fmt.Sprint(tt.wantFields) {
+				t.Errorf("fields = %v, want %v", resp.Fields, tt.wantFields)
+			}
+			// 整批拒绝，其中的增量更新也不执行
+			if got := env.mysql.Calls("SetPlayerScore") + env.mysql.Calls("ApplyScoreChange"); got != 0 {
+				t.Errorf("mysql writes = %d, want 0 for a rejected request", got)
+			}
+			if player, _ := env.mysql.Player("p1"); player.TotalScore != 100 {
+				t.Errorf("p1 score = %d, want 100", player.TotalScore)
+			}
+		})
+	}
+}
+
+func TestGetPlayerLastActive(t *testing.T) {
+	env := newHandlerEnv(t, service.Options{})
+	env.router.POST("/game/rank/upscores", env.h.UpdateScore)
+	env.router.GET("/game/rank/user/:playerId/last-active", env.h.GetPlayerLastActive)
+	env.seed(t, "p1", "alice", 100)
+
+	lastActive := func(t *testing.T) time.Time {
+		t.Helper()
+		w := env.do(http.MethodGet, "/game/rank/user/p1/last-active", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		var resp LastActiveResponse
+		decode(t, w, &resp)
+		return resp.LastActive
+	}
+
+	seeded, _ := env.mysql.Player("p1")
+	if got := lastActive(t); !got.Equal(seeded.UpdatedAt) {
+		t.Fatalf("last active = %v, want the seeded %v", got, seeded.UpdatedAt)
+	}
+
+	before := time.Now().Truncate(time.Second)
+	if w := env.do(http.MethodPost, "/game/rank/upscores", `{"playerId": "p1", "incrScore": 5}`); w.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body %s", w.Code, w.Body)
+	}
+
+	got := lastActive(t)
+	if got.Before(before) || got.After(time.Now()) {
+		t.Fatalf("last active = %v, want the time of the update (after %v)", got, before)
+	}
+	updated, _ := env.mysql.Player("p1")
+	if !got.Equal(updated.UpdatedAt) {
+		t.Errorf("redis last active %v differs from mysql updated_at %v", got, updated.UpdatedAt)
+	}
+
+	t.Run("falls back to mysql", func(t *testing.T) {
+		env.redis.FailNext("GetPlayerLastActive", 1, nil)
+		if got := lastActive(t); !got.Equal(updated.UpdatedAt) {
+			t.Errorf("last active = %v, want mysql updated_at %v", got, updated.UpdatedAt)
+		}
+	})
+
+	t.Run("unknown player", func(t *testing.T) {
+		if w := env.do(http.MethodGet, "/game/rank/user/p9/last-active", ""); w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", w.Code)
+		}
+	})
+}
+
+func TestRankBase(t *testing.T) {
+	env := newHandlerEnv(t, service.Options{EnableCache: true, CacheSize: 10, CacheTTL: time.Minute})
+	env.router.GET("/game/rank/user/:playerId", env.h.GetPlayerRank)
+	env.router.GET("/game/rank/top/:n", env.h.GetTopN)
+	env.router.GET("/game/rank/range/:playerId/:range", env.h.GetPlayerRankRange)
+	env.router.POST("/game/rank/ranks", env.h.BatchGetPlayerRanks)
+	env.seed(t, "p1", "alice", 300)
+	env.seed(t, "p2", "bob", 200)
+	env.seed(t, "p3", "carol", 100)
+
+	// 读取 p2 在各接口中的名次
+	endpoints := []struct {
+		name string
+		rank func(t *testing.T, query string) int
+	}{
+		{"user", func(t *testing.T, query string) int {
+			var resp model.RankInfo
+			decode(t, env.do(http.MethodGet, "/game/rank/user/p2"+query, ""), &resp)
+			return resp.Rank
+		}},
+		{"top", func(t *testing.T, query string) int {
+			var resp struct{ Rankings []*model.RankInfo }
+			decode(t, env.do(http.MethodGet, "/game/rank/top/3"+query, ""), &resp)
+			return resp.Rankings[1].Rank
+		}},
+		{"range", func(t *testing.T, query string) int {
+			var resp struct{ Rankings []*model.RankInfo }
+			decode(t, env.do(http.MethodGet, "/game/rank/range/p2/3"+query, ""), &resp)
+			for _, rankInfo := range resp.Rankings {
+				if rankInfo.PlayerID == "p2" {
+					return rankInfo.Rank
+				}
+			}
+			t.Fatal("p2 missing from its own rank range")
+			return 0
+		}},
+		{"ranks", func(t *testing.T, query string) int {
+			var resp BatchRankResponse
+			decode(t, env.do(http.MethodPost, "/game/rank/ranks"+query, `{"playerIds": ["p2"]}`), &resp)
+			return resp.Ranks["p2"].Rank
+		}},
+	}
+
+	for _, endpoint := range endpoints {
+		t.Run(endpoint.name, func(t *testing.T) {
+			// 先按 0 起始读取，确认缓存中的名次没有被改写
+			for _, tc := range []struct {
+				query string
+				want  int
+			}{{"?base=0", 1}, {"", 2}, {"?base=1", 2}} {
+				if got := endpoint.rank(t, tc.query); got != tc.want {
+					t.Errorf("rank with %q = %d, want %d", tc.query, got, tc.want)
+				}
+			}
+		})
+	}
+
+	t.Run("invalid base", func(t *testing.T) {
+		for _, target := range []string{"/game/rank/user/p2?base=2", "/game/rank/top/3?base=-1", "/game/rank/range/p2/3?base=one"} {
+			if w := env.do(http.MethodGet, target, ""); w.Code != http.StatusBadRequest {
+				t.Errorf("GET %s status = %d, want 400", target, w.Code)
+			}
+		}
+	})
+}
+
+func TestSinglePlayerBoard(t *testing.T) {
+	env := newHandlerEnv(t, service.Options{EnableCache: true, CacheSize: 10, CacheTTL: time.Minute})
+	env.router.GET("/game/rank/user/:playerId", env.h.GetPlayerRank)
+	env.router.GET("/game/rank/user/:playerId/percentile", env.h.GetPlayerPercentile)
+	env.router.GET("/game/rank/top/:n", env.h.GetTopN)
+	env.router.GET("/game/rank/page", env.h.GetLeaderboardPage)
+	env.router.GET("/game/rank/score-at/:rank", env.h.GetScoreAtRank)
+	env.router.GET("/game/rank/rank-for-score/:score", env.h.GetRankForScore)
+	env.router.GET("/game/rank/range/:playerId/:range", env.h.GetPlayerRankRange)
+	env.router.POST("/game/rank/ranks", env.h.BatchGetPlayerRanks)
+	env.router.POST("/game/rank/among", env.h.GetRankingAmongPlayers)
+	env.seed(t, "p1", "alice", 100)
+
+	// 每个接口返回唯一玩家 p1 的名次
+	endpoints := []struct {
+		name string
+		rank func(t *testing.T, method string) int64
+	}{
+		{"user", func(t *testing.T, method string) int64 {
+			var resp model.RankInfo
+			decode(t, env.get(t, "/game/rank/user/p1?method="+method), &resp)
+			return int64(resp.Rank)
+		}},
+		{"percentile", func(t *testing.T, method string) int64 {
+			var resp model.PercentileInfo
+			decode(t, env.get(t, "/game/rank/user/p1/percentile?method="+method), &resp)
+			if resp.Total != 1 || resp.Percentile != 100 {
+				t.Errorf("percentile = %v of %d, want 100 of 1", resp.Percentile, resp.Total)
+			}
+			return resp.Rank
+		}},
+		{"top", func(t *testing.T, method string) int64 {
+			var resp struct{ Rankings []*model.RankInfo }
+			decode(t, env.get(t, "/game/rank/top/3?method="+method), &resp)
+			return onlyRank(t, resp.Rankings)
+		}},
+		{"page", func(t *testing.T, method string) int64 {
+			var resp struct {
+				Total    int64
+				Rankings []*model.RankInfo
+			}
+			decode(t, env.get(t, "/game/rank/page?offset=0&limit=10&method="+method), &resp)
+			if resp.Total != 1 {
+				t.Errorf("page total = %d, want 1", resp.Total)
+			}
+			return onlyRank(t, resp.Rankings)
+		}},
+		{"score-at", func(t *testing.T, method string) int64 {
+			var resp model.ScoreAtRankInfo
+			decode(t, env.get(t, "/game/rank/score-at/1?method="+method), &resp)
+			if resp.PlayerID != "p1" || resp.Score != 100 {
+				t.Errorf("score-at = %s %d, want p1 100", resp.PlayerID, resp.Score)
+			}
+			return resp.Rank
+		}},
+		{"rank-for-score", func(t *testing.T, method string) int64 {
+			var resp model.RankForScoreInfo
+			decode(t, env.get(t, "/game/rank/rank-for-score/100?method="+method), &resp)
+			if resp.Tied != 1 {
+				t.Errorf("rank-for-score tied = %d, want 1", resp.Tied)
+			}
+			return resp.Rank
+		}},
+		{"range", func(t *testing.T, method string) int64 {
+			var resp struct {
+				EffectiveRange int
+				Rankings       []*model.RankInfo
+			}
+			decode(t, env.get(t, "/game/rank/range/p1/5?method="+method), &resp)
+			if resp.EffectiveRange != 1 {
+				t.Errorf("range effectiveRange = %d, want 1", resp.EffectiveRange)
+			}
+			return onlyRank(t, resp.Rankings)
+		}},
+		{"ranks", func(t *testing.T, method string) int64 {
+			var resp BatchRankResponse
+			decode(t, env.post(t, "/game/rank/ranks?method="+method, `{"playerIds": ["p1"]}`), &resp)
+			return int64(resp.Ranks["p1"].Rank)
+		}},
+		{"among", func(t *testing.T, method string) int64 {
+			var resp AmongRankingResponse
+			decode(t, env.post(t, "/game/rank/among?method="+method, `{"playerIds": ["p1"]}`), &resp)
+			return onlyRank(t, resp.Rankings)
+		}},
+	}
+
+	for _, method := range []string{service.RankingStandard, service.RankingDense} {
+		for _, endpoint := range endpoints {
+			t.Run(method+"/"+endpoint.name, func(t *testing.T) {
+				if got := endpoint.rank(t, method); got != 1 {
+					t.Errorf("rank = %d, want 1", got)
+				}
+			})
+		}
+	}
+}
+
+func TestPlayerRankRangeLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{
+			name:       "top player gets the window below",
+			target:     "/game/rank/range/p1/5",
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"p1", "p2", "p3", "p4", "p5"},
+		},
+		{
+			name:       "last player gets the window above",
+			target:     "/game/rank/range/p8/5",
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"p4", "p5", "p6", "p7", "p8"},
+		},
+		{
+			name:       "second player with an even range",
+			target:     "/game/rank/range/p2/4",
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"p1", "p2", "p3", "p4"},
+		},
+		{
+			name:       "top player over the limit",
+			target:     "/game/rank/range/p1/6",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "last player far over the limit",
+			target:     "/game/rank/range/p8/1000",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	env := newHandlerEnv(t, service.Options{})
+	env.router.GET("/game/rank/range/:playerId/:range", env.h.GetPlayerRankRange)
+	for i := 1; i <= 8; i++ {
+		env.seed(t, fmt.Sprintf("p%d", i), fmt.Sprintf("player%d", i), int64(1000-i*10))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.do(http.MethodGet, tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp RankRangeResponse
+			var rankings []*model.RankInfo
+			resp.Rankings = &rankings
+			decode(t, w, &resp)
+			// 排行榜人数足够时窗口大小总是等于请求的范围
+			if resp.EffectiveRange != resp.Range || resp.Range != len(tt.wantIDs) {
+				t.Errorf("range = %d, effectiveRange = %d, want both %d", resp.Range, resp.EffectiveRange, len(tt.wantIDs))
+			}
+			var gotIDs []string
+			for _, rankInfo := range rankings {
+				gotIDs = append(gotIDs, rankInfo.PlayerID)
+			}
+			if fmt.Sprint(gotIDs) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("rankings = %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestRequestCounterConstLabels(t *testing.T) {
+	// metrics.Init 每个进程只能调用一次，并且会注册其他测试创建的缓存指标，因此在子进程中单独运行
+	if os.Getenv("METRICS_INIT_SUBPROCESS") == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestRequestCounterConstLabels$")
+		cmd.Env = append(os.Environ(), "METRICS_INIT_SUBPROCESS=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("subprocess failed: %v\n%s", err, out)
+		}
+		return
+	}
+
+	if err := metrics.Init(map[string]string{"game": "foo", "region": "us"}); err != nil {
+		t.Fatalf("metrics.Init() error = %v", err)
+	}
+
+	env := newHandlerEnv(t, service.Options{})
+	env.router.GET("/game/rank/user/:playerId", env.h.GetPlayerRank)
+	env.seed(t, "p1", "alice", 100)
+	env.get(t, "/game/rank/user/p1")
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	found := false
+	for _, family := range families {
+		if family.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			if labels["game"] != "foo" || labels["region"] != "us" {
+				t.Errorf("http_requests_total labels = %v, want game=foo and region=us", labels)
+			}
+			if labels["endpoint"] == "/rank/:playerId" && labels["status"] == "200" {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Error("http_requests_total has no sample for the request")
+	}
+}
+
+func TestGetScoreBuckets(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		wantStatus  int
+		wantBuckets []model.ScoreBucket
+	}{
+		{
+			name:       "default size",
+			target:     "/admin/score-buckets",
+			wantStatus: http.StatusOK,
+			wantBuckets: []model.ScoreBucket{
+				{MinScore: -100, MaxScore: -1, Count: 1},
+				{MinScore: 0, MaxScore: 99, Count: 3},
+				{MinScore: 100, MaxScore: 199, Count: 2},
+				{MinScore: 1200, MaxScore: 1299, Count: 1},
+			},
+		},
+		{
+			name:       "wide buckets",
+			target:     "/admin/score-buckets?size=1000",
+			wantStatus: http.StatusOK,
+			wantBuckets: []model.ScoreBucket{
+				{MinScore: -1000, MaxScore: -1, Count: 1},
+				{MinScore: 0, MaxScore: 999, Count: 5},
+				{MinScore: 1000, MaxScore: 1999, Count: 1},
+			},
+		},
+		{name: "zero size", target: "/admin/score-buckets?size=0", wantStatus: http.StatusBadRequest},
+		{name: "invalid size", target: "/admin/score-buckets?size=abc", wantStatus: http.StatusBadRequest},
+	}
+
+	env := newHandlerEnv(t, service.Options{})
+	env.router.GET("/admin/score-buckets", env.h.GetScoreBuckets)
+	// 只有 p1、p2 在排行榜上，其余玩家只存在于 MySQL
+	env.seed(t, "p1", "alice", 1250)
+	env.seed(t, "p2", "bob", 150)
+	for id, score := range map[string]int64{"p3": 100, "p4": 0, "p5": 50, "p6": 99, "p7": -5} {
+		env.mysql.AddPlayer(model.Player{ID: id, Name: id, TotalScore: score})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.do(http.MethodGet, tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp ScoreBucketsResponse
+			decode(t, w, &resp)
+			if resp.Total != 7 {
+				t.Errorf("total = %d, want 7", resp.Total)
+			}
+			if fmt.Sprint(resp.Buckets) != fmt.Sprint(tt.wantBuckets) {
+				t.Errorf("buckets = %v, want %v", resp.Buckets, tt.wantBuckets)
+			}
+		})
+	}
+
+	t.Run("too many buckets", func(t *testing.T) {
+		env := newHandlerEnv(t, service.Options{})
+		env.router.GET("/admin/score-buckets", env.h.GetScoreBuckets)
+		for i := 0; i <= 10000; i++ {
+			env.mysql.AddPlayer(model.Player{ID: fmt.Sprintf("p%d", i), TotalScore: int64(i)})
+		}
+
+		if w := env.do(http.MethodGet, "/admin/score-buckets?size=1", ""); w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+		if w := env.do(http.MethodGet, "/admin/score-buckets?size=2", ""); w.Code != http.StatusOK {
+			t.Errorf("status = %d, want 200", w.Code)
+		}
+	})
+}
+
+// GET 请求，状态码不是 200 时测试失败
+func (e *handlerEnv) get(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	return e.expectOK(t, http.MethodGet, target, "")
+}
+
+// POST 请求，状态码不是 200 时测试失败
+func (e *handlerEnv) post(t *testing.T, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return e.expectOK(t, http.MethodPost, target, body)
+}
+
+func (e *handlerEnv) expectOK(t *testing.T, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := e.do(method, target, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s %s status = %d, want 200: %s", method, target, w.Code, w.Body.String())
+	}
+	return w
+}
+
+// 排名列表只有 p1 一条时返回其名次
+func onlyRank(t *testing.T, rankings []*model.RankInfo) int64 {
+	t.Helper()
+
+	if len(rankings) != 1 || rankings[0].PlayerID != "p1" {
+		t.Fatalf("rankings = %d entries, want only p1", len(rankings))
+	}
+	return int64(rankings[0].Rank)
+}
+
+func TestGetTopNZero(t *testing.T) {
+	env := newHandlerEnv(t, service.Options{})
+	env.router.GET("/game/rank/top/:n", env.h.GetTopN)
+	env.seed(t, "p1", "alice", 300)
+	env.seed(t, "p2", "bob", 200)
+	env.seed(t, "p3", "carol", 100)
+
+	var resp struct {
+		Count    int
+		Rankings []*model.RankInfo
+		Size     *int64
+	}
+	w := env.get(t, "/game/rank/top/0")
+	decode(t, w, &resp)
+	if resp.Count != 0 || resp.Rankings == nil || len(resp.Rankings) != 0 {
+		t.Errorf("n=0 returned count %d rankings %s, want an empty list", resp.Count, w.Body.String())
+	}
+	if resp.Size == nil || *resp.Size != 3 {
+		t.Errorf("n=0 size = %v, want 3", resp.Size)
+	}
+
+	// 普通查询不返回排行榜人数
+	var top struct{ Size *int64 }
+	decode(t, env.get(t, "/game/rank/top/2"), &top)
+	if top.Size != nil {
+		t.Errorf("n=2 size = %d, want omitted", *top.Size)
+	}
+
+	for _, n := range []string{"-1", "abc", "1.5"} {
+		if w := env.do(http.MethodGet, "/game/rank/top/"+n, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /top/%s status = %d, want 400", n, w.Code)
+		}
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	env := newHandlerEnv(t, service.Options{EnableCache: true, CacheSize: 10, CacheTTL: time.Minute})
+	env.router.POST("/game/rank/upscores", env.h.UpdateScore)
+	env.router.GET("/game/rank/top/:n", env.h.GetTopN)
+	env.router.GET("/admin/blocklist", env.h.GetBlockedPlayers)
+	env.router.POST("/admin/blocklist", env.h.BlockPlayers)
+	env.router.DELETE("/admin/blocklist/:playerId", env.h.UnblockPlayer)
+	env.seed(t, "p1", "alice", 300)
+	env.seed(t, "p2", "bob", 200)
+
+	topIDs := func(t *testing.T) string {
+		var resp struct{ Rankings []*model.RankInfo }
+		decode(t, env.get(t, "/game/rank/top/3"), &resp)
+		ids := make([]string, 0, len(resp.Rankings))
+		for _, rankInfo := range resp.Rankings {
+			ids = append(ids, rankInfo.PlayerID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	// 预热前N名缓存，封禁后应失效
+	if got := topIDs(t); got != "p1,p2" {
+		t.Fatalf("top before block = %s, want p1,p2", got)
+	}
+
+	env.post(t, "/admin/blocklist", `{"playerIds": ["p1"]}`)
+	var blocked BlocklistResponse
+	decode(t, env.get(t, "/admin/blocklist"), &blocked)
+	if blocked.Count != 1 || blocked.PlayerIDs[0] != "p1" {
+		t.Errorf("blocklist = %v, want [p1]", blocked.PlayerIDs)
+	}
+	if got := topIDs(t); got != "p2" {
+		t.Errorf("top after block = %s, want p2", got)
+	}
+
+	// 封禁期间的更新只写入 MySQL
+	env.post(t, "/game/rank/upscores", `{"playerId": "p1", "incrScore": 1000, "name": "alice"}`)
+	if got := topIDs(t); got != "p2" {
+		t.Errorf("top after blocked update = %s, want p2", got)
+	}
+	if player, _ := env.mysql.Player("p1"); player.TotalScore != 1300 {
+		t.Errorf("blocked player mysql score = %d, want 1300", player.TotalScore)
+	}
+	if _, ok := env.redis.Score("p1"); ok {
+		t.Error("blocked player written to redis")
+	}
+
+	// 解除封禁后以 MySQL 中的总分回到排行榜
+	if w := env.do(http.MethodDelete, "/admin/blocklist/p1", ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE /admin/blocklist/p1 status = %d, want 200", w.Code)
+	}
+	if got := topIDs(t); got != "p1,p2" {
+		t.Errorf("top after unblock = %s, want p1,p2", got)
+	}
+	if score, _ := env.redis.Score("p1"); score != 1300 {
+		t.Errorf("unblocked player redis score = %d, want 1300", score)
+	}
+}
+
+func TestRankFields(t *testing.T) {
+	env := newHandlerEnv(t, service.Options{})
+	env.router.GET("/game/rank/user/:playerId", env.h.GetPlayerRank)
+	env.router.GET("/game/rank/top/:n", env.h.GetTopN)
+	env.router.GET("/game/rank/range/:playerId/:range", env.h.GetPlayerRankRange)
+	env.router.GET("/game/rank/page", env.h.GetLeaderboardPage)
+	env.seed(t, "p1", "alice", 300)
+	env.seed(t, "p2", "bob", 200)
+
+	// 各接口返回的 RankInfo 对象（原始 JSON）
+	endpoints := []struct {
+		name    string
+		target  string
+		entries func(t *testing.T, w *httptest.ResponseRecorder) []map[string]json.RawMessage
+	}{
+		{"user", "/game/rank/user/p2", func(t *testing.T, w *httptest.ResponseRecorder) []map[string]json.RawMessage {
+			var resp map[string]json.RawMessage
+			decode(t, w, &resp)
+			return []map[string]json.RawMessage{resp}
+		}},
+		{"top", "/game/rank/top/2", rankingsField},
+		{"range", "/game/rank/range/p2/2", rankingsField},
+		{"page", "/game/rank/page?offset=0&limit=2", rankingsField},
+	}
+
+	for _, endpoint := range endpoints {
+		t.Run(endpoint.name, func(t *testing.T) {
+			sep := "?"
+			if strings.Contains(endpoint.target, "?") {
+				sep = "&"
+			}
+
+			entries := endpoint.entries(t, env.get(t, endpoint.target+sep+"fields=playerId,%20rank"))
+			if len(entries) == 0 {
+				t.Fatal("no rank entries returned")
+			}
+			for _, entry := range entries {
+				if len(entry) != 2 || entry["playerId"] == nil || entry["rank"] == nil {
+					t.Errorf("entry fields = %v, want only playerId and rank", keys(entry))
+				}
+			}
+
+			// 未指定 fields 时返回全部字段
+			for _, entry := range endpoint.entries(t, env.get(t, endpoint.target)) {
+				if entry["name"] == nil || entry["score"] == nil {
+					t.Errorf("entry fields without filter = %v, want name and score included", keys(entry))
+				}
+			}
+
+			if w := env.do(http.MethodGet, endpoint.target+sep+"fields=playerId,percentile", ""); w.Code != http.StatusBadRequest {
+				t.Errorf("unknown field status = %d, want 400", w.Code)
+			}
+		})
+	}
+}
+
+// 响应中 rankings 数组的各项
+func rankingsField(t *testing.T, w *httptest.ResponseRecorder) []map[string]json.RawMessage {
+	t.Helper()
+
+	var resp struct{ Rankings []map[string]json.RawMessage }
+	decode(t, w, &resp)
+	return resp.Rankings
+}
+
+// 按字母顺序返回 JSON 对象的字段名
+func keys(m map[string]json.RawMessage) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRankingMethodParam(t *testing.T) {
+	env := newHandlerEnv(t, service.Options{RankingMethod: service.RankingStandard, EnableCache: true, CacheSize: 10, CacheTTL: time.Minute})
+	env.router.GET("/game/rank/user/:playerId", env.h.GetPlayerRank)
+	env.router.GET("/game/rank/top/:n", env.h.GetTopN)
+	env.seed(t, "p1", "alice", 300)
+	env.seed(t, "p2", "bob", 300)
+	env.seed(t, "p3", "carol", 200)
+
+	userRank := func(t *testing.T, query string) int {
+		var resp model.RankInfo
+		decode(t, env.get(t, "/game/rank/user/p3"+query), &resp)
+		return resp.Rank
+	}
+	topRank := func(t *testing.T, query string) int {
+		var resp struct{ Rankings []*model.RankInfo }
+		decode(t, env.get(t, "/game/rank/top/3"+query), &resp)
+		return resp.Rankings[2].Rank
+	}
+
+	// 交替请求两种排名方式，缓存中的结果互不影响
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"", 3},
+		{"?method=dense", 2},
+		{"?method=standard", 3},
+		{"", 3},
+		{"?method=dense", 2},
+	} {
+		if got := userRank(t, tc.query); got != tc.want {
+			t.Errorf("user rank with %q = %d, want %d", tc.query, got, tc.want)
+		}
+		if got := topRank(t, tc.query); got != tc.want {
+			t.Errorf("top rank with %q = %d, want %d", tc.query, got, tc.want)
+		}
+	}
+
+	for _, target := range []string{"/game/rank/user/p3?method=ordinal", "/game/rank/top/3?method=DENSE"} {
+		if w := env.do(http.MethodGet, target, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want 400", target, w.Code)
+		}
+	}
+}
+
+func TestReadinessErrorRate(t *testing.T) {
+	env := newHandlerEnv(t, service.Options{})
+	tracker := middleware.NewErrorRateTracker(time.Minute)
+	env.h.SetErrorRateCheck(tracker, 50, 4)
+	env.router.Use(tracker.Middleware("/game/rank/ready"))
+	env.router.GET("/game/rank/ready", env.h.ReadinessCheck)
+	env.router.GET("/game/rank/user/:playerId", env.h.GetPlayerRank)
+	env.seed(t, "p1", "alice", 100)
+
+	ready := func(t *testing.T) (int, ReadinessResponse) {
+		var resp ReadinessResponse
+		w := env.do(http.MethodGet, "/game/rank/ready", "")
+		decode(t, w, &resp)
+		return w.Code, resp
+	}
+
+	// 请求数不足 minRequests 时不因错误率降级
+	env.redis.FailNext("GetPlayerRankAndScore", 3, nil)
+	for i := 0; i < 3; i++ {
+		if w := env.do(http.MethodGet, "/game/rank/user/p1", ""); w.Code != http.StatusInternalServerError {
+			t.Fatalf("forced failure status = %d, want 500", w.Code)
+		}
+	}
+	if code, resp := ready(t); code != http.StatusOK || resp.Status != "ready" {
+		t.Errorf("readiness with 3 requests = %d %s, want 200 ready", code, resp.Status)
+	}
+
+	// 4 次请求中 3 次 5xx，超过 50%
+	env.get(t, "/game/rank/user/p1")
+	code, resp := ready(t)
+	if code != http.StatusServiceUnavailable || resp.Status != "degraded" {
+		t.Errorf("readiness at 75%% errors = %d %s, want 503 degraded", code, resp.Status)
+	}
+	if resp.ErrorRate == nil || resp.ErrorRate.Requests != 4 || resp.ErrorRate.Percent != 75 {
+		t.Errorf("errorRate = %+v, want 4 requests at 75%%", resp.ErrorRate)
+	}
+
+	// 就绪检查本身不计入，成功请求将错误率拉回阈值以下
+	for i := 0; i < 2; i++ {
+		env.get(t, "/game/rank/user/p1")
+	}
+	if code, resp := ready(t); code != http.StatusOK || resp.ErrorRate.Requests != 6 || resp.ErrorRate.Percent != 50 {
+		t.Errorf("readiness at 50%% errors = %d %+v, want 200 with 6 requests", code, resp.ErrorRate)
+	}
+}
+
+func TestExportLeaderboardGzip(t *testing.T) {
+	env := newHandlerEnv(t, service.Options{})
+	env.router.GET("/admin/export", env.h.ExportLeaderboard)
+	env.seed(t, "p1", "alice", 300)
+	env.seed(t, "p2", "bob", 200)
+	env.seed(t, "p3", "carol", 100)
+
+	tests := []struct {
+		query       string
+		contentType string
+		extension   string
+		parse       func(t *testing.T, body []byte) []string
+	}{
+		{
+			query:       "format=json&compress=gzip",
+			contentType: "application/json",
+			extension:   ".json",
+			parse: func(t *testing.T, body []byte) []string {
+				var rankings []*model.RankInfo
+				if err := json.Unmarshal(body, &rankings); err != nil {
+					t.Fatalf("decode export %q: %v", body, err)
+				}
+				ids := make([]string, 0, len(rankings))
+				for _, rankInfo := range rankings {
+					ids = append(ids, fmt.Sprintf("%s:%d:%s", rankInfo.PlayerID, rankInfo.Rank, rankInfo.Name))
+				}
+				return ids
+			},
+		},
+		{
+			query:       "format=csv&compress=gzip",
+			contentType: "text/csv; charset=utf-8",
+			extension:   ".csv",
+			parse: func(t *testing.T, body []byte) []string {
+				records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+				if err != nil {
+					t.Fatalf("decode export %q: %v", body, err)
+				}
+				ids := make([]string, 0, len(records))
+				for _, record := range records[1:] {
+					ids = append(ids, record[0]+":"+record[3]+":"+record[1])
+				}
+				return ids
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := env.get(t, "/admin/export?"+tt.query)
+			if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+				t.Errorf("Content-Encoding = %q, want gzip", got)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, `attachment; filename="leaderboard-`) || !strings.HasSuffix(got, tt.extension+`"`) {
+				t.Errorf("Content-Disposition = %q, want a %s attachment", got, tt.extension)
+			}
+			if !w.Flushed {
+				t.Error("export was not flushed while streaming")
+			}
+
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("gzip.NewReader() error = %v", err)
+			}
+			body, err := io.ReadAll(gz)
+			if err != nil {
+				t.Fatalf("decompress export: %v", err)
+			}
+
+			want := "[p1:1:alice p2:2:bob p3:3:carol]"
+			if got := fmt.Sprint(tt.parse(t, body)); got != want {
+				t.Errorf("export = %s, want %s", got, want)
+			}
+		})
+	}
+
+	if w := env.do(http.MethodGet, "/admin/export?compress=zstd", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported compression status = %d, want 400", w.Code)
+	}
+}
+
+func TestGetPlayerProfile(t *testing.T) {
+	env := newHandlerEnv(t, service.Options{})
+	env.router.GET("/game/rank/user/:playerId/profile", env.h.GetPlayerProfile)
+	env.seed(t, "p1", "alice", 300)
+	env.seed(t, "p2", "bob", 200)
+	env.seed(t, "p3", "carol", 100)
+	// 只在排行榜上，MySQL 中没有记录
+	if err := env.redis.UpdatePlayerScore(context.Background(), "p4", 50, "dave", time.Now()); err != nil {
+		t.Fatalf("seed p4: %v", err)
+	}
+	// 只在 MySQL 中，未上榜
+	env.mysql.AddPlayer(model.Player{ID: "p5", Name: "erin", TotalScore: 0})
+
+	profile := func(t *testing.T, playerID string) model.PlayerProfile {
+		var resp model.PlayerProfile
+		decode(t, env.get(t, "/game/rank/user/"+playerID+"/profile"), &resp)
+		return resp
+	}
+
+	t.Run("ranked with player row", func(t *testing.T) {
+		got := profile(t, "p2")
+		if got.Rank == nil || got.Rank.Rank != 2 || got.Rank.Score != 200 {
+			t.Fatalf("rank = %+v, want rank 2 score 200", got.Rank)
+		}
+		if got.Player == nil || got.Player.Name != "bob" || got.Player.TotalScore != 200 || got.Player.CreatedAt.IsZero() {
+			t.Errorf("player = %+v, want bob with total 200 and created_at", got.Player)
+		}
+		if got.Percentile == nil || got.Percentile.Total != 4 {
+			t.Errorf("percentile = %+v, want board of 4", got.Percentile)
+		}
+		if len(got.Neighbors) != 4 || len(got.Unavailable) != 0 {
+			t.Errorf("neighbors = %d unavailable = %v, want 4 neighbors and no failures", len(got.Neighbors), got.Unavailable)
+		}
+	})
+
+	t.Run("ranked without player row", func(t *testing.T) {
+		got := profile(t, "p4")
+		if got.Rank == nil || got.Rank.Rank != 4 {
+			t.Errorf("rank = %+v, want rank 4", got.Rank)
+		}
+		if got.Player != nil {
+			t.Errorf("player = %+v, want null", got.Player)
+		}
+	})
+
+	t.Run("player row without rank", func(t *testing.T) {
+		got := profile(t, "p5")
+		if got.Rank != nil || got.Player == nil || got.Player.Name != "erin" {
+			t.Errorf("profile = rank %+v player %+v, want no rank and erin", got.Rank, got.Player)
+		}
+	})
+
+	t.Run("failed part is reported", func(t *testing.T) {
+		env.mysql.FailNext("GetScoreHistory", 1, nil)
+		got := profile(t, "p1")
+		if got.Rank == nil || got.Rank.Rank != 1 || fmt.Sprint(got.Unavailable) != "[history]" {
+			t.Errorf("profile = rank %+v unavailable %v, want rank 1 and [history]", got.Rank, got.Unavailable)
+		}
+	})
+
+	t.Run("unknown player", func(t *testing.T) {
+		if w := env.do(http.MethodGet, "/game/rank/user/ghost/profile", ""); w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", w.Code)
+		}
+	})
+}
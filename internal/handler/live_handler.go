@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"game-leaderboard/internal/metrics"
+	"game-leaderboard/internal/service"
+	"game-leaderboard/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// 单条消息的写超时，超时视为客户端已断开
+	liveWriteTimeout = 10 * time.Second
+	// 服务端每隔 livePingInterval 发送 ping，超过 livePongTimeout 没有收到 pong 或其他消息时视为客户端已断开
+	livePingInterval = 30 * time.Second
+	livePongTimeout  = 60 * time.Second
+	// 客户端无需发送数据，只接受控制消息大小的消息，超过时断开连接
+	liveMaxMessageSize = 512
+)
+
+var liveConnections = promauto.With(metrics.Registerer).NewGauge(prometheus.GaugeOpts{
+	Name: "live_connections",
+	Help: "Number of connected live top-n WebSocket and player rank stream clients",
+})
+
+// LiveErrorMessage 订阅失败时发送给客户端的消息
+type LiveErrorMessage struct {
+	Type    string `json:"type"` // 固定为 error
+	Message string `json:"message"`
+}
+
+type LiveHandler struct {
+	leaderboardService *service.LeaderboardService
+	logger             *logger.Logger
+	maxConnections     int64
+	connections        atomic.Int64
+	streamIdleTimeout  time.Duration
+	allowedOrigins     []string
+	upgrader           websocket.Upgrader
+	pingInterval       time.Duration
+	pongTimeout        time.Duration
+}
+
+// NewLiveHandler allowedOrigins 为允许建立 WebSocket 连接的页面来源，见 config.LiveAllowedOrigins
+func NewLiveHandler(leaderboardService *service.LeaderboardService, maxConnections int, streamIdleTimeout time.Duration, allowedOrigins []string) *LiveHandler {
+	h := &LiveHandler{
+		leaderboardService: leaderboardService,
+		logger:             logger.NewLogger("live_handler"),
+		maxConnections:     int64(maxConnections),
+		streamIdleTimeout:  streamIdleTimeout,
+		allowedOrigins:     allowedOrigins,
+		pingInterval:       livePingInterval,
+		pongTimeout:        livePongTimeout,
+	}
+	h.upgrader = websocket.Upgrader{
+		HandshakeTimeout: liveWriteTimeout,
+		CheckOrigin:      h.checkOrigin,
+	}
+	return h
+}
+
+// 校验 WebSocket 握手的 Origin：不带 Origin 的非浏览器客户端、与服务同源的页面和 allowedOrigins 中的来源允许连接
+func (h *LiveHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range h.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// 占用一个实时连接名额，已满时返回 false
+func (h *LiveHandler) acquire() bool {
+	if h.connections.Add(1) > h.maxConnections {
+		h.connections.Add(-1)
+		return false
+	}
+	liveConnections.Inc()
+	return true
+}
+
+func (h *LiveHandler) release() {
+	h.connections.Add(-1)
+	liveConnections.Dec()
+}
+
+func tooManyConnections(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+		Error:   "Too many connections",
+		Message: "The live leaderboard has reached its connection limit, please retry later",
+	})
+}
+
+// Live 实时前N名
+// @Summary 实时前N名
+// @Description WebSocket 接口，连接后先推送当前前N名（type=snapshot），之后前N名变化时推送 type=delta 消息；服务端定期发送 ping，客户端需回复 pong
+// @Tags ranks
+// @Success 101 {object} model.TopNUpdate "切换到 WebSocket"
+// @Failure 403 {object} ErrorResponse "页面来源不允许连接"
+// @Failure 503 {object} ErrorResponse "连接数已满"
+// @Router /live [get]
+func (h *LiveHandler) Live(c *gin.Context) {
+	start := time.Now()
+
+	if !h.acquire() {
+		recordRequestMetrics("GET", "/live", "503", start)
+		tooManyConnections(c)
+		return
+	}
+	defer h.release()
+
+	log := h.logger.WithContext(c.Request.Context())
+
+	// 握手失败时 Upgrade 已写入错误响应（来源不允许时为 403）
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		recordRequestMetrics("GET", "/live", strconv.Itoa(c.Writer.Status()), start)
+		log.Debug("Live websocket handshake failed", "origin", c.Request.Header.Get("Origin"), "error", err)
+		return
+	}
+	defer conn.Close()
+
+	recordRequestMetrics("GET", "/live", "101", start)
+	h.stream(conn, log)
+}
+
+// 推送快照和后续变更，直到客户端断开、心跳超时或服务关闭
+func (h *LiveHandler) stream(conn *websocket.Conn, log *logger.Logger) {
+	// 连接被接管后请求 context 不再反映连接状态，由读循环检测客户端断开
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	snapshot, updates, unsubscribe, err := h.leaderboardService.SubscribeTopN(ctx)
+	if err != nil {
+		log.Warn("Failed to subscribe live top-n", "error", err)
+		h.send(conn, LiveErrorMessage{Type: "error", Message: err.Error()})
+		return
+	}
+	defer unsubscribe()
+
+	conn.SetReadLimit(liveMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(h.pongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.pongTimeout))
+	})
+
+	go func() {
+		defer cancel()
+		// 客户端无需发送数据，读取用于处理 pong 和关闭消息、发现断开和心跳超时
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := h.send(conn, snapshot); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(h.pingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteTimeout)); err != nil {
+				log.Debug("Live client ping failed", "error", err)
+				return
+			}
+		case update, ok := <-updates:
+			if !ok {
+				// 服务关闭
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, ""),
+					time.Now().Add(liveWriteTimeout))
+				return
+			}
+			if err := h.send(conn, update); err != nil {
+				log.Debug("Live client write failed", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// 写入一条 JSON 消息，gorilla/websocket 不支持并发写，只在 stream 的写循环中调用
+func (h *LiveHandler) send(conn *websocket.Conn, message interface{}) error {
+	conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+	return conn.WriteJSON(message)
+}
+
+// PlayerStream 玩家排名变化
+// @Summary 玩家排名变化
+// @Description Server-Sent Events 接口，连接后先推送玩家当前排名，之后排名或分数变化时推送 rank 事件；rank 为 0 表示玩家不在榜上。超过空闲时长没有更新时服务端关闭连接，客户端可重新连接
+// @Tags ranks
+// @Produce text/event-stream
+// @Param playerId path string true "玩家ID"
+// @Success 200 {object} model.RankInfo "rank 事件的数据"
+// @Failure 400 {object} ErrorResponse "请求参数错误"
+// @Failure 503 {object} ErrorResponse "连接数已满"
+// @Router /user/{playerId}/stream [get]
+func (h *LiveHandler) PlayerStream(c *gin.Context) {
+	start := time.Now()
+
+	playerID := c.Param("playerId")
+	if playerID == "" {
+		recordRequestMetrics("GET", "/user/:playerId/stream", "400", start)
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "PlayerID is required",
+			Message: "PlayerID parameter cannot be empty",
+		})
+		return
+	}
+
+	if !h.acquire() {
+		recordRequestMetrics("GET", "/user/:playerId/stream", "503", start)
+		tooManyConnections(c)
+		return
+	}
+	defer h.release()
+
+	log := h.logger.WithContext(c.Request.Context())
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	updates, err := h.leaderboardService.WatchPlayerRank(ctx, playerID)
+	if err != nil {
+		recordRequestMetrics("GET", "/user/:playerId/stream", "500", start)
+		log.Error("Failed to watch player rank", "playerID", playerID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to watch player rank",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// 流式响应不受服务器 WriteTimeout 限制，由空闲超时和客户端断开结束
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn("Failed to clear write deadline for player stream", "error", err)
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	defer recordRequestMetrics("GET", "/user/:playerId/stream", "200", start)
+
+	idle := time.NewTimer(h.streamIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-idle.C:
+			return
+		case rankInfo, ok := <-updates:
+			if !ok {
+				return
+			}
+			if err := writeEvent(c.Writer, "rank", rankInfo); err != nil {
+				log.Debug("Player stream write failed", "playerID", playerID, "error", err)
+				return
+			}
+			idle.Reset(h.streamIdleTimeout)
+		}
+	}
+}
+
+// 写入一条 SSE 事件并立即发送
+func writeEvent(w gin.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
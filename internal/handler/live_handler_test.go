@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestLiveCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{name: "no origin header", origin: "", want: true},
+		{name: "same origin", origin: "http://leaderboard.example.com", want: true},
+		{name: "cross origin", origin: "https://evil.example.com", want: false},
+		{name: "allowed origin", origin: "https://game.example.com", allowed: []string{"https://game.example.com"}, want: true},
+		{name: "allow all", origin: "https://evil.example.com", allowed: []string{"*"}, want: true},
+		{name: "malformed origin", origin: "://", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewLiveHandler(nil, 1, time.Minute, tt.allowed)
+			req := httptest.NewRequest(http.MethodGet, "http://leaderboard.example.com/api/v1/live", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if got := h.checkOrigin(req); got != tt.want {
+				t.Errorf("checkOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiveWebSocket(t *testing.T) {
+	// 启动 WebSocket 服务，返回连接地址和 handler；心跳间隔缩短以便测试超时
+	newServer := func(t *testing.T) (string, *LiveHandler) {
+		t.Helper()
+		env := newHandlerEnv(t, service.Options{LiveTopN: 3})
+		env.seed(t, "p1", "alice", 100)
+
+		h := NewLiveHandler(env.svc, 10, time.Minute, nil)
+		h.pingInterval = 10 * time.Millisecond
+		h.pongTimeout = 100 * time.Millisecond
+		router := gin.New()
+		router.GET("/live", h.Live)
+		server := httptest.NewServer(router)
+		t.Cleanup(server.Close)
+		return "ws" + strings.TrimPrefix(server.URL, "http") + "/live", h
+	}
+
+	dial := func(t *testing.T, url string, header http.Header) *websocket.Conn {
+		t.Helper()
+		conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if err != nil {
+			t.Fatalf("Dial() error = %v (response %v)", err, resp)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		var snapshot model.TopNUpdate
+		if err := conn.ReadJSON(&snapshot); err != nil {
+			t.Fatalf("read snapshot: %v", err)
+		}
+		if snapshot.Type != "snapshot" {
+			t.Fatalf("first message type = %q, want snapshot", snapshot.Type)
+		}
+		return conn
+	}
+
+	// 读取直到连接被关闭，超时测试失败
+	waitClosed := func(t *testing.T, conn *websocket.Conn) error {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+					t.Fatal("connection still open, want it closed by the server")
+				}
+				return err
+			}
+		}
+	}
+
+	t.Run("cross origin handshake is rejected", func(t *testing.T) {
+		url, _ := newServer(t)
+		_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}})
+		if err == nil {
+			t.Fatal("Dial() error = nil, want a rejected handshake")
+		}
+		if resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Errorf("handshake response = %v, want 403", resp)
+		}
+	})
+
+	t.Run("client answering pings stays connected", func(t *testing.T) {
+		url, h := newServer(t)
+		conn := dial(t, url, nil)
+
+		// 默认的 ping 处理会回复 pong，超过 pongTimeout 后连接仍保持
+		pings := make(chan struct{}, 100)
+		conn.SetPingHandler(func(data string) error {
+			pings <- struct{}{}
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		})
+		conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		_, _, err := conn.ReadMessage()
+		if netErr, ok := err.(interface{ Timeout() bool }); !ok || !netErr.Timeout() {
+			t.Fatalf("ReadMessage() error = %v, want a client-side timeout with the connection open", err)
+		}
+		if len(pings) < 2 {
+			t.Errorf("received %d pings, want periodic pings", len(pings))
+		}
+		if got := h.connections.Load(); got != 1 {
+			t.Errorf("open connections = %d, want 1", got)
+		}
+	})
+
+	t.Run("client not answering pings is disconnected", func(t *testing.T) {
+		url, _ := newServer(t)
+		conn := dial(t, url, nil)
+
+		conn.SetPingHandler(func(string) error { return nil })
+		waitClosed(t, conn)
+	})
+
+	t.Run("oversized client message closes the connection", func(t *testing.T) {
+		url, _ := newServer(t)
+		conn := dial(t, url, nil)
+
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", liveMaxMessageSize+1))); err != nil {
+			t.Fatalf("WriteMessage() error = %v", err)
+		}
+		err := waitClosed(t, conn)
+		if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+			t.Errorf("close error = %v, want %d", err, websocket.CloseMessageTooBig)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// 校验错误中的字段名使用 JSON 字段名，与客户端提交的请求体一致
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// bindJSON 解析并校验 JSON 请求体，失败时返回可直接响应的 ErrorResponse
+// 校验规则来自 binding 标签，字段级错误写入 Fields（字段路径 -> 未通过的规则，如 "updates[0].playerId": "required"）
+func bindJSON(c *gin.Context, obj interface{}) *ErrorResponse {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return nil
+	}
+
+	resp := &ErrorResponse{
+		Error:   "Invalid request body",
+		Message: err.Error(),
+	}
+
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		resp.Error = "Validation failed"
+		resp.Fields = make(map[string]string, len(validationErrs))
+		for _, fe := range validationErrs {
+			rule := fe.Tag()
+			if fe.Param() != "" {
+				rule += "=" + fe.Param()
+			}
+			resp.Fields[fieldPath(fe.Namespace())] = rule
+		}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		resp.Fields = map[string]string{typeErr.Field: "type:" + typeErr.Type.String()}
+	}
+
+	return resp
+}
+
+// 去掉校验错误命名空间中的顶层结构体名，如 BatchUpdateRequest.updates[0].playerId -> updates[0].playerId
+func fieldPath(namespace string) string {
+	if i := strings.IndexByte(namespace, '.'); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
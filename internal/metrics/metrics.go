@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry 服务暴露的指标注册表
+var Registry = prometheus.NewRegistry()
+
+// Registerer 应用指标使用的注册器，配合 promauto.With 使用
+// 包初始化时配置尚未加载，Init 之前注册的指标先暂存，Init 时带上常量标签注册到 Registry
+var Registerer prometheus.Registerer = deferred
+
+var deferred = &deferredRegisterer{}
+
+type deferredRegisterer struct {
+	mu      sync.Mutex
+	target  prometheus.Registerer // Init 之后非空
+	pending []prometheus.Collector
+}
+
+func (d *deferredRegisterer) Register(c prometheus.Collector) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.target != nil {
+		return d.target.Register(c)
+	}
+	d.pending = append(d.pending, c)
+	return nil
+}
+
+func (d *deferredRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := d.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (d *deferredRegisterer) Unregister(c prometheus.Collector) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.target != nil {
+		return d.target.Unregister(c)
+	}
+	for i, pending := range d.pending {
+		if pending == c {
+			d.pending = append(d.pending[:i], d.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Init 为所有指标（包括 Go 运行时和进程指标）加上常量标签并完成注册，只应调用一次
+// 常量标签与指标自身的标签重名时返回错误
+func Init(constLabels map[string]string) error {
+	deferred.mu.Lock()
+	defer deferred.mu.Unlock()
+
+	target := prometheus.WrapRegistererWith(prometheus.Labels(constLabels), Registry)
+
+	toRegister := append([]prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	}, deferred.pending...)
+	for _, c := range toRegister {
+		if err := target.Register(c); err != nil {
+			return err
+		}
+	}
+
+	deferred.target = target
+	deferred.pending = nil
+	return nil
+}
+
+// Handler 返回暴露 Registry 中指标的 HTTP 处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader 管理接口的 API Key 请求头，也可以使用 Authorization: Bearer <key>
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuth 校验管理接口的 API Key：未携带返回 401，不匹配返回 403；
+// keys 为空时所有请求均返回 403，避免未配置密钥时管理接口对外开放
+func APIKeyAuth(keys []string) gin.HandlerFunc {
+	validKeys := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if key != "" {
+			validKeys = append(validKeys, []byte(key))
+		}
+	}
+
+	return func(c *gin.Context) {
+		provided := requestAPIKey(c)
+		if provided == "" {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "API key is required",
+			})
+			return
+		}
+
+		if !matchAPIKey(validKeys, []byte(provided)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "Invalid API key",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// 从 X-API-Key 或 Authorization: Bearer 中读取 API Key
+func requestAPIKey(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+
+	auth := c.GetHeader("Authorization")
+	if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// 逐个以常量时间比较所有密钥，不因匹配提前返回
+func matchAPIKey(validKeys [][]byte, provided []byte) bool {
+	matched := 0
+	for _, key := range validKeys {
+		matched |= subtle.ConstantTimeCompare(key, provided)
+	}
+	return matched == 1
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorRateBucket 一秒内的请求数和 5xx 数
+type errorRateBucket struct {
+	second int64
+	total  int
+	errors int
+}
+
+// ErrorRateTracker 按秒分桶统计最近一个窗口内的 5xx 比例，供就绪检查使用
+type ErrorRateTracker struct {
+	mu      sync.Mutex
+	buckets []errorRateBucket
+}
+
+// NewErrorRateTracker 创建错误率统计，window 按秒取整，至少 1 秒
+func NewErrorRateTracker(window time.Duration) *ErrorRateTracker {
+	seconds := int(window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &ErrorRateTracker{
+		buckets: make([]errorRateBucket, seconds),
+	}
+}
+
+// Record 记录一次请求的响应状态码
+func (t *ErrorRateTracker) Record(status int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now().Unix()
+	bucket := &t.buckets[now%int64(len(t.buckets))]
+	if bucket.second != now {
+		*bucket = errorRateBucket{second: now}
+	}
+
+	bucket.total++
+	if status >= http.StatusInternalServerError {
+		bucket.errors++
+	}
+}
+
+// Rate 返回窗口内的请求总数和 5xx 百分比（0-100）
+func (t *ErrorRateTracker) Rate() (int, float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now().Unix()
+	oldest := now - int64(len(t.buckets)) + 1
+
+	total, errors := 0, 0
+	for _, bucket := range t.buckets {
+		if bucket.second >= oldest && bucket.second <= now {
+			total += bucket.total
+			errors += bucket.errors
+		}
+	}
+
+	if total == 0 {
+		return 0, 0
+	}
+	return total, float64(errors) / float64(total) * 100
+}
+
+// Middleware 记录每个请求的响应状态，skipPaths 中的路由（如健康检查本身）不计入
+func (t *ErrorRateTracker) Middleware(skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+
+	return func(c *gin.Context) {
+		c.Next()
+
+		if skip[c.FullPath()] {
+			return
+		}
+		t.Record(c.Writer.Status())
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 超过该时间未访问的令牌桶会被清理
+	bucketIdleTimeout = 10 * time.Minute
+	// 清理空闲令牌桶的最小间隔
+	bucketSweepInterval = 1 * time.Minute
+)
+
+// tokenBucket 单个客户端的令牌桶
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// RateLimiter 按 key（默认客户端 IP）限流的令牌桶，桶容量为 burst，每秒补充 rps 个令牌
+type RateLimiter struct {
+	mu        sync.Mutex
+	rps       float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter 创建令牌桶限流器
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rps:       rps,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow 尝试为 key 取出一个令牌，失败时返回需要等待的时间
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = bucket
+	} else {
+		elapsed := now.Sub(bucket.lastSeen).Seconds()
+		bucket.tokens = math.Min(l.burst, bucket.tokens+elapsed*l.rps)
+		bucket.lastSeen = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / l.rps * float64(time.Second))
+	return false, wait
+}
+
+// 清理长时间未访问的令牌桶，调用方需持有锁
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware 按客户端 IP 限流，超出时返回 429 并设置 Retry-After（秒）
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, wait := l.Allow(c.ClientIP())
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":   "Too many requests",
+				"message": "Rate limit exceeded, retry after " + strconv.Itoa(retryAfter) + "s",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
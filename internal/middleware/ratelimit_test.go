@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	limiter := NewRateLimiter(0.5, 3)
+	router.POST("/upscores", limiter.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/top/:n", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(method, target, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 桶容量内的请求全部放行，之后返回 429，每 2 秒补充一个令牌
+	for i := 0; i < 3; i++ {
+		if w := request(http.MethodPost, "/upscores", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i+1, w.Code)
+		}
+	}
+	w := request(http.MethodPost, "/upscores", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over burst status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+
+	// 其他客户端和未限流的读路由不受影响
+	if w := request(http.MethodPost, "/upscores", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", w.Code)
+	}
+	if w := request(http.MethodGet, "/top/10", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Errorf("read route status = %d, want 200", w.Code)
+	}
+}
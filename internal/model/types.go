@@ -15,12 +15,20 @@ type Player struct {
 
 // PlayerScoreHistory 玩家分数历史
 type PlayerScoreHistory struct {
-	ID          int64     `json:"id" db:"id"`
-	PlayerID    string    `json:"player_id" db:"player_id"`
-	ScoreChange int64     `json:"score_change" db:"score_change"`
-	FinalScore  int64     `json:"final_score" db:"final_score"`
-	Reason      string    `json:"reason" db:"reason"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ID             int64     `json:"id" db:"id"`
+	PlayerID       string    `json:"player_id" db:"player_id"`
+	RawScoreChange int64     `json:"raw_score_change" db:"raw_score_change"` // 应用倍率前的原始增量
+	ScoreChange    int64     `json:"score_change" db:"score_change"`         // 实际计入总分的增量
+	FinalScore     int64     `json:"final_score" db:"final_score"`
+	Reason         string    `json:"reason" db:"reason"`
+	WriteID        string    `json:"-" db:"write_id"` // 异步写入的变更ID，用于去重，同步写入时为空
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// DailyScoreDelta 玩家某一天的分数变化合计，Date 为 MySQL 会话时区下的日期（YYYY-MM-DD）
+type DailyScoreDelta struct {
+	Date  string `json:"date" db:"date"`
+	Delta int64  `json:"delta" db:"delta"`
 }
 
 // RankInfo 排名信息
@@ -30,6 +38,200 @@ type RankInfo struct {
 	Score     int64     `json:"score"`
 	Name      string    `json:"name,omitempty"`
 	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+
+	// 排名来自后台预计算结果时为 true，RankComputedAt 为计算时间
+	Approximate    bool       `json:"approximate,omitempty"`
+	RankComputedAt *time.Time `json:"rankComputedAt,omitempty"`
+
+	// Redis 不可用时返回已过期的本地缓存结果时为 true
+	Stale bool `json:"stale,omitempty"`
+	// Redis 不可用时由 MySQL 统计的结果为 true，不排除被封禁的玩家
+	Fallback bool `json:"fallback,omitempty"`
+}
+
+// 实时前N名推送的消息类型
+const (
+	TopNUpdateSnapshot = "snapshot" // 连接建立时的完整前N名
+	TopNUpdateDelta    = "delta"    // 前N名发生变化
+)
+
+// TopNUpdate 实时前N名推送，Rankings 始终为当前完整前N名
+type TopNUpdate struct {
+	Type     string      `json:"type"`
+	Rankings []*RankInfo `json:"rankings"`
+	Changed  []*RankInfo `json:"changed,omitempty"` // 名次、分数或名称变化以及新进入前N名的玩家
+	Removed  []string    `json:"removed,omitempty"` // 跌出前N名的玩家ID
+}
+
+// PlayerProfile 玩家排名和 MySQL 中的完整玩家信息
+// 未上榜（如被封禁）时 Rank 为空；在榜但 MySQL 中没有记录时 Player 为空
+// Percentile、Neighbors、History 仅玩家概览接口返回，读取失败的部分为空并列在 Unavailable 中
+type PlayerProfile struct {
+	PlayerID    string                `json:"playerId"`
+	Rank        *RankInfo             `json:"rank"`
+	Player      *Player               `json:"player"`
+	Percentile  *PercentileInfo       `json:"percentile,omitempty"`
+	Neighbors   []*RankInfo           `json:"neighbors,omitempty"` // 玩家前后各两名（含玩家本人）
+	History     []*PlayerScoreHistory `json:"history,omitempty"`   // 最近的分数变更，按时间倒序
+	Unavailable []string              `json:"unavailable,omitempty"`
+}
+
+// PeakRankInfo 玩家的历史最佳排名（按标准排名计算），只在玩家自己的分数写入总榜后更新
+type PeakRankInfo struct {
+	PlayerID   string    `json:"playerId"`
+	PeakRank   int64     `json:"peakRank"`
+	AchievedAt time.Time `json:"achievedAt"`
+}
+
+// PercentileInfo 玩家百分位信息
+type PercentileInfo struct {
+	PlayerID   string  `json:"playerId"`
+	Rank       int64   `json:"rank"`
+	Total      int64   `json:"total"`
+	Percentile float64 `json:"percentile"` // rank/total*100，越小越靠前，如 5 表示前 5%
+}
+
+// DependencyHealth 依赖服务的检查结果
+type DependencyHealth struct {
+	Healthy   bool    `json:"healthy"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ResetResult 重置排行榜的结果，DryRun 为 true 时为预计删除的数量
+type ResetResult struct {
+	DryRun             bool   `json:"dryRun"`
+	LeaderboardEntries int64  `json:"leaderboardEntries"`
+	MySQLMode          string `json:"mysqlMode"`
+	ResetPlayers       int64  `json:"resetPlayers"`
+	DeletedHistory     int64  `json:"deletedHistory"`
+	Archived           bool   `json:"archived"`
+}
+
+// LeaderboardSnapshot MySQL 中保存的排行榜快照，SnapshotData 为 []*Player 的 JSON
+type LeaderboardSnapshot struct {
+	ID           int64     `json:"id" db:"id"`
+	SnapshotData []byte    `json:"-" db:"snapshot_data"`
+	PlayerCount  int       `json:"playerCount" db:"player_count"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+}
+
+// RestoreResult 从快照恢复排行榜的结果
+type RestoreResult struct {
+	SnapshotID         int64     `json:"snapshotId"`
+	SnapshotCreatedAt  time.Time `json:"snapshotCreatedAt"`
+	RestoredPlayers    int       `json:"restoredPlayers"`    // 写入 MySQL 的快照玩家数
+	LeaderboardEntries int       `json:"leaderboardEntries"` // 写入 Redis 排行榜的玩家数，不含被封禁的玩家
+}
+
+// CohortStats 一组玩家在排行榜中的分布
+type CohortStats struct {
+	Requested  int            `json:"requested"`
+	Ranked     int            `json:"ranked"`
+	Unranked   int            `json:"unranked"`
+	BoardSize  int64          `json:"boardSize"`
+	MinRank    int64          `json:"minRank,omitempty"` // 最靠前的名次
+	MaxRank    int64          `json:"maxRank,omitempty"` // 最靠后的名次
+	MedianRank float64        `json:"medianRank,omitempty"`
+	Histogram  []CohortBucket `json:"histogram"`
+}
+
+// CohortBucket 名次区间 [FromRank, ToRank] 内的玩家数
+type CohortBucket struct {
+	FromRank int64 `json:"fromRank"`
+	ToRank   int64 `json:"toRank"`
+	Count    int   `json:"count"`
+}
+
+// ScoreBucket 总分在 [MinScore, MaxScore] 内的玩家数
+type ScoreBucket struct {
+	MinScore int64 `json:"minScore"`
+	MaxScore int64 `json:"maxScore"`
+	Count    int64 `json:"count"`
+}
+
+// PendingScoreWrite 先写 Redis 模式下已写入排行榜、等待写入 MySQL 的分数变更
+type PendingScoreWrite struct {
+	WriteID        string    `json:"writeId"`
+	PlayerID       string    `json:"playerId"`
+	Name           string    `json:"name,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	RawScoreChange int64     `json:"rawScoreChange"`
+	ScoreChange    int64     `json:"scoreChange"`
+	SetAbsolute    bool      `json:"setAbsolute,omitempty"`
+	Score          int64     `json:"score,omitempty"` // SetAbsolute 时覆盖写入的总分
+	ExpiresAt      time.Time `json:"expiresAt"`       // 零值表示不到期
+	QueuedAt       time.Time `json:"queuedAt"`
+}
+
+// ScoreWriteQueueStats 异步写入队列中各状态的变更数
+type ScoreWriteQueueStats struct {
+	Pending    int64 `json:"pending"`
+	Processing int64 `json:"processing"`
+	Dead       int64 `json:"dead"` // 多次重试仍未写入 MySQL，需要人工处理或重新入队
+}
+
+// PlayerAttributes 玩家属性，用于筛选子集排名
+type PlayerAttributes struct {
+	Country string `json:"country"`
+	Level   int    `json:"level"`
+}
+
+// PlayerFilter 玩家子集的筛选条件，为零值的条件不参与筛选
+type PlayerFilter struct {
+	Country  string `json:"country,omitempty"`
+	MinLevel int    `json:"minLevel,omitempty"`
+	MaxLevel int    `json:"maxLevel,omitempty"`
+}
+
+// IsEmpty 是否没有任何筛选条件
+func (f PlayerFilter) IsEmpty() bool {
+	return f.Country == "" && f.MinLevel == 0 && f.MaxLevel == 0
+}
+
+// Matches 属性为 attrs 的玩家是否属于该子集
+func (f PlayerFilter) Matches(attrs PlayerAttributes) bool {
+	if f.Country != "" && attrs.Country != f.Country {
+		return false
+	}
+	if f.MinLevel != 0 && attrs.Level < f.MinLevel {
+		return false
+	}
+	if f.MaxLevel != 0 && attrs.Level > f.MaxLevel {
+		return false
+	}
+	return true
+}
+
+// FilteredRankInfo 玩家在筛选子集中的排名
+// 玩家本身不属于该子集时（InSubset 为 false），Rank 为按其分数放入该子集后的名次
+type FilteredRankInfo struct {
+	PlayerID string       `json:"playerId"`
+	Rank     int64        `json:"rank"`
+	Score    int64        `json:"score"`
+	Total    int64        `json:"total"` // 子集中的玩家数
+	InSubset bool         `json:"inSubset"`
+	Method   string       `json:"method"`
+	Filter   PlayerFilter `json:"filter"`
+}
+
+// ScoreAtRankInfo 指定排名的分数，以及与某位玩家当前分数的差值
+type ScoreAtRankInfo struct {
+	Rank        int64  `json:"rank"`
+	PlayerID    string `json:"playerId"`
+	Score       int64  `json:"score"`
+	RefPlayerID string `json:"refPlayerId,omitempty"`
+	RefScore    *int64 `json:"refScore,omitempty"`
+	Delta       *int64 `json:"delta,omitempty"` // Score - RefScore
+}
+
+// RankForScoreInfo 某个分数在当前排行榜中将占据的名次
+// 与已有玩家同分时并列，不排在其后：标准排名为排在该分数之前的人数加一，密集排名为排在该分数之前的不同分数个数加一
+type RankForScoreInfo struct {
+	Score  int64  `json:"score"`
+	Rank   int64  `json:"rank"`
+	Tied   int64  `json:"tied"` // 当前恰好为该分数的玩家数
+	Method string `json:"method"`
 }
 
 // LeaderboardConfig 排行榜配置
@@ -43,9 +245,68 @@ type LeaderboardConfig struct {
 }
 
 // UpdateRequest 分数更新请求
+// IncrScore 默认为分数增量，允许为 0（仅记录历史）；SetAbsolute 为 true 时 IncrScore 表示要覆盖写入的总分，
+// 公开的 HTTP 和 gRPC 更新接口拒绝 SetAbsolute，只有管理员接口 SetPlayerScore 会设置
 type UpdateRequest struct {
-	PlayerID  string `json:"playerId" binding:"required"`
-	IncrScore int64  `json:"incrScore" binding:"required"`
-	Name      string `json:"name,omitempty"`
-	Reason    string `json:"reason,omitempty"`
+	PlayerID    string `json:"playerId" binding:"required"`
+	IncrScore   int64  `json:"incrScore"`
+	Name        string `json:"name,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	SetAbsolute bool   `json:"setAbsolute,omitempty"`
+	// TTLSeconds 大于 0 时本次增量在该秒数后到期并从总分中扣回，不传时按得分原因配置的有效期处理
+	TTLSeconds int64 `json:"ttlSeconds,omitempty" binding:"min=0"`
+	// IdempotencyKey 客户端生成的幂等键，同一键在有效期内只生效一次；请求头 Idempotency-Key 优先，批量更新中忽略
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+// UpdateReceipt 带幂等键的分数更新的处理结果，重复提交同一幂等键时原样返回
+type UpdateReceipt struct {
+	PlayerID    string    `json:"playerId"`
+	ScoreChange int64     `json:"scoreChange"`
+	SetAbsolute bool      `json:"setAbsolute"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// BatchUpdateRequest 批量分数更新请求，每条更新按 UpdateRequest 的规则校验，任一条不通过时整批拒绝
+type BatchUpdateRequest struct {
+	Updates []UpdateRequest `json:"updates" binding:"required,dive"`
+}
+
+// BatchUpdateResult 批量更新中单条记录的处理结果
+type BatchUpdateResult struct {
+	PlayerID   string `json:"playerId"`
+	Success    bool   `json:"success"`
+	FinalScore int64  `json:"finalScore,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// UpdateNamesRequest 批量更新玩家名称请求
+type UpdateNamesRequest struct {
+	Names map[string]string `json:"names" binding:"required"` // playerId -> name
+}
+
+// CohortRequest 玩家分布查询请求
+type CohortRequest struct {
+	PlayerIDs []string `json:"playerIds" binding:"required"`
+}
+
+// SetScoreRequest 管理员直接设置玩家总分的请求，Score 为新的总分而非增量
+type SetScoreRequest struct {
+	Score  *int64 `json:"score" binding:"required"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// BatchRankRequest 批量查询玩家排名请求
+type BatchRankRequest struct {
+	PlayerIDs []string `json:"playerIds" binding:"required"`
+}
+
+// AmongRequest 在一组玩家（如好友列表）内排名的请求
+type AmongRequest struct {
+	PlayerIDs []string `json:"playerIds" binding:"required"`
+}
+
+// BlocklistRequest 封禁玩家请求
+type BlocklistRequest struct {
+	PlayerIDs []string `json:"playerIds" binding:"required"`
 }
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 测试用的 database/sql 驱动：记录执行的语句（事务的开始、提交和回滚记为 BEGIN、COMMIT、ROLLBACK），
+// 每条语句的结果由 respond 返回
+type fakeSQL struct {
+	mu         sync.Mutex
+	statements []fakeStatement
+	respond    func(query string, args []driver.Value) fakeResult
+	// 每条查询或执行语句返回前等待的时长；与 MySQL 驱动一致，ctx 先结束时中止语句并返回 ctx 的错误
+	delay time.Duration
+}
+
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeResult 查询返回 columns 和 rows，执行语句返回 rowsAffected
+type fakeResult struct {
+	columns      []string
+	rows         [][]driver.Value
+	rowsAffected int64
+	err          error
+}
+
+// 创建使用 fakeSQL 的 MySQLRepository，respond 为空时所有语句返回空结果
+func newFakeMySQL(t *testing.T, maxScore int64, respond func(query string, args []driver.Value) fakeResult) (*MySQLRepository, *fakeSQL) {
+	t.Helper()
+
+	f := &fakeSQL{respond: respond}
+	db := sql.OpenDB(fakeConnector{f})
+	t.Cleanup(func() { db.Close() })
+	return NewMySQLRepository(sqlx.NewDb(db, "mysql"), 0, maxScore), f
+}
+
+// Statements 返回已执行的语句
+func (f *fakeSQL) Statements() []fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeStatement(nil), f.statements...)
+}
+
+func (f *fakeSQL) run(query string, args []driver.NamedValue) fakeResult {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	f.mu.Lock()
+	f.statements = append(f.statements, fakeStatement{query: query, args: values})
+	respond := f.respond
+	f.mu.Unlock()
+
+	if respond == nil {
+		return fakeResult{}
+	}
+	return respond(query, values)
+}
+
+type fakeConnector struct{ f *fakeSQL }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{f: c.f}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fakeSQL: use sql.OpenDB with a fakeConnector")
+}
+
+type fakeConn struct{ f *fakeSQL }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakeSQL: prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.f.run("BEGIN", nil)
+	return fakeTx{c.f}, nil
+}
+
+// 模拟执行耗时，ctx 先结束时返回其错误
+func (f *fakeSQL) wait(ctx context.Context) error {
+	if f.delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(f.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.f.wait(ctx); err != nil {
+		return nil, err
+	}
+	result := c.f.run(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &fakeRows{columns: result.columns, rows: result.rows}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.f.wait(ctx); err != nil {
+		return nil, err
+	}
+	result := c.f.run(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return driver.RowsAffected(result.rowsAffected), nil
+}
+
+type fakeTx struct{ f *fakeSQL }
+
+func (tx fakeTx) Commit() error {
+	tx.f.run("COMMIT", nil)
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	tx.f.run("ROLLBACK", nil)
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
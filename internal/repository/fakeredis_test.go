@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"testing"
+
+	"game-leaderboard/internal/repository/repotest/resp"
+)
+
+// 创建连接到测试用 Redis 服务端的 RedisRepository（玩家信息保存在 Redis），respond 为空时所有命令返回 OK
+func newFakeRedis(t *testing.T, respond func(args []string) interface{}) (*RedisRepository, *resp.Server) {
+	t.Helper()
+
+	server := resp.NewServer(respond)
+	client := server.NewClient()
+	t.Cleanup(func() { client.Close() })
+	return NewRedisRepository(client, true, RankOrderDesc, 0, RetryOptions{}), server
+}
@@ -1,7 +1,11 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"time"
+
+	"game-leaderboard/internal/model"
 )
 
 // 定义通用的错误
@@ -9,4 +13,138 @@ var (
 	ErrPlayerNotFound = errors.New("player not found")
 	ErrInvalidData    = errors.New("invalid data")
 	ErrDuplicateEntry = errors.New("duplicate entry")
+	ErrInvalidWindow  = errors.New("invalid window")
+	ErrRankOutOfRange = errors.New("rank out of range")
+	ErrSchemaMismatch = errors.New("schema mismatch")
+	ErrNoSnapshot     = errors.New("snapshot not found")
+
+	// ErrScoreOutOfRange 变更后的总分超出上限或 int64 范围
+	ErrScoreOutOfRange = errors.New("score out of range")
+
+	// ErrStopIteration 遍历回调返回该错误时提前结束遍历，不视为失败
+	ErrStopIteration = errors.New("stop iteration")
+)
+
+// RedisStore 排行榜服务使用的 Redis 存储操作，由 RedisRepository 实现
+type RedisStore interface {
+	StoresMetadata() bool
+	Ascending() bool
+	HealthCheck(ctx context.Context) error
+
+	// 总榜写入
+	UpdatePlayerScore(ctx context.Context, playerID string, score int64, name string, updatedAt time.Time) error
+	UpdatePlayerScores(ctx context.Context, players []*model.Player) error
+	IncrementPlayerScore(ctx context.Context, playerID string, incrScore, total int64, name string) (int64, error)
+	IncrementPlayerScoreAt(ctx context.Context, playerID string, incrScore, total int64, name string, updatedAt time.Time) (int64, error)
+	WritePlayerScores(ctx context.Context, writes []*ScoreWrite) error
+	SetPlayerNames(ctx context.Context, names map[string]string) error
+	RebuildScoreIndex(ctx context.Context, force bool) (bool, error)
+	ClearLeaderboard(ctx context.Context) (int64, error)
+
+	// 总榜查询
+	GetPlayerRank(ctx context.Context, playerID string) (int64, error)
+	GetPlayerRanks(ctx context.Context, playerIDs []string) (map[string]int64, int64, error)
+	GetPlayerRankInfos(ctx context.Context, playerIDs []string) (map[string]*model.RankInfo, error)
+	GetPlayerScore(ctx context.Context, playerID string) (float64, error)
+	GetPlayerRankAndScore(ctx context.Context, playerID string) (int64, float64, error)
+	GetRankForScore(ctx context.Context, score int64) (int64, int64, error)
+	CountBetterScores(ctx context.Context, score int64) (int64, error)
+	GetScoreAtRank(ctx context.Context, rank int64) (string, int64, error)
+	GetTopPlayers(ctx context.Context, n int64) ([]*model.RankInfo, error)
+	GetPlayersByRankRange(ctx context.Context, start, end int64) ([]*model.RankInfo, error)
+	GetPlayersByScoreRange(ctx context.Context, minScore, maxScore *int64, limit int64) ([]*model.RankInfo, int64, error)
+	GetPlayerRankRange(ctx context.Context, playerID string, rangeNum int64) ([]*model.RankInfo, error)
+	GetPlayersNearScore(ctx context.Context, playerID string, scoreDelta, limit int64) ([]*model.RankInfo, int64, int64, error)
+	IterateLeaderboard(ctx context.Context, pageSize int64, fn func(page []*model.RankInfo) error) error
+	GetLeaderboardSize(ctx context.Context) (int64, error)
+	GetPlayerLastActive(ctx context.Context, playerID string) (time.Time, error)
+
+	// 时间窗口排行榜
+	IncrementWindowScores(ctx context.Context, playerID string, incrScore int64) error
+	IncrementWindowScoresBatch(ctx context.Context, increments map[string]int64) error
+	GetWindowTopPlayers(ctx context.Context, window string, n int64) ([]*model.RankInfo, error)
+	GetWindowSize(ctx context.Context, window string) (int64, error)
+
+	// 封禁名单
+	BlockPlayers(ctx context.Context, playerIDs []string) error
+	UnblockPlayers(ctx context.Context, playerIDs []string) error
+	IsPlayerBlocked(ctx context.Context, playerID string) (bool, error)
+	GetBlockedPlayers(ctx context.Context) ([]string, error)
+
+	// 幂等键
+	ClaimIdempotencyKey(ctx context.Context, key string, ttl time.Duration) (bool, *model.UpdateReceipt, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, receipt *model.UpdateReceipt, ttl time.Duration) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+
+	// 预计算排名
+	WritePrecomputedRanks(ctx context.Context, buildKey string, ranks map[string]int) error
+	PublishPrecomputedRanks(ctx context.Context, buildKey string, computedAt time.Time) error
+	DiscardPrecomputedRanks(ctx context.Context, buildKey string) error
+	GetPrecomputedRank(ctx context.Context, playerID string) (int, time.Time, error)
+
+	// 历史最佳排名
+	UpdatePeakRanks(ctx context.Context, playerIDs []string) error
+	GetPeakRank(ctx context.Context, playerID string) (int64, time.Time, error)
+
+	// 缓存快照
+	SaveCacheSnapshot(ctx context.Context, data []byte, ttl time.Duration) error
+	LoadCacheSnapshot(ctx context.Context) ([]byte, error)
+
+	// 先写 Redis 模式的写入队列
+	WriteScoreAndEnqueue(ctx context.Context, write *model.PendingScoreWrite, total int64) (int64, error)
+	EnqueueScoreWrite(ctx context.Context, write *model.PendingScoreWrite) error
+	AcquireScoreWritePartition(ctx context.Context, partition int, owner string, ttl time.Duration) (bool, error)
+	ReleaseScoreWritePartition(ctx context.Context, partition int, owner string) error
+	ClaimScoreWrite(ctx context.Context, partition int, timeout time.Duration) (*ClaimedScoreWrite, error)
+	AckScoreWrite(ctx context.Context, claimed *ClaimedScoreWrite) error
+	DeadLetterScoreWrite(ctx context.Context, claimed *ClaimedScoreWrite) error
+	RequeueProcessingScoreWrites(ctx context.Context, partition int) (int64, error)
+	RequeueDeadScoreWrites(ctx context.Context) (int64, error)
+	GetScoreWriteQueueStats(ctx context.Context) (*model.ScoreWriteQueueStats, error)
+	GetDeadScoreWrites(ctx context.Context, limit int64) ([]*model.PendingScoreWrite, error)
+}
+
+// MySQLStore 排行榜服务使用的 MySQL 存储操作，由 MySQLRepository 实现
+type MySQLStore interface {
+	HealthCheck(ctx context.Context) error
+
+	// 分数变更
+	ApplyScoreChange(ctx context.Context, name string, history *model.PlayerScoreHistory, expiresAt time.Time) (int64, error)
+	SetPlayerScore(ctx context.Context, name string, history *model.PlayerScoreHistory, score int64) (int64, error)
+	RevertExpiredScore(ctx context.Context, now time.Time) (*model.PlayerScoreHistory, string, error)
+	ClaimExpiredScore(ctx context.Context, now time.Time) (*model.PlayerScoreHistory, string, error)
+	ListDecayCandidates(ctx context.Context, inactiveBefore time.Time, afterID string, limit int) ([]string, error)
+	DecayPlayerScore(ctx context.Context, playerID string, rate float64, inactiveBefore time.Time) (*model.PlayerScoreHistory, string, time.Time, error)
+	EstimateDecay(ctx context.Context, rate float64, inactiveBefore time.Time) (int64, int64, error)
+
+	// 玩家信息
+	UpdatePlayerNames(ctx context.Context, names map[string]string) (int64, error)
+	UpdatePlayerAttributes(ctx context.Context, playerID string, attrs model.PlayerAttributes) error
+	GetPlayer(ctx context.Context, playerID string) (*model.Player, error)
+	GetPlayerNames(ctx context.Context, playerIDs []string) (map[string]string, error)
+	GetPlayersByIDs(ctx context.Context, playerIDs []string) (map[string]*model.Player, error)
+	GetRecentlyActivePlayers(ctx context.Context, limit int) ([]*model.Player, error)
+	SearchPlayersByName(ctx context.Context, query string, limit int) ([]*model.Player, error)
+	GetScoreHistory(ctx context.Context, playerID string, limit, offset int) ([]*model.PlayerScoreHistory, error)
+	GetDailyScoreDeltas(ctx context.Context, playerID string, days int) ([]*model.DailyScoreDelta, error)
+
+	// 排名统计
+	GetFilteredRank(ctx context.Context, playerID string, filter model.PlayerFilter, excludeIDs []string, dense, ascending bool) (*model.FilteredRankInfo, error)
+	GetRankedPlayers(ctx context.Context, limit int, ascending bool) ([]*model.Player, error)
+	GetAllPlayers(ctx context.Context) ([]*model.Player, error)
+	GetScoreBuckets(ctx context.Context, size int64, limit int) ([]model.ScoreBucket, error)
+
+	// 重置和快照
+	CountScoreData(ctx context.Context) (int64, int64, error)
+	ResetScores(ctx context.Context) (int64, int64, error)
+	SaveLeaderboardSnapshot(ctx context.Context, snapshotData []byte, playerCount int) error
+	ListSnapshots(ctx context.Context, limit, offset int) ([]*model.LeaderboardSnapshot, int64, error)
+	GetSnapshot(ctx context.Context, id int64) (*model.LeaderboardSnapshot, error)
+	PruneSnapshots(ctx context.Context, keepCount int, before time.Time) (int64, error)
+	RestorePlayerScores(ctx context.Context, players []*model.Player) error
+}
+
+var (
+	_ RedisStore = (*RedisRepository)(nil)
+	_ MySQLStore = (*MySQLRepository)(nil)
 )
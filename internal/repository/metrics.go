@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"game-leaderboard/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 存储操作耗时，store 为 redis 或 mysql
+// operation 取值固定：MySQL 为 startSpan 的操作名（如 UpsertPlayer），Redis 为 RedisRepository 的方法名（如 GetPlayerRank）
+// 只记录仓库方法，共用同一 Redis 客户端的其他调用（如 L2 缓存）不计入
+var storeOperationDuration = promauto.With(metrics.Registerer).NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "leaderboard_store_operation_duration_seconds",
+	Help:    "Duration of Redis and MySQL operations in seconds",
+	Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+}, []string{"store", "operation"})
+
+const (
+	storeRedis = "redis"
+	storeMySQL = "mysql"
+)
+
+// mysqlSpan 在结束 span 时记录 MySQL 操作耗时
+type mysqlSpan struct {
+	trace.Span
+	operation string
+	start     time.Time
+}
+
+func (s *mysqlSpan) End() {
+	storeOperationDuration.WithLabelValues(storeMySQL, s.operation).Observe(time.Since(s.start).Seconds())
+	s.Span.End()
+}
+
+type redisOperationKey struct{}
+
+// startRedisOperation 开始记录一次 RedisRepository 方法调用的耗时，operation 为方法名，返回的函数结束记录
+// 方法内部调用的其他方法（如 GetPlayerRankRange 调用的 GetPlayerRanks）计入外层操作，不重复记录
+func startRedisOperation(ctx context.Context, operation string) (context.Context, func()) {
+	if ctx.Value(redisOperationKey{}) != nil {
+		return ctx, func() {}
+	}
+	start := time.Now()
+	return context.WithValue(ctx, redisOperationKey{}, operation), func() {
+		storeOperationDuration.WithLabelValues(storeRedis, operation).Observe(time.Since(start).Seconds())
+	}
+}
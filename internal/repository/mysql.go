@@ -3,25 +3,77 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
 
 	"game-leaderboard/internal/model"
+	"game-leaderboard/pkg/utils"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// requiredSchema 服务依赖的表和字段
+var requiredSchema = map[string][]string{
+	"players":               {"id", "name", "country", "level", "total_score", "created_at", "updated_at"},
+	"player_score_history":  {"id", "player_id", "raw_score_change", "score_change", "final_score", "reason", "write_id", "created_at"},
+	"leaderboard_snapshots": {"id", "snapshot_data", "player_count", "created_at"},
+	"score_expirations":     {"id", "player_id", "score_change", "reason", "expires_at", "reverted_at", "created_at"},
+}
+
+// MySQL 调用的 span，Redis 命令的 span 由 go-redis 的 redisotel hook 创建
+var tracer = otel.Tracer("game-leaderboard/internal/repository")
+
+// startSpan 为 MySQL 调用创建客户端 span，未启用追踪时只记录耗时指标
+func startSpan(ctx context.Context, operation string) (context.Context, *mysqlSpan) {
+	ctx, span := tracer.Start(ctx, "mysql."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "mysql")))
+	return ctx, &mysqlSpan{Span: span, operation: operation, start: time.Now()}
+}
+
 type MySQLRepository struct {
 	db *sqlx.DB
+	// 单次操作的最长耗时，为 0 时不限制
+	opTimeout time.Duration
+	// 总分的绝对值上限，为 0 时只检查 int64 溢出
+	maxScore int64
 }
 
-func NewMySQLRepository(db *sqlx.DB) *MySQLRepository {
+// NewMySQLRepository opTimeout 为单次操作（查询或事务）的最长耗时，为 0 时只受调用方 ctx 限制
+// maxScore 为分数更新后总分的绝对值上限，为 0 时不限制
+func NewMySQLRepository(db *sqlx.DB, opTimeout time.Duration, maxScore int64) *MySQLRepository {
 	return &MySQLRepository{
-		db: db,
+		db:        db,
+		opTimeout: opTimeout,
+		maxScore:  maxScore,
+	}
+}
+
+// withOpTimeout 为单次操作设置截止时间，调用方的截止时间更早时以其为准
+// 驱动在 ctx 取消后中止查询并关闭连接，事务随之回滚
+// 全表读取、重置、恢复等批量操作不调用，其耗时与数据量成正比
+func (m *MySQLRepository) withOpTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.opTimeout <= 0 {
+		return ctx, func() {}
 	}
+	return context.WithTimeout(ctx, m.opTimeout)
 }
 
 // UpsertPlayer 插入或更新玩家信息
 func (m *MySQLRepository) UpsertPlayer(ctx context.Context, player *model.Player) error {
+	ctx, span := startSpan(ctx, "UpsertPlayer")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO players (id, name, total_score, created_at, updated_at)
 		VALUES (?, ?, ?, NOW(), NOW())
@@ -41,12 +93,17 @@ func (m *MySQLRepository) UpsertPlayer(ctx context.Context, player *model.Player
 
 // RecordScoreHistory 记录分数变更历史
 func (m *MySQLRepository) RecordScoreHistory(ctx context.Context, history *model.PlayerScoreHistory) error {
+	ctx, span := startSpan(ctx, "RecordScoreHistory")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
 	query := `
-		INSERT INTO player_score_history (player_id, score_change, final_score, reason, created_at)
-		VALUES (?, ?, ?, ?, NOW())
+		INSERT INTO player_score_history (player_id, raw_score_change, score_change, final_score, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, NOW())
 	`
 
-	_, err := m.db.ExecContext(ctx, query, history.PlayerID, history.ScoreChange, history.FinalScore, history.Reason)
+	_, err := m.db.ExecContext(ctx, query, history.PlayerID, history.RawScoreChange, history.ScoreChange, history.FinalScore, history.Reason)
 	if err != nil {
 		return fmt.Errorf("failed to record score history: %w", err)
 	}
@@ -54,8 +111,518 @@ func (m *MySQLRepository) RecordScoreHistory(ctx context.Context, history *model
 	return nil
 }
 
+// ApplyScoreChange 在同一事务内按 history.ScoreChange 更新玩家总分并记录分数变更历史，
+// 变更后的总分写回 history.FinalScore 并返回
+// expiresAt 非零时同时记录该变更的到期时间，到期后由 RevertExpiredScore 从总分中扣回
+func (m *MySQLRepository) ApplyScoreChange(ctx context.Context, name string, history *model.PlayerScoreHistory, expiresAt time.Time) (int64, error) {
+	compute := func(currentScore int64) (int64, error) {
+		finalScore, ok := utils.AddScore(currentScore, history.ScoreChange)
+		if !ok {
+			return 0, fmt.Errorf("%w: %d%+d overflows int64", ErrScoreOutOfRange, currentScore, history.ScoreChange)
+		}
+		return finalScore, nil
+	}
+	if expiresAt.IsZero() || history.ScoreChange == 0 {
+		return m.changeScore(ctx, name, history, compute, nil)
+	}
+
+	return m.changeScore(ctx, name, history, compute, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO score_expirations (player_id, score_change, reason, expires_at, created_at) VALUES (?, ?, ?, ?, NOW())`,
+			history.PlayerID, history.ScoreChange, history.Reason, expiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to record score expiration: %w", err)
+		}
+		return nil
+	})
+}
+
+// SetPlayerScore 在同一事务内将玩家总分直接设为 score，并以与原分数的差值记录分数变更历史，
+// history.RawScoreChange、ScoreChange 和 FinalScore 均在此回填
+// 总分被直接覆盖后，之前未到期的临时分数不再扣回
+func (m *MySQLRepository) SetPlayerScore(ctx context.Context, name string, history *model.PlayerScoreHistory, score int64) (int64, error) {
+	compute := func(currentScore int64) (int64, error) {
+		// 总分都在上限内时差值不会溢出，之前写入的超限总分在此拒绝
+		change, ok := utils.AddScore(score, -currentScore)
+		if !ok {
+			return 0, fmt.Errorf("%w: change from %d to %d overflows int64", ErrScoreOutOfRange, currentScore, score)
+		}
+		history.RawScoreChange = change
+		history.ScoreChange = change
+		return score, nil
+	}
+
+	return m.changeScore(ctx, name, history, compute, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM score_expirations WHERE player_id = ? AND reverted_at IS NULL`, history.PlayerID)
+		if err != nil {
+			return fmt.Errorf("failed to cancel score expirations: %w", err)
+		}
+		return nil
+	})
+}
+
+// changeScore 锁定玩家当前分数，由 compute 计算新的总分后写入玩家表和分数历史，after 不为空时在提交前执行
+// history.WriteID 非空且已有相同ID的历史记录时不做任何修改，返回 ErrDuplicateEntry
+// 新的总分超出 maxScore 且比当前总分离 0 更远时不做任何修改，返回 ErrScoreOutOfRange；已超限的总分仍可向 0 调整
+func (m *MySQLRepository) changeScore(ctx context.Context, name string, history *model.PlayerScoreHistory, compute func(currentScore int64) (int64, error), after func(tx *sqlx.Tx) error) (int64, error) {
+	ctx, span := startSpan(ctx, "ApplyScoreChange")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 加行锁读取当前分数，避免并发更新同一玩家时丢失增量
+	var currentScore int64
+	err = tx.GetContext(ctx, &currentScore, `SELECT total_score FROM players WHERE id = ? FOR UPDATE`, history.PlayerID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to lock player: %w", err)
+	}
+
+	finalScore, err := compute(currentScore)
+	if err != nil {
+		return 0, err
+	}
+	if m.maxScore > 0 && utils.AbsScore(finalScore) > m.maxScore && utils.AbsScore(finalScore) > utils.AbsScore(currentScore) {
+		return 0, fmt.Errorf("%w: %d exceeds the limit of %d", ErrScoreOutOfRange, finalScore, m.maxScore)
+	}
+
+	upsert := `
+		INSERT INTO players (id, name, total_score, created_at, updated_at)
+		VALUES (?, ?, ?, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE
+			name = VALUES(name),
+			total_score = VALUES(total_score),
+			updated_at = NOW()
+	`
+	if _, err := tx.ExecContext(ctx, upsert, history.PlayerID, name, finalScore); err != nil {
+		return 0, fmt.Errorf("failed to upsert player: %w", err)
+	}
+
+	// write_id 唯一，重复投递的异步变更在此失败并整体回滚
+	insertHistory := `
+		INSERT INTO player_score_history (player_id, raw_score_change, score_change, final_score, reason, write_id, created_at)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), NOW())
+	`
+	_, err = tx.ExecContext(ctx, insertHistory,
+		history.PlayerID, history.RawScoreChange, history.ScoreChange, finalScore, history.Reason, history.WriteID)
+	if isDuplicateEntry(err) {
+		return 0, ErrDuplicateEntry
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to record score history: %w", err)
+	}
+
+	if after != nil {
+		if err := after(tx); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit score change: %w", err)
+	}
+
+	history.FinalScore = finalScore
+	return finalScore, nil
+}
+
+// MySQL 唯一键冲突的错误码
+const mysqlErrDuplicateEntry = 1062
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry
+}
+
+// ExpiredReasonPrefix 到期扣回时记录的分数历史原因前缀，后接原变更的原因
+const ExpiredReasonPrefix = "expired:"
+
+// 已到期待扣回的临时分数
+type scoreExpiration struct {
+	ID          int64  `db:"id"`
+	PlayerID    string `db:"player_id"`
+	ScoreChange int64  `db:"score_change"`
+	Reason      string `db:"reason"`
+}
+
+// 在事务内锁定一条已到期且未处理的临时分数，没有到期记录时返回 nil；多个实例同时处理时通过 SKIP LOCKED 各取不同的记录
+func lockExpiredScore(ctx context.Context, tx *sqlx.Tx, now time.Time) (*scoreExpiration, error) {
+	var expiration scoreExpiration
+	err := tx.GetContext(ctx, &expiration,
+		`SELECT id, player_id, score_change, reason FROM score_expirations
+		 WHERE reverted_at IS NULL AND expires_at <= ?
+		 ORDER BY expires_at
+		 LIMIT 1
+		 FOR UPDATE SKIP LOCKED`, now)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired score: %w", err)
+	}
+	return &expiration, nil
+}
+
+// RevertExpiredScore 取一条已到期且未处理的临时分数，在同一事务内从玩家总分中扣回、记录冲销历史并标记为已处理
+// 返回冲销历史和玩家名称，没有到期记录时返回 nil
+func (m *MySQLRepository) RevertExpiredScore(ctx context.Context, now time.Time) (*model.PlayerScoreHistory, string, error) {
+	ctx, span := startSpan(ctx, "RevertExpiredScore")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	expiration, err := lockExpiredScore(ctx, tx, now)
+	if err != nil || expiration == nil {
+		return nil, "", err
+	}
+
+	var player struct {
+		Name       string `db:"name"`
+		TotalScore int64  `db:"total_score"`
+	}
+	if err := tx.GetContext(ctx, &player, `SELECT name, total_score FROM players WHERE id = ? FOR UPDATE`, expiration.PlayerID); err != nil {
+		return nil, "", fmt.Errorf("failed to lock player: %w", err)
+	}
+
+	history := &model.PlayerScoreHistory{
+		PlayerID:       expiration.PlayerID,
+		RawScoreChange: -expiration.ScoreChange,
+		ScoreChange:    -expiration.ScoreChange,
+		FinalScore:     player.TotalScore - expiration.ScoreChange,
+		Reason:         ExpiredReasonPrefix + expiration.Reason,
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE players SET total_score = ?, updated_at = NOW() WHERE id = ?`,
+		history.FinalScore, history.PlayerID); err != nil {
+		return nil, "", fmt.Errorf("failed to revert player score: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO player_score_history (player_id, raw_score_change, score_change, final_score, reason, created_at)
+		 VALUES (?, ?, ?, ?, ?, NOW())`,
+		history.PlayerID, history.RawScoreChange, history.ScoreChange, history.FinalScore, history.Reason)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to record score history: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE score_expirations SET reverted_at = NOW() WHERE id = ?`, expiration.ID); err != nil {
+		return nil, "", fmt.Errorf("failed to mark score expiration: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to commit score reversal: %w", err)
+	}
+
+	return history, player.Name, nil
+}
+
+// ClaimExpiredScore 取一条已到期且未处理的临时分数并标记为已处理，不修改玩家总分也不记录历史
+// 用于先写 Redis 模式：返回的冲销变更（不含总分）由调用方通过写入队列写入 Redis 和 MySQL；没有到期记录时返回 nil
+func (m *MySQLRepository) ClaimExpiredScore(ctx context.Context, now time.Time) (*model.PlayerScoreHistory, string, error) {
+	ctx, span := startSpan(ctx, "ClaimExpiredScore")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	expiration, err := lockExpiredScore(ctx, tx, now)
+	if err != nil || expiration == nil {
+		return nil, "", err
+	}
+
+	var name string
+	if err := tx.GetContext(ctx, &name, `SELECT name FROM players WHERE id = ?`, expiration.PlayerID); err != nil {
+		return nil, "", fmt.Errorf("failed to get player: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE score_expirations SET reverted_at = NOW() WHERE id = ?`, expiration.ID); err != nil {
+		return nil, "", fmt.Errorf("failed to mark score expiration: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to commit score expiration claim: %w", err)
+	}
+
+	return &model.PlayerScoreHistory{
+		PlayerID:       expiration.PlayerID,
+		RawScoreChange: -expiration.ScoreChange,
+		ScoreChange:    -expiration.ScoreChange,
+		Reason:         ExpiredReasonPrefix + expiration.Reason,
+	}, name, nil
+}
+
+// DecayReason 分数衰减时记录的分数历史原因
+const DecayReason = "decay"
+
+// ListDecayCandidates 按 ID 顺序列出 inactiveBefore 之前没有得分且总分为正的玩家 ID，从 afterID 之后开始
+// 结果只作为候选，是否衰减由 DecayPlayerScore 在锁内重新判断
+func (m *MySQLRepository) ListDecayCandidates(ctx context.Context, inactiveBefore time.Time, afterID string, limit int) ([]string, error) {
+	ctx, span := startSpan(ctx, "ListDecayCandidates")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	var playerIDs []string
+	err := m.db.SelectContext(ctx, &playerIDs,
+		`SELECT id FROM players
+		 WHERE id > ? AND updated_at < ? AND total_score > 0
+		 ORDER BY id
+		 LIMIT ?`, afterID, inactiveBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list decay candidates: %w", err)
+	}
+	return playerIDs, nil
+}
+
+// DecayPlayerScore 在同一事务内将玩家总分按 rate 比例向下取整扣减并记录分数历史
+// 加锁后重新检查：期间有新得分（updated_at 不早于 inactiveBefore）、总分不为正或扣减量为 0 时不修改，返回 nil
+// 衰减不算玩家活动，不修改 updated_at，同分时的先后顺序保持不变
+func (m *MySQLRepository) DecayPlayerScore(ctx context.Context, playerID string, rate float64, inactiveBefore time.Time) (*model.PlayerScoreHistory, string, time.Time, error) {
+	ctx, span := startSpan(ctx, "DecayPlayerScore")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var player struct {
+		Name       string    `db:"name"`
+		TotalScore int64     `db:"total_score"`
+		UpdatedAt  time.Time `db:"updated_at"`
+	}
+	err = tx.GetContext(ctx, &player, `SELECT name, total_score, updated_at FROM players WHERE id = ? FOR UPDATE`, playerID)
+	if err == sql.ErrNoRows {
+		return nil, "", time.Time{}, nil
+	}
+	if err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("failed to lock player: %w", err)
+	}
+
+	if !player.UpdatedAt.Before(inactiveBefore) || player.TotalScore <= 0 {
+		return nil, "", time.Time{}, nil
+	}
+	decrement := int64(math.Floor(float64(player.TotalScore) * rate))
+	if decrement <= 0 {
+		return nil, "", time.Time{}, nil
+	}
+
+	history := &model.PlayerScoreHistory{
+		PlayerID:       playerID,
+		RawScoreChange: -decrement,
+		ScoreChange:    -decrement,
+		FinalScore:     player.TotalScore - decrement,
+		Reason:         DecayReason,
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE players SET total_score = ?, updated_at = updated_at WHERE id = ?`,
+		history.FinalScore, playerID); err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("failed to decay player score: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO player_score_history (player_id, raw_score_change, score_change, final_score, reason, created_at)
+		 VALUES (?, ?, ?, ?, ?, NOW())`,
+		history.PlayerID, history.RawScoreChange, history.ScoreChange, history.FinalScore, history.Reason)
+	if err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("failed to record score history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("failed to commit score decay: %w", err)
+	}
+
+	return history, player.Name, player.UpdatedAt, nil
+}
+
+// EstimateDecay 统计 inactiveBefore 之前没有得分且总分为正的玩家数，以及按 rate 衰减时的总扣减分数
+func (m *MySQLRepository) EstimateDecay(ctx context.Context, rate float64, inactiveBefore time.Time) (int64, int64, error) {
+	ctx, span := startSpan(ctx, "EstimateDecay")
+	defer span.End()
+
+	var result struct {
+		Players   int64 `db:"players"`
+		Decrement int64 `db:"decrement"`
+	}
+	err := m.db.GetContext(ctx, &result,
+		`SELECT COUNT(*) AS players, CAST(COALESCE(SUM(FLOOR(total_score * ?)), 0) AS SIGNED) AS decrement
+		 FROM players
+		 WHERE updated_at < ? AND total_score > 0`, rate, inactiveBefore)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to estimate decay: %w", err)
+	}
+	return result.Players, result.Decrement, nil
+}
+
+// UpdatePlayerNames 批量更新玩家名称，不修改分数和更新时间，返回实际更新的行数
+func (m *MySQLRepository) UpdatePlayerNames(ctx context.Context, names map[string]string) (int64, error) {
+	ctx, span := startSpan(ctx, "UpdatePlayerNames")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// updated_at 参与排名的并列判定，改名时保持不变
+	stmt, err := tx.PreparexContext(ctx, `UPDATE players SET name = ?, updated_at = updated_at WHERE id = ?`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare name update: %w", err)
+	}
+	defer stmt.Close()
+
+	var updated int64
+	for playerID, name := range names {
+		result, err := stmt.ExecContext(ctx, name, playerID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update player name: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil {
+			updated += affected
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit name update: %w", err)
+	}
+
+	return updated, nil
+}
+
+// UpdatePlayerAttributes 更新玩家属性，不修改分数和更新时间；玩家不存在时返回 ErrPlayerNotFound
+func (m *MySQLRepository) UpdatePlayerAttributes(ctx context.Context, playerID string, attrs model.PlayerAttributes) error {
+	ctx, span := startSpan(ctx, "UpdatePlayerAttributes")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx,
+		`UPDATE players SET country = ?, level = ?, updated_at = updated_at WHERE id = ?`,
+		attrs.Country, attrs.Level, playerID)
+	if err != nil {
+		return fmt.Errorf("failed to update player attributes: %w", err)
+	}
+
+	// 属性未变化时影响行数也为 0，需要再确认玩家是否存在
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		return nil
+	}
+	var exists bool
+	if err := m.db.GetContext(ctx, &exists, `SELECT EXISTS(SELECT 1 FROM players WHERE id = ?)`, playerID); err != nil {
+		return fmt.Errorf("failed to check player: %w", err)
+	}
+	if !exists {
+		return ErrPlayerNotFound
+	}
+	return nil
+}
+
+// GetFilteredRank 计算玩家在满足 filter 的玩家子集中的排名，excludeIDs 中的玩家不计入子集
+// 标准排名与 Redis 总榜一致，同分时 updated_at 较早者在前，仍相同时 desc 按玩家ID倒序、asc 按玩家ID正序；
+// dense 为 true 时为子集中排在该玩家分数之前的不同分数个数加一；ascending 为 true 时分数低者在前
+// 玩家不存在时返回 ErrPlayerNotFound
+func (m *MySQLRepository) GetFilteredRank(ctx context.Context, playerID string, filter model.PlayerFilter, excludeIDs []string, dense, ascending bool) (*model.FilteredRankInfo, error) {
+	ctx, span := startSpan(ctx, "GetFilteredRank")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	var player struct {
+		Country    string    `db:"country"`
+		Level      int       `db:"level"`
+		TotalScore int64     `db:"total_score"`
+		UpdatedAt  time.Time `db:"updated_at"`
+	}
+	err := m.db.GetContext(ctx, &player, `SELECT country, level, total_score, updated_at FROM players WHERE id = ?`, playerID)
+	if err == sql.ErrNoRows {
+		return nil, ErrPlayerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get player: %w", err)
+	}
+
+	better, tieBreak := ">", ">"
+	if ascending {
+		better, tieBreak = "<", "<"
+	}
+	query := `SELECT COUNT(*) AS total,
+			COALESCE(SUM(total_score ` + better + ` ? OR (total_score = ? AND (updated_at < ? OR (updated_at = ? AND id ` + tieBreak + ` ?)))), 0) AS ahead,
+			COUNT(DISTINCT CASE WHEN total_score ` + better + ` ? THEN total_score END) AS better_scores
+		FROM players WHERE 1 = 1`
+	args := []interface{}{player.TotalScore, player.TotalScore, player.UpdatedAt, player.UpdatedAt, playerID, player.TotalScore}
+	if filter.Country != "" {
+		query += ` AND country = ?`
+		args = append(args, filter.Country)
+	}
+	if filter.MinLevel != 0 {
+		query += ` AND level >= ?`
+		args = append(args, filter.MinLevel)
+	}
+	if filter.MaxLevel != 0 {
+		query += ` AND level <= ?`
+		args = append(args, filter.MaxLevel)
+	}
+	if len(excludeIDs) > 0 {
+		query += ` AND id NOT IN (?)`
+		args = append(args, excludeIDs)
+		if query, args, err = sqlx.In(query, args...); err != nil {
+			return nil, fmt.Errorf("failed to build filtered rank query: %w", err)
+		}
+	}
+
+	var counts struct {
+		Total        int64 `db:"total"`
+		Ahead        int64 `db:"ahead"`
+		BetterScores int64 `db:"better_scores"`
+	}
+	if err := m.db.GetContext(ctx, &counts, m.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("failed to get filtered rank: %w", err)
+	}
+
+	rankInfo := &model.FilteredRankInfo{
+		PlayerID: playerID,
+		Rank:     counts.Ahead + 1,
+		Score:    player.TotalScore,
+		Total:    counts.Total,
+		InSubset: filter.Matches(model.PlayerAttributes{Country: player.Country, Level: player.Level}),
+		Filter:   filter,
+	}
+	if dense {
+		rankInfo.Rank = counts.BetterScores + 1
+	}
+	return rankInfo, nil
+}
+
 // GetPlayer 获取玩家信息
 func (m *MySQLRepository) GetPlayer(ctx context.Context, playerID string) (*model.Player, error) {
+	ctx, span := startSpan(ctx, "GetPlayer")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
 	var player model.Player
 	query := `SELECT id, name, total_score, created_at, updated_at FROM players WHERE id = ?`
 
@@ -70,12 +637,166 @@ func (m *MySQLRepository) GetPlayer(ctx context.Context, playerID string) (*mode
 	return &player, nil
 }
 
-// GetTopPlayersFromDB 从数据库获取前N名玩家（用于数据恢复）
+// GetScoreHistory 获取玩家分数变更历史，按时间倒序
+func (m *MySQLRepository) GetScoreHistory(ctx context.Context, playerID string, limit, offset int) ([]*model.PlayerScoreHistory, error) {
+	ctx, span := startSpan(ctx, "GetScoreHistory")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	history := make([]*model.PlayerScoreHistory, 0)
+	query := `SELECT id, player_id, raw_score_change, score_change, final_score, reason, created_at
+			  FROM player_score_history
+			  WHERE player_id = ?
+			  ORDER BY created_at DESC, id DESC
+			  LIMIT ? OFFSET ?`
+
+	err := m.db.SelectContext(ctx, &history, query, playerID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get score history: %w", err)
+	}
+
+	return history, nil
+}
+
+// GetDailyScoreDeltas 按天汇总玩家最近 days 天（含今天）的分数变化，按日期升序，没有变化的日期不返回
+// 日期按 MySQL 会话时区（time_zone）划分，created_at 为 TIMESTAMP，会按该时区转换后取日期
+func (m *MySQLRepository) GetDailyScoreDeltas(ctx context.Context, playerID string, days int) ([]*model.DailyScoreDelta, error) {
+	ctx, span := startSpan(ctx, "GetDailyScoreDeltas")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	deltas := make([]*model.DailyScoreDelta, 0)
+	err := m.db.SelectContext(ctx, &deltas,
+		`SELECT DATE_FORMAT(created_at, '%Y-%m-%d') AS date, SUM(score_change) AS delta
+		 FROM player_score_history
+		 WHERE player_id = ? AND created_at >= CURDATE() - INTERVAL ? DAY
+		 GROUP BY date
+		 ORDER BY date`, playerID, days-1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily score deltas: %w", err)
+	}
+	return deltas, nil
+}
+
+// GetPlayerNames 批量获取玩家名称，返回 playerID -> name，不存在的玩家不包含在结果中
+func (m *MySQLRepository) GetPlayerNames(ctx context.Context, playerIDs []string) (map[string]string, error) {
+	ctx, span := startSpan(ctx, "GetPlayerNames")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	names := make(map[string]string, len(playerIDs))
+	if len(playerIDs) == 0 {
+		return names, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT id, name FROM players WHERE id IN (?)`, playerIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build player names query: %w", err)
+	}
+
+	var rows []struct {
+		ID   string `db:"id"`
+		Name string `db:"name"`
+	}
+	if err := m.db.SelectContext(ctx, &rows, m.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("failed to get player names: %w", err)
+	}
+
+	for _, row := range rows {
+		names[row.ID] = row.Name
+	}
+
+	return names, nil
+}
+
+// 转义 LIKE 中的通配符和转义符（MySQL 默认转义符为反斜杠）
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchPlayersByName 按名称前缀搜索玩家，按名称排序，最多返回 limit 个
+// 使用 idx_name 索引，是否区分大小写和重音由 name 列的排序规则决定（utf8mb4_0900_ai_ci 下均不区分）
+func (m *MySQLRepository) SearchPlayersByName(ctx context.Context, query string, limit int) ([]*model.Player, error) {
+	ctx, span := startSpan(ctx, "SearchPlayersByName")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	pattern := likeEscaper.Replace(query) + "%"
+
+	players := make([]*model.Player, 0)
+	err := m.db.SelectContext(ctx, &players,
+		`SELECT id, name, total_score, created_at, updated_at FROM players WHERE name LIKE ? ORDER BY name LIMIT ?`,
+		pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search players: %w", err)
+	}
+
+	return players, nil
+}
+
+// GetPlayersByIDs 批量获取玩家，返回 playerID -> 玩家，不存在的玩家不包含在结果中
+func (m *MySQLRepository) GetPlayersByIDs(ctx context.Context, playerIDs []string) (map[string]*model.Player, error) {
+	ctx, span := startSpan(ctx, "GetPlayersByIDs")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	players := make(map[string]*model.Player, len(playerIDs))
+	if len(playerIDs) == 0 {
+		return players, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT id, name, total_score, created_at, updated_at FROM players WHERE id IN (?)`, playerIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build players query: %w", err)
+	}
+
+	var rows []*model.Player
+	if err := m.db.SelectContext(ctx, &rows, m.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("failed to get players: %w", err)
+	}
+
+	for _, player := range rows {
+		players[player.ID] = player
+	}
+
+	return players, nil
+}
+
+// GetRecentlyActivePlayers 按最近得分时间倒序获取玩家，用于启动时预热缓存
+func (m *MySQLRepository) GetRecentlyActivePlayers(ctx context.Context, limit int) ([]*model.Player, error) {
+	ctx, span := startSpan(ctx, "GetRecentlyActivePlayers")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	var players []*model.Player
+	query := `SELECT id, name, total_score, created_at, updated_at
+			  FROM players
+			  ORDER BY updated_at DESC
+			  LIMIT ?`
+
+	err := m.db.SelectContext(ctx, &players, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recently active players: %w", err)
+	}
+
+	return players, nil
+}
+
+// GetTopPlayersFromDB 从数据库获取前N名玩家（用于数据恢复），同分时先得到该分数的玩家在前
 func (m *MySQLRepository) GetTopPlayersFromDB(ctx context.Context, limit int) ([]*model.Player, error) {
+	ctx, span := startSpan(ctx, "GetTopPlayersFromDB")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
 	var players []*model.Player
 	query := `SELECT id, name, total_score, created_at, updated_at 
 			  FROM players 
-			  ORDER BY total_score DESC, updated_at ASC 
+			  ORDER BY total_score DESC, updated_at ASC, id DESC
 			  LIMIT ?`
 
 	err := m.db.SelectContext(ctx, &players, query, limit)
@@ -86,8 +807,38 @@ func (m *MySQLRepository) GetTopPlayersFromDB(ctx context.Context, limit int) ([
 	return players, nil
 }
 
+// GetRankedPlayers 按排行榜顺序从数据库获取前N名玩家，同分规则与 Redis 总榜一致
+// ascending 为 true 时分数低者在前，用于 Redis 不可用时的降级读取
+func (m *MySQLRepository) GetRankedPlayers(ctx context.Context, limit int, ascending bool) ([]*model.Player, error) {
+	ctx, span := startSpan(ctx, "GetRankedPlayers")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	order := "total_score DESC, updated_at ASC, id DESC"
+	if ascending {
+		order = "total_score ASC, updated_at ASC, id ASC"
+	}
+
+	var players []*model.Player
+	query := `SELECT id, name, total_score, created_at, updated_at
+			  FROM players
+			  ORDER BY ` + order + `
+			  LIMIT ?`
+
+	err := m.db.SelectContext(ctx, &players, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ranked players from db: %w", err)
+	}
+
+	return players, nil
+}
+
 // GetAllPlayers 获取所有玩家（用于数据恢复）
 func (m *MySQLRepository) GetAllPlayers(ctx context.Context) ([]*model.Player, error) {
+	ctx, span := startSpan(ctx, "GetAllPlayers")
+	defer span.End()
+
 	var players []*model.Player
 	query := `SELECT id, name, total_score, created_at, updated_at FROM players`
 
@@ -99,8 +850,96 @@ func (m *MySQLRepository) GetAllPlayers(ctx context.Context) ([]*model.Player, e
 	return players, nil
 }
 
+// GetScoreBuckets 按 FLOOR(total_score/size) 对 players 表中的所有玩家（包括不在 Redis 排行榜上的玩家）分组计数
+// 按分数从低到高返回，最多 limit 组
+func (m *MySQLRepository) GetScoreBuckets(ctx context.Context, size int64, limit int) ([]model.ScoreBucket, error) {
+	ctx, span := startSpan(ctx, "GetScoreBuckets")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	var rows []struct {
+		Bucket int64 `db:"bucket"`
+		Count  int64 `db:"count"`
+	}
+	query := `SELECT FLOOR(total_score / ?) AS bucket, COUNT(*) AS count
+			  FROM players
+			  GROUP BY bucket
+			  ORDER BY bucket
+			  LIMIT ?`
+	if err := m.db.SelectContext(ctx, &rows, query, size, limit); err != nil {
+		return nil, fmt.Errorf("failed to get score buckets: %w", err)
+	}
+
+	buckets := make([]model.ScoreBucket, 0, len(rows))
+	for _, row := range rows {
+		buckets = append(buckets, model.ScoreBucket{
+			MinScore: row.Bucket * size,
+			MaxScore: row.Bucket*size + size - 1,
+			Count:    row.Count,
+		})
+	}
+
+	return buckets, nil
+}
+
+// CountScoreData 统计有分数的玩家数和分数历史记录数，用于重置前预估
+func (m *MySQLRepository) CountScoreData(ctx context.Context) (int64, int64, error) {
+	ctx, span := startSpan(ctx, "CountScoreData")
+	defer span.End()
+
+	var players, histories int64
+	if err := m.db.GetContext(ctx, &players, `SELECT COUNT(*) FROM players WHERE total_score <> 0`); err != nil {
+		return 0, 0, fmt.Errorf("failed to count players: %w", err)
+	}
+	if err := m.db.GetContext(ctx, &histories, `SELECT COUNT(*) FROM player_score_history`); err != nil {
+		return 0, 0, fmt.Errorf("failed to count score history: %w", err)
+	}
+
+	return players, histories, nil
+}
+
+// ResetScores 在一个事务中将所有玩家分数清零并删除分数历史，保留玩家名称，返回受影响的玩家数和历史记录数
+func (m *MySQLRepository) ResetScores(ctx context.Context) (int64, int64, error) {
+	ctx, span := startSpan(ctx, "ResetScores")
+	defer span.End()
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE players SET total_score = 0, updated_at = NOW() WHERE total_score <> 0`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to reset player scores: %w", err)
+	}
+	players, _ := result.RowsAffected()
+
+	// TRUNCATE 会隐式提交事务，这里使用 DELETE 保证与分数清零一起回滚
+	result, err = tx.ExecContext(ctx, `DELETE FROM player_score_history`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete score history: %w", err)
+	}
+	histories, _ := result.RowsAffected()
+
+	// 分数已清零，未到期的临时分数不再扣回
+	if _, err := tx.ExecContext(ctx, `DELETE FROM score_expirations`); err != nil {
+		return 0, 0, fmt.Errorf("failed to delete score expirations: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit score reset: %w", err)
+	}
+
+	return players, histories, nil
+}
+
 // SaveLeaderboardSnapshot 保存排行榜快照
 func (m *MySQLRepository) SaveLeaderboardSnapshot(ctx context.Context, snapshotData []byte, playerCount int) error {
+	ctx, span := startSpan(ctx, "SaveLeaderboardSnapshot")
+	defer span.End()
+
 	query := `INSERT INTO leaderboard_snapshots (snapshot_data, player_count, created_at) VALUES (?, ?, NOW())`
 
 	_, err := m.db.ExecContext(ctx, query, snapshotData, playerCount)
@@ -111,6 +950,193 @@ func (m *MySQLRepository) SaveLeaderboardSnapshot(ctx context.Context, snapshotD
 	return nil
 }
 
+// ListSnapshots 按创建时间倒序分页列出排行榜快照及快照总数，不读取 snapshot_data
+// 按主键倒序排序（ID 与创建时间顺序一致），LIMIT/OFFSET 直接走主键索引，无需额外索引；
+// 快照很多时深分页仍需扫描 offset 行，可改为按 id < 上一页最小 ID 翻页
+func (m *MySQLRepository) ListSnapshots(ctx context.Context, limit, offset int) ([]*model.LeaderboardSnapshot, int64, error) {
+	ctx, span := startSpan(ctx, "ListSnapshots")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	snapshots := make([]*model.LeaderboardSnapshot, 0)
+	query := `SELECT id, player_count, created_at
+			  FROM leaderboard_snapshots
+			  ORDER BY id DESC
+			  LIMIT ? OFFSET ?`
+	if err := m.db.SelectContext(ctx, &snapshots, query, limit, offset); err != nil {
+		return nil, 0, fmt.Errorf("failed to list leaderboard snapshots: %w", err)
+	}
+
+	var total int64
+	if err := m.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM leaderboard_snapshots`); err != nil {
+		return nil, 0, fmt.Errorf("failed to count leaderboard snapshots: %w", err)
+	}
+
+	return snapshots, total, nil
+}
+
+// PruneSnapshots 删除旧的排行榜快照，返回删除的行数
+// keepCount 大于 0 时最近的 keepCount 个快照不删除，before 非零时晚于 before 创建的快照不删除，两者都未指定时不删除
+func (m *MySQLRepository) PruneSnapshots(ctx context.Context, keepCount int, before time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "PruneSnapshots")
+	defer span.End()
+
+	var conditions []string
+	var args []interface{}
+
+	if keepCount > 0 {
+		// 第 keepCount 新的快照 ID 作为边界，快照不足 keepCount 个时无需删除
+		var boundaryID int64
+		query := `SELECT id FROM leaderboard_snapshots ORDER BY id DESC LIMIT 1 OFFSET ?`
+		if err := m.db.GetContext(ctx, &boundaryID, query, keepCount-1); err != nil {
+			if err == sql.ErrNoRows {
+				return 0, nil
+			}
+			return 0, fmt.Errorf("failed to find snapshot retention boundary: %w", err)
+		}
+		conditions = append(conditions, "id < ?")
+		args = append(args, boundaryID)
+	}
+	if !before.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, before)
+	}
+	if len(conditions) == 0 {
+		return 0, nil
+	}
+
+	result, err := m.db.ExecContext(ctx, `DELETE FROM leaderboard_snapshots WHERE `+strings.Join(conditions, " AND "), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune leaderboard snapshots: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// 恢复快照时每条 INSERT 写入的玩家数
+const restoreBatchSize = 500
+
+// GetSnapshot 获取排行榜快照，id 为 0 时返回最新的快照，不存在时返回 ErrNoSnapshot
+func (m *MySQLRepository) GetSnapshot(ctx context.Context, id int64) (*model.LeaderboardSnapshot, error) {
+	ctx, span := startSpan(ctx, "GetSnapshot")
+	defer span.End()
+	ctx, cancel := m.withOpTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, snapshot_data, player_count, created_at FROM leaderboard_snapshots WHERE id = ?`
+	args := []interface{}{id}
+	if id == 0 {
+		query = `SELECT id, snapshot_data, player_count, created_at FROM leaderboard_snapshots ORDER BY id DESC LIMIT 1`
+		args = nil
+	}
+
+	var snapshot model.LeaderboardSnapshot
+	if err := m.db.GetContext(ctx, &snapshot, query, args...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNoSnapshot
+		}
+		return nil, fmt.Errorf("failed to get leaderboard snapshot: %w", err)
+	}
+
+	return &snapshot, nil
+}
+
+// RestorePlayerScores 在一个事务中将玩家分数恢复为 players 中的值：先将所有玩家分数清零，
+// 再按快照写入名称、分数和 updated_at（保持同分时的先后顺序），并取消未到期的临时分数；分数历史保持不变
+func (m *MySQLRepository) RestorePlayerScores(ctx context.Context, players []*model.Player) error {
+	ctx, span := startSpan(ctx, "RestorePlayerScores")
+	defer span.End()
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE players SET total_score = 0, updated_at = NOW() WHERE total_score <> 0`); err != nil {
+		return fmt.Errorf("failed to reset player scores: %w", err)
+	}
+
+	// 恢复后的分数中已不包含这些临时分数，到期时不应再扣回
+	if _, err := tx.ExecContext(ctx, `DELETE FROM score_expirations WHERE reverted_at IS NULL`); err != nil {
+		return fmt.Errorf("failed to cancel score expirations: %w", err)
+	}
+
+	for start := 0; start < len(players); start += restoreBatchSize {
+		end := start + restoreBatchSize
+		if end > len(players) {
+			end = len(players)
+		}
+
+		batch := players[start:end]
+		query := `INSERT INTO players (id, name, total_score, created_at, updated_at) VALUES ` +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?),", len(batch)), ",") + `
+			ON DUPLICATE KEY UPDATE
+				name = VALUES(name),
+				total_score = VALUES(total_score),
+				updated_at = VALUES(updated_at)`
+		args := make([]interface{}, 0, len(batch)*5)
+		for _, player := range batch {
+			args = append(args, player.ID, player.Name, player.TotalScore, player.CreatedAt, player.UpdatedAt)
+		}
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore player scores: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit score restore: %w", err)
+	}
+
+	return nil
+}
+
+// VerifySchema 检查当前数据库中是否存在服务依赖的表和字段，缺失时返回包含全部缺失项的错误
+func (m *MySQLRepository) VerifySchema(ctx context.Context) error {
+	var columns []struct {
+		Table  string `db:"table_name"`
+		Column string `db:"column_name"`
+	}
+	query := `SELECT table_name AS table_name, column_name AS column_name
+			  FROM information_schema.columns
+			  WHERE table_schema = DATABASE()`
+
+	if err := m.db.SelectContext(ctx, &columns, query); err != nil {
+		return fmt.Errorf("failed to query information_schema: %w", err)
+	}
+
+	existing := make(map[string]map[string]bool)
+	for _, col := range columns {
+		if existing[col.Table] == nil {
+			existing[col.Table] = make(map[string]bool)
+		}
+		existing[col.Table][col.Column] = true
+	}
+
+	missing := make([]string, 0)
+	for table, required := range requiredSchema {
+		tableColumns, ok := existing[table]
+		if !ok {
+			missing = append(missing, "table "+table)
+			continue
+		}
+		for _, column := range required {
+			if !tableColumns[column] {
+				missing = append(missing, "column "+table+"."+column)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: missing %s", ErrSchemaMismatch, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
 // HealthCheck 健康检查
 func (m *MySQLRepository) HealthCheck(ctx context.Context) error {
 	return m.db.PingContext(ctx)
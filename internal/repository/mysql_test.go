@@ -0,0 +1,300 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"game-leaderboard/internal/model"
+)
+
+var playerColumns = []string{"id", "name", "total_score", "created_at", "updated_at"}
+
+func playerRow(id, name string, score int64) []driver.Value {
+	t := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []driver.Value{id, name, score, t, t}
+}
+
+// 只校验查询条件和结果映射：不区分大小写、重音的匹配和按语言规则的排序由 name 列的排序规则在 MySQL 中完成，
+// 假驱动不执行 SQL，这里不覆盖；排序规则和索引由 TestPlayerNameCollationMigration 校验迁移脚本，未在真实 MySQL 上验证
+func TestSearchPlayersByName(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantPattern string
+		rows        [][]driver.Value
+		wantNames   []string
+	}{
+		{
+			name:        "results keep the database order",
+			query:       "Jo",
+			wantPattern: "Jo%",
+			rows:        [][]driver.Value{playerRow("p1", "joan", 10), playerRow("p2", "José", 20)},
+			wantNames:   []string{"joan", "José"},
+		},
+		{
+			// 多字节字符原样作为前缀，不被截断或转义
+			name:        "accented prefix",
+			query:       "José",
+			wantPattern: "José%",
+		},
+		{
+			name:        "cjk prefix",
+			query:       "张",
+			wantPattern: "张%",
+		},
+		{
+			name:        "like wildcards are matched literally",
+			query:       `50%_off\`,
+			wantPattern: `50\%\_off\\%`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, db := newFakeMySQL(t, 0, func(query string, args []driver.Value) fakeResult {
+				return fakeResult{columns: playerColumns, rows: tt.rows}
+			})
+
+			players, err := repo.SearchPlayersByName(context.Background(), tt.query, 20)
+			if err != nil {
+				t.Fatalf("SearchPlayersByName() error = %v", err)
+			}
+
+			statements := db.Statements()
+			if len(statements) != 1 {
+				t.Fatalf("statements = %d, want 1", len(statements))
+			}
+			stmt := statements[0]
+			if !strings.Contains(stmt.query, "name LIKE ?") || !strings.Contains(stmt.query, "ORDER BY name") {
+				t.Errorf("query = %q, want a LIKE prefix match ordered by name", stmt.query)
+			}
+			if stmt.args[0] != tt.wantPattern || stmt.args[1] != int64(20) {
+				t.Errorf("args = %v, want [%q 20]", stmt.args, tt.wantPattern)
+			}
+
+			if len(players) != len(tt.wantNames) {
+				t.Fatalf("players = %d, want %d", len(players), len(tt.wantNames))
+			}
+			for i, player := range players {
+				if player.Name != tt.wantNames[i] {
+					t.Errorf("players[%d].Name = %q, want %q", i, player.Name, tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+// 名称搜索依赖迁移 003 的排序规则（前缀匹配不区分大小写和重音、按语言规则排序）和 idx_name 索引（前缀匹配走索引）
+// 只检查迁移脚本的内容，没有在真实 MySQL 上执行迁移或查询
+func TestPlayerNameCollationMigration(t *testing.T) {
+	data, err := os.ReadFile("../../migrations/003_player_name_collation.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	migration := strings.Join(strings.Fields(string(data)), " ")
+
+	for _, want := range []string{
+		"MODIFY name VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci",
+		"ADD INDEX idx_name (name)",
+	} {
+		if !strings.Contains(migration, want) {
+			t.Errorf("migration 003 does not contain %q", want)
+		}
+	}
+}
+
+func TestVerifySchema(t *testing.T) {
+	tests := []struct {
+		name        string
+		drop        func(table, column string) bool
+		wantMissing string
+	}{
+		{
+			name: "complete schema",
+			drop: func(table, column string) bool { return false },
+		},
+		{
+			name:        "missing column",
+			drop:        func(table, column string) bool { return table == "players" && column == "country" },
+			wantMissing: "missing column players.country",
+		},
+		{
+			name:        "missing table",
+			drop:        func(table, column string) bool { return table == "score_expirations" },
+			wantMissing: "missing table score_expirations",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows [][]driver.Value
+			for table, columns := range requiredSchema {
+				for _, column := range columns {
+					if !tt.drop(table, column) {
+						rows = append(rows, []driver.Value{table, column})
+					}
+				}
+			}
+			repo, _ := newFakeMySQL(t, 0, func(query string, args []driver.Value) fakeResult {
+				return fakeResult{columns: []string{"table_name", "column_name"}, rows: rows}
+			})
+
+			err := repo.VerifySchema(context.Background())
+			if tt.wantMissing == "" {
+				if err != nil {
+					t.Fatalf("VerifySchema() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrSchemaMismatch) {
+				t.Fatalf("VerifySchema() error = %v, want ErrSchemaMismatch", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantMissing) {
+				t.Errorf("VerifySchema() error = %q, want it to contain %q", err, tt.wantMissing)
+			}
+		})
+	}
+}
+
+// 分组由 MySQL 完成，这里校验查询条件以及分组编号到分数区间的换算
+func TestGetScoreBuckets(t *testing.T) {
+	repo, db := newFakeMySQL(t, 0, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{
+			columns: []string{"bucket", "count"},
+			rows:    [][]driver.Value{{int64(-1), int64(2)}, {int64(0), int64(5)}, {int64(12), int64(1)}},
+		}
+	})
+
+	buckets, err := repo.GetScoreBuckets(context.Background(), 100, 50)
+	if err != nil {
+		t.Fatalf("GetScoreBuckets() error = %v", err)
+	}
+
+	stmt := db.Statements()[0]
+	if !strings.Contains(stmt.query, "FLOOR(total_score / ?)") || !strings.Contains(stmt.query, "GROUP BY bucket") {
+		t.Errorf("query = %q, want FLOOR(total_score / ?) grouped by bucket", stmt.query)
+	}
+	if len(stmt.args) != 2 || stmt.args[0] != int64(100) || stmt.args[1] != int64(50) {
+		t.Errorf("args = %v, want [100 50]", stmt.args)
+	}
+
+	want := []model.ScoreBucket{
+		{MinScore: -100, MaxScore: -1, Count: 2},
+		{MinScore: 0, MaxScore: 99, Count: 5},
+		{MinScore: 1200, MaxScore: 1299, Count: 1},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("buckets = %v, want %v", buckets, want)
+	}
+	for i := range want {
+		if buckets[i] != want[i] {
+			t.Errorf("buckets[%d] = %+v, want %+v", i, buckets[i], want[i])
+		}
+	}
+}
+
+// 计数由 MySQL 完成，这里校验筛选条件、排除列表和由计数得到的排名
+func TestGetFilteredRank(t *testing.T) {
+	updatedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo, db := newFakeMySQL(t, 0, func(query string, args []driver.Value) fakeResult {
+		if strings.Contains(query, "WHERE id = ?") {
+			return fakeResult{
+				columns: []string{"country", "level", "total_score", "updated_at"},
+				rows:    [][]driver.Value{{"JP", int64(20), int64(600), updatedAt}},
+			}
+		}
+		return fakeResult{
+			columns: []string{"total", "ahead", "better_scores"},
+			rows:    [][]driver.Value{{int64(4), int64(3), int64(2)}},
+		}
+	})
+
+	filter := model.PlayerFilter{Country: "JP", MinLevel: 15, MaxLevel: 35}
+	for _, dense := range []bool{false, true} {
+		rankInfo, err := repo.GetFilteredRank(context.Background(), "p5", filter, []string{"p2", "p7"}, dense, false)
+		if err != nil {
+			t.Fatalf("GetFilteredRank() error = %v", err)
+		}
+		wantRank := int64(4)
+		if dense {
+			wantRank = 3
+		}
+		if rankInfo.Rank != wantRank || rankInfo.Total != 4 || !rankInfo.InSubset {
+			t.Errorf("dense=%v: rank %d of %d, inSubset %v, want rank %d of 4 in subset", dense, rankInfo.Rank, rankInfo.Total, rankInfo.InSubset, wantRank)
+		}
+	}
+
+	stmt := db.Statements()[1]
+	for _, clause := range []string{"country = ?", "level >= ?", "level <= ?", "id NOT IN (?, ?)"} {
+		if !strings.Contains(stmt.query, clause) {
+			t.Errorf("query = %q, want %q", stmt.query, clause)
+		}
+	}
+	wantTail := []driver.Value{"JP", int64(15), int64(35), "p2", "p7"}
+	if len(stmt.args) < len(wantTail) {
+		t.Fatalf("args = %v, want to end with %v", stmt.args, wantTail)
+	}
+	for i, want := range wantTail {
+		if got := stmt.args[len(stmt.args)-len(wantTail)+i]; got != want {
+			t.Errorf("args = %v, want to end with %v", stmt.args, wantTail)
+			break
+		}
+	}
+}
+
+// 数据库响应慢时，单次操作在 opTimeout 到达时中止；调用方的截止时间更早时以其为准
+func TestMySQLOpTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		opTimeout   time.Duration
+		callerLimit time.Duration
+		wantMax     time.Duration
+	}{
+		{name: "op timeout", opTimeout: 50 * time.Millisecond, wantMax: 500 * time.Millisecond},
+		{name: "earlier caller deadline", opTimeout: time.Hour, callerLimit: 50 * time.Millisecond, wantMax: 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, db := newFakeMySQL(t, 0, nil)
+			repo.opTimeout = tt.opTimeout
+			db.delay = 5 * time.Second
+
+			ctx := context.Background()
+			if tt.callerLimit > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.callerLimit)
+				defer cancel()
+			}
+
+			start := time.Now()
+			_, err := repo.GetPlayer(ctx, "p1")
+			if elapsed := time.Since(start); elapsed > tt.wantMax {
+				t.Errorf("GetPlayer() took %v, want it aborted within %v", elapsed, tt.wantMax)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("GetPlayer() error = %v, want context.DeadlineExceeded", err)
+			}
+
+			// 事务中的语句同样受限，超时后回滚
+			start = time.Now()
+			_, err = repo.ApplyScoreChange(ctx, "alice", &model.PlayerScoreHistory{PlayerID: "p1", ScoreChange: 10}, time.Time{})
+			if elapsed := time.Since(start); elapsed > tt.wantMax {
+				t.Errorf("ApplyScoreChange() took %v, want it aborted within %v", elapsed, tt.wantMax)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("ApplyScoreChange() error = %v, want context.DeadlineExceeded", err)
+			}
+			for _, stmt := range db.Statements() {
+				if stmt.query == "COMMIT" {
+					t.Error("transaction committed after the deadline")
+				}
+			}
+		})
+	}
+}
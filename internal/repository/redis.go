@@ -2,59 +2,513 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
 	"time"
 
+	"game-leaderboard/internal/metrics"
 	"game-leaderboard/internal/model"
 	"game-leaderboard/pkg/logger"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 const (
+	// KeyHashTag 排行榜相关 key 的哈希标签：集群模式下多键脚本和 MULTI 事务要求涉及的 key 位于同一槽位
+	// 只做单键操作的缓存和幂等键不带标签，可分布到各节点；升级前不带标签的 key 由 MigrateKeys 迁移
+	KeyHashTag = "{lb}"
+
 	// Redis Key 定义
-	LeaderboardKey     = "leaderboard:global"
-	PlayerKeyPrefix    = "player:"
+	LeaderboardKey = KeyHashTag + "leaderboard:global"
+	// 总榜中出现过的不同分数（Sorted Set，成员和分数均为该分数）及每个分数的玩家数（Hash），用于计算密集排名
+	DistinctScoresKey  = KeyHashTag + "leaderboard:global:distinct_scores"
+	ScoreCountsKey     = KeyHashTag + "leaderboard:global:score_counts"
+	PlayerKeyPrefix    = KeyHashTag + "player:"
 	PlayerCacheKey     = "player_cache"
 	TopPlayersCacheKey = "top_players_cache"
+	CacheSnapshotKey   = "cache_snapshot"               // 本地缓存快照，重启后用于预热
+	BlocklistKey       = KeyHashTag + "blocked_players" // 被封禁玩家集合，集合中的玩家不进入排行榜
+
+	// 总榜的排名顺序（Sorted Set，分数与总榜相同，成员为 rankOrderMember 编码的得分时间和玩家ID）及玩家ID到该成员的映射（Hash）
+	// 同分时按成员字典序排列即为先得到该分数者在前，见 rankOrderMember
+	RankOrderKey        = KeyHashTag + "leaderboard:global:order"
+	RankOrderMembersKey = KeyHashTag + "leaderboard:global:order_members"
+
+	// 先写 Redis 模式下等待写入 MySQL 的分数变更（List，元素为 JSON），按玩家分为 ScoreWritePartitions 个分区：
+	// 待处理、处理中队列的完整 key 形如 {lb}score_writes:pending:3；多次失败后的死信队列不分区
+	ScoreWritePendingKeyPrefix    = KeyHashTag + "score_writes:pending:"
+	ScoreWriteProcessingKeyPrefix = KeyHashTag + "score_writes:processing:"
+	ScoreWriteDeadKey             = KeyHashTag + "score_writes:dead"
+	// 分区租约（String，值为持有租约的实例ID，带过期时间），同一时刻只有持有租约的实例处理该分区
+	ScoreWriteLeaseKeyPrefix = KeyHashTag + "score_writes:lease:"
+
+	// 写入队列的分区数：同一玩家的变更总在同一分区，由一个实例按入队顺序写入 MySQL
+	ScoreWritePartitions = 8
+
+	// 分数更新幂等键（String），值为处理结果 JSON，处理中时为空字符串
+	IdempotencyKeyPrefix = "idempotency:"
+
+	// 后台预计算的排名：Hash（玩家ID -> 排名）及其计算时间
+	PrecomputedRankKey     = KeyHashTag + "precomputed_ranks"
+	PrecomputedRankTimeKey = KeyHashTag + "precomputed_ranks:computed_at"
+
+	// 玩家的历史最佳排名：Hash（玩家ID -> 1-based 名次）及达到该名次的时间（Hash，玩家ID -> Unix 秒）
+	PeakRankKey     = KeyHashTag + "leaderboard:global:peak_ranks"
+	PeakRankTimeKey = KeyHashTag + "leaderboard:global:peak_ranks:achieved_at"
+
+	// 升级前的 key 已迁移到带 KeyHashTag 名称的标记，见 MigrateKeys
+	KeyMigrationMarkerKey = KeyHashTag + "migrations:hash_tag"
+
+	// 玩家详情 Hash 的过期时间
+	playerInfoTTL = 7 * 24 * time.Hour
+
+	// 分页遍历排行榜时的默认每页数量
+	defaultIteratePageSize = 1000
+
+	// 时间窗口排行榜 key 前缀，完整 key 形如 {lb}leaderboard:daily:2024-06-01
+	WindowKeyPrefix = KeyHashTag + "leaderboard:"
+)
+
+// 排名顺序
+const (
+	RankOrderDesc = "desc" // 分数高者排名靠前（默认）
+	RankOrderAsc  = "asc"  // 分数低者排名靠前，如高尔夫计杆
+)
+
+// 时间窗口排行榜类型
+const (
+	WindowDaily   = "daily"
+	WindowWeekly  = "weekly"
+	WindowMonthly = "monthly"
 )
 
+// 各时间窗口 key 的过期时间，保留上一个周期供查询后自动过期
+var windowTTLs = map[string]time.Duration{
+	WindowDaily:   2 * 24 * time.Hour,
+	WindowWeekly:  14 * 24 * time.Hour,
+	WindowMonthly: 62 * 24 * time.Hour,
+}
+
+// 写入总榜的脚本共用的分数计数和排名顺序维护函数
+// KEYS[1]: 总榜, KEYS[2]: DistinctScoresKey, KEYS[3]: ScoreCountsKey, KEYS[4]: RankOrderKey, KEYS[5]: RankOrderMembersKey
+// 分数统一使用 Redis 返回的字符串形式，保证同一分数在计数 Hash 中只有一个字段
+const scoreIndexLua = `
+local function release(score)
+	if redis.call('HINCRBY', KEYS[3], score, -1) <= 0 then
+		redis.call('HDEL', KEYS[3], score)
+		redis.call('ZREM', KEYS[2], score)
+	end
+end
+local function retain(score)
+	if redis.call('HINCRBY', KEYS[3], score, 1) == 1 then
+		redis.call('ZADD', KEYS[2], score, score)
+	end
+end
+local function unorder(member)
+	local old = redis.call('HGET', KEYS[5], member)
+	if old then
+		redis.call('ZREM', KEYS[4], old)
+		redis.call('HDEL', KEYS[5], member)
+	end
+end
+local function reorder(member, order, score)
+	unorder(member)
+	redis.call('ZADD', KEYS[4], score, order)
+	redis.call('HSET', KEYS[5], member, order)
+end
+`
+
+// writeScoreScript 原子地设置或增加玩家分数，同步维护不同分数索引和排名顺序，可选刷新玩家信息
+// 每次写入都以本次的得分时间重新排序，与 MySQL 中的 updated_at 一致
+// KEYS[6]: 玩家信息 key（可选）
+// ARGV[1]: 玩家ID, ARGV[2]: set 或 incr, ARGV[3]: 分数或增量, ARGV[4]: 排名顺序成员,
+// ARGV[5]: incr 时玩家不在总榜上则直接写入的总分（为空时从 0 累加）,
+// ARGV[6]: 玩家名称, ARGV[7]: 更新时间, ARGV[8]: 过期秒数
+var writeScoreScript = redis.NewScript(scoreIndexLua + `
+local old = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if ARGV[2] == 'incr' and (old or ARGV[5] == '') then
+	redis.call('ZINCRBY', KEYS[1], ARGV[3], ARGV[1])
+elseif ARGV[2] == 'incr' then
+	redis.call('ZADD', KEYS[1], ARGV[5], ARGV[1])
+else
+	redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+end
+local new = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if old ~= new then
+	if old then
+		release(old)
+	end
+	retain(new)
+end
+reorder(ARGV[1], ARGV[4], new)
+if KEYS[6] then
+	redis.call('HSET', KEYS[6], 'name', ARGV[6], 'updated_at', ARGV[7])
+	redis.call('EXPIRE', KEYS[6], ARGV[8])
+end
+return new
+`)
+
+// trimScript 总榜人数超过上限时移除排名最后的玩家，同步维护不同分数索引和排名顺序，返回被移除的玩家ID
+// 每次最多移除 ARGV[3] 人，剩余的在之后的写入中继续移除，避免单次执行阻塞 Redis 过久
+// 玩家信息 key 无法事先确定，不能通过 KEYS 传入，由调用方根据返回的玩家ID删除
+// ARGV[1]: 人数上限, ARGV[2]: asc 或 desc, ARGV[3]: 单次最多移除人数
+var trimScript = redis.NewScript(scoreIndexLua + `
+local excess = redis.call('ZCARD', KEYS[1]) - tonumber(ARGV[1])
+if excess <= 0 then
+	return {}
+end
+excess = math.min(excess, tonumber(ARGV[3]))
+local orders
+if ARGV[2] == 'asc' then
+	orders = redis.call('ZRANGE', KEYS[4], -excess, -1)
+else
+	orders = redis.call('ZRANGE', KEYS[4], 0, excess - 1)
+end
+local removed = {}
+for _, order in ipairs(orders) do
+	local member = string.sub(order, 13)
+	local score = redis.call('ZSCORE', KEYS[1], member)
+	if score then
+		redis.call('ZREM', KEYS[1], member)
+		release(score)
+		removed[#removed + 1] = member
+	end
+	unorder(member)
+end
+return removed
+`)
+
+// 每次写入后最多移除的超出上限的玩家数
+const trimBatchSize = 1000
+
+// 因超出总榜人数上限被移除的玩家数
+var playersTrimmed = promauto.With(metrics.Registerer).NewCounter(prometheus.CounterOpts{
+	Name: "leaderboard_players_trimmed_total",
+	Help: "Total number of players removed from the global leaderboard because it exceeded the configured maximum size",
+})
+
+// removeScoresScript 从总榜移除玩家并同步维护不同分数索引，ARGV 为玩家ID列表，返回移除的人数
+var removeScoresScript = redis.NewScript(scoreIndexLua + `
+local removed = 0
+for _, member in ipairs(ARGV) do
+	local score = redis.call('ZSCORE', KEYS[1], member)
+	if score then
+		redis.call('ZREM', KEYS[1], member)
+		release(score)
+		unorder(member)
+		removed = removed + 1
+	end
+end
+return removed
+`)
+
+// rebuildScoreIndexScript 按分数从低到高分批重建不同分数索引，ARGV[1] 为本批的分数下界（"-inf" 或 "(分数"），ARGV[2] 为本批读取的玩家数
+// 本批覆盖的分数区间内的计数直接以 ZCOUNT 重新计算，并移除索引中区间内已没有玩家的分数；返回本批的最高分数，没有更多玩家时返回 nil
+// 每批单独原子执行，已重建的区间由之后的写入增量维护，尚未重建的区间即使被并发写入修改，也会在轮到时被覆盖，因此无需暂停写入
+var rebuildScoreIndexScript = redis.NewScript(`
+local entries = redis.call('ZRANGEBYSCORE', KEYS[1], ARGV[1], '+inf', 'WITHSCORES', 'LIMIT', 0, tonumber(ARGV[2]))
+local last = '+inf'
+if #entries > 0 then
+	last = entries[#entries]
+end
+for _, score in ipairs(redis.call('ZRANGEBYSCORE', KEYS[2], ARGV[1], last)) do
+	if redis.call('ZCOUNT', KEYS[1], score, score) == 0 then
+		redis.call('ZREM', KEYS[2], score)
+		redis.call('HDEL', KEYS[3], score)
+	end
+end
+if #entries == 0 then
+	return false
+end
+local previous
+for i = 2, #entries, 2 do
+	local score = entries[i]
+	if score ~= previous then
+		redis.call('HSET', KEYS[3], score, redis.call('ZCOUNT', KEYS[1], score, score))
+		redis.call('ZADD', KEYS[2], score, score)
+		previous = score
+	end
+end
+return last
+`)
+
+// 重建不同分数索引和排名顺序时每批处理的玩家数，避免单次脚本或 pipeline 长时间阻塞 Redis
+const rebuildBatchSize = 1000
+
+// rebuildRankOrderScript 按调用方读取的得分时间为总榜中尚未排序的玩家补建排名顺序，返回是否补建了任何玩家
+// 排名顺序成员映射不存在时，残留的排名顺序先被清空；已有排名顺序的玩家（如补建期间的新写入）保持不变
+// ARGV: 依次为玩家ID和对应的排名顺序成员
+var rebuildRankOrderScript = redis.NewScript(scoreIndexLua + `
+if redis.call('EXISTS', KEYS[5]) == 0 then
+	redis.call('DEL', KEYS[4])
+end
+local ordered = 0
+for i = 1, #ARGV, 2 do
+	local member = ARGV[i]
+	local score = redis.call('ZSCORE', KEYS[1], member)
+	if score and redis.call('HEXISTS', KEYS[5], member) == 0 then
+		reorder(member, ARGV[i + 1], score)
+		ordered = 1
+	end
+end
+return ordered
+`)
+
+// rankScript 按排名顺序获取总榜成员的 0-based 名次，玩家不在榜上时返回 nil
+// ARGV[1]: 玩家ID, ARGV[2]: asc 或 desc
+var rankScript = redis.NewScript(`
+local order = redis.call('HGET', KEYS[2], ARGV[1])
+if not order then
+	return false
+end
+if ARGV[2] == 'asc' then
+	return redis.call('ZRANK', KEYS[1], order)
+end
+return redis.call('ZREVRANK', KEYS[1], order)
+`)
+
+// peakRankScript 按排名顺序计算玩家当前名次（1-based），优于已记录的最佳排名时更新，玩家不在榜上时返回 nil
+// KEYS: 排名顺序、排名顺序成员、最佳排名、最佳排名时间; ARGV[1]: 玩家ID, ARGV[2]: asc 或 desc, ARGV[3]: 当前时间（Unix 秒）
+var peakRankScript = redis.NewScript(`
+local order = redis.call('HGET', KEYS[2], ARGV[1])
+if not order then
+	return false
+end
+local rank
+if ARGV[2] == 'asc' then
+	rank = redis.call('ZRANK', KEYS[1], order)
+else
+	rank = redis.call('ZREVRANK', KEYS[1], order)
+end
+rank = rank + 1
+local best = tonumber(redis.call('HGET', KEYS[3], ARGV[1]) or '')
+if best and best <= rank then
+	return best
+end
+redis.call('HSET', KEYS[3], ARGV[1], rank)
+redis.call('HSET', KEYS[4], ARGV[1], ARGV[3])
+return rank
+`)
+
+// scoreWriteLeaseScript 获取或续期写入队列分区的租约：租约属于 ARGV[1] 时续期，不存在时获取，属于其他实例时返回 0
+// KEYS[1]: 租约; ARGV[1]: 实例ID, ARGV[2]: 有效期（毫秒）
+var scoreWriteLeaseScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if owner then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// releaseScoreWriteLeaseScript 释放 ARGV[1] 持有的分区租约，已被其他实例获取时不修改
+var releaseScoreWriteLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// requeueDeadScoreWriteScript 将死信队列中的一条变更移到所在分区待处理队列的尾部，已被移走时不重复入队
+// KEYS: 死信队列、分区待处理队列; ARGV[1]: 变更原始内容
+var requeueDeadScoreWriteScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('RPUSH', KEYS[2], ARGV[1])
+return 1
+`)
+
+// 写入总榜的脚本使用的 key
+var scoreIndexKeys = []string{LeaderboardKey, DistinctScoresKey, ScoreCountsKey, RankOrderKey, RankOrderMembersKey}
+
+// 排名顺序成员中得分时间的最大值（11 位秒数），desc 时以该值减去得分时间
+const rankOrderMaxTime = 99999999999
+
+// 排名顺序成员：11 位定长的得分时间（秒）+ ":" + 玩家ID
+// 同分成员按字典序排列，desc（ZREVRANGE 字典序倒序）时时间部分取 rankOrderMaxTime 减去得分时间，asc（ZRANGE）时直接使用得分时间，
+// 因此同分时先得到该分数的玩家在前；同一秒内得分时 desc 按玩家ID倒序、asc 按玩家ID正序，与 MySQL 的排序规则一致
+func (r *RedisRepository) rankOrderMember(playerID string, updatedAt time.Time) string {
+	ts := updatedAt.Unix()
+	if ts < 0 {
+		ts = 0
+	}
+	if !r.ascending {
+		ts = rankOrderMaxTime - ts
+	}
+	return fmt.Sprintf("%011d:%s", ts, playerID)
+}
+
+// 从排名顺序成员中取出玩家ID
+func rankOrderPlayerID(member string) string {
+	if i := strings.IndexByte(member, ':'); i >= 0 {
+		return member[i+1:]
+	}
+	return member
+}
+
+// 排名方向参数，传给需要区分排名顺序的脚本
+func (r *RedisRepository) orderArg() string {
+	if r.ascending {
+		return RankOrderAsc
+	}
+	return RankOrderDesc
+}
+
+// 写入分数的脚本参数，保存玩家信息时附带玩家信息 key
+// fallback 为 incr 时玩家不在总榜上则直接写入的总分，为 nil 时从 0 累加
+func (r *RedisRepository) writeScoreArgs(playerID, mode string, value int64, fallback *int64, name string, updatedAt time.Time) ([]string, []interface{}) {
+	fallbackArg := ""
+	if fallback != nil {
+		fallbackArg = strconv.FormatInt(*fallback, 10)
+	}
+	args := []interface{}{playerID, mode, value, r.rankOrderMember(playerID, updatedAt), fallbackArg}
+	if !r.storeMetadata {
+		return scoreIndexKeys, args
+	}
+
+	keys := append(append([]string{}, scoreIndexKeys...), PlayerKeyPrefix+playerID)
+	return keys, append(args, name, updatedAt.Unix(), int64(playerInfoTTL.Seconds()))
+}
+
 type RedisRepository struct {
-	client *redis.Client
+	client redis.UniversalClient
 	logger *logger.Logger
+	// 为 false 时 Redis 只保存排行榜分数，玩家名称等信息由 MySQL 提供
+	storeMetadata bool
+	// 为 true 时分数低者排名靠前（RankOrderAsc），总榜和时间窗口排行榜的排名、区间和密集排名均按此顺序
+	ascending bool
+	// 大于 0 时总榜只保留排名前 maxPlayers 的玩家，每次写入总榜后移除超出的部分
+	maxPlayers int
+	// 幂等命令（分数和排名读取、覆盖写入）遇到临时错误时的重试，客户端本身不重试
+	retry RetryOptions
 }
 
-func NewRedisRepository(client *redis.Client) *RedisRepository {
+// NewRedisRepository rankOrder 为 RankOrderDesc 或 RankOrderAsc，为空时按 RankOrderDesc 处理；maxPlayers 为 0 时总榜人数不限
+// retry 只作用于幂等命令，client 应关闭自身的重试（见 database.NewRedisConnection）
+func NewRedisRepository(client redis.UniversalClient, storeMetadata bool, rankOrder string, maxPlayers int, retry RetryOptions) *RedisRepository {
 	return &RedisRepository{
-		client: client,
-		logger: logger.NewLogger("redis_repository"),
+		client:        client,
+		logger:        logger.NewLogger("redis_repository"),
+		storeMetadata: storeMetadata,
+		ascending:     rankOrder == RankOrderAsc,
+		maxPlayers:    maxPlayers,
+		retry:         retry,
 	}
 }
 
-// UpdatePlayerScore 更新玩家分数（Redis Sorted Set）
-func (r *RedisRepository) UpdatePlayerScore(ctx context.Context, playerID string, score int64, name string) error {
-	// 使用 Sorted Set 存储排行榜，score 作为分数，playerID 作为成员
-	_, err := r.client.ZAdd(ctx, LeaderboardKey, &redis.Z{
-		Score:  float64(score),
-		Member: playerID,
-	}).Result()
+// 总榜人数超过上限时移除排名最后的玩家，未设置上限时不做处理
+// 移除失败只记录日志，之后的写入会继续移除
+func (r *RedisRepository) trim(ctx context.Context) {
+	if r.maxPlayers <= 0 {
+		return
+	}
+
+	removed, err := trimScript.Run(ctx, r.client, scoreIndexKeys, r.maxPlayers, r.orderArg(), trimBatchSize).StringSlice()
 	if err != nil {
-		return fmt.Errorf("failed to update player score in redis: %w", err)
+		r.logger.Warn("Failed to trim leaderboard", "maxPlayers", r.maxPlayers, "error", err)
+		return
+	}
+	if len(removed) == 0 {
+		return
+	}
+	playersTrimmed.Add(float64(len(removed)))
+	r.logger.Debug("Trimmed leaderboard", "removed", len(removed), "maxPlayers", r.maxPlayers)
+
+	// 玩家信息 Hash 删除失败时随过期时间清理
+	if r.storeMetadata {
+		keys := make([]string, len(removed))
+		for i, playerID := range removed {
+			keys[i] = PlayerKeyPrefix + playerID
+		}
+		if err := r.client.Del(ctx, keys...).Err(); err != nil {
+			r.logger.Warn("Failed to delete trimmed player info", "count", len(keys), "error", err)
+		}
 	}
+}
+
+// StoresMetadata 返回玩家名称等信息是否保存在 Redis 中
+func (r *RedisRepository) StoresMetadata() bool {
+	return r.storeMetadata
+}
+
+// Ascending 返回是否分数低者排名靠前
+func (r *RedisRepository) Ascending() bool {
+	return r.ascending
+}
 
-	// 存储玩家详细信息
-	playerInfo := map[string]interface{}{
-		"name":       name,
-		"updated_at": time.Now().Unix(),
+// 按排名顺序读取有序集合中 0-based 名次在 [start, stop] 内的成员
+// 总榜按 RankOrderKey 读取，同分时先得到该分数者在前，返回的成员为玩家ID；
+// 时间窗口排行榜同分时 desc 按玩家ID倒序、asc 按玩家ID正序
+func (r *RedisRepository) rangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	orderKey := key
+	if key == LeaderboardKey {
+		orderKey = RankOrderKey
 	}
 
-	_, err = r.client.HSet(ctx, PlayerKeyPrefix+playerID, playerInfo).Result()
-	if err != nil {
-		return fmt.Errorf("failed to update player info in redis: %w", err)
+	var result []redis.Z
+	var err error
+	if r.ascending {
+		result, err = r.client.ZRangeWithScores(ctx, orderKey, start, stop).Result()
+	} else {
+		result, err = r.client.ZRevRangeWithScores(ctx, orderKey, start, stop).Result()
 	}
+	if err != nil || orderKey == key {
+		return result, err
+	}
+
+	for i := range result {
+		result[i].Member = rankOrderPlayerID(result[i].Member.(string))
+	}
+	return result, nil
+}
+
+// 按排名顺序获取总榜玩家的 0-based 名次，c 可以是 pipeline（调用前需确保 rankScript 已缓存）
+// 玩家不在榜上时结果为 redis.Nil
+func (r *RedisRepository) rankCmd(ctx context.Context, c redis.Cmdable, playerID string) *redis.Cmd {
+	return rankScript.EvalSha(ctx, c, []string{RankOrderKey, RankOrderMembersKey}, playerID, r.orderArg())
+}
+
+// 确保 rankScript 已缓存，pipeline 和 MULTI 中只能使用 EVALSHA
+func (r *RedisRepository) loadRankScript(ctx context.Context) error {
+	if err := rankScript.Load(ctx, r.client).Err(); err != nil {
+		return fmt.Errorf("failed to load rank script: %w", err)
+	}
+	return nil
+}
+
+// 排名在分数 score 之前（不含 score）的分数区间，作为 ZCOUNT 的 min、max
+func (r *RedisRepository) betterThan(score int64) (string, string) {
+	scoreStr := strconv.FormatInt(score, 10)
+	if r.ascending {
+		return "-inf", "(" + scoreStr
+	}
+	return "(" + scoreStr, "+inf"
+}
 
-	// 设置过期时间（可选，防止数据无限增长）
-	r.client.Expire(ctx, PlayerKeyPrefix+playerID, 7*24*time.Hour)
+// UpdatePlayerScore 更新玩家分数（Redis Sorted Set），updatedAt 为玩家最后一次得分时间
+func (r *RedisRepository) UpdatePlayerScore(ctx context.Context, playerID string, score int64, name string, updatedAt time.Time) error {
+	ctx, done := startRedisOperation(ctx, "UpdatePlayerScore")
+	defer done()
+	// 使用 Sorted Set 存储排行榜，score 作为分数，playerID 作为成员；玩家信息与分数在同一脚本中写入
+	// 覆盖写入重复执行结果不变，可以重试
+	keys, args := r.writeScoreArgs(playerID, "set", score, nil, name, updatedAt)
+	err := r.withRetry(ctx, func() error {
+		return writeScoreScript.Run(ctx, r.client, keys, args...).Err()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update player score in redis: %w", err)
+	}
+	r.trim(ctx)
 
 	r.logger.Debug("Updated player score in redis",
 		"playerID", playerID,
@@ -64,94 +518,342 @@ func (r *RedisRepository) UpdatePlayerScore(ctx context.Context, playerID string
 	return nil
 }
 
-// GetPlayerRank 获取玩家排名
-func (r *RedisRepository) GetPlayerRank(ctx context.Context, playerID string) (int64, error) {
-	// ZREVRANK 返回从高到低的排名（0-based）
-	rank, err := r.client.ZRevRank(ctx, LeaderboardKey, playerID).Result()
+// UpdatePlayerScores 通过 pipeline 批量写入玩家分数和玩家信息
+func (r *RedisRepository) UpdatePlayerScores(ctx context.Context, players []*model.Player) error {
+	ctx, done := startRedisOperation(ctx, "UpdatePlayerScores")
+	defer done()
+	if len(players) == 0 {
+		return nil
+	}
+
+	// 确保脚本已缓存，pipeline 中使用 EVALSHA
+	if err := writeScoreScript.Load(ctx, r.client).Err(); err != nil {
+		return fmt.Errorf("failed to load score script: %w", err)
+	}
+
+	// 整批都是覆盖写入，重复执行结果不变，可以整体重试
+	err := r.withRetry(ctx, func() error {
+		_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, player := range players {
+				keys, args := r.writeScoreArgs(player.ID, "set", player.TotalScore, nil, player.Name, player.UpdatedAt)
+				writeScoreScript.EvalSha(ctx, pipe, keys, args...)
+			}
+			return nil
+		})
+		return err
+	})
 	if err != nil {
-		if err == redis.Nil {
-			return -1, ErrPlayerNotFound
+		return fmt.Errorf("failed to batch update player scores in redis: %w", err)
+	}
+	r.trim(ctx)
+
+	r.logger.Debug("Batch updated player scores in redis", "count", len(players))
+	return nil
+}
+
+// ScoreWrite 批量写入总榜的一条分数变更：Increment 为 true 时累加 Delta，玩家不在总榜上时直接写入 Total；否则覆盖为 Total
+type ScoreWrite struct {
+	PlayerID  string
+	Name      string
+	Increment bool
+	Delta     int64
+	Total     int64
+	UpdatedAt time.Time
+}
+
+// WritePlayerScores 通过 pipeline 按顺序执行一批分数写入，累加与 IncrementPlayerScoreAt、覆盖与 UpdatePlayerScore 的语义相同
+// 返回错误时其中部分写入可能已经生效，累加不可安全重试，调用方应以 MySQL 中的总分覆盖补偿
+func (r *RedisRepository) WritePlayerScores(ctx context.Context, writes []*ScoreWrite) error {
+	ctx, done := startRedisOperation(ctx, "WritePlayerScores")
+	defer done()
+	if len(writes) == 0 {
+		return nil
+	}
+
+	// 确保脚本已缓存，pipeline 中使用 EVALSHA
+	if err := writeScoreScript.Load(ctx, r.client).Err(); err != nil {
+		return fmt.Errorf("failed to load score script: %w", err)
+	}
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, w := range writes {
+			var keys []string
+			var args []interface{}
+			if w.Increment {
+				keys, args = r.writeScoreArgs(w.PlayerID, "incr", w.Delta, &w.Total, w.Name, w.UpdatedAt)
+			} else {
+				keys, args = r.writeScoreArgs(w.PlayerID, "set", w.Total, nil, w.Name, w.UpdatedAt)
+			}
+			writeScoreScript.EvalSha(ctx, pipe, keys, args...)
 		}
-		return -1, fmt.Errorf("failed to get player rank: %w", err)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to batch write player scores in redis: %w", err)
 	}
+	r.trim(ctx)
 
-	// 转换为 1-based 排名
-	return rank + 1, nil
+	r.logger.Debug("Batch wrote player scores in redis", "count", len(writes))
+	return nil
 }
 
-// GetPlayerScore 获取玩家分数
-func (r *RedisRepository) GetPlayerScore(ctx context.Context, playerID string) (float64, error) {
-	score, err := r.client.ZScore(ctx, LeaderboardKey, playerID).Result()
+// IncrementPlayerScore 原子地增加玩家分数，返回增加后的分数
+// 玩家不在总榜上（如超出人数上限被移除）时直接写入 total，即 MySQL 中增加后的总分
+func (r *RedisRepository) IncrementPlayerScore(ctx context.Context, playerID string, incrScore, total int64, name string) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "IncrementPlayerScore")
+	defer done()
+	return r.IncrementPlayerScoreAt(ctx, playerID, incrScore, total, name, time.Now())
+}
+
+// IncrementPlayerScoreAt 与 IncrementPlayerScore 相同，以 updatedAt 作为得分时间（决定同分时的先后）
+func (r *RedisRepository) IncrementPlayerScoreAt(ctx context.Context, playerID string, incrScore, total int64, name string, updatedAt time.Time) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "IncrementPlayerScoreAt")
+	defer done()
+	keys, args := r.writeScoreArgs(playerID, "incr", incrScore, &total, name, updatedAt)
+	result, err := writeScoreScript.Run(ctx, r.client, keys, args...).Text()
 	if err != nil {
-		if err == redis.Nil {
-			return 0, ErrPlayerNotFound
-		}
-		return 0, fmt.Errorf("failed to get player score: %w", err)
+		return 0, fmt.Errorf("failed to increment player score in redis: %w", err)
 	}
-	return score, nil
+	r.trim(ctx)
+
+	score, err := strconv.ParseFloat(result, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse incremented score: %w", err)
+	}
+
+	r.logger.Debug("Incremented player score in redis",
+		"playerID", playerID,
+		"incrScore", incrScore,
+		"score", int64(score))
+
+	return int64(score), nil
 }
 
-// GetTopPlayers 获取前N名玩家
-func (r *RedisRepository) GetTopPlayers(ctx context.Context, n int64) ([]*model.RankInfo, error) {
-	// ZREVRANGE 获取前N名（从高到低）
-	result, err := r.client.ZRevRangeWithScores(ctx, LeaderboardKey, 0, n-1).Result()
+// SetPlayerNames 批量更新玩家信息中的名称，不修改排行榜分数
+func (r *RedisRepository) SetPlayerNames(ctx context.Context, names map[string]string) error {
+	ctx, done := startRedisOperation(ctx, "SetPlayerNames")
+	defer done()
+	if !r.storeMetadata {
+		return nil
+	}
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for playerID, name := range names {
+			pipe.HSet(ctx, PlayerKeyPrefix+playerID, "name", name)
+			pipe.Expire(ctx, PlayerKeyPrefix+playerID, playerInfoTTL)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get top players: %w", err)
+		return fmt.Errorf("failed to set player names in redis: %w", err)
 	}
 
-	rankings := make([]*model.RankInfo, 0, len(result))
+	return nil
+}
 
-	for i, z := range result {
-		playerID := z.Member.(string)
+// BlockPlayers 将玩家加入封禁集合，并从总榜和当前时间窗口排行榜中移除
+func (r *RedisRepository) BlockPlayers(ctx context.Context, playerIDs []string) error {
+	ctx, done := startRedisOperation(ctx, "BlockPlayers")
+	defer done()
+	if len(playerIDs) == 0 {
+		return nil
+	}
 
-		// 获取玩家详细信息
-		name, err := r.getPlayerName(ctx, playerID)
-		if err != nil {
-			r.logger.Warn("Failed to get player name", "playerID", playerID, "error", err)
-			name = ""
+	members := make([]interface{}, len(playerIDs))
+	for i, playerID := range playerIDs {
+		members[i] = playerID
+	}
+
+	now := time.Now()
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, BlocklistKey, members...)
+		removeScoresScript.Eval(ctx, pipe, scoreIndexKeys, members...)
+		for window := range windowTTLs {
+			key, err := WindowKey(window, now)
+			if err != nil {
+				return err
+			}
+			pipe.ZRem(ctx, key, members...)
 		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to block players: %w", err)
+	}
 
-		rankings = append(rankings, &model.RankInfo{
-			PlayerID: playerID,
-			Rank:     i + 1,
-			Score:    int64(z.Score),
-			Name:     name,
-		})
+	return nil
+}
+
+// UnblockPlayers 将玩家移出封禁集合，不会恢复其排行榜分数
+func (r *RedisRepository) UnblockPlayers(ctx context.Context, playerIDs []string) error {
+	ctx, done := startRedisOperation(ctx, "UnblockPlayers")
+	defer done()
+	if len(playerIDs) == 0 {
+		return nil
 	}
 
-	return rankings, nil
+	members := make([]interface{}, len(playerIDs))
+	for i, playerID := range playerIDs {
+		members[i] = playerID
+	}
+
+	if err := r.client.SRem(ctx, BlocklistKey, members...).Err(); err != nil {
+		return fmt.Errorf("failed to unblock players: %w", err)
+	}
+	return nil
 }
 
-// GetPlayerRankRange 获取玩家排名范围
-func (r *RedisRepository) GetPlayerRankRange(ctx context.Context, playerID string, rangeNum int64) ([]*model.RankInfo, error) {
-	// 先获取玩家排名
-	rank, err := r.GetPlayerRank(ctx, playerID)
+// ClaimIdempotencyKey 以处理中状态占用幂等键，有效期为 ttl
+// 键已存在时返回 false 以及之前保存的处理结果，仍在处理中时结果为空
+func (r *RedisRepository) ClaimIdempotencyKey(ctx context.Context, key string, ttl time.Duration) (bool, *model.UpdateReceipt, error) {
+	ctx, done := startRedisOperation(ctx, "ClaimIdempotencyKey")
+	defer done()
+	redisKey := IdempotencyKeyPrefix + key
+	claimed, err := r.client.SetNX(ctx, redisKey, "", ttl).Result()
 	if err != nil {
-		return nil, err
+		return false, nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if claimed {
+		return true, nil, nil
 	}
 
-	// 计算范围（rank 是 1-based）
-	start := rank - rangeNum/2 - 1
-	if start < 0 {
-		start = 0
+	raw, err := r.client.Get(ctx, redisKey).Result()
+	if err == redis.Nil || (err == nil && raw == "") {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to get idempotency key: %w", err)
 	}
-	end := start + rangeNum
 
-	// 获取范围内的玩家
-	result, err := r.client.ZRevRangeWithScores(ctx, LeaderboardKey, start, end).Result()
+	var receipt model.UpdateReceipt
+	if err := json.Unmarshal([]byte(raw), &receipt); err != nil {
+		return false, nil, fmt.Errorf("failed to decode idempotency receipt: %w", err)
+	}
+	return false, &receipt, nil
+}
+
+// CompleteIdempotencyKey 保存幂等键对应的处理结果，有效期从此时重新计算
+func (r *RedisRepository) CompleteIdempotencyKey(ctx context.Context, key string, receipt *model.UpdateReceipt, ttl time.Duration) error {
+	ctx, done := startRedisOperation(ctx, "CompleteIdempotencyKey")
+	defer done()
+	data, err := json.Marshal(receipt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get player rank range: %w", err)
+		return fmt.Errorf("failed to encode idempotency receipt: %w", err)
+	}
+	if err := r.client.Set(ctx, IdempotencyKeyPrefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save idempotency receipt: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey 释放未生效的幂等键，允许使用同一键重试
+func (r *RedisRepository) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, done := startRedisOperation(ctx, "ReleaseIdempotencyKey")
+	defer done()
+	if err := r.client.Del(ctx, IdempotencyKeyPrefix+key).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// IsPlayerBlocked 检查玩家是否被封禁
+func (r *RedisRepository) IsPlayerBlocked(ctx context.Context, playerID string) (bool, error) {
+	ctx, done := startRedisOperation(ctx, "IsPlayerBlocked")
+	defer done()
+	blocked, err := r.client.SIsMember(ctx, BlocklistKey, playerID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check blocklist: %w", err)
+	}
+	return blocked, nil
+}
+
+// GetBlockedPlayers 获取所有被封禁的玩家ID
+func (r *RedisRepository) GetBlockedPlayers(ctx context.Context) ([]string, error) {
+	ctx, done := startRedisOperation(ctx, "GetBlockedPlayers")
+	defer done()
+	playerIDs, err := r.client.SMembers(ctx, BlocklistKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blocked players: %w", err)
+	}
+	return playerIDs, nil
+}
+
+// WindowKey 返回指定时间所在窗口的排行榜 key（按 UTC 划分）
+func WindowKey(window string, t time.Time) (string, error) {
+	t = t.UTC()
+
+	var period string
+	switch window {
+	case WindowDaily:
+		period = t.Format("2006-01-02")
+	case WindowWeekly:
+		year, week := t.ISOWeek()
+		period = fmt.Sprintf("%d-W%02d", year, week)
+	case WindowMonthly:
+		period = t.Format("2006-01")
+	default:
+		return "", ErrInvalidWindow
+	}
+
+	return WindowKeyPrefix + window + ":" + period, nil
+}
+
+// IncrementWindowScores 将本次得分累加到所有当前时间窗口排行榜
+func (r *RedisRepository) IncrementWindowScores(ctx context.Context, playerID string, incrScore int64) error {
+	ctx, done := startRedisOperation(ctx, "IncrementWindowScores")
+	defer done()
+	return r.IncrementWindowScoresBatch(ctx, map[string]int64{playerID: incrScore})
+}
+
+// IncrementWindowScoresBatch 批量将得分累加到所有当前时间窗口排行榜
+func (r *RedisRepository) IncrementWindowScoresBatch(ctx context.Context, increments map[string]int64) error {
+	ctx, done := startRedisOperation(ctx, "IncrementWindowScoresBatch")
+	defer done()
+	now := time.Now()
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for window, ttl := range windowTTLs {
+			key, err := WindowKey(window, now)
+			if err != nil {
+				return err
+			}
+			for playerID, incrScore := range increments {
+				pipe.ZIncrBy(ctx, key, float64(incrScore), playerID)
+			}
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to increment window scores: %w", err)
+	}
+
+	return nil
+}
+
+// GetWindowTopPlayers 获取当前时间窗口排行榜的前N名玩家
+func (r *RedisRepository) GetWindowTopPlayers(ctx context.Context, window string, n int64) ([]*model.RankInfo, error) {
+	ctx, done := startRedisOperation(ctx, "GetWindowTopPlayers")
+	defer done()
+	key, err := WindowKey(window, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.rangeWithScores(ctx, key, 0, n-1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get window top players: %w", err)
 	}
 
 	rankings := make([]*model.RankInfo, 0, len(result))
 
 	for i, z := range result {
-		currentPlayerID := z.Member.(string)
-		name, _ := r.getPlayerName(ctx, currentPlayerID)
+		playerID := z.Member.(string)
+		name, _ := r.getPlayerName(ctx, playerID)
 
 		rankings = append(rankings, &model.RankInfo{
-			PlayerID: currentPlayerID,
-			Rank:     int(start) + i + 1,
+			PlayerID: playerID,
+			Rank:     i + 1,
 			Score:    int64(z.Score),
 			Name:     name,
 		})
@@ -160,25 +862,1162 @@ func (r *RedisRepository) GetPlayerRankRange(ctx context.Context, playerID strin
 	return rankings, nil
 }
 
-// GetLeaderboardSize 获取排行榜大小
-func (r *RedisRepository) GetLeaderboardSize(ctx context.Context) (int64, error) {
-	return r.client.ZCard(ctx, LeaderboardKey).Result()
+// GetPlayerRank 获取玩家排名
+func (r *RedisRepository) GetPlayerRank(ctx context.Context, playerID string) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "GetPlayerRank")
+	defer done()
+	// 返回按排名顺序的 0-based 名次
+	var rank int64
+	err := r.withRetry(ctx, func() error {
+		var err error
+		rank, err = rankScript.Run(ctx, r.client, []string{RankOrderKey, RankOrderMembersKey}, playerID, r.orderArg()).Int64()
+		return err
+	})
+	if err != nil {
+		if err == redis.Nil {
+			return -1, ErrPlayerNotFound
+		}
+		return -1, fmt.Errorf("failed to get player rank: %w", err)
+	}
+
+	// 转换为 1-based 排名
+	return rank + 1, nil
 }
 
-// 获取玩家名称
-func (r *RedisRepository) getPlayerName(ctx context.Context, playerID string) (string, error) {
-	name, err := r.client.HGet(ctx, PlayerKeyPrefix+playerID, "name").Result()
-	if err != nil {
+// GetPlayerRanks 在同一事务中批量获取玩家排名（1-based）和排行榜人数，未上榜的玩家不在返回结果中
+func (r *RedisRepository) GetPlayerRanks(ctx context.Context, playerIDs []string) (map[string]int64, int64, error) {
+	ctx, done := startRedisOperation(ctx, "GetPlayerRanks")
+	defer done()
+	rankCmds := make(map[string]*redis.Cmd, len(playerIDs))
+	var sizeCmd *redis.IntCmd
+
+	if err := r.loadRankScript(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	err := r.withRetry(ctx, func() error {
+		_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, playerID := range playerIDs {
+				rankCmds[playerID] = r.rankCmd(ctx, pipe, playerID)
+			}
+			sizeCmd = pipe.ZCard(ctx, LeaderboardKey)
+			return nil
+		})
+		return err
+	})
+	// 未上榜玩家的名次返回 redis.Nil，逐条判断
+	if err != nil && err != redis.Nil {
+		return nil, 0, fmt.Errorf("failed to get player ranks: %w", err)
+	}
+
+	ranks := make(map[string]int64, len(playerIDs))
+	for playerID, cmd := range rankCmds {
+		rank, err := cmd.Int64()
 		if err == redis.Nil {
-			return "", nil
+			continue
 		}
-		return "", err
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get player rank: %w", err)
+		}
+		ranks[playerID] = rank + 1
 	}
-	return name, nil
+
+	return ranks, sizeCmd.Val(), nil
+}
+
+// GetPlayerRankInfos 在同一事务中批量获取玩家排名（1-based）和分数，不含名称，未上榜的玩家不在返回结果中
+func (r *RedisRepository) GetPlayerRankInfos(ctx context.Context, playerIDs []string) (map[string]*model.RankInfo, error) {
+	ctx, done := startRedisOperation(ctx, "GetPlayerRankInfos")
+	defer done()
+	rankCmds := make(map[string]*redis.Cmd, len(playerIDs))
+	scoreCmds := make(map[string]*redis.FloatCmd, len(playerIDs))
+
+	if err := r.loadRankScript(ctx); err != nil {
+		return nil, err
+	}
+
+	err := r.withRetry(ctx, func() error {
+		_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, playerID := range playerIDs {
+				rankCmds[playerID] = r.rankCmd(ctx, pipe, playerID)
+				scoreCmds[playerID] = pipe.ZScore(ctx, LeaderboardKey, playerID)
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get player ranks: %w", err)
+	}
+
+	rankInfos := make(map[string]*model.RankInfo, len(playerIDs))
+	for playerID, cmd := range rankCmds {
+		rank, err := cmd.Int64()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get player rank: %w", err)
+		}
+		rankInfos[playerID] = &model.RankInfo{
+			PlayerID: playerID,
+			Rank:     int(rank) + 1,
+			Score:    int64(scoreCmds[playerID].Val()),
+		}
+	}
+
+	return rankInfos, nil
+}
+
+// GetRankForScore 返回分数 score 在总榜中将占据的名次（1-based，即按排名顺序排在 score 之前的玩家数加一）
+// 以及当前恰好为该分数的玩家数，score 不必属于任何玩家
+func (r *RedisRepository) GetRankForScore(ctx context.Context, score int64) (int64, int64, error) {
+	ctx, done := startRedisOperation(ctx, "GetRankForScore")
+	defer done()
+	var betterCmd, tiedCmd *redis.IntCmd
+	scoreStr := strconv.FormatInt(score, 10)
+	min, max := r.betterThan(score)
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		betterCmd = pipe.ZCount(ctx, LeaderboardKey, min, max)
+		tiedCmd = pipe.ZCount(ctx, LeaderboardKey, scoreStr, scoreStr)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get rank for score: %w", err)
+	}
+
+	return betterCmd.Val() + 1, tiedCmd.Val(), nil
+}
+
+// CountBetterScores 统计总榜中按排名顺序排在 score 之前的不同分数个数（desc 时为更高的分数，asc 时为更低的分数），
+// 密集排名即该值加一
+func (r *RedisRepository) CountBetterScores(ctx context.Context, score int64) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "CountBetterScores")
+	defer done()
+	min, max := r.betterThan(score)
+	count, err := r.client.ZCount(ctx, DistinctScoresKey, min, max).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count better scores: %w", err)
+	}
+	return count, nil
+}
+
+// RebuildScoreIndex 根据总榜重建不同分数索引，force 为 false 时只在索引缺失时重建；
+// 排名顺序只在缺失时补建（写入时已按得分时间维护，不随 force 重建）。返回是否执行了重建
+// 两者都按 rebuildBatchSize 分批执行，重建期间的写入不会被阻塞
+func (r *RedisRepository) RebuildScoreIndex(ctx context.Context, force bool) (bool, error) {
+	ctx, done := startRedisOperation(ctx, "RebuildScoreIndex")
+	defer done()
+	rebuilt, err := r.rebuildScoreIndex(ctx, force)
+	if err != nil {
+		return false, fmt.Errorf("failed to rebuild score index: %w", err)
+	}
+
+	ordered, err := r.rebuildRankOrder(ctx)
+	if err != nil {
+		return rebuilt, fmt.Errorf("failed to rebuild rank order: %w", err)
+	}
+	return rebuilt || ordered, nil
+}
+
+// 分批重建不同分数索引，force 为 false 且索引已存在或总榜为空时跳过，返回是否执行了重建
+func (r *RedisRepository) rebuildScoreIndex(ctx context.Context, force bool) (bool, error) {
+	if !force {
+		var existsCmd, sizeCmd *redis.IntCmd
+		_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			existsCmd = pipe.Exists(ctx, ScoreCountsKey)
+			sizeCmd = pipe.ZCard(ctx, LeaderboardKey)
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+		if existsCmd.Val() == 1 || sizeCmd.Val() == 0 {
+			return false, nil
+		}
+	}
+
+	lower := "-inf"
+	for {
+		last, err := rebuildScoreIndexScript.Run(ctx, r.client, scoreIndexKeys, lower, rebuildBatchSize).Text()
+		if err == redis.Nil {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		lower = "(" + last
+	}
+}
+
+// 排名顺序缺失（升级前写入的排行榜）时按总榜分批补建，返回是否补建了任何玩家
+// 排名顺序成员数少于总榜人数时才补建，上次补建中途失败或补建期间总榜变化漏掉的玩家在下次调用时补上
+// 得分时间取自玩家信息 Hash，没有时按最早处理，之后的写入或从 MySQL 重建会修正
+func (r *RedisRepository) rebuildRankOrder(ctx context.Context) (bool, error) {
+	var orderedCmd, sizeCmd *redis.IntCmd
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		orderedCmd = pipe.HLen(ctx, RankOrderMembersKey)
+		sizeCmd = pipe.ZCard(ctx, LeaderboardKey)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if orderedCmd.Val() >= sizeCmd.Val() {
+		return false, nil
+	}
+
+	ordered := false
+	for start := int64(0); ; start += rebuildBatchSize {
+		playerIDs, err := r.client.ZRange(ctx, LeaderboardKey, start, start+rebuildBatchSize-1).Result()
+		if err != nil {
+			return ordered, err
+		}
+		if len(playerIDs) == 0 {
+			return ordered, nil
+		}
+
+		updatedAtCmds := make([]*redis.StringCmd, len(playerIDs))
+		_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, playerID := range playerIDs {
+				updatedAtCmds[i] = pipe.HGet(ctx, PlayerKeyPrefix+playerID, "updated_at")
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			return ordered, err
+		}
+
+		args := make([]interface{}, 0, 2*len(playerIDs))
+		for i, playerID := range playerIDs {
+			updatedAt, _ := updatedAtCmds[i].Int64()
+			args = append(args, playerID, r.rankOrderMember(playerID, time.Unix(updatedAt, 0)))
+		}
+		n, err := rebuildRankOrderScript.Run(ctx, r.client, scoreIndexKeys, args...).Int()
+		if err != nil {
+			return ordered, err
+		}
+		ordered = ordered || n == 1
+
+		if len(playerIDs) < rebuildBatchSize {
+			return ordered, nil
+		}
+	}
+}
+
+// GetPlayerScore 获取玩家分数
+func (r *RedisRepository) GetPlayerScore(ctx context.Context, playerID string) (float64, error) {
+	ctx, done := startRedisOperation(ctx, "GetPlayerScore")
+	defer done()
+	var score float64
+	err := r.withRetry(ctx, func() error {
+		var err error
+		score, err = r.client.ZScore(ctx, LeaderboardKey, playerID).Result()
+		return err
+	})
+	if err != nil {
+		if err == redis.Nil {
+			return 0, ErrPlayerNotFound
+		}
+		return 0, fmt.Errorf("failed to get player score: %w", err)
+	}
+	return score, nil
+}
+
+// GetPlayerRankAndScore 在同一事务中获取玩家排名（1-based）和分数
+func (r *RedisRepository) GetPlayerRankAndScore(ctx context.Context, playerID string) (int64, float64, error) {
+	ctx, done := startRedisOperation(ctx, "GetPlayerRankAndScore")
+	defer done()
+	var rankCmd *redis.Cmd
+	var scoreCmd *redis.FloatCmd
+
+	if err := r.loadRankScript(ctx); err != nil {
+		return -1, 0, err
+	}
+
+	// MULTI/EXEC 保证两次读取看到同一份排行榜数据
+	err := r.withRetry(ctx, func() error {
+		_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			rankCmd = r.rankCmd(ctx, pipe, playerID)
+			scoreCmd = pipe.ZScore(ctx, LeaderboardKey, playerID)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		if err == redis.Nil {
+			return -1, 0, ErrPlayerNotFound
+		}
+		return -1, 0, fmt.Errorf("failed to get player rank and score: %w", err)
+	}
+
+	rank, err := rankCmd.Int64()
+	if err != nil {
+		return -1, 0, fmt.Errorf("failed to get player rank: %w", err)
+	}
+	return rank + 1, scoreCmd.Val(), nil
+}
+
+// GetScoreAtRank 获取指定排名（1-based）玩家的ID和分数
+func (r *RedisRepository) GetScoreAtRank(ctx context.Context, rank int64) (string, int64, error) {
+	ctx, done := startRedisOperation(ctx, "GetScoreAtRank")
+	defer done()
+	if rank <= 0 {
+		return "", 0, ErrRankOutOfRange
+	}
+
+	result, err := r.rangeWithScores(ctx, LeaderboardKey, rank-1, rank-1)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get score at rank: %w", err)
+	}
+
+	if len(result) == 0 {
+		return "", 0, ErrRankOutOfRange
+	}
+
+	return result[0].Member.(string), int64(result[0].Score), nil
+}
+
+// GetTopPlayers 获取前N名玩家
+func (r *RedisRepository) GetTopPlayers(ctx context.Context, n int64) ([]*model.RankInfo, error) {
+	ctx, done := startRedisOperation(ctx, "GetTopPlayers")
+	defer done()
+	return r.GetPlayersByRankRange(ctx, 0, n-1)
+}
+
+// GetPlayersByRankRange 获取排名区间内的玩家（start、end 为 0-based 闭区间）
+func (r *RedisRepository) GetPlayersByRankRange(ctx context.Context, start, end int64) ([]*model.RankInfo, error) {
+	ctx, done := startRedisOperation(ctx, "GetPlayersByRankRange")
+	defer done()
+	result, err := r.rangeWithScores(ctx, LeaderboardKey, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get players by rank range: %w", err)
+	}
+
+	rankings := make([]*model.RankInfo, 0, len(result))
+
+	for i, z := range result {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		playerID := z.Member.(string)
+
+		// 获取玩家详细信息
+		name, err := r.getPlayerName(ctx, playerID)
+		if err != nil {
+			r.logger.Warn("Failed to get player name", "playerID", playerID, "error", err)
+			name = ""
+		}
+
+		rankings = append(rankings, &model.RankInfo{
+			PlayerID: playerID,
+			Rank:     int(start) + i + 1,
+			Score:    int64(z.Score),
+			Name:     name,
+		})
+	}
+
+	return rankings, nil
+}
+
+// GetPlayersByScoreRange 按排名顺序获取总榜中分数在 [minScore, maxScore] 内的前 limit 名玩家，以及满足条件的总人数
+// minScore、maxScore 为 nil 时该侧不限；limit 为 0 时只统计人数；返回的排名为玩家在整个总榜中的名次（1-based）
+func (r *RedisRepository) GetPlayersByScoreRange(ctx context.Context, minScore, maxScore *int64, limit int64) ([]*model.RankInfo, int64, error) {
+	ctx, done := startRedisOperation(ctx, "GetPlayersByScoreRange")
+	defer done()
+	min, max := "-inf", "+inf"
+	if minScore != nil {
+		min = strconv.FormatInt(*minScore, 10)
+	}
+	if maxScore != nil {
+		max = strconv.FormatInt(*maxScore, 10)
+	}
+
+	// 排在区间之前的人数：desc 时为高于 maxScore 的人数，asc 时为低于 minScore 的人数
+	var beforeMin, beforeMax string
+	var bounded bool
+	if r.ascending && minScore != nil {
+		beforeMin, beforeMax = r.betterThan(*minScore)
+		bounded = true
+	} else if !r.ascending && maxScore != nil {
+		beforeMin, beforeMax = r.betterThan(*maxScore)
+		bounded = true
+	}
+
+	var rangeCmd *redis.ZSliceCmd
+	var countCmd, beforeCmd *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		// Count 为 0 时不带 LIMIT，会返回整个区间，因此 limit 为 0 时不读取成员
+		if limit > 0 {
+			opt := &redis.ZRangeBy{Min: min, Max: max, Count: limit}
+			if r.ascending {
+				rangeCmd = pipe.ZRangeByScoreWithScores(ctx, RankOrderKey, opt)
+			} else {
+				rangeCmd = pipe.ZRevRangeByScoreWithScores(ctx, RankOrderKey, opt)
+			}
+		}
+		countCmd = pipe.ZCount(ctx, RankOrderKey, min, max)
+		if bounded {
+			beforeCmd = pipe.ZCount(ctx, RankOrderKey, beforeMin, beforeMax)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get players by score range: %w", err)
+	}
+
+	var before int64
+	if beforeCmd != nil {
+		before = beforeCmd.Val()
+	}
+
+	var result []redis.Z
+	if rangeCmd != nil {
+		result = rangeCmd.Val()
+	}
+	rankings := make([]*model.RankInfo, 0, len(result))
+	for i, z := range result {
+		playerID := rankOrderPlayerID(z.Member.(string))
+
+		name, err := r.getPlayerName(ctx, playerID)
+		if err != nil {
+			r.logger.Warn("Failed to get player name", "playerID", playerID, "error", err)
+			name = ""
+		}
+
+		rankings = append(rankings, &model.RankInfo{
+			PlayerID: playerID,
+			Rank:     int(before) + i + 1,
+			Score:    int64(z.Score),
+			Name:     name,
+		})
+	}
+
+	return rankings, countCmd.Val(), nil
+}
+
+// GetPlayerRankRange 获取玩家排名范围
+// 窗口以玩家为中心，靠近榜首或榜尾时向另一侧延伸，排行榜人数不少于 rangeNum 时总是返回 rangeNum 条
+// 返回包含该玩家在内共 rangeNum 名玩家，玩家前面有 (rangeNum-1)/2 名、后面有 rangeNum/2 名；
+// 靠近榜首或榜尾时窗口整体平移以保持数量，排行榜人数不足 rangeNum 时返回整个排行榜
+func (r *RedisRepository) GetPlayerRankRange(ctx context.Context, playerID string, rangeNum int64) ([]*model.RankInfo, error) {
+	ctx, done := startRedisOperation(ctx, "GetPlayerRankRange")
+	defer done()
+	// 排名和排行榜人数在同一事务中读取，避免两次读取之间榜单变化导致窗口越界
+	ranks, size, err := r.GetPlayerRanks(ctx, []string{playerID})
+	if err != nil {
+		return nil, err
+	}
+	rank, ok := ranks[playerID]
+	if !ok {
+		return nil, ErrPlayerNotFound
+	}
+
+	// 计算 0-based 闭区间 [start, end]（rank 是 1-based）
+	start := rank - 1 - (rangeNum-1)/2
+	if start+rangeNum > size {
+		start = size - rangeNum
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + rangeNum - 1
+
+	// 获取范围内的玩家
+	result, err := r.rangeWithScores(ctx, LeaderboardKey, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get player rank range: %w", err)
+	}
+
+	rankings := make([]*model.RankInfo, 0, len(result))
+
+	for i, z := range result {
+		currentPlayerID := z.Member.(string)
+		name, _ := r.getPlayerName(ctx, currentPlayerID)
+
+		rankings = append(rankings, &model.RankInfo{
+			PlayerID: currentPlayerID,
+			Rank:     int(start) + i + 1,
+			Score:    int64(z.Score),
+			Name:     name,
+		})
+	}
+
+	return rankings, nil
+}
+
+// GetPlayersNearScore 获取总榜中分数与玩家相差不超过 scoreDelta 的玩家，按排名顺序返回，包含该玩家本身
+// 满足条件的人数超过 limit 时返回以该玩家为中心的 limit 名，靠近区间边界时向另一侧延伸；同时返回玩家分数和满足条件的总人数
+func (r *RedisRepository) GetPlayersNearScore(ctx context.Context, playerID string, scoreDelta, limit int64) ([]*model.RankInfo, int64, int64, error) {
+	ctx, done := startRedisOperation(ctx, "GetPlayersNearScore")
+	defer done()
+	rank, score, err := r.GetPlayerRankAndScore(ctx, playerID)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	playerScore := int64(score)
+
+	// 区间内的玩家在排名顺序中是连续的一段：区间之前的人数即为区间起始的 0-based 名次
+	min := strconv.FormatInt(playerScore-scoreDelta, 10)
+	max := strconv.FormatInt(playerScore+scoreDelta, 10)
+	bound := playerScore + scoreDelta
+	if r.ascending {
+		bound = playerScore - scoreDelta
+	}
+	beforeMin, beforeMax := r.betterThan(bound)
+
+	var countCmd, beforeCmd *redis.IntCmd
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		countCmd = pipe.ZCount(ctx, LeaderboardKey, min, max)
+		beforeCmd = pipe.ZCount(ctx, LeaderboardKey, beforeMin, beforeMax)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count players near score: %w", err)
+	}
+	matched, first := countCmd.Val(), beforeCmd.Val()
+	last := first + matched - 1
+
+	// 以玩家为中心截取 limit 名，不超出区间
+	start := rank - 1 - (limit-1)/2
+	if start+limit-1 > last {
+		start = last - limit + 1
+	}
+	if start < first {
+		start = first
+	}
+	end := start + limit - 1
+	if end > last {
+		end = last
+	}
+
+	rankings, err := r.GetPlayersByRankRange(ctx, start, end)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return rankings, playerScore, matched, nil
+}
+
+// IterateLeaderboard 按排名顺序分页遍历排行榜（不含玩家名称），fn 返回 ErrStopIteration 时提前结束
+// 每页之间检查 ctx，客户端断开或超时后立即停止遍历
+func (r *RedisRepository) IterateLeaderboard(ctx context.Context, pageSize int64, fn func(page []*model.RankInfo) error) error {
+	ctx, done := startRedisOperation(ctx, "IterateLeaderboard")
+	defer done()
+	if pageSize <= 0 {
+		pageSize = defaultIteratePageSize
+	}
+
+	for start := int64(0); ; start += pageSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		result, err := r.rangeWithScores(ctx, LeaderboardKey, start, start+pageSize-1)
+		if err != nil {
+			return fmt.Errorf("failed to iterate leaderboard: %w", err)
+		}
+
+		if len(result) == 0 {
+			return nil
+		}
+
+		page := make([]*model.RankInfo, 0, len(result))
+		for i, z := range result {
+			page = append(page, &model.RankInfo{
+				PlayerID: z.Member.(string),
+				Rank:     int(start) + i + 1,
+				Score:    int64(z.Score),
+			})
+		}
+
+		if err := fn(page); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+
+		if int64(len(result)) < pageSize {
+			return nil
+		}
+	}
+}
+
+// PrecomputedRankBuildKey 返回一次预计算使用的临时 Hash key，完成后通过 PublishPrecomputedRanks 替换正式数据
+func PrecomputedRankBuildKey(t time.Time) string {
+	return PrecomputedRankKey + ":building:" + strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// WritePrecomputedRanks 将一批玩家排名写入临时 Hash
+func (r *RedisRepository) WritePrecomputedRanks(ctx context.Context, buildKey string, ranks map[string]int) error {
+	ctx, done := startRedisOperation(ctx, "WritePrecomputedRanks")
+	defer done()
+	if len(ranks) == 0 {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(ranks))
+	for playerID, rank := range ranks {
+		values[playerID] = rank
+	}
+
+	if err := r.client.HSet(ctx, buildKey, values).Err(); err != nil {
+		return fmt.Errorf("failed to write precomputed ranks: %w", err)
+	}
+	return nil
+}
+
+// PublishPrecomputedRanks 以临时 Hash 原子地替换预计算排名并记录计算时间，
+// 临时 Hash 不存在（排行榜为空）时清空预计算排名
+func (r *RedisRepository) PublishPrecomputedRanks(ctx context.Context, buildKey string, computedAt time.Time) error {
+	ctx, done := startRedisOperation(ctx, "PublishPrecomputedRanks")
+	defer done()
+	exists, err := r.client.Exists(ctx, buildKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check precomputed ranks: %w", err)
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if exists > 0 {
+			pipe.Rename(ctx, buildKey, PrecomputedRankKey)
+		} else {
+			pipe.Del(ctx, PrecomputedRankKey)
+		}
+		pipe.Set(ctx, PrecomputedRankTimeKey, computedAt.Unix(), 0)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish precomputed ranks: %w", err)
+	}
+	return nil
+}
+
+// DiscardPrecomputedRanks 删除未完成的临时 Hash
+func (r *RedisRepository) DiscardPrecomputedRanks(ctx context.Context, buildKey string) error {
+	ctx, done := startRedisOperation(ctx, "DiscardPrecomputedRanks")
+	defer done()
+	return r.client.Del(ctx, buildKey).Err()
+}
+
+// GetPrecomputedRank 获取玩家的预计算排名及计算时间，玩家不在预计算结果中时返回 ErrPlayerNotFound
+func (r *RedisRepository) GetPrecomputedRank(ctx context.Context, playerID string) (int, time.Time, error) {
+	ctx, done := startRedisOperation(ctx, "GetPrecomputedRank")
+	defer done()
+	var rankCmd *redis.StringCmd
+	var timeCmd *redis.StringCmd
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		rankCmd = pipe.HGet(ctx, PrecomputedRankKey, playerID)
+		timeCmd = pipe.Get(ctx, PrecomputedRankTimeKey)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return 0, time.Time{}, fmt.Errorf("failed to get precomputed rank: %w", err)
+	}
+
+	rank, err := rankCmd.Int()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, time.Time{}, ErrPlayerNotFound
+		}
+		return 0, time.Time{}, fmt.Errorf("failed to parse precomputed rank: %w", err)
+	}
+
+	computedAt, err := timeCmd.Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, time.Time{}, ErrPlayerNotFound
+		}
+		return 0, time.Time{}, fmt.Errorf("failed to parse precomputed rank time: %w", err)
+	}
+
+	return rank, time.Unix(computedAt, 0), nil
+}
+
+// UpdatePeakRanks 以玩家当前在总榜中的名次更新其历史最佳排名，不在榜上的玩家跳过
+func (r *RedisRepository) UpdatePeakRanks(ctx context.Context, playerIDs []string) error {
+	ctx, done := startRedisOperation(ctx, "UpdatePeakRanks")
+	defer done()
+	if len(playerIDs) == 0 {
+		return nil
+	}
+
+	// pipeline 中只能使用 EVALSHA，先确保脚本已缓存
+	if err := peakRankScript.Load(ctx, r.client).Err(); err != nil {
+		return fmt.Errorf("failed to load peak rank script: %w", err)
+	}
+
+	keys := []string{RankOrderKey, RankOrderMembersKey, PeakRankKey, PeakRankTimeKey}
+	now := time.Now().Unix()
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, playerID := range playerIDs {
+			peakRankScript.EvalSha(ctx, pipe, keys, playerID, r.orderArg(), now)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to update peak ranks: %w", err)
+	}
+	return nil
+}
+
+// GetPeakRank 获取玩家的历史最佳排名（1-based）及达到该名次的时间，没有记录时返回 ErrPlayerNotFound
+func (r *RedisRepository) GetPeakRank(ctx context.Context, playerID string) (int64, time.Time, error) {
+	ctx, done := startRedisOperation(ctx, "GetPeakRank")
+	defer done()
+	var rankCmd, timeCmd *redis.StringCmd
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		rankCmd = pipe.HGet(ctx, PeakRankKey, playerID)
+		timeCmd = pipe.HGet(ctx, PeakRankTimeKey, playerID)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return 0, time.Time{}, fmt.Errorf("failed to get peak rank: %w", err)
+	}
+
+	rank, err := rankCmd.Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, time.Time{}, ErrPlayerNotFound
+		}
+		return 0, time.Time{}, fmt.Errorf("failed to parse peak rank: %w", err)
+	}
+
+	achievedAt, err := timeCmd.Int64()
+	if err != nil && err != redis.Nil {
+		return 0, time.Time{}, fmt.Errorf("failed to parse peak rank time: %w", err)
+	}
+
+	return rank, time.Unix(achievedAt, 0), nil
+}
+
+// GetLeaderboardSize 获取排行榜大小
+func (r *RedisRepository) GetLeaderboardSize(ctx context.Context) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "GetLeaderboardSize")
+	defer done()
+	return r.client.ZCard(ctx, LeaderboardKey).Result()
+}
+
+// ClearLeaderboard 清空排行榜：删除总榜、时间窗口榜、预计算排名、最佳排名和玩家信息 Hash，返回总榜中被删除的玩家数
+// 总榜在一个事务中读取人数并删除；其余 key 随后通过 SCAN 删除
+func (r *RedisRepository) ClearLeaderboard(ctx context.Context) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "ClearLeaderboard")
+	defer done()
+	var size *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		size = pipe.ZCard(ctx, LeaderboardKey)
+		pipe.Del(ctx, LeaderboardKey, DistinctScoresKey, ScoreCountsKey, RankOrderKey, RankOrderMembersKey, PrecomputedRankKey, PrecomputedRankTimeKey, PeakRankKey, PeakRankTimeKey)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear leaderboard: %w", err)
+	}
+
+	patterns := []string{PlayerKeyPrefix + "*", PrecomputedRankKey + ":building:*"}
+	for window := range windowTTLs {
+		patterns = append(patterns, WindowKeyPrefix+window+":*")
+	}
+	for _, pattern := range patterns {
+		if err := r.deleteByPattern(ctx, pattern); err != nil {
+			return size.Val(), err
+		}
+	}
+
+	return size.Val(), nil
+}
+
+// 保存带 KeyHashTag 的 key 的节点：集群模式下为标签所在槽位的主节点，SCAN 只扫描单个节点
+func (r *RedisRepository) taggedKeyNode(ctx context.Context) (redis.Cmdable, error) {
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		return cluster.MasterForKey(ctx, KeyHashTag)
+	}
+	return r.client, nil
+}
+
+// 按 pattern 扫描并分批删除 key，pattern 须以 KeyHashTag 开头
+func (r *RedisRepository) deleteByPattern(ctx context.Context, pattern string) error {
+	node, err := r.taggedKeyNode(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to locate keys matching %s: %w", pattern, err)
+	}
+
+	iter := node.Scan(ctx, 0, pattern, defaultIteratePageSize).Iterator()
+	keys := make([]string, 0, defaultIteratePageSize)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) >= defaultIteratePageSize {
+			if err := r.client.Del(ctx, keys...).Err(); err != nil {
+				return fmt.Errorf("failed to delete keys matching %s: %w", pattern, err)
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan keys matching %s: %w", pattern, err)
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to delete keys matching %s: %w", pattern, err)
+	}
+	return nil
+}
+
+// GetWindowSize 获取当前时间窗口排行榜中的玩家数量
+func (r *RedisRepository) GetWindowSize(ctx context.Context, window string) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "GetWindowSize")
+	defer done()
+	key, err := WindowKey(window, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return r.client.ZCard(ctx, key).Result()
+}
+
+// GetPlayerLastActive 获取玩家最后一次得分时间
+func (r *RedisRepository) GetPlayerLastActive(ctx context.Context, playerID string) (time.Time, error) {
+	ctx, done := startRedisOperation(ctx, "GetPlayerLastActive")
+	defer done()
+	updatedAt, err := r.client.HGet(ctx, PlayerKeyPrefix+playerID, "updated_at").Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return time.Time{}, ErrPlayerNotFound
+		}
+		return time.Time{}, fmt.Errorf("failed to get player last active time: %w", err)
+	}
+	return time.Unix(updatedAt, 0), nil
+}
+
+// SaveCacheSnapshot 保存序列化后的缓存快照，ttl 到期后自动删除
+func (r *RedisRepository) SaveCacheSnapshot(ctx context.Context, data []byte, ttl time.Duration) error {
+	ctx, done := startRedisOperation(ctx, "SaveCacheSnapshot")
+	defer done()
+	if err := r.client.Set(ctx, CacheSnapshotKey, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save cache snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadCacheSnapshot 读取缓存快照，不存在时返回 ErrNoSnapshot
+func (r *RedisRepository) LoadCacheSnapshot(ctx context.Context) ([]byte, error) {
+	ctx, done := startRedisOperation(ctx, "LoadCacheSnapshot")
+	defer done()
+	data, err := r.client.Get(ctx, CacheSnapshotKey).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNoSnapshot
+		}
+		return nil, fmt.Errorf("failed to load cache snapshot: %w", err)
+	}
+	return data, nil
+}
+
+// 获取玩家名称
+func (r *RedisRepository) getPlayerName(ctx context.Context, playerID string) (string, error) {
+	if !r.storeMetadata {
+		return "", nil
+	}
+
+	name, err := r.client.HGet(ctx, PlayerKeyPrefix+playerID, "name").Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return name, nil
+}
+
+// ClaimedScoreWrite 从待处理队列取出、尚未确认的分数变更
+type ClaimedScoreWrite struct {
+	*model.PendingScoreWrite
+	Partition int // 所在的写入队列分区
+	raw       string
+}
+
+// ScoreWritePartition 玩家的分数变更所在的写入队列分区
+func ScoreWritePartition(playerID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(playerID))
+	return int(h.Sum32() % ScoreWritePartitions)
+}
+
+// 分区的待处理、处理中队列和租约
+func scoreWritePendingKey(partition int) string {
+	return ScoreWritePendingKeyPrefix + strconv.Itoa(partition)
+}
+
+func scoreWriteProcessingKey(partition int) string {
+	return ScoreWriteProcessingKeyPrefix + strconv.Itoa(partition)
+}
+
+func scoreWriteLeaseKey(partition int) string {
+	return ScoreWriteLeaseKeyPrefix + strconv.Itoa(partition)
+}
+
+// WriteScoreAndEnqueue 将分数变更写入总榜，并在同一个 MULTI 事务中加入玩家所在分区的待写入 MySQL 队列
+// write.SetAbsolute 为 true 时覆盖为 write.Score，否则累加 write.ScoreChange，玩家不在总榜上时直接写入 total；返回写入后的总分
+func (r *RedisRepository) WriteScoreAndEnqueue(ctx context.Context, write *model.PendingScoreWrite, total int64) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "WriteScoreAndEnqueue")
+	defer done()
+	data, err := json.Marshal(write)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal score write: %w", err)
+	}
+
+	// MULTI 中只能使用 EVALSHA，先确保脚本已缓存
+	if err := writeScoreScript.Load(ctx, r.client).Err(); err != nil {
+		return 0, fmt.Errorf("failed to load score script: %w", err)
+	}
+
+	var keys []string
+	var args []interface{}
+	if write.SetAbsolute {
+		keys, args = r.writeScoreArgs(write.PlayerID, "set", write.Score, nil, write.Name, write.QueuedAt)
+	} else {
+		keys, args = r.writeScoreArgs(write.PlayerID, "incr", write.ScoreChange, &total, write.Name, write.QueuedAt)
+	}
+
+	var scoreCmd *redis.Cmd
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		scoreCmd = writeScoreScript.EvalSha(ctx, pipe, keys, args...)
+		pipe.RPush(ctx, scoreWritePendingKey(ScoreWritePartition(write.PlayerID)), data)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to write score and enqueue: %w", err)
+	}
+
+	result, err := scoreCmd.Text()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read updated score: %w", err)
+	}
+	score, err := strconv.ParseFloat(result, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse updated score: %w", err)
+	}
+	return int64(score), nil
+}
+
+// EnqueueScoreWrite 只将分数变更加入玩家所在分区的待写入 MySQL 队列，不修改排行榜
+func (r *RedisRepository) EnqueueScoreWrite(ctx context.Context, write *model.PendingScoreWrite) error {
+	ctx, done := startRedisOperation(ctx, "EnqueueScoreWrite")
+	defer done()
+	data, err := json.Marshal(write)
+	if err != nil {
+		return fmt.Errorf("failed to marshal score write: %w", err)
+	}
+	if err := r.client.RPush(ctx, scoreWritePendingKey(ScoreWritePartition(write.PlayerID)), data).Err(); err != nil {
+		return fmt.Errorf("failed to enqueue score write: %w", err)
+	}
+	return nil
+}
+
+// AcquireScoreWritePartition 获取或续期写入队列分区的租约，租约由其他实例持有时返回 false
+// 持有租约的实例应在 ttl 内续期，否则租约过期后可能被其他实例获取
+func (r *RedisRepository) AcquireScoreWritePartition(ctx context.Context, partition int, owner string, ttl time.Duration) (bool, error) {
+	ctx, done := startRedisOperation(ctx, "AcquireScoreWritePartition")
+	defer done()
+	acquired, err := scoreWriteLeaseScript.Run(ctx, r.client, []string{scoreWriteLeaseKey(partition)}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire score write partition %d: %w", partition, err)
+	}
+	return acquired == 1, nil
+}
+
+// ReleaseScoreWritePartition 释放 owner 持有的分区租约，使其他实例无需等待过期即可接管
+func (r *RedisRepository) ReleaseScoreWritePartition(ctx context.Context, partition int, owner string) error {
+	ctx, done := startRedisOperation(ctx, "ReleaseScoreWritePartition")
+	defer done()
+	if err := releaseScoreWriteLeaseScript.Run(ctx, r.client, []string{scoreWriteLeaseKey(partition)}, owner).Err(); err != nil {
+		return fmt.Errorf("failed to release score write partition %d: %w", partition, err)
+	}
+	return nil
+}
+
+// ClaimScoreWrite 从分区的待处理队列取出一条变更并移入该分区的处理中队列，最多阻塞 timeout，队列为空时返回 nil
+// 调用方须持有分区租约；处理完成后需调用 AckScoreWrite 或 DeadLetterScoreWrite，
+// 进程在此之间退出时变更留在处理中队列，由下一个获取租约的实例通过 RequeueProcessingScoreWrites 重新入队
+func (r *RedisRepository) ClaimScoreWrite(ctx context.Context, partition int, timeout time.Duration) (*ClaimedScoreWrite, error) {
+	ctx, done := startRedisOperation(ctx, "ClaimScoreWrite")
+	defer done()
+	raw, err := r.client.BLMove(ctx, scoreWritePendingKey(partition), scoreWriteProcessingKey(partition), "LEFT", "RIGHT", timeout).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim score write: %w", err)
+	}
+
+	claimed := &ClaimedScoreWrite{PendingScoreWrite: &model.PendingScoreWrite{}, Partition: partition, raw: raw}
+	if err := json.Unmarshal([]byte(raw), claimed.PendingScoreWrite); err != nil {
+		// 无法解析的元素无法重试，直接移入死信队列保留原始内容
+		if dlqErr := r.DeadLetterScoreWrite(ctx, claimed); dlqErr != nil {
+			return nil, dlqErr
+		}
+		return nil, fmt.Errorf("%w: malformed score write: %v", ErrInvalidData, err)
+	}
+	return claimed, nil
+}
+
+// AckScoreWrite 确认变更已写入 MySQL，从处理中队列移除
+func (r *RedisRepository) AckScoreWrite(ctx context.Context, claimed *ClaimedScoreWrite) error {
+	ctx, done := startRedisOperation(ctx, "AckScoreWrite")
+	defer done()
+	if err := r.client.LRem(ctx, scoreWriteProcessingKey(claimed.Partition), 1, claimed.raw).Err(); err != nil {
+		return fmt.Errorf("failed to ack score write: %w", err)
+	}
+	return nil
+}
+
+// DeadLetterScoreWrite 将变更从处理中队列移入死信队列
+func (r *RedisRepository) DeadLetterScoreWrite(ctx context.Context, claimed *ClaimedScoreWrite) error {
+	ctx, done := startRedisOperation(ctx, "DeadLetterScoreWrite")
+	defer done()
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, scoreWriteProcessingKey(claimed.Partition), 1, claimed.raw)
+		pipe.RPush(ctx, ScoreWriteDeadKey, claimed.raw)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter score write: %w", err)
+	}
+	return nil
+}
+
+// RequeueProcessingScoreWrites 将分区处理中队列的全部变更按原顺序移回待处理队列头部，返回移动的条数
+// 应在获取分区租约后、取出新变更前调用；上一个租约持有者已写入 MySQL 但未确认的变更由 write_id 去重
+func (r *RedisRepository) RequeueProcessingScoreWrites(ctx context.Context, partition int) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "RequeueProcessingScoreWrites")
+	defer done()
+	return r.moveAll(ctx, scoreWriteProcessingKey(partition), scoreWritePendingKey(partition), "LEFT")
+}
+
+// RequeueDeadScoreWrites 将死信队列的全部变更移回各自分区待处理队列的尾部，返回移动的条数
+// 无法解析的变更留在死信队列中；重新入队的变更排在同一玩家之后的变更后面
+func (r *RedisRepository) RequeueDeadScoreWrites(ctx context.Context) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "RequeueDeadScoreWrites")
+	defer done()
+
+	var moved, skipped int64
+	for {
+		items, err := r.client.LRange(ctx, ScoreWriteDeadKey, skipped, skipped+defaultIteratePageSize-1).Result()
+		if err != nil {
+			return moved, fmt.Errorf("failed to read dead score writes: %w", err)
+		}
+		if len(items) == 0 {
+			return moved, nil
+		}
+
+		for _, raw := range items {
+			var write model.PendingScoreWrite
+			if err := json.Unmarshal([]byte(raw), &write); err != nil {
+				skipped++
+				continue
+			}
+			keys := []string{ScoreWriteDeadKey, scoreWritePendingKey(ScoreWritePartition(write.PlayerID))}
+			n, err := requeueDeadScoreWriteScript.Run(ctx, r.client, keys, raw).Int64()
+			if err != nil {
+				return moved, fmt.Errorf("failed to requeue dead score write: %w", err)
+			}
+			moved += n
+		}
+	}
+}
+
+// 逐条从 source 尾部移到 destination 的 destPos 端，保持原有顺序
+func (r *RedisRepository) moveAll(ctx context.Context, source, destination, destPos string) (int64, error) {
+	srcPos := "LEFT"
+	if destPos == "LEFT" {
+		srcPos = "RIGHT"
+	}
+
+	var moved int64
+	for {
+		err := r.client.LMove(ctx, source, destination, srcPos, destPos).Err()
+		if err == redis.Nil {
+			return moved, nil
+		}
+		if err != nil {
+			return moved, fmt.Errorf("failed to move %s to %s: %w", source, destination, err)
+		}
+		moved++
+	}
+}
+
+// GetScoreWriteQueueStats 获取异步写入队列各状态的变更数，待处理和处理中为全部分区之和
+func (r *RedisRepository) GetScoreWriteQueueStats(ctx context.Context) (*model.ScoreWriteQueueStats, error) {
+	ctx, done := startRedisOperation(ctx, "GetScoreWriteQueueStats")
+	defer done()
+	pending := make([]*redis.IntCmd, ScoreWritePartitions)
+	processing := make([]*redis.IntCmd, ScoreWritePartitions)
+	var dead *redis.IntCmd
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for p := 0; p < ScoreWritePartitions; p++ {
+			pending[p] = pipe.LLen(ctx, scoreWritePendingKey(p))
+			processing[p] = pipe.LLen(ctx, scoreWriteProcessingKey(p))
+		}
+		dead = pipe.LLen(ctx, ScoreWriteDeadKey)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get score write queue stats: %w", err)
+	}
+
+	stats := &model.ScoreWriteQueueStats{Dead: dead.Val()}
+	for p := 0; p < ScoreWritePartitions; p++ {
+		stats.Pending += pending[p].Val()
+		stats.Processing += processing[p].Val()
+	}
+	return stats, nil
+}
+
+// GetDeadScoreWrites 获取死信队列中最早的 limit 条变更，无法解析的元素被跳过
+func (r *RedisRepository) GetDeadScoreWrites(ctx context.Context, limit int64) ([]*model.PendingScoreWrite, error) {
+	ctx, done := startRedisOperation(ctx, "GetDeadScoreWrites")
+	defer done()
+	items, err := r.client.LRange(ctx, ScoreWriteDeadKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead score writes: %w", err)
+	}
+
+	writes := make([]*model.PendingScoreWrite, 0, len(items))
+	for _, item := range items {
+		var write model.PendingScoreWrite
+		if err := json.Unmarshal([]byte(item), &write); err != nil {
+			r.logger.Warn("Skipping malformed dead score write", "error", err)
+			continue
+		}
+		writes = append(writes, &write)
+	}
+	return writes, nil
+}
+
+// VerifySchema 检查排行榜 key 的数据类型是否为 Sorted Set
+func (r *RedisRepository) VerifySchema(ctx context.Context) error {
+	ctx, done := startRedisOperation(ctx, "VerifySchema")
+	defer done()
+	keyType, err := r.client.Type(ctx, LeaderboardKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check leaderboard key type: %w", err)
+	}
+
+	// none 表示排行榜尚未创建
+	if keyType != "zset" && keyType != "none" {
+		return fmt.Errorf("%w: key %s has type %s, expected zset", ErrSchemaMismatch, LeaderboardKey, keyType)
+	}
+
+	return nil
 }
 
 // HealthCheck 健康检查
 func (r *RedisRepository) HealthCheck(ctx context.Context) error {
+	ctx, done := startRedisOperation(ctx, "HealthCheck")
+	defer done()
 	_, err := r.client.Ping(ctx).Result()
 	return err
 }
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 升级前就存在、现已带 KeyHashTag 的 key，旧名称为去掉标签的部分；其他带标签的 key 都是加上哈希标签之后才引入的，没有旧名称
+// 不同分数索引和排名顺序由总榜派生，迁移后启动时的 RebuildScoreIndex 会补建
+var taggedKeys = []string{LeaderboardKey}
+
+// 升级前就存在、现已带 KeyHashTag 的 key 前缀
+var taggedKeyPrefixes = []string{PlayerKeyPrefix}
+
+// MigrateKeys 将升级前不带 KeyHashTag 的 key 迁移到当前名称，返回迁移的 key 数，没有旧 key 时不做修改
+// 通过 DUMP/RESTORE 复制（保留剩余有效期）后删除旧 key，集群模式下新旧 key 位于不同槽位也能迁移；
+// 新 key 已存在时两者都保留并记录警告，需人工确认。迁移期间旧版本实例的写入可能丢失，应先停止旧版本实例
+// 全部迁移成功后写入 KeyMigrationMarkerKey，之后的调用直接返回 0，不再扫描
+func (r *RedisRepository) MigrateKeys(ctx context.Context) (int64, error) {
+	ctx, done := startRedisOperation(ctx, "MigrateKeys")
+	defer done()
+	migratedBefore, err := r.client.Exists(ctx, KeyMigrationMarkerKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check the key migration marker: %w", err)
+	}
+	if migratedBefore == 1 {
+		return 0, nil
+	}
+
+	legacy := make([]string, len(taggedKeys))
+	for i, key := range taggedKeys {
+		legacy[i] = strings.TrimPrefix(key, KeyHashTag)
+	}
+	migrated, err := r.migrateKeys(ctx, legacy)
+	if err != nil {
+		return migrated, err
+	}
+
+	// 集群模式下旧 key 分布在各节点上，逐个节点扫描
+	total := migrated
+	for _, prefix := range taggedKeyPrefixes {
+		pattern := strings.TrimPrefix(prefix, KeyHashTag) + "*"
+		err := r.forEachNode(ctx, func(ctx context.Context, node redis.Cmdable) error {
+			iter := node.Scan(ctx, 0, pattern, defaultIteratePageSize).Iterator()
+			keys := make([]string, 0, defaultIteratePageSize)
+			for iter.Next(ctx) {
+				keys = append(keys, iter.Val())
+				if len(keys) >= defaultIteratePageSize {
+					n, err := r.migrateKeys(ctx, keys)
+					atomic.AddInt64(&total, n)
+					if err != nil {
+						return err
+					}
+					keys = keys[:0]
+				}
+			}
+			if err := iter.Err(); err != nil {
+				return fmt.Errorf("failed to scan keys matching %s: %w", pattern, err)
+			}
+			n, err := r.migrateKeys(ctx, keys)
+			atomic.AddInt64(&total, n)
+			return err
+		})
+		if err != nil {
+			return atomic.LoadInt64(&total), err
+		}
+	}
+
+	if err := r.client.Set(ctx, KeyMigrationMarkerKey, "1", 0).Err(); err != nil {
+		return atomic.LoadInt64(&total), fmt.Errorf("failed to set the key migration marker: %w", err)
+	}
+	return atomic.LoadInt64(&total), nil
+}
+
+// 对每个保存数据的节点执行 fn：集群模式下并发地在每个主节点上执行，否则只对 client 本身执行
+func (r *RedisRepository) forEachNode(ctx context.Context, fn func(ctx context.Context, node redis.Cmdable) error) error {
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		return fn(ctx, r.client)
+	}
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return fn(ctx, node)
+	})
+}
+
+// 将一批旧 key 迁移到加上 KeyHashTag 的名称，返回迁移的 key 数；不存在的旧 key 跳过
+// 新旧 key 可能不在同一槽位，每个命令只操作一个 key
+func (r *RedisRepository) migrateKeys(ctx context.Context, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	dumps := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			dumps[i] = pipe.Dump(ctx, key)
+			ttls[i] = pipe.PTTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("failed to dump legacy keys: %w", err)
+	}
+
+	// 部分 RESTORE 失败不影响同批其他 key，逐条检查结果
+	restores := make([]*redis.StatusCmd, len(keys))
+	_, _ = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			// PTTL 为 -2 表示 DUMP 之后旧 key 已过期，-1 表示没有过期时间
+			ttl := ttls[i].Val()
+			if dumps[i].Err() != nil || ttl == -2 {
+				continue
+			}
+			if ttl < 0 {
+				ttl = 0
+			}
+			restores[i] = pipe.Restore(ctx, KeyHashTag+key, ttl, dumps[i].Val())
+		}
+		return nil
+	})
+
+	var restored []string
+	var restoreErr error
+	for i, cmd := range restores {
+		if cmd == nil {
+			continue
+		}
+		err := cmd.Err()
+		switch {
+		case err == nil:
+			restored = append(restored, keys[i])
+		case strings.HasPrefix(err.Error(), "BUSYKEY"):
+			r.logger.Warn("Skipping legacy redis key, the tagged key already exists", "key", keys[i], "taggedKey", KeyHashTag+keys[i])
+		case restoreErr == nil:
+			restoreErr = fmt.Errorf("failed to restore %s: %w", KeyHashTag+keys[i], err)
+		}
+	}
+
+	// 已复制的旧 key 即使其他 key 失败也要删除，避免下次迁移时与新 key 冲突
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range restored {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return int64(len(restored)), fmt.Errorf("failed to delete legacy keys: %w", err)
+	}
+	return int64(len(restored)), restoreErr
+}
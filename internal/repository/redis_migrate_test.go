@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMigrateKeys(t *testing.T) {
+	// 升级前的 key 及其 PTTL（毫秒，-1 为不过期）；player:p2 在 SCAN 之后、DUMP 之前过期
+	legacy := map[string]int64{
+		"leaderboard:global": -1,
+		"player:p1":          5000,
+		"player:p3":          -1,
+	}
+	repo, fake := newFakeRedis(t, func(args []string) interface{} {
+		switch args[0] {
+		case "DUMP":
+			if _, ok := legacy[args[1]]; ok {
+				return "dump:" + args[1]
+			}
+			return nil
+		case "PTTL":
+			if ttl, ok := legacy[args[1]]; ok {
+				return ttl
+			}
+			return int64(-2)
+		case "RESTORE":
+			// 新 key 已存在
+			if args[1] == PlayerKeyPrefix+"p3" {
+				return errors.New("BUSYKEY Target key name already exists.")
+			}
+			return "OK"
+		case "SCAN":
+			if args[3] == "player:*" {
+				return []interface{}{"0", []interface{}{"player:p1", "player:p2", "player:p3"}}
+			}
+			return []interface{}{"0", []interface{}{}}
+		case "DEL":
+			return int64(1)
+		case "EXISTS":
+			return int64(0)
+		case "SET":
+			return "OK"
+		}
+		return errors.New("ERR unexpected command " + args[0])
+	})
+
+	migrated, err := repo.MigrateKeys(context.Background())
+	if err != nil {
+		t.Fatalf("MigrateKeys() error = %v", err)
+	}
+	if migrated != 2 {
+		t.Errorf("MigrateKeys() = %d, want 2", migrated)
+	}
+
+	var restored, deleted, scanned, marked []string
+	for _, args := range fake.Commands() {
+		switch args[0] {
+		case "RESTORE":
+			// RESTORE key ttl value
+			restored = append(restored, args[1]+" "+args[2]+" "+args[3])
+		case "DEL":
+			deleted = append(deleted, args[1:]...)
+		case "SCAN":
+			scanned = append(scanned, args[3])
+		case "SET":
+			marked = append(marked, args[1])
+		}
+	}
+	wantRestored := []string{
+		LeaderboardKey + " 0 dump:leaderboard:global",
+		PlayerKeyPrefix + "p1 5000 dump:player:p1",
+		PlayerKeyPrefix + "p3 0 dump:player:p3",
+	}
+	if strings.Join(restored, ",") != strings.Join(wantRestored, ",") {
+		t.Errorf("RESTORE calls = %q, want %q", restored, wantRestored)
+	}
+	// 新 key 已存在的旧 key 保留，留给人工确认
+	wantDeleted := []string{"leaderboard:global", "player:p1"}
+	if strings.Join(deleted, ",") != strings.Join(wantDeleted, ",") {
+		t.Errorf("deleted keys = %q, want %q", deleted, wantDeleted)
+	}
+	// 只扫描升级前就存在的 key 前缀
+	if strings.Join(scanned, ",") != "player:*" {
+		t.Errorf("SCAN patterns = %q, want [player:*]", scanned)
+	}
+	if strings.Join(marked, ",") != KeyMigrationMarkerKey {
+		t.Errorf("SET keys = %q, want the migration marker", marked)
+	}
+}
+
+func TestMigrateKeysAlreadyMigrated(t *testing.T) {
+	repo, fake := newFakeRedis(t, func(args []string) interface{} {
+		if args[0] == "EXISTS" && args[1] == KeyMigrationMarkerKey {
+			return int64(1)
+		}
+		return errors.New("ERR unexpected command " + args[0])
+	})
+
+	migrated, err := repo.MigrateKeys(context.Background())
+	if err != nil || migrated != 0 {
+		t.Fatalf("MigrateKeys() = %d, %v, want 0, nil", migrated, err)
+	}
+	// 已有迁移标记时不再读取或扫描旧 key
+	if got := len(fake.Commands()); got != 1 {
+		t.Errorf("issued %d commands, want only the marker check", got)
+	}
+}
+
+func TestMigrateKeysWithoutLegacyKeys(t *testing.T) {
+	repo, fake := newFakeRedis(t, func(args []string) interface{} {
+		switch args[0] {
+		case "DUMP":
+			return nil
+		case "PTTL":
+			return int64(-2)
+		case "SCAN":
+			return []interface{}{"0", []interface{}{}}
+		case "EXISTS":
+			return int64(0)
+		case "SET":
+			return "OK"
+		}
+		return errors.New("ERR unexpected command " + args[0])
+	})
+
+	migrated, err := repo.MigrateKeys(context.Background())
+	if err != nil || migrated != 0 {
+		t.Fatalf("MigrateKeys() = %d, %v, want 0, nil", migrated, err)
+	}
+	if got := fake.CommandCount("RESTORE") + fake.CommandCount("DEL"); got != 0 {
+		t.Errorf("RESTORE and DEL issued %d times, want 0", got)
+	}
+	// 全新部署同样写入标记，之后启动不再扫描
+	if got := fake.CommandCount("SET"); got != 1 {
+		t.Errorf("SET issued %d times, want 1 for the marker", got)
+	}
+}
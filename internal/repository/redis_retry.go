@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RetryOptions 幂等 Redis 命令遇到临时错误时的重试配置
+// MaxRetries 为 0 时不重试；第 n 次重试前等待 MinBackoff*2^(n-1)，不超过 MaxBackoff
+type RetryOptions struct {
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// 第 attempt 次重试（从 1 开始）前的等待时长
+func (o RetryOptions) backoff(attempt int) time.Duration {
+	d := o.MinBackoff
+	for i := 1; i < attempt && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if o.MaxBackoff > 0 && d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	return d
+}
+
+// 可在重试后成功的临时错误前缀：节点加载数据、主从切换、集群迁移槽位等
+var retryableErrorPrefixes = []string{"LOADING ", "READONLY ", "MASTERDOWN ", "TRYAGAIN ", "CLUSTERDOWN "}
+
+// isRetryableError 判断错误是否为连接断开、超时或 Redis 的临时状态
+// redis.Nil 是命令的正常结果，ctx 取消或到期说明调用方已放弃，均不重试
+func isRetryableError(err error) bool {
+	if err == nil || err == redis.Nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	for _, prefix := range retryableErrorPrefixes {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry 执行 op，遇到临时错误时按 r.retry 退避重试，返回最后一次的错误
+// 只能用于重复执行结果不变的命令（读取、覆盖写入）；累加、入队等写入在连接断开时可能已经执行，重试会重复生效
+func (r *RedisRepository) withRetry(ctx context.Context, op func() error) error {
+	err := op()
+	for attempt := 1; attempt <= r.retry.MaxRetries && isRetryableError(err); attempt++ {
+		r.logger.Warn("Redis command failed, retrying", "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(r.retry.backoff(attempt)):
+		}
+		err = op()
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 前 failures 次 name 命令返回 reply 错误，之后返回 ok；其他命令按 writeReplies 回复
+func flakyReplies(name string, failures int, reply error, ok interface{}) func(args []string) interface{} {
+	calls := 0
+	return func(args []string) interface{} {
+		if args[0] != name {
+			return writeReplies(args)
+		}
+		calls++
+		if calls <= failures {
+			return reply
+		}
+		return ok
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	loading := errors.New("LOADING Redis is loading the dataset in memory")
+
+	tests := []struct {
+		name      string
+		respond   func(args []string) interface{}
+		wantScore float64
+		wantErr   error
+		wantCalls int
+	}{
+		{
+			name:      "transient errors are retried",
+			respond:   flakyReplies("ZSCORE", 2, loading, "42"),
+			wantScore: 42,
+			wantCalls: 3,
+		},
+		{
+			name:      "gives up after max retries",
+			respond:   flakyReplies("ZSCORE", 10, loading, "42"),
+			wantErr:   loading,
+			wantCalls: 4,
+		},
+		{
+			// redis.Nil 是正常结果，不重试
+			name:      "missing member is not retried",
+			respond:   flakyReplies("ZSCORE", 0, nil, nil),
+			wantErr:   ErrPlayerNotFound,
+			wantCalls: 1,
+		},
+		{
+			name:      "command errors are not retried",
+			respond:   flakyReplies("ZSCORE", 10, errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"), "42"),
+			wantErr:   errors.New("WRONGTYPE"),
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, fake := newFakeRedis(t, tt.respond)
+			repo.retry = RetryOptions{MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+			score, err := repo.GetPlayerScore(context.Background(), "p1")
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("GetPlayerScore() error = %v", err)
+			case tt.wantErr == ErrPlayerNotFound && !errors.Is(err, ErrPlayerNotFound):
+				t.Fatalf("GetPlayerScore() error = %v, want ErrPlayerNotFound", err)
+			case tt.wantErr != nil && (err == nil || !strings.Contains(err.Error(), tt.wantErr.Error())):
+				t.Fatalf("GetPlayerScore() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && score != tt.wantScore {
+				t.Errorf("GetPlayerScore() = %v, want %v", score, tt.wantScore)
+			}
+			if got := fake.CommandCount("ZSCORE"); got != tt.wantCalls {
+				t.Errorf("ZSCORE issued %d times, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIncrementIsNotRetried(t *testing.T) {
+	repo, fake := newFakeRedis(t, flakyReplies("EVALSHA", 10, errors.New("LOADING Redis is loading the dataset in memory"), "10"))
+	repo.retry = RetryOptions{MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	if _, err := repo.IncrementPlayerScore(context.Background(), "p1", 10, 10, "alice"); err == nil {
+		t.Fatal("IncrementPlayerScore() error = nil, want the LOADING error")
+	}
+	// 累加在连接断开前可能已经执行，重试会重复加分
+	if got := fake.CommandCount("EVALSHA") + fake.CommandCount("EVAL"); got != 1 {
+		t.Errorf("increment script issued %d times, want 1", got)
+	}
+}
+
+func TestUpdatePlayerScoreRetries(t *testing.T) {
+	repo, fake := newFakeRedis(t, flakyReplies("EVALSHA", 1, errors.New("READONLY You can't write against a read only replica."), "10"))
+	repo.retry = RetryOptions{MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	if err := repo.UpdatePlayerScore(context.Background(), "p1", 10, "alice", time.Now()); err != nil {
+		t.Fatalf("UpdatePlayerScore() error = %v", err)
+	}
+	if got := fake.CommandCount("EVALSHA"); got != 2 {
+		t.Errorf("EVALSHA issued %d times, want 2", got)
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"redis nil", redis.Nil, false},
+		{"canceled", context.Canceled, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"connection closed", io.EOF, true},
+		{"loading", errors.New("LOADING Redis is loading"), true},
+		{"cluster down", errors.New("CLUSTERDOWN The cluster is down"), true},
+		{"wrong type", errors.New("WRONGTYPE Operation against a key"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err); got != tt.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,992 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"game-leaderboard/internal/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestIterateLeaderboardStopsWhenCanceled(t *testing.T) {
+	repo, fake := newFakeRedis(t, func(args []string) interface{} {
+		if args[0] != "ZREVRANGE" {
+			return "OK"
+		}
+		// 每页返回两名玩家，成员格式与 RankOrderKey 一致
+		start, _ := strconv.Atoi(args[2])
+		return []interface{}{
+			"0:player" + strconv.Itoa(start+1), "100",
+			"0:player" + strconv.Itoa(start+2), "90",
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var pages [][]*model.RankInfo
+	err := repo.IterateLeaderboard(ctx, 2, func(page []*model.RankInfo) error {
+		pages = append(pages, page)
+		cancel()
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("IterateLeaderboard() error = %v, want context.Canceled", err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("IterateLeaderboard() visited %d pages, want 1", len(pages))
+	}
+	if got := pages[0][0].PlayerID; got != "player1" {
+		t.Errorf("first player = %q, want player1", got)
+	}
+	if got := fake.CommandCount("ZREVRANGE"); got != 1 {
+		t.Errorf("ZREVRANGE issued %d times, want 1", got)
+	}
+}
+
+// 写入玩家分数和名称时的回复：写入脚本返回写入后的分数
+func writeReplies(args []string) interface{} {
+	switch args[0] {
+	case "EVAL", "EVALSHA":
+		return "10"
+	case "SCRIPT":
+		return "0123456789abcdef0123456789abcdef01234567"
+	case "HSET", "EXPIRE":
+		return int64(1)
+	}
+	return "OK"
+}
+
+func TestPlayerMetadataWrites(t *testing.T) {
+	tests := []struct {
+		name          string
+		storeMetadata bool
+	}{
+		{name: "metadata in redis", storeMetadata: true},
+		{name: "metadata in mysql", storeMetadata: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, fake := newFakeRedis(t, writeReplies)
+			repo.storeMetadata = tt.storeMetadata
+
+			ctx := context.Background()
+			now := time.Now()
+			if err := repo.UpdatePlayerScore(ctx, "p1", 10, "alice", now); err != nil {
+				t.Fatalf("UpdatePlayerScore() error = %v", err)
+			}
+			if err := repo.UpdatePlayerScores(ctx, []*model.Player{{ID: "p2", Name: "bob", TotalScore: 10, UpdatedAt: now}}); err != nil {
+				t.Fatalf("UpdatePlayerScores() error = %v", err)
+			}
+			if _, err := repo.IncrementPlayerScore(ctx, "p3", 10, 10, "carol"); err != nil {
+				t.Fatalf("IncrementPlayerScore() error = %v", err)
+			}
+			if err := repo.SetPlayerNames(ctx, map[string]string{"p1": "alicia"}); err != nil {
+				t.Fatalf("SetPlayerNames() error = %v", err)
+			}
+
+			// 玩家信息 Hash 只会作为写入脚本的 KEYS 或 SetPlayerNames 的 HSET 出现
+			touched := map[string]bool{}
+			for _, args := range fake.Commands() {
+				for _, arg := range args[1:] {
+					if strings.HasPrefix(arg, PlayerKeyPrefix) {
+						touched[arg] = true
+					}
+				}
+			}
+
+			for _, playerID := range []string{"p1", "p2", "p3"} {
+				if got := touched[PlayerKeyPrefix+playerID]; got != tt.storeMetadata {
+					t.Errorf("player hash of %s written = %v, want %v", playerID, got, tt.storeMetadata)
+				}
+			}
+			if got := fake.CommandCount("HSET") > 0; got != tt.storeMetadata {
+				t.Errorf("HSET issued = %v, want %v", got, tt.storeMetadata)
+			}
+		})
+	}
+}
+
+func TestWritePlayerScoresKeepsIncrements(t *testing.T) {
+	repo, fake := newFakeRedis(t, writeReplies)
+
+	now := time.Now()
+	err := repo.WritePlayerScores(context.Background(), []*ScoreWrite{
+		{PlayerID: "p1", Increment: true, Delta: 5, Total: 105, UpdatedAt: now},
+		{PlayerID: "p2", Total: 70, UpdatedAt: now},
+	})
+	if err != nil {
+		t.Fatalf("WritePlayerScores() error = %v", err)
+	}
+
+	// EVALSHA sha numkeys KEYS... ARGV...，ARGV 以玩家ID、set 或 incr、分数或增量开头
+	var got []string
+	for _, args := range fake.Commands() {
+		if args[0] != "EVALSHA" {
+			continue
+		}
+		numKeys, _ := strconv.Atoi(args[2])
+		argv := args[3+numKeys:]
+		got = append(got, strings.Join(argv[:3], " "))
+	}
+	want := []string{"p1 incr 5", "p2 set 70"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("score script calls = %q, want %q", got, want)
+	}
+}
+
+func TestRedisVerifySchema(t *testing.T) {
+	tests := []struct {
+		keyType string
+		wantErr error
+	}{
+		{keyType: "zset"},
+		{keyType: "none"},
+		{keyType: "hash", wantErr: ErrSchemaMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.keyType, func(t *testing.T) {
+			repo, _ := newFakeRedis(t, func(args []string) interface{} {
+				return tt.keyType
+			})
+
+			if err := repo.VerifySchema(context.Background()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifySchema() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 总榜上有 size 名玩家的 Redis 回复：第 i 名（1-based）为 p<i>，分数为 (size-i+1)*10
+// 支持 GetPlayerRanks 的 MULTI/EVALSHA/ZCARD/EXEC 和总榜的 ZREVRANGE WITHSCORES
+func boardReplies(size int) func(args []string) interface{} {
+	var queued []string
+	return func(args []string) interface{} {
+		switch args[0] {
+		case "SCRIPT":
+			return "0123456789abcdef0123456789abcdef01234567"
+		case "MULTI":
+			queued = nil
+			return "OK"
+		case "EVALSHA":
+			// KEYS 数量之后依次为玩家ID和排名方向
+			queued = append(queued, args[5])
+			return "QUEUED"
+		case "ZCARD":
+			return "QUEUED"
+		case "EXEC":
+			replies := make([]interface{}, 0, len(queued)+1)
+			for _, playerID := range queued {
+				rank, err := strconv.Atoi(strings.TrimPrefix(playerID, "p"))
+				if err != nil || rank < 1 || rank > size {
+					replies = append(replies, nil)
+					continue
+				}
+				replies = append(replies, int64(rank-1))
+			}
+			return append(replies, int64(size))
+		case "ZREVRANGE":
+			start, _ := strconv.Atoi(args[2])
+			stop, _ := strconv.Atoi(args[3])
+			var reply []interface{}
+			for i := start; i <= stop && i < size; i++ {
+				reply = append(reply, "0:p"+strconv.Itoa(i+1), strconv.Itoa((size-i)*10))
+			}
+			return reply
+		}
+		return fmt.Errorf("ERR unexpected command %s", args[0])
+	}
+}
+
+func TestGetPlayerRankRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		playerID  string
+		rangeNum  int64
+		wantRanks []int
+	}{
+		{name: "centered", size: 10, playerID: "p5", rangeNum: 5, wantRanks: []int{3, 4, 5, 6, 7}},
+		{name: "even range puts the extra entry after the player", size: 10, playerID: "p5", rangeNum: 4, wantRanks: []int{4, 5, 6, 7}},
+		{name: "player at rank 1", size: 10, playerID: "p1", rangeNum: 5, wantRanks: []int{1, 2, 3, 4, 5}},
+		{name: "player at the last rank", size: 10, playerID: "p10", rangeNum: 5, wantRanks: []int{6, 7, 8, 9, 10}},
+		{name: "range larger than the board", size: 3, playerID: "p2", rangeNum: 7, wantRanks: []int{1, 2, 3}},
+		{name: "single entry", size: 10, playerID: "p4", rangeNum: 1, wantRanks: []int{4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := newFakeRedis(t, boardReplies(tt.size))
+			repo.storeMetadata = false
+
+			got, err := repo.GetPlayerRankRange(context.Background(), tt.playerID, tt.rangeNum)
+			if err != nil {
+				t.Fatalf("GetPlayerRankRange() error = %v", err)
+			}
+			if len(got) != len(tt.wantRanks) {
+				t.Fatalf("GetPlayerRankRange() returned %d entries, want %d", len(got), len(tt.wantRanks))
+			}
+			for i, rankInfo := range got {
+				// 名次与玩家在总榜上的真实名次一致
+				if rankInfo.Rank != tt.wantRanks[i] || rankInfo.PlayerID != "p"+strconv.Itoa(tt.wantRanks[i]) {
+					t.Errorf("entry %d = %s rank %d, want p%d rank %d", i, rankInfo.PlayerID, rankInfo.Rank, tt.wantRanks[i], tt.wantRanks[i])
+				}
+			}
+		})
+	}
+
+	t.Run("player not on the board", func(t *testing.T) {
+		repo, _ := newFakeRedis(t, boardReplies(3))
+		if _, err := repo.GetPlayerRankRange(context.Background(), "p9", 3); !errors.Is(err, ErrPlayerNotFound) {
+			t.Errorf("GetPlayerRankRange() error = %v, want ErrPlayerNotFound", err)
+		}
+	})
+}
+
+// 按 Redis 的语义保存总榜排名顺序的回复：写入脚本记录分数和排名顺序成员，
+// 排名顺序的 ZREVRANGE WITHSCORES 按分数、同分按成员字典序降序返回，排名脚本返回该顺序中的 0-based 名次
+func rankOrderReplies() func(args []string) interface{} {
+	scores := make(map[string]float64)
+	members := make(map[string]string)
+
+	// 排名顺序成员按总榜降序排列
+	ordered := func() []string {
+		ids := make([]string, 0, len(members))
+		for id := range members {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			if scores[ids[i]] != scores[ids[j]] {
+				return scores[ids[i]] > scores[ids[j]]
+			}
+			return members[ids[i]] > members[ids[j]]
+		})
+		return ids
+	}
+
+	var exec func(args []string) interface{}
+	exec = func(args []string) interface{} {
+		switch args[0] {
+		case "SCRIPT":
+			return "0123456789abcdef0123456789abcdef01234567"
+		case "EVALSHA":
+			numKeys, _ := strconv.Atoi(args[2])
+			keys, argv := args[3:3+numKeys], args[3+numKeys:]
+			if keys[0] == RankOrderKey {
+				for i, id := range ordered() {
+					if id == argv[0] {
+						return int64(i)
+					}
+				}
+				return nil
+			}
+			// 写入脚本的参数依次为玩家ID、模式、分数和排名顺序成员
+			score, _ := strconv.ParseFloat(argv[2], 64)
+			scores[argv[0]] = score
+			members[argv[0]] = argv[3]
+			return argv[2]
+		case "ZSCORE":
+			if score, ok := scores[args[2]]; ok {
+				return strconv.FormatFloat(score, 'f', -1, 64)
+			}
+			return nil
+		case "ZREVRANGE":
+			start, _ := strconv.Atoi(args[2])
+			stop, _ := strconv.Atoi(args[3])
+			var reply []interface{}
+			for i, id := range ordered() {
+				if i >= start && i <= stop {
+					reply = append(reply, members[id], strconv.FormatFloat(scores[id], 'f', -1, 64))
+				}
+			}
+			return reply
+		}
+		return fmt.Errorf("ERR unexpected command %s", args[0])
+	}
+
+	var queued [][]string
+	inMulti := false
+	return func(args []string) interface{} {
+		switch {
+		case args[0] == "MULTI":
+			inMulti, queued = true, nil
+			return "OK"
+		case args[0] == "EXEC":
+			inMulti = false
+			replies := make([]interface{}, 0, len(queued))
+			for _, cmd := range queued {
+				replies = append(replies, exec(cmd))
+			}
+			return replies
+		case inMulti:
+			queued = append(queued, args)
+			return "QUEUED"
+		}
+		return exec(args)
+	}
+}
+
+// 按查询中的 ORDER BY 子句对 players 表的行排序后返回，用于校验 SQL 的同分规则
+func orderedPlayerRows(players []*model.Player) func(query string, args []driver.Value) fakeResult {
+	clause := regexp.MustCompile(`(?s)ORDER BY\s+(.*?)\s+LIMIT`)
+	return func(query string, args []driver.Value) fakeResult {
+		match := clause.FindStringSubmatch(query)
+		if match == nil {
+			return fakeResult{err: fmt.Errorf("no ORDER BY in %q", query)}
+		}
+
+		sorted := append([]*model.Player(nil), players...)
+		terms := strings.Split(match[1], ",")
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, b := sorted[i], sorted[j]
+			for _, term := range terms {
+				fields := strings.Fields(term)
+				var cmp int
+				switch fields[0] {
+				case "total_score":
+					cmp = compareInt64(a.TotalScore, b.TotalScore)
+				case "updated_at":
+					cmp = a.UpdatedAt.Compare(b.UpdatedAt)
+				case "id":
+					cmp = strings.Compare(a.ID, b.ID)
+				}
+				if len(fields) > 1 && fields[1] == "DESC" {
+					cmp = -cmp
+				}
+				if cmp != 0 {
+					return cmp < 0
+				}
+			}
+			return false
+		})
+
+		limit := len(sorted)
+		if n, ok := args[len(args)-1].(int64); ok && int(n) < limit {
+			limit = int(n)
+		}
+		rows := make([][]driver.Value, 0, limit)
+		for _, p := range sorted[:limit] {
+			rows = append(rows, []driver.Value{p.ID, p.Name, p.TotalScore, p.CreatedAt, p.UpdatedAt})
+		}
+		return fakeResult{columns: playerColumns, rows: rows}
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// 一串同分玩家在 Redis 总榜中的前N名和名次与 GetTopPlayersFromDB 的顺序一致：先得到该分数者在前，同一秒内按玩家ID
+func TestEqualScoresMatchTopPlayersFromDB(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	players := []*model.Player{
+		{ID: "p1", TotalScore: 500, UpdatedAt: base.Add(3 * time.Second)},
+		{ID: "p2", TotalScore: 500, UpdatedAt: base.Add(time.Second)},
+		{ID: "p3", TotalScore: 500, UpdatedAt: base.Add(time.Second)},
+		{ID: "p4", TotalScore: 500, UpdatedAt: base},
+		{ID: "p5", TotalScore: 500, UpdatedAt: base.Add(2 * time.Second)},
+		{ID: "p10", TotalScore: 500, UpdatedAt: base.Add(time.Second)},
+		{ID: "p6", TotalScore: 900, UpdatedAt: base.Add(5 * time.Second)},
+		{ID: "p7", TotalScore: 100, UpdatedAt: base},
+	}
+
+	redisRepo, _ := newFakeRedis(t, rankOrderReplies())
+	redisRepo.storeMetadata = false
+	if err := redisRepo.UpdatePlayerScores(ctx, players); err != nil {
+		t.Fatalf("UpdatePlayerScores() error = %v", err)
+	}
+
+	mysqlRepo, _ := newFakeMySQL(t, 0, orderedPlayerRows(players))
+	fromDB, err := mysqlRepo.GetTopPlayersFromDB(ctx, len(players))
+	if err != nil {
+		t.Fatalf("GetTopPlayersFromDB() error = %v", err)
+	}
+	top, err := redisRepo.GetTopPlayers(ctx, int64(len(players)))
+	if err != nil {
+		t.Fatalf("GetTopPlayers() error = %v", err)
+	}
+
+	var dbOrder, redisOrder []string
+	for _, p := range fromDB {
+		dbOrder = append(dbOrder, p.ID)
+	}
+	for _, rankInfo := range top {
+		redisOrder = append(redisOrder, rankInfo.PlayerID)
+	}
+	if want := []string{"p6", "p4", "p3", "p2", "p10", "p5", "p1", "p7"}; strings.Join(dbOrder, ",") != strings.Join(want, ",") {
+		t.Fatalf("GetTopPlayersFromDB() order = %v, want %v", dbOrder, want)
+	}
+	if strings.Join(redisOrder, ",") != strings.Join(dbOrder, ",") {
+		t.Fatalf("GetTopPlayers() order = %v, want the database order %v", redisOrder, dbOrder)
+	}
+
+	for i, p := range fromDB {
+		rank, score, err := redisRepo.GetPlayerRankAndScore(ctx, p.ID)
+		if err != nil {
+			t.Fatalf("GetPlayerRankAndScore(%s) error = %v", p.ID, err)
+		}
+		if rank != int64(i+1) || int64(score) != p.TotalScore {
+			t.Errorf("GetPlayerRankAndScore(%s) = rank %d score %v, want rank %d score %d", p.ID, rank, score, i+1, p.TotalScore)
+		}
+	}
+}
+
+// 命令中作为 key 的参数：脚本为 KEYS，SCAN 为 MATCH 的 pattern，DEL 为全部参数，其他命令为第一个参数
+func commandKeys(args []string) []string {
+	switch args[0] {
+	case "MULTI", "EXEC", "SCRIPT":
+		return nil
+	case "EVAL", "EVALSHA":
+		numKeys, _ := strconv.Atoi(args[2])
+		return args[3 : 3+numKeys]
+	case "SCAN":
+		for i := 1; i+1 < len(args); i++ {
+			if args[i] == "MATCH" {
+				return args[i+1 : i+2]
+			}
+		}
+		return nil
+	case "DEL":
+		return args[1:]
+	}
+	return args[1:2]
+}
+
+func TestLeaderboardKeysShareHashTag(t *testing.T) {
+	var queued []string
+	repo, fake := newFakeRedis(t, func(args []string) interface{} {
+		switch args[0] {
+		case "MULTI":
+			queued = []string{}
+			return "OK"
+		case "EXEC":
+			replies := make([]interface{}, len(queued))
+			for i, name := range queued {
+				replies[i] = int64(1)
+				if name == "EVAL" || name == "EVALSHA" {
+					replies[i] = "10"
+				}
+			}
+			queued = nil
+			return replies
+		case "SCAN":
+			return []interface{}{"0", []interface{}{}}
+		}
+		if queued != nil {
+			queued = append(queued, args[0])
+			return "QUEUED"
+		}
+		return writeReplies(args)
+	})
+	repo.maxPlayers = 100
+
+	ctx := context.Background()
+	if err := repo.UpdatePlayerScore(ctx, "p1", 10, "alice", time.Now()); err != nil {
+		t.Fatalf("UpdatePlayerScore() error = %v", err)
+	}
+	if err := repo.BlockPlayers(ctx, []string{"p2"}); err != nil {
+		t.Fatalf("BlockPlayers() error = %v", err)
+	}
+	if _, err := repo.WriteScoreAndEnqueue(ctx, &model.PendingScoreWrite{PlayerID: "p3", ScoreChange: 5}, 5); err != nil {
+		t.Fatalf("WriteScoreAndEnqueue() error = %v", err)
+	}
+	if _, err := repo.ClearLeaderboard(ctx); err != nil {
+		t.Fatalf("ClearLeaderboard() error = %v", err)
+	}
+
+	// 集群模式下脚本和 MULTI 中的 key 须位于同一槽位，脚本内不能访问 KEYS 之外的 key
+	for _, args := range fake.Commands() {
+		for _, key := range commandKeys(args) {
+			if !strings.HasPrefix(key, KeyHashTag) {
+				t.Errorf("%s uses key %q without the %s hash tag", args[0], key, KeyHashTag)
+			}
+		}
+	}
+}
+
+func TestScoreWritePartitions(t *testing.T) {
+	ctx := context.Background()
+	// 死信队列中依次为 p1、无法解析的元素、p2
+	dead := []string{`{"writeId":"w1","playerId":"p1"}`, "not json", `{"writeId":"w2","playerId":"p2"}`}
+	repo, fake := newFakeRedis(t, func(args []string) interface{} {
+		switch args[0] {
+		case "RPUSH":
+			return int64(1)
+		case "LRANGE":
+			start, _ := strconv.Atoi(args[2])
+			var items []interface{}
+			for _, item := range dead[min(start, len(dead)):] {
+				items = append(items, item)
+			}
+			return items
+		case "EVALSHA":
+			// requeueDeadScoreWriteScript：从死信队列移除 ARGV[1]
+			for i, item := range dead {
+				if item == args[5] {
+					dead = append(dead[:i], dead[i+1:]...)
+					return int64(1)
+				}
+			}
+			return int64(0)
+		}
+		return writeReplies(args)
+	})
+
+	if err := repo.EnqueueScoreWrite(ctx, &model.PendingScoreWrite{WriteID: "w3", PlayerID: "p1"}); err != nil {
+		t.Fatalf("EnqueueScoreWrite() error = %v", err)
+	}
+	moved, err := repo.RequeueDeadScoreWrites(ctx)
+	if err != nil || moved != 2 {
+		t.Fatalf("RequeueDeadScoreWrites() = %d, %v, want 2, nil", moved, err)
+	}
+	// 无法解析的元素留在死信队列
+	if len(dead) != 1 || dead[0] != "not json" {
+		t.Errorf("dead queue = %q, want only the malformed entry", dead)
+	}
+
+	// 同一玩家的变更总是进入同一分区
+	var pushed, requeued []string
+	for _, args := range fake.Commands() {
+		switch args[0] {
+		case "RPUSH":
+			pushed = append(pushed, args[1])
+		case "EVALSHA":
+			requeued = append(requeued, args[4])
+		}
+	}
+	p1, p2 := scoreWritePendingKey(ScoreWritePartition("p1")), scoreWritePendingKey(ScoreWritePartition("p2"))
+	if strings.Join(pushed, ",") != p1 {
+		t.Errorf("RPUSH keys = %q, want [%s]", pushed, p1)
+	}
+	if strings.Join(requeued, ",") != p1+","+p2 {
+		t.Errorf("requeued into %q, want [%s %s]", requeued, p1, p2)
+	}
+}
+
+func TestTrimDeletesPlayerInfo(t *testing.T) {
+	tests := []struct {
+		name          string
+		storeMetadata bool
+		wantDeleted   string
+	}{
+		{name: "metadata in redis", storeMetadata: true, wantDeleted: PlayerKeyPrefix + "p3 " + PlayerKeyPrefix + "p4"},
+		{name: "metadata in mysql", storeMetadata: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, fake := newFakeRedis(t, func(args []string) interface{} {
+				if args[0] == "EVALSHA" && args[1] == trimScript.Hash() {
+					return []interface{}{"p3", "p4"}
+				}
+				if args[0] == "DEL" {
+					return int64(len(args) - 1)
+				}
+				return writeReplies(args)
+			})
+			repo.storeMetadata = tt.storeMetadata
+			repo.maxPlayers = 2
+
+			if err := repo.UpdatePlayerScore(context.Background(), "p1", 10, "alice", time.Now()); err != nil {
+				t.Fatalf("UpdatePlayerScore() error = %v", err)
+			}
+
+			var trimArgs, deleted []string
+			for _, args := range fake.Commands() {
+				switch {
+				case args[0] == "EVALSHA" && args[1] == trimScript.Hash():
+					numKeys, _ := strconv.Atoi(args[2])
+					trimArgs = args[3+numKeys:]
+				case args[0] == "DEL":
+					deleted = append(deleted, args[1:]...)
+				}
+			}
+			if got := strings.Join(trimArgs, " "); got != "2 desc 1000" {
+				t.Errorf("trim script ARGV = %q, want %q", got, "2 desc 1000")
+			}
+			if got := strings.Join(deleted, " "); got != tt.wantDeleted {
+				t.Errorf("deleted keys = %q, want %q", got, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestRebuildRankOrder(t *testing.T) {
+	desc := &RedisRepository{}
+	tests := []struct {
+		name     string
+		ordered  int64
+		wantArgs string
+	}{
+		{name: "rank order exists", ordered: 2},
+		{
+			// p2 没有玩家信息，按最早得分处理
+			name:     "rank order missing",
+			wantArgs: "p1 " + desc.rankOrderMember("p1", time.Unix(100, 0)) + " p2 " + desc.rankOrderMember("p2", time.Unix(0, 0)),
+		},
+		{
+			// 上次补建中途失败，只有部分玩家有排名顺序
+			name:     "rank order partially built",
+			ordered:  1,
+			wantArgs: "p1 " + desc.rankOrderMember("p1", time.Unix(100, 0)) + " p2 " + desc.rankOrderMember("p2", time.Unix(0, 0)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, fake := newFakeRedis(t, func(args []string) interface{} {
+				switch args[0] {
+				case "EVALSHA":
+					if args[1] == rebuildRankOrderScript.Hash() {
+						return int64(1)
+					}
+					return nil
+				case "EXISTS":
+					// 不同分数索引已存在
+					return int64(1)
+				case "HLEN":
+					return tt.ordered
+				case "ZCARD":
+					return int64(2)
+				case "ZRANGE":
+					return []interface{}{"p1", "p2"}
+				case "HGET":
+					if args[1] == PlayerKeyPrefix+"p1" {
+						return "100"
+					}
+					return nil
+				}
+				return writeReplies(args)
+			})
+
+			rebuilt, err := repo.RebuildScoreIndex(context.Background(), false)
+			if err != nil {
+				t.Fatalf("RebuildScoreIndex() error = %v", err)
+			}
+			if want := tt.wantArgs != ""; rebuilt != want {
+				t.Errorf("RebuildScoreIndex() = %v, want %v", rebuilt, want)
+			}
+
+			var gotArgs string
+			for _, args := range fake.Commands() {
+				if args[0] == "EVALSHA" && args[1] == rebuildRankOrderScript.Hash() {
+					numKeys, _ := strconv.Atoi(args[2])
+					gotArgs = strings.Join(args[3+numKeys:], " ")
+				}
+			}
+			if gotArgs != tt.wantArgs {
+				t.Errorf("rank order script ARGV = %q, want %q", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestRebuildScoreIndexInBatches(t *testing.T) {
+	const size = 2*rebuildBatchSize + 500
+
+	// 不同分数索引脚本依次返回每批的最高分数，之后返回 nil 表示没有更多玩家
+	lastScores := []interface{}{"10", "20", "30"}
+	repo, fake := newFakeRedis(t, func(args []string) interface{} {
+		switch args[0] {
+		case "EVALSHA":
+			if args[1] == rebuildRankOrderScript.Hash() {
+				return int64(1)
+			}
+			if len(lastScores) == 0 {
+				return nil
+			}
+			last := lastScores[0]
+			lastScores = lastScores[1:]
+			return last
+		case "HLEN":
+			return int64(0)
+		case "ZCARD":
+			return int64(size)
+		case "ZRANGE":
+			start, _ := strconv.Atoi(args[2])
+			stop, _ := strconv.Atoi(args[3])
+			var reply []interface{}
+			for i := start; i <= stop && i < size; i++ {
+				reply = append(reply, "p"+strconv.Itoa(i))
+			}
+			return reply
+		case "HGET":
+			return nil
+		}
+		return writeReplies(args)
+	})
+
+	rebuilt, err := repo.RebuildScoreIndex(context.Background(), true)
+	if err != nil || !rebuilt {
+		t.Fatalf("RebuildScoreIndex() = %v, %v, want true, nil", rebuilt, err)
+	}
+
+	var indexArgs []string
+	var orderBatches []int
+	for _, args := range fake.Commands() {
+		if args[0] != "EVALSHA" {
+			continue
+		}
+		numKeys, _ := strconv.Atoi(args[2])
+		argv := args[3+numKeys:]
+		if args[1] == rebuildRankOrderScript.Hash() {
+			orderBatches = append(orderBatches, len(argv)/2)
+		} else {
+			indexArgs = append(indexArgs, strings.Join(argv, " "))
+		}
+	}
+	// 下一批从上一批最高分数之后开始
+	wantIndexArgs := []string{"-inf 1000", "(10 1000", "(20 1000", "(30 1000"}
+	if strings.Join(indexArgs, ",") != strings.Join(wantIndexArgs, ",") {
+		t.Errorf("score index script ARGV = %q, want %q", indexArgs, wantIndexArgs)
+	}
+	if fmt.Sprint(orderBatches) != fmt.Sprint([]int{rebuildBatchSize, rebuildBatchSize, 500}) {
+		t.Errorf("rank order batches = %v, want [1000 1000 500]", orderBatches)
+	}
+}
+
+// 按 operation 标签统计 Redis 操作耗时的样本数
+func redisOperationCounts(t *testing.T) map[string]uint64 {
+	t.Helper()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(storeOperationDuration)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	counts := make(map[string]uint64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			if labels["store"] == storeRedis {
+				counts[labels["operation"]] = metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return counts
+}
+
+func TestRedisOperationMetrics(t *testing.T) {
+	repo, _ := newFakeRedis(t, boardReplies(10))
+	repo.storeMetadata = false
+	ctx := context.Background()
+	before := redisOperationCounts(t)
+
+	if _, err := repo.GetPlayerRankRange(ctx, "p5", 3); err != nil {
+		t.Fatalf("GetPlayerRankRange() error = %v", err)
+	}
+	// 共用同一客户端的其他调用（如 L2 缓存）不计入
+	repo.client.Get(ctx, "cache:rank:p5")
+
+	after := redisOperationCounts(t)
+	for operation, count := range after {
+		delta := count - before[operation]
+		want := uint64(0)
+		if operation == "GetPlayerRankRange" {
+			want = 1
+		}
+		// 内部调用的 GetPlayerRanks 和 GetPlayersByRankRange 计入外层操作
+		if delta != want {
+			t.Errorf("operation %q recorded %d times, want %d", operation, delta, want)
+		}
+	}
+	if after["GetPlayerRankRange"] == before["GetPlayerRankRange"] {
+		t.Error("GetPlayerRankRange was not recorded")
+	}
+}
+
+// 按 Redis 有序集合的语义应答排名相关的读命令，sets 为 key -> 成员 -> 分数；MULTI 中的命令在 EXEC 时一起返回
+func sortedSetReplies(sets map[string]map[string]float64) func(args []string) interface{} {
+	// 按分数升序、同分按成员字典序排列
+	sorted := func(key string) []string {
+		members := make([]string, 0, len(sets[key]))
+		for member := range sets[key] {
+			members = append(members, member)
+		}
+		sort.Slice(members, func(i, j int) bool {
+			a, b := sets[key][members[i]], sets[key][members[j]]
+			if a != b {
+				return a < b
+			}
+			return members[i] < members[j]
+		})
+		return members
+	}
+	reverse := func(members []string) {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+	inRange := func(score float64, min, max string) bool {
+		bound := func(s string) (float64, bool) {
+			exclusive := strings.HasPrefix(s, "(")
+			v, _ := strconv.ParseFloat(strings.TrimPrefix(s, "("), 64)
+			return v, exclusive
+		}
+		lo, loEx := bound(min)
+		hi, hiEx := bound(max)
+		return (score > lo || (!loEx && score == lo)) && (score < hi || (!hiEx && score == hi))
+	}
+
+	var queued []interface{}
+	inMulti := false
+	var reply func(args []string) interface{}
+	reply = func(args []string) interface{} {
+		switch args[0] {
+		case "MULTI":
+			inMulti, queued = true, nil
+			return "OK"
+		case "EXEC":
+			inMulti = false
+			return queued
+		}
+		if inMulti {
+			inMulti = false
+			queued = append(queued, reply(args))
+			inMulti = true
+			return "QUEUED"
+		}
+
+		switch args[0] {
+		case "SCRIPT":
+			return rankScript.Hash()
+		case "EVALSHA":
+			// rankScript：KEYS 为排名顺序和排名顺序成员，ARGV 为玩家ID和排名方向
+			members := sorted(args[3])
+			if args[6] == RankOrderDesc {
+				reverse(members)
+			}
+			for rank, member := range members {
+				if rankOrderPlayerID(member) == args[5] {
+					return int64(rank)
+				}
+			}
+			return nil
+		case "ZCARD":
+			return int64(len(sets[args[1]]))
+		case "ZCOUNT":
+			count := int64(0)
+			for _, score := range sets[args[1]] {
+				if inRange(score, args[2], args[3]) {
+					count++
+				}
+			}
+			return count
+		case "ZRANGE", "ZREVRANGE":
+			members := sorted(args[1])
+			if args[0] == "ZREVRANGE" {
+				reverse(members)
+			}
+			start, _ := strconv.Atoi(args[2])
+			stop, _ := strconv.Atoi(args[3])
+			var result []interface{}
+			for i := start; i <= stop && i < len(members); i++ {
+				result = append(result, members[i], strconv.FormatFloat(sets[args[1]][members[i]], 'f', -1, 64))
+			}
+			return result
+		}
+		return fmt.Errorf("ERR unexpected command %s", args[0])
+	}
+	return reply
+}
+
+// 分数低者在前的总榜：第 1 名是最低分，同分时先得分者在前
+func TestAscendingBoardRanks(t *testing.T) {
+	asc := &RedisRepository{ascending: true}
+	base := time.Unix(1700000000, 0)
+	scores := map[string]float64{"p1": 30, "p2": 10, "p3": 20, "p4": 20, "p5": 40}
+	// p4 比 p3 先得到 20 分
+	updatedAt := map[string]time.Time{"p1": base, "p2": base, "p3": base.Add(time.Minute), "p4": base, "p5": base}
+
+	order := make(map[string]float64)
+	members := make(map[string]float64)
+	distinct := make(map[string]float64)
+	for playerID, score := range scores {
+		order[asc.rankOrderMember(playerID, updatedAt[playerID])] = score
+		members[playerID] = 1
+		distinct[strconv.FormatFloat(score, 'f', -1, 64)] = score
+	}
+	repo, _ := newFakeRedis(t, sortedSetReplies(map[string]map[string]float64{
+		LeaderboardKey:      scores,
+		RankOrderKey:        order,
+		RankOrderMembersKey: members,
+		DistinctScoresKey:   distinct,
+	}))
+	repo.ascending = true
+	repo.storeMetadata = false
+	ctx := context.Background()
+
+	ids := func(rankings []*model.RankInfo) string {
+		var parts []string
+		for _, r := range rankings {
+			parts = append(parts, fmt.Sprintf("%d:%s:%d", r.Rank, r.PlayerID, r.Score))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	for playerID, want := range map[string]int64{"p2": 1, "p4": 2, "p3": 3, "p1": 4, "p5": 5} {
+		if rank, err := repo.GetPlayerRank(ctx, playerID); err != nil || rank != want {
+			t.Errorf("GetPlayerRank(%s) = %d, %v, want %d", playerID, rank, err, want)
+		}
+	}
+
+	top, err := repo.GetTopPlayers(ctx, 3)
+	if err != nil {
+		t.Fatalf("GetTopPlayers() error = %v", err)
+	}
+	if got, want := ids(top), "1:p2:10 2:p4:20 3:p3:20"; got != want {
+		t.Errorf("GetTopPlayers(3) = %q, want %q", got, want)
+	}
+
+	// 分页：第二页从第 3 名开始
+	page, err := repo.GetPlayersByRankRange(ctx, 2, 3)
+	if err != nil {
+		t.Fatalf("GetPlayersByRankRange() error = %v", err)
+	}
+	if got, want := ids(page), "3:p3:20 4:p1:30"; got != want {
+		t.Errorf("GetPlayersByRankRange(2, 3) = %q, want %q", got, want)
+	}
+
+	around, err := repo.GetPlayerRankRange(ctx, "p3", 3)
+	if err != nil {
+		t.Fatalf("GetPlayerRankRange() error = %v", err)
+	}
+	if got, want := ids(around), "2:p4:20 3:p3:20 4:p1:30"; got != want {
+		t.Errorf("GetPlayerRankRange(p3, 3) = %q, want %q", got, want)
+	}
+
+	// 密集排名 = 更低的不同分数个数 + 1
+	for score, want := range map[int64]int64{10: 0, 20: 1, 30: 2, 40: 3} {
+		if better, err := repo.CountBetterScores(ctx, score); err != nil || better != want {
+			t.Errorf("CountBetterScores(%d) = %d, %v, want %d", score, better, err, want)
+		}
+	}
+
+	rank, tied, err := repo.GetRankForScore(ctx, 20)
+	if err != nil || rank != 2 || tied != 2 {
+		t.Errorf("GetRankForScore(20) = %d, %d, %v, want 2, 2", rank, tied, err)
+	}
+}
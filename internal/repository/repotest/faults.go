@@ -0,0 +1,85 @@
+// Package repotest 提供 repository.RedisStore 和 repository.MySQLStore 的内存实现，供服务层和接口层测试使用
+package repotest
+
+import (
+	"errors"
+	"sync"
+
+	"game-leaderboard/internal/repository"
+)
+
+var (
+	_ repository.RedisStore = (*RedisStore)(nil)
+	_ repository.MySQLStore = (*MySQLStore)(nil)
+)
+
+// ErrInjected FailNext 未指定错误时注入的错误
+var ErrInjected = errors.New("injected failure")
+
+// faults 按方法名注入失败并统计调用次数，内存存储的每个方法在执行前调用 check
+type faults struct {
+	mu      sync.Mutex
+	pending map[string]fault
+	calls   map[string]int
+}
+
+type fault struct {
+	remaining int // 小于 0 时一直失败
+	err       error
+}
+
+// FailNext 使方法 method 接下来的 n 次调用返回 err（为 nil 时为 ErrInjected），n 小于 0 时一直失败直到 Recover
+func (f *faults) FailNext(method string, n int, err error) {
+	if err == nil {
+		err = ErrInjected
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pending == nil {
+		f.pending = make(map[string]fault)
+	}
+	if n == 0 {
+		delete(f.pending, method)
+		return
+	}
+	f.pending[method] = fault{remaining: n, err: err}
+}
+
+// Recover 取消方法 method 尚未触发的失败
+func (f *faults) Recover(method string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.pending, method)
+}
+
+// Calls 返回方法 method 被调用的次数，包括注入失败的调用
+func (f *faults) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// 记录一次调用，需要失败时返回注入的错误
+func (f *faults) check(method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[method]++
+
+	pending, ok := f.pending[method]
+	if !ok {
+		return nil
+	}
+	if pending.remaining > 0 {
+		pending.remaining--
+		if pending.remaining == 0 {
+			delete(f.pending, method)
+		} else {
+			f.pending[method] = pending
+		}
+	}
+	return pending.err
+}
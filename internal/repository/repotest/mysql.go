@@ -0,0 +1,553 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/repository"
+	"game-leaderboard/pkg/utils"
+)
+
+// MySQLStore repository.MySQLStore 的内存实现，分数变更、上限检查和排名规则与 MySQLRepository 一致
+// 时间精确到秒（与 DATETIME 列相同）；未实现的方法（分数衰减、重置等）调用时 panic
+type MySQLStore struct {
+	repository.MySQLStore
+	faults
+
+	mu          sync.Mutex
+	maxScore    int64
+	players     map[string]*model.Player
+	attrs       map[string]model.PlayerAttributes
+	history     []*model.PlayerScoreHistory
+	writeIDs    map[string]bool
+	expirations []*expiration
+	snapshots   []*model.LeaderboardSnapshot
+}
+
+type expiration struct {
+	playerID    string
+	scoreChange int64
+	reason      string
+	expiresAt   time.Time
+	reverted    bool
+}
+
+// NewMySQLStore maxScore 与 repository.NewMySQLRepository 相同，为 0 时不限制
+func NewMySQLStore(maxScore int64) *MySQLStore {
+	return &MySQLStore{
+		maxScore: maxScore,
+		players:  make(map[string]*model.Player),
+		attrs:    make(map[string]model.PlayerAttributes),
+		writeIDs: make(map[string]bool),
+	}
+}
+
+// AddPlayer 直接写入玩家记录，不记录分数历史；updatedAt 为零值时使用当前时间
+func (m *MySQLStore) AddPlayer(player model.Player) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if player.UpdatedAt.IsZero() {
+		player.UpdatedAt = now()
+	}
+	if player.CreatedAt.IsZero() {
+		player.CreatedAt = player.UpdatedAt
+	}
+	m.players[player.ID] = &player
+}
+
+// Player 返回玩家记录的副本，不计入调用次数
+func (m *MySQLStore) Player(playerID string) (model.Player, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	player, ok := m.players[playerID]
+	if !ok {
+		return model.Player{}, false
+	}
+	return *player, true
+}
+
+// History 返回玩家的全部分数历史，按写入顺序，不计入调用次数
+func (m *MySQLStore) History(playerID string) []model.PlayerScoreHistory {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var history []model.PlayerScoreHistory
+	for _, h := range m.history {
+		if h.PlayerID == playerID {
+			history = append(history, *h)
+		}
+	}
+	return history
+}
+
+// 与 MySQL NOW() 相同只保留到秒
+func now() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+// 与 MySQLRepository.changeScore 相同：计算新的总分、检查上限、写入玩家和分数历史
+func (m *MySQLStore) changeScore(name string, history *model.PlayerScoreHistory, compute func(currentScore int64) (int64, error)) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var currentScore int64
+	player, ok := m.players[history.PlayerID]
+	if ok {
+		currentScore = player.TotalScore
+	}
+
+	finalScore, err := compute(currentScore)
+	if err != nil {
+		return 0, err
+	}
+	if m.maxScore > 0 && utils.AbsScore(finalScore) > m.maxScore && utils.AbsScore(finalScore) > utils.AbsScore(currentScore) {
+		return 0, fmt.Errorf("%w: %d exceeds the limit of %d", repository.ErrScoreOutOfRange, finalScore, m.maxScore)
+	}
+	if history.WriteID != "" {
+		if m.writeIDs[history.WriteID] {
+			return 0, repository.ErrDuplicateEntry
+		}
+		m.writeIDs[history.WriteID] = true
+	}
+
+	t := now()
+	if !ok {
+		player = &model.Player{ID: history.PlayerID, CreatedAt: t}
+		m.players[history.PlayerID] = player
+	}
+	player.Name = name
+	player.TotalScore = finalScore
+	player.UpdatedAt = t
+
+	history.FinalScore = finalScore
+	saved := *history
+	saved.ID = int64(len(m.history)) + 1
+	saved.CreatedAt = t
+	m.history = append(m.history, &saved)
+	return finalScore, nil
+}
+
+func (m *MySQLStore) HealthCheck(ctx context.Context) error {
+	return m.check("HealthCheck")
+}
+
+func (m *MySQLStore) ApplyScoreChange(ctx context.Context, name string, history *model.PlayerScoreHistory, expiresAt time.Time) (int64, error) {
+	if err := m.check("ApplyScoreChange"); err != nil {
+		return 0, err
+	}
+	finalScore, err := m.changeScore(name, history, func(currentScore int64) (int64, error) {
+		finalScore, ok := utils.AddScore(currentScore, history.ScoreChange)
+		if !ok {
+			return 0, fmt.Errorf("%w: %d%+d overflows int64", repository.ErrScoreOutOfRange, currentScore, history.ScoreChange)
+		}
+		return finalScore, nil
+	})
+	if err != nil || expiresAt.IsZero() || history.ScoreChange == 0 {
+		return finalScore, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expirations = append(m.expirations, &expiration{
+		playerID:    history.PlayerID,
+		scoreChange: history.ScoreChange,
+		reason:      history.Reason,
+		expiresAt:   expiresAt,
+	})
+	return finalScore, nil
+}
+
+func (m *MySQLStore) SetPlayerScore(ctx context.Context, name string, history *model.PlayerScoreHistory, score int64) (int64, error) {
+	if err := m.check("SetPlayerScore"); err != nil {
+		return 0, err
+	}
+	finalScore, err := m.changeScore(name, history, func(currentScore int64) (int64, error) {
+		change, ok := utils.AddScore(score, -currentScore)
+		if !ok {
+			return 0, fmt.Errorf("%w: change from %d to %d overflows int64", repository.ErrScoreOutOfRange, currentScore, score)
+		}
+		history.RawScoreChange = change
+		history.ScoreChange = change
+		return score, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.expirations {
+		if e.playerID == history.PlayerID {
+			e.reverted = true
+		}
+	}
+	return finalScore, nil
+}
+
+func (m *MySQLStore) RevertExpiredScore(ctx context.Context, at time.Time) (*model.PlayerScoreHistory, string, error) {
+	if err := m.check("RevertExpiredScore"); err != nil {
+		return nil, "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := m.nextExpiration(at)
+	if next == nil {
+		return nil, "", nil
+	}
+	next.reverted = true
+
+	player := m.players[next.playerID]
+	player.TotalScore -= next.scoreChange
+	player.UpdatedAt = now()
+
+	history := &model.PlayerScoreHistory{
+		ID:             int64(len(m.history)) + 1,
+		PlayerID:       next.playerID,
+		RawScoreChange: -next.scoreChange,
+		ScoreChange:    -next.scoreChange,
+		FinalScore:     player.TotalScore,
+		Reason:         repository.ExpiredReasonPrefix + next.reason,
+		CreatedAt:      player.UpdatedAt,
+	}
+	saved := *history
+	m.history = append(m.history, &saved)
+	return history, player.Name, nil
+}
+
+func (m *MySQLStore) ClaimExpiredScore(ctx context.Context, at time.Time) (*model.PlayerScoreHistory, string, error) {
+	if err := m.check("ClaimExpiredScore"); err != nil {
+		return nil, "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := m.nextExpiration(at)
+	if next == nil {
+		return nil, "", nil
+	}
+	next.reverted = true
+
+	return &model.PlayerScoreHistory{
+		PlayerID:       next.playerID,
+		RawScoreChange: -next.scoreChange,
+		ScoreChange:    -next.scoreChange,
+		Reason:         repository.ExpiredReasonPrefix + next.reason,
+	}, m.players[next.playerID].Name, nil
+}
+
+// 最早到期且未扣回的临时分数，调用方需持有 m.mu
+func (m *MySQLStore) nextExpiration(at time.Time) *expiration {
+	var next *expiration
+	for _, e := range m.expirations {
+		if !e.reverted && !e.expiresAt.After(at) && (next == nil || e.expiresAt.Before(next.expiresAt)) {
+			next = e
+		}
+	}
+	return next
+}
+
+func (m *MySQLStore) UpdatePlayerNames(ctx context.Context, names map[string]string) (int64, error) {
+	if err := m.check("UpdatePlayerNames"); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var updated int64
+	for playerID, name := range names {
+		if player, ok := m.players[playerID]; ok && player.Name != name {
+			player.Name = name
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func (m *MySQLStore) UpdatePlayerAttributes(ctx context.Context, playerID string, attrs model.PlayerAttributes) error {
+	if err := m.check("UpdatePlayerAttributes"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.players[playerID]; !ok {
+		return repository.ErrPlayerNotFound
+	}
+	m.attrs[playerID] = attrs
+	return nil
+}
+
+func (m *MySQLStore) GetPlayer(ctx context.Context, playerID string) (*model.Player, error) {
+	if err := m.check("GetPlayer"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	player, ok := m.players[playerID]
+	if !ok {
+		return nil, repository.ErrPlayerNotFound
+	}
+	result := *player
+	return &result, nil
+}
+
+func (m *MySQLStore) GetPlayerNames(ctx context.Context, playerIDs []string) (map[string]string, error) {
+	if err := m.check("GetPlayerNames"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make(map[string]string, len(playerIDs))
+	for _, playerID := range playerIDs {
+		if player, ok := m.players[playerID]; ok {
+			names[playerID] = player.Name
+		}
+	}
+	return names, nil
+}
+
+func (m *MySQLStore) GetPlayersByIDs(ctx context.Context, playerIDs []string) (map[string]*model.Player, error) {
+	if err := m.check("GetPlayersByIDs"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	players := make(map[string]*model.Player, len(playerIDs))
+	for _, playerID := range playerIDs {
+		if player, ok := m.players[playerID]; ok {
+			result := *player
+			players[playerID] = &result
+		}
+	}
+	return players, nil
+}
+
+// 名称前缀匹配不区分大小写，与 utf8mb4_0900_ai_ci 排序规则下的 LIKE 一致（不处理重音）
+func (m *MySQLStore) SearchPlayersByName(ctx context.Context, query string, limit int) ([]*model.Player, error) {
+	if err := m.check("SearchPlayersByName"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var players []*model.Player
+	for _, player := range m.players {
+		if strings.HasPrefix(strings.ToLower(player.Name), strings.ToLower(query)) {
+			result := *player
+			players = append(players, &result)
+		}
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].Name < players[j].Name })
+	if len(players) > limit {
+		players = players[:limit]
+	}
+	return players, nil
+}
+
+func (m *MySQLStore) GetScoreHistory(ctx context.Context, playerID string, limit, offset int) ([]*model.PlayerScoreHistory, error) {
+	if err := m.check("GetScoreHistory"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history := make([]*model.PlayerScoreHistory, 0)
+	for i := len(m.history) - 1; i >= 0; i-- {
+		if m.history[i].PlayerID == playerID {
+			h := *m.history[i]
+			history = append(history, &h)
+		}
+	}
+	if offset >= len(history) {
+		return history[:0], nil
+	}
+	history = history[offset:]
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
+
+// 排名顺序与 MySQLRepository.GetRankedPlayers 相同，调用方需持有 m.mu
+func (m *MySQLStore) ahead(a, b *model.Player, ascending bool) bool {
+	if a.TotalScore != b.TotalScore {
+		if ascending {
+			return a.TotalScore < b.TotalScore
+		}
+		return a.TotalScore > b.TotalScore
+	}
+	if !a.UpdatedAt.Equal(b.UpdatedAt) {
+		return a.UpdatedAt.Before(b.UpdatedAt)
+	}
+	if ascending {
+		return a.ID < b.ID
+	}
+	return a.ID > b.ID
+}
+
+func (m *MySQLStore) GetFilteredRank(ctx context.Context, playerID string, filter model.PlayerFilter, excludeIDs []string, dense, ascending bool) (*model.FilteredRankInfo, error) {
+	if err := m.check("GetFilteredRank"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	player, ok := m.players[playerID]
+	if !ok {
+		return nil, repository.ErrPlayerNotFound
+	}
+
+	excluded := make(map[string]bool, len(excludeIDs))
+	for _, id := range excludeIDs {
+		excluded[id] = true
+	}
+
+	var total, ahead int64
+	betterScores := make(map[int64]bool)
+	for _, other := range m.players {
+		if excluded[other.ID] || !filter.Matches(m.attrs[other.ID]) {
+			continue
+		}
+		total++
+		if m.ahead(other, player, ascending) {
+			ahead++
+		}
+		if other.TotalScore != player.TotalScore && m.ahead(other, player, ascending) {
+			betterScores[other.TotalScore] = true
+		}
+	}
+
+	rankInfo := &model.FilteredRankInfo{
+		PlayerID: playerID,
+		Rank:     ahead + 1,
+		Score:    player.TotalScore,
+		Total:    total,
+		InSubset: filter.Matches(m.attrs[playerID]),
+		Filter:   filter,
+	}
+	if dense {
+		rankInfo.Rank = int64(len(betterScores)) + 1
+	}
+	return rankInfo, nil
+}
+
+func (m *MySQLStore) GetRankedPlayers(ctx context.Context, limit int, ascending bool) ([]*model.Player, error) {
+	if err := m.check("GetRankedPlayers"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	players := m.all()
+	sort.Slice(players, func(i, j int) bool { return m.ahead(players[i], players[j], ascending) })
+	if len(players) > limit {
+		players = players[:limit]
+	}
+	return players, nil
+}
+
+func (m *MySQLStore) GetAllPlayers(ctx context.Context) ([]*model.Player, error) {
+	if err := m.check("GetAllPlayers"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.all(), nil
+}
+
+// 全部玩家的副本，按玩家ID排序，调用方需持有 m.mu
+func (m *MySQLStore) all() []*model.Player {
+	players := make([]*model.Player, 0, len(m.players))
+	for _, player := range m.players {
+		result := *player
+		players = append(players, &result)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].ID < players[j].ID })
+	return players
+}
+
+// GetScoreBuckets 与 FLOOR(total_score / size) 分组一致，负分向下取整
+func (m *MySQLStore) GetScoreBuckets(ctx context.Context, size int64, limit int) ([]model.ScoreBucket, error) {
+	if err := m.check("GetScoreBuckets"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[int64]int64)
+	for _, player := range m.players {
+		bucket := player.TotalScore / size
+		if player.TotalScore%size != 0 && player.TotalScore < 0 {
+			bucket--
+		}
+		counts[bucket]++
+	}
+
+	buckets := make([]model.ScoreBucket, 0, len(counts))
+	for bucket, count := range counts {
+		buckets = append(buckets, model.ScoreBucket{MinScore: bucket * size, MaxScore: bucket*size + size - 1, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].MinScore < buckets[j].MinScore })
+	if len(buckets) > limit {
+		buckets = buckets[:limit]
+	}
+	return buckets, nil
+}
+
+func (m *MySQLStore) SaveLeaderboardSnapshot(ctx context.Context, snapshotData []byte, playerCount int) error {
+	if err := m.check("SaveLeaderboardSnapshot"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots = append(m.snapshots, &model.LeaderboardSnapshot{
+		ID:           int64(len(m.snapshots)) + 1,
+		SnapshotData: append([]byte(nil), snapshotData...),
+		PlayerCount:  playerCount,
+		CreatedAt:    now(),
+	})
+	return nil
+}
+
+func (m *MySQLStore) GetSnapshot(ctx context.Context, id int64) (*model.LeaderboardSnapshot, error) {
+	if err := m.check("GetSnapshot"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.snapshots) == 0 {
+		return nil, repository.ErrNoSnapshot
+	}
+	if id == 0 {
+		id = int64(len(m.snapshots))
+	}
+	if id < 0 || id > int64(len(m.snapshots)) {
+		return nil, repository.ErrNoSnapshot
+	}
+	snapshot := *m.snapshots[id-1]
+	return &snapshot, nil
+}
+
+func (m *MySQLStore) RestorePlayerScores(ctx context.Context, players []*model.Player) error {
+	if err := m.check("RestorePlayerScores"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, player := range m.players {
+		player.TotalScore = 0
+	}
+	for _, restored := range players {
+		player, ok := m.players[restored.ID]
+		if !ok {
+			player = &model.Player{ID: restored.ID, CreatedAt: now()}
+			m.players[restored.ID] = player
+		}
+		player.Name = restored.Name
+		player.TotalScore = restored.TotalScore
+		player.UpdatedAt = restored.UpdatedAt
+	}
+	for _, e := range m.expirations {
+		e.reverted = true
+	}
+	return nil
+}
@@ -0,0 +1,990 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/repository"
+)
+
+// RedisStore repository.RedisStore 的内存实现，排名顺序和同分规则与 RedisRepository 一致：
+// 同分时得分时间（秒）较早者在前，仍相同时 desc 按玩家ID倒序、asc 按玩家ID正序
+// 未实现的方法（分数区间等）调用时 panic
+type RedisStore struct {
+	repository.RedisStore
+	faults
+
+	mu            sync.Mutex
+	storeMetadata bool
+	ascending     bool
+
+	scores    map[string]*scoreEntry
+	distinct  []int64               // 总榜中出现过的不同分数，从小到大，对应 DistinctScoresKey
+	counts    map[int64]int         // 每个分数的玩家数，对应 ScoreCountsKey
+	info      map[string]playerInfo // 玩家信息 Hash，storeMetadata 为 false 时不写入
+	windows   map[string]map[string]int64
+	blocked   map[string]bool
+	receipts  map[string]*model.UpdateReceipt // 值为 nil 表示处理中
+	builds    map[string]map[string]int
+	ranks     map[string]int
+	rankTime  time.Time
+	peakRanks map[string]peakRank
+	snapshot  []byte // 缓存快照，不处理过期时间
+
+	// 先写 Redis 模式的写入队列，依次对应各分区的待处理、处理中队列和 ScoreWriteDeadKey
+	pendingWrites    [repository.ScoreWritePartitions][]*model.PendingScoreWrite
+	processingWrites [repository.ScoreWritePartitions][]*model.PendingScoreWrite
+	deadWrites       []*model.PendingScoreWrite
+	leases           map[int]scoreWriteLease
+}
+
+type scoreWriteLease struct {
+	owner     string
+	expiresAt time.Time
+}
+
+type scoreEntry struct {
+	playerID  string
+	score     int64
+	updatedAt time.Time
+}
+
+type playerInfo struct {
+	name      string
+	updatedAt time.Time
+}
+
+type peakRank struct {
+	rank       int64
+	achievedAt time.Time
+}
+
+// NewRedisStore 参数与 repository.NewRedisRepository 相同，rankOrder 为空时按 RankOrderDesc 处理
+func NewRedisStore(storeMetadata bool, rankOrder string) *RedisStore {
+	return &RedisStore{
+		storeMetadata: storeMetadata,
+		ascending:     rankOrder == repository.RankOrderAsc,
+		scores:        make(map[string]*scoreEntry),
+		counts:        make(map[int64]int),
+		info:          make(map[string]playerInfo),
+		windows:       make(map[string]map[string]int64),
+		blocked:       make(map[string]bool),
+		receipts:      make(map[string]*model.UpdateReceipt),
+		builds:        make(map[string]map[string]int),
+		ranks:         make(map[string]int),
+		peakRanks:     make(map[string]peakRank),
+		leases:        make(map[int]scoreWriteLease),
+	}
+}
+
+// Score 返回玩家在总榜中的分数，不在榜上时 ok 为 false；不计入调用次数
+func (r *RedisStore) Score(playerID string) (score int64, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.scores[playerID]
+	if !ok {
+		return 0, false
+	}
+	return entry.score, true
+}
+
+// 按排名顺序 a 是否排在 b 之前
+func (r *RedisStore) ahead(a, b *scoreEntry) bool {
+	if a.score != b.score {
+		if r.ascending {
+			return a.score < b.score
+		}
+		return a.score > b.score
+	}
+	ta, tb := orderTime(a.updatedAt), orderTime(b.updatedAt)
+	if ta != tb {
+		return ta < tb
+	}
+	if r.ascending {
+		return a.playerID < b.playerID
+	}
+	return a.playerID > b.playerID
+}
+
+// 排名顺序只精确到秒，与 RedisRepository 的排名顺序成员一致
+func orderTime(t time.Time) int64 {
+	if ts := t.Unix(); ts > 0 {
+		return ts
+	}
+	return 0
+}
+
+// 按排名顺序排列的总榜，调用方需持有 r.mu
+func (r *RedisStore) ranked() []*scoreEntry {
+	entries := make([]*scoreEntry, 0, len(r.scores))
+	for _, entry := range r.scores {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return r.ahead(entries[i], entries[j]) })
+	return entries
+}
+
+// 玩家的 1-based 名次，不在榜上时返回 0，调用方需持有 r.mu
+func (r *RedisStore) rankOf(playerID string) int64 {
+	entry, ok := r.scores[playerID]
+	if !ok {
+		return 0
+	}
+	rank := int64(1)
+	for _, other := range r.scores {
+		if other != entry && r.ahead(other, entry) {
+			rank++
+		}
+	}
+	return rank
+}
+
+// 排在 score 之前的分数，调用方需持有 r.mu
+func (r *RedisStore) better(a, b int64) bool {
+	if r.ascending {
+		return a < b
+	}
+	return a > b
+}
+
+// 0-based 闭区间 [start, stop] 内的玩家，调用方需持有 r.mu
+func (r *RedisStore) rankRange(start, stop int64) []*model.RankInfo {
+	entries := r.ranked()
+	if start < 0 {
+		start = 0
+	}
+	if stop < 0 || stop >= int64(len(entries)) {
+		stop = int64(len(entries)) - 1
+	}
+
+	rankings := make([]*model.RankInfo, 0)
+	for i := start; i <= stop; i++ {
+		rankings = append(rankings, &model.RankInfo{
+			PlayerID: entries[i].playerID,
+			Rank:     int(i) + 1,
+			Score:    entries[i].score,
+			Name:     r.info[entries[i].playerID].name,
+		})
+	}
+	return rankings
+}
+
+// 写入总榜并维护不同分数索引，调用方需持有 r.mu
+func (r *RedisStore) write(playerID string, score int64, name string, updatedAt time.Time) {
+	r.remove(playerID)
+	r.scores[playerID] = &scoreEntry{playerID: playerID, score: score, updatedAt: updatedAt}
+	if r.counts[score]++; r.counts[score] == 1 {
+		i := sort.Search(len(r.distinct), func(i int) bool { return r.distinct[i] >= score })
+		r.distinct = append(r.distinct, 0)
+		copy(r.distinct[i+1:], r.distinct[i:])
+		r.distinct[i] = score
+	}
+	if r.storeMetadata {
+		r.info[playerID] = playerInfo{name: name, updatedAt: updatedAt}
+	}
+}
+
+// 从总榜移除玩家并维护不同分数索引，调用方需持有 r.mu
+func (r *RedisStore) remove(playerID string) {
+	entry, ok := r.scores[playerID]
+	if !ok {
+		return
+	}
+	delete(r.scores, playerID)
+	if r.counts[entry.score]--; r.counts[entry.score] > 0 {
+		return
+	}
+	delete(r.counts, entry.score)
+	i := sort.Search(len(r.distinct), func(i int) bool { return r.distinct[i] >= entry.score })
+	r.distinct = append(r.distinct[:i], r.distinct[i+1:]...)
+}
+
+func (r *RedisStore) StoresMetadata() bool {
+	return r.storeMetadata
+}
+
+func (r *RedisStore) Ascending() bool {
+	return r.ascending
+}
+
+func (r *RedisStore) HealthCheck(ctx context.Context) error {
+	return r.check("HealthCheck")
+}
+
+func (r *RedisStore) UpdatePlayerScore(ctx context.Context, playerID string, score int64, name string, updatedAt time.Time) error {
+	if err := r.check("UpdatePlayerScore"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.write(playerID, score, name, updatedAt)
+	return nil
+}
+
+func (r *RedisStore) UpdatePlayerScores(ctx context.Context, players []*model.Player) error {
+	if err := r.check("UpdatePlayerScores"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, player := range players {
+		r.write(player.ID, player.TotalScore, player.Name, player.UpdatedAt)
+	}
+	return nil
+}
+
+func (r *RedisStore) IncrementPlayerScore(ctx context.Context, playerID string, incrScore, total int64, name string) (int64, error) {
+	return r.IncrementPlayerScoreAt(ctx, playerID, incrScore, total, name, time.Now())
+}
+
+func (r *RedisStore) IncrementPlayerScoreAt(ctx context.Context, playerID string, incrScore, total int64, name string, updatedAt time.Time) (int64, error) {
+	if err := r.check("IncrementPlayerScore"); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	score := total
+	if entry, ok := r.scores[playerID]; ok {
+		score = entry.score + incrScore
+	}
+	r.write(playerID, score, name, updatedAt)
+	return score, nil
+}
+
+func (r *RedisStore) WritePlayerScores(ctx context.Context, writes []*repository.ScoreWrite) error {
+	if err := r.check("WritePlayerScores"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, w := range writes {
+		score := w.Total
+		if entry, ok := r.scores[w.PlayerID]; ok && w.Increment {
+			score = entry.score + w.Delta
+		}
+		r.write(w.PlayerID, score, w.Name, w.UpdatedAt)
+	}
+	return nil
+}
+
+func (r *RedisStore) SetPlayerNames(ctx context.Context, names map[string]string) error {
+	if err := r.check("SetPlayerNames"); err != nil {
+		return err
+	}
+	if !r.storeMetadata {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for playerID, name := range names {
+		info := r.info[playerID]
+		info.name = name
+		r.info[playerID] = info
+	}
+	return nil
+}
+
+func (r *RedisStore) RebuildScoreIndex(ctx context.Context, force bool) (bool, error) {
+	if err := r.check("RebuildScoreIndex"); err != nil {
+		return false, err
+	}
+	return force, nil
+}
+
+func (r *RedisStore) ClearLeaderboard(ctx context.Context) (int64, error) {
+	if err := r.check("ClearLeaderboard"); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	removed := int64(len(r.scores))
+	r.scores = make(map[string]*scoreEntry)
+	r.distinct = nil
+	r.counts = make(map[int64]int)
+	r.info = make(map[string]playerInfo)
+	r.windows = make(map[string]map[string]int64)
+	r.builds = make(map[string]map[string]int)
+	r.ranks = make(map[string]int)
+	r.rankTime = time.Time{}
+	r.peakRanks = make(map[string]peakRank)
+	return removed, nil
+}
+
+func (r *RedisStore) GetPlayerRank(ctx context.Context, playerID string) (int64, error) {
+	if err := r.check("GetPlayerRank"); err != nil {
+		return -1, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rank := r.rankOf(playerID)
+	if rank == 0 {
+		return -1, repository.ErrPlayerNotFound
+	}
+	return rank, nil
+}
+
+func (r *RedisStore) GetPlayerRanks(ctx context.Context, playerIDs []string) (map[string]int64, int64, error) {
+	if err := r.check("GetPlayerRanks"); err != nil {
+		return nil, 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ranks := make(map[string]int64, len(playerIDs))
+	for _, playerID := range playerIDs {
+		if rank := r.rankOf(playerID); rank > 0 {
+			ranks[playerID] = rank
+		}
+	}
+	return ranks, int64(len(r.scores)), nil
+}
+
+func (r *RedisStore) GetPlayerRankInfos(ctx context.Context, playerIDs []string) (map[string]*model.RankInfo, error) {
+	if err := r.check("GetPlayerRankInfos"); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rankInfos := make(map[string]*model.RankInfo, len(playerIDs))
+	for _, playerID := range playerIDs {
+		if rank := r.rankOf(playerID); rank > 0 {
+			rankInfos[playerID] = &model.RankInfo{
+				PlayerID: playerID,
+				Rank:     int(rank),
+				Score:    r.scores[playerID].score,
+			}
+		}
+	}
+	return rankInfos, nil
+}
+
+func (r *RedisStore) GetPlayerScore(ctx context.Context, playerID string) (float64, error) {
+	if err := r.check("GetPlayerScore"); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.scores[playerID]
+	if !ok {
+		return 0, repository.ErrPlayerNotFound
+	}
+	return float64(entry.score), nil
+}
+
+func (r *RedisStore) GetPlayerRankAndScore(ctx context.Context, playerID string) (int64, float64, error) {
+	if err := r.check("GetPlayerRankAndScore"); err != nil {
+		return -1, 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rank := r.rankOf(playerID)
+	if rank == 0 {
+		return -1, 0, repository.ErrPlayerNotFound
+	}
+	return rank, float64(r.scores[playerID].score), nil
+}
+
+func (r *RedisStore) GetRankForScore(ctx context.Context, score int64) (int64, int64, error) {
+	if err := r.check("GetRankForScore"); err != nil {
+		return 0, 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var better, tied int64
+	for _, entry := range r.scores {
+		switch {
+		case entry.score == score:
+			tied++
+		case r.better(entry.score, score):
+			better++
+		}
+	}
+	return better + 1, tied, nil
+}
+
+// 与 RedisRepository 相同通过不同分数索引统计，不遍历总榜
+func (r *RedisStore) CountBetterScores(ctx context.Context, score int64) (int64, error) {
+	if err := r.check("CountBetterScores"); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ascending {
+		return int64(sort.Search(len(r.distinct), func(i int) bool { return r.distinct[i] >= score })), nil
+	}
+	return int64(len(r.distinct) - sort.Search(len(r.distinct), func(i int) bool { return r.distinct[i] > score })), nil
+}
+
+func (r *RedisStore) GetScoreAtRank(ctx context.Context, rank int64) (string, int64, error) {
+	if err := r.check("GetScoreAtRank"); err != nil {
+		return "", 0, err
+	}
+	if rank <= 0 {
+		return "", 0, repository.ErrRankOutOfRange
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.ranked()
+	if rank > int64(len(entries)) {
+		return "", 0, repository.ErrRankOutOfRange
+	}
+	return entries[rank-1].playerID, entries[rank-1].score, nil
+}
+
+func (r *RedisStore) GetTopPlayers(ctx context.Context, n int64) ([]*model.RankInfo, error) {
+	if err := r.check("GetTopPlayers"); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rankRange(0, n-1), nil
+}
+
+func (r *RedisStore) GetPlayersByRankRange(ctx context.Context, start, end int64) ([]*model.RankInfo, error) {
+	if err := r.check("GetPlayersByRankRange"); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rankRange(start, end), nil
+}
+
+func (r *RedisStore) GetPlayerRankRange(ctx context.Context, playerID string, rangeNum int64) ([]*model.RankInfo, error) {
+	if err := r.check("GetPlayerRankRange"); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rank := r.rankOf(playerID)
+	if rank == 0 {
+		return nil, repository.ErrPlayerNotFound
+	}
+
+	size := int64(len(r.scores))
+	start := rank - 1 - (rangeNum-1)/2
+	if start+rangeNum > size {
+		start = size - rangeNum
+	}
+	if start < 0 {
+		start = 0
+	}
+	return r.rankRange(start, start+rangeNum-1), nil
+}
+
+func (r *RedisStore) IterateLeaderboard(ctx context.Context, pageSize int64, fn func(page []*model.RankInfo) error) error {
+	if err := r.check("IterateLeaderboard"); err != nil {
+		return err
+	}
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+
+	r.mu.Lock()
+	rankings := r.rankRange(0, -1)
+	r.mu.Unlock()
+
+	for start := 0; start < len(rankings); start += int(pageSize) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := start + int(pageSize)
+		if end > len(rankings) {
+			end = len(rankings)
+		}
+		page := rankings[start:end]
+		for _, rankInfo := range page {
+			rankInfo.Name = ""
+		}
+		if err := fn(page); err != nil {
+			if err == repository.ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RedisStore) GetLeaderboardSize(ctx context.Context) (int64, error) {
+	if err := r.check("GetLeaderboardSize"); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(len(r.scores)), nil
+}
+
+func (r *RedisStore) GetPlayerLastActive(ctx context.Context, playerID string) (time.Time, error) {
+	if err := r.check("GetPlayerLastActive"); err != nil {
+		return time.Time{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.info[playerID]
+	if !ok {
+		return time.Time{}, repository.ErrPlayerNotFound
+	}
+	return time.Unix(info.updatedAt.Unix(), 0), nil
+}
+
+func (r *RedisStore) IncrementWindowScores(ctx context.Context, playerID string, incrScore int64) error {
+	return r.IncrementWindowScoresBatch(ctx, map[string]int64{playerID: incrScore})
+}
+
+func (r *RedisStore) IncrementWindowScoresBatch(ctx context.Context, increments map[string]int64) error {
+	if err := r.check("IncrementWindowScores"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, window := range []string{repository.WindowDaily, repository.WindowWeekly, repository.WindowMonthly} {
+		key, _ := repository.WindowKey(window, now)
+		board := r.windows[key]
+		if board == nil {
+			board = make(map[string]int64)
+			r.windows[key] = board
+		}
+		for playerID, incrScore := range increments {
+			board[playerID] += incrScore
+		}
+	}
+	return nil
+}
+
+func (r *RedisStore) GetWindowTopPlayers(ctx context.Context, window string, n int64) ([]*model.RankInfo, error) {
+	if err := r.check("GetWindowTopPlayers"); err != nil {
+		return nil, err
+	}
+	key, err := repository.WindowKey(window, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	board := r.windows[key]
+	entries := make([]*scoreEntry, 0, len(board))
+	for playerID, score := range board {
+		entries = append(entries, &scoreEntry{playerID: playerID, score: score})
+	}
+	// 时间窗口排行榜没有得分时间，同分时只按玩家ID排序
+	sort.Slice(entries, func(i, j int) bool { return r.ahead(entries[i], entries[j]) })
+	if int64(len(entries)) > n {
+		entries = entries[:n]
+	}
+
+	rankings := make([]*model.RankInfo, len(entries))
+	for i, entry := range entries {
+		rankings[i] = &model.RankInfo{
+			PlayerID: entry.playerID,
+			Rank:     i + 1,
+			Score:    entry.score,
+			Name:     r.info[entry.playerID].name,
+		}
+	}
+	return rankings, nil
+}
+
+func (r *RedisStore) GetWindowSize(ctx context.Context, window string) (int64, error) {
+	if err := r.check("GetWindowSize"); err != nil {
+		return 0, err
+	}
+	key, err := repository.WindowKey(window, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(len(r.windows[key])), nil
+}
+
+func (r *RedisStore) BlockPlayers(ctx context.Context, playerIDs []string) error {
+	if err := r.check("BlockPlayers"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, playerID := range playerIDs {
+		r.blocked[playerID] = true
+		r.remove(playerID)
+		for _, board := range r.windows {
+			delete(board, playerID)
+		}
+	}
+	return nil
+}
+
+func (r *RedisStore) UnblockPlayers(ctx context.Context, playerIDs []string) error {
+	if err := r.check("UnblockPlayers"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, playerID := range playerIDs {
+		delete(r.blocked, playerID)
+	}
+	return nil
+}
+
+func (r *RedisStore) IsPlayerBlocked(ctx context.Context, playerID string) (bool, error) {
+	if err := r.check("IsPlayerBlocked"); err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.blocked[playerID], nil
+}
+
+func (r *RedisStore) GetBlockedPlayers(ctx context.Context) ([]string, error) {
+	if err := r.check("GetBlockedPlayers"); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	playerIDs := make([]string, 0, len(r.blocked))
+	for playerID := range r.blocked {
+		playerIDs = append(playerIDs, playerID)
+	}
+	sort.Strings(playerIDs)
+	return playerIDs, nil
+}
+
+// 幂等键不会过期，ttl 被忽略
+func (r *RedisStore) ClaimIdempotencyKey(ctx context.Context, key string, ttl time.Duration) (bool, *model.UpdateReceipt, error) {
+	if err := r.check("ClaimIdempotencyKey"); err != nil {
+		return false, nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if receipt, ok := r.receipts[key]; ok {
+		return false, receipt, nil
+	}
+	r.receipts[key] = nil
+	return true, nil, nil
+}
+
+func (r *RedisStore) CompleteIdempotencyKey(ctx context.Context, key string, receipt *model.UpdateReceipt, ttl time.Duration) error {
+	if err := r.check("CompleteIdempotencyKey"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saved := *receipt
+	r.receipts[key] = &saved
+	return nil
+}
+
+func (r *RedisStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	if err := r.check("ReleaseIdempotencyKey"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.receipts, key)
+	return nil
+}
+
+func (r *RedisStore) WritePrecomputedRanks(ctx context.Context, buildKey string, ranks map[string]int) error {
+	if err := r.check("WritePrecomputedRanks"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	build := r.builds[buildKey]
+	if build == nil {
+		build = make(map[string]int, len(ranks))
+		r.builds[buildKey] = build
+	}
+	for playerID, rank := range ranks {
+		build[playerID] = rank
+	}
+	return nil
+}
+
+func (r *RedisStore) PublishPrecomputedRanks(ctx context.Context, buildKey string, computedAt time.Time) error {
+	if err := r.check("PublishPrecomputedRanks"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ranks = r.builds[buildKey]
+	if r.ranks == nil {
+		r.ranks = make(map[string]int)
+	}
+	delete(r.builds, buildKey)
+	r.rankTime = time.Unix(computedAt.Unix(), 0)
+	return nil
+}
+
+func (r *RedisStore) DiscardPrecomputedRanks(ctx context.Context, buildKey string) error {
+	if err := r.check("DiscardPrecomputedRanks"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.builds, buildKey)
+	return nil
+}
+
+func (r *RedisStore) GetPrecomputedRank(ctx context.Context, playerID string) (int, time.Time, error) {
+	if err := r.check("GetPrecomputedRank"); err != nil {
+		return 0, time.Time{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rank, ok := r.ranks[playerID]
+	if !ok || r.rankTime.IsZero() {
+		return 0, time.Time{}, repository.ErrPlayerNotFound
+	}
+	return rank, r.rankTime, nil
+}
+
+func (r *RedisStore) UpdatePeakRanks(ctx context.Context, playerIDs []string) error {
+	if err := r.check("UpdatePeakRanks"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Unix(time.Now().Unix(), 0)
+	for _, playerID := range playerIDs {
+		rank := r.rankOf(playerID)
+		if rank == 0 {
+			continue
+		}
+		if best, ok := r.peakRanks[playerID]; ok && best.rank <= rank {
+			continue
+		}
+		r.peakRanks[playerID] = peakRank{rank: rank, achievedAt: now}
+	}
+	return nil
+}
+
+func (r *RedisStore) GetPeakRank(ctx context.Context, playerID string) (int64, time.Time, error) {
+	if err := r.check("GetPeakRank"); err != nil {
+		return 0, time.Time{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	best, ok := r.peakRanks[playerID]
+	if !ok {
+		return 0, time.Time{}, repository.ErrPlayerNotFound
+	}
+	return best.rank, best.achievedAt, nil
+}
+
+func (r *RedisStore) SaveCacheSnapshot(ctx context.Context, data []byte, ttl time.Duration) error {
+	if err := r.check("SaveCacheSnapshot"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.snapshot = append([]byte(nil), data...)
+	return nil
+}
+
+func (r *RedisStore) LoadCacheSnapshot(ctx context.Context) ([]byte, error) {
+	if err := r.check("LoadCacheSnapshot"); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.snapshot == nil {
+		return nil, repository.ErrNoSnapshot
+	}
+	return r.snapshot, nil
+}
+
+func (r *RedisStore) WriteScoreAndEnqueue(ctx context.Context, write *model.PendingScoreWrite, total int64) (int64, error) {
+	if err := r.check("WriteScoreAndEnqueue"); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	score := write.Score
+	if !write.SetAbsolute {
+		score = total
+		if entry, ok := r.scores[write.PlayerID]; ok {
+			score = entry.score + write.ScoreChange
+		}
+	}
+	r.write(write.PlayerID, score, write.Name, write.QueuedAt)
+	r.enqueue(write)
+	return score, nil
+}
+
+func (r *RedisStore) EnqueueScoreWrite(ctx context.Context, write *model.PendingScoreWrite) error {
+	if err := r.check("EnqueueScoreWrite"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enqueue(write)
+	return nil
+}
+
+// 将 write 的副本加入玩家所在分区的待处理队列，调用方需持有 r.mu
+func (r *RedisStore) enqueue(write *model.PendingScoreWrite) {
+	queued := *write
+	p := repository.ScoreWritePartition(write.PlayerID)
+	r.pendingWrites[p] = append(r.pendingWrites[p], &queued)
+}
+
+func (r *RedisStore) AcquireScoreWritePartition(ctx context.Context, partition int, owner string, ttl time.Duration) (bool, error) {
+	if err := r.check("AcquireScoreWritePartition"); err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if lease, ok := r.leases[partition]; ok && lease.owner != owner && now.Before(lease.expiresAt) {
+		return false, nil
+	}
+	r.leases[partition] = scoreWriteLease{owner: owner, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (r *RedisStore) ReleaseScoreWritePartition(ctx context.Context, partition int, owner string) error {
+	if err := r.check("ReleaseScoreWritePartition"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.leases[partition].owner == owner {
+		delete(r.leases, partition)
+	}
+	return nil
+}
+
+// LeaseOwner 返回分区租约的持有者，租约不存在或已过期时返回空字符串；不计入调用次数
+func (r *RedisStore) LeaseOwner(partition int) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lease, ok := r.leases[partition]
+	if !ok || !time.Now().Before(lease.expiresAt) {
+		return ""
+	}
+	return lease.owner
+}
+
+// ClaimScoreWrite 队列为空时每毫秒检查一次，最多等待 timeout
+func (r *RedisStore) ClaimScoreWrite(ctx context.Context, partition int, timeout time.Duration) (*repository.ClaimedScoreWrite, error) {
+	if err := r.check("ClaimScoreWrite"); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		r.mu.Lock()
+		if len(r.pendingWrites[partition]) > 0 {
+			write := r.pendingWrites[partition][0]
+			r.pendingWrites[partition] = r.pendingWrites[partition][1:]
+			r.processingWrites[partition] = append(r.processingWrites[partition], write)
+			r.mu.Unlock()
+			return &repository.ClaimedScoreWrite{PendingScoreWrite: write, Partition: partition}, nil
+		}
+		r.mu.Unlock()
+
+		if !time.Now().Before(deadline) {
+			return nil, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (r *RedisStore) AckScoreWrite(ctx context.Context, claimed *repository.ClaimedScoreWrite) error {
+	if err := r.check("AckScoreWrite"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := claimed.Partition
+	r.processingWrites[p] = removeWrite(r.processingWrites[p], claimed.PendingScoreWrite)
+	return nil
+}
+
+func (r *RedisStore) DeadLetterScoreWrite(ctx context.Context, claimed *repository.ClaimedScoreWrite) error {
+	if err := r.check("DeadLetterScoreWrite"); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := claimed.Partition
+	r.processingWrites[p] = removeWrite(r.processingWrites[p], claimed.PendingScoreWrite)
+	r.deadWrites = append(r.deadWrites, claimed.PendingScoreWrite)
+	return nil
+}
+
+// 从队列中移除 write（按指针比较，与 LREM 移除第一个相同元素一致）
+func removeWrite(writes []*model.PendingScoreWrite, write *model.PendingScoreWrite) []*model.PendingScoreWrite {
+	for i, queued := range writes {
+		if queued == write {
+			return append(writes[:i], writes[i+1:]...)
+		}
+	}
+	return writes
+}
+
+func (r *RedisStore) RequeueProcessingScoreWrites(ctx context.Context, partition int) (int64, error) {
+	if err := r.check("RequeueProcessingScoreWrites"); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	moved := int64(len(r.processingWrites[partition]))
+	r.pendingWrites[partition] = append(r.processingWrites[partition], r.pendingWrites[partition]...)
+	r.processingWrites[partition] = nil
+	return moved, nil
+}
+
+func (r *RedisStore) RequeueDeadScoreWrites(ctx context.Context) (int64, error) {
+	if err := r.check("RequeueDeadScoreWrites"); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	moved := int64(len(r.deadWrites))
+	for _, write := range r.deadWrites {
+		p := repository.ScoreWritePartition(write.PlayerID)
+		r.pendingWrites[p] = append(r.pendingWrites[p], write)
+	}
+	r.deadWrites = nil
+	return moved, nil
+}
+
+func (r *RedisStore) GetScoreWriteQueueStats(ctx context.Context) (*model.ScoreWriteQueueStats, error) {
+	if err := r.check("GetScoreWriteQueueStats"); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := &model.ScoreWriteQueueStats{Dead: int64(len(r.deadWrites))}
+	for p := range r.pendingWrites {
+		stats.Pending += int64(len(r.pendingWrites[p]))
+		stats.Processing += int64(len(r.processingWrites[p]))
+	}
+	return stats, nil
+}
+
+func (r *RedisStore) GetDeadScoreWrites(ctx context.Context, limit int64) ([]*model.PendingScoreWrite, error) {
+	if err := r.check("GetDeadScoreWrites"); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dead := r.deadWrites
+	if int64(len(dead)) > limit {
+		dead = dead[:limit]
+	}
+	writes := make([]*model.PendingScoreWrite, 0, len(dead))
+	for _, write := range dead {
+		result := *write
+		writes = append(writes, &result)
+	}
+	return writes, nil
+}
@@ -0,0 +1,176 @@
+package resp
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+)
+
+// Memory 内存中的 Redis 键空间，支持字符串、Hash、Set 的基本命令和 MULTI/EXEC，作为 Server 的 respond 使用
+// 不处理过期时间；MULTI 在所有连接间共享，不支持并发事务
+type Memory struct {
+	mu      sync.Mutex
+	strings map[string]string
+	hashes  map[string]map[string]string
+	sets    map[string]map[string]bool
+	queued  [][]string // MULTI 之后排队的命令，为空切片表示处于事务中
+}
+
+// NewMemory 创建空的键空间
+func NewMemory() *Memory {
+	return &Memory{
+		strings: make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		sets:    make(map[string]map[string]bool),
+	}
+}
+
+// Exists 返回 key 是否存在
+func (m *Memory) Exists(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.exists(key)
+}
+
+// Respond 执行一条命令并返回回复
+func (m *Memory) Respond(args []string) interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch args[0] {
+	case "MULTI":
+		m.queued = [][]string{}
+		return "OK"
+	case "EXEC":
+		if m.queued == nil {
+			return fmt.Errorf("ERR EXEC without MULTI")
+		}
+		replies := make([]interface{}, 0, len(m.queued))
+		for _, queued := range m.queued {
+			replies = append(replies, m.exec(queued))
+		}
+		m.queued = nil
+		return replies
+	}
+
+	if m.queued != nil {
+		m.queued = append(m.queued, args)
+		return "QUEUED"
+	}
+	return m.exec(args)
+}
+
+func (m *Memory) exists(key string) bool {
+	_, isString := m.strings[key]
+	return isString || m.hashes[key] != nil || m.sets[key] != nil
+}
+
+func (m *Memory) exec(args []string) interface{} {
+	switch args[0] {
+	case "PING":
+		return "PONG"
+	case "GET":
+		if value, ok := m.strings[args[1]]; ok {
+			return value
+		}
+		return nil
+	case "SET":
+		m.strings[args[1]] = args[2]
+		return "OK"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if m.exists(key) {
+				deleted++
+			}
+			delete(m.strings, key)
+			delete(m.hashes, key)
+			delete(m.sets, key)
+		}
+		return deleted
+	case "EXPIRE":
+		if m.exists(args[1]) {
+			return 1
+		}
+		return 0
+	case "HGET":
+		if value, ok := m.hashes[args[1]][args[2]]; ok {
+			return value
+		}
+		return nil
+	case "HSET":
+		hash := m.hashes[args[1]]
+		if hash == nil {
+			hash = make(map[string]string)
+			m.hashes[args[1]] = hash
+		}
+		added := 0
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := hash[args[i]]; !ok {
+				added++
+			}
+			hash[args[i]] = args[i+1]
+		}
+		return added
+	case "SADD":
+		set := m.sets[args[1]]
+		if set == nil {
+			set = make(map[string]bool)
+			m.sets[args[1]] = set
+		}
+		added := 0
+		for _, member := range args[2:] {
+			if !set[member] {
+				set[member] = true
+				added++
+			}
+		}
+		return added
+	case "SMEMBERS":
+		members := make([]interface{}, 0, len(m.sets[args[1]]))
+		for _, member := range sortedKeys(m.sets[args[1]]) {
+			members = append(members, member)
+		}
+		return members
+	case "SCAN":
+		// 一次返回全部匹配的 key，游标始终为 0
+		pattern := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if args[i] == "MATCH" || args[i] == "match" {
+				pattern = args[i+1]
+			}
+		}
+		keys := make([]interface{}, 0)
+		for _, key := range m.keys() {
+			if ok, _ := path.Match(pattern, key); ok {
+				keys = append(keys, key)
+			}
+		}
+		return []interface{}{"0", keys}
+	}
+	return fmt.Errorf("ERR unsupported command %s", args[0])
+}
+
+func (m *Memory) keys() []string {
+	all := make(map[string]bool)
+	for key := range m.strings {
+		all[key] = true
+	}
+	for key := range m.hashes {
+		all[key] = true
+	}
+	for key := range m.sets {
+		all[key] = true
+	}
+	return sortedKeys(all)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,160 @@
+// Package resp 提供按 RESP2 协议应答的测试用 Redis 服务端，配合 redis.Options.Dialer 使用，
+// 用于测试直接使用 redis 客户端的代码（RedisRepository、RedisCache 等）
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Server 解析并记录收到的命令，回复由 respond 返回
+// 回复类型：nil 为空回复，string 为 bulk string，int64/int 为整数，[]interface{} 为数组，error 为错误回复
+type Server struct {
+	mu       sync.Mutex
+	commands [][]string
+	respond  func(args []string) interface{}
+}
+
+// NewServer 创建服务端，respond 为空时所有命令返回 OK；命令名统一转为大写后传给 respond
+func NewServer(respond func(args []string) interface{}) *Server {
+	return &Server{respond: respond}
+}
+
+// NewClient 创建连接到 s 的客户端，不重试失败的命令
+func (s *Server) NewClient() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Dialer:     s.Dial,
+		MaxRetries: -1,
+	})
+}
+
+// Dial 每次调用建立一条新的内存连接
+func (s *Server) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	server, conn := net.Pipe()
+	go s.serve(server)
+	return conn, nil
+}
+
+// Commands 返回已执行的命令，命令名为大写
+func (s *Server) Commands() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.commands...)
+}
+
+// CommandCount 返回命令名为 name 的命令条数
+func (s *Server) CommandCount(name string) int {
+	count := 0
+	for _, args := range s.Commands() {
+		if args[0] == name {
+			count++
+		}
+	}
+	return count
+}
+
+// 客户端写完整个 pipeline 之后才读取回复，回复由单独的 goroutine 写出，避免读写互相阻塞
+const maxPendingReplies = 1 << 16
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	replies := make(chan []byte, maxPendingReplies)
+	defer close(replies)
+	go func() {
+		for reply := range replies {
+			if _, err := conn.Write(reply); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		args[0] = strings.ToUpper(args[0])
+
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		respond := s.respond
+		s.mu.Unlock()
+
+		var reply interface{} = "OK"
+		if respond != nil {
+			reply = respond(args)
+		}
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		writeReply(w, reply)
+		w.Flush()
+		replies <- buf.Bytes()
+	}
+}
+
+// 读取一条以 bulk string 数组表示的命令
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected command line %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case error:
+		fmt.Fprintf(w, "-%s\r\n", v.Error())
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		writeReply(w, fmt.Errorf("ERR unsupported reply %T", reply))
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+
+	"game-leaderboard/internal/metrics"
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/repository"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Redis 不可用时由 MySQL 提供的读取次数
+var dbFallbackReads = promauto.With(metrics.Registerer).NewCounterVec(prometheus.CounterOpts{
+	Name: "leaderboard_db_fallback_reads_total",
+	Help: "Total number of rank and top-N reads served from MySQL because Redis was unavailable",
+}, []string{"endpoint"})
+
+// 从 MySQL 统计玩家排名，排名顺序和同分规则与 Redis 排行榜一致
+// Redis 不可用时无法读取封禁名单，结果中被封禁的玩家仍参与排名；先写 Redis 模式下尚未写入 MySQL 的变更不会体现
+// 结果标记为 Fallback 且不写入缓存
+func (s *LeaderboardService) getPlayerRankFromDB(ctx context.Context, playerID, method string) (*model.RankInfo, error) {
+	dbFallbackReads.WithLabelValues(CacheEndpointRank).Inc()
+
+	ranked, err := s.mysqlRepo.GetFilteredRank(ctx, playerID, model.PlayerFilter{}, nil, method == RankingDense, s.redisRepo.Ascending())
+	if err != nil {
+		if err == repository.ErrPlayerNotFound {
+			return nil, ErrPlayerNotFound
+		}
+		return nil, err
+	}
+
+	player, err := s.mysqlRepo.GetPlayer(ctx, playerID)
+	if err != nil {
+		if err == repository.ErrPlayerNotFound {
+			return nil, ErrPlayerNotFound
+		}
+		return nil, err
+	}
+
+	return &model.RankInfo{
+		PlayerID:  playerID,
+		Rank:      int(ranked.Rank),
+		Score:     ranked.Score,
+		Name:      player.Name,
+		UpdatedAt: player.UpdatedAt,
+		Fallback:  true,
+	}, nil
+}
+
+// 从 MySQL 读取前N名，限制与 getPlayerRankFromDB 相同
+func (s *LeaderboardService) getTopNFromDB(ctx context.Context, n int, method string) ([]*model.RankInfo, error) {
+	dbFallbackReads.WithLabelValues(CacheEndpointTopN).Inc()
+
+	players, err := s.mysqlRepo.GetRankedPlayers(ctx, n, s.redisRepo.Ascending())
+	if err != nil {
+		return nil, err
+	}
+
+	rankings := make([]*model.RankInfo, len(players))
+	for i, player := range players {
+		rankings[i] = &model.RankInfo{
+			PlayerID:  player.ID,
+			Rank:      i + 1,
+			Score:     player.TotalScore,
+			Name:      player.Name,
+			UpdatedAt: player.UpdatedAt,
+			Fallback:  true,
+		}
+	}
+
+	if method == RankingDense {
+		rankings = s.applyDenseRanking(rankings, 1)
+	}
+	return rankings, nil
+}
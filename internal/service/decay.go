@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"game-leaderboard/internal/model"
+)
+
+// 每次从 MySQL 读取的衰减候选玩家数
+const decayBatchSize = 500
+
+// 返回不能运行分数衰减的原因，可以运行时返回空字符串；与 config.Validate 的检查相同，防止绕过配置校验创建的服务
+// 分数低者在前时扣减分数反而提升排名；先写 Redis 时 MySQL 不是最新分数，按 MySQL 扣减并同步会覆盖尚未写入的得分
+func (s *LeaderboardService) decayUnsupported() string {
+	if s.redisRepo.Ascending() {
+		return "score decay requires a descending leaderboard"
+	}
+	if s.writeMode == WriteModeRedisFirst {
+		return "score decay requires the mysql_first write mode"
+	}
+	return ""
+}
+
+// 将超过 decayInactiveAfter 没有得分的玩家总分按 decayRate 比例扣减
+// 每个玩家在 MySQL 中单独加锁扣减，Redis 以增量方式同步，与同时进行的分数更新互不覆盖
+func (s *LeaderboardService) decayScores(ctx context.Context) {
+	inactiveBefore := time.Now().Add(-s.decayInactiveAfter)
+
+	if s.decayDryRun {
+		players, decrement, err := s.mysqlRepo.EstimateDecay(ctx, s.decayRate, inactiveBefore)
+		if err != nil {
+			s.logger.Error("Failed to estimate score decay", "error", err)
+			return
+		}
+		s.logger.Info("Score decay dry run",
+			"players", players,
+			"totalDecrement", decrement,
+			"rate", s.decayRate,
+			"inactiveBefore", inactiveBefore)
+		return
+	}
+
+	var decayed, totalDecrement int64
+	afterID := ""
+	for {
+		if ctx.Err() != nil {
+			break
+		}
+
+		playerIDs, err := s.mysqlRepo.ListDecayCandidates(ctx, inactiveBefore, afterID, decayBatchSize)
+		if err != nil {
+			s.logger.Error("Failed to list decay candidates", "error", err)
+			break
+		}
+
+		for _, playerID := range playerIDs {
+			if ctx.Err() != nil {
+				break
+			}
+
+			history, name, updatedAt, err := s.mysqlRepo.DecayPlayerScore(ctx, playerID, s.decayRate, inactiveBefore)
+			if err != nil {
+				s.logger.Error("Failed to decay player score", "playerID", playerID, "error", err)
+				continue
+			}
+			if history == nil {
+				continue
+			}
+			decayed++
+			totalDecrement -= history.ScoreChange
+
+			s.syncDecayedScore(ctx, history, name, updatedAt)
+			s.publishScoreChange(ctx, history)
+		}
+
+		if len(playerIDs) < decayBatchSize {
+			break
+		}
+		afterID = playerIDs[len(playerIDs)-1]
+	}
+
+	if decayed > 0 {
+		s.logger.Info("Scores decayed",
+			"players", decayed,
+			"totalDecrement", totalDecrement)
+	}
+}
+
+// 衰减后同步 Redis 总榜，被封禁的玩家不写入
+// 以增量而非总分写入，衰减与同步之间若有新的得分也不会被覆盖；得分时间沿用衰减前的 updated_at
+func (s *LeaderboardService) syncDecayedScore(ctx context.Context, history *model.PlayerScoreHistory, name string, updatedAt time.Time) {
+	defer s.invalidateCache(ctx, history.PlayerID)
+
+	blocked, err := s.redisRepo.IsPlayerBlocked(ctx, history.PlayerID)
+	if err != nil {
+		s.logger.Warn("Failed to check blocklist for decayed score",
+			"playerID", history.PlayerID,
+			"error", err)
+		return
+	}
+	if blocked {
+		return
+	}
+
+	if _, err := s.redisRepo.IncrementPlayerScoreAt(ctx, history.PlayerID, history.ScoreChange, history.FinalScore, name, updatedAt); err != nil {
+		s.logger.Error("Failed to sync decayed score to redis",
+			"playerID", history.PlayerID,
+			"scoreChange", history.ScoreChange,
+			"error", err)
+	}
+}
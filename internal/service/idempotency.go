@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"game-leaderboard/internal/model"
+)
+
+const (
+	// DefaultIdempotencyTTL 幂等键默认保留时间，应覆盖客户端的最长重试时间
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// 幂等键的最大长度
+	maxIdempotencyKeyLength = 255
+)
+
+// UpdateScoreIdempotent 带幂等键的分数更新：同一幂等键在保留时间内只生效一次
+// 重复提交时不再更新分数，返回首次的处理结果，replayed 为 true
+// 更新未生效时释放幂等键以便客户端重试；MySQL 已写入但 Redis 同步失败时更新已生效，幂等键保留
+func (s *LeaderboardService) UpdateScoreIdempotent(ctx context.Context, key string, req model.UpdateRequest) (receipt *model.UpdateReceipt, replayed bool, err error) {
+	if strings.TrimSpace(key) == "" || len(key) > maxIdempotencyKeyLength {
+		return nil, false, ErrInvalidIdempotencyKey
+	}
+
+	claimed, prior, err := s.redisRepo.ClaimIdempotencyKey(ctx, key, s.idempotencyTTL)
+	if err != nil {
+		return nil, false, err
+	}
+	if !claimed {
+		if prior == nil {
+			return nil, false, ErrIdempotencyKeyInProgress
+		}
+		if prior.PlayerID != req.PlayerID {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		s.logger.Info("Duplicate score update ignored",
+			"playerID", req.PlayerID,
+			"idempotencyKey", key)
+		return prior, true, nil
+	}
+
+	err = s.UpdateScore(ctx, req)
+	if err != nil && !errors.Is(err, ErrRedisSyncFailed) {
+		if releaseErr := s.redisRepo.ReleaseIdempotencyKey(ctx, key); releaseErr != nil {
+			s.logger.Warn("Failed to release idempotency key",
+				"idempotencyKey", key,
+				"error", releaseErr)
+		}
+		return nil, false, err
+	}
+
+	receipt = &model.UpdateReceipt{
+		PlayerID:    req.PlayerID,
+		ScoreChange: req.IncrScore,
+		SetAbsolute: req.SetAbsolute,
+		Timestamp:   time.Now(),
+	}
+	// 保存失败时键保持处理中状态直到过期，重复提交返回 ErrIdempotencyKeyInProgress 而不会重复计分
+	if completeErr := s.redisRepo.CompleteIdempotencyKey(ctx, key, receipt, s.idempotencyTTL); completeErr != nil {
+		s.logger.Warn("Failed to save idempotency receipt",
+			"idempotencyKey", key,
+			"error", completeErr)
+	}
+	return receipt, false, err
+}
@@ -3,365 +3,2538 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
 	"sync"
 	"time"
 
 	"game-leaderboard/internal/cache"
+	"game-leaderboard/internal/events"
+	"game-leaderboard/internal/metrics"
 	"game-leaderboard/internal/model"
 	"game-leaderboard/internal/repository"
 	"game-leaderboard/pkg/logger"
+	"game-leaderboard/pkg/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/sync/errgroup"
 )
 
+// 服务方法的 span，未启用追踪时全局 TracerProvider 为空实现
+var tracer = otel.Tracer("game-leaderboard/internal/service")
+
 // 定义服务级别的错误
 var (
 	ErrPlayerNotFound = fmt.Errorf("player not found")
 	ErrInvalidRange   = fmt.Errorf("invalid range")
+	ErrInvalidWindow  = fmt.Errorf("invalid window")
+	ErrRankOutOfRange = fmt.Errorf("rank out of range")
+	ErrCacheDisabled  = fmt.Errorf("cache disabled")
+	ErrNoSnapshot     = fmt.Errorf("cache snapshot not found")
+
+	ErrLeaderboardSnapshotNotFound = fmt.Errorf("leaderboard snapshot not found")
+
+	ErrInvalidRankingMethod = fmt.Errorf("invalid ranking method")
+	ErrInvalidResetMode     = fmt.Errorf("invalid reset mode")
+	ErrTooManyBuckets       = fmt.Errorf("too many score buckets")
+	ErrInvalidTTL           = fmt.Errorf("invalid ttl")
+	ErrInvalidFilter        = fmt.Errorf("invalid player filter")
+	ErrInvalidPlayerID      = fmt.Errorf("invalid player id")
+	ErrInvalidScoreRange    = fmt.Errorf("invalid score range")
+	ErrScoreOutOfRange      = fmt.Errorf("score out of range")
+
+	// 幂等键格式错误、同一键仍在处理中、同一键已用于其他玩家
+	ErrInvalidIdempotencyKey    = fmt.Errorf("invalid idempotency key")
+	ErrIdempotencyKeyInProgress = fmt.Errorf("idempotency key in progress")
+	ErrIdempotencyKeyReused     = fmt.Errorf("idempotency key reused for a different player")
+
+	// ErrRedisSyncFailed MySQL 已提交但 Redis 重试后仍未写入，排行榜与数据源暂时不一致
+	ErrRedisSyncFailed = fmt.Errorf("redis sync failed")
+)
+
+// 分数写入 Redis 的方式
+const (
+	// UpdateModeIncrement 在 Redis 中通过 ZINCRBY 原子地累加增量，并发更新同一玩家时不会丢失（默认）
+	UpdateModeIncrement = "increment"
+	// UpdateModeSet 将 MySQL 中的最终分数覆盖写入 Redis
+	UpdateModeSet = "set"
+)
+
+// 排名方式
+const (
+	// RankingStandard 按排名顺序逐一递增（1,2,3），同分时先得到该分数的玩家在前，同一秒内得分时按玩家ID排序
+	RankingStandard = "standard"
+	// RankingDense 同分玩家名次相同，下一名次连续（1,1,2）
+	RankingDense = "dense"
+)
+
+// 重置排行榜时 MySQL 数据的处理方式
+const (
+	// ResetMySQLKeep 只清空 Redis，MySQL 中的分数保留（之后重建会恢复旧分数）
+	ResetMySQLKeep = "keep"
+	// ResetMySQLTruncate 同时清零 MySQL 中的分数并删除分数历史
+	ResetMySQLTruncate = "truncate"
+	// ResetMySQLArchive 先将当前分数保存为排行榜快照，再按 truncate 处理
+	ResetMySQLArchive = "archive"
+)
+
+type rankingMethodKey struct{}
+
+// WithRankingMethod 在 context 中指定本次查询使用的排名方式，覆盖全局配置；method 为空时沿用配置
+func WithRankingMethod(ctx context.Context, method string) (context.Context, error) {
+	switch method {
+	case "":
+		return ctx, nil
+	case RankingStandard, RankingDense:
+		return context.WithValue(ctx, rankingMethodKey{}, method), nil
+	default:
+		return ctx, fmt.Errorf("%w: %s", ErrInvalidRankingMethod, method)
+	}
+}
+
+// 本次查询使用的排名方式，未指定时使用全局配置
+func (s *LeaderboardService) rankingMethodFor(ctx context.Context) string {
+	if method, ok := ctx.Value(rankingMethodKey{}).(string); ok {
+		return method
+	}
+	return s.rankingMethod
+}
+
+// 事件发布失败次数，发布失败不影响分数更新
+var eventPublishFailures = promauto.With(metrics.Registerer).NewCounter(prometheus.CounterOpts{
+	Name: "leaderboard_event_publish_failures_total",
+	Help: "Total number of score change events that failed to publish",
+})
+
+// registerCacheMetrics 将本地缓存的容量和命中统计注册为指标，每次抓取时读取，缓存访问路径上没有额外开销
+// 命中和未命中次数只增不减，使用 counter 以便用 rate() 计算命中率的变化
+func registerCacheMetrics(c *cache.LocalCache) {
+	factory := promauto.With(metrics.Registerer)
+
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "leaderboard_local_cache_size",
+		Help: "Number of entries in the local cache",
+	}, func() float64 { return float64(c.Stats().Size) })
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "leaderboard_local_cache_capacity",
+		Help: "Maximum number of entries in the local cache",
+	}, func() float64 { return float64(c.Stats().Capacity) })
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "leaderboard_local_cache_hits_total",
+		Help: "Total number of local cache hits",
+	}, func() float64 { return float64(c.Stats().Hits) })
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "leaderboard_local_cache_misses_total",
+		Help: "Total number of local cache misses",
+	}, func() float64 { return float64(c.Stats().Misses) })
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "leaderboard_local_cache_hit_ratio",
+		Help: "Local cache hit ratio (0-1) since startup",
+	}, func() float64 { return c.Stats().HitRatio() })
+}
+
+const (
+	// 事件发布的超时时间
+	eventPublishTimeout = 5 * time.Second
+	// 就绪检查中单个依赖的超时时间
+	dependencyCheckTimeout = 2 * time.Second
+	// 玩家分布直方图的分段数
+	cohortHistogramBuckets = 10
+)
+
+const (
+	// Redis 写入重试配置
+	redisSyncMaxAttempts  = 3
+	redisSyncRetryBackoff = 100 * time.Millisecond
 )
 
 type LeaderboardService struct {
-	redisRepo        *repository.RedisRepository
-	mysqlRepo        *repository.MySQLRepository
-	rankingMethod    string
-	enableCache      bool
-	cache            *cache.LocalCache
-	mu               sync.RWMutex
-	logger           *logger.Logger
-	snapshotInterval time.Duration
-	lastSnapshot     time.Time
-}
-
-func NewLeaderboardService(redisRepo *repository.RedisRepository, mysqlRepo *repository.MySQLRepository, rankingMethod string, enableCache bool) *LeaderboardService {
+	redisRepo          repository.RedisStore
+	mysqlRepo          repository.MySQLStore
+	rankingMethod      string
+	updateMode         string
+	writeMode          string
+	reasonMultipliers  map[string]float64
+	reasonTTLs         map[string]time.Duration
+	maxScore           int64 // 总分和单次变更的绝对值上限
+	enableCache        bool
+	cacheDisabled      map[string]bool // 不使用缓存的接口，见 CacheEndpoint* 常量
+	rebuildPreserveMax bool
+	dbFallbackReads    bool // Redis 读取失败时从 MySQL 读取，见 db_fallback.go
+	cache              *cache.LocalCache
+	cacheTTL           time.Duration
+	l2Cache            *cache.RedisCache // 可选的 Redis L2 缓存，多实例间共享
+	mu                 sync.RWMutex
+	logger             *logger.Logger
+
+	// 后台任务间隔，为 0 时不运行对应任务
+	snapshotInterval    time.Duration
+	healthCheckInterval time.Duration
+	scoreExpiryInterval time.Duration
+	// 每次后台任务额外等待 [0, scheduleJitter) 的随机时长，避免多个实例同时执行
+	scheduleJitter time.Duration
+
+	// 快照保留的个数和时长，为 0 时不按该条件删除
+	snapshotRetentionCount    int
+	snapshotRetentionDuration time.Duration
+
+	// 后台健康检查发现不可用的依赖及其开始不可用的时间，只由健康检查任务读写
+	dependencyDownSince map[string]time.Time
+
+	// 幂等键的保留时间
+	idempotencyTTL time.Duration
+
+	// 分数衰减
+	decayInterval      time.Duration
+	decayRate          float64
+	decayInactiveAfter time.Duration
+	decayDryRun        bool
+
+	// 后台预计算排名，开启后 GetPlayerRank 优先返回预计算的近似排名
+	precomputedRanks    bool
+	rankRefreshInterval time.Duration
+
+	// 分数变更事件发布
+	eventPublisher events.EventPublisher
+
+	// 实时前N名推送和排行榜变更监听
+	live *liveTopN
+
+	// 后台任务
+	stopBackground context.CancelFunc
+	backgroundWg   sync.WaitGroup
+
+	// 进行中的事件发布；closed 由 Close 在 mu 下设置，之后不再开始新的发布
+	publishWg sync.WaitGroup
+	closed    bool
+}
+
+// Options 排行榜服务配置
+type Options struct {
+	RankingMethod       string
+	UpdateMode          string
+	WriteMode           string // 为空时按 WriteModeMySQLFirst 处理
+	MaxScore            int64  // 总分和单次变更的绝对值上限，为 0 时使用 utils.MaxExactScore
+	ReasonMultipliers   map[string]float64
+	EnableCache         bool
+	CacheSize           int
+	CacheTTL            time.Duration
+	CacheMaxStale       time.Duration     // Redis 读取失败时可返回的本地缓存最长过期时间，为 0 时直接返回错误
+	DBFallbackReads     bool              // Redis 读取失败且没有可用缓存时，从 MySQL 统计排名和前N名
+	L2Cache             *cache.RedisCache // 为空时只使用本地缓存
+	SnapshotInterval    time.Duration
+	HealthCheckInterval time.Duration
+	RebuildPreserveMax  bool // 重建时保留 Redis 与 MySQL 中按排名顺序靠前的分数，默认直接以 MySQL 覆盖
+
+	// SnapshotRetentionCount、SnapshotRetentionDuration 每次创建快照后删除超出保留范围的旧快照，都为 0 时保留全部
+	SnapshotRetentionCount    int
+	SnapshotRetentionDuration time.Duration
+
+	// ScheduleJitter 后台任务每个周期额外等待的最大随机时长，为 0 时严格按间隔运行
+	ScheduleJitter time.Duration
+
+	// CacheDisabledEndpoints 不读写缓存（本地和 L2）的接口，取值为 CacheEndpoint* 常量
+	CacheDisabledEndpoints []string
+
+	// ReasonTTLs 按得分原因配置的有效期，到期后该次增量从总分中扣回；请求中的 TTLSeconds 优先
+	// ScoreExpiryInterval 检查到期分数的间隔，为 0 时不处理到期（记录仍会保存）
+	ReasonTTLs          map[string]time.Duration
+	ScoreExpiryInterval time.Duration
+
+	// IdempotencyTTL 分数更新幂等键的保留时间，为 0 时使用 DefaultIdempotencyTTL
+	IdempotencyTTL time.Duration
+
+	// DecayInterval 分数衰减的间隔，为 0 时不衰减；见 decay.go
+	DecayInterval      time.Duration
+	DecayRate          float64
+	DecayInactiveAfter time.Duration
+	DecayDryRun        bool
+
+	// PrecomputedRanks 后台每隔 RankRefreshInterval 预计算所有玩家排名，查询单个玩家排名时直接读取
+	PrecomputedRanks    bool
+	RankRefreshInterval time.Duration
+
+	// EventPublisher 分数成功写入后发布变更事件，为空时不发布
+	EventPublisher events.EventPublisher
+
+	// LiveTopN 实时推送的前N名人数，为 0 时不启用
+	LiveTopN int
+}
+
+// NewLeaderboardService 创建排行榜服务，redisRepo、mysqlRepo 通常为 *repository.RedisRepository 和 *repository.MySQLRepository
+func NewLeaderboardService(redisRepo repository.RedisStore, mysqlRepo repository.MySQLStore, opts Options) *LeaderboardService {
 	service := &LeaderboardService{
-		redisRepo:        redisRepo,
-		mysqlRepo:        mysqlRepo,
-		rankingMethod:    rankingMethod,
-		enableCache:      enableCache,
-		logger:           logger.NewLogger("leaderboard_service"),
-		snapshotInterval: 1 * time.Hour, // 每小时快照一次
+		redisRepo:           redisRepo,
+		mysqlRepo:           mysqlRepo,
+		rankingMethod:       opts.RankingMethod,
+		updateMode:          opts.UpdateMode,
+		writeMode:           opts.WriteMode,
+		reasonMultipliers:   opts.ReasonMultipliers,
+		reasonTTLs:          opts.ReasonTTLs,
+		maxScore:            opts.MaxScore,
+		enableCache:         opts.EnableCache,
+		cacheDisabled:       make(map[string]bool, len(opts.CacheDisabledEndpoints)),
+		cacheTTL:            opts.CacheTTL,
+		l2Cache:             opts.L2Cache,
+		rebuildPreserveMax:  opts.RebuildPreserveMax,
+		dbFallbackReads:     opts.DBFallbackReads,
+		logger:              logger.NewLogger("leaderboard_service"),
+		snapshotInterval:    opts.SnapshotInterval,
+		healthCheckInterval: opts.HealthCheckInterval,
+		dependencyDownSince: make(map[string]time.Time),
+		scheduleJitter:      opts.ScheduleJitter,
+		scoreExpiryInterval: opts.ScoreExpiryInterval,
+		idempotencyTTL:      opts.IdempotencyTTL,
+		decayInterval:       opts.DecayInterval,
+		decayRate:           opts.DecayRate,
+		decayInactiveAfter:  opts.DecayInactiveAfter,
+		decayDryRun:         opts.DecayDryRun,
+
+		precomputedRanks:    opts.PrecomputedRanks,
+		rankRefreshInterval: opts.RankRefreshInterval,
+
+		snapshotRetentionCount:    opts.SnapshotRetentionCount,
+		snapshotRetentionDuration: opts.SnapshotRetentionDuration,
+	}
+
+	if service.idempotencyTTL <= 0 {
+		service.idempotencyTTL = DefaultIdempotencyTTL
+	}
+	if service.maxScore <= 0 {
+		service.maxScore = utils.MaxExactScore
+	}
+
+	if opts.EnableCache {
+		service.cache = cache.NewLocalCacheWithTTL(opts.CacheSize, opts.CacheTTL)
+		service.cache.SetMaxStale(opts.CacheMaxStale)
+		registerCacheMetrics(service.cache)
+	}
+	for _, endpoint := range opts.CacheDisabledEndpoints {
+		service.cacheDisabled[endpoint] = true
+	}
+
+	service.live = newLiveTopN(opts.LiveTopN)
+
+	service.eventPublisher = opts.EventPublisher
+	if service.eventPublisher == nil {
+		service.eventPublisher = events.NoopPublisher{}
+	}
+
+	return service
+}
+
+// StartBackgroundTasks 启动快照、健康检查和缓存清理等后台任务，ctx 取消或调用 Close 后全部停止
+func (s *LeaderboardService) StartBackgroundTasks(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	if s.stopBackground != nil {
+		s.stopBackground()
+	}
+	s.stopBackground = cancel
+	s.mu.Unlock()
+
+	if s.cache != nil {
+		s.cache.StartCleanup(ctx, cache.CleanupInterval)
+	}
+
+	// 升级前写入的排行榜没有不同分数索引和排名顺序，在处理请求前补建
+	if rebuilt, err := s.redisRepo.RebuildScoreIndex(ctx, false); err != nil {
+		s.logger.Error("Failed to build score index", "error", err)
+	} else if rebuilt {
+		s.logger.Info("Score index built from leaderboard")
+	}
+
+	s.backgroundWg.Add(1)
+	go func() {
+		defer s.backgroundWg.Done()
+		s.backgroundTasks(ctx)
+	}()
+
+	s.backgroundWg.Add(1)
+	go func() {
+		defer s.backgroundWg.Done()
+		s.liveTopNLoop(ctx)
+	}()
+
+	// 先写 Redis 模式下由后台任务把队列中的变更写入 MySQL
+	if s.writeMode == WriteModeRedisFirst {
+		s.backgroundWg.Add(1)
+		go func() {
+			defer s.backgroundWg.Done()
+			s.scoreWriteLoop(ctx)
+		}()
+	}
+}
+
+// Close 停止所有后台任务和事件发布并等待其退出，可重复调用
+func (s *LeaderboardService) Close() {
+	s.mu.Lock()
+	stop := s.stopBackground
+	s.stopBackground = nil
+	s.closed = true
+	s.mu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+	s.backgroundWg.Wait()
+	s.publishWg.Wait()
+
+	s.live.closeAll()
+
+	if s.cache != nil {
+		s.cache.Close()
+	}
+}
+
+// UpdateScore 更新玩家分数
+//
+// 默认按增量处理：MySQL 在事务内累加 total_score，Redis 通过 ZINCRBY 累加同一增量；
+// updateMode 为 set 时 Redis 改为覆盖写入 MySQL 累加后的总分。
+// req.SetAbsolute 为 true 时 IncrScore 视为新的总分，MySQL 直接覆盖 total_score 并以差值记录历史，
+// Redis 同样覆盖写入，不应用得分原因倍率。增量为 0 时只记录历史，不写排行榜。
+// writeMode 为 redis_first 时改为先写 Redis 并异步写入 MySQL，见 updateScoreRedisFirst。
+func (s *LeaderboardService) UpdateScore(ctx context.Context, req model.UpdateRequest) error {
+	ctx, span := tracer.Start(ctx, "service.UpdateScore")
+	defer span.End()
+
+	playerID, name, reason := req.PlayerID, req.Name, req.Reason
+	if !utils.ValidatePlayerID(playerID) {
+		return ErrInvalidPlayerID
+	}
+	if err := s.checkScoreBounds(req); err != nil {
+		return err
+	}
+
+	// 1. 先更新 MySQL（作为数据源），玩家表和历史记录在同一事务内提交
+	history := &model.PlayerScoreHistory{
+		PlayerID: playerID,
+		Reason:   reason,
+	}
+
+	expiresAt, err := s.scoreExpiresAt(req)
+	if err != nil {
+		return err
+	}
+
+	if s.writeMode == WriteModeRedisFirst {
+		_, err := s.updateScoreRedisFirst(ctx, req, expiresAt)
+		return err
+	}
+
+	var finalScore int64
+	if req.SetAbsolute {
+		finalScore, err = s.mysqlRepo.SetPlayerScore(ctx, name, history, req.IncrScore)
+	} else {
+		// 按得分原因应用倍率，0 倍只记录历史不影响排行榜
+		history.RawScoreChange = req.IncrScore
+		history.ScoreChange = s.applyReasonMultiplier(req.IncrScore, reason)
+		finalScore, err = s.mysqlRepo.ApplyScoreChange(ctx, name, history, expiresAt)
+	}
+	if errors.Is(err, repository.ErrScoreOutOfRange) {
+		return fmt.Errorf("%w: %v", ErrScoreOutOfRange, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update player in mysql: %w", err)
+	}
+
+	// 直接设置的分数与 MySQL 原分数相同时仍需写入 Redis，以修正 Redis 与 MySQL 不一致的分数
+	effectiveScore := history.ScoreChange
+	if !req.SetAbsolute && effectiveScore == 0 {
+		s.logger.Info("Score change recorded without affecting leaderboard",
+			"playerID", playerID,
+			"rawScoreChange", history.RawScoreChange,
+			"reason", reason)
+		s.publishScoreChange(ctx, history)
+		return nil
+	}
+
+	// 被封禁的玩家只记录 MySQL，不写入排行榜，并确保其不在排行榜中
+	blocked, err := s.redisRepo.IsPlayerBlocked(ctx, playerID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRedisSyncFailed, err)
+	}
+	if blocked {
+		if err := s.redisRepo.BlockPlayers(ctx, []string{playerID}); err != nil {
+			s.logger.Warn("Failed to remove blocked player from leaderboard",
+				"playerID", playerID,
+				"error", err)
+		}
+		s.invalidateCache(ctx, playerID)
+		s.logger.Info("Score change recorded for blocked player without affecting leaderboard",
+			"playerID", playerID,
+			"finalScore", finalScore)
+		s.publishScoreChange(ctx, history)
+		return nil
+	}
+
+	// 2. 更新 Redis（作为排行榜存储），失败时有限次重试
+	var redisErr error
+	if req.SetAbsolute || s.updateMode == UpdateModeSet {
+		redisErr = s.updateRedisWithRetry(ctx, playerID, finalScore, name)
+	} else if _, err := s.redisRepo.IncrementPlayerScore(ctx, playerID, effectiveScore, finalScore, name); err != nil {
+		// 增量写入不可安全重试，失败后以 MySQL 中的最终分数覆盖补偿
+		s.logger.Warn("Redis increment failed, falling back to absolute set",
+			"playerID", playerID,
+			"error", err)
+		redisErr = s.updateRedisWithRetry(ctx, playerID, finalScore, name)
+	}
+
+	// 累加到日/周/月时间窗口排行榜，窗口榜仅用于展示，失败不影响主流程
+	if effectiveScore != 0 {
+		if err := s.redisRepo.IncrementWindowScores(ctx, playerID, effectiveScore); err != nil {
+			s.logger.Warn("Failed to update window leaderboards",
+				"playerID", playerID,
+				"error", err)
+		}
+	}
+
+	// 3. 清除相关缓存
+	s.invalidateCache(ctx, playerID)
+
+	if redisErr != nil {
+		s.logger.Error("Failed to update redis leaderboard",
+			"playerID", playerID,
+			"finalScore", finalScore,
+			"error", redisErr)
+		return fmt.Errorf("%w: %v", ErrRedisSyncFailed, redisErr)
+	}
+
+	s.recordPeakRanks(ctx, playerID)
+
+	s.logger.Info("Player score updated",
+		"playerID", playerID,
+		"rawScoreChange", history.RawScoreChange,
+		"scoreChange", effectiveScore,
+		"finalScore", finalScore,
+		"setAbsolute", req.SetAbsolute,
+		"reason", reason)
+
+	s.publishScoreChange(ctx, history)
+	return nil
+}
+
+// 管理员修正分数时未指定原因使用的默认原因
+const ReasonAdminCorrection = "admin_correction"
+
+// SetPlayerScore 将已有玩家的总分直接设为 score，用于作弊回滚等人工修正
+// 与 UpdateScore 的增量路径不同：MySQL 覆盖 total_score 并以差值记录历史，Redis 覆盖写入（ZADD）而非 ZINCRBY，
+// 不应用得分原因倍率，未到期的临时分数不再扣回。玩家名称沿用 MySQL 中的记录，玩家不存在时返回 ErrPlayerNotFound
+func (s *LeaderboardService) SetPlayerScore(ctx context.Context, playerID string, score int64, reason string) error {
+	if !utils.ValidatePlayerID(playerID) {
+		return ErrInvalidPlayerID
+	}
+
+	player, err := s.mysqlRepo.GetPlayer(ctx, playerID)
+	if err != nil {
+		if err == repository.ErrPlayerNotFound {
+			return ErrPlayerNotFound
+		}
+		return err
+	}
+
+	if reason == "" {
+		reason = ReasonAdminCorrection
+	}
+
+	return s.UpdateScore(ctx, model.UpdateRequest{
+		PlayerID:    playerID,
+		IncrScore:   score,
+		Name:        player.Name,
+		Reason:      reason,
+		SetAbsolute: true,
+	})
+}
+
+// BatchUpdateScores 批量更新玩家分数，逐条提交 MySQL 事务，Redis 通过 pipeline 一次写入
+// 单条记录失败不影响其他记录，结果顺序与请求顺序一致
+// Redis 的写入方式与 UpdateScore 相同：默认累加本次增量，SetAbsolute 或 updateMode 为 set 时覆盖写入 MySQL 提交后的总分
+// 先写 Redis 模式下每条记录与 UpdateScore 一样写入 Redis 并进入写入队列，不同步写 MySQL
+func (s *LeaderboardService) BatchUpdateScores(ctx context.Context, updates []model.UpdateRequest) []*model.BatchUpdateResult {
+	ctx, span := tracer.Start(ctx, "service.BatchUpdateScores")
+	defer span.End()
+
+	results := make([]*model.BatchUpdateResult, len(updates))
+	batchHistories := make([]*model.PlayerScoreHistory, len(updates))
+	writes := make([]*repository.ScoreWrite, 0, len(updates))
+	writeResults := make([]*model.BatchUpdateResult, 0, len(updates))
+	var blockedIDs []string
+	windowIncrements := make(map[string]int64)
+	now := time.Now()
+
+	var blocked map[string]bool
+	var blocklistErr error
+	if s.writeMode != WriteModeRedisFirst {
+		blocked, blocklistErr = s.blockedPlayerSet(ctx)
+		if blocklistErr != nil {
+			// 无法确认封禁状态时不写排行榜，MySQL 仍然逐条提交
+			s.logger.Warn("Failed to load blocklist for batch update", "error", blocklistErr)
+		}
+	}
+
+	// 1. 逐条写入 MySQL
+	for i, req := range updates {
+		result := &model.BatchUpdateResult{PlayerID: req.PlayerID}
+		results[i] = result
+
+		if req.PlayerID == "" {
+			result.Error = "playerId cannot be empty"
+			continue
+		}
+		if !utils.ValidatePlayerID(req.PlayerID) {
+			result.Error = ErrInvalidPlayerID.Error()
+			continue
+		}
+
+		history := &model.PlayerScoreHistory{
+			PlayerID: req.PlayerID,
+			Reason:   req.Reason,
+		}
+
+		if err := s.checkScoreBounds(req); err != nil {
+			result.Error = err.Error()
+			continue
+		}
+
+		expiresAt, err := s.scoreExpiresAt(req)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+
+		// 封禁检查、时间窗口、缓存和事件发布都由写入队列路径处理
+		if s.writeMode == WriteModeRedisFirst {
+			score, err := s.updateScoreRedisFirst(ctx, req, expiresAt)
+			if err != nil {
+				result.Error = err.Error()
+				continue
+			}
+			result.Success = true
+			result.FinalScore = score
+			continue
+		}
+
+		var finalScore int64
+		if req.SetAbsolute {
+			finalScore, err = s.mysqlRepo.SetPlayerScore(ctx, req.Name, history, req.IncrScore)
+		} else {
+			history.RawScoreChange = req.IncrScore
+			history.ScoreChange = s.applyReasonMultiplier(req.IncrScore, req.Reason)
+			finalScore, err = s.mysqlRepo.ApplyScoreChange(ctx, req.Name, history, expiresAt)
+		}
+		if err != nil {
+			s.logger.Warn("Failed to apply batch score change",
+				"playerID", req.PlayerID,
+				"error", err)
+			result.Error = err.Error()
+			continue
+		}
+
+		result.Success = true
+		result.FinalScore = finalScore
+		batchHistories[i] = history
+
+		effectiveScore := history.ScoreChange
+		if !req.SetAbsolute && effectiveScore == 0 {
+			continue
+		}
+		if blocked[req.PlayerID] {
+			blockedIDs = append(blockedIDs, req.PlayerID)
+			continue
+		}
+		if blocklistErr != nil {
+			result.Success = false
+			result.Error = fmt.Errorf("%w: %v", ErrRedisSyncFailed, blocklistErr).Error()
+			continue
+		}
+
+		writes = append(writes, &repository.ScoreWrite{
+			PlayerID:  req.PlayerID,
+			Name:      req.Name,
+			Increment: !req.SetAbsolute && s.updateMode != UpdateModeSet,
+			Delta:     effectiveScore,
+			Total:     finalScore,
+			UpdatedAt: now,
+		})
+		writeResults = append(writeResults, result)
+		if effectiveScore != 0 {
+			windowIncrements[req.PlayerID] += effectiveScore
+		}
+	}
+
+	// 2. 批量写入 Redis；累加不可安全重试，失败时逐条以 MySQL 中的总分覆盖补偿，同一玩家以最后提交的总分为准
+	if err := s.redisRepo.WritePlayerScores(ctx, writes); err != nil {
+		s.logger.Warn("Batch redis update failed, retrying per player", "error", err)
+		for i, w := range writes {
+			if err := s.updateRedisWithRetry(ctx, w.PlayerID, w.Total, w.Name); err != nil {
+				writeResults[i].Success = false
+				writeResults[i].Error = fmt.Errorf("%w: %v", ErrRedisSyncFailed, err).Error()
+			}
+		}
+	}
+
+	// 被封禁的玩家只记录 MySQL，并确保其不在排行榜中
+	if len(blockedIDs) > 0 {
+		if err := s.redisRepo.BlockPlayers(ctx, blockedIDs); err != nil {
+			s.logger.Warn("Failed to remove blocked players from leaderboard",
+				"count", len(blockedIDs),
+				"error", err)
+		}
+	}
+
+	if len(windowIncrements) > 0 {
+		if err := s.redisRepo.IncrementWindowScoresBatch(ctx, windowIncrements); err != nil {
+			s.logger.Warn("Failed to update window leaderboards for batch", "error", err)
+		}
+	}
+
+	// 3. 清除相关缓存
+	playerIDs := make([]string, 0, len(writes))
+	for _, w := range writes {
+		playerIDs = append(playerIDs, w.PlayerID)
+	}
+	s.invalidateCache(ctx, append(playerIDs, blockedIDs...)...)
+	s.recordPeakRanks(ctx, playerIDs...)
+
+	for i, result := range results {
+		if result.Success && batchHistories[i] != nil {
+			s.publishScoreChange(ctx, batchHistories[i])
+		}
+	}
+
+	s.logger.Info("Batch score update completed",
+		"total", len(updates),
+		"leaderboardUpdates", len(writes))
+
+	return results
+}
+
+// 异步发布分数变更事件，失败只记录日志和指标；Close 会等待进行中的发布完成，Close 之后的变更不再发布
+func (s *LeaderboardService) publishScoreChange(ctx context.Context, history *model.PlayerScoreHistory) {
+	event := events.ScoreChangeEvent{
+		PlayerID:   history.PlayerID,
+		Delta:      history.ScoreChange,
+		FinalScore: history.FinalScore,
+		Reason:     history.Reason,
+		Timestamp:  time.Now(),
+	}
+
+	// Add 与 Close 设置 closed 互斥，保证 Close 中的 Wait 之后不会再有 Add
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		s.logger.Debug("Service closed, score change event dropped", "playerID", event.PlayerID)
+		return
+	}
+	s.publishWg.Add(1)
+	s.mu.RUnlock()
+
+	// 请求结束后 ctx 会被取消，发布使用独立的超时
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), eventPublishTimeout)
+	go func() {
+		defer s.publishWg.Done()
+		defer cancel()
+
+		if err := s.eventPublisher.Publish(ctx, event); err != nil {
+			eventPublishFailures.Inc()
+			s.logger.Warn("Failed to publish score change event",
+				"playerID", event.PlayerID,
+				"error", err)
+		}
+	}()
+}
+
+// 根据得分原因计算实际计入的分数，未配置倍率的原因保持原值
+func (s *LeaderboardService) applyReasonMultiplier(incrScore int64, reason string) int64 {
+	multiplier, ok := s.reasonMultipliers[reason]
+	if !ok {
+		return incrScore
+	}
+	return int64(math.Round(float64(incrScore) * multiplier))
+}
+
+// 检查请求中的分数不超过上限：覆盖总分时检查新的总分，累加时检查应用得分原因倍率后的单次增量
+// 累加后的总分在 MySQL 事务中检查（先写 Redis 时见 updateScoreRedisFirst）
+func (s *LeaderboardService) checkScoreBounds(req model.UpdateRequest) error {
+	if req.SetAbsolute {
+		if utils.AbsScore(req.IncrScore) > s.maxScore {
+			return fmt.Errorf("%w: score %d exceeds the limit of %d", ErrScoreOutOfRange, req.IncrScore, s.maxScore)
+		}
+		return nil
+	}
+
+	// 乘以倍率后可能超出 int64，先以浮点数排除远超上限的值，再按整数比较
+	if multiplier, ok := s.reasonMultipliers[req.Reason]; ok {
+		if value := float64(req.IncrScore) * multiplier; math.Abs(value) > float64(s.maxScore) {
+			return fmt.Errorf("%w: score change %.0f exceeds the limit of %d", ErrScoreOutOfRange, value, s.maxScore)
+		}
+	}
+	if change := s.applyReasonMultiplier(req.IncrScore, req.Reason); utils.AbsScore(change) > s.maxScore {
+		return fmt.Errorf("%w: score change %d exceeds the limit of %d", ErrScoreOutOfRange, change, s.maxScore)
+	}
+	return nil
+}
+
+// 计算本次增量的到期时间，请求中的 TTLSeconds 优先于得分原因配置的有效期，不到期时返回零值
+// 覆盖总分（SetAbsolute）不能设置有效期
+func (s *LeaderboardService) scoreExpiresAt(req model.UpdateRequest) (time.Time, error) {
+	if req.TTLSeconds < 0 {
+		return time.Time{}, fmt.Errorf("%w: ttlSeconds must not be negative", ErrInvalidTTL)
+	}
+	if req.SetAbsolute {
+		if req.TTLSeconds > 0 {
+			return time.Time{}, fmt.Errorf("%w: ttlSeconds cannot be used with setAbsolute", ErrInvalidTTL)
+		}
+		return time.Time{}, nil
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if ttl == 0 {
+		ttl = s.reasonTTLs[req.Reason]
+	}
+	if ttl <= 0 {
+		return time.Time{}, nil
+	}
+	return time.Now().Add(ttl), nil
+}
+
+// 每次最多处理的到期分数条数，剩余的留到下一个周期
+const scoreExpiryBatchSize = 500
+
+// 将已到期的临时分数从总分中扣回，Redis 总榜按扣回的分数累加
+// 先写 Redis 模式下扣回与普通写入一样通过写入队列完成，事件在写入 MySQL 后发布
+func (s *LeaderboardService) expireScores(ctx context.Context) {
+	reverted := 0
+	for reverted < scoreExpiryBatchSize {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if s.writeMode == WriteModeRedisFirst {
+			history, name, err := s.mysqlRepo.ClaimExpiredScore(ctx, time.Now())
+			if err != nil {
+				s.logger.Error("Failed to claim expired score", "error", err)
+				return
+			}
+			if history == nil {
+				break
+			}
+			reverted++
+
+			if err := s.queueRevertedScore(ctx, history, name); err != nil {
+				s.logger.Error("Failed to queue reverted score, leaderboard and mysql keep the expired score",
+					"playerID", history.PlayerID,
+					"scoreChange", history.ScoreChange,
+					"error", err)
+			}
+			continue
+		}
+
+		history, name, err := s.mysqlRepo.RevertExpiredScore(ctx, time.Now())
+		if err != nil {
+			s.logger.Error("Failed to revert expired score", "error", err)
+			return
+		}
+		if history == nil {
+			break
+		}
+		reverted++
+
+		s.syncRevertedScore(ctx, history, name)
+		s.publishScoreChange(ctx, history)
 	}
 
-	if enableCache {
-		service.cache = cache.NewLocalCache(10000) // 缓存10000个结果
+	if reverted > 0 {
+		s.logger.Info("Expired scores reverted", "count", reverted)
 	}
+}
 
-	// 启动后台任务
-	go service.backgroundTasks()
+// 扣回后同步 Redis 总榜，被封禁的玩家不写入；时间窗口榜记录的是当期得分，不做扣回
+// 与 UpdateScore 相同以增量写入，不覆盖扣回期间其他写入对 Redis 的修改；增量失败时以 MySQL 中的总分覆盖补偿
+func (s *LeaderboardService) syncRevertedScore(ctx context.Context, history *model.PlayerScoreHistory, name string) {
+	defer s.invalidateCache(ctx, history.PlayerID)
+
+	blocked, err := s.redisRepo.IsPlayerBlocked(ctx, history.PlayerID)
+	if err != nil {
+		s.logger.Warn("Failed to check blocklist for reverted score",
+			"playerID", history.PlayerID,
+			"error", err)
+		return
+	}
+	if blocked {
+		return
+	}
+
+	_, err = s.redisRepo.IncrementPlayerScore(ctx, history.PlayerID, history.ScoreChange, history.FinalScore, name)
+	if err == nil {
+		return
+	}
+	s.logger.Warn("Redis decrement for reverted score failed, falling back to absolute set",
+		"playerID", history.PlayerID,
+		"error", err)
+
+	if err := s.updateRedisWithRetry(ctx, history.PlayerID, history.FinalScore, name); err != nil {
+		s.logger.Error("Failed to sync reverted score to redis",
+			"playerID", history.PlayerID,
+			"finalScore", history.FinalScore,
+			"error", err)
+	}
+}
+
+// UpdatePlayerNames 批量更新玩家名称，不改变分数也不记录分数历史
+func (s *LeaderboardService) UpdatePlayerNames(ctx context.Context, names map[string]string) (int64, error) {
+	if len(names) == 0 {
+		return 0, nil
+	}
+
+	updated, err := s.mysqlRepo.UpdatePlayerNames(ctx, names)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update player names in mysql: %w", err)
+	}
+
+	redisErr := s.redisRepo.SetPlayerNames(ctx, names)
+
+	// 缓存的排名信息中包含名称，需要一并失效
+	playerIDs := make([]string, 0, len(names))
+	for playerID := range names {
+		playerIDs = append(playerIDs, playerID)
+	}
+	s.invalidateCache(ctx, playerIDs...)
+
+	if redisErr != nil {
+		s.logger.Error("Failed to update player names in redis", "error", redisErr)
+		return updated, fmt.Errorf("%w: %v", ErrRedisSyncFailed, redisErr)
+	}
+
+	s.logger.Info("Player names updated",
+		"requested", len(names),
+		"updated", updated)
+
+	return updated, nil
+}
+
+// 更新 Redis 排行榜，失败时按递增间隔重试
+func (s *LeaderboardService) updateRedisWithRetry(ctx context.Context, playerID string, score int64, name string) error {
+	var err error
+	for attempt := 1; attempt <= redisSyncMaxAttempts; attempt++ {
+		if err = s.redisRepo.UpdatePlayerScore(ctx, playerID, score, name, time.Now()); err == nil {
+			return nil
+		}
+
+		s.logger.Warn("Redis update failed, retrying",
+			"playerID", playerID,
+			"attempt", attempt,
+			"error", err)
+
+		if attempt == redisSyncMaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * redisSyncRetryBackoff):
+		}
+	}
+
+	return err
+}
+
+// 可单独关闭缓存的接口
+const (
+	CacheEndpointRank = "rank" // 玩家排名
+	CacheEndpointTopN = "top"  // 前N名
+)
+
+// 返回接口可用的本地缓存和 L2 缓存，未启用或该接口关闭缓存时为 nil
+func (s *LeaderboardService) cachesFor(endpoint string) (*cache.LocalCache, *cache.RedisCache) {
+	if s.cacheDisabled[endpoint] {
+		return nil, nil
+	}
+	if s.enableCache {
+		return s.cache, s.l2Cache
+	}
+	return nil, s.l2Cache
+}
+
+// GetPlayerRank 获取玩家排名
+func (s *LeaderboardService) GetPlayerRank(ctx context.Context, playerID string) (*model.RankInfo, error) {
+	ctx, span := tracer.Start(ctx, "service.GetPlayerRank")
+	defer span.End()
+
+	method := s.rankingMethodFor(ctx)
+	localCache, l2Cache := s.cachesFor(CacheEndpointRank)
+
+	// 尝试从缓存获取
+	if localCache != nil {
+		if cached, ok := localCache.GetPlayerRank(playerID, method); ok {
+			return cached, nil
+		}
+	}
+
+	// 本地未命中时查询 L2 缓存，命中后回填本地缓存
+	if l2Cache != nil {
+		cached, ok, err := l2Cache.GetPlayerRank(ctx, playerID, method)
+		if err != nil {
+			s.logger.Warn("Failed to read l2 cache", "playerID", playerID, "error", err)
+		} else if ok {
+			if localCache != nil {
+				localCache.SetPlayerRank(playerID, method, cached)
+			}
+			return cached, nil
+		}
+	}
+
+	// 优先使用预计算的排名，新上榜的玩家在下次计算前回退到实时排名
+	// 预计算只按全局配置的排名方式进行，指定其他排名方式时实时计算
+	var (
+		rank       int64
+		score      float64
+		computedAt time.Time
+		err        error
+	)
+	approximate := false
+	if s.precomputedRanks && method == s.rankingMethod {
+		var precomputed int
+		precomputed, computedAt, err = s.redisRepo.GetPrecomputedRank(ctx, playerID)
+		if err == nil {
+			score, err = s.redisRepo.GetPlayerScore(ctx, playerID)
+			if err == nil {
+				rank, approximate = int64(precomputed), true
+			}
+		}
+		if err != nil && err != repository.ErrPlayerNotFound {
+			s.logger.Warn("Failed to read precomputed rank, falling back to live rank",
+				"playerID", playerID,
+				"error", err)
+		}
+	}
+
+	// 从 Redis 获取排名和分数
+	if !approximate {
+		rank, score, err = s.redisRepo.GetPlayerRankAndScore(ctx, playerID)
+		if err != nil {
+			if err == repository.ErrPlayerNotFound {
+				return nil, ErrPlayerNotFound
+			}
+			if localCache != nil {
+				if stale, ok := localCache.GetStalePlayerRank(playerID, method); ok {
+					s.logger.Warn("Redis unavailable, serving stale cached rank", "playerID", playerID, "error", err)
+					staleCopy := *stale
+					staleCopy.Stale = true
+					return &staleCopy, nil
+				}
+			}
+			if s.dbFallbackReads {
+				s.logger.Warn("Redis unavailable, reading rank from mysql", "playerID", playerID, "error", err)
+				return s.getPlayerRankFromDB(ctx, playerID, method)
+			}
+			return nil, err
+		}
+	}
+
+	// 获取玩家名称
+	player, err := s.mysqlRepo.GetPlayer(ctx, playerID)
+	if err != nil {
+		if err == repository.ErrPlayerNotFound {
+			// 如果 MySQL 中没有，但 Redis 中有，创建一个基本的玩家信息
+			player = &model.Player{
+				ID:   playerID,
+				Name: "",
+			}
+		} else {
+			return nil, err
+		}
+	}
+
+	rankInfo := &model.RankInfo{
+		PlayerID:  playerID,
+		Rank:      int(rank),
+		Score:     int64(score),
+		Name:      player.Name,
+		UpdatedAt: player.UpdatedAt,
+	}
+
+	// 应用排名策略（密集排名），预计算的排名已按排名策略计算
+	if approximate {
+		rankInfo.Approximate = true
+		rankInfo.RankComputedAt = &computedAt
+	} else if method == RankingDense {
+		rankInfo.Rank = s.calculateDenseRank(ctx, int64(score), rankInfo.Rank)
+	}
+
+	// 缓存结果
+	if localCache != nil {
+		localCache.SetPlayerRank(playerID, method, rankInfo)
+	}
+	if l2Cache != nil {
+		if err := l2Cache.SetPlayerRank(ctx, playerID, method, rankInfo); err != nil {
+			s.logger.Warn("Failed to write l2 cache", "playerID", playerID, "error", err)
+		}
+	}
+
+	return rankInfo, nil
+}
+
+// GetPlayerPercentile 获取玩家在全服中的百分位（rank/total*100，范围 (0,100]）
+// 只有一名玩家时该玩家的百分位为 100
+func (s *LeaderboardService) GetPlayerPercentile(ctx context.Context, playerID string) (*model.PercentileInfo, error) {
+	rank, err := s.redisRepo.GetPlayerRank(ctx, playerID)
+	if err != nil {
+		if err == repository.ErrPlayerNotFound {
+			return nil, ErrPlayerNotFound
+		}
+		return nil, err
+	}
+
+	total, err := s.redisRepo.GetLeaderboardSize(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leaderboard size: %w", err)
+	}
+
+	// 两次读取之间玩家可能被移出排行榜，保证结果不超过 100
+	if total < rank {
+		total = rank
+	}
+
+	return &model.PercentileInfo{
+		PlayerID:   playerID,
+		Rank:       rank,
+		Total:      total,
+		Percentile: float64(rank) / float64(total) * 100,
+	}, nil
+}
+
+// GetScoreForRank 获取第 k 名的分数；指定 playerID 时同时返回该玩家与第 k 名的分差
+func (s *LeaderboardService) GetScoreForRank(ctx context.Context, k int64, playerID string) (*model.ScoreAtRankInfo, error) {
+	holderID, score, err := s.redisRepo.GetScoreAtRank(ctx, k)
+	if err != nil {
+		if err == repository.ErrRankOutOfRange {
+			return nil, ErrRankOutOfRange
+		}
+		return nil, err
+	}
+
+	info := &model.ScoreAtRankInfo{
+		Rank:     k,
+		PlayerID: holderID,
+		Score:    score,
+	}
+
+	if playerID != "" {
+		playerScore, err := s.redisRepo.GetPlayerScore(ctx, playerID)
+		if err != nil {
+			if err == repository.ErrPlayerNotFound {
+				return nil, ErrPlayerNotFound
+			}
+			return nil, err
+		}
+
+		refScore := int64(playerScore)
+		delta := score - refScore
+		info.RefPlayerID = playerID
+		info.RefScore = &refScore
+		info.Delta = &delta
+	}
+
+	return info, nil
+}
+
+// GetRankForScore 计算分数 score 在当前排行榜中将占据的名次，不要求有玩家持有该分数，也不修改排行榜
+func (s *LeaderboardService) GetRankForScore(ctx context.Context, score int64) (*model.RankForScoreInfo, error) {
+	rank, tied, err := s.redisRepo.GetRankForScore(ctx, score)
+	if err != nil {
+		return nil, err
+	}
+
+	method := s.rankingMethodFor(ctx)
+	if method == RankingDense {
+		better, err := s.redisRepo.CountBetterScores(ctx, score)
+		if err != nil {
+			return nil, err
+		}
+		rank = better + 1
+	}
+
+	return &model.RankForScoreInfo{
+		Score:  score,
+		Rank:   rank,
+		Tied:   tied,
+		Method: method,
+	}, nil
+}
+
+// SetPlayerAttributes 更新玩家属性（国家/地区、等级），只写入 MySQL
+func (s *LeaderboardService) SetPlayerAttributes(ctx context.Context, playerID string, attrs model.PlayerAttributes) error {
+	err := s.mysqlRepo.UpdatePlayerAttributes(ctx, playerID, attrs)
+	if err == repository.ErrPlayerNotFound {
+		return ErrPlayerNotFound
+	}
+	return err
+}
+
+// GetFilteredRank 计算玩家在满足 filter 的玩家子集中的排名，按请求的排名方式计算
+// 子集由 MySQL 按索引实时统计，不为每种筛选条件维护单独的有序集合；被封禁的玩家不计入子集
+func (s *LeaderboardService) GetFilteredRank(ctx context.Context, playerID string, filter model.PlayerFilter) (*model.FilteredRankInfo, error) {
+	if filter.IsEmpty() {
+		return nil, fmt.Errorf("%w: at least one filter is required", ErrInvalidFilter)
+	}
+	if filter.MinLevel < 0 || filter.MaxLevel < 0 {
+		return nil, fmt.Errorf("%w: level must not be negative", ErrInvalidFilter)
+	}
+	if filter.MaxLevel != 0 && filter.MinLevel > filter.MaxLevel {
+		return nil, fmt.Errorf("%w: minLevel must not exceed maxLevel", ErrInvalidFilter)
+	}
+
+	blocked, err := s.redisRepo.GetBlockedPlayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, blockedID := range blocked {
+		if blockedID == playerID {
+			return nil, ErrPlayerNotFound
+		}
+	}
+
+	method := s.rankingMethodFor(ctx)
+	rankInfo, err := s.mysqlRepo.GetFilteredRank(ctx, playerID, filter, blocked, method == RankingDense, s.redisRepo.Ascending())
+	if err == repository.ErrPlayerNotFound {
+		return nil, ErrPlayerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rankInfo.Method = method
+	return rankInfo, nil
+}
+
+// 分数分布最多返回的分组数
+const maxScoreBuckets = 10000
+
+// GetScoreBuckets 从 MySQL 统计所有玩家的总分分布，每组宽度为 size，不读取 Redis
+// 分组数超过 maxScoreBuckets 时返回 ErrTooManyBuckets
+func (s *LeaderboardService) GetScoreBuckets(ctx context.Context, size int64) ([]model.ScoreBucket, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid bucket size: %d", size)
+	}
+
+	buckets, err := s.mysqlRepo.GetScoreBuckets(ctx, size, maxScoreBuckets+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(buckets) > maxScoreBuckets {
+		return nil, ErrTooManyBuckets
+	}
+
+	return buckets, nil
+}
+
+// 以玩家当前名次更新其历史最佳排名，最佳排名仅用于展示，失败只记录日志
+func (s *LeaderboardService) recordPeakRanks(ctx context.Context, playerIDs ...string) {
+	if err := s.redisRepo.UpdatePeakRanks(ctx, playerIDs); err != nil {
+		s.logger.Warn("Failed to update peak ranks",
+			"playerIDs", playerIDs,
+			"error", err)
+	}
+}
+
+// GetPlayerPeakRank 获取玩家的历史最佳排名（标准排名，1-based）及达到的时间
+// 最佳排名只在玩家自己的分数写入总榜后更新，其他玩家分数变化导致的名次上升不会被记录；清空排行榜时一并清除
+func (s *LeaderboardService) GetPlayerPeakRank(ctx context.Context, playerID string) (*model.PeakRankInfo, error) {
+	if !utils.ValidatePlayerID(playerID) {
+		return nil, ErrInvalidPlayerID
+	}
+
+	rank, achievedAt, err := s.redisRepo.GetPeakRank(ctx, playerID)
+	if err != nil {
+		if err == repository.ErrPlayerNotFound {
+			return nil, ErrPlayerNotFound
+		}
+		return nil, err
+	}
+
+	return &model.PeakRankInfo{
+		PlayerID:   playerID,
+		PeakRank:   rank,
+		AchievedAt: achievedAt,
+	}, nil
+}
+
+// GetPlayerLastActive 获取玩家最后一次得分时间，优先读取 Redis，缺失时回退到 MySQL
+func (s *LeaderboardService) GetPlayerLastActive(ctx context.Context, playerID string) (time.Time, error) {
+	lastActive, err := s.redisRepo.GetPlayerLastActive(ctx, playerID)
+	if err == nil {
+		return lastActive, nil
+	}
+	if err != repository.ErrPlayerNotFound {
+		s.logger.Warn("Failed to get last active time from redis, falling back to mysql",
+			"playerID", playerID,
+			"error", err)
+	}
+
+	player, err := s.mysqlRepo.GetPlayer(ctx, playerID)
+	if err != nil {
+		if err == repository.ErrPlayerNotFound {
+			return time.Time{}, ErrPlayerNotFound
+		}
+		return time.Time{}, err
+	}
+
+	return player.UpdatedAt, nil
+}
+
+// 玩家概览中周边排名的单侧人数和最近分数变更条数
+const (
+	profileNeighbors    = 2
+	profileHistoryLimit = 10
+)
+
+// 玩家概览中各部分的名称，读取失败时列在 PlayerProfile.Unavailable 中
+const (
+	ProfilePartRank       = "rank"
+	ProfilePartPlayer     = "player"
+	ProfilePartPercentile = "percentile"
+	ProfilePartNeighbors  = "neighbors"
+	ProfilePartHistory    = "history"
+)
+
+// GetPlayerProfile 并发获取玩家排名、MySQL 中的玩家信息、百分位、周边排名和最近的分数变更
+// 某一部分读取失败时该字段为空并列在 Unavailable 中，其余部分照常返回；
+// 排名和玩家信息都读取失败时返回错误，两者都不存在时返回 ErrPlayerNotFound
+func (s *LeaderboardService) GetPlayerProfile(ctx context.Context, playerID string) (*model.PlayerProfile, error) {
+	ctx, span := tracer.Start(ctx, "service.GetPlayerProfile")
+	defer span.End()
+
+	profile := &model.PlayerProfile{PlayerID: playerID}
+	var rankErr, playerErr, percentileErr, neighborsErr, historyErr error
+
+	// 各部分互不依赖，失败只记录在对应的错误中，不取消其他部分
+	var g errgroup.Group
+	g.Go(func() error {
+		profile.Rank, rankErr = s.GetPlayerRank(ctx, playerID)
+		return nil
+	})
+	g.Go(func() error {
+		profile.Player, playerErr = s.mysqlRepo.GetPlayer(ctx, playerID)
+		return nil
+	})
+	g.Go(func() error {
+		profile.Percentile, percentileErr = s.GetPlayerPercentile(ctx, playerID)
+		return nil
+	})
+	g.Go(func() error {
+		profile.Neighbors, neighborsErr = s.GetPlayerRankRange(ctx, playerID, 2*profileNeighbors+1)
+		return nil
+	})
+	g.Go(func() error {
+		profile.History, historyErr = s.GetScoreHistory(ctx, playerID, profileHistoryLimit, 0)
+		return nil
+	})
+	g.Wait()
+
+	// 未上榜或 MySQL 中没有记录不算失败
+	parts := []struct {
+		name string
+		err  error
+	}{
+		{ProfilePartRank, rankErr},
+		{ProfilePartPlayer, playerErr},
+		{ProfilePartPercentile, percentileErr},
+		{ProfilePartNeighbors, neighborsErr},
+		{ProfilePartHistory, historyErr},
+	}
+	for _, part := range parts {
+		if part.err == nil || part.err == ErrPlayerNotFound || part.err == repository.ErrPlayerNotFound {
+			continue
+		}
+		profile.Unavailable = append(profile.Unavailable, part.name)
+		s.logger.Warn("Failed to load player profile part",
+			"playerID", playerID,
+			"part", part.name,
+			"error", part.err)
+	}
+
+	rankFailed := rankErr != nil && rankErr != ErrPlayerNotFound
+	playerFailed := playerErr != nil && playerErr != repository.ErrPlayerNotFound
+	if rankFailed && playerFailed {
+		return nil, rankErr
+	}
+	if profile.Rank == nil && profile.Player == nil && !rankFailed && !playerFailed {
+		return nil, ErrPlayerNotFound
+	}
+	return profile, nil
+}
+
+// SearchPlayers 按名称前缀搜索玩家（是否区分大小写由 MySQL 排序规则决定，默认不区分），并附上当前排名
+// 不在榜上的玩家 Rank 为空
+func (s *LeaderboardService) SearchPlayers(ctx context.Context, name string, limit int) ([]*model.PlayerProfile, error) {
+	if name == "" {
+		return nil, fmt.Errorf("empty search name")
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid limit: %d", limit)
+	}
+
+	players, err := s.mysqlRepo.SearchPlayersByName(ctx, name, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	playerIDs := make([]string, 0, len(players))
+	for _, player := range players {
+		playerIDs = append(playerIDs, player.ID)
+	}
+
+	rankInfos, err := s.redisRepo.GetPlayerRankInfos(ctx, playerIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	method := s.rankingMethodFor(ctx)
+	results := make([]*model.PlayerProfile, 0, len(players))
+	for _, player := range players {
+		rankInfo := rankInfos[player.ID]
+		if rankInfo != nil {
+			rankInfo.Name = player.Name
+			rankInfo.UpdatedAt = player.UpdatedAt
+			if method == RankingDense {
+				rankInfo.Rank = s.calculateDenseRank(ctx, rankInfo.Score, rankInfo.Rank)
+			}
+		}
+		results = append(results, &model.PlayerProfile{
+			PlayerID: player.ID,
+			Rank:     rankInfo,
+			Player:   player,
+		})
+	}
+
+	return results, nil
+}
+
+// BatchGetPlayerRanks 批量获取玩家排名，排名和分数在一次 Redis 事务中读取，名称批量从 MySQL 补全
+// 返回 playerID -> 排名，以及按请求顺序排列的未上榜玩家ID（重复ID只出现一次）
+func (s *LeaderboardService) BatchGetPlayerRanks(ctx context.Context, playerIDs []string) (map[string]*model.RankInfo, []string, error) {
+	unique := make([]string, 0, len(playerIDs))
+	seen := make(map[string]bool, len(playerIDs))
+	for _, playerID := range playerIDs {
+		if !seen[playerID] {
+			seen[playerID] = true
+			unique = append(unique, playerID)
+		}
+	}
+
+	rankInfos, err := s.redisRepo.GetPlayerRankInfos(ctx, unique)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := make([]*model.RankInfo, 0, len(rankInfos))
+	notFound := make([]string, 0)
+	for _, playerID := range unique {
+		if rankInfo, ok := rankInfos[playerID]; ok {
+			found = append(found, rankInfo)
+		} else {
+			notFound = append(notFound, playerID)
+		}
+	}
+
+	s.resolveNames(ctx, found)
+
+	if s.rankingMethodFor(ctx) == RankingDense {
+		for _, rankInfo := range found {
+			rankInfo.Rank = s.calculateDenseRank(ctx, rankInfo.Score, rankInfo.Rank)
+		}
+	}
+
+	return rankInfos, notFound, nil
+}
+
+// GetRankingAmongPlayers 只在给定的一组玩家（如好友列表）之间排名，返回按组内名次排序的结果和按请求顺序排列的未上榜玩家ID
+// Rank 为组内的相对名次（从 1 开始），不是总榜名次；Score 为总榜分数，组内顺序与总榜顺序一致，
+// 密集排名时同分玩家名次相同，否则按总榜位置依次编号。重复的玩家ID只计一次
+func (s *LeaderboardService) GetRankingAmongPlayers(ctx context.Context, playerIDs []string) ([]*model.RankInfo, []string, error) {
+	unique := make([]string, 0, len(playerIDs))
+	seen := make(map[string]bool, len(playerIDs))
+	for _, playerID := range playerIDs {
+		if !seen[playerID] {
+			seen[playerID] = true
+			unique = append(unique, playerID)
+		}
+	}
+
+	rankInfos, err := s.redisRepo.GetPlayerRankInfos(ctx, unique)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rankings := make([]*model.RankInfo, 0, len(rankInfos))
+	notFound := make([]string, 0)
+	for _, playerID := range unique {
+		if rankInfo, ok := rankInfos[playerID]; ok {
+			rankings = append(rankings, rankInfo)
+		} else {
+			notFound = append(notFound, playerID)
+		}
+	}
+
+	// 总榜名次在同一事务中读取，按其排序即与总榜的排名顺序（含同分时的先后）一致
+	sort.Slice(rankings, func(i, j int) bool { return rankings[i].Rank < rankings[j].Rank })
+	for i, rankInfo := range rankings {
+		rankInfo.Rank = i + 1
+	}
+	if s.rankingMethodFor(ctx) == RankingDense {
+		rankings = s.applyDenseRanking(rankings, 1)
+	}
+
+	s.resolveNames(ctx, rankings)
+
+	return rankings, notFound, nil
+}
+
+// GetTopN 获取前N名玩家
+func (s *LeaderboardService) GetTopN(ctx context.Context, n int) ([]*model.RankInfo, error) {
+	ctx, span := tracer.Start(ctx, "service.GetTopN")
+	defer span.End()
+
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid N: %d", n)
+	}
+
+	method := s.rankingMethodFor(ctx)
+	localCache, l2Cache := s.cachesFor(CacheEndpointTopN)
+
+	// 尝试从缓存获取
+	if localCache != nil {
+		if cached, ok := localCache.GetTopN(n, method); ok {
+			return cached, nil
+		}
+	}
+
+	if l2Cache != nil {
+		cached, ok, err := l2Cache.GetTopN(ctx, n, method)
+		if err != nil {
+			s.logger.Warn("Failed to read l2 cache", "n", n, "error", err)
+		} else if ok {
+			if localCache != nil {
+				localCache.SetTopN(n, method, cached)
+			}
+			return cached, nil
+		}
+	}
+
+	// 从 Redis 获取前N名
+	rankings, err := s.redisRepo.GetTopPlayers(ctx, int64(n))
+	if err != nil {
+		if localCache != nil {
+			if stale, ok := localCache.GetStaleTopN(n, method); ok {
+				s.logger.Warn("Redis unavailable, serving stale cached top-n", "n", n, "error", err)
+				return markStale(stale), nil
+			}
+		}
+		if s.dbFallbackReads {
+			s.logger.Warn("Redis unavailable, reading top-n from mysql", "n", n, "error", err)
+			return s.getTopNFromDB(ctx, n, method)
+		}
+		return nil, err
+	}
+
+	s.resolveNames(ctx, rankings)
+
+	// 应用密集排名策略
+	if method == RankingDense {
+		rankings = s.applyDenseRanking(rankings, 1)
+	}
+
+	// 缓存结果
+	if localCache != nil {
+		localCache.SetTopN(n, method, rankings)
+	}
+	if l2Cache != nil {
+		if err := l2Cache.SetTopN(ctx, n, method, rankings); err != nil {
+			s.logger.Warn("Failed to write l2 cache", "n", n, "error", err)
+		}
+	}
+
+	return rankings, nil
+}
+
+// GetTopNByScoreRange 获取总榜中分数在 [minScore, maxScore] 内的前N名玩家，以及满足条件的总人数
+// minScore、maxScore 为 nil 时该侧不限；n 为 0 时只统计人数；排名为玩家在整个总榜中的名次，结果不缓存
+func (s *LeaderboardService) GetTopNByScoreRange(ctx context.Context, minScore, maxScore *int64, n int) ([]*model.RankInfo, int64, error) {
+	ctx, span := tracer.Start(ctx, "service.GetTopNByScoreRange")
+	defer span.End()
+
+	if n < 0 {
+		return nil, 0, fmt.Errorf("invalid N: %d", n)
+	}
+	if minScore != nil && maxScore != nil && *minScore > *maxScore {
+		return nil, 0, ErrInvalidScoreRange
+	}
+
+	rankings, matched, err := s.redisRepo.GetPlayersByScoreRange(ctx, minScore, maxScore, int64(n))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.resolveNames(ctx, rankings)
+
+	// 应用密集排名策略，区间内第一名的密集排名由排在其之前的不同分数个数决定
+	if s.rankingMethodFor(ctx) == RankingDense && len(rankings) > 0 {
+		rankings = s.applyDenseRanking(rankings, s.calculateDenseRank(ctx, rankings[0].Score, rankings[0].Rank))
+	}
+
+	return rankings, matched, nil
+}
+
+// GetTopNForWindow 获取日/周/月时间窗口排行榜的前N名
+func (s *LeaderboardService) GetTopNForWindow(ctx context.Context, window string, n int) ([]*model.RankInfo, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid N: %d", n)
+	}
+
+	rankings, err := s.redisRepo.GetWindowTopPlayers(ctx, window, int64(n))
+	if err != nil {
+		if err == repository.ErrInvalidWindow {
+			return nil, ErrInvalidWindow
+		}
+		return nil, err
+	}
+
+	s.resolveNames(ctx, rankings)
+
+	// 应用密集排名策略
+	if s.rankingMethodFor(ctx) == RankingDense {
+		rankings = s.applyDenseRanking(rankings, 1)
+	}
+
+	return rankings, nil
+}
+
+// GetLeaderboardSize 获取排行榜玩家数量，window 为空时为全服总榜
+func (s *LeaderboardService) GetLeaderboardSize(ctx context.Context, window string) (int64, error) {
+	if window == "" {
+		return s.redisRepo.GetLeaderboardSize(ctx)
+	}
+
+	size, err := s.redisRepo.GetWindowSize(ctx, window)
+	if err == repository.ErrInvalidWindow {
+		return 0, ErrInvalidWindow
+	}
+	return size, err
+}
+
+// GetPlayerRankRange 获取玩家周边排名
+func (s *LeaderboardService) GetPlayerRankRange(ctx context.Context, playerID string, rangeNum int) ([]*model.RankInfo, error) {
+	ctx, span := tracer.Start(ctx, "service.GetPlayerRankRange")
+	defer span.End()
+
+	if rangeNum <= 0 {
+		return nil, fmt.Errorf("invalid range: %d", rangeNum)
+	}
+
+	rankings, err := s.redisRepo.GetPlayerRankRange(ctx, playerID, int64(rangeNum))
+	if err != nil {
+		if err == repository.ErrPlayerNotFound {
+			return nil, ErrPlayerNotFound
+		}
+		return nil, err
+	}
+
+	s.resolveNames(ctx, rankings)
+
+	// 应用密集排名策略，窗口不一定从榜首开始，首条记录的名次需要结合整个排行榜计算
+	if s.rankingMethodFor(ctx) == RankingDense && len(rankings) > 0 {
+		first := rankings[0]
+		startRank := s.calculateDenseRank(ctx, first.Score, first.Rank)
+		rankings = s.applyDenseRanking(rankings, startRank)
+	}
+
+	return rankings, nil
+}
+
+// GetPlayersNearScore 获取分数与玩家相差不超过 scoreDelta 的玩家（包含该玩家），按排名顺序最多返回 limit 名
+// 同时返回玩家当前分数和满足条件的总人数
+func (s *LeaderboardService) GetPlayersNearScore(ctx context.Context, playerID string, scoreDelta int64, limit int) ([]*model.RankInfo, int64, int64, error) {
+	ctx, span := tracer.Start(ctx, "service.GetPlayersNearScore")
+	defer span.End()
+
+	if scoreDelta < 0 {
+		return nil, 0, 0, fmt.Errorf("invalid score delta: %d", scoreDelta)
+	}
+	if limit <= 0 {
+		return nil, 0, 0, fmt.Errorf("invalid limit: %d", limit)
+	}
+
+	rankings, score, matched, err := s.redisRepo.GetPlayersNearScore(ctx, playerID, scoreDelta, int64(limit))
+	if err != nil {
+		if err == repository.ErrPlayerNotFound {
+			return nil, 0, 0, ErrPlayerNotFound
+		}
+		return nil, 0, 0, err
+	}
+
+	s.resolveNames(ctx, rankings)
+
+	// 应用密集排名策略，首条记录的名次需要结合整个排行榜计算
+	if s.rankingMethodFor(ctx) == RankingDense && len(rankings) > 0 {
+		first := rankings[0]
+		rankings = s.applyDenseRanking(rankings, s.calculateDenseRank(ctx, first.Score, first.Rank))
+	}
+
+	return rankings, score, matched, nil
+}
+
+// GetScoreHistory 获取玩家分数变更历史
+func (s *LeaderboardService) GetScoreHistory(ctx context.Context, playerID string, limit, offset int) ([]*model.PlayerScoreHistory, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid limit: %d", limit)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid offset: %d", offset)
+	}
+
+	return s.mysqlRepo.GetScoreHistory(ctx, playerID, limit, offset)
+}
+
+// GetDailyScoreDeltas 获取玩家最近 days 天每天的分数变化合计，没有变化的日期不返回
+func (s *LeaderboardService) GetDailyScoreDeltas(ctx context.Context, playerID string, days int) ([]*model.DailyScoreDelta, error) {
+	if days <= 0 {
+		return nil, fmt.Errorf("invalid days: %d", days)
+	}
+
+	return s.mysqlRepo.GetDailyScoreDeltas(ctx, playerID, days)
+}
+
+// GetLeaderboardPage 分页获取排行榜，返回当前页数据和排行榜总人数
+func (s *LeaderboardService) GetLeaderboardPage(ctx context.Context, offset, limit int) ([]*model.RankInfo, int64, error) {
+	ctx, span := tracer.Start(ctx, "service.GetLeaderboardPage")
+	defer span.End()
+
+	if offset < 0 {
+		return nil, 0, fmt.Errorf("invalid offset: %d", offset)
+	}
+	if limit <= 0 {
+		return nil, 0, fmt.Errorf("invalid limit: %d", limit)
+	}
+
+	total, err := s.redisRepo.GetLeaderboardSize(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get leaderboard size: %w", err)
+	}
+
+	rankings, err := s.redisRepo.GetPlayersByRankRange(ctx, int64(offset), int64(offset+limit-1))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.resolveNames(ctx, rankings)
+
+	// 应用密集排名策略，首条记录的名次需要结合整个排行榜计算
+	if s.rankingMethodFor(ctx) == RankingDense && len(rankings) > 0 {
+		first := rankings[0]
+		startRank := s.calculateDenseRank(ctx, first.Score, first.Rank)
+		rankings = s.applyDenseRanking(rankings, startRank)
+	}
+
+	return rankings, total, nil
+}
+
+// 玩家信息不保存在 Redis 时，从 MySQL 批量补全排名列表中的玩家名称
+func (s *LeaderboardService) resolveNames(ctx context.Context, rankings []*model.RankInfo) {
+	if s.redisRepo.StoresMetadata() || len(rankings) == 0 {
+		return
+	}
+
+	playerIDs := make([]string, 0, len(rankings))
+	for _, rankInfo := range rankings {
+		playerIDs = append(playerIDs, rankInfo.PlayerID)
+	}
+
+	names, err := s.mysqlRepo.GetPlayerNames(ctx, playerIDs)
+	if err != nil {
+		s.logger.Warn("Failed to get player names from mysql", "error", err)
+		return
+	}
+
+	for _, rankInfo := range rankings {
+		rankInfo.Name = names[rankInfo.PlayerID]
+	}
+}
+
+// 计算密集排名，standardRank 为该分数的标准排名；榜首（包括榜上只有一名玩家时）无需查询，
+// 查询失败时退回标准排名，避免返回 0
+func (s *LeaderboardService) calculateDenseRank(ctx context.Context, score int64, standardRank int) int {
+	if standardRank <= 1 {
+		return 1
+	}
+
+	// 通过不同分数索引统计排在当前分数之前的唯一分数数量，无需读取排行榜成员
+	betterCount, err := s.redisRepo.CountBetterScores(ctx, score)
+	if err != nil {
+		s.logger.Warn("Failed to count better scores for dense ranking", "error", err)
+		return standardRank
+	}
+
+	return int(betterCount) + 1
+}
+
+// 复制缓存中的排名并标记为过期结果，缓存中的数据保持不变
+func markStale(rankings []*model.RankInfo) []*model.RankInfo {
+	result := make([]*model.RankInfo, len(rankings))
+	for i, rankInfo := range rankings {
+		staleCopy := *rankInfo
+		staleCopy.Stale = true
+		result[i] = &staleCopy
+	}
+	return result
+}
+
+// 应用密集排名到结果集，startRank 为第一条记录的密集排名
+func (s *LeaderboardService) applyDenseRanking(rankings []*model.RankInfo, startRank int) []*model.RankInfo {
+	if len(rankings) == 0 {
+		return rankings
+	}
+
+	denseRank := startRank
+	lastScore := rankings[0].Score
+
+	for i, rankInfo := range rankings {
+		if rankInfo.Score != lastScore {
+			denseRank++
+			lastScore = rankInfo.Score
+		}
+		rankings[i].Rank = denseRank
+	}
+
+	return rankings
+}
+
+// 后台任务：快照、预计算排名和健康检查各自按配置的间隔运行，互不影响
+func (s *LeaderboardService) backgroundTasks(ctx context.Context) {
+	var wg sync.WaitGroup
+	run := func(name string, interval time.Duration, fn func(context.Context)) {
+		if interval <= 0 {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runPeriodic(ctx, interval, s.scheduleJitter, fn)
+			s.logger.Info("Background task stopped", "task", name)
+		}()
+	}
+
+	run("snapshot", s.snapshotInterval, func(ctx context.Context) {
+		s.createSnapshot(ctx)
+		s.pruneSnapshots(ctx)
+	})
+	if s.precomputedRanks {
+		s.refreshPrecomputedRanks(ctx)
+		run("precomputed_ranks", s.rankRefreshInterval, s.refreshPrecomputedRanks)
+	}
+	run("health_check", s.healthCheckInterval, s.healthCheck)
+	run("score_expiry", s.scoreExpiryInterval, s.expireScores)
+	if s.decayInterval > 0 {
+		if reason := s.decayUnsupported(); reason != "" {
+			s.logger.Error("Score decay disabled", "reason", reason)
+		} else {
+			run("score_decay", s.decayInterval, s.decayScores)
+		}
+	}
+
+	wg.Wait()
+}
+
+// 每次 fn 返回后等待 interval 加上 [0, jitter) 的随机时长再调用，ctx 取消后返回
+func runPeriodic(ctx context.Context, interval, jitter time.Duration, fn func(context.Context)) {
+	timer := time.NewTimer(jitteredDelay(interval, jitter))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			fn(ctx)
+			timer.Reset(jitteredDelay(interval, jitter))
+		}
+	}
+}
+
+// 返回 interval 加上 [0, jitter) 的随机时长，jitter 不大于 0 时返回 interval
+func jitteredDelay(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + rand.N(jitter)
+}
+
+// 创建排行榜快照
+func (s *LeaderboardService) createSnapshot(ctx context.Context) {
+	players, err := s.mysqlRepo.GetAllPlayers(ctx)
+	if err != nil {
+		s.logger.Error("Failed to get players for snapshot", "error", err)
+		return
+	}
+
+	snapshotData, err := json.Marshal(players)
+	if err != nil {
+		s.logger.Error("Failed to marshal snapshot data", "error", err)
+		return
+	}
+
+	if err := s.mysqlRepo.SaveLeaderboardSnapshot(ctx, snapshotData, len(players)); err != nil {
+		s.logger.Error("Failed to save leaderboard snapshot", "error", err)
+		return
+	}
+
+	s.logger.Info("Leaderboard snapshot created", "playerCount", len(players))
+}
+
+// 按保留策略删除旧的排行榜快照
+func (s *LeaderboardService) pruneSnapshots(ctx context.Context) {
+	if s.snapshotRetentionCount <= 0 && s.snapshotRetentionDuration <= 0 {
+		return
+	}
+
+	var before time.Time
+	if s.snapshotRetentionDuration > 0 {
+		before = time.Now().Add(-s.snapshotRetentionDuration)
+	}
+
+	pruned, err := s.mysqlRepo.PruneSnapshots(ctx, s.snapshotRetentionCount, before)
+	if err != nil {
+		s.logger.Error("Failed to prune leaderboard snapshots", "error", err)
+		return
+	}
+
+	s.logger.Info("Leaderboard snapshots pruned",
+		"pruned", pruned,
+		"retentionCount", s.snapshotRetentionCount,
+		"retentionDuration", s.snapshotRetentionDuration)
+}
+
+// 遍历排行榜按当前排名策略计算所有玩家排名，写入临时 Hash 后整体替换
+func (s *LeaderboardService) refreshPrecomputedRanks(ctx context.Context) {
+	computedAt := time.Now()
+	buildKey := repository.PrecomputedRankBuildKey(computedAt)
+
+	count := 0
+	denseRank := 0
+	lastScore := int64(0)
+	err := s.redisRepo.IterateLeaderboard(ctx, 0, func(page []*model.RankInfo) error {
+		ranks := make(map[string]int, len(page))
+		for _, entry := range page {
+			rank := entry.Rank
+			if s.rankingMethod == RankingDense {
+				if count == 0 || entry.Score != lastScore {
+					denseRank++
+					lastScore = entry.Score
+				}
+				rank = denseRank
+			}
+			ranks[entry.PlayerID] = rank
+			count++
+		}
+		return s.redisRepo.WritePrecomputedRanks(ctx, buildKey, ranks)
+	})
+	if err == nil {
+		err = s.redisRepo.PublishPrecomputedRanks(ctx, buildKey, computedAt)
+	}
+	if err != nil {
+		s.logger.Error("Failed to refresh precomputed ranks", "error", err)
+		if err := s.redisRepo.DiscardPrecomputedRanks(context.Background(), buildKey); err != nil {
+			s.logger.Warn("Failed to discard partial precomputed ranks", "error", err)
+		}
+		return
+	}
+
+	s.logger.Info("Precomputed ranks refreshed",
+		"playerCount", count,
+		"duration", time.Since(computedAt))
+}
+
+// GetCohortStats 统计一组玩家的名次分布，直方图将排行榜按名次等分为 cohortHistogramBuckets 段
+// 名次为标准排名（排行榜中的位置），重复的玩家ID只计一次
+func (s *LeaderboardService) GetCohortStats(ctx context.Context, playerIDs []string) (*model.CohortStats, error) {
+	unique := make([]string, 0, len(playerIDs))
+	seen := make(map[string]bool, len(playerIDs))
+	for _, playerID := range playerIDs {
+		if !seen[playerID] {
+			seen[playerID] = true
+			unique = append(unique, playerID)
+		}
+	}
+
+	ranks, size, err := s.redisRepo.GetPlayerRanks(ctx, unique)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &model.CohortStats{
+		Requested: len(unique),
+		Ranked:    len(ranks),
+		Unranked:  len(unique) - len(ranks),
+		BoardSize: size,
+		Histogram: make([]model.CohortBucket, 0),
+	}
+	if len(ranks) == 0 {
+		return stats, nil
+	}
+
+	sorted := make([]int64, 0, len(ranks))
+	for _, rank := range ranks {
+		sorted = append(sorted, rank)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	stats.MinRank = sorted[0]
+	stats.MaxRank = sorted[len(sorted)-1]
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		stats.MedianRank = float64(sorted[mid-1]+sorted[mid]) / 2
+	} else {
+		stats.MedianRank = float64(sorted[mid])
+	}
+
+	// 排行榜人数不足分段数时每段一个名次
+	width := (size + cohortHistogramBuckets - 1) / cohortHistogramBuckets
+	for from := int64(1); from <= size; from += width {
+		stats.Histogram = append(stats.Histogram, model.CohortBucket{
+			FromRank: from,
+			ToRank:   min(from+width-1, size),
+		})
+	}
+	for _, rank := range sorted {
+		// 批量读取在同一事务中完成，名次不会超过排行榜人数
+		stats.Histogram[(rank-1)/width].Count++
+	}
+
+	return stats, nil
+}
+
+// ExportLeaderboard 按排名顺序分页导出整个排行榜，每页交给 fn 处理，便于调用方流式输出
+// 名称和更新时间从 MySQL 读取，MySQL 中没有的玩家保留 Redis 中的名称，更新时间为空
+func (s *LeaderboardService) ExportLeaderboard(ctx context.Context, fn func(page []*model.RankInfo) error) error {
+	method := s.rankingMethodFor(ctx)
+
+	count := 0
+	denseRank := 0
+	lastScore := int64(0)
+	return s.redisRepo.IterateLeaderboard(ctx, 0, func(page []*model.RankInfo) error {
+		if method == RankingDense {
+			for _, entry := range page {
+				if count == 0 || entry.Score != lastScore {
+					denseRank++
+					lastScore = entry.Score
+				}
+				entry.Rank = denseRank
+				count++
+			}
+		}
 
-	return service
+		if err := s.fillExportMetadata(ctx, page); err != nil {
+			return err
+		}
+		return fn(page)
+	})
 }
 
-// UpdateScore 更新玩家分数
-func (s *LeaderboardService) UpdateScore(ctx context.Context, playerID string, incrScore int64, name, reason string) error {
-	// 1. 先更新 MySQL（作为数据源）
-	currentPlayer, err := s.mysqlRepo.GetPlayer(ctx, playerID)
-	if err != nil && err != repository.ErrPlayerNotFound {
-		return fmt.Errorf("failed to get player from mysql: %w", err)
+// 从 MySQL 批量补全导出数据的玩家名称和更新时间
+func (s *LeaderboardService) fillExportMetadata(ctx context.Context, page []*model.RankInfo) error {
+	playerIDs := make([]string, 0, len(page))
+	for _, entry := range page {
+		playerIDs = append(playerIDs, entry.PlayerID)
 	}
 
-	var finalScore int64
-	if currentPlayer != nil {
-		finalScore = currentPlayer.TotalScore + incrScore
-	} else {
-		finalScore = incrScore
+	players, err := s.mysqlRepo.GetPlayersByIDs(ctx, playerIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get player metadata: %w", err)
 	}
 
-	// 更新 MySQL 玩家表
-	player := &model.Player{
-		ID:         playerID,
-		Name:       name,
-		TotalScore: finalScore,
+	for _, entry := range page {
+		player, ok := players[entry.PlayerID]
+		if !ok {
+			continue
+		}
+		entry.Name = player.Name
+		entry.UpdatedAt = player.UpdatedAt
 	}
+	return nil
+}
 
-	if err := s.mysqlRepo.UpsertPlayer(ctx, player); err != nil {
-		return fmt.Errorf("failed to update player in mysql: %w", err)
-	}
+// 后台健康检查得到的依赖服务状态
+var dependencyUp = promauto.With(metrics.Registerer).NewGaugeVec(prometheus.GaugeOpts{
+	Name: "leaderboard_dependency_up",
+	Help: "Whether the dependency passed the last background health check (1 = up, 0 = down)",
+}, []string{"dependency"})
 
-	// 记录分数变更历史
-	history := &model.PlayerScoreHistory{
-		PlayerID:    playerID,
-		ScoreChange: incrScore,
-		FinalScore:  finalScore,
-		Reason:      reason,
+// 健康检查：逐个检查 Redis 和 MySQL，更新 leaderboard_dependency_up，状态变化（可用与不可用之间）时记录日志
+// 两者的连接池在依赖恢复后都会丢弃失效连接并重新建立，不需要重启；每次检查也会促使连接池尽早重连
+func (s *LeaderboardService) healthCheck(ctx context.Context) {
+	checks := []struct {
+		name  string
+		check func(context.Context) error
+	}{
+		{"redis", s.redisRepo.HealthCheck},
+		{"mysql", s.mysqlRepo.HealthCheck},
 	}
 
-	if err := s.mysqlRepo.RecordScoreHistory(ctx, history); err != nil {
-		s.logger.Warn("Failed to record score history", "error", err)
+	for _, dep := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+		err := dep.check(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		s.recordDependencyState(dep.name, err)
 	}
+}
 
-	// 2. 更新 Redis（作为排行榜存储）
-	if err := s.redisRepo.UpdatePlayerScore(ctx, playerID, finalScore, name); err != nil {
-		// Redis 更新失败，记录错误但不要完全失败
-		s.logger.Error("Failed to update redis leaderboard",
-			"playerID", playerID,
+// 记录一次健康检查的结果，状态变化时输出日志
+func (s *LeaderboardService) recordDependencyState(name string, err error) {
+	downSince, wasDown := s.dependencyDownSince[name]
+
+	if err != nil {
+		dependencyUp.WithLabelValues(name).Set(0)
+		if !wasDown {
+			s.dependencyDownSince[name] = time.Now()
+			s.logger.Error("Dependency became unhealthy", "dependency", name, "error", err)
+			return
+		}
+		s.logger.Warn("Dependency still unhealthy",
+			"dependency", name,
+			"downFor", time.Since(downSince).Round(time.Second).String(),
 			"error", err)
-		// 可以加入重试机制
+		return
 	}
 
-	// 3. 清除相关缓存
-	if s.enableCache {
-		s.cache.ClearPlayerRank(playerID)
-		s.cache.ClearTopN()
+	dependencyUp.WithLabelValues(name).Set(1)
+	if wasDown {
+		delete(s.dependencyDownSince, name)
+		s.logger.Info("Dependency recovered",
+			"dependency", name,
+			"downFor", time.Since(downSince).Round(time.Second).String())
 	}
+}
 
-	s.logger.Info("Player score updated",
-		"playerID", playerID,
-		"scoreChange", incrScore,
-		"finalScore", finalScore,
-		"reason", reason)
+// CheckRedisHealth 检查 Redis 健康状态
+func (s *LeaderboardService) CheckRedisHealth(ctx context.Context) bool {
+	if err := s.redisRepo.HealthCheck(ctx); err != nil {
+		s.logger.Error("Redis health check failed", "error", err)
+		return false
+	}
+	return true
+}
 
-	return nil
+// CheckMySQLHealth 检查 MySQL 健康状态
+func (s *LeaderboardService) CheckMySQLHealth(ctx context.Context) bool {
+	if err := s.mysqlRepo.HealthCheck(ctx); err != nil {
+		s.logger.Error("MySQL health check failed", "error", err)
+		return false
+	}
+	return true
 }
 
-// GetPlayerRank 获取玩家排名
-func (s *LeaderboardService) GetPlayerRank(ctx context.Context, playerID string) (*model.RankInfo, error) {
-	// 尝试从缓存获取
-	if s.enableCache {
-		if cached, ok := s.cache.GetPlayerRank(playerID); ok {
-			return cached, nil
-		}
+// ResetLeaderboard 清空排行榜（赛季切换），mysqlMode 为空时按 keep 处理；dryRun 时只统计将被删除的数量
+// 重置期间不阻止并发写入，应在停止写入后调用
+func (s *LeaderboardService) ResetLeaderboard(ctx context.Context, mysqlMode string, dryRun bool) (*model.ResetResult, error) {
+	if mysqlMode == "" {
+		mysqlMode = ResetMySQLKeep
+	}
+	if mysqlMode != ResetMySQLKeep && mysqlMode != ResetMySQLTruncate && mysqlMode != ResetMySQLArchive {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResetMode, mysqlMode)
 	}
 
-	// 从 Redis 获取排名和分数
-	rank, err := s.redisRepo.GetPlayerRank(ctx, playerID)
-	if err != nil {
-		if err == repository.ErrPlayerNotFound {
-			return nil, ErrPlayerNotFound
+	result := &model.ResetResult{DryRun: dryRun, MySQLMode: mysqlMode}
+
+	if dryRun {
+		size, err := s.redisRepo.GetLeaderboardSize(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get leaderboard size: %w", err)
 		}
-		return nil, err
-	}
+		result.LeaderboardEntries = size
 
-	score, err := s.redisRepo.GetPlayerScore(ctx, playerID)
-	if err != nil {
-		if err == repository.ErrPlayerNotFound {
-			return nil, ErrPlayerNotFound
+		if mysqlMode != ResetMySQLKeep {
+			result.ResetPlayers, result.DeletedHistory, err = s.mysqlRepo.CountScoreData(ctx)
+			if err != nil {
+				return nil, err
+			}
 		}
-		return nil, err
+		return result, nil
 	}
 
-	// 获取玩家名称
-	player, err := s.mysqlRepo.GetPlayer(ctx, playerID)
-	if err != nil {
-		if err == repository.ErrPlayerNotFound {
-			// 如果 MySQL 中没有，但 Redis 中有，创建一个基本的玩家信息
-			player = &model.Player{
-				ID:   playerID,
-				Name: "",
-			}
-		} else {
+	// 先处理 MySQL：Redis 清空失败时可通过重建恢复一致
+	if mysqlMode == ResetMySQLArchive {
+		players, err := s.mysqlRepo.GetAllPlayers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get players for archive: %w", err)
+		}
+		snapshotData, err := json.Marshal(players)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal archive: %w", err)
+		}
+		if err := s.mysqlRepo.SaveLeaderboardSnapshot(ctx, snapshotData, len(players)); err != nil {
 			return nil, err
 		}
+		result.Archived = true
 	}
-
-	rankInfo := &model.RankInfo{
-		PlayerID:  playerID,
-		Rank:      int(rank),
-		Score:     int64(score),
-		Name:      player.Name,
-		UpdatedAt: player.UpdatedAt,
+	if mysqlMode != ResetMySQLKeep {
+		var err error
+		result.ResetPlayers, result.DeletedHistory, err = s.mysqlRepo.ResetScores(ctx)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// 应用排名策略（密集排名）
-	if s.rankingMethod == "dense" {
-		rankInfo.Rank = s.calculateDenseRank(ctx, playerID, int64(score))
+	removed, err := s.redisRepo.ClearLeaderboard(ctx)
+	if err != nil {
+		return nil, err
 	}
+	result.LeaderboardEntries = removed
 
-	// 缓存结果
 	if s.enableCache {
-		s.cache.SetPlayerRank(playerID, rankInfo)
+		s.cache.Clear()
+	}
+	if s.l2Cache != nil {
+		if err := s.l2Cache.Clear(ctx); err != nil {
+			s.logger.Warn("Failed to clear l2 cache", "error", err)
+		}
 	}
+	s.live.markDirty()
 
-	return rankInfo, nil
+	s.logger.Info("Leaderboard reset",
+		"mysqlMode", mysqlMode,
+		"leaderboardEntries", result.LeaderboardEntries,
+		"resetPlayers", result.ResetPlayers,
+		"deletedHistory", result.DeletedHistory)
+
+	return result, nil
 }
 
-// GetTopN 获取前N名玩家
-func (s *LeaderboardService) GetTopN(ctx context.Context, n int) ([]*model.RankInfo, error) {
-	if n <= 0 {
-		return nil, fmt.Errorf("invalid N: %d", n)
+// ListSnapshots 分页列出排行榜快照（不含快照数据）及快照总数，最新的在前
+func (s *LeaderboardService) ListSnapshots(ctx context.Context, limit, offset int) ([]*model.LeaderboardSnapshot, int64, error) {
+	if limit <= 0 {
+		return nil, 0, fmt.Errorf("invalid limit: %d", limit)
+	}
+	if offset < 0 {
+		return nil, 0, fmt.Errorf("invalid offset: %d", offset)
 	}
 
-	// 尝试从缓存获取
-	if s.enableCache {
-		if cached, ok := s.cache.GetTopN(n); ok {
-			return cached, nil
+	return s.mysqlRepo.ListSnapshots(ctx, limit, offset)
+}
+
+// 从快照恢复时每个 Redis pipeline 写入的玩家数
+const restoreRedisBatchSize = 1000
+
+// RestoreFromSnapshot 以 MySQL 中保存的排行榜快照恢复分数，snapshotID 为 0 时使用最新的快照
+// MySQL 中不在快照里的玩家分数清零、未到期的临时分数不再扣回，分数历史保持不变；
+// 随后清空 Redis 排行榜（包括时间窗口榜）并按快照重新写入，被封禁的玩家不写入。
+// 恢复期间不阻止并发写入，应在停止写入后调用
+func (s *LeaderboardService) RestoreFromSnapshot(ctx context.Context, snapshotID int64) (*model.RestoreResult, error) {
+	ctx, span := tracer.Start(ctx, "service.RestoreFromSnapshot")
+	defer span.End()
+
+	snapshot, err := s.mysqlRepo.GetSnapshot(ctx, snapshotID)
+	if err != nil {
+		if err == repository.ErrNoSnapshot {
+			return nil, ErrLeaderboardSnapshotNotFound
 		}
+		return nil, err
 	}
 
-	// 从 Redis 获取前N名
-	rankings, err := s.redisRepo.GetTopPlayers(ctx, int64(n))
+	var players []*model.Player
+	if err := json.Unmarshal(snapshot.SnapshotData, &players); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot %d: %w", snapshot.ID, err)
+	}
+
+	blocked, err := s.blockedPlayerSet(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// 应用密集排名策略
-	if s.rankingMethod == "dense" {
-		rankings = s.applyDenseRanking(rankings)
+	// 先恢复 MySQL：Redis 写入失败时可通过重建恢复一致
+	if err := s.mysqlRepo.RestorePlayerScores(ctx, players); err != nil {
+		return nil, err
 	}
 
-	// 缓存结果
-	if s.enableCache {
-		s.cache.SetTopN(n, rankings)
+	if _, err := s.redisRepo.ClearLeaderboard(ctx); err != nil {
+		return nil, err
 	}
 
-	return rankings, nil
-}
-
-// GetPlayerRankRange 获取玩家周边排名
-func (s *LeaderboardService) GetPlayerRankRange(ctx context.Context, playerID string, rangeNum int) ([]*model.RankInfo, error) {
-	if rangeNum <= 0 {
-		return nil, fmt.Errorf("invalid range: %d", rangeNum)
+	ranked := make([]*model.Player, 0, len(players))
+	for _, player := range players {
+		if !blocked[player.ID] {
+			ranked = append(ranked, player)
+		}
+	}
+	for start := 0; start < len(ranked); start += restoreRedisBatchSize {
+		end := min(start+restoreRedisBatchSize, len(ranked))
+		if err := s.redisRepo.UpdatePlayerScores(ctx, ranked[start:end]); err != nil {
+			return nil, err
+		}
 	}
 
-	rankings, err := s.redisRepo.GetPlayerRankRange(ctx, playerID, int64(rangeNum))
-	if err != nil {
-		if err == repository.ErrPlayerNotFound {
-			return nil, ErrPlayerNotFound
+	if s.enableCache {
+		s.cache.Clear()
+	}
+	if s.l2Cache != nil {
+		if err := s.l2Cache.Clear(ctx); err != nil {
+			s.logger.Warn("Failed to clear l2 cache after restore", "error", err)
 		}
-		return nil, err
 	}
+	s.live.markDirty()
 
-	// 应用密集排名策略
-	if s.rankingMethod == "dense" {
-		rankings = s.applyDenseRanking(rankings)
+	result := &model.RestoreResult{
+		SnapshotID:         snapshot.ID,
+		SnapshotCreatedAt:  snapshot.CreatedAt,
+		RestoredPlayers:    len(players),
+		LeaderboardEntries: len(ranked),
 	}
 
-	return rankings, nil
+	s.logger.Info("Leaderboard restored from snapshot",
+		"snapshotID", snapshot.ID,
+		"restoredPlayers", result.RestoredPlayers,
+		"leaderboardEntries", result.LeaderboardEntries)
+
+	return result, nil
 }
 
-// 计算密集排名
-func (s *LeaderboardService) calculateDenseRank(ctx context.Context, playerID string, score int64) int {
-	// 获取排行榜大小
-	size, err := s.redisRepo.GetLeaderboardSize(ctx)
-	if err != nil {
-		s.logger.Warn("Failed to get leaderboard size for dense ranking", "error", err)
-		return 0
+// CheckDependencies 逐个检查依赖服务并记录耗时，用于就绪检查
+func (s *LeaderboardService) CheckDependencies(ctx context.Context) map[string]model.DependencyHealth {
+	checks := map[string]func(context.Context) error{
+		"redis": s.redisRepo.HealthCheck,
+		"mysql": s.mysqlRepo.HealthCheck,
 	}
 
-	// 获取比当前玩家分数高的玩家数量
-	// 注意：这只是一个近似值，实际实现可能需要更复杂的逻辑
-	topPlayers, err := s.redisRepo.GetTopPlayers(ctx, size)
-	if err != nil {
-		s.logger.Warn("Failed to get top players for dense ranking", "error", err)
-		return 0
+	results := make(map[string]model.DependencyHealth, len(checks))
+	for name, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+		start := time.Now()
+		err := check(checkCtx)
+		cancel()
+
+		result := model.DependencyHealth{
+			Healthy:   err == nil,
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			result.Error = err.Error()
+			s.logger.Error("Dependency health check failed", "dependency", name, "error", err)
+		}
+		results[name] = result
 	}
 
-	// 计算唯一分数的数量
-	uniqueScores := make(map[int64]bool)
-	for _, player := range topPlayers {
-		uniqueScores[player.Score] = true
+	return results
+}
+
+// GetCacheStats 获取缓存统计
+func (s *LeaderboardService) GetCacheStats() map[string]interface{} {
+	stats := map[string]interface{}{
+		"enabled": false,
+	}
+	if s.cache != nil {
+		stats = s.cache.GetStats()
 	}
+	stats["l2_enabled"] = s.l2Cache != nil
 
-	// 计算比当前分数高的唯一分数数量
-	higherCount := 0
-	for uniqueScore := range uniqueScores {
-		if uniqueScore > score {
-			higherCount++
+	disabled := make([]string, 0, len(s.cacheDisabled))
+	for _, endpoint := range []string{CacheEndpointRank, CacheEndpointTopN} {
+		if s.cacheDisabled[endpoint] {
+			disabled = append(disabled, endpoint)
 		}
 	}
-
-	return higherCount + 1
+	stats["disabled_endpoints"] = disabled
+	return stats
 }
 
-// 应用密集排名到结果集
-func (s *LeaderboardService) applyDenseRanking(rankings []*model.RankInfo) []*model.RankInfo {
-	if len(rankings) == 0 {
-		return rankings
+// FlushCache 清空本地缓存和 L2 缓存，返回清空前后的缓存统计；playerID 非空时只清除该玩家的排名缓存
+// 整体清空时本地缓存的命中统计一并归零；本地缓存和 L2 缓存都未启用时返回 ErrCacheDisabled
+func (s *LeaderboardService) FlushCache(ctx context.Context, playerID string) (before, after map[string]interface{}, err error) {
+	if !s.enableCache && s.l2Cache == nil {
+		return nil, nil, ErrCacheDisabled
+	}
+	if playerID != "" && !utils.ValidatePlayerID(playerID) {
+		return nil, nil, ErrInvalidPlayerID
 	}
 
-	denseRank := 1
-	lastScore := rankings[0].Score
+	before = s.GetCacheStats()
 
-	for i, rankInfo := range rankings {
-		if rankInfo.Score != lastScore {
-			denseRank++
-			lastScore = rankInfo.Score
+	if playerID != "" {
+		if s.enableCache {
+			s.cache.ClearPlayerRank(playerID)
+		}
+		if s.l2Cache != nil {
+			if err := s.l2Cache.ClearPlayerRank(ctx, playerID); err != nil {
+				return nil, nil, fmt.Errorf("failed to clear l2 cache: %w", err)
+			}
+		}
+	} else {
+		if s.enableCache {
+			s.cache.Clear()
+		}
+		if s.l2Cache != nil {
+			if err := s.l2Cache.Clear(ctx); err != nil {
+				return nil, nil, fmt.Errorf("failed to clear l2 cache: %w", err)
+			}
 		}
-		rankings[i].Rank = denseRank
 	}
 
-	return rankings
+	s.logger.Info("Cache flushed", "playerID", playerID)
+	return before, s.GetCacheStats(), nil
 }
 
-// 后台任务
-func (s *LeaderboardService) backgroundTasks() {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+// ExportCacheState 将本地缓存中未过期的排名和前N名导出到 Redis，返回导出的缓存项数量
+// 快照与缓存使用相同的过期时间，过期后不会再被导入
+func (s *LeaderboardService) ExportCacheState(ctx context.Context) (int, error) {
+	if !s.enableCache {
+		return 0, ErrCacheDisabled
+	}
 
-	for range ticker.C {
-		// 定期创建快照
-		if time.Since(s.lastSnapshot) > s.snapshotInterval {
-			s.createSnapshot(context.Background())
-		}
+	snapshot := s.cache.Export()
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal cache snapshot: %w", err)
+	}
 
-		// 健康检查
-		s.healthCheck(context.Background())
+	if err := s.redisRepo.SaveCacheSnapshot(ctx, data, s.cacheTTL); err != nil {
+		return 0, err
 	}
+
+	exported := len(snapshot.Ranks) + len(snapshot.TopN)
+	s.logger.Info("Cache state exported", "entries", exported)
+	return exported, nil
 }
 
-// 创建排行榜快照
-func (s *LeaderboardService) createSnapshot(ctx context.Context) {
-	players, err := s.mysqlRepo.GetAllPlayers(ctx)
-	if err != nil {
-		s.logger.Error("Failed to get players for snapshot", "error", err)
-		return
+// ImportCacheState 从 Redis 中的快照恢复本地缓存，返回导入的缓存项数量
+func (s *LeaderboardService) ImportCacheState(ctx context.Context) (int, error) {
+	if !s.enableCache {
+		return 0, ErrCacheDisabled
 	}
 
-	snapshotData, err := json.Marshal(players)
+	data, err := s.redisRepo.LoadCacheSnapshot(ctx)
 	if err != nil {
-		s.logger.Error("Failed to marshal snapshot data", "error", err)
-		return
+		if err == repository.ErrNoSnapshot {
+			return 0, ErrNoSnapshot
+		}
+		return 0, err
 	}
 
-	if err := s.mysqlRepo.SaveLeaderboardSnapshot(ctx, snapshotData, len(players)); err != nil {
-		s.logger.Error("Failed to save leaderboard snapshot", "error", err)
-		return
+	var snapshot cache.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal cache snapshot: %w", err)
 	}
 
-	s.lastSnapshot = time.Now()
-	s.logger.Info("Leaderboard snapshot created", "playerCount", len(players))
+	imported := s.cache.Import(&snapshot)
+	s.logger.Info("Cache state imported",
+		"entries", imported,
+		"snapshotCreatedAt", snapshot.CreatedAt)
+	return imported, nil
 }
 
-// 健康检查
-func (s *LeaderboardService) healthCheck(ctx context.Context) {
-	if err := s.redisRepo.HealthCheck(ctx); err != nil {
-		s.logger.Error("Redis health check failed", "error", err)
+// BlockPlayers 封禁玩家，将其从排行榜中移除，之后的分数更新只记录到 MySQL
+func (s *LeaderboardService) BlockPlayers(ctx context.Context, playerIDs []string) error {
+	if err := s.redisRepo.BlockPlayers(ctx, playerIDs); err != nil {
+		return err
 	}
 
-	if err := s.mysqlRepo.HealthCheck(ctx); err != nil {
-		s.logger.Error("MySQL health check failed", "error", err)
-	}
+	s.invalidateCache(ctx, playerIDs...)
+	s.logger.Info("Players blocked", "count", len(playerIDs))
+	return nil
 }
 
-// CheckRedisHealth 检查 Redis 健康状态
-func (s *LeaderboardService) CheckRedisHealth(ctx context.Context) bool {
-	if err := s.redisRepo.HealthCheck(ctx); err != nil {
-		s.logger.Error("Redis health check failed", "error", err)
-		return false
+// UnblockPlayers 解除封禁，并以 MySQL 中的总分将玩家恢复到总榜（时间窗口排行榜不恢复）
+func (s *LeaderboardService) UnblockPlayers(ctx context.Context, playerIDs []string) error {
+	if err := s.redisRepo.UnblockPlayers(ctx, playerIDs); err != nil {
+		return err
 	}
-	return true
+
+	for _, playerID := range playerIDs {
+		player, err := s.mysqlRepo.GetPlayer(ctx, playerID)
+		if err != nil {
+			if err != repository.ErrPlayerNotFound {
+				s.logger.Warn("Failed to load unblocked player from mysql",
+					"playerID", playerID,
+					"error", err)
+			}
+			continue
+		}
+
+		if err := s.updateRedisWithRetry(ctx, player.ID, player.TotalScore, player.Name); err != nil {
+			s.logger.Warn("Failed to restore unblocked player to leaderboard",
+				"playerID", playerID,
+				"error", err)
+		}
+	}
+
+	s.invalidateCache(ctx, playerIDs...)
+	s.logger.Info("Players unblocked", "count", len(playerIDs))
+	return nil
 }
 
-// CheckMySQLHealth 检查 MySQL 健康状态
-func (s *LeaderboardService) CheckMySQLHealth(ctx context.Context) bool {
-	if err := s.mysqlRepo.HealthCheck(ctx); err != nil {
-		s.logger.Error("MySQL health check failed", "error", err)
-		return false
+// GetBlockedPlayers 获取所有被封禁的玩家ID
+func (s *LeaderboardService) GetBlockedPlayers(ctx context.Context) ([]string, error) {
+	return s.redisRepo.GetBlockedPlayers(ctx)
+}
+
+// 以集合形式返回被封禁的玩家
+func (s *LeaderboardService) blockedPlayerSet(ctx context.Context) (map[string]bool, error) {
+	playerIDs, err := s.redisRepo.GetBlockedPlayers(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return true
+
+	blocked := make(map[string]bool, len(playerIDs))
+	for _, playerID := range playerIDs {
+		blocked[playerID] = true
+	}
+	return blocked, nil
 }
 
-// GetCacheStats 获取缓存统计
-func (s *LeaderboardService) GetCacheStats() map[string]interface{} {
-	if s.cache != nil {
-		return s.cache.GetStats()
+// invalidateCache 清除指定玩家的排名缓存和所有前N名缓存（本地与 L2）
+func (s *LeaderboardService) invalidateCache(ctx context.Context, playerIDs ...string) {
+	// 排名或名称变化都可能影响实时前N名
+	s.live.markDirty()
+
+	if s.enableCache {
+		for _, playerID := range playerIDs {
+			s.cache.ClearPlayerRank(playerID)
+		}
+		s.cache.ClearTopN()
 	}
-	return map[string]interface{}{
-		"enabled": false,
+
+	if s.l2Cache != nil {
+		for _, playerID := range playerIDs {
+			if err := s.l2Cache.ClearPlayerRank(ctx, playerID); err != nil {
+				s.logger.Warn("Failed to clear l2 cache", "playerID", playerID, "error", err)
+			}
+		}
+		if err := s.l2Cache.ClearTopN(ctx); err != nil {
+			s.logger.Warn("Failed to clear l2 top-n cache", "error", err)
+		}
+	}
+}
+
+// 按排行榜的排名顺序，分数 a 是否排在 b 之前
+func (s *LeaderboardService) scoreAhead(a, b int64) bool {
+	if s.redisRepo.Ascending() {
+		return a < b
 	}
+	return a > b
 }
 
 // RebuildLeaderboard 从 MySQL 重建 Redis 排行榜（用于数据恢复）
 func (s *LeaderboardService) RebuildLeaderboard(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "service.RebuildLeaderboard")
+	defer span.End()
+
 	s.logger.Info("Starting leaderboard rebuild from MySQL")
 
 	players, err := s.mysqlRepo.GetAllPlayers(ctx)
@@ -369,15 +2542,64 @@ func (s *LeaderboardService) RebuildLeaderboard(ctx context.Context) error {
 		return fmt.Errorf("failed to get players from mysql: %w", err)
 	}
 
+	blocked, err := s.blockedPlayerSet(ctx)
+	if err != nil {
+		return err
+	}
+
 	// 批量更新 Redis
+	preserved := 0
 	for _, player := range players {
-		if err := s.redisRepo.UpdatePlayerScore(ctx, player.ID, player.TotalScore, player.Name); err != nil {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("leaderboard rebuild aborted: %w", err)
+		}
+
+		if blocked[player.ID] {
+			continue
+		}
+
+		score := player.TotalScore
+
+		// 保留 Redis 与 MySQL 中按排名顺序靠前的分数（升序榜为较低者），避免覆盖尚未持久化的更新
+		if s.rebuildPreserveMax {
+			redisFloat, err := s.redisRepo.GetPlayerScore(ctx, player.ID)
+			if err == nil {
+				redisScore, ok := utils.ScoreFromFloat(redisFloat)
+				if ok && s.scoreAhead(redisScore, score) {
+					score = redisScore
+					preserved++
+				}
+			} else if err != repository.ErrPlayerNotFound {
+				s.logger.Warn("Failed to get redis score during rebuild",
+					"playerID", player.ID,
+					"error", err)
+			}
+		}
+
+		if err := s.redisRepo.UpdatePlayerScore(ctx, player.ID, score, player.Name, player.UpdatedAt); err != nil {
 			s.logger.Warn("Failed to update player in redis during rebuild",
 				"playerID", player.ID,
 				"error", err)
 		}
 	}
 
-	s.logger.Info("Leaderboard rebuild completed", "playerCount", len(players))
+	// 逐个写入时已维护不同分数索引，这里整体重建以修正重建前可能存在的偏差
+	if _, err := s.redisRepo.RebuildScoreIndex(ctx, true); err != nil {
+		s.logger.Warn("Failed to rebuild score index after rebuild", "error", err)
+	}
+
+	if s.enableCache {
+		s.cache.Clear()
+	}
+	if s.l2Cache != nil {
+		if err := s.l2Cache.Clear(ctx); err != nil {
+			s.logger.Warn("Failed to clear l2 cache after rebuild", "error", err)
+		}
+	}
+	s.live.markDirty()
+
+	s.logger.Info("Leaderboard rebuild completed",
+		"playerCount", len(players),
+		"preservedRedisScores", preserved)
 	return nil
 }
@@ -0,0 +1,2214 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"game-leaderboard/internal/cache"
+	"game-leaderboard/internal/events"
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/repository"
+	"game-leaderboard/internal/repository/repotest"
+	"game-leaderboard/internal/repository/repotest/resp"
+	"game-leaderboard/pkg/utils"
+)
+
+// 基于内存存储的排行榜服务
+type testEnv struct {
+	svc   *LeaderboardService
+	redis *repotest.RedisStore
+	mysql *repotest.MySQLStore
+}
+
+// 创建使用内存存储的排行榜服务，rankOrder 为空时按分数从高到低排名；测试结束时关闭服务
+func newTestEnv(t testing.TB, rankOrder string, opts Options) *testEnv {
+	t.Helper()
+
+	env := &testEnv{
+		redis: repotest.NewRedisStore(false, rankOrder),
+		mysql: repotest.NewMySQLStore(opts.MaxScore),
+	}
+	env.svc = NewLeaderboardService(env.redis, env.mysql, opts)
+	t.Cleanup(env.svc.Close)
+	return env
+}
+
+// 在 MySQL 和 Redis 中写入相同的玩家分数，updatedAt 决定同分时的先后
+func (e *testEnv) seed(t testing.TB, playerID, name string, score int64, updatedAt time.Time) {
+	t.Helper()
+
+	e.mysql.AddPlayer(model.Player{ID: playerID, Name: name, TotalScore: score, UpdatedAt: updatedAt})
+	if err := e.redis.UpdatePlayerScore(context.Background(), playerID, score, name, updatedAt); err != nil {
+		t.Fatalf("seed %s: %v", playerID, err)
+	}
+}
+
+// 玩家在 MySQL 中的总分，不存在时测试失败
+func (e *testEnv) mysqlScore(t *testing.T, playerID string) int64 {
+	t.Helper()
+
+	player, ok := e.mysql.Player(playerID)
+	if !ok {
+		t.Fatalf("player %s not found in mysql", playerID)
+	}
+	return player.TotalScore
+}
+
+func TestUpdateScore(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		opts    Options
+		setup   func(t *testing.T, e *testEnv)
+		req     model.UpdateRequest
+		wantErr error
+
+		wantMySQL int64
+		wantRedis int64
+		onBoard   bool
+	}{
+		{
+			name:      "new player",
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 100},
+			wantMySQL: 100,
+			wantRedis: 100,
+			onBoard:   true,
+		},
+		{
+			name:      "increment existing player",
+			setup:     func(t *testing.T, e *testEnv) { e.seed(t, "p1", "alice", 50, past) },
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 30, Name: "alice"},
+			wantMySQL: 80,
+			wantRedis: 80,
+			onBoard:   true,
+		},
+		{
+			name:      "reason multiplier",
+			opts:      Options{ReasonMultipliers: map[string]float64{"boss": 2}},
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 10, Reason: "boss"},
+			wantMySQL: 20,
+			wantRedis: 20,
+			onBoard:   true,
+		},
+		{
+			name:      "zero multiplier only records history",
+			opts:      Options{ReasonMultipliers: map[string]float64{"practice": 0}},
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 10, Reason: "practice"},
+			wantMySQL: 0,
+		},
+		{
+			name:      "set absolute",
+			setup:     func(t *testing.T, e *testEnv) { e.seed(t, "p1", "alice", 500, past) },
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 120, SetAbsolute: true},
+			wantMySQL: 120,
+			wantRedis: 120,
+			onBoard:   true,
+		},
+		{
+			// 设置的分数与 MySQL 相同，也要修正不一致的 Redis 分数
+			name: "set absolute to the mysql total corrects diverged redis score",
+			setup: func(t *testing.T, e *testEnv) {
+				e.seed(t, "p1", "alice", 500, past)
+				e.redis.UpdatePlayerScore(context.Background(), "p1", 999, "alice", past)
+			},
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 500, SetAbsolute: true},
+			wantMySQL: 500,
+			wantRedis: 500,
+			onBoard:   true,
+		},
+		{
+			name: "update mode set overwrites diverged redis score",
+			opts: Options{UpdateMode: UpdateModeSet},
+			setup: func(t *testing.T, e *testEnv) {
+				e.seed(t, "p1", "alice", 50, past)
+				e.redis.UpdatePlayerScore(context.Background(), "p1", 999, "alice", past)
+			},
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 10},
+			wantMySQL: 60,
+			wantRedis: 60,
+			onBoard:   true,
+		},
+		{
+			name: "blocked player stays off the leaderboard",
+			setup: func(t *testing.T, e *testEnv) {
+				e.redis.BlockPlayers(context.Background(), []string{"p1"})
+			},
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 10},
+			wantMySQL: 10,
+		},
+		{
+			name: "redis increment failure falls back to absolute set",
+			setup: func(t *testing.T, e *testEnv) {
+				e.seed(t, "p1", "alice", 30, past)
+				e.redis.FailNext("IncrementPlayerScore", 1, nil)
+			},
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 10},
+			wantMySQL: 40,
+			wantRedis: 40,
+			onBoard:   true,
+		},
+		{
+			name: "redis sync failure keeps the mysql update",
+			setup: func(t *testing.T, e *testEnv) {
+				e.redis.FailNext("IncrementPlayerScore", 1, nil)
+				e.redis.FailNext("UpdatePlayerScore", -1, nil)
+			},
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 10},
+			wantErr:   ErrRedisSyncFailed,
+			wantMySQL: 10,
+		},
+		{
+			name:      "blocklist check failure",
+			setup:     func(t *testing.T, e *testEnv) { e.redis.FailNext("IsPlayerBlocked", 1, nil) },
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 10},
+			wantErr:   ErrRedisSyncFailed,
+			wantMySQL: 10,
+		},
+		{
+			name:    "mysql failure",
+			setup:   func(t *testing.T, e *testEnv) { e.mysql.FailNext("ApplyScoreChange", 1, nil) },
+			req:     model.UpdateRequest{PlayerID: "p1", IncrScore: 10},
+			wantErr: repotest.ErrInjected,
+		},
+		{
+			name:    "invalid player id",
+			req:     model.UpdateRequest{PlayerID: " ", IncrScore: 10},
+			wantErr: ErrInvalidPlayerID,
+		},
+		{
+			name:    "score change over the limit",
+			opts:    Options{MaxScore: 100},
+			req:     model.UpdateRequest{PlayerID: "p1", IncrScore: 101},
+			wantErr: ErrScoreOutOfRange,
+		},
+		{
+			name:      "total at the limit plus a positive increment",
+			opts:      Options{MaxScore: 1000},
+			setup:     func(t *testing.T, e *testEnv) { e.seed(t, "p1", "alice", 1000, past) },
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 1},
+			wantErr:   ErrScoreOutOfRange,
+			wantMySQL: 1000,
+			wantRedis: 1000,
+			onBoard:   true,
+		},
+		{
+			name:      "total at MaxInt64 plus a positive increment",
+			setup:     func(t *testing.T, e *testEnv) { e.seed(t, "p1", "alice", math.MaxInt64, past) },
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 1},
+			wantErr:   ErrScoreOutOfRange,
+			wantMySQL: math.MaxInt64,
+			wantRedis: math.MaxInt64,
+			onBoard:   true,
+		},
+		{
+			name:      "redis first total at MaxInt64 plus a positive increment",
+			opts:      Options{WriteMode: WriteModeRedisFirst},
+			setup:     func(t *testing.T, e *testEnv) { e.seed(t, "p1", "alice", math.MaxInt64, past) },
+			req:       model.UpdateRequest{PlayerID: "p1", IncrScore: 1},
+			wantErr:   ErrScoreOutOfRange,
+			wantMySQL: math.MaxInt64,
+			wantRedis: math.MaxInt64,
+			onBoard:   true,
+		},
+		{
+			name:    "ttl with set absolute",
+			req:     model.UpdateRequest{PlayerID: "p1", IncrScore: 10, SetAbsolute: true, TTLSeconds: 60},
+			wantErr: ErrInvalidTTL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, "", tt.opts)
+			if tt.setup != nil {
+				tt.setup(t, env)
+			}
+
+			err := env.svc.UpdateScore(context.Background(), tt.req)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("UpdateScore() = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateScore() = %v, want %v", err, tt.wantErr)
+			}
+
+			if _, ok := env.mysql.Player(tt.req.PlayerID); ok || tt.wantMySQL != 0 {
+				if got := env.mysqlScore(t, tt.req.PlayerID); got != tt.wantMySQL {
+					t.Errorf("mysql score = %d, want %d", got, tt.wantMySQL)
+				}
+			}
+
+			score, ok := env.redis.Score(tt.req.PlayerID)
+			if ok != tt.onBoard {
+				t.Fatalf("on leaderboard = %v, want %v", ok, tt.onBoard)
+			}
+			if ok && score != tt.wantRedis {
+				t.Errorf("redis score = %d, want %d", score, tt.wantRedis)
+			}
+		})
+	}
+}
+
+func TestCheckScoreBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		req     model.UpdateRequest
+		wantErr bool
+	}{
+		{name: "change at MaxScore", opts: Options{MaxScore: 1000}, req: model.UpdateRequest{IncrScore: 1000}},
+		{name: "change at MaxScore+1", opts: Options{MaxScore: 1000}, req: model.UpdateRequest{IncrScore: 1001}, wantErr: true},
+		{name: "negative change at -MaxScore", opts: Options{MaxScore: 1000}, req: model.UpdateRequest{IncrScore: -1000}},
+		{name: "negative change at -(MaxScore+1)", opts: Options{MaxScore: 1000}, req: model.UpdateRequest{IncrScore: -1001}, wantErr: true},
+		{name: "set to MaxScore", opts: Options{MaxScore: 1000}, req: model.UpdateRequest{IncrScore: 1000, SetAbsolute: true}},
+		{name: "set to MaxScore+1", opts: Options{MaxScore: 1000}, req: model.UpdateRequest{IncrScore: 1001, SetAbsolute: true}, wantErr: true},
+		{
+			name:    "multiplier pushes the change over MaxScore",
+			opts:    Options{MaxScore: 1000, ReasonMultipliers: map[string]float64{"boss": 2}},
+			req:     model.UpdateRequest{IncrScore: 501, Reason: "boss"},
+			wantErr: true,
+		},
+		{
+			name: "multiplier is not applied to set absolute",
+			opts: Options{MaxScore: 1000, ReasonMultipliers: map[string]float64{"boss": 2}},
+			req:  model.UpdateRequest{IncrScore: 1000, Reason: "boss", SetAbsolute: true},
+		},
+		{name: "default limit", req: model.UpdateRequest{IncrScore: utils.MaxExactScore}},
+		{name: "default limit+1", req: model.UpdateRequest{IncrScore: utils.MaxExactScore + 1}, wantErr: true},
+		{name: "MaxInt64 change", req: model.UpdateRequest{IncrScore: math.MaxInt64}, wantErr: true},
+		{name: "MinInt64 change", req: model.UpdateRequest{IncrScore: math.MinInt64}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, "", tt.opts)
+			err := env.svc.checkScoreBounds(tt.req)
+			if tt.wantErr && !errors.Is(err, ErrScoreOutOfRange) {
+				t.Fatalf("checkScoreBounds() = %v, want ErrScoreOutOfRange", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("checkScoreBounds() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestUpdateScoreRetriesRedisSync(t *testing.T) {
+	env := newTestEnv(t, "", Options{})
+	env.redis.FailNext("IncrementPlayerScore", 1, nil)
+	env.redis.FailNext("UpdatePlayerScore", -1, nil)
+
+	err := env.svc.UpdateScore(context.Background(), model.UpdateRequest{PlayerID: "p1", IncrScore: 10})
+	if !errors.Is(err, ErrRedisSyncFailed) {
+		t.Fatalf("UpdateScore() = %v, want %v", err, ErrRedisSyncFailed)
+	}
+	if got := env.redis.Calls("UpdatePlayerScore"); got != redisSyncMaxAttempts {
+		t.Errorf("UpdatePlayerScore called %d times, want %d", got, redisSyncMaxAttempts)
+	}
+	if history := env.mysql.History("p1"); len(history) != 1 {
+		t.Errorf("score history has %d entries, want 1", len(history))
+	}
+}
+
+func TestUpdateScoreIdempotent(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("same key twice changes the score once", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{})
+		req := model.UpdateRequest{PlayerID: "p1", IncrScore: 50, Name: "alice"}
+
+		first, replayed, err := env.svc.UpdateScoreIdempotent(ctx, "key-1", req)
+		if err != nil || replayed {
+			t.Fatalf("first UpdateScoreIdempotent() = replayed %v, error %v", replayed, err)
+		}
+		second, replayed, err := env.svc.UpdateScoreIdempotent(ctx, "key-1", req)
+		if err != nil || !replayed {
+			t.Fatalf("second UpdateScoreIdempotent() = replayed %v, error %v, want a replay", replayed, err)
+		}
+		if !second.Timestamp.Equal(first.Timestamp) || second.ScoreChange != 50 {
+			t.Errorf("replayed receipt = %+v, want the first receipt %+v", second, first)
+		}
+		if got := env.mysqlScore(t, "p1"); got != 50 {
+			t.Errorf("mysql score = %d, want 50", got)
+		}
+		if got := len(env.mysql.History("p1")); got != 1 {
+			t.Errorf("history entries = %d, want 1", got)
+		}
+	})
+
+	t.Run("key reused for another player", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{})
+		if _, _, err := env.svc.UpdateScoreIdempotent(ctx, "key-1", model.UpdateRequest{PlayerID: "p1", IncrScore: 50}); err != nil {
+			t.Fatalf("UpdateScoreIdempotent(p1) error = %v", err)
+		}
+
+		_, _, err := env.svc.UpdateScoreIdempotent(ctx, "key-1", model.UpdateRequest{PlayerID: "p2", IncrScore: 50})
+		if !errors.Is(err, ErrIdempotencyKeyReused) {
+			t.Fatalf("UpdateScoreIdempotent(p2) error = %v, want ErrIdempotencyKeyReused", err)
+		}
+		if _, ok := env.mysql.Player("p2"); ok {
+			t.Error("p2 written with a key that belongs to p1")
+		}
+	})
+
+	t.Run("key released after a failed update", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{})
+		req := model.UpdateRequest{PlayerID: "p1", IncrScore: 50}
+		env.mysql.FailNext("ApplyScoreChange", 1, nil)
+
+		if _, _, err := env.svc.UpdateScoreIdempotent(ctx, "key-1", req); !errors.Is(err, repotest.ErrInjected) {
+			t.Fatalf("first UpdateScoreIdempotent() error = %v, want the injected error", err)
+		}
+		if got := env.redis.Calls("ReleaseIdempotencyKey"); got != 1 {
+			t.Errorf("ReleaseIdempotencyKey calls = %d, want 1", got)
+		}
+
+		// 重试使用同一个键，作为首次提交处理
+		if _, replayed, err := env.svc.UpdateScoreIdempotent(ctx, "key-1", req); err != nil || replayed {
+			t.Fatalf("retried UpdateScoreIdempotent() = replayed %v, error %v", replayed, err)
+		}
+		if got := env.mysqlScore(t, "p1"); got != 50 {
+			t.Errorf("mysql score = %d, want 50", got)
+		}
+	})
+
+	t.Run("key kept when only the redis sync failed", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{})
+		req := model.UpdateRequest{PlayerID: "p1", IncrScore: 50}
+		env.redis.FailNext("IncrementPlayerScore", 1, nil)
+		env.redis.FailNext("UpdatePlayerScore", -1, nil)
+
+		if _, _, err := env.svc.UpdateScoreIdempotent(ctx, "key-1", req); !errors.Is(err, ErrRedisSyncFailed) {
+			t.Fatalf("first UpdateScoreIdempotent() error = %v, want ErrRedisSyncFailed", err)
+		}
+		if _, replayed, err := env.svc.UpdateScoreIdempotent(ctx, "key-1", req); err != nil || !replayed {
+			t.Fatalf("retried UpdateScoreIdempotent() = replayed %v, error %v, want a replay", replayed, err)
+		}
+		if got := env.mysqlScore(t, "p1"); got != 50 {
+			t.Errorf("mysql score = %d, want 50", got)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{})
+		for _, key := range []string{"  ", strings.Repeat("k", maxIdempotencyKeyLength+1)} {
+			if _, _, err := env.svc.UpdateScoreIdempotent(ctx, key, model.UpdateRequest{PlayerID: "p1", IncrScore: 1}); !errors.Is(err, ErrInvalidIdempotencyKey) {
+				t.Errorf("UpdateScoreIdempotent(%.10q) error = %v, want ErrInvalidIdempotencyKey", key, err)
+			}
+		}
+	})
+}
+
+func TestGetPlayerRank(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	seedBoard := func(t *testing.T, e *testEnv) {
+		e.seed(t, "p1", "alice", 300, base)
+		e.seed(t, "p2", "bob", 200, base)
+		e.seed(t, "p3", "carol", 200, base.Add(time.Second))
+		e.seed(t, "p4", "dave", 100, base)
+	}
+	redisDown := func(t *testing.T, e *testEnv) {
+		e.redis.FailNext("GetPlayerRankAndScore", -1, nil)
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		setup    func(t *testing.T, e *testEnv)
+		playerID string
+		method   string
+		wantErr  error
+
+		wantRank     int
+		wantScore    int64
+		wantName     string
+		wantStale    bool
+		wantFallback bool
+		wantApprox   bool
+	}{
+		{
+			name:     "live rank",
+			setup:    seedBoard,
+			playerID: "p3",
+			wantRank: 3, wantScore: 200, wantName: "carol",
+		},
+		{
+			name:     "dense rank",
+			setup:    seedBoard,
+			playerID: "p3",
+			method:   RankingDense,
+			wantRank: 2, wantScore: 200, wantName: "carol",
+		},
+		{
+			name:     "player not on the leaderboard",
+			setup:    seedBoard,
+			playerID: "p9",
+			wantErr:  ErrPlayerNotFound,
+		},
+		{
+			name: "on the leaderboard without a mysql record",
+			setup: func(t *testing.T, e *testEnv) {
+				e.redis.UpdatePlayerScore(context.Background(), "p1", 10, "", base)
+			},
+			playerID: "p1",
+			wantRank: 1, wantScore: 10,
+		},
+		{
+			name: "redis unavailable without fallback",
+			setup: func(t *testing.T, e *testEnv) {
+				seedBoard(t, e)
+				redisDown(t, e)
+			},
+			playerID: "p2",
+			wantErr:  repotest.ErrInjected,
+		},
+		{
+			name: "redis unavailable serves stale cache",
+			opts: Options{EnableCache: true, CacheSize: 10, CacheTTL: 10 * time.Millisecond, CacheMaxStale: time.Hour},
+			setup: func(t *testing.T, e *testEnv) {
+				seedBoard(t, e)
+				if _, err := e.svc.GetPlayerRank(context.Background(), "p2"); err != nil {
+					t.Fatalf("warm cache: %v", err)
+				}
+				time.Sleep(20 * time.Millisecond)
+				redisDown(t, e)
+			},
+			playerID: "p2",
+			wantRank: 2, wantScore: 200, wantName: "bob", wantStale: true,
+		},
+		{
+			name: "redis unavailable with cache past the max staleness",
+			opts: Options{EnableCache: true, CacheSize: 10, CacheTTL: 10 * time.Millisecond, CacheMaxStale: 10 * time.Millisecond},
+			setup: func(t *testing.T, e *testEnv) {
+				seedBoard(t, e)
+				if _, err := e.svc.GetPlayerRank(context.Background(), "p2"); err != nil {
+					t.Fatalf("warm cache: %v", err)
+				}
+				time.Sleep(40 * time.Millisecond)
+				redisDown(t, e)
+			},
+			playerID: "p2",
+			wantErr:  repotest.ErrInjected,
+		},
+		{
+			name: "redis unavailable reads from mysql",
+			opts: Options{DBFallbackReads: true},
+			setup: func(t *testing.T, e *testEnv) {
+				seedBoard(t, e)
+				redisDown(t, e)
+			},
+			playerID: "p3",
+			wantRank: 3, wantScore: 200, wantName: "carol", wantFallback: true,
+		},
+		{
+			name: "mysql fallback uses dense rank",
+			opts: Options{DBFallbackReads: true},
+			setup: func(t *testing.T, e *testEnv) {
+				seedBoard(t, e)
+				redisDown(t, e)
+			},
+			playerID: "p4",
+			method:   RankingDense,
+			wantRank: 3, wantScore: 100, wantName: "dave", wantFallback: true,
+		},
+		{
+			name: "mysql fallback for unknown player",
+			opts: Options{DBFallbackReads: true},
+			setup: func(t *testing.T, e *testEnv) {
+				seedBoard(t, e)
+				redisDown(t, e)
+			},
+			playerID: "p9",
+			wantErr:  ErrPlayerNotFound,
+		},
+		{
+			name: "precomputed rank",
+			opts: Options{PrecomputedRanks: true},
+			setup: func(t *testing.T, e *testEnv) {
+				seedBoard(t, e)
+				ctx := context.Background()
+				e.redis.WritePrecomputedRanks(ctx, "build", map[string]int{"p4": 7})
+				e.redis.PublishPrecomputedRanks(ctx, "build", base)
+			},
+			playerID: "p4",
+			wantRank: 7, wantScore: 100, wantName: "dave", wantApprox: true,
+		},
+		{
+			name: "player missing from precomputed ranks gets the live rank",
+			opts: Options{PrecomputedRanks: true},
+			setup: func(t *testing.T, e *testEnv) {
+				seedBoard(t, e)
+				ctx := context.Background()
+				e.redis.WritePrecomputedRanks(ctx, "build", map[string]int{"p4": 7})
+				e.redis.PublishPrecomputedRanks(ctx, "build", base)
+			},
+			playerID: "p1",
+			wantRank: 1, wantScore: 300, wantName: "alice",
+		},
+		{
+			name: "precomputed ranks are skipped for another ranking method",
+			opts: Options{PrecomputedRanks: true, RankingMethod: RankingStandard},
+			setup: func(t *testing.T, e *testEnv) {
+				seedBoard(t, e)
+				ctx := context.Background()
+				e.redis.WritePrecomputedRanks(ctx, "build", map[string]int{"p4": 7})
+				e.redis.PublishPrecomputedRanks(ctx, "build", base)
+			},
+			playerID: "p4",
+			method:   RankingDense,
+			wantRank: 3, wantScore: 100, wantName: "dave",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, "", tt.opts)
+			if tt.setup != nil {
+				tt.setup(t, env)
+			}
+
+			ctx, err := WithRankingMethod(context.Background(), tt.method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := env.svc.GetPlayerRank(ctx, tt.playerID)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetPlayerRank() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPlayerRank() error = %v", err)
+			}
+
+			if got.Rank != tt.wantRank || got.Score != tt.wantScore || got.Name != tt.wantName {
+				t.Errorf("GetPlayerRank() = rank %d score %d name %q, want rank %d score %d name %q",
+					got.Rank, got.Score, got.Name, tt.wantRank, tt.wantScore, tt.wantName)
+			}
+			if got.Stale != tt.wantStale || got.Fallback != tt.wantFallback || got.Approximate != tt.wantApprox {
+				t.Errorf("GetPlayerRank() stale=%v fallback=%v approximate=%v, want %v %v %v",
+					got.Stale, got.Fallback, got.Approximate, tt.wantStale, tt.wantFallback, tt.wantApprox)
+			}
+		})
+	}
+}
+
+// Redis 不可用时，过期不超过 CacheMaxStale 的前N名缓存标记为 stale 返回，超过后返回 Redis 的错误
+func TestGetTopNServesStaleCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxStale  time.Duration
+		wantErr   error
+		wantStale bool
+	}{
+		{name: "within the max staleness", maxStale: time.Hour, wantStale: true},
+		{name: "past the max staleness", maxStale: 10 * time.Millisecond, wantErr: repotest.ErrInjected},
+		{name: "stale reads disabled", wantErr: repotest.ErrInjected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t, "", Options{EnableCache: true, CacheSize: 10, CacheTTL: 10 * time.Millisecond, CacheMaxStale: tt.maxStale})
+			env.seed(t, "p1", "alice", 300, time.Now().Add(-time.Hour))
+			env.seed(t, "p2", "bob", 200, time.Now().Add(-time.Hour))
+
+			if _, err := env.svc.GetTopN(ctx, 2); err != nil {
+				t.Fatalf("warm cache: %v", err)
+			}
+			time.Sleep(40 * time.Millisecond)
+			env.redis.FailNext("GetTopPlayers", -1, nil)
+
+			got, err := env.svc.GetTopN(ctx, 2)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetTopN() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetTopN() error = %v", err)
+			}
+			if len(got) != 2 {
+				t.Fatalf("GetTopN() = %d entries, want 2", len(got))
+			}
+			if got[0].PlayerID != "p1" || got[0].Stale != tt.wantStale {
+				t.Errorf("GetTopN()[0] = %s stale=%v, want p1 stale=%v", got[0].PlayerID, got[0].Stale, tt.wantStale)
+			}
+		})
+	}
+}
+
+// 排名和分数来自同一次 GetPlayerRankAndScore 调用，找不到玩家时只有一条路径
+func TestGetPlayerRankReadsRankAndScoreTogether(t *testing.T) {
+	tests := []struct {
+		name     string
+		playerID string
+		wantRank int
+		wantErr  error
+	}{
+		{name: "ranked", playerID: "p2", wantRank: 2},
+		{name: "not found", playerID: "p9", wantErr: ErrPlayerNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, "", Options{})
+			env.seed(t, "p1", "alice", 300, time.Now())
+			env.seed(t, "p2", "bob", 200, time.Now())
+
+			got, err := env.svc.GetPlayerRank(context.Background(), tt.playerID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetPlayerRank() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Rank != tt.wantRank || got.Score != 200) {
+				t.Errorf("GetPlayerRank() = rank %d score %d, want rank %d score 200", got.Rank, got.Score, tt.wantRank)
+			}
+
+			if calls := env.redis.Calls("GetPlayerRankAndScore"); calls != 1 {
+				t.Errorf("GetPlayerRankAndScore calls = %d, want 1", calls)
+			}
+			if calls := env.redis.Calls("GetPlayerRank") + env.redis.Calls("GetPlayerScore"); calls != 0 {
+				t.Errorf("separate rank/score reads = %d, want 0", calls)
+			}
+		})
+	}
+}
+
+func TestNamesResolveFromMySQL(t *testing.T) {
+	tests := []struct {
+		name          string
+		storeMetadata bool
+		wantLookups   int
+	}{
+		{name: "metadata in redis", storeMetadata: true, wantLookups: 0},
+		{name: "metadata in mysql", storeMetadata: false, wantLookups: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redis := repotest.NewRedisStore(tt.storeMetadata, "")
+			mysql := repotest.NewMySQLStore(0)
+			svc := NewLeaderboardService(redis, mysql, Options{})
+			t.Cleanup(svc.Close)
+
+			ctx := context.Background()
+			for _, req := range []model.UpdateRequest{
+				{PlayerID: "p1", IncrScore: 300, Name: "alice"},
+				{PlayerID: "p2", IncrScore: 200, Name: "bob"},
+				{PlayerID: "p3", IncrScore: 100, Name: "carol"},
+			} {
+				if err := svc.UpdateScore(ctx, req); err != nil {
+					t.Fatalf("UpdateScore(%s) error = %v", req.PlayerID, err)
+				}
+			}
+
+			got, err := svc.GetTopN(ctx, 3)
+			if err != nil {
+				t.Fatalf("GetTopN() error = %v", err)
+			}
+			want := []string{"alice", "bob", "carol"}
+			if len(got) != len(want) {
+				t.Fatalf("GetTopN() returned %d players, want %d", len(got), len(want))
+			}
+			for i, rankInfo := range got {
+				if rankInfo.Name != want[i] {
+					t.Errorf("rank %d name = %q, want %q", i+1, rankInfo.Name, want[i])
+				}
+			}
+			if calls := mysql.Calls("GetPlayerNames"); calls != tt.wantLookups {
+				t.Errorf("GetPlayerNames calls = %d, want %d", calls, tt.wantLookups)
+			}
+		})
+	}
+}
+
+// 排名列表中的玩家ID，用于错误信息
+func topIDs(rankings []*model.RankInfo) string {
+	ids := make([]string, 0, len(rankings))
+	for _, rankInfo := range rankings {
+		ids = append(ids, rankInfo.PlayerID)
+	}
+	return "[" + strings.Join(ids, " ") + "]"
+}
+
+// 多实例部署：各实例有独立的本地缓存，共用 Redis、MySQL 和 L2 缓存
+func TestL2Cache(t *testing.T) {
+	redis := repotest.NewRedisStore(false, "")
+	mysql := repotest.NewMySQLStore(0)
+	server := resp.NewServer(resp.NewMemory().Respond)
+	client := server.NewClient()
+	t.Cleanup(func() { client.Close() })
+	l2 := cache.NewRedisCache(client, time.Minute)
+
+	newInstance := func() *LeaderboardService {
+		svc := NewLeaderboardService(redis, mysql, Options{EnableCache: true, CacheSize: 100, CacheTTL: time.Minute, L2Cache: l2})
+		t.Cleanup(svc.Close)
+		return svc
+	}
+	a, b, c := newInstance(), newInstance(), newInstance()
+
+	ctx := context.Background()
+	for _, req := range []model.UpdateRequest{
+		{PlayerID: "p1", IncrScore: 300, Name: "alice"},
+		{PlayerID: "p2", IncrScore: 200, Name: "bob"},
+	} {
+		if err := a.UpdateScore(ctx, req); err != nil {
+			t.Fatalf("UpdateScore(%s) error = %v", req.PlayerID, err)
+		}
+	}
+
+	// A 计算后写入 L2，B 本地未命中时直接读取 L2，不再查询排行榜
+	if _, err := a.GetPlayerRank(ctx, "p2"); err != nil {
+		t.Fatalf("GetPlayerRank() error = %v", err)
+	}
+	if _, err := a.GetTopN(ctx, 2); err != nil {
+		t.Fatalf("GetTopN() error = %v", err)
+	}
+	rankReads, topReads := redis.Calls("GetPlayerRankAndScore"), redis.Calls("GetTopPlayers")
+
+	rankInfo, err := b.GetPlayerRank(ctx, "p2")
+	if err != nil {
+		t.Fatalf("GetPlayerRank() error = %v", err)
+	}
+	if rankInfo.Rank != 2 || rankInfo.Score != 200 {
+		t.Errorf("GetPlayerRank() from l2 = rank %d score %d, want rank 2 score 200", rankInfo.Rank, rankInfo.Score)
+	}
+	top, err := b.GetTopN(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetTopN() error = %v", err)
+	}
+	if len(top) != 2 || top[0].PlayerID != "p1" {
+		t.Errorf("GetTopN() from l2 = %s, want p1 first", topIDs(top))
+	}
+	if got := redis.Calls("GetPlayerRankAndScore"); got != rankReads {
+		t.Errorf("GetPlayerRankAndScore calls after l2 hit = %d, want %d", got, rankReads)
+	}
+	if got := redis.Calls("GetTopPlayers"); got != topReads {
+		t.Errorf("GetTopPlayers calls after l2 hit = %d, want %d", got, topReads)
+	}
+
+	// B 更新分数后清除 L2，C 读到的是新的排名而不是 L2 中的旧值
+	if err := b.UpdateScore(ctx, model.UpdateRequest{PlayerID: "p2", IncrScore: 200, Name: "bob"}); err != nil {
+		t.Fatalf("UpdateScore() error = %v", err)
+	}
+
+	rankInfo, err = c.GetPlayerRank(ctx, "p2")
+	if err != nil {
+		t.Fatalf("GetPlayerRank() error = %v", err)
+	}
+	if rankInfo.Rank != 1 || rankInfo.Score != 400 {
+		t.Errorf("GetPlayerRank() after update = rank %d score %d, want rank 1 score 400", rankInfo.Rank, rankInfo.Score)
+	}
+	top, err = c.GetTopN(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetTopN() error = %v", err)
+	}
+	if len(top) != 2 || top[0].PlayerID != "p2" {
+		t.Errorf("GetTopN() after update = %s, want p2 first", topIDs(top))
+	}
+}
+
+func TestCacheDisabledEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled []string
+		// 两次查询读取排行榜的次数，缓存生效时第二次命中缓存
+		wantRankReads, wantTopReads int
+	}{
+		{name: "all cached", wantRankReads: 1, wantTopReads: 1},
+		{name: "rank disabled", disabled: []string{CacheEndpointRank}, wantRankReads: 2, wantTopReads: 1},
+		{name: "top disabled", disabled: []string{CacheEndpointTopN}, wantRankReads: 1, wantTopReads: 2},
+		{name: "both disabled", disabled: []string{CacheEndpointRank, CacheEndpointTopN}, wantRankReads: 2, wantTopReads: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := resp.NewServer(resp.NewMemory().Respond)
+			client := server.NewClient()
+			t.Cleanup(func() { client.Close() })
+
+			env := newTestEnv(t, "", Options{
+				EnableCache:            true,
+				CacheSize:              100,
+				CacheTTL:               time.Minute,
+				L2Cache:                cache.NewRedisCache(client, time.Minute),
+				CacheDisabledEndpoints: tt.disabled,
+			})
+			env.seed(t, "p1", "alice", 300, time.Now())
+			env.seed(t, "p2", "bob", 200, time.Now())
+
+			ctx := context.Background()
+			for i := 0; i < 2; i++ {
+				if _, err := env.svc.GetPlayerRank(ctx, "p2"); err != nil {
+					t.Fatalf("GetPlayerRank() error = %v", err)
+				}
+				if _, err := env.svc.GetTopN(ctx, 2); err != nil {
+					t.Fatalf("GetTopN() error = %v", err)
+				}
+			}
+
+			if got := env.redis.Calls("GetPlayerRankAndScore"); got != tt.wantRankReads {
+				t.Errorf("rank reads = %d, want %d", got, tt.wantRankReads)
+			}
+			if got := env.redis.Calls("GetTopPlayers"); got != tt.wantTopReads {
+				t.Errorf("top reads = %d, want %d", got, tt.wantTopReads)
+			}
+
+			// 关闭缓存的接口也不写入 L2，排名写 HSET，前N名写 SET
+			if got, want := server.CommandCount("HSET") > 0, tt.wantRankReads == 1; got != want {
+				t.Errorf("rank written to l2 = %v, want %v", got, want)
+			}
+			if got, want := server.CommandCount("SET") > 0, tt.wantTopReads == 1; got != want {
+				t.Errorf("top written to l2 = %v, want %v", got, want)
+			}
+			wantSize := 0
+			if tt.wantRankReads == 1 {
+				wantSize++
+			}
+			if tt.wantTopReads == 1 {
+				wantSize++
+			}
+			if got := env.svc.cache.Stats().Size; got != wantSize {
+				t.Errorf("local cache size = %d, want %d", got, wantSize)
+			}
+		})
+	}
+}
+
+func TestGetFilteredRank(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	players := []struct {
+		id    string
+		score int64
+		attrs model.PlayerAttributes
+	}{
+		{"p1", 900, model.PlayerAttributes{Country: "US", Level: 50}},
+		{"p2", 800, model.PlayerAttributes{Country: "JP", Level: 40}},
+		{"p3", 700, model.PlayerAttributes{Country: "JP", Level: 10}},
+		{"p4", 700, model.PlayerAttributes{Country: "JP", Level: 30}},
+		{"p5", 600, model.PlayerAttributes{Country: "JP", Level: 20}},
+		{"p6", 500, model.PlayerAttributes{Country: "US", Level: 20}},
+	}
+
+	tests := []struct {
+		name         string
+		playerID     string
+		filter       model.PlayerFilter
+		method       string
+		blocked      []string
+		wantRank     int64
+		wantTotal    int64
+		wantInSubset bool
+		wantErr      error
+	}{
+		{name: "first in country", playerID: "p2", filter: model.PlayerFilter{Country: "JP"}, wantRank: 1, wantTotal: 4, wantInSubset: true},
+		{name: "tie goes to the earlier update", playerID: "p4", filter: model.PlayerFilter{Country: "JP"}, wantRank: 3, wantTotal: 4, wantInSubset: true},
+		{name: "last in country", playerID: "p5", filter: model.PlayerFilter{Country: "JP"}, wantRank: 4, wantTotal: 4, wantInSubset: true},
+		{name: "dense rank shares the tied score", playerID: "p5", filter: model.PlayerFilter{Country: "JP"}, method: RankingDense, wantRank: 3, wantTotal: 4, wantInSubset: true},
+		{name: "country and level range", playerID: "p5", filter: model.PlayerFilter{Country: "JP", MinLevel: 15, MaxLevel: 35}, wantRank: 2, wantTotal: 2, wantInSubset: true},
+		{name: "blocked players leave the subset", playerID: "p5", filter: model.PlayerFilter{Country: "JP"}, blocked: []string{"p2"}, wantRank: 3, wantTotal: 3, wantInSubset: true},
+		{name: "player outside the subset", playerID: "p6", filter: model.PlayerFilter{Country: "JP"}, wantRank: 5, wantTotal: 4, wantInSubset: false},
+		{name: "empty filter", playerID: "p2", wantErr: ErrInvalidFilter},
+		{name: "inverted level range", playerID: "p2", filter: model.PlayerFilter{MinLevel: 30, MaxLevel: 10}, wantErr: ErrInvalidFilter},
+		{name: "blocked player", playerID: "p2", filter: model.PlayerFilter{Country: "JP"}, blocked: []string{"p2"}, wantErr: ErrPlayerNotFound},
+		{name: "unknown player", playerID: "ghost", filter: model.PlayerFilter{Country: "JP"}, wantErr: ErrPlayerNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, "", Options{})
+			ctx := context.Background()
+			for i, player := range players {
+				// p3 比 p4 更早达到 700 分
+				env.seed(t, player.id, player.id, player.score, base.Add(time.Duration(i)*time.Minute))
+				if err := env.svc.SetPlayerAttributes(ctx, player.id, player.attrs); err != nil {
+					t.Fatalf("SetPlayerAttributes(%s) error = %v", player.id, err)
+				}
+			}
+			if len(tt.blocked) > 0 {
+				if err := env.svc.BlockPlayers(ctx, tt.blocked); err != nil {
+					t.Fatalf("BlockPlayers() error = %v", err)
+				}
+			}
+			if tt.method != "" {
+				var err error
+				if ctx, err = WithRankingMethod(ctx, tt.method); err != nil {
+					t.Fatalf("WithRankingMethod() error = %v", err)
+				}
+			}
+
+			rankInfo, err := env.svc.GetFilteredRank(ctx, tt.playerID, tt.filter)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetFilteredRank() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetFilteredRank() error = %v", err)
+			}
+			if rankInfo.Rank != tt.wantRank || rankInfo.Total != tt.wantTotal || rankInfo.InSubset != tt.wantInSubset {
+				t.Errorf("GetFilteredRank() = rank %d of %d, inSubset %v, want rank %d of %d, inSubset %v",
+					rankInfo.Rank, rankInfo.Total, rankInfo.InSubset, tt.wantRank, tt.wantTotal, tt.wantInSubset)
+			}
+		})
+	}
+}
+
+func TestCacheStateExportImport(t *testing.T) {
+	env := newTestEnv(t, "", Options{EnableCache: true, CacheSize: 100, CacheTTL: time.Minute})
+	env.seed(t, "p1", "alice", 300, time.Now())
+	env.seed(t, "p2", "bob", 200, time.Now())
+
+	ctx := context.Background()
+	if _, err := env.svc.ImportCacheState(ctx); !errors.Is(err, ErrNoSnapshot) {
+		t.Fatalf("ImportCacheState() before export error = %v, want ErrNoSnapshot", err)
+	}
+
+	// 预热缓存后导出
+	if _, err := env.svc.GetPlayerRank(ctx, "p2"); err != nil {
+		t.Fatalf("GetPlayerRank() error = %v", err)
+	}
+	if _, err := env.svc.GetTopN(ctx, 2); err != nil {
+		t.Fatalf("GetTopN() error = %v", err)
+	}
+	exported, err := env.svc.ExportCacheState(ctx)
+	if err != nil {
+		t.Fatalf("ExportCacheState() error = %v", err)
+	}
+	if exported != 2 {
+		t.Errorf("ExportCacheState() = %d entries, want 2", exported)
+	}
+
+	if _, _, err := env.svc.FlushCache(ctx, ""); err != nil {
+		t.Fatalf("FlushCache() error = %v", err)
+	}
+	imported, err := env.svc.ImportCacheState(ctx)
+	if err != nil {
+		t.Fatalf("ImportCacheState() error = %v", err)
+	}
+	if imported != exported {
+		t.Errorf("ImportCacheState() = %d entries, want %d", imported, exported)
+	}
+
+	// 恢复后的读取直接由缓存返回，不再查询排行榜
+	rankReads, topReads := env.redis.Calls("GetPlayerRankAndScore"), env.redis.Calls("GetTopPlayers")
+	rankInfo, err := env.svc.GetPlayerRank(ctx, "p2")
+	if err != nil {
+		t.Fatalf("GetPlayerRank() error = %v", err)
+	}
+	if rankInfo.Rank != 2 || rankInfo.Score != 200 || rankInfo.Name != "bob" {
+		t.Errorf("GetPlayerRank() = %s rank %d score %d, want bob rank 2 score 200", rankInfo.Name, rankInfo.Rank, rankInfo.Score)
+	}
+	top, err := env.svc.GetTopN(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetTopN() error = %v", err)
+	}
+	if got := topIDs(top); got != "[p1 p2]" {
+		t.Errorf("GetTopN() = %s, want [p1 p2]", got)
+	}
+	if got := env.redis.Calls("GetPlayerRankAndScore"); got != rankReads {
+		t.Errorf("GetPlayerRankAndScore calls after import = %d, want %d", got, rankReads)
+	}
+	if got := env.redis.Calls("GetTopPlayers"); got != topReads {
+		t.Errorf("GetTopPlayers calls after import = %d, want %d", got, topReads)
+	}
+}
+
+func TestPrecomputedRanks(t *testing.T) {
+	env := newTestEnv(t, "", Options{PrecomputedRanks: true, RankRefreshInterval: time.Hour})
+	env.seed(t, "p1", "alice", 300, time.Now())
+	env.seed(t, "p2", "bob", 200, time.Now())
+	ctx := context.Background()
+
+	// 尚未计算时回退到实时排名
+	rankInfo, err := env.svc.GetPlayerRank(ctx, "p2")
+	if err != nil {
+		t.Fatalf("GetPlayerRank() error = %v", err)
+	}
+	if rankInfo.Approximate || rankInfo.Rank != 2 {
+		t.Errorf("GetPlayerRank() before refresh = rank %d approximate %v, want live rank 2", rankInfo.Rank, rankInfo.Approximate)
+	}
+
+	env.svc.refreshPrecomputedRanks(ctx)
+	liveReads := env.redis.Calls("GetPlayerRankAndScore")
+
+	// 分数变化后，刷新前仍返回上次计算的排名
+	if err := env.redis.UpdatePlayerScore(ctx, "p2", 500, "bob", time.Now()); err != nil {
+		t.Fatalf("UpdatePlayerScore() error = %v", err)
+	}
+	rankInfo, err = env.svc.GetPlayerRank(ctx, "p2")
+	if err != nil {
+		t.Fatalf("GetPlayerRank() error = %v", err)
+	}
+	if !rankInfo.Approximate || rankInfo.RankComputedAt == nil || rankInfo.Rank != 2 || rankInfo.Score != 500 {
+		t.Errorf("GetPlayerRank() after refresh = rank %d score %d approximate %v, want precomputed rank 2 score 500",
+			rankInfo.Rank, rankInfo.Score, rankInfo.Approximate)
+	}
+	if got := env.redis.Calls("GetPlayerRankAndScore"); got != liveReads {
+		t.Errorf("GetPlayerRankAndScore calls = %d, want %d", got, liveReads)
+	}
+	env.svc.refreshPrecomputedRanks(ctx)
+	rankInfo, err = env.svc.GetPlayerRank(ctx, "p2")
+	if err != nil {
+		t.Fatalf("GetPlayerRank() error = %v", err)
+	}
+	if !rankInfo.Approximate || rankInfo.Rank != 1 {
+		t.Errorf("GetPlayerRank() after second refresh = rank %d approximate %v, want precomputed rank 1", rankInfo.Rank, rankInfo.Approximate)
+	}
+
+	// 按请求指定其他排名方式时实时计算
+	denseCtx, err := WithRankingMethod(ctx, RankingDense)
+	if err != nil {
+		t.Fatalf("WithRankingMethod() error = %v", err)
+	}
+	rankInfo, err = env.svc.GetPlayerRank(denseCtx, "p1")
+	if err != nil {
+		t.Fatalf("GetPlayerRank() error = %v", err)
+	}
+	if rankInfo.Approximate || rankInfo.Rank != 2 {
+		t.Errorf("GetPlayerRank() dense = rank %d approximate %v, want live rank 2", rankInfo.Rank, rankInfo.Approximate)
+	}
+}
+
+func TestGetCohortStats(t *testing.T) {
+	env := newTestEnv(t, "", Options{})
+	for i := 1; i <= 25; i++ {
+		env.seed(t, fmt.Sprintf("p%02d", i), "", int64(1000-i), time.Now())
+	}
+
+	stats, err := env.svc.GetCohortStats(context.Background(), []string{"p01", "p05", "p13", "p25", "p05", "ghost"})
+	if err != nil {
+		t.Fatalf("GetCohortStats() error = %v", err)
+	}
+
+	if stats.Requested != 5 || stats.Ranked != 4 || stats.Unranked != 1 || stats.BoardSize != 25 {
+		t.Errorf("counts = requested %d ranked %d unranked %d size %d, want 5/4/1/25",
+			stats.Requested, stats.Ranked, stats.Unranked, stats.BoardSize)
+	}
+	if stats.MinRank != 1 || stats.MaxRank != 25 || stats.MedianRank != 9 {
+		t.Errorf("ranks = min %d max %d median %v, want 1/25/9", stats.MinRank, stats.MaxRank, stats.MedianRank)
+	}
+
+	// 25 名按每段 3 个名次分为 9 段，最后一段只有第 25 名
+	if len(stats.Histogram) != 9 {
+		t.Fatalf("histogram has %d buckets, want 9", len(stats.Histogram))
+	}
+	wantCounts := map[int]int{0: 1, 1: 1, 4: 1, 8: 1}
+	for i, bucket := range stats.Histogram {
+		if bucket.FromRank != int64(i*3+1) || bucket.ToRank != min(int64(i*3+3), 25) {
+			t.Errorf("bucket %d = [%d, %d], want [%d, %d]", i, bucket.FromRank, bucket.ToRank, i*3+1, min(i*3+3, 25))
+		}
+		if bucket.Count != wantCounts[i] {
+			t.Errorf("bucket %d count = %d, want %d", i, bucket.Count, wantCounts[i])
+		}
+	}
+
+	if calls := env.redis.Calls("GetPlayerRanks"); calls != 1 {
+		t.Errorf("GetPlayerRanks calls = %d, want 1", calls)
+	}
+}
+
+func TestBatchUpdateScores(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	type want struct {
+		success    bool
+		finalScore int64
+		errMatch   string
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		setup   func(t *testing.T, e *testEnv)
+		updates []model.UpdateRequest
+		want    []want
+
+		// 期望的 Redis 总榜分数，值为 -1 表示不在榜上
+		wantRedis map[string]int64
+	}{
+		{
+			name:  "independent results in request order",
+			opts:  Options{MaxScore: 1000},
+			setup: func(t *testing.T, e *testEnv) { e.seed(t, "p2", "bob", 40, past) },
+			updates: []model.UpdateRequest{
+				{PlayerID: "p1", IncrScore: 10},
+				{PlayerID: "", IncrScore: 10},
+				{PlayerID: "p2", IncrScore: 5},
+				{PlayerID: "p3", IncrScore: 5000},
+				{PlayerID: "p4", IncrScore: 70, SetAbsolute: true},
+			},
+			want: []want{
+				{success: true, finalScore: 10},
+				{errMatch: "playerId cannot be empty"},
+				{success: true, finalScore: 45},
+				{errMatch: ErrScoreOutOfRange.Error()},
+				{success: true, finalScore: 70},
+			},
+			wantRedis: map[string]int64{"p1": 10, "p2": 45, "p3": -1, "p4": 70},
+		},
+		{
+			name: "repeated player keeps the last total",
+			updates: []model.UpdateRequest{
+				{PlayerID: "p1", IncrScore: 10},
+				{PlayerID: "p1", IncrScore: 15},
+			},
+			want: []want{
+				{success: true, finalScore: 10},
+				{success: true, finalScore: 25},
+			},
+			wantRedis: map[string]int64{"p1": 25},
+		},
+		{
+			// 设置的分数与 MySQL 相同，也要修正不一致的 Redis 分数
+			name: "set absolute to the mysql total corrects diverged redis score",
+			setup: func(t *testing.T, e *testEnv) {
+				e.seed(t, "p1", "alice", 40, past)
+				e.redis.UpdatePlayerScore(context.Background(), "p1", 999, "alice", past)
+			},
+			updates:   []model.UpdateRequest{{PlayerID: "p1", IncrScore: 40, SetAbsolute: true}},
+			want:      []want{{success: true, finalScore: 40}},
+			wantRedis: map[string]int64{"p1": 40},
+		},
+		{
+			name: "blocked player is only recorded in mysql",
+			setup: func(t *testing.T, e *testEnv) {
+				e.redis.BlockPlayers(context.Background(), []string{"p2"})
+			},
+			updates: []model.UpdateRequest{
+				{PlayerID: "p1", IncrScore: 10},
+				{PlayerID: "p2", IncrScore: 20},
+			},
+			want: []want{
+				{success: true, finalScore: 10},
+				{success: true, finalScore: 20},
+			},
+			wantRedis: map[string]int64{"p1": 10, "p2": -1},
+		},
+		{
+			name: "blocked player left on the leaderboard is removed",
+			setup: func(t *testing.T, e *testEnv) {
+				e.redis.BlockPlayers(context.Background(), []string{"p2"})
+				e.seed(t, "p2", "bob", 40, past)
+			},
+			updates:   []model.UpdateRequest{{PlayerID: "p2", IncrScore: 20}},
+			want:      []want{{success: true, finalScore: 60}},
+			wantRedis: map[string]int64{"p2": -1},
+		},
+		{
+			name: "increments keep concurrent redis changes",
+			setup: func(t *testing.T, e *testEnv) {
+				e.seed(t, "p1", "alice", 50, past)
+				// 另一个请求已累加到 Redis、尚未反映在本批次读取的 MySQL 总分中
+				e.redis.UpdatePlayerScore(context.Background(), "p1", 80, "alice", past)
+			},
+			updates: []model.UpdateRequest{
+				{PlayerID: "p1", IncrScore: 10},
+				{PlayerID: "p2", IncrScore: 5},
+			},
+			want: []want{
+				{success: true, finalScore: 60},
+				{success: true, finalScore: 5},
+			},
+			wantRedis: map[string]int64{"p1": 90, "p2": 5},
+		},
+		{
+			name: "update mode set overwrites with the mysql total",
+			opts: Options{UpdateMode: UpdateModeSet},
+			setup: func(t *testing.T, e *testEnv) {
+				e.seed(t, "p1", "alice", 50, past)
+				e.redis.UpdatePlayerScore(context.Background(), "p1", 80, "alice", past)
+			},
+			updates:   []model.UpdateRequest{{PlayerID: "p1", IncrScore: 10}},
+			want:      []want{{success: true, finalScore: 60}},
+			wantRedis: map[string]int64{"p1": 60},
+		},
+		{
+			name:  "pipeline failure retried per player",
+			setup: func(t *testing.T, e *testEnv) { e.redis.FailNext("WritePlayerScores", 1, nil) },
+			updates: []model.UpdateRequest{
+				{PlayerID: "p1", IncrScore: 10},
+				{PlayerID: "p2", IncrScore: 20},
+			},
+			want: []want{
+				{success: true, finalScore: 10},
+				{success: true, finalScore: 20},
+			},
+			wantRedis: map[string]int64{"p1": 10, "p2": 20},
+		},
+		{
+			name: "redis sync failure marks the update as failed",
+			setup: func(t *testing.T, e *testEnv) {
+				e.redis.FailNext("WritePlayerScores", 1, nil)
+				e.redis.FailNext("UpdatePlayerScore", -1, nil)
+			},
+			updates: []model.UpdateRequest{{PlayerID: "p1", IncrScore: 10}},
+			want: []want{
+				{finalScore: 10, errMatch: ErrRedisSyncFailed.Error()},
+			},
+			wantRedis: map[string]int64{"p1": -1},
+		},
+		{
+			name:    "blocklist unavailable",
+			setup:   func(t *testing.T, e *testEnv) { e.redis.FailNext("GetBlockedPlayers", 1, nil) },
+			updates: []model.UpdateRequest{{PlayerID: "p1", IncrScore: 10}},
+			want: []want{
+				{finalScore: 10, errMatch: ErrRedisSyncFailed.Error()},
+			},
+			wantRedis: map[string]int64{"p1": -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, "", tt.opts)
+			if tt.setup != nil {
+				tt.setup(t, env)
+			}
+
+			results := env.svc.BatchUpdateScores(context.Background(), tt.updates)
+			if len(results) != len(tt.want) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.want))
+			}
+			for i, w := range tt.want {
+				got := results[i]
+				if got.PlayerID != tt.updates[i].PlayerID {
+					t.Errorf("results[%d].PlayerID = %q, want %q", i, got.PlayerID, tt.updates[i].PlayerID)
+				}
+				if got.Success != w.success || got.FinalScore != w.finalScore {
+					t.Errorf("results[%d] = success %v final %d, want success %v final %d",
+						i, got.Success, got.FinalScore, w.success, w.finalScore)
+				}
+				if w.errMatch != "" && !strings.Contains(got.Error, w.errMatch) {
+					t.Errorf("results[%d].Error = %q, want it to contain %q", i, got.Error, w.errMatch)
+				}
+			}
+
+			for playerID, want := range tt.wantRedis {
+				score, ok := env.redis.Score(playerID)
+				switch {
+				case want < 0 && ok:
+					t.Errorf("%s is on the leaderboard with %d, want absent", playerID, score)
+				case want >= 0 && (!ok || score != want):
+					t.Errorf("%s redis score = %d (present %v), want %d", playerID, score, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateScoreConcurrentIncrements(t *testing.T) {
+	const goroutines = 100
+
+	env := newTestEnv(t, "", Options{UpdateMode: UpdateModeIncrement})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	var want int64
+	for i := 1; i <= goroutines; i++ {
+		want += int64(i)
+		wg.Add(1)
+		go func(incr int64) {
+			defer wg.Done()
+			errs <- env.svc.UpdateScore(context.Background(), model.UpdateRequest{PlayerID: "p1", IncrScore: incr})
+		}(int64(i))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("UpdateScore() = %v", err)
+		}
+	}
+
+	if got := env.mysqlScore(t, "p1"); got != want {
+		t.Errorf("mysql score = %d, want %d", got, want)
+	}
+	if got, _ := env.redis.Score("p1"); got != want {
+		t.Errorf("redis score = %d, want %d", got, want)
+	}
+	if history := env.mysql.History("p1"); len(history) != goroutines {
+		t.Errorf("score history has %d entries, want %d", len(history), goroutines)
+	}
+}
+
+func TestUpdateRedisWithRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		wantErr   bool
+		wantCalls int
+	}{
+		{name: "first attempt succeeds", failures: 0, wantCalls: 1},
+		{name: "succeeds after one failure", failures: 1, wantCalls: 2},
+		{name: "succeeds on the last attempt", failures: redisSyncMaxAttempts - 1, wantCalls: redisSyncMaxAttempts},
+		{name: "gives up after max attempts", failures: redisSyncMaxAttempts, wantErr: true, wantCalls: redisSyncMaxAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, "", Options{})
+			env.redis.FailNext("UpdatePlayerScore", tt.failures, nil)
+
+			err := env.svc.updateRedisWithRetry(context.Background(), "p1", 42, "alice")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("updateRedisWithRetry() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := env.redis.Calls("UpdatePlayerScore"); got != tt.wantCalls {
+				t.Errorf("UpdatePlayerScore called %d times, want %d", got, tt.wantCalls)
+			}
+
+			score, ok := env.redis.Score("p1")
+			if ok == tt.wantErr || (ok && score != 42) {
+				t.Errorf("redis score = %d (present %v), want 42 present %v", score, ok, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateRedisWithRetryStopsWhenCanceled(t *testing.T) {
+	env := newTestEnv(t, "", Options{})
+	env.redis.FailNext("UpdatePlayerScore", -1, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisSyncRetryBackoff/2)
+	defer cancel()
+
+	err := env.svc.updateRedisWithRetry(ctx, "p1", 42, "alice")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("updateRedisWithRetry() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := env.redis.Calls("UpdatePlayerScore"); got != 1 {
+		t.Errorf("UpdatePlayerScore called %d times, want 1", got)
+	}
+}
+
+// 名次计算通过不同分数索引统计，耗时不随榜单规模增长
+func BenchmarkCalculateDenseRank(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		env := newTestEnv(b, "", Options{})
+		players := make([]*model.Player, size)
+		for i := range players {
+			// 每两名玩家同分，共 size/2 个不同分数
+			players[i] = &model.Player{ID: fmt.Sprintf("p%06d", i), TotalScore: int64(i / 2)}
+		}
+		if err := env.redis.UpdatePlayerScores(context.Background(), players); err != nil {
+			b.Fatalf("seed: %v", err)
+		}
+
+		score := int64(size / 4)
+		want := size/2 - size/4
+		b.Run(fmt.Sprintf("N=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+			for i := 0; i < b.N; i++ {
+				if got := env.svc.calculateDenseRank(ctx, score, size/2); got != want {
+					b.Fatalf("dense rank = %d, want %d", got, want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkApplyDenseRanking(b *testing.B) {
+	const size = 100000
+	env := newTestEnv(b, "", Options{})
+	rankings := make([]*model.RankInfo, size)
+	for i := range rankings {
+		rankings[i] = &model.RankInfo{PlayerID: fmt.Sprintf("p%06d", i), Score: int64(size - i/2)}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		env.svc.applyDenseRanking(rankings, 1)
+	}
+	if got := rankings[size-1].Rank; got != size/2 {
+		b.Fatalf("last dense rank = %d, want %d", got, size/2)
+	}
+}
+
+func TestRebuildLeaderboard(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		rankOrder string
+		preserve  bool
+		want      map[string]int64
+	}{
+		{
+			name: "overwrite with mysql",
+			want: map[string]int64{"p1": 100, "p2": 50, "p3": 80},
+		},
+		{
+			name:     "desc keeps the higher score",
+			preserve: true,
+			want:     map[string]int64{"p1": 120, "p2": 50, "p3": 80},
+		},
+		{
+			name:      "asc keeps the lower score",
+			rankOrder: "asc",
+			preserve:  true,
+			want:      map[string]int64{"p1": 100, "p2": 30, "p3": 80},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, tt.rankOrder, Options{RebuildPreserveMax: tt.preserve})
+			ctx := context.Background()
+			env.seed(t, "p1", "alice", 100, base)
+			env.seed(t, "p2", "bob", 50, base)
+			env.mysql.AddPlayer(model.Player{ID: "p3", Name: "carol", TotalScore: 80, UpdatedAt: base})
+			// Redis 中尚未持久化的分数：p1 更高，p2 更低
+			env.redis.UpdatePlayerScore(ctx, "p1", 120, "alice", base)
+			env.redis.UpdatePlayerScore(ctx, "p2", 30, "bob", base)
+
+			if err := env.svc.RebuildLeaderboard(ctx); err != nil {
+				t.Fatalf("RebuildLeaderboard: %v", err)
+			}
+			for playerID, want := range tt.want {
+				got, ok := env.redis.Score(playerID)
+				if !ok || got != want {
+					t.Errorf("redis score of %s = %d (present %v), want %d", playerID, got, ok, want)
+				}
+			}
+			if calls := env.redis.Calls("RebuildScoreIndex"); calls != 1 {
+				t.Errorf("RebuildScoreIndex calls = %d, want 1", calls)
+			}
+		})
+	}
+}
+
+func TestRebuildLeaderboardSkipsBlockedPlayers(t *testing.T) {
+	env := newTestEnv(t, "", Options{})
+	ctx := context.Background()
+	env.mysql.AddPlayer(model.Player{ID: "p1", Name: "alice", TotalScore: 100})
+	env.mysql.AddPlayer(model.Player{ID: "p2", Name: "bob", TotalScore: 50})
+	if err := env.redis.BlockPlayers(ctx, []string{"p2"}); err != nil {
+		t.Fatalf("BlockPlayers: %v", err)
+	}
+
+	if err := env.svc.RebuildLeaderboard(ctx); err != nil {
+		t.Fatalf("RebuildLeaderboard: %v", err)
+	}
+	if _, ok := env.redis.Score("p2"); ok {
+		t.Error("blocked player p2 was written back to the leaderboard")
+	}
+	if got, _ := env.redis.Score("p1"); got != 100 {
+		t.Errorf("redis score of p1 = %d, want 100", got)
+	}
+}
+
+func TestBackgroundSnapshotInterval(t *testing.T) {
+	tests := []struct {
+		name      string
+		interval  time.Duration
+		wantSaves bool
+	}{
+		{name: "configured interval", interval: 10 * time.Millisecond, wantSaves: true},
+		{name: "longer than the test", interval: time.Hour},
+		{name: "disabled", interval: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, "", Options{SnapshotInterval: tt.interval})
+			env.seed(t, "p1", "alice", 100, time.Now())
+			env.svc.StartBackgroundTasks(context.Background())
+
+			deadline := time.Now().Add(100 * time.Millisecond)
+			if tt.wantSaves {
+				deadline = time.Now().Add(2 * time.Second)
+			}
+			for time.Now().Before(deadline) && env.mysql.Calls("SaveLeaderboardSnapshot") < 3 {
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			saves := env.mysql.Calls("SaveLeaderboardSnapshot")
+			if tt.wantSaves && saves < 3 {
+				t.Fatalf("snapshots saved = %d, want at least 3 with interval %v", saves, tt.interval)
+			}
+			if !tt.wantSaves && saves != 0 {
+				t.Fatalf("snapshots saved = %d, want 0 with interval %v", saves, tt.interval)
+			}
+		})
+	}
+}
+
+func TestBackgroundTasksRunOnTheirOwnSchedules(t *testing.T) {
+	const (
+		snapshotInterval = 10 * time.Millisecond
+		healthInterval   = 30 * time.Millisecond
+		rankInterval     = 90 * time.Millisecond
+		runFor           = 450 * time.Millisecond
+	)
+
+	env := newTestEnv(t, "", Options{
+		SnapshotInterval:    snapshotInterval,
+		HealthCheckInterval: healthInterval,
+		PrecomputedRanks:    true,
+		RankRefreshInterval: rankInterval,
+	})
+	env.seed(t, "p1", "alice", 100, time.Now())
+	env.svc.StartBackgroundTasks(context.Background())
+	time.Sleep(runFor)
+	env.svc.Close()
+
+	// 预计算排名在启动时先执行一次
+	tasks := []struct {
+		name     string
+		runs     int
+		interval time.Duration
+	}{
+		{"snapshot", env.mysql.Calls("SaveLeaderboardSnapshot"), snapshotInterval},
+		{"health_check", env.redis.Calls("HealthCheck"), healthInterval},
+		{"precomputed_ranks", env.redis.Calls("PublishPrecomputedRanks") - 1, rankInterval},
+	}
+	for _, task := range tasks {
+		// 每次运行之间至少间隔 interval，调度延迟只会减少运行次数
+		maxRuns := int(runFor / task.interval)
+		if task.runs > maxRuns || task.runs < maxRuns/3 {
+			t.Errorf("%s ran %d times, want between %d and %d with interval %v", task.name, task.runs, maxRuns/3, maxRuns, task.interval)
+		}
+	}
+	if tasks[0].runs <= tasks[1].runs || tasks[1].runs <= tasks[2].runs {
+		t.Errorf("runs = %d/%d/%d, want shorter intervals to run more often", tasks[0].runs, tasks[1].runs, tasks[2].runs)
+	}
+}
+
+func TestJitteredDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		jitter   time.Duration
+	}{
+		{name: "no jitter", interval: time.Hour},
+		{name: "negative jitter", interval: time.Hour, jitter: -time.Minute},
+		{name: "jitter shorter than interval", interval: time.Hour, jitter: 5 * time.Minute},
+		{name: "jitter longer than interval", interval: time.Second, jitter: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bound := tt.interval + max(tt.jitter, 0)
+			distinct := make(map[time.Duration]bool)
+			for i := 0; i < 100; i++ {
+				delay := jitteredDelay(tt.interval, tt.jitter)
+				if tt.jitter <= 0 && delay != tt.interval {
+					t.Fatalf("jitteredDelay() = %v, want exactly %v", delay, tt.interval)
+				}
+				if tt.jitter > 0 && (delay < tt.interval || delay >= bound) {
+					t.Fatalf("jitteredDelay() = %v, want in [%v, %v)", delay, tt.interval, bound)
+				}
+				distinct[delay] = true
+			}
+			// 有抖动时各实例的等待时间应当分散
+			if tt.jitter > 0 && len(distinct) < 50 {
+				t.Errorf("jitteredDelay() returned %d distinct delays in 100 calls, want spread", len(distinct))
+			}
+		})
+	}
+}
+
+func TestScheduleJitterDelaysBackgroundTasks(t *testing.T) {
+	const (
+		interval = 5 * time.Millisecond
+		runFor   = 200 * time.Millisecond
+	)
+
+	snapshots := func(jitter time.Duration) int {
+		env := newTestEnv(t, "", Options{SnapshotInterval: interval, ScheduleJitter: jitter})
+		env.seed(t, "p1", "alice", 100, time.Now())
+		env.svc.StartBackgroundTasks(context.Background())
+		time.Sleep(runFor)
+		env.svc.Close()
+		return env.mysql.Calls("SaveLeaderboardSnapshot")
+	}
+
+	// 平均每个周期多等待 50ms，运行次数远少于不带抖动时
+	withoutJitter, withJitter := snapshots(0), snapshots(100*time.Millisecond)
+	if withJitter >= withoutJitter/2 || withJitter > int(runFor/interval)/5 {
+		t.Errorf("snapshots = %d with jitter, %d without, want jitter to stretch the schedule", withJitter, withoutJitter)
+	}
+}
+
+func TestExportLeaderboardStopsWhenCanceled(t *testing.T) {
+	env := newTestEnv(t, "", Options{})
+	players := make([]*model.Player, 2500)
+	for i := range players {
+		players[i] = &model.Player{ID: fmt.Sprintf("p%04d", i), TotalScore: int64(i)}
+	}
+	if err := env.redis.UpdatePlayerScores(context.Background(), players); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	t.Run("complete export", func(t *testing.T) {
+		exported := 0
+		err := env.svc.ExportLeaderboard(context.Background(), func(page []*model.RankInfo) error {
+			exported += len(page)
+			return nil
+		})
+		if err != nil || exported != len(players) {
+			t.Fatalf("ExportLeaderboard() exported %d, error %v, want %d, nil", exported, err, len(players))
+		}
+	})
+
+	t.Run("client disconnects after the first page", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		pages := 0
+		err := env.svc.ExportLeaderboard(ctx, func(page []*model.RankInfo) error {
+			pages++
+			cancel()
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("ExportLeaderboard() error = %v, want context.Canceled", err)
+		}
+		if pages != 1 {
+			t.Fatalf("pages exported after cancellation = %d, want 1", pages)
+		}
+	})
+}
+
+func TestRedisFirstWrites(t *testing.T) {
+	ctx := context.Background()
+
+	// 等待后台任务把队列中的变更写入 MySQL，超时测试失败
+	waitPersisted := func(t *testing.T, env *testEnv, playerID string, want int64) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for {
+			player, ok := env.mysql.Player(playerID)
+			stats, err := env.redis.GetScoreWriteQueueStats(ctx)
+			if err != nil {
+				t.Fatalf("GetScoreWriteQueueStats() error = %v", err)
+			}
+			if ok && player.TotalScore == want && *stats == (model.ScoreWriteQueueStats{}) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("mysql score = %d (found %v), queue = %+v, want %d with an empty queue", player.TotalScore, ok, *stats, want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("redis reflects the update before mysql", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{WriteMode: WriteModeRedisFirst})
+		env.seed(t, "p1", "alice", 100, time.Now().Add(-time.Hour))
+
+		for _, req := range []model.UpdateRequest{
+			{PlayerID: "p1", IncrScore: 50},
+			{PlayerID: "p2", IncrScore: 300, Name: "bob"},
+		} {
+			if err := env.svc.UpdateScore(ctx, req); err != nil {
+				t.Fatalf("UpdateScore(%s) error = %v", req.PlayerID, err)
+			}
+		}
+
+		// 后台任务尚未启动，排行榜已更新而 MySQL 还没有写入
+		rankInfo, err := env.svc.GetPlayerRank(ctx, "p1")
+		if err != nil {
+			t.Fatalf("GetPlayerRank() error = %v", err)
+		}
+		if rankInfo.Score != 150 || rankInfo.Rank != 2 {
+			t.Errorf("GetPlayerRank() = rank %d score %d, want rank 2 score 150", rankInfo.Rank, rankInfo.Score)
+		}
+		if got := env.mysqlScore(t, "p1"); got != 100 {
+			t.Errorf("mysql score before persisting = %d, want 100", got)
+		}
+		if _, ok := env.mysql.Player("p2"); ok {
+			t.Error("p2 written to mysql before the background task ran")
+		}
+
+		env.svc.StartBackgroundTasks(ctx)
+		waitPersisted(t, env, "p1", 150)
+		waitPersisted(t, env, "p2", 300)
+	})
+
+	t.Run("player missing from redis starts from the mysql total", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{WriteMode: WriteModeRedisFirst})
+		// 玩家只在 MySQL 中（如被裁剪出总榜或 Redis 数据丢失），累加应基于 MySQL 总分
+		env.mysql.AddPlayer(model.Player{ID: "p1", Name: "alice", TotalScore: 100, UpdatedAt: time.Now().Add(-time.Hour)})
+
+		if err := env.svc.UpdateScore(ctx, model.UpdateRequest{PlayerID: "p1", IncrScore: 50}); err != nil {
+			t.Fatalf("UpdateScore() error = %v", err)
+		}
+		score, err := env.redis.GetPlayerScore(ctx, "p1")
+		if err != nil {
+			t.Fatalf("GetPlayerScore() error = %v", err)
+		}
+		if score != 150 {
+			t.Errorf("redis score = %v, want 150", score)
+		}
+
+		env.svc.StartBackgroundTasks(ctx)
+		waitPersisted(t, env, "p1", 150)
+	})
+
+	t.Run("batch updates go through the queue", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{WriteMode: WriteModeRedisFirst})
+		env.seed(t, "p1", "alice", 100, time.Now().Add(-time.Hour))
+		if err := env.redis.BlockPlayers(ctx, []string{"p3"}); err != nil {
+			t.Fatalf("BlockPlayers() error = %v", err)
+		}
+
+		results := env.svc.BatchUpdateScores(ctx, []model.UpdateRequest{
+			{PlayerID: "p1", IncrScore: 50},
+			{PlayerID: "p2", IncrScore: 30, Name: "bob"},
+			{PlayerID: "p3", IncrScore: 500, Name: "carol"},
+		})
+		for _, r := range results {
+			if !r.Success {
+				t.Fatalf("BatchUpdateScores(%s) error = %s", r.PlayerID, r.Error)
+			}
+		}
+		if results[0].FinalScore != 150 {
+			t.Errorf("p1 final score = %d, want the redis score 150", results[0].FinalScore)
+		}
+
+		// 排行榜已更新，MySQL 要等后台任务写入；被封禁的玩家只入队
+		if got := env.mysqlScore(t, "p1"); got != 100 {
+			t.Errorf("mysql score before persisting = %d, want 100", got)
+		}
+		if _, err := env.svc.GetPlayerRank(ctx, "p3"); !errors.Is(err, ErrPlayerNotFound) {
+			t.Errorf("GetPlayerRank(p3) error = %v, want ErrPlayerNotFound", err)
+		}
+		stats, err := env.redis.GetScoreWriteQueueStats(ctx)
+		if err != nil {
+			t.Fatalf("GetScoreWriteQueueStats() error = %v", err)
+		}
+		if stats.Pending != 3 {
+			t.Errorf("queued writes = %d, want 3", stats.Pending)
+		}
+		if got := env.mysql.Calls("ApplyScoreChange"); got != 0 {
+			t.Errorf("ApplyScoreChange calls before persisting = %d, want 0", got)
+		}
+
+		env.svc.StartBackgroundTasks(ctx)
+		waitPersisted(t, env, "p1", 150)
+		waitPersisted(t, env, "p3", 500)
+	})
+
+	t.Run("failed mysql write is retried", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{WriteMode: WriteModeRedisFirst})
+		env.mysql.FailNext("ApplyScoreChange", 1, nil)
+
+		if err := env.svc.UpdateScore(ctx, model.UpdateRequest{PlayerID: "p1", IncrScore: 70, Name: "alice"}); err != nil {
+			t.Fatalf("UpdateScore() error = %v", err)
+		}
+		env.svc.StartBackgroundTasks(ctx)
+		waitPersisted(t, env, "p1", 70)
+		if got := env.mysql.Calls("ApplyScoreChange"); got != 2 {
+			t.Errorf("ApplyScoreChange calls = %d, want 2", got)
+		}
+	})
+
+	t.Run("redelivered write is counted once", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{WriteMode: WriteModeRedisFirst})
+		if err := env.svc.UpdateScore(ctx, model.UpdateRequest{PlayerID: "p1", IncrScore: 40, Name: "alice"}); err != nil {
+			t.Fatalf("UpdateScore() error = %v", err)
+		}
+
+		// 模拟上一个进程写入 MySQL 后、确认前退出：变更留在处理中队列，启动时重新入队
+		claimed, err := env.redis.ClaimScoreWrite(ctx, repository.ScoreWritePartition("p1"), 0)
+		if err != nil || claimed == nil {
+			t.Fatalf("ClaimScoreWrite() = %v, %v", claimed, err)
+		}
+		if _, err := env.svc.applyScoreWrite(ctx, claimed.PendingScoreWrite); err != nil {
+			t.Fatalf("applyScoreWrite() error = %v", err)
+		}
+
+		env.svc.StartBackgroundTasks(ctx)
+		waitPersisted(t, env, "p1", 40)
+		if got := len(env.mysql.History("p1")); got != 1 {
+			t.Errorf("history entries = %d, want 1", got)
+		}
+	})
+
+	t.Run("expired lease is taken over in queue order", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{WriteMode: WriteModeRedisFirst})
+		partition := repository.ScoreWritePartition("p1")
+		for _, write := range []*model.PendingScoreWrite{
+			{WriteID: "w1", PlayerID: "p1", Name: "alice", RawScoreChange: 40, ScoreChange: 40},
+			{WriteID: "w2", PlayerID: "p1", Name: "alice", SetAbsolute: true, Score: 100},
+		} {
+			if err := env.redis.EnqueueScoreWrite(ctx, write); err != nil {
+				t.Fatalf("EnqueueScoreWrite(%s) error = %v", write.WriteID, err)
+			}
+		}
+
+		// 另一个实例取出 w1 后停止续期，租约过期
+		if ok, err := env.redis.AcquireScoreWritePartition(ctx, partition, "other", time.Millisecond); !ok || err != nil {
+			t.Fatalf("AcquireScoreWritePartition() = %v, %v", ok, err)
+		}
+		if claimed, err := env.redis.ClaimScoreWrite(ctx, partition, 0); err != nil || claimed.WriteID != "w1" {
+			t.Fatalf("ClaimScoreWrite() = %v, %v, want w1", claimed, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		// w1 先于 w2 写入，顺序颠倒时总分为 140
+		env.svc.StartBackgroundTasks(ctx)
+		waitPersisted(t, env, "p1", 100)
+		if owner := env.redis.LeaseOwner(partition); owner == "" || owner == "other" {
+			t.Errorf("lease owner = %q, want this instance", owner)
+		}
+	})
+
+	t.Run("partition leased by another instance is left alone", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{WriteMode: WriteModeRedisFirst})
+		// 找一个与 p1 不在同一分区的玩家
+		other := "p2"
+		for i := 3; repository.ScoreWritePartition(other) == repository.ScoreWritePartition("p1"); i++ {
+			other = fmt.Sprintf("p%d", i)
+		}
+
+		held := repository.ScoreWritePartition("p1")
+		if ok, err := env.redis.AcquireScoreWritePartition(ctx, held, "other", time.Minute); !ok || err != nil {
+			t.Fatalf("AcquireScoreWritePartition() = %v, %v", ok, err)
+		}
+		for _, id := range []string{"p1", other} {
+			if err := env.svc.UpdateScore(ctx, model.UpdateRequest{PlayerID: id, IncrScore: 10, Name: id}); err != nil {
+				t.Fatalf("UpdateScore(%s) error = %v", id, err)
+			}
+		}
+
+		env.svc.StartBackgroundTasks(ctx)
+		deadline := time.Now().Add(3 * time.Second)
+		for {
+			if player, ok := env.mysql.Player(other); ok && player.TotalScore == 10 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s not persisted", other)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if _, ok := env.mysql.Player("p1"); ok {
+			t.Error("p1 persisted while its partition is leased by another instance")
+		}
+
+		// 关闭时释放持有的租约，其他实例的租约不受影响
+		mine := repository.ScoreWritePartition(other)
+		if owner := env.redis.LeaseOwner(mine); owner == "" {
+			t.Fatalf("partition %d has no lease owner while running", mine)
+		}
+		env.svc.Close()
+		if owner := env.redis.LeaseOwner(mine); owner != "" {
+			t.Errorf("lease owner after Close = %q, want released", owner)
+		}
+		if owner := env.redis.LeaseOwner(held); owner != "other" {
+			t.Errorf("lease owner of the held partition = %q, want other", owner)
+		}
+	})
+}
+
+func TestExpireScores(t *testing.T) {
+	ctx := context.Background()
+	opts := Options{ReasonTTLs: map[string]time.Duration{"bonus": time.Millisecond}}
+
+	redisScore := func(t *testing.T, env *testEnv, playerID string) int64 {
+		t.Helper()
+		score, err := env.redis.GetPlayerScore(ctx, playerID)
+		if err != nil {
+			t.Fatalf("GetPlayerScore(%s) error = %v", playerID, err)
+		}
+		return int64(score)
+	}
+
+	t.Run("expired bonus is subtracted from the total", func(t *testing.T) {
+		env := newTestEnv(t, "", opts)
+		env.seed(t, "p1", "alice", 100, time.Now().Add(-time.Hour))
+
+		if err := env.svc.UpdateScore(ctx, model.UpdateRequest{PlayerID: "p1", IncrScore: 50, Reason: "bonus"}); err != nil {
+			t.Fatalf("UpdateScore() error = %v", err)
+		}
+		// 不经过 MySQL 的 Redis 修改（如其他实例正在进行的写入）在扣回后应当保留
+		if _, err := env.redis.IncrementPlayerScore(ctx, "p1", 5, 155, "alice"); err != nil {
+			t.Fatalf("IncrementPlayerScore() error = %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		env.svc.expireScores(ctx)
+
+		if got := env.mysqlScore(t, "p1"); got != 100 {
+			t.Errorf("mysql score = %d, want 100", got)
+		}
+		if got := redisScore(t, env, "p1"); got != 105 {
+			t.Errorf("redis score = %d, want 105", got)
+		}
+		history := env.mysql.History("p1")
+		if last := history[len(history)-1]; last.ScoreChange != -50 || last.Reason != repository.ExpiredReasonPrefix+"bonus" {
+			t.Errorf("last history = %+v, want -50 for the expired bonus", last)
+		}
+	})
+
+	t.Run("redis first reversal goes through the queue", func(t *testing.T) {
+		env := newTestEnv(t, "", Options{WriteMode: WriteModeRedisFirst, ReasonTTLs: opts.ReasonTTLs})
+		env.seed(t, "p1", "alice", 100, time.Now().Add(-time.Hour))
+
+		// 逐条取出 p1 所在分区的变更写入 MySQL
+		persistQueued := func(t *testing.T) {
+			t.Helper()
+			for {
+				claimed, err := env.redis.ClaimScoreWrite(ctx, repository.ScoreWritePartition("p1"), 0)
+				if err != nil {
+					t.Fatalf("ClaimScoreWrite() error = %v", err)
+				}
+				if claimed == nil {
+					return
+				}
+				env.svc.persistScoreWrite(ctx, claimed)
+			}
+		}
+
+		if err := env.svc.UpdateScore(ctx, model.UpdateRequest{PlayerID: "p1", IncrScore: 50, Reason: "bonus"}); err != nil {
+			t.Fatalf("UpdateScore() error = %v", err)
+		}
+		persistQueued(t)
+		time.Sleep(5 * time.Millisecond)
+
+		env.svc.expireScores(ctx)
+
+		// 排行榜立即扣回，MySQL 等写入队列处理
+		if got := redisScore(t, env, "p1"); got != 100 {
+			t.Errorf("redis score = %d, want 100", got)
+		}
+		if got := env.mysqlScore(t, "p1"); got != 150 {
+			t.Errorf("mysql score before persisting = %d, want 150", got)
+		}
+
+		persistQueued(t)
+		if got := env.mysqlScore(t, "p1"); got != 100 {
+			t.Errorf("mysql score = %d, want 100", got)
+		}
+
+		// 已扣回的记录不会再次处理
+		env.svc.expireScores(ctx)
+		if got := redisScore(t, env, "p1"); got != 100 {
+			t.Errorf("redis score after a second pass = %d, want 100", got)
+		}
+	})
+}
+
+// 等待 goroutine 数量回落到 want 以内，超时返回最后一次的数量
+func waitGoroutines(want int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= want || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCloseStopsBackgroundGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		func() {
+			svc := NewLeaderboardService(repotest.NewRedisStore(false, ""), repotest.NewMySQLStore(0), Options{
+				EnableCache:      true,
+				CacheSize:        10,
+				SnapshotInterval: 10 * time.Millisecond,
+			})
+			defer svc.Close()
+
+			svc.StartBackgroundTasks(context.Background())
+
+			if runtime.NumGoroutine() <= before {
+				t.Fatal("StartBackgroundTasks() started no goroutines")
+			}
+		}()
+	}
+
+	if after := waitGoroutines(before); after > before {
+		t.Errorf("goroutines after Close = %d, want <= %d", after, before)
+	}
+}
+
+// 记录进行中和已开始的发布，每次发布耗时 delay
+type slowPublisher struct {
+	delay    time.Duration
+	started  atomic.Int64
+	inFlight atomic.Int64
+}
+
+func (p *slowPublisher) Publish(ctx context.Context, event events.ScoreChangeEvent) error {
+	p.started.Add(1)
+	p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	time.Sleep(p.delay)
+	return nil
+}
+
+func TestCloseWaitsForPublishes(t *testing.T) {
+	ctx := context.Background()
+	publisher := &slowPublisher{delay: 5 * time.Millisecond}
+	svc := NewLeaderboardService(repotest.NewRedisStore(false, ""), repotest.NewMySQLStore(0), Options{EventPublisher: publisher})
+
+	// Close 与写入并发进行，写入在 Close 之后继续成功但不再发布事件
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := svc.UpdateScore(ctx, model.UpdateRequest{PlayerID: fmt.Sprintf("p%d", i), IncrScore: 1}); err != nil {
+					t.Errorf("UpdateScore() error = %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	svc.Close()
+	if n := publisher.inFlight.Load(); n != 0 {
+		t.Errorf("publishes in flight after Close = %d, want 0", n)
+	}
+	started := publisher.started.Load()
+	if started == 0 {
+		t.Error("no events published before Close")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	if got := publisher.started.Load(); got != started {
+		t.Errorf("publishes started after Close = %d, want 0", got-started)
+	}
+}
+
+// 记录衰减任务是否读取了候选玩家，不返回任何候选
+type decayStore struct {
+	*repotest.MySQLStore
+	listed atomic.Int32
+}
+
+func (d *decayStore) ListDecayCandidates(ctx context.Context, inactiveBefore time.Time, afterID string, limit int) ([]string, error) {
+	d.listed.Add(1)
+	return nil, nil
+}
+
+func TestDecayUnsupportedModes(t *testing.T) {
+	tests := []struct {
+		name      string
+		rankOrder string
+		writeMode string
+		wantRun   bool
+	}{
+		{"descending mysql first", repository.RankOrderDesc, WriteModeMySQLFirst, true},
+		// 分数低者在前时扣减分数反而提升排名
+		{"ascending", repository.RankOrderAsc, WriteModeMySQLFirst, false},
+		// MySQL 不是最新分数，衰减会覆盖尚未写入的得分
+		{"redis first", repository.RankOrderDesc, WriteModeRedisFirst, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mysql := &decayStore{MySQLStore: repotest.NewMySQLStore(0)}
+			svc := NewLeaderboardService(repotest.NewRedisStore(false, tt.rankOrder), mysql, Options{
+				WriteMode:          tt.writeMode,
+				DecayInterval:      time.Millisecond,
+				DecayRate:          0.1,
+				DecayInactiveAfter: time.Hour,
+			})
+			t.Cleanup(svc.Close)
+			svc.StartBackgroundTasks(context.Background())
+
+			time.Sleep(50 * time.Millisecond)
+			if got := mysql.listed.Load() > 0; got != tt.wantRun {
+				t.Errorf("decay ran = %v, want %v", got, tt.wantRun)
+			}
+		})
+	}
+}
+
+// 分数低者在前的排行榜：第 1 名是最低分，各查询接口的排名方向一致
+func TestAscendingBoard(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t, repository.RankOrderAsc, Options{})
+	base := time.Now().Add(-time.Hour)
+	env.seed(t, "p1", "alice", 30, base)
+	env.seed(t, "p2", "bob", 10, base)
+	// 同分时先得分者在前
+	env.seed(t, "p3", "carol", 20, base.Add(time.Minute))
+	env.seed(t, "p4", "dave", 20, base)
+	env.seed(t, "p5", "erin", 40, base)
+
+	ids := func(rankings []*model.RankInfo) string {
+		var parts []string
+		for _, r := range rankings {
+			parts = append(parts, fmt.Sprintf("%d:%s:%d", r.Rank, r.PlayerID, r.Score))
+		}
+		return strings.Join(parts, " ")
+	}
+	denseCtx, err := WithRankingMethod(ctx, RankingDense)
+	if err != nil {
+		t.Fatalf("WithRankingMethod() error = %v", err)
+	}
+
+	rankInfo, err := env.svc.GetPlayerRank(ctx, "p2")
+	if err != nil || rankInfo.Rank != 1 || rankInfo.Score != 10 {
+		t.Errorf("GetPlayerRank(p2) = %+v, %v, want rank 1 with the minimum score", rankInfo, err)
+	}
+
+	top, err := env.svc.GetTopN(ctx, 3)
+	if err != nil {
+		t.Fatalf("GetTopN() error = %v", err)
+	}
+	if got, want := ids(top), "1:p2:10 2:p4:20 3:p3:20"; got != want {
+		t.Errorf("GetTopN(3) = %q, want %q", got, want)
+	}
+
+	page, total, err := env.svc.GetLeaderboardPage(ctx, 2, 2)
+	if err != nil {
+		t.Fatalf("GetLeaderboardPage() error = %v", err)
+	}
+	if got, want := ids(page), "3:p3:20 4:p1:30"; got != want || total != 5 {
+		t.Errorf("GetLeaderboardPage(2, 2) = %q (total %d), want %q (total 5)", got, total, want)
+	}
+
+	around, err := env.svc.GetPlayerRankRange(ctx, "p1", 3)
+	if err != nil {
+		t.Fatalf("GetPlayerRankRange() error = %v", err)
+	}
+	if got, want := ids(around), "3:p3:20 4:p1:30 5:p5:40"; got != want {
+		t.Errorf("GetPlayerRankRange(p1, 3) = %q, want %q", got, want)
+	}
+
+	// 密集排名：同分共享名次，之后的名次连续
+	rankInfo, err = env.svc.GetPlayerRank(denseCtx, "p1")
+	if err != nil || rankInfo.Rank != 3 {
+		t.Errorf("GetPlayerRank(p1) dense = %+v, %v, want rank 3", rankInfo, err)
+	}
+	top, err = env.svc.GetTopN(denseCtx, 5)
+	if err != nil {
+		t.Fatalf("GetTopN() dense error = %v", err)
+	}
+	if got, want := ids(top), "1:p2:10 2:p4:20 2:p3:20 3:p1:30 4:p5:40"; got != want {
+		t.Errorf("GetTopN(5) dense = %q, want %q", got, want)
+	}
+}
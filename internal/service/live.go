@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/repository"
+)
+
+// ErrLiveDisabled 未启用实时前N名推送
+var ErrLiveDisabled = fmt.Errorf("live top-n disabled")
+
+const (
+	// 两次推送之间的最小间隔，期间的多次变更合并为一次推送
+	liveUpdateMinInterval = 200 * time.Millisecond
+	// 读取前N名的超时时间
+	liveFetchTimeout = 2 * time.Second
+	// 每个订阅者的缓冲区大小，客户端处理不及时的推送会被丢弃；每次推送都带有完整前N名，客户端可据此恢复
+	liveSubscriberBuffer = 16
+)
+
+// liveTopN 维护实时前N名的订阅者和最近一次推送的结果，以及排行榜变更的监听者
+type liveTopN struct {
+	n     int // 为 0 时不提供前N名订阅
+	dirty chan struct{}
+
+	mu       sync.Mutex
+	subs     map[chan *model.TopNUpdate]struct{}
+	last     []*model.RankInfo
+	watchers map[chan struct{}]struct{}
+}
+
+func newLiveTopN(n int) *liveTopN {
+	return &liveTopN{
+		n:        n,
+		dirty:    make(chan struct{}, 1),
+		subs:     make(map[chan *model.TopNUpdate]struct{}),
+		watchers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// 标记排行榜已变更，由后台任务合并后检查前N名是否变化
+func (l *liveTopN) markDirty() {
+	if l == nil {
+		return
+	}
+	select {
+	case l.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (l *liveTopN) subscriberCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.subs)
+}
+
+// 通知所有监听者排行榜已变更，监听者尚未处理上一次通知时合并
+func (l *liveTopN) notifyWatchers() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ch := range l.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// 关闭所有订阅，服务关闭时调用
+func (l *liveTopN) closeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ch := range l.subs {
+		delete(l.subs, ch)
+		close(ch)
+	}
+	for ch := range l.watchers {
+		delete(l.watchers, ch)
+		close(ch)
+	}
+}
+
+// SubscribeTopN 订阅实时前N名，返回当前前N名快照、后续变更的推送通道和取消订阅函数
+// 服务关闭或取消订阅后推送通道会被关闭
+func (s *LeaderboardService) SubscribeTopN(ctx context.Context) (*model.TopNUpdate, <-chan *model.TopNUpdate, func(), error) {
+	if s.live.n == 0 {
+		return nil, nil, nil, ErrLiveDisabled
+	}
+
+	rankings, err := s.fetchLiveTopN(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ch := make(chan *model.TopNUpdate, liveSubscriberBuffer)
+
+	s.live.mu.Lock()
+	// 没有订阅者时不跟踪变更，第一个订阅者以当前结果为基准
+	if len(s.live.subs) == 0 {
+		s.live.last = rankings
+	}
+	s.live.subs[ch] = struct{}{}
+	s.live.mu.Unlock()
+
+	unsubscribe := func() {
+		s.live.mu.Lock()
+		defer s.live.mu.Unlock()
+
+		if _, ok := s.live.subs[ch]; ok {
+			delete(s.live.subs, ch)
+			close(ch)
+		}
+	}
+
+	snapshot := &model.TopNUpdate{
+		Type:     model.TopNUpdateSnapshot,
+		Rankings: rankings,
+	}
+	return snapshot, ch, unsubscribe, nil
+}
+
+// 读取用于推送的前N名，按全局配置的排名方式计算
+func (s *LeaderboardService) fetchLiveTopN(ctx context.Context) ([]*model.RankInfo, error) {
+	rankings, err := s.redisRepo.GetTopPlayers(ctx, int64(s.live.n))
+	if err != nil {
+		return nil, err
+	}
+
+	s.resolveNames(ctx, rankings)
+
+	if s.rankingMethod == RankingDense {
+		rankings = s.applyDenseRanking(rankings, 1)
+	}
+	return rankings, nil
+}
+
+// 排行榜变更后检查前N名，有变化时推送给所有订阅者；两次推送至少间隔 liveUpdateMinInterval
+func (s *LeaderboardService) liveTopNLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.live.dirty:
+		}
+
+		if s.live.n > 0 && s.live.subscriberCount() > 0 {
+			s.pushLiveTopN(ctx)
+		}
+		s.live.notifyWatchers()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(liveUpdateMinInterval):
+		}
+	}
+}
+
+func (s *LeaderboardService) pushLiveTopN(ctx context.Context) {
+	fetchCtx, cancel := context.WithTimeout(ctx, liveFetchTimeout)
+	rankings, err := s.fetchLiveTopN(fetchCtx)
+	cancel()
+	if err != nil {
+		s.logger.Warn("Failed to fetch live top-n", "error", err)
+		return
+	}
+
+	s.live.mu.Lock()
+	defer s.live.mu.Unlock()
+
+	changed, removed := diffTopN(s.live.last, rankings)
+	if len(changed) == 0 && len(removed) == 0 {
+		return
+	}
+	s.live.last = rankings
+
+	update := &model.TopNUpdate{
+		Type:     model.TopNUpdateDelta,
+		Rankings: rankings,
+		Changed:  changed,
+		Removed:  removed,
+	}
+	for ch := range s.live.subs {
+		select {
+		case ch <- update:
+		default:
+			s.logger.Debug("Live top-n subscriber is slow, dropping update")
+		}
+	}
+}
+
+// WatchPlayerRank 监听玩家排名，先发送当前排名，之后排名或分数变化时发送新的排名
+// 玩家不在榜上时发送 Rank 为 0 的 RankInfo；ctx 取消或服务关闭后通道被关闭
+// 排名直接从 Redis 读取，不经过缓存
+func (s *LeaderboardService) WatchPlayerRank(ctx context.Context, playerID string) (<-chan *model.RankInfo, error) {
+	current, err := s.livePlayerRank(ctx, playerID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	s.live.mu.Lock()
+	s.live.watchers[changes] = struct{}{}
+	s.live.mu.Unlock()
+
+	out := make(chan *model.RankInfo, 1)
+	out <- current
+
+	go func() {
+		defer close(out)
+		defer func() {
+			s.live.mu.Lock()
+			defer s.live.mu.Unlock()
+			if _, ok := s.live.watchers[changes]; ok {
+				delete(s.live.watchers, changes)
+				close(changes)
+			}
+		}()
+
+		last := current
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-changes:
+				if !ok {
+					return
+				}
+			}
+
+			rankInfo, err := s.livePlayerRank(ctx, playerID)
+			if err != nil {
+				s.logger.Warn("Failed to read player rank for watcher", "playerID", playerID, "error", err)
+				continue
+			}
+			if rankInfo.Rank == last.Rank && rankInfo.Score == last.Score {
+				continue
+			}
+			last = rankInfo
+
+			select {
+			case out <- rankInfo:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// 从 Redis 读取玩家当前排名（按全局配置的排名方式），不在榜上时 Rank 为 0
+func (s *LeaderboardService) livePlayerRank(ctx context.Context, playerID string) (*model.RankInfo, error) {
+	rank, score, err := s.redisRepo.GetPlayerRankAndScore(ctx, playerID)
+	if err == repository.ErrPlayerNotFound {
+		return &model.RankInfo{PlayerID: playerID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rankInfo := &model.RankInfo{
+		PlayerID: playerID,
+		Rank:     int(rank),
+		Score:    int64(score),
+	}
+	if s.rankingMethod == RankingDense {
+		rankInfo.Rank = s.calculateDenseRank(ctx, rankInfo.Score, rankInfo.Rank)
+	}
+	return rankInfo, nil
+}
+
+// 比较前后两次前N名，返回名次、分数或名称变化（包括新进入）的玩家，以及跌出前N名的玩家ID
+func diffTopN(previous, current []*model.RankInfo) ([]*model.RankInfo, []string) {
+	before := make(map[string]*model.RankInfo, len(previous))
+	for _, entry := range previous {
+		before[entry.PlayerID] = entry
+	}
+
+	changed := make([]*model.RankInfo, 0)
+	for _, entry := range current {
+		old, ok := before[entry.PlayerID]
+		if !ok || old.Rank != entry.Rank || old.Score != entry.Score || old.Name != entry.Name {
+			changed = append(changed, entry)
+		}
+		delete(before, entry.PlayerID)
+	}
+
+	removed := make([]string, 0, len(before))
+	for _, entry := range previous {
+		if _, ok := before[entry.PlayerID]; ok {
+			removed = append(removed, entry.PlayerID)
+		}
+	}
+
+	return changed, removed
+}
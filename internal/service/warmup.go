@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+// WarmCache 预热本地缓存：查询前 topN 名（同时缓存其中每个玩家的排名）和最近得分的 players 名玩家的排名
+// 按全局配置的排名方式写入，未上榜或被封禁的玩家跳过；接口禁用缓存时跳过对应部分，返回写入的缓存条数
+func (s *LeaderboardService) WarmCache(ctx context.Context, topN, players int) (int, error) {
+	if !s.enableCache {
+		return 0, ErrCacheDisabled
+	}
+
+	method := s.rankingMethodFor(ctx)
+	topCache, _ := s.cachesFor(CacheEndpointTopN)
+	rankCache, _ := s.cachesFor(CacheEndpointRank)
+	warmed := 0
+
+	// GetTopN 未命中缓存时会写入本地缓存
+	if topN > 0 && (topCache != nil || rankCache != nil) {
+		rankings, err := s.GetTopN(ctx, topN)
+		if err != nil {
+			return warmed, fmt.Errorf("failed to warm top-n cache: %w", err)
+		}
+		if topCache != nil {
+			warmed++
+		}
+		if rankCache != nil {
+			for _, rankInfo := range rankings {
+				rankCopy := *rankInfo
+				rankCache.SetPlayerRank(rankInfo.PlayerID, method, &rankCopy)
+				warmed++
+			}
+		}
+	}
+
+	if players > 0 && rankCache != nil {
+		recent, err := s.mysqlRepo.GetRecentlyActivePlayers(ctx, players)
+		if err != nil {
+			return warmed, fmt.Errorf("failed to warm player rank cache: %w", err)
+		}
+
+		playerIDs := make([]string, 0, len(recent))
+		for _, player := range recent {
+			playerIDs = append(playerIDs, player.ID)
+		}
+		rankInfos, err := s.redisRepo.GetPlayerRankInfos(ctx, playerIDs)
+		if err != nil {
+			return warmed, fmt.Errorf("failed to warm player rank cache: %w", err)
+		}
+
+		for _, player := range recent {
+			rankInfo, ok := rankInfos[player.ID]
+			if !ok {
+				continue
+			}
+			rankInfo.Name = player.Name
+			rankInfo.UpdatedAt = player.UpdatedAt
+			if method == RankingDense {
+				rankInfo.Rank = s.calculateDenseRank(ctx, rankInfo.Score, rankInfo.Rank)
+			}
+			rankCache.SetPlayerRank(player.ID, method, rankInfo)
+			warmed++
+		}
+	}
+
+	s.logger.Info("Cache warmed",
+		"entries", warmed,
+		"topN", topN,
+		"players", players)
+	return warmed, nil
+}
@@ -0,0 +1,410 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"game-leaderboard/internal/metrics"
+	"game-leaderboard/internal/model"
+	"game-leaderboard/internal/repository"
+	"game-leaderboard/pkg/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 分数写入顺序
+const (
+	// WriteModeMySQLFirst 先在 MySQL 事务中提交，再同步到 Redis（默认）；请求成功即已持久化
+	WriteModeMySQLFirst = "mysql_first"
+	// WriteModeRedisFirst 先写 Redis 排行榜并把变更加入 Redis 中的队列，由后台任务异步写入 MySQL
+	// 请求成功时变更只保存在 Redis 中，Redis 丢失数据（未开启持久化、主从切换）时尚未写入 MySQL 的变更会丢失；
+	// 多次写入失败的变更进入死信队列，此时排行榜与 MySQL 不一致，需要处理死信后再重建排行榜
+	WriteModeRedisFirst = "redis_first"
+)
+
+const (
+	// 等待队列中新变更的最长阻塞时间，决定关闭服务时后台任务的退出延迟
+	scoreWriteClaimTimeout = 1 * time.Second
+	// 单条变更写入 MySQL 的最大尝试次数，超过后进入死信队列
+	scoreWriteMaxAttempts = 5
+	// 重试间隔随尝试次数线性增加
+	scoreWriteRetryBackoff = 1 * time.Second
+	// 写入队列分区租约的有效期，持有者每隔 scoreWriteLeaseRenewInterval 续期；
+	// 实例异常退出后其分区最晚在有效期后由其他实例接管
+	scoreWriteLeaseTTL           = 15 * time.Second
+	scoreWriteLeaseRenewInterval = scoreWriteLeaseTTL / 3
+)
+
+// 进入死信队列的变更数
+var scoreWritesDeadLettered = promauto.With(metrics.Registerer).NewCounter(prometheus.CounterOpts{
+	Name: "leaderboard_score_writes_dead_lettered_total",
+	Help: "Total number of redis-first score writes moved to the dead-letter queue after failing to persist to MySQL",
+})
+
+// 先写 Redis 模式下的分数更新：排行榜和写入队列在同一个 Redis 事务中修改，不等待 MySQL
+// 被封禁的玩家和增量为 0 的变更只入队，不修改排行榜；覆盖总分时不更新时间窗口排行榜
+// 累加后的总分按写入前 Redis 中的分数检查上限，同一玩家的并发写入可能使总分略微超出，之后写入 MySQL 时被拒绝并进入死信队列
+// 返回写入后 Redis 中的分数，只入队未修改排行榜时返回 0
+func (s *LeaderboardService) updateScoreRedisFirst(ctx context.Context, req model.UpdateRequest, expiresAt time.Time) (int64, error) {
+	write := &model.PendingScoreWrite{
+		WriteID:     newWriteID(),
+		PlayerID:    req.PlayerID,
+		Name:        req.Name,
+		Reason:      req.Reason,
+		SetAbsolute: req.SetAbsolute,
+		ExpiresAt:   expiresAt,
+		QueuedAt:    time.Now(),
+	}
+	if req.SetAbsolute {
+		write.Score = req.IncrScore
+	} else {
+		write.RawScoreChange = req.IncrScore
+		write.ScoreChange = s.applyReasonMultiplier(req.IncrScore, req.Reason)
+	}
+
+	// 累加时玩家不在总榜上则写入 total，即 MySQL 中的总分加上本次变更
+	var total int64
+	if !req.SetAbsolute && write.ScoreChange != 0 {
+		current, err := s.redisFirstCurrentScore(ctx, req.PlayerID)
+		if err != nil {
+			return 0, err
+		}
+		if total, err = s.checkRedisScoreBound(current, write.ScoreChange); err != nil {
+			return 0, err
+		}
+	}
+
+	blocked, err := s.redisRepo.IsPlayerBlocked(ctx, req.PlayerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check blocklist: %w", err)
+	}
+
+	if blocked || (!req.SetAbsolute && write.ScoreChange == 0) {
+		if err := s.redisRepo.EnqueueScoreWrite(ctx, write); err != nil {
+			return 0, err
+		}
+		s.logger.Info("Score change queued without affecting leaderboard",
+			"playerID", req.PlayerID,
+			"writeID", write.WriteID,
+			"blocked", blocked)
+		return 0, nil
+	}
+
+	score, err := s.redisRepo.WriteScoreAndEnqueue(ctx, write, total)
+	if err != nil {
+		return 0, err
+	}
+
+	if !req.SetAbsolute {
+		if err := s.redisRepo.IncrementWindowScores(ctx, req.PlayerID, write.ScoreChange); err != nil {
+			s.logger.Warn("Failed to update window leaderboards",
+				"playerID", req.PlayerID,
+				"error", err)
+		}
+	}
+
+	s.invalidateCache(ctx, req.PlayerID)
+	s.recordPeakRanks(ctx, req.PlayerID)
+
+	s.logger.Info("Player score updated in redis, mysql write queued",
+		"playerID", req.PlayerID,
+		"writeID", write.WriteID,
+		"scoreChange", write.ScoreChange,
+		"score", score,
+		"setAbsolute", req.SetAbsolute)
+	return score, nil
+}
+
+// 先写 Redis 模式下的到期扣回：冲销变更与普通写入一样先累加到 Redis 总榜并进入写入队列，由后台任务写入 MySQL
+// 被封禁的玩家只入队；时间窗口榜记录的是当期得分，不做扣回
+func (s *LeaderboardService) queueRevertedScore(ctx context.Context, history *model.PlayerScoreHistory, name string) error {
+	write := &model.PendingScoreWrite{
+		WriteID:        newWriteID(),
+		PlayerID:       history.PlayerID,
+		Name:           name,
+		Reason:         history.Reason,
+		RawScoreChange: history.RawScoreChange,
+		ScoreChange:    history.ScoreChange,
+		QueuedAt:       time.Now(),
+	}
+
+	blocked, err := s.redisRepo.IsPlayerBlocked(ctx, history.PlayerID)
+	if err != nil {
+		return fmt.Errorf("failed to check blocklist: %w", err)
+	}
+	if blocked {
+		return s.redisRepo.EnqueueScoreWrite(ctx, write)
+	}
+
+	current, err := s.redisFirstCurrentScore(ctx, history.PlayerID)
+	if err != nil {
+		return err
+	}
+	// 总分超出 int64 范围时玩家一定在总榜上，不会用到 total
+	total, _ := utils.ScoreFromFloat(current)
+	total, _ = utils.AddScore(total, write.ScoreChange)
+	if _, err := s.redisRepo.WriteScoreAndEnqueue(ctx, write, total); err != nil {
+		return err
+	}
+	s.invalidateCache(ctx, history.PlayerID)
+	return nil
+}
+
+// 持续获取和续期写入队列分区的租约，为持有租约的每个分区运行一个 scoreWritePartitionLoop
+// 续期失败或租约已被其他实例获取时停止该分区的处理；退出时释放持有的租约，其他实例无需等待过期即可接管
+// 续期失败到租约过期之间已停止处理，同一分区不会被两个实例同时处理，除非实例暂停超过租约有效期
+func (s *LeaderboardService) scoreWriteLoop(ctx context.Context) {
+	owner := newWriteID()
+	stops := make(map[int]context.CancelFunc)
+	var wg sync.WaitGroup
+	defer func() {
+		for _, stop := range stops {
+			stop()
+		}
+		wg.Wait()
+
+		releaseCtx, cancel := context.WithTimeout(context.Background(), scoreWriteClaimTimeout)
+		defer cancel()
+		for partition := range stops {
+			if err := s.redisRepo.ReleaseScoreWritePartition(releaseCtx, partition, owner); err != nil {
+				s.logger.Warn("Failed to release score write partition", "partition", partition, "error", err)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(scoreWriteLeaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		for partition := 0; partition < repository.ScoreWritePartitions; partition++ {
+			acquired, err := s.redisRepo.AcquireScoreWritePartition(ctx, partition, owner, scoreWriteLeaseTTL)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				s.logger.Error("Failed to renew score write partition lease", "partition", partition, "error", err)
+			}
+
+			stop, running := stops[partition]
+			switch {
+			case acquired && !running:
+				partitionCtx, stop := context.WithCancel(ctx)
+				stops[partition] = stop
+				wg.Add(1)
+				go func(partition int) {
+					defer wg.Done()
+					s.scoreWritePartitionLoop(partitionCtx, partition)
+				}(partition)
+				s.logger.Info("Score write partition acquired", "partition", partition, "owner", owner)
+			case !acquired && running:
+				stop()
+				delete(stops, partition)
+				s.logger.Warn("Score write partition lease lost, stopped processing", "partition", partition, "owner", owner)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 持续从分区取出先写 Redis 的变更按入队顺序写入 MySQL，ctx 在租约丢失或服务关闭时取消
+// 开始前先将上一个租约持有者未确认的变更移回队列头部
+func (s *LeaderboardService) scoreWritePartitionLoop(ctx context.Context, partition int) {
+	// 处理中队列的变更未移回前取出新变更会打乱同一玩家的写入顺序，移回失败时重试
+	for {
+		requeued, err := s.redisRepo.RequeueProcessingScoreWrites(ctx, partition)
+		if err == nil {
+			if requeued > 0 {
+				s.logger.Info("Requeued unacknowledged score writes", "partition", partition, "count", requeued)
+			}
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.Error("Failed to requeue unacknowledged score writes", "partition", partition, "error", err)
+		if !sleepContext(ctx, scoreWriteRetryBackoff) {
+			return
+		}
+	}
+
+	for ctx.Err() == nil {
+		claimed, err := s.redisRepo.ClaimScoreWrite(ctx, partition, scoreWriteClaimTimeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("Failed to claim score write", "partition", partition, "error", err)
+			if !sleepContext(ctx, scoreWriteRetryBackoff) {
+				return
+			}
+			continue
+		}
+		if claimed == nil {
+			continue
+		}
+
+		s.persistScoreWrite(ctx, claimed)
+	}
+}
+
+// 将一条变更写入 MySQL，失败时有限次重试，仍失败则移入死信队列
+// ctx 取消时变更留在处理中队列，下一个获取分区租约的实例将其重新入队
+func (s *LeaderboardService) persistScoreWrite(ctx context.Context, claimed *repository.ClaimedScoreWrite) {
+	write := claimed.PendingScoreWrite
+
+	var err error
+	for attempt := 1; attempt <= scoreWriteMaxAttempts; attempt++ {
+		var history *model.PlayerScoreHistory
+		history, err = s.applyScoreWrite(ctx, write)
+		if err == nil || errors.Is(err, repository.ErrDuplicateEntry) {
+			if ackErr := s.redisRepo.AckScoreWrite(ctx, claimed); ackErr != nil {
+				s.logger.Warn("Failed to ack score write", "writeID", write.WriteID, "error", ackErr)
+			}
+			// 重复投递的变更已在之前写入并发布过事件
+			if err == nil {
+				s.publishScoreChange(ctx, history)
+			}
+			return
+		}
+
+		s.logger.Warn("Failed to persist score write, retrying",
+			"writeID", write.WriteID,
+			"playerID", write.PlayerID,
+			"attempt", attempt,
+			"error", err)
+
+		if attempt == scoreWriteMaxAttempts || !sleepContext(ctx, time.Duration(attempt)*scoreWriteRetryBackoff) {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	scoreWritesDeadLettered.Inc()
+	s.logger.Error("Score write moved to dead-letter queue, leaderboard and mysql are out of sync",
+		"writeID", write.WriteID,
+		"playerID", write.PlayerID,
+		"error", err)
+	if dlqErr := s.redisRepo.DeadLetterScoreWrite(ctx, claimed); dlqErr != nil {
+		s.logger.Error("Failed to dead-letter score write", "writeID", write.WriteID, "error", dlqErr)
+	}
+}
+
+// 先写 Redis 模式下累加前的当前总分：玩家在总榜上时取 Redis 中的分数，
+// 否则（新玩家、Redis 数据丢失）取 MySQL 中的总分，队列中尚未写入 MySQL 的变更不计入
+func (s *LeaderboardService) redisFirstCurrentScore(ctx context.Context, playerID string) (float64, error) {
+	current, err := s.redisRepo.GetPlayerScore(ctx, playerID)
+	if err == nil {
+		return current, nil
+	}
+	if err != repository.ErrPlayerNotFound {
+		return 0, fmt.Errorf("failed to read current score: %w", err)
+	}
+
+	player, err := s.mysqlRepo.GetPlayer(ctx, playerID)
+	if err == repository.ErrPlayerNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read current score from mysql: %w", err)
+	}
+	return float64(player.TotalScore), nil
+}
+
+// 检查当前总分 current 累加 change 后是否超出上限，已超限的总分仍可向 0 调整；返回累加后的总分
+func (s *LeaderboardService) checkRedisScoreBound(current float64, change int64) (int64, error) {
+	currentScore, ok := utils.ScoreFromFloat(current)
+	if !ok {
+		// Redis 中的分数已超出 int64 范围，只允许向 0 调整
+		if (current > 0) == (change > 0) {
+			return 0, fmt.Errorf("%w: current score %.0f is outside the int64 range", ErrScoreOutOfRange, current)
+		}
+		return 0, nil
+	}
+
+	finalScore, ok := utils.AddScore(currentScore, change)
+	if !ok {
+		return 0, fmt.Errorf("%w: %d%+d overflows int64", ErrScoreOutOfRange, currentScore, change)
+	}
+	if utils.AbsScore(finalScore) > s.maxScore && utils.AbsScore(finalScore) > utils.AbsScore(currentScore) {
+		return 0, fmt.Errorf("%w: %d exceeds the limit of %d", ErrScoreOutOfRange, finalScore, s.maxScore)
+	}
+	return finalScore, nil
+}
+
+// 按变更类型写入 MySQL，返回写入的分数历史
+func (s *LeaderboardService) applyScoreWrite(ctx context.Context, write *model.PendingScoreWrite) (*model.PlayerScoreHistory, error) {
+	history := &model.PlayerScoreHistory{
+		PlayerID: write.PlayerID,
+		Reason:   write.Reason,
+		WriteID:  write.WriteID,
+	}
+
+	var err error
+	if write.SetAbsolute {
+		_, err = s.mysqlRepo.SetPlayerScore(ctx, write.Name, history, write.Score)
+	} else {
+		history.RawScoreChange = write.RawScoreChange
+		history.ScoreChange = write.ScoreChange
+		_, err = s.mysqlRepo.ApplyScoreChange(ctx, write.Name, history, write.ExpiresAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// GetScoreWriteQueue 获取异步写入队列的状态，以及死信队列中最早的 limit 条变更
+func (s *LeaderboardService) GetScoreWriteQueue(ctx context.Context, limit int64) (*model.ScoreWriteQueueStats, []*model.PendingScoreWrite, error) {
+	stats, err := s.redisRepo.GetScoreWriteQueueStats(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dead, err := s.redisRepo.GetDeadScoreWrites(ctx, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stats, dead, nil
+}
+
+// RetryDeadScoreWrites 将死信队列中的变更全部重新加入待写入队列，返回重新入队的条数
+// 已经写入过 MySQL 的变更会按 write_id 去重，不会重复计分
+func (s *LeaderboardService) RetryDeadScoreWrites(ctx context.Context) (int64, error) {
+	requeued, err := s.redisRepo.RequeueDeadScoreWrites(ctx)
+	if err != nil {
+		return requeued, err
+	}
+
+	s.logger.Info("Dead score writes requeued", "count", requeued)
+	return requeued, nil
+}
+
+// 异步写入变更的唯一ID
+func newWriteID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// 等待 d 或 ctx 取消，ctx 取消时返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
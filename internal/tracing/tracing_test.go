@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetupExportsSpans(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Content-Type"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	ctx := context.Background()
+	shutdown, err := Setup(ctx, collector.URL+"/v1/traces", "game-leaderboard-test")
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(ctx, "service.UpdateScore")
+	span.End()
+
+	// 关闭时导出批处理中剩余的 span
+	if err := shutdown(ctx); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 || requests[0] != "POST /v1/traces application/x-protobuf" {
+		t.Errorf("collector requests = %q, want one POST /v1/traces", requests)
+	}
+}
@@ -0,0 +1,5 @@
+-- 分数历史记录原始增量（应用原因倍率之前），score_change 保存实际计入总分的增量
+ALTER TABLE player_score_history
+    ADD COLUMN raw_score_change BIGINT NOT NULL DEFAULT 0 AFTER player_id;
+
+UPDATE player_score_history SET raw_score_change = score_change;
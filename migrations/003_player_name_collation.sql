@@ -0,0 +1,5 @@
+-- 玩家名称使用 Unicode 感知的排序规则（MySQL 8.0+），保证中日韩及带重音字符的名称
+-- 按语言规则排序，并且前缀匹配不区分大小写和重音（如 "Jose" 可匹配 "José"）
+ALTER TABLE players
+    MODIFY name VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL DEFAULT '',
+    ADD INDEX idx_name (name);
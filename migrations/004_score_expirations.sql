@@ -0,0 +1,14 @@
+-- 带有效期的分数变更（如活动奖励），到期后由后台任务从总分中扣回并记录一条冲销历史
+-- reverted_at 为空表示尚未处理；玩家总分被直接覆盖（setAbsolute）时未到期的记录会被删除
+CREATE TABLE IF NOT EXISTS score_expirations (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    player_id VARCHAR(64) NOT NULL,
+    score_change BIGINT NOT NULL,
+    reason VARCHAR(255) DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    reverted_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_pending (reverted_at, expires_at),
+    INDEX idx_player_id (player_id),
+    FOREIGN KEY (player_id) REFERENCES players(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
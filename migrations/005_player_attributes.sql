@@ -0,0 +1,7 @@
+-- 玩家属性（国家/地区、等级），用于计算玩家在筛选子集中的排名
+-- idx_country_score 覆盖按国家筛选后统计高于某分数的人数
+ALTER TABLE players
+    ADD COLUMN country VARCHAR(16) NOT NULL DEFAULT '' AFTER name,
+    ADD COLUMN level INT NOT NULL DEFAULT 0 AFTER country,
+    ADD INDEX idx_country_score (country, total_score DESC),
+    ADD INDEX idx_level_score (level, total_score DESC);
@@ -0,0 +1,5 @@
+-- 先写 Redis 模式下每次分数变更的唯一ID，异步写入 MySQL 时用于去重，重复投递的变更不会被重复计入
+-- 同步写入的历史记录该列为空，唯一索引允许多个 NULL
+ALTER TABLE player_score_history
+    ADD COLUMN write_id VARCHAR(64) NULL AFTER reason,
+    ADD UNIQUE INDEX uk_write_id (write_id);
@@ -2,6 +2,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -11,16 +12,54 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-func NewMySQLConnection(dsn string, maxConns int) (*sqlx.DB, error) {
+// MySQLPoolOptions 连接池配置
+type MySQLPoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime 空闲超过该时间的连接在下次取用前被关闭，应短于服务端 wait_timeout 和防火墙的空闲超时
+	ConnMaxIdleTime time.Duration
+}
+
+func NewMySQLConnection(dsn string, opts MySQLPoolOptions) (*sqlx.DB, error) {
 	db, err := sqlx.Connect("mysql", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to mysql: %w", err)
 	}
 
-	db.SetMaxOpenConns(maxConns)
-	db.SetMaxIdleConns(maxConns / 2)
-	db.SetConnMaxLifetime(30 * time.Minute)
+	configureMySQLPool(db, opts)
 
 	logger.NewLogger("database").Info("MySQL connection established")
 	return db, nil
 }
+
+func configureMySQLPool(db *sqlx.DB, opts MySQLPoolOptions) {
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+}
+
+// StartMySQLKeepalive 每隔 interval ping 一次 MySQL，使连接池在低流量时段保持可用连接并尽早发现失效连接，ctx 取消时停止
+func StartMySQLKeepalive(ctx context.Context, db *sqlx.DB, interval time.Duration) {
+	log := logger.NewLogger("database")
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pingCtx, cancel := context.WithTimeout(ctx, interval)
+				err := db.PingContext(pingCtx)
+				cancel()
+				if err != nil && ctx.Err() == nil {
+					log.Warn("MySQL keepalive ping failed", "error", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 模拟 MySQL 服务端的 wait_timeout：空闲超过 timeout 的连接被服务端断开，之后的请求返回 invalid connection
+type idleServer struct {
+	timeout time.Duration
+
+	mu     sync.Mutex
+	opened int
+}
+
+func (s *idleServer) Connect(context.Context) (driver.Conn, error) {
+	s.mu.Lock()
+	s.opened++
+	s.mu.Unlock()
+	return &idleConn{server: s, lastUsed: time.Now()}, nil
+}
+
+func (s *idleServer) Driver() driver.Driver { return idleDriver{} }
+
+func (s *idleServer) Opened() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opened
+}
+
+type idleDriver struct{}
+
+func (idleDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("idleServer: use sql.OpenDB")
+}
+
+type idleConn struct {
+	server   *idleServer
+	mu       sync.Mutex
+	lastUsed time.Time
+}
+
+// 与 go-sql-driver/mysql 一致，连接已被服务端关闭时返回的不是 driver.ErrBadConn，database/sql 不会自动重试
+func (c *idleConn) use() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.lastUsed) > c.server.timeout {
+		return errors.New("invalid connection")
+	}
+	c.lastUsed = time.Now()
+	return nil
+}
+
+func (c *idleConn) Ping(ctx context.Context) error { return c.use() }
+
+func (c *idleConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.use(); err != nil {
+		return nil, err
+	}
+	return &oneRow{}, nil
+}
+
+func (c *idleConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("idleServer: prepared statements are not supported")
+}
+func (c *idleConn) Close() error { return nil }
+func (c *idleConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("idleServer: transactions are not supported")
+}
+
+// SELECT 1 的结果
+type oneRow struct{ done bool }
+
+func (r *oneRow) Columns() []string { return []string{"1"} }
+func (r *oneRow) Close() error      { return nil }
+func (r *oneRow) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func TestMySQLPoolSurvivesIdlePeriod(t *testing.T) {
+	const serverTimeout = 200 * time.Millisecond
+
+	tests := []struct {
+		name      string
+		opts      MySQLPoolOptions
+		keepalive time.Duration
+		idle      time.Duration
+		wantErr   bool
+	}{
+		{
+			name:    "stale connection surfaces an error",
+			opts:    MySQLPoolOptions{MaxOpenConns: 1, MaxIdleConns: 1},
+			idle:    300 * time.Millisecond,
+			wantErr: true,
+		},
+		{
+			// database/sql 至少每秒清理一次空闲连接
+			name: "idle timeout closes the connection first",
+			opts: MySQLPoolOptions{MaxOpenConns: 1, MaxIdleConns: 1, ConnMaxIdleTime: 50 * time.Millisecond},
+			idle: 1300 * time.Millisecond,
+		},
+		{
+			name:      "keepalive keeps the connection alive",
+			opts:      MySQLPoolOptions{MaxOpenConns: 1, MaxIdleConns: 1},
+			keepalive: 20 * time.Millisecond,
+			idle:      300 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := &idleServer{timeout: serverTimeout}
+			db := sqlx.NewDb(sql.OpenDB(server), "mysql")
+			t.Cleanup(func() { db.Close() })
+			configureMySQLPool(db, tt.opts)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			if tt.keepalive > 0 {
+				StartMySQLKeepalive(ctx, db, tt.keepalive)
+			}
+
+			var n int
+			if err := db.GetContext(ctx, &n, "SELECT 1"); err != nil {
+				t.Fatalf("first query error = %v", err)
+			}
+
+			time.Sleep(tt.idle)
+
+			err := db.GetContext(ctx, &n, "SELECT 1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("query after idle error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.opts.ConnMaxIdleTime > 0 && server.Opened() != 2 {
+				t.Errorf("connections opened = %d, want 2", server.Opened())
+			}
+		})
+	}
+}
@@ -10,21 +10,108 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
-func NewRedisConnection(addr, password string, db int) (*redis.Client, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
-		PoolSize: 100,
-	})
+// Redis 部署模式
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
+// RedisTopology Redis 部署方式，Mode 为空时按 single 处理
+// single 连接 addr；sentinel 通过 SentinelAddrs 中的哨兵发现 MasterName 的主节点，故障切换后自动重连新的主节点；
+// cluster 以 ClusterAddrs 为种子节点发现集群拓扑，不支持选择 db
+type RedisTopology struct {
+	Mode             string
+	MasterName       string
+	SentinelAddrs    []string
+	SentinelPassword string
+	ClusterAddrs     []string
+}
+
+// RedisPoolOptions 连接池配置，超时为 0 时使用 go-redis 的默认值
+type RedisPoolOptions struct {
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// OpTimeout 单条命令（pipeline 整体，包括等待连接）的最长耗时，调用方的 ctx 截止时间更早时以其为准，为 0 时不限制
+	OpTimeout time.Duration
+}
+
+// 客户端不重试任何命令：ZINCRBY、EVAL 等非幂等写入在连接断开前可能已经执行，重试会重复生效
+// 幂等命令的重试由 repository.RedisRepository 负责；go-redis 中 MaxRetries 为 0 表示使用默认值 3，-1 才表示不重试
+const redisClientMaxRetries = -1
+
+// NewRedisConnection 按 topology 创建单节点、哨兵或集群客户端，三者都实现 redis.UniversalClient
+func NewRedisConnection(addr, password string, db int, topology RedisTopology, opts RedisPoolOptions) (redis.UniversalClient, error) {
+	client, err := newRedisClient(addr, password, db, topology, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	logger.NewLogger("database").Info("Redis connection established")
+	logger.NewLogger("database").Info("Redis connection established", "mode", topology.Mode)
+	return client, nil
+}
+
+// 按 topology 创建客户端，不建立连接
+func newRedisClient(addr, password string, db int, topology RedisTopology, opts RedisPoolOptions) (redis.UniversalClient, error) {
+	var client redis.UniversalClient
+	switch topology.Mode {
+	case "", RedisModeSingle:
+		client = redis.NewClient(&redis.Options{
+			Addr:         addr,
+			Password:     password,
+			DB:           db,
+			PoolSize:     opts.PoolSize,
+			MinIdleConns: opts.MinIdleConns,
+			DialTimeout:  opts.DialTimeout,
+			ReadTimeout:  opts.ReadTimeout,
+			WriteTimeout: opts.WriteTimeout,
+			MaxRetries:   redisClientMaxRetries,
+		})
+	case RedisModeSentinel:
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       topology.MasterName,
+			SentinelAddrs:    topology.SentinelAddrs,
+			SentinelPassword: topology.SentinelPassword,
+			Password:         password,
+			DB:               db,
+			PoolSize:         opts.PoolSize,
+			MinIdleConns:     opts.MinIdleConns,
+			DialTimeout:      opts.DialTimeout,
+			ReadTimeout:      opts.ReadTimeout,
+			WriteTimeout:     opts.WriteTimeout,
+			MaxRetries:       redisClientMaxRetries,
+		})
+	case RedisModeCluster:
+		// 槽位迁移时的 MOVED/ASK 重定向（命令未执行）仍按 go-redis 默认最多跟随 3 次；
+		// go-redis 在同一循环中也会对连接错误重新发送命令，无法单独关闭
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        topology.ClusterAddrs,
+			Password:     password,
+			PoolSize:     opts.PoolSize,
+			MinIdleConns: opts.MinIdleConns,
+			DialTimeout:  opts.DialTimeout,
+			ReadTimeout:  opts.ReadTimeout,
+			WriteTimeout: opts.WriteTimeout,
+			MaxRetries:   redisClientMaxRetries,
+		})
+	default:
+		return nil, fmt.Errorf("unknown redis mode: %s", topology.Mode)
+	}
+
+	if opts.OpTimeout > 0 {
+		client.AddHook(opTimeoutHook{timeout: opts.OpTimeout})
+	}
 	return client, nil
 }
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 按部署模式创建对应的客户端，客户端本身不重试命令（go-redis 初始化后 MaxRetries 不大于 0）
+func TestNewRedisClient(t *testing.T) {
+	tests := []struct {
+		name     string
+		topology RedisTopology
+		db       int
+		wantErr  bool
+		check    func(t *testing.T, client redis.UniversalClient)
+	}{
+		{
+			name:     "single",
+			topology: RedisTopology{Mode: RedisModeSingle},
+			db:       2,
+			check: func(t *testing.T, client redis.UniversalClient) {
+				c, ok := client.(*redis.Client)
+				if !ok {
+					t.Fatalf("client is %T, want *redis.Client", client)
+				}
+				if opt := c.Options(); opt.Addr != "redis:6379" || opt.DB != 2 || opt.MaxRetries > 0 {
+					t.Errorf("options = addr %q db %d maxRetries %d, want redis:6379, 2, no retries", opt.Addr, opt.DB, opt.MaxRetries)
+				}
+			},
+		},
+		{
+			name:     "sentinel",
+			topology: RedisTopology{Mode: RedisModeSentinel, MasterName: "mymaster", SentinelAddrs: []string{"sentinel:26379"}},
+			check: func(t *testing.T, client redis.UniversalClient) {
+				c, ok := client.(*redis.Client)
+				if !ok {
+					t.Fatalf("client is %T, want *redis.Client", client)
+				}
+				if got := c.Options().MaxRetries; got > 0 {
+					t.Errorf("MaxRetries = %d, want no retries", got)
+				}
+			},
+		},
+		{
+			name:     "cluster",
+			topology: RedisTopology{Mode: RedisModeCluster, ClusterAddrs: []string{"redis-0:6379", "redis-1:6379"}},
+			check: func(t *testing.T, client redis.UniversalClient) {
+				c, ok := client.(*redis.ClusterClient)
+				if !ok {
+					t.Fatalf("client is %T, want *redis.ClusterClient", client)
+				}
+				opt := c.Options()
+				if got := strings.Join(opt.Addrs, ","); got != "redis-0:6379,redis-1:6379" {
+					t.Errorf("Addrs = %q, want redis-0:6379,redis-1:6379", got)
+				}
+				if opt.MaxRetries > 0 {
+					t.Errorf("MaxRetries = %d, want no retries", opt.MaxRetries)
+				}
+			},
+		},
+		{
+			name:     "unknown mode",
+			topology: RedisTopology{Mode: "replica"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newRedisClient("redis:6379", "", tt.db, tt.topology, RedisPoolOptions{PoolSize: 4})
+			if tt.wantErr {
+				if err == nil {
+					client.Close()
+					t.Fatal("newRedisClient() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newRedisClient() error = %v", err)
+			}
+			defer client.Close()
+			tt.check(t, client)
+		})
+	}
+}
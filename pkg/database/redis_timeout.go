@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type opTimeoutCancelKey struct{}
+
+// 阻塞命令的等待时长由命令参数决定，不受单次操作超时限制
+var blockingCommands = map[string]bool{
+	"blpop":      true,
+	"brpop":      true,
+	"brpoplpush": true,
+	"blmove":     true,
+	"bzpopmin":   true,
+	"bzpopmax":   true,
+}
+
+// opTimeoutHook 为没有更早截止时间的 Redis 命令（pipeline 整体）设置截止时间
+// go-redis 按 ctx 的截止时间设置连接读写超时，超时后命令连同重试一起中止，返回 context.DeadlineExceeded
+type opTimeoutHook struct {
+	timeout time.Duration
+}
+
+var _ redis.Hook = opTimeoutHook{}
+
+func (h opTimeoutHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if blockingCommands[cmd.Name()] {
+		return ctx, nil
+	}
+	return h.withTimeout(ctx), nil
+}
+
+func (h opTimeoutHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	cancelOpTimeout(ctx)
+	return nil
+}
+
+func (h opTimeoutHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return h.withTimeout(ctx), nil
+}
+
+func (h opTimeoutHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	cancelOpTimeout(ctx)
+	return nil
+}
+
+// 调用方已设置更早的截止时间时保持不变
+func (h opTimeoutHook) withTimeout(ctx context.Context) context.Context {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= h.timeout {
+		return ctx
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	return context.WithValue(ctx, opTimeoutCancelKey{}, cancel)
+}
+
+func cancelOpTimeout(ctx context.Context) {
+	if cancel, ok := ctx.Value(opTimeoutCancelKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"game-leaderboard/internal/repository/repotest/resp"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis 响应慢时，命令和 pipeline 在 OpTimeout 到达时中止；阻塞命令和调用方更早的截止时间不受影响
+func TestOpTimeoutHook(t *testing.T) {
+	const delay = 300 * time.Millisecond
+	server := resp.NewServer(func(args []string) interface{} {
+		time.Sleep(delay)
+		if args[0] == "BRPOP" {
+			return nil
+		}
+		return "OK"
+	})
+	client := server.NewClient()
+	defer client.Close()
+	client.AddHook(opTimeoutHook{timeout: 50 * time.Millisecond})
+
+	// 超时错误为 context.DeadlineExceeded 或连接读超时
+	isTimeout := func(err error) bool {
+		var netErr net.Error
+		return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+	}
+	ctx := context.Background()
+
+	t.Run("command", func(t *testing.T) {
+		start := time.Now()
+		err := client.Set(ctx, "k", "v", 0).Err()
+		if elapsed := time.Since(start); elapsed >= delay {
+			t.Errorf("SET took %v, want it aborted before the %v reply", elapsed, delay)
+		}
+		if !isTimeout(err) {
+			t.Errorf("SET error = %v, want a timeout", err)
+		}
+	})
+
+	t.Run("pipeline", func(t *testing.T) {
+		start := time.Now()
+		_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "a", "1", 0)
+			pipe.Set(ctx, "b", "2", 0)
+			return nil
+		})
+		if elapsed := time.Since(start); elapsed >= delay {
+			t.Errorf("pipeline took %v, want it aborted before the %v reply", elapsed, delay)
+		}
+		if !isTimeout(err) {
+			t.Errorf("pipeline error = %v, want a timeout", err)
+		}
+	})
+
+	t.Run("caller deadline is longer than the reply", func(t *testing.T) {
+		// 调用方的截止时间晚于 OpTimeout 时仍以 OpTimeout 为准
+		callerCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		if err := client.Set(callerCtx, "k", "v", 0).Err(); !isTimeout(err) {
+			t.Errorf("SET error = %v, want a timeout", err)
+		}
+	})
+
+	t.Run("blocking command is exempt", func(t *testing.T) {
+		err := client.BRPop(ctx, time.Second, "queue").Err()
+		if isTimeout(err) {
+			t.Errorf("BRPOP error = %v, want it to wait past the op timeout", err)
+		}
+	})
+}
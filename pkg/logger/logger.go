@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"os"
 	"runtime"
 	"strings"
@@ -51,8 +52,8 @@ func NewLogger(name string) *Logger {
 
 	// 创建核心
 	core := zapcore.NewCore(
-		zapcore.NewJSONEncoder(encoderConfig),
-		zapcore.AddSync(os.Stdout),
+		newEncoder(encoderConfig),
+		output,
 		level,
 	)
 
@@ -79,6 +80,29 @@ func (l *Logger) WithFields(fields map[string]interface{}) *Logger {
 	}
 }
 
+// requestIDKey 请求ID在 context 中的 key
+type requestIDKey struct{}
+
+// ContextWithRequestID 返回携带请求ID的 context
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext 获取 context 中的请求ID，不存在时返回空字符串
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// WithContext 如果 ctx 中带有请求ID，返回附加了 request_id 字段的日志记录器
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	requestID := RequestIDFromContext(ctx)
+	if requestID == "" {
+		return l
+	}
+	return l.WithFields(map[string]interface{}{"request_id": requestID})
+}
+
 // Debug 调试日志
 func (l *Logger) Debug(msg string, keysAndValues ...interface{}) {
 	l.SugaredLogger.Debugw(msg, l.addDefaultFields(keysAndValues)...)
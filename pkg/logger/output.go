@@ -0,0 +1,289 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// 日志输出目标
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+)
+
+// 日志格式
+const (
+	FormatJSON    = "json"    // 每行一个 JSON 对象（默认）
+	FormatConsole = "console" // 便于阅读的文本格式，用于本地开发
+)
+
+// OutputOptions 日志输出配置
+type OutputOptions struct {
+	// Output 为 stdout（默认）、stderr 或 file
+	Output string
+	// File Output 为 file 时写入的文件路径，目录不存在时自动创建
+	File string
+	// MaxSizeMB 单个日志文件的最大大小，超过后将当前文件重命名为带时间戳的备份并新建文件，为 0 时不轮转
+	MaxSizeMB int
+	// MaxBackups 最多保留的备份文件数，MaxAgeDays 备份文件最长保留天数，为 0 时不限
+	MaxBackups int
+	MaxAgeDays int
+
+	// Format 为 json（默认）或 console；Color 为 true 且输出到终端（stdout、stderr）时 console 格式的日志级别带颜色
+	Format string
+	Color  bool
+}
+
+// 当前的日志格式，Configure 之后创建的日志记录器使用
+var (
+	formatMu     sync.RWMutex
+	format       = FormatJSON
+	colorConsole bool
+)
+
+// 所有日志记录器共用的输出，Configure 之前写入 stdout
+var output = &switchableOutput{w: os.Stdout}
+
+// 可在运行时切换目标的输出，包初始化时创建的日志记录器在 Configure 之后也写入新的目标
+type switchableOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (o *switchableOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.w.Write(p)
+}
+
+func (o *switchableOutput) Sync() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if s, ok := o.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// set 切换输出目标，之前的目标是文件时将其关闭
+func (o *switchableOutput) set(w io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if old, ok := o.w.(*rotatingFile); ok && old != w {
+		old.Close()
+	}
+	o.w = w
+}
+
+// Configure 设置所有日志记录器的输出目标和格式，在加载配置后、创建其他日志记录器之前调用
+// 输出目标对已创建的日志记录器同样生效，格式只影响之后创建的日志记录器
+func Configure(opts OutputOptions) error {
+	switch opts.Format {
+	case "", FormatJSON, FormatConsole:
+	default:
+		return fmt.Errorf("unknown log format: %s", opts.Format)
+	}
+
+	switch opts.Output {
+	case "", OutputStdout:
+		output.set(os.Stdout)
+	case OutputStderr:
+		output.set(os.Stderr)
+	case OutputFile:
+		if opts.File == "" {
+			return fmt.Errorf("log file path is required when output is %s", OutputFile)
+		}
+		f, err := newRotatingFile(opts)
+		if err != nil {
+			return err
+		}
+		output.set(f)
+	default:
+		return fmt.Errorf("unknown log output: %s", opts.Output)
+	}
+
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	format = opts.Format
+	if format == "" {
+		format = FormatJSON
+	}
+	colorConsole = opts.Color && opts.Output != OutputFile
+	return nil
+}
+
+// 按当前的日志格式创建编码器
+func newEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	formatMu.RLock()
+	defer formatMu.RUnlock()
+
+	if format != FormatConsole {
+		return zapcore.NewJSONEncoder(cfg)
+	}
+	if colorConsole {
+		cfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	} else {
+		cfg.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+	return zapcore.NewConsoleEncoder(cfg)
+}
+
+// rotatingFile 按大小轮转的日志文件
+// 备份文件名为原文件名加上轮转时间，如 app-2024-06-01T15-04-05.000.log，按保留数量和天数清理
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+
+	file *os.File
+	size int64
+}
+
+// 备份文件名中的时间格式
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+func newRotatingFile(opts OutputOptions) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:       opts.File,
+		maxSize:    int64(opts.MaxSizeMB) * 1024 * 1024,
+		maxBackups: opts.MaxBackups,
+		maxAge:     time.Duration(opts.MaxAgeDays) * 24 * time.Hour,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// 打开（或创建）日志文件并在末尾追加
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write 由 switchableOutput 加锁调用
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			// 轮转失败时继续写入当前文件，不丢失日志
+			fmt.Fprintf(os.Stderr, "failed to rotate log file: %v\n", err)
+			if f.file == nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Sync() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+func (f *rotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// 将当前文件重命名为备份并新建文件，然后清理过多或过旧的备份
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	f.file = nil
+
+	ext := filepath.Ext(f.path)
+	backup := strings.TrimSuffix(f.path, ext) + "-" + time.Now().Format(backupTimeFormat) + ext
+	if err := os.Rename(f.path, backup); err != nil {
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rename log file: %w", err)
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.removeOldBackups()
+	return nil
+}
+
+// 删除超出保留数量或保留天数的备份文件
+func (f *rotatingFile) removeOldBackups() {
+	if f.maxBackups <= 0 && f.maxAge <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), ext) + "-"
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		name      string
+		rotatedAt time.Time
+	}
+	var backups []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		rotatedAt, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext), time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: name, rotatedAt: rotatedAt})
+	}
+	// 新的在前
+	sort.Slice(backups, func(i, j int) bool { return backups[i].rotatedAt.After(backups[j].rotatedAt) })
+
+	cutoff := time.Now().Add(-f.maxAge)
+	for i, b := range backups {
+		if (f.maxBackups > 0 && i >= f.maxBackups) || (f.maxAge > 0 && b.rotatedAt.Before(cutoff)) {
+			os.Remove(filepath.Join(filepath.Dir(f.path), b.name))
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package logger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 将日志写入临时文件，返回文件路径；测试结束时恢复默认输出
+func configureFile(t *testing.T, opts OutputOptions) string {
+	t.Helper()
+
+	opts.Output = OutputFile
+	opts.File = filepath.Join(t.TempDir(), "app.log")
+	if err := Configure(opts); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	t.Cleanup(func() { Configure(OutputOptions{}) })
+	return opts.File
+}
+
+func TestEncoderFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     OutputOptions
+		wantJSON bool
+	}{
+		{name: "default is json", opts: OutputOptions{}, wantJSON: true},
+		{name: "json", opts: OutputOptions{Format: FormatJSON}, wantJSON: true},
+		{name: "console", opts: OutputOptions{Format: FormatConsole}},
+		{name: "console ignores color for files", opts: OutputOptions{Format: FormatConsole, Color: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := configureFile(t, tt.opts)
+
+			NewLogger("test").Info("player updated", "playerID", "p1")
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			line := strings.TrimSpace(string(data))
+
+			var entry map[string]interface{}
+			isJSON := json.Unmarshal([]byte(line), &entry) == nil
+			if isJSON != tt.wantJSON {
+				t.Fatalf("log line %q: json = %v, want %v", line, isJSON, tt.wantJSON)
+			}
+
+			if tt.wantJSON {
+				if entry["message"] != "player updated" || entry["level"] != "info" || entry["playerID"] != "p1" {
+					t.Errorf("json entry = %v, want message, level and playerID fields", entry)
+				}
+				return
+			}
+			if !strings.Contains(line, "\tINFO\t") || !strings.Contains(line, "player updated") {
+				t.Errorf("console line = %q, want tab-separated INFO level and message", line)
+			}
+			if strings.Contains(line, "\x1b[") {
+				t.Errorf("console line = %q, want no color codes in a file", line)
+			}
+		})
+	}
+}
+
+func TestConfigureRejectsUnknownFormat(t *testing.T) {
+	if err := Configure(OutputOptions{Format: "xml"}); err == nil {
+		t.Fatal("Configure() with unknown format succeeded, want error")
+	}
+}
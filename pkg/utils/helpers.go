@@ -4,11 +4,51 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"math/rand"
+	"strings"
 	"time"
+	"unicode"
 	"unicode/utf8"
 )
 
+// MaxPlayerIDLength 玩家ID的最大字符数，与 players.id 列一致
+const MaxPlayerIDLength = 64
+
+// MaxExactScore float64 能精确表示的最大整数（2^53）
+// Redis 有序集合以 float64 保存分数，绝对值超过该值后相邻的整数分数无法区分，排名和读回的总分都会失真
+const MaxExactScore int64 = 1 << 53
+
+// AddScore 返回 a+b，结果超出 int64 范围时 ok 为 false
+func AddScore(a, b int64) (sum int64, ok bool) {
+	sum = a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, false
+	}
+	return sum, true
+}
+
+// AbsScore 返回分数的绝对值，math.MinInt64 按 math.MaxInt64 处理
+func AbsScore(score int64) int64 {
+	if score == math.MinInt64 {
+		return math.MaxInt64
+	}
+	if score < 0 {
+		return -score
+	}
+	return score
+}
+
+// ScoreFromFloat 将 Redis 中以 float64 保存的分数四舍五入为整数，NaN、无穷大或超出 int64 范围时 ok 为 false
+func ScoreFromFloat(f float64) (score int64, ok bool) {
+	f = math.Round(f)
+	// float64(math.MaxInt64) 向上取整为 2^63，等于该值时已超出范围
+	if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
 // GeneratePlayerID 生成玩家ID
 func GeneratePlayerID(prefix string) string {
 	timestamp := time.Now().UnixNano()
@@ -19,18 +59,23 @@ func GeneratePlayerID(prefix string) string {
 	return hex.EncodeToString(hash[:8]) // 取前8位
 }
 
-// ValidatePlayerID 验证玩家ID格式
+// ValidatePlayerID 验证玩家ID格式：非空、不超过 MaxPlayerIDLength 个字符、是合法的 UTF-8，
+// 不含控制字符且不全是空白
 func ValidatePlayerID(playerID string) bool {
-	if playerID == "" {
+	if playerID == "" || strings.TrimSpace(playerID) == "" {
 		return false
 	}
 
-	// 简单的长度和字符验证
-	if utf8.RuneCountInString(playerID) > 64 {
+	if !utf8.ValidString(playerID) || utf8.RuneCountInString(playerID) > MaxPlayerIDLength {
 		return false
 	}
 
-	// 可以添加更多的验证逻辑
+	for _, r := range playerID {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestScoreFromFloat(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     float64
+		want   int64
+		wantOK bool
+	}{
+		{"integer", 42, 42, true},
+		{"negative", -7, -7, true},
+		{"rounds half away from zero", 2.5, 3, true},
+		{"max exact score", float64(MaxExactScore), MaxExactScore, true},
+		{"NaN", math.NaN(), 0, false},
+		{"positive infinity", math.Inf(1), 0, false},
+		{"negative infinity", math.Inf(-1), 0, false},
+		{"beyond int64", 1e19, 0, false},
+		{"int64 max rounds up to 2^63", float64(math.MaxInt64), 0, false},
+		{"int64 min", float64(math.MinInt64), math.MinInt64, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ScoreFromFloat(tt.in)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("ScoreFromFloat(%v) = (%d, %v), want (%d, %v)", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidatePlayerID(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want bool
+	}{
+		{"ascii", "player_1", true},
+		{"non-ascii", "玩家-42", true},
+		{"inner space", "alice smith", true},
+		{"empty", "", false},
+		{"only spaces", "   ", false},
+		{"only tabs and newlines", "\t\n", false},
+		{"newline", "alice\nbob", false},
+		{"null byte", "alice\x00", false},
+		{"escape sequence", "\x1b[31malice", false},
+		{"delete", "alice\x7f", false},
+		{"invalid utf-8", "alice\xff", false},
+		{"max length", strings.Repeat("a", MaxPlayerIDLength), true},
+		{"max length in runes", strings.Repeat("玩", MaxPlayerIDLength), true},
+		{"over max length", strings.Repeat("a", MaxPlayerIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidatePlayerID(tt.in); got != tt.want {
+				t.Fatalf("ValidatePlayerID(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   int64
+		want   int64
+		wantOK bool
+	}{
+		{"small", 40, 2, 42, true},
+		{"max exact score plus one", MaxExactScore, 1, MaxExactScore + 1, true},
+		{"int64 max plus zero", math.MaxInt64, 0, math.MaxInt64, true},
+		{"int64 max plus one", math.MaxInt64, 1, 0, false},
+		{"int64 max plus a large increment", math.MaxInt64, MaxExactScore, 0, false},
+		{"int64 max minus one", math.MaxInt64, -1, math.MaxInt64 - 1, true},
+		{"int64 min minus one", math.MinInt64, -1, 0, false},
+		{"int64 min plus int64 max", math.MinInt64, math.MaxInt64, -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := AddScore(tt.a, tt.b)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("AddScore(%d, %d) = (%d, %v), want (%d, %v)", tt.a, tt.b, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}